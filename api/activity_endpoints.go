@@ -0,0 +1,37 @@
+package api
+
+import (
+	"github.com/pkg/errors"
+	"time"
+)
+
+// A single action performed on a server, reported to the Panel for the activity log of the
+// server.
+type ActivityRecord struct {
+	Server string `json:"server"`
+	Event  string `json:"event"`
+
+	// The user that performed the action, and the IP address they performed it from, if known.
+	// Actions performed through the Panel API are made by the Panel itself, which records the
+	// user on its end.
+	User string `json:"user,omitempty"`
+	Ip   string `json:"ip,omitempty"`
+
+	Metadata  map[string]interface{} `json:"metadata,omitempty"`
+	Timestamp time.Time              `json:"timestamp"`
+}
+
+// Sends a batch of activity records to the Panel.
+func (r *Request) SendActivity(records []ActivityRecord) error {
+	resp, err := r.Post("/activity", D{"data": records})
+	if err != nil {
+		return errors.WithStack(err)
+	}
+	defer resp.Body.Close()
+
+	if resp.HasError() {
+		return resp.Error()
+	}
+
+	return nil
+}
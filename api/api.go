@@ -15,11 +15,17 @@ import (
 	"time"
 )
 
-// Initializes the requester instance.
+// Initializes the requester instance for the primary Panel.
 func New() *Request {
 	return &Request{}
 }
 
+// Initializes the requester instance for the Panel with the given name. An empty name
+// uses the primary Panel.
+func NewForPanel(panel string) *Request {
+	return &Request{panel: panel}
+}
+
 // A generic type allowing for easy binding use when making requests to API endpoints
 // that only expect a singular argument or something that would not benefit from being
 // a typed struct.
@@ -31,7 +37,10 @@ type D map[string]interface{}
 type Q map[string]string
 
 // A custom API requester struct for Claws.
-type Request struct{}
+type Request struct {
+	// The name of the Panel that requests are made to.
+	panel string
+}
 
 // A custom response type that allows for commonly used error handling and response
 // parsing from the Panel API. This just embeds the normal HTTP response from Go and
@@ -55,11 +64,21 @@ func (r *Request) Client() *http.Client {
 	return &http.Client{Timeout: time.Second * time.Duration(config.Get().RemoteQuery.Timeout)}
 }
 
+// Returns the configuration for the Panel that requests are made to. If the Panel has since
+// been removed from the configuration the primary Panel is used.
+func (r *Request) Panel() config.PanelConfiguration {
+	if p, ok := config.Get().GetPanel(r.panel); ok {
+		return p
+	}
+
+	return config.Get().PrimaryPanel()
+}
+
 // Returns the given endpoint formatted as a URL to the Panel API.
 func (r *Request) Endpoint(endpoint string) string {
 	return fmt.Sprintf(
 		"%s/api/remote/%s",
-		strings.TrimSuffix(config.Get().PanelLocation, "/"),
+		strings.TrimSuffix(r.Panel().PanelLocation, "/"),
 		strings.TrimPrefix(strings.TrimPrefix(endpoint, "/"), "api/remote/"),
 	)
 }
@@ -72,10 +91,12 @@ func (r *Request) Make(method, url string, body io.Reader, opts ...func(r *http.
 		return nil, errors.WithStack(err)
 	}
 
-	req.Header.Set("User-Agent", fmt.Sprintf("Panther Claws/v%s (id:%s)", system.Version, config.Get().AuthenticationTokenId))
+	p := r.Panel()
+
+	req.Header.Set("User-Agent", fmt.Sprintf("Panther Claws/v%s (id:%s)", system.Version, p.AuthenticationTokenId))
 	req.Header.Set("Accept", "application/vnd.panther.v1+json")
 	req.Header.Set("Content-Type", "application/json")
-	req.Header.Set("Authorization", fmt.Sprintf("Bearer %s.%s", config.Get().AuthenticationTokenId, config.Get().AuthenticationToken))
+	req.Header.Set("Authorization", fmt.Sprintf("Bearer %s.%s", p.AuthenticationTokenId, p.AuthenticationToken))
 
 	// Make any options calls that will allow us to make modifications to the request
 	// before it is sent off.
@@ -0,0 +1,37 @@
+package api
+
+import (
+	"github.com/pkg/errors"
+	"io"
+	"net/http"
+)
+
+type DiagnosticsUploadResponse struct {
+	// The identifier of the report in the Panel, which can be given to support staff so
+	// that they are able to find it.
+	Id  string `json:"id"`
+	Url string `json:"url"`
+}
+
+// Uploads a gzip compressed diagnostics bundle to the Panel. The bundle is stored privately
+// on the Panel and is only visible to its administrators.
+func (r *Request) SendDiagnostics(bundle io.Reader) (*DiagnosticsUploadResponse, error) {
+	resp, err := r.Make(http.MethodPost, r.Endpoint("/diagnostics"), bundle, func(r *http.Request) {
+		r.Header.Set("Content-Type", "application/gzip")
+	})
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+	defer resp.Body.Close()
+
+	if resp.HasError() {
+		return nil, resp.Error()
+	}
+
+	var res DiagnosticsUploadResponse
+	if err := resp.Bind(&res); err != nil {
+		return nil, errors.WithStack(err)
+	}
+
+	return &res, nil
+}
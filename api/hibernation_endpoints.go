@@ -0,0 +1,71 @@
+package api
+
+import (
+	"fmt"
+	"github.com/pkg/errors"
+	"strconv"
+)
+
+// Returns the presigned URLs used to upload the compressed files of a hibernated server to S3.
+func (r *Request) GetHibernationUploadURLs(uuid string, size int64) (*BackupRemoteUploadResponse, error) {
+	resp, err := r.Get(fmt.Sprintf("/servers/%s/hibernation/upload", uuid), Q{"size": strconv.FormatInt(size, 10)})
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+	defer resp.Body.Close()
+
+	if resp.HasError() {
+		return nil, resp.Error()
+	}
+
+	var res BackupRemoteUploadResponse
+	if err := resp.Bind(&res); err != nil {
+		return nil, errors.WithStack(err)
+	}
+
+	return &res, nil
+}
+
+// Returns a presigned URL that the compressed files of a hibernated server can be downloaded
+// from S3 with.
+func (r *Request) GetHibernationDownloadURL(uuid string) (string, error) {
+	resp, err := r.Get(fmt.Sprintf("/servers/%s/hibernation/download", uuid), nil)
+	if err != nil {
+		return "", errors.WithStack(err)
+	}
+	defer resp.Body.Close()
+
+	if resp.HasError() {
+		return "", resp.Error()
+	}
+
+	var res struct {
+		Url string `json:"url"`
+	}
+	if err := resp.Bind(&res); err != nil {
+		return "", errors.WithStack(err)
+	}
+
+	return res.Url, nil
+}
+
+type HibernationRequest struct {
+	Hibernated   bool   `json:"hibernated"`
+	Successful   bool   `json:"successful"`
+	Adapter      string `json:"adapter"`
+	Checksum     string `json:"checksum"`
+	ChecksumType string `json:"checksum_type"`
+	Size         int64  `json:"size"`
+}
+
+// Notifies the panel that a server has finished being hibernated, or has been restored from
+// hibernation.
+func (r *Request) SendHibernationStatus(uuid string, data HibernationRequest) error {
+	resp, err := r.Post(fmt.Sprintf("/servers/%s/hibernation", uuid), data)
+	if err != nil {
+		return errors.WithStack(err)
+	}
+	defer resp.Body.Close()
+
+	return resp.Error()
+}
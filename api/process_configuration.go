@@ -52,6 +52,71 @@ type ProcessStopConfiguration struct {
 	Value string `json:"value"`
 }
 
+const (
+	ReadinessCheckTcp = "tcp"
+	ReadinessCheckUdp = "udp"
+)
+
+const (
+	ReadinessFailureNone      = "none"
+	ReadinessFailureStop      = "stop"
+	ReadinessFailureTerminate = "kill"
+)
+
+// Defines a check used to determine when a server has finished starting by probing the
+// primary allocation for the server, rather than relying on console output.
+type ProcessReadinessConfiguration struct {
+	// The protocol to probe the primary allocation with, either "tcp" or "udp". If this
+	// is empty no readiness check is performed and the console output is used instead.
+	Type string `json:"type"`
+
+	// The number of seconds to wait for the allocation to respond before the failure
+	// action is performed. A value of 0 will wait until the server is stopped.
+	Timeout int `json:"timeout"`
+
+	// The action to take if the server does not become ready before the timeout is
+	// reached. This should be one of "none", "stop", or "kill".
+	FailureAction string `json:"failure_action"`
+}
+
+// Returns true if a readiness check has been configured for the process.
+func (prc *ProcessReadinessConfiguration) Enabled() bool {
+	return prc.Type == ReadinessCheckTcp || prc.Type == ReadinessCheckUdp
+}
+
+// Defines a file that is created with default content before the server boots, if it does
+// not already exist in the server directory.
+type ProcessFileConfiguration struct {
+	// The path of the file, relative to the server directory.
+	Path string `json:"path"`
+
+	// The content written to the file. This is ignored if a URL is provided.
+	Content string `json:"content"`
+
+	// The URL that the content of the file is downloaded from.
+	Url string `json:"url"`
+}
+
+// Defines a prompt in the console output of a server that is answered by sending a command.
+type ProcessPromptConfiguration struct {
+	// The line of output that is answered, which may be prefixed with "regex:" to match the
+	// line against a regular expression.
+	Match *OutputLineMatcher `json:"match"`
+
+	// The command that is sent to the server when the prompt is output.
+	Answer string `json:"answer"`
+}
+
+// Defines the actions performed the first time a server boots after it has been installed,
+// such as accepting the EULA for Minecraft servers.
+type ProcessFirstBootConfiguration struct {
+	// The files that are written before the server boots, replacing any existing content.
+	Files []ProcessFileConfiguration `json:"files"`
+
+	// The prompts that are answered while the server is booting.
+	Prompts []ProcessPromptConfiguration `json:"prompts"`
+}
+
 // Defines the process configuration for a given server instance. This sets what the
 // daemon is looking for to mark a server as done starting, what to do when stopping,
 // and what changes to make to the configuration file for a server.
@@ -60,9 +125,24 @@ type ProcessConfiguration struct {
 		Done            []*OutputLineMatcher `json:"done"`
 		UserInteraction []string             `json:"user_interaction"`
 		StripAnsi       bool                 `json:"strip_ansi"`
+
+		// When configured the server is only marked as running once the primary allocation
+		// accepts connections, and the done lines above are ignored.
+		Readiness ProcessReadinessConfiguration `json:"readiness"`
 	} `json:"startup"`
 
 	Stop ProcessStopConfiguration `json:"stop"`
 
 	ConfigurationFiles []parser.ConfigurationFile `json:"configs"`
+
+	// Determines if the "*.tmpl" files in the server directory are rendered each time the
+	// server boots, substituting the variables for the server within them.
+	RenderTemplates bool `json:"render_templates"`
+
+	// The files that are created with default content if they are missing when the server
+	// boots, which allows simple eggs to avoid needing an installation script.
+	Files []ProcessFileConfiguration `json:"files"`
+
+	// The actions performed the first time the server boots after it has been installed.
+	FirstBoot ProcessFirstBootConfiguration `json:"first_boot"`
 }
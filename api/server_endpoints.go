@@ -29,6 +29,9 @@ const (
 type ServerConfigurationResponse struct {
 	Settings             json.RawMessage       `json:"settings"`
 	ProcessConfiguration *ProcessConfiguration `json:"process_configuration"`
+
+	// The name of the Panel that the configuration was fetched from.
+	Panel string `json:"-"`
 }
 
 // Defines installation script information for a server process. This is used when
@@ -141,6 +144,7 @@ func (r *Request) GetServerConfiguration(uuid string) (ServerConfigurationRespon
 	if err := resp.Bind(&cfg); err != nil {
 		return cfg, errors.WithStack(err)
 	}
+	cfg.Panel = r.panel
 
 	return cfg, nil
 }
@@ -180,6 +184,28 @@ func (r *Request) SendInstallationStatus(uuid string, successful bool) error {
 	return nil
 }
 
+// Notifies the panel that a server process was killed for running out of memory.
+func (r *Request) SendServerOutOfMemory(uuid string, exitCode uint32, memoryLimit int64) error {
+	resp, err := r.Post(fmt.Sprintf("/servers/%s/oom", uuid), D{"exit_code": exitCode, "memory_limit": memoryLimit})
+	if err != nil {
+		return errors.WithStack(err)
+	}
+	defer resp.Body.Close()
+
+	return resp.Error()
+}
+
+// Sends the report written for a server crash to the panel.
+func (r *Request) SendCrashReport(uuid string, report interface{}) error {
+	resp, err := r.Post(fmt.Sprintf("/servers/%s/crash", uuid), D{"data": report})
+	if err != nil {
+		return errors.WithStack(err)
+	}
+	defer resp.Body.Close()
+
+	return resp.Error()
+}
+
 func (r *Request) SendArchiveStatus(uuid string, successful bool) error {
 	resp, err := r.Post(fmt.Sprintf("/servers/%s/archive", uuid), D{"successful": successful})
 	if err != nil {
@@ -0,0 +1,95 @@
+package api
+
+import (
+	"github.com/pkg/errors"
+	"net/http"
+	"regexp"
+)
+
+// Usernames are made up of the panel username, a period, and the short identifier for the
+// server, such as "username.a1b2c3d4".
+var validUsernameRegex = regexp.MustCompile(`^(?i)(.+)\.([a-z0-9]{8})$`)
+
+type SftpAuthRequest struct {
+	User string `json:"username"`
+	Pass string `json:"password"`
+	IP   string `json:"ip"`
+
+	// The one-time code provided by the user as their second factor, if they provided one.
+	Code string `json:"one_time_code,omitempty"`
+}
+
+type SftpAuthResponse struct {
+	Server      string   `json:"server"`
+	Token       string   `json:"token"`
+	Permissions []string `json:"permissions"`
+
+	// Set by the Panel when the login should only be able to read files, regardless of the
+	// permissions granted to the user.
+	ReadOnly bool `json:"read_only"`
+
+	// The directory within the server that the login is restricted to. If this is empty
+	// the login has access to the entire server directory.
+	Root string `json:"root"`
+
+	// Set by the Panel when the user is required to provide a second factor to log in. The
+	// login is refused if this is set and a one-time code was not provided, so that a Panel
+	// that flags the user without validating the code itself cannot be used to log in with
+	// only a password.
+	TwoFactorRequired bool `json:"two_factor_required"`
+}
+
+// Returned when the credentials provided for a file access login are not valid, or the
+// user they belong to does not have access to the server.
+var ErrInvalidCredentials = errors.New("api: the credentials provided were invalid")
+
+// Returned when the credentials provided for a file access login belong to a user that must
+// also provide a one-time code, and a valid code was not provided.
+var ErrTwoFactorRequired = errors.New("api: a one-time code is required for the credentials provided")
+
+// The error code returned by the Panel when a one-time code is required to log in.
+const twoFactorRequiredCode = "TwoFactorRequiredException"
+
+// The number of digits in a one-time code.
+const OneTimeCodeLength = 6
+
+// Validates a set of file access credentials against the Panel, returning the server the
+// user is logging into along with the permissions they have for it. These are the same
+// credentials used for SFTP.
+func (r *Request) ValidateSftpCredentials(request SftpAuthRequest) (*SftpAuthResponse, error) {
+	// If the username doesn't meet the expected format that the Panel would even recognize just
+	// go ahead and bail out of the process here to avoid accidentally brute forcing the panel if
+	// a bot decides to connect to spam username attempts.
+	if !validUsernameRegex.MatchString(request.User) {
+		return nil, ErrInvalidCredentials
+	}
+
+	resp, err := r.Post("/sftp/auth", request)
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+	defer resp.Body.Close()
+
+	if resp.HasError() {
+		if err, ok := resp.Error().(*RequestError); ok && err.Code == twoFactorRequiredCode {
+			return nil, ErrTwoFactorRequired
+		}
+
+		if resp.StatusCode == http.StatusForbidden || resp.StatusCode == http.StatusUnprocessableEntity {
+			return nil, ErrInvalidCredentials
+		}
+
+		return nil, resp.Error()
+	}
+
+	var auth SftpAuthResponse
+	if err := resp.Bind(&auth); err != nil {
+		return nil, errors.WithStack(err)
+	}
+
+	if auth.TwoFactorRequired && request.Code == "" {
+		return nil, ErrTwoFactorRequired
+	}
+
+	return &auth, nil
+}
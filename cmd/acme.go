@@ -0,0 +1,220 @@
+package cmd
+
+import (
+	"bytes"
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"fmt"
+	"github.com/avatag-host/claws/config"
+	"github.com/avatag-host/claws/system"
+	"github.com/pkg/errors"
+	"golang.org/x/crypto/acme"
+	"golang.org/x/crypto/acme/autocert"
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// The key that autocert stores the account key under in its cache. The same key is used when
+// registering an account with External Account Binding so that autocert uses that account.
+const acmeAccountKeyName = "acme_account+key"
+
+// Returns the ACME client that autocert should use to generate certificates. If External Account
+// Binding credentials are configured the account is registered with them before the client is
+// returned, since autocert is unable to register the account itself in that case.
+func configureAcmeClient(ctx context.Context, cfg config.AcmeConfiguration, cache autocert.Cache) (*acme.Client, error) {
+	dir := cfg.DirectoryUrl
+	if dir == "" {
+		dir = config.DefaultAcmeDirectory
+	}
+
+	client := &acme.Client{DirectoryURL: dir, UserAgent: "claws/" + system.Version}
+	if !cfg.UsesExternalAccount() {
+		return client, nil
+	}
+
+	key, err := acmeAccountKey(ctx, cache)
+	if err != nil {
+		return nil, err
+	}
+	client.Key = key
+
+	if err := registerExternalAccount(ctx, client, key, cfg); err != nil {
+		return nil, err
+	}
+
+	return client, nil
+}
+
+// Returns the account key stored in the autocert cache, generating and storing a new key if
+// there is not one already.
+func acmeAccountKey(ctx context.Context, cache autocert.Cache) (*ecdsa.PrivateKey, error) {
+	data, err := cache.Get(ctx, acmeAccountKeyName)
+	if err == autocert.ErrCacheMiss {
+		key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+		if err != nil {
+			return nil, errors.WithStack(err)
+		}
+
+		b, err := x509.MarshalECPrivateKey(key)
+		if err != nil {
+			return nil, errors.WithStack(err)
+		}
+
+		if err := cache.Put(ctx, acmeAccountKeyName, pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: b})); err != nil {
+			return nil, errors.WithStack(err)
+		}
+
+		return key, nil
+	} else if err != nil {
+		return nil, errors.WithStack(err)
+	}
+
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return nil, errors.New("acme: invalid account key found in cache")
+	}
+
+	if key, err := x509.ParseECPrivateKey(block.Bytes); err == nil {
+		return key, nil
+	}
+
+	if k, err := x509.ParsePKCS8PrivateKey(block.Bytes); err == nil {
+		if key, ok := k.(*ecdsa.PrivateKey); ok {
+			return key, nil
+		}
+	}
+
+	return nil, errors.New("acme: the cached account key must be an ECDSA key to use external account binding")
+}
+
+// Registers a new account with the ACME server, bound to an existing account using the External
+// Account Binding credentials. If an account already exists for the key the server returns that
+// account instead, so this is safe to call each time Wings boots.
+//
+// See https://tools.ietf.org/html/rfc8555#section-7.3.4
+func registerExternalAccount(ctx context.Context, client *acme.Client, key *ecdsa.PrivateKey, cfg config.AcmeConfiguration) error {
+	if key.Curve != elliptic.P256() {
+		return errors.New("acme: the account key must use the P-256 curve to use external account binding")
+	}
+
+	dir, err := client.Discover(ctx)
+	if err != nil {
+		return errors.Wrap(err, "acme: failed to retrieve directory")
+	}
+
+	hmacKey, err := base64.RawURLEncoding.DecodeString(strings.TrimRight(cfg.Eab.HmacKey, "="))
+	if err != nil {
+		return errors.Wrap(err, "acme: failed to decode external account binding key")
+	}
+
+	hc := &http.Client{Timeout: time.Second * 30}
+
+	req, err := http.NewRequest(http.MethodHead, dir.NonceURL, nil)
+	if err != nil {
+		return errors.WithStack(err)
+	}
+
+	res, err := hc.Do(req.WithContext(ctx))
+	if err != nil {
+		return errors.Wrap(err, "acme: failed to retrieve nonce")
+	}
+	res.Body.Close()
+
+	nonce := res.Header.Get("Replay-Nonce")
+	if nonce == "" {
+		return errors.New("acme: server did not return a nonce")
+	}
+
+	size := (key.Curve.Params().BitSize + 7) / 8
+	jwk := fmt.Sprintf(
+		`{"crv":"P-256","kty":"EC","x":%q,"y":%q}`,
+		base64.RawURLEncoding.EncodeToString(padBytes(key.X.Bytes(), size)),
+		base64.RawURLEncoding.EncodeToString(padBytes(key.Y.Bytes(), size)),
+	)
+
+	// The binding is a JWS of the account key, signed with the key provided by the certificate
+	// authority.
+	eabProtected := encodeSegment([]byte(fmt.Sprintf(`{"alg":"HS256","kid":%q,"url":%q}`, cfg.Eab.KeyId, dir.RegURL)))
+	eabPayload := encodeSegment([]byte(jwk))
+	mac := hmac.New(sha256.New, hmacKey)
+	mac.Write([]byte(eabProtected + "." + eabPayload))
+
+	account := map[string]interface{}{
+		"termsOfServiceAgreed": true,
+		"externalAccountBinding": map[string]string{
+			"protected": eabProtected,
+			"payload":   eabPayload,
+			"signature": encodeSegment(mac.Sum(nil)),
+		},
+	}
+	if cfg.Email != "" {
+		account["contact"] = []string{"mailto:" + cfg.Email}
+	}
+
+	payload, err := json.Marshal(account)
+	if err != nil {
+		return errors.WithStack(err)
+	}
+
+	protected := encodeSegment([]byte(fmt.Sprintf(`{"alg":"ES256","jwk":%s,"nonce":%q,"url":%q}`, jwk, nonce, dir.RegURL)))
+	encoded := encodeSegment(payload)
+
+	digest := sha256.Sum256([]byte(protected + "." + encoded))
+	r, s, err := ecdsa.Sign(rand.Reader, key, digest[:])
+	if err != nil {
+		return errors.WithStack(err)
+	}
+
+	body, err := json.Marshal(map[string]string{
+		"protected": protected,
+		"payload":   encoded,
+		"signature": encodeSegment(append(padBytes(r.Bytes(), size), padBytes(s.Bytes(), size)...)),
+	})
+	if err != nil {
+		return errors.WithStack(err)
+	}
+
+	req, err = http.NewRequest(http.MethodPost, dir.RegURL, bytes.NewReader(body))
+	if err != nil {
+		return errors.WithStack(err)
+	}
+	req.Header.Set("Content-Type", "application/jose+json")
+	req.Header.Set("User-Agent", client.UserAgent)
+
+	res, err = hc.Do(req.WithContext(ctx))
+	if err != nil {
+		return errors.Wrap(err, "acme: failed to register account")
+	}
+	defer res.Body.Close()
+
+	if res.StatusCode != http.StatusOK && res.StatusCode != http.StatusCreated {
+		b, _ := ioutil.ReadAll(res.Body)
+
+		return errors.New(fmt.Sprintf("acme: failed to register account with external account binding: %d %s", res.StatusCode, strings.TrimSpace(string(b))))
+	}
+
+	return nil
+}
+
+func encodeSegment(b []byte) string {
+	return base64.RawURLEncoding.EncodeToString(b)
+}
+
+// Left pads the bytes with zeros to the given size.
+func padBytes(b []byte, size int) []byte {
+	if len(b) >= size {
+		return b
+	}
+
+	return append(make([]byte, size-len(b)), b...)
+}
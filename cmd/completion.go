@@ -0,0 +1,40 @@
+package cmd
+
+import (
+	"fmt"
+	"github.com/spf13/cobra"
+	"os"
+)
+
+var completionCmd = &cobra.Command{
+	Use:   "completion [bash|zsh|fish|powershell]",
+	Short: "Generate a shell completion script.",
+	Long: `Generate a script that provides completions for the claws command in the given shell.
+
+The script is written to stdout and must be loaded by the shell, for example:
+
+  bash:        claws completion bash > /etc/bash_completion.d/claws
+  zsh:         claws completion zsh > "${fpath[1]}/_claws"
+  fish:        claws completion fish > ~/.config/fish/completions/claws.fish
+  powershell:  claws completion powershell | Out-String | Invoke-Expression`,
+	ValidArgs: []string{"bash", "zsh", "fish", "powershell"},
+	Args:      cobra.ExactValidArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		var err error
+		switch args[0] {
+		case "bash":
+			err = root.GenBashCompletion(os.Stdout)
+		case "zsh":
+			err = root.GenZshCompletion(os.Stdout)
+		case "fish":
+			err = root.GenFishCompletion(os.Stdout, true)
+		case "powershell":
+			err = root.GenPowerShellCompletion(os.Stdout)
+		}
+
+		if err != nil {
+			fmt.Println("Failed to generate the completion script:", err.Error())
+			os.Exit(1)
+		}
+	},
+}
@@ -0,0 +1,49 @@
+package cmd
+
+import (
+	"fmt"
+	"github.com/avatag-host/claws/config"
+	"github.com/mitchellh/colorstring"
+	"github.com/spf13/cobra"
+	"os"
+)
+
+var configCmd = &cobra.Command{
+	Use:   "config",
+	Short: "Manage the daemon configuration file.",
+}
+
+var configValidateCmd = &cobra.Command{
+	Use:   "validate",
+	Short: "Check the configuration file for errors without starting the daemon.",
+	Run:   configValidateCmdRun,
+}
+
+func init() {
+	configCmd.AddCommand(configValidateCmd)
+}
+
+func configValidateCmdRun(*cobra.Command, []string) {
+	_, problems, err := config.ValidateFile(configPath)
+	if err != nil {
+		if os.IsNotExist(err) {
+			fmt.Printf("No configuration file was found at %s.\n", configPath)
+		} else {
+			fmt.Printf("The configuration file at %s could not be parsed:\n\n    %s\n", configPath, err.Error())
+		}
+
+		os.Exit(1)
+	}
+
+	if len(problems) == 0 {
+		fmt.Println(colorstring.Color(fmt.Sprintf("[green]The configuration file at %s is valid.", configPath)))
+		return
+	}
+
+	fmt.Printf("Found %d problem(s) with the configuration file at %s:\n\n", len(problems), configPath)
+	for _, p := range problems {
+		fmt.Println(colorstring.Color("[red]  - [reset]" + p.Error()))
+	}
+
+	os.Exit(1)
+}
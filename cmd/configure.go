@@ -19,12 +19,13 @@ import (
 
 var (
 	configureArgs struct {
-		PanelURL      string
-		Token         string
-		ConfigPath    string
-		Node          string
-		Override      bool
-		AllowInsecure bool
+		PanelURL       string
+		Token          string
+		ConfigPath     string
+		Node           string
+		Override       bool
+		AllowInsecure  bool
+		InstallService bool
 	}
 )
 
@@ -38,11 +39,14 @@ var configureCmd = &cobra.Command{
 
 func init() {
 	configureCmd.PersistentFlags().StringVarP(&configureArgs.PanelURL, "panel-url", "p", "", "The base URL for this daemon's panel")
-	configureCmd.PersistentFlags().StringVarP(&configureArgs.Token, "token", "t", "", "The API key to use for fetching node information")
+	configureCmd.PersistentFlags().StringVarP(&configureArgs.Token, "token", "t", "", "The API key or node deployment token to use for fetching node information")
 	configureCmd.PersistentFlags().StringVarP(&configureArgs.Node, "node", "n", "", "The ID of the node which will be connected to this daemon")
 	configureCmd.PersistentFlags().StringVarP(&configureArgs.ConfigPath, "config-path", "c", config.DefaultLocationLinux, "The path where the configuration file should be made")
 	configureCmd.PersistentFlags().BoolVar(&configureArgs.Override, "override", false, "Set to true to override an existing configuration for this node")
 	configureCmd.PersistentFlags().BoolVar(&configureArgs.AllowInsecure, "allow-insecure", false, "Set to true to disable certificate checking")
+	configureCmd.PersistentFlags().BoolVar(&configureArgs.InstallService, "install-service", false, "Set to true to install and enable a service for the daemon once configured")
+
+	setFlagGroup(configureCmd.PersistentFlags(), "Panel", "panel-url", "token", "node", "allow-insecure")
 }
 
 func configureCmdRun(cmd *cobra.Command, args []string) {
@@ -99,7 +103,7 @@ func configureCmdRun(cmd *cobra.Command, args []string) {
 			Validate: func(ans interface{}) error {
 				if str, ok := ans.(string); ok {
 					if !nodeIdRegex.Match([]byte(str)) {
-						return fmt.Errorf("please provide a valid authentication token")
+						return fmt.Errorf("please provide a valid node ID")
 					}
 				}
 				return nil
@@ -124,9 +128,6 @@ func configureCmdRun(cmd *cobra.Command, args []string) {
 		panic(err)
 	}
 
-	fmt.Printf("%+v", req.Header)
-	fmt.Printf(req.URL.String())
-
 	res, err := c.Do(req)
 	if err != nil {
 		fmt.Println("Failed to fetch configuration from the panel.\n", err.Error())
@@ -145,13 +146,21 @@ func configureCmdRun(cmd *cobra.Command, args []string) {
 	}
 
 	b, err := ioutil.ReadAll(res.Body)
+	if err != nil {
+		panic(err)
+	}
 
-	cfg, err := config.NewFromPath(configPath)
+	cfg, err := config.NewFromPath(configureArgs.ConfigPath)
 	if err != nil {
 		panic(err)
 	}
 
 	if err := json.Unmarshal(b, cfg); err != nil {
+		fmt.Println("The configuration returned by the panel could not be parsed.\n", err.Error())
+		os.Exit(1)
+	}
+
+	if err := os.MkdirAll(path.Dir(configureArgs.ConfigPath), 0755); err != nil {
 		panic(err)
 	}
 
@@ -160,6 +169,15 @@ func configureCmdRun(cmd *cobra.Command, args []string) {
 	}
 
 	fmt.Println("Successfully configured wings.")
+
+	if configureArgs.InstallService {
+		if err := installService(configureArgs.ConfigPath); err != nil {
+			fmt.Println("Failed to install the service.\n", err.Error())
+			os.Exit(1)
+		}
+
+		fmt.Println("Installed and enabled the claws service.")
+	}
 }
 
 func getRequest() (*http.Request, error) {
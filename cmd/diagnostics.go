@@ -1,6 +1,9 @@
 package cmd
 
 import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
 	"context"
 	"encoding/json"
 	"errors"
@@ -10,9 +13,9 @@ import (
 	"io/ioutil"
 	"net/http"
 	"net/url"
+	"os"
 	"os/exec"
 	"path"
-	"runtime"
 	"strconv"
 	"strings"
 	"time"
@@ -22,6 +25,7 @@ import (
 	"github.com/docker/cli/components/engine/pkg/parsers/operatingsystem"
 	"github.com/docker/docker/api/types"
 	"github.com/docker/docker/pkg/parsers/kernel"
+	"github.com/avatag-host/claws/api"
 	"github.com/avatag-host/claws/config"
 	"github.com/avatag-host/claws/system"
 	"github.com/spf13/cobra"
@@ -30,6 +34,12 @@ import (
 const DefaultHastebinUrl = "https://hastebin.com/"
 const DefaultLogLines = 200
 
+// The destinations that a diagnostics report can be uploaded to.
+const (
+	uploadDestinationPanel    = "panel"
+	uploadDestinationHastebin = "hastebin"
+)
+
 var (
 	diagnosticsArgs struct {
 		IncludeEndpoints   bool
@@ -37,18 +47,76 @@ var (
 		ReviewBeforeUpload bool
 		HastebinURL        string
 		LogLines           int
+		Format             string
+		Output             string
+		UploadTo           string
 	}
 )
 
 var diagnosticsCmd = &cobra.Command{
 	Use:   "diagnostics",
 	Short: "Collect diagnostics information.",
-	Run:   diagnosticsCmdRun,
+	Long: `Collect diagnostics information about the daemon, its configuration and the node.
+
+When run without any of the --format, --output, --include-endpoints, --include-logs or
+--upload-to flags you are asked which information to include and whether to upload the
+report. Otherwise the report is written to stdout, or the output file, without any prompts.
+
+Reports can be uploaded either to the Panel, where they are stored privately alongside a
+compressed copy of the log file, or to a public hastebin instance.`,
+	Run: diagnosticsCmdRun,
 }
 
 func init() {
 	diagnosticsCmd.PersistentFlags().StringVar(&diagnosticsArgs.HastebinURL, "hastebin-url", DefaultHastebinUrl, "The url of the hastebin instance to use.")
 	diagnosticsCmd.PersistentFlags().IntVar(&diagnosticsArgs.LogLines, "log-lines", DefaultLogLines, "The number of log lines to include in the report")
+	diagnosticsCmd.PersistentFlags().StringVar(&diagnosticsArgs.Format, "format", "text", "The format of the report, either \"text\" or \"json\"")
+	diagnosticsCmd.PersistentFlags().StringVarP(&diagnosticsArgs.Output, "output", "o", "", "Write the report to this file instead of stdout")
+	diagnosticsCmd.PersistentFlags().BoolVar(&diagnosticsArgs.IncludeEndpoints, "include-endpoints", false, "Include endpoints (i.e. the FQDN/IP of your panel) in the report")
+	diagnosticsCmd.PersistentFlags().BoolVar(&diagnosticsArgs.IncludeLogs, "include-logs", true, "Include the latest logs in the report")
+	diagnosticsCmd.PersistentFlags().StringVar(&diagnosticsArgs.UploadTo, "upload-to", "", "Upload the report to \"panel\" or \"hastebin\" after it is generated")
+}
+
+// A diagnostics report for the node.
+type diagnosticsReport struct {
+	GeneratedAt time.Time `json:"generated_at"`
+
+	Versions struct {
+		Claws  string `json:"claws"`
+		Docker string `json:"docker,omitempty"`
+		Kernel string `json:"kernel,omitempty"`
+		OS     string `json:"os,omitempty"`
+	} `json:"versions"`
+
+	Configuration      *diagnosticsConfiguration `json:"configuration"`
+	ConfigurationError string                    `json:"configuration_error,omitempty"`
+
+	Docker          *types.Info `json:"docker"`
+	DockerError     string      `json:"docker_error,omitempty"`
+	Containers      string      `json:"containers"`
+	ContainersError string      `json:"containers_error,omitempty"`
+
+	// The latest lines from the log file, nil if logs were not included.
+	Logs         []string `json:"logs"`
+	LogsRedacted bool     `json:"logs_redacted"`
+	LogsError    string   `json:"logs_error,omitempty"`
+}
+
+type diagnosticsConfiguration struct {
+	PanelLocation    string `json:"panel_location"`
+	ApiHost          string `json:"api_host"`
+	ApiPort          int    `json:"api_port"`
+	SslEnabled       bool   `json:"ssl_enabled"`
+	SslCertificate   string `json:"ssl_certificate"`
+	SslKey           string `json:"ssl_key"`
+	RootDirectory    string `json:"root_directory"`
+	LogDirectory     string `json:"log_directory"`
+	DataDirectory    string `json:"data_directory"`
+	ArchiveDirectory string `json:"archive_directory"`
+	BackupDirectory  string `json:"backup_directory"`
+	Username         string `json:"username"`
+	Environment      string `json:"environment"`
+	Debug            bool   `json:"debug"`
 }
 
 // diagnosticsCmdRun collects diagnostics about wings, it's configuration and the node.
@@ -59,135 +127,268 @@ func init() {
 // - running docker containers
 // - logs
 func diagnosticsCmdRun(cmd *cobra.Command, args []string) {
-	questions := []*survey.Question{
-		{
-			Name:   "IncludeEndpoints",
-			Prompt: &survey.Confirm{Message: "Do you want to include endpoints (i.e. the FQDN/IP of your panel)?", Default: false},
-		},
-		{
-			Name:   "IncludeLogs",
-			Prompt: &survey.Confirm{Message: "Do you want to include the latest logs?", Default: true},
-		},
-		{
-			Name: "ReviewBeforeUpload",
-			Prompt: &survey.Confirm{
-				Message: "Do you want to review the collected data before uploading to hastebin.com?",
-				Help:    "The data, especially the logs, might contain sensitive information, so you should review it. You will be asked again if you want to upload.",
-				Default: true,
+	flags := cmd.Flags()
+	interactive := !flags.Changed("format") && !flags.Changed("output") && !flags.Changed("include-endpoints") && !flags.Changed("include-logs") && !flags.Changed("upload-to")
+
+	if diagnosticsArgs.Format != "text" && diagnosticsArgs.Format != "json" {
+		fmt.Println("The report format must be either \"text\" or \"json\".")
+		os.Exit(1)
+	}
+
+	if diagnosticsArgs.UploadTo != "" && diagnosticsArgs.UploadTo != uploadDestinationPanel && diagnosticsArgs.UploadTo != uploadDestinationHastebin {
+		fmt.Println("Reports can only be uploaded to \"panel\" or \"hastebin\".")
+		os.Exit(1)
+	}
+
+	if interactive {
+		questions := []*survey.Question{
+			{
+				Name:   "IncludeEndpoints",
+				Prompt: &survey.Confirm{Message: "Do you want to include endpoints (i.e. the FQDN/IP of your panel)?", Default: false},
 			},
-		},
+			{
+				Name:   "IncludeLogs",
+				Prompt: &survey.Confirm{Message: "Do you want to include the latest logs?", Default: true},
+			},
+			{
+				Name: "UploadTo",
+				Prompt: &survey.Select{
+					Message: "Where do you want to upload the report?",
+					Help:    "Reports uploaded to the Panel are only visible to its administrators, while reports uploaded to hastebin are public to anyone with the link.",
+					Options: []string{uploadDestinationPanel, uploadDestinationHastebin},
+					Default: uploadDestinationPanel,
+				},
+			},
+			{
+				Name: "ReviewBeforeUpload",
+				Prompt: &survey.Confirm{
+					Message: "Do you want to review the collected data before uploading it?",
+					Help:    "The data, especially the logs, might contain sensitive information, so you should review it. You will be asked again if you want to upload.",
+					Default: true,
+				},
+			},
+		}
+		if err := survey.Ask(questions, &diagnosticsArgs); err != nil {
+			if err == terminal.InterruptErr {
+				return
+			}
+			panic(err)
+		}
 	}
-	if err := survey.Ask(questions, &diagnosticsArgs); err != nil {
-		if err == terminal.InterruptErr {
-			return
+
+	report := collectDiagnostics()
+
+	var out string
+	if diagnosticsArgs.Format == "json" {
+		b, err := json.MarshalIndent(report, "", "  ")
+		if err != nil {
+			panic(err)
 		}
-		panic(err)
+		out = string(b) + "\n"
+	} else {
+		out = report.String()
 	}
 
-	dockerVersion, dockerInfo, dockerErr := getDockerInfo()
-	_ = dockerInfo
+	if !interactive {
+		if diagnosticsArgs.Output != "" {
+			if err := ioutil.WriteFile(diagnosticsArgs.Output, []byte(out), 0600); err != nil {
+				fmt.Println("Failed to write the report:", err)
+				os.Exit(1)
+			}
 
-	output := &strings.Builder{}
-	fmt.Fprintln(output, "Panther Claws - Diagnostics Report")
-	printHeader(output, "Versions")
-	fmt.Fprintln(output, "         claws:", system.Version)
+			fmt.Println("The report has been written to", diagnosticsArgs.Output)
+		} else if diagnosticsArgs.UploadTo == "" {
+			fmt.Print(out)
+		}
+
+		if diagnosticsArgs.UploadTo != "" {
+			if err := uploadReport(report, out); err != nil {
+				os.Exit(1)
+			}
+		}
+		return
+	}
+
+	fmt.Println("\n---------------  generated report  ---------------")
+	fmt.Println(out)
+	fmt.Print("---------------   end of report    ---------------\n\n")
+
+	upload := !diagnosticsArgs.ReviewBeforeUpload
+	if !upload {
+		dest := "the Panel"
+		if diagnosticsArgs.UploadTo == uploadDestinationHastebin {
+			dest = diagnosticsArgs.HastebinURL
+		}
+		survey.AskOne(&survey.Confirm{Message: "Upload to " + dest + "?", Default: false}, &upload)
+	}
+	if upload {
+		uploadReport(report, out)
+	}
+}
+
+// Uploads the report to the selected destination and prints where it can be found.
+func uploadReport(report *diagnosticsReport, out string) error {
+	if diagnosticsArgs.UploadTo == uploadDestinationHastebin {
+		url, err := uploadToHastebin(diagnosticsArgs.HastebinURL, out)
+		if err == nil {
+			fmt.Println("Your report is available here: ", url)
+		}
+		return err
+	}
+
+	res, err := uploadToPanel(report)
+	if err != nil {
+		fmt.Println("Failed to upload report to the Panel:", err)
+		return err
+	}
+
+	if res.Url != "" {
+		fmt.Println("Your report is available here: ", res.Url)
+	} else {
+		fmt.Println("Your report has been uploaded to the Panel with the ID", res.Id)
+	}
+	return nil
+}
+
+// Collects the diagnostics information for the node.
+func collectDiagnostics() *diagnosticsReport {
+	r := &diagnosticsReport{GeneratedAt: time.Now()}
+
+	r.Versions.Claws = system.Version
+	dockerVersion, dockerInfo, dockerErr := getDockerInfo()
 	if dockerErr == nil {
-		fmt.Fprintln(output, "Docker:", dockerVersion.Version)
+		r.Versions.Docker = dockerVersion.Version
+		r.Docker = &dockerInfo
+	} else {
+		r.DockerError = dockerErr.Error()
 	}
 	if v, err := kernel.GetKernelVersion(); err == nil {
-		fmt.Fprintln(output, "Kernel:", v)
+		r.Versions.Kernel = v.String()
 	}
 	if os, err := operatingsystem.GetOperatingSystem(); err == nil {
-		fmt.Fprintln(output, "    OS:", os)
+		r.Versions.OS = os
+	}
+
+	cfg, err := config.ReadConfiguration(configPath)
+	if cfg != nil {
+		r.Configuration = &diagnosticsConfiguration{
+			PanelLocation:    redact(cfg.PanelLocation),
+			ApiHost:          redact(cfg.Api.Host),
+			ApiPort:          cfg.Api.Port,
+			SslEnabled:       cfg.Api.Ssl.Enabled,
+			SslCertificate:   redact(cfg.Api.Ssl.CertificateFile),
+			SslKey:           redact(cfg.Api.Ssl.KeyFile),
+			RootDirectory:    cfg.System.RootDirectory,
+			LogDirectory:     cfg.System.LogDirectory,
+			DataDirectory:    cfg.System.Data,
+			ArchiveDirectory: cfg.System.ArchiveDirectory,
+			BackupDirectory:  cfg.System.BackupDirectory,
+			Username:         cfg.System.Username,
+			Environment:      cfg.Environment,
+			Debug:            cfg.Debug,
+		}
+	} else {
+		r.ConfigurationError = err.Error()
 	}
 
-	printHeader(output, "Claws Configuration");
-	var err error;
-	var cfg *config.Configuration;
-	if runtime.GOOS == "windows" {
-		cfg, err = config.ReadConfiguration(config.DefaultLocationWindows)
+	if co, err := exec.Command("docker", "ps").Output(); err == nil {
+		r.Containers = string(co)
 	} else {
-		cfg, err = config.ReadConfiguration(config.DefaultLocationLinux)
+		r.ContainersError = err.Error()
 	}
-	if cfg != nil {
-		fmt.Fprintln(output, "    Panel Location:", redact(cfg.PanelLocation))
+
+	if diagnosticsArgs.IncludeLogs {
+		p := "/var/log/claws/claws.log"
+		if cfg != nil {
+			p = path.Join(cfg.System.LogDirectory, "wings.log")
+		}
+		if c, err := exec.Command("tail", "-n", strconv.Itoa(diagnosticsArgs.LogLines), p).Output(); err != nil {
+			r.LogsError = "No logs found or an error occurred."
+		} else {
+			r.Logs = strings.Split(strings.TrimRight(string(c), "\n"), "\n")
+		}
+	} else {
+		r.LogsRedacted = true
+	}
+
+	return r
+}
+
+// Returns the report formatted as human readable text.
+func (r *diagnosticsReport) String() string {
+	output := &strings.Builder{}
+	fmt.Fprintln(output, "Panther Claws - Diagnostics Report")
+	printHeader(output, "Versions")
+	fmt.Fprintln(output, "         claws:", r.Versions.Claws)
+	if r.Versions.Docker != "" {
+		fmt.Fprintln(output, "Docker:", r.Versions.Docker)
+	}
+	if r.Versions.Kernel != "" {
+		fmt.Fprintln(output, "Kernel:", r.Versions.Kernel)
+	}
+	if r.Versions.OS != "" {
+		fmt.Fprintln(output, "    OS:", r.Versions.OS)
+	}
+
+	printHeader(output, "Claws Configuration")
+	if c := r.Configuration; c != nil {
+		fmt.Fprintln(output, "    Panel Location:", c.PanelLocation)
 		fmt.Fprintln(output, "")
-		fmt.Fprintln(output, " Internal Webserver:", redact(cfg.Api.Host), ":", cfg.Api.Port)
-		fmt.Fprintln(output, "        SSL Enabled:", cfg.Api.Ssl.Enabled)
-		fmt.Fprintln(output, "    SSL Certificate:", redact(cfg.Api.Ssl.CertificateFile))
-		fmt.Fprintln(output, "            SSL Key:", redact(cfg.Api.Ssl.KeyFile))
+		fmt.Fprintln(output, " Internal Webserver:", c.ApiHost, ":", c.ApiPort)
+		fmt.Fprintln(output, "        SSL Enabled:", c.SslEnabled)
+		fmt.Fprintln(output, "    SSL Certificate:", c.SslCertificate)
+		fmt.Fprintln(output, "            SSL Key:", c.SslKey)
 		fmt.Fprintln(output, "")
-		fmt.Fprintln(output, "     Root Directory:", cfg.System.RootDirectory)
-		fmt.Fprintln(output, "     Logs Directory:", cfg.System.LogDirectory)
-		fmt.Fprintln(output, "     Data Directory:", cfg.System.Data)
-		fmt.Fprintln(output, "  Archive Directory:", cfg.System.ArchiveDirectory)
-		fmt.Fprintln(output, "   Backup Directory:", cfg.System.BackupDirectory)
+		fmt.Fprintln(output, "     Root Directory:", c.RootDirectory)
+		fmt.Fprintln(output, "     Logs Directory:", c.LogDirectory)
+		fmt.Fprintln(output, "     Data Directory:", c.DataDirectory)
+		fmt.Fprintln(output, "  Archive Directory:", c.ArchiveDirectory)
+		fmt.Fprintln(output, "   Backup Directory:", c.BackupDirectory)
 		fmt.Fprintln(output, "")
-		fmt.Fprintln(output, "           Username:", cfg.System.Username)
-		fmt.Fprintln(output, "        Server Time:", time.Now().Format(time.RFC1123Z))
-		fmt.Fprintln(output, "         Debug Mode:", cfg.Debug)
+		fmt.Fprintln(output, "           Username:", c.Username)
+		fmt.Fprintln(output, "        Environment:", c.Environment)
+		fmt.Fprintln(output, "        Server Time:", r.GeneratedAt.Format(time.RFC1123Z))
+		fmt.Fprintln(output, "         Debug Mode:", c.Debug)
 	} else {
-		fmt.Println("Failed to load configuration.", err)
+		fmt.Fprintln(output, "Failed to load configuration.", r.ConfigurationError)
 	}
 
 	printHeader(output, "Docker: Info")
-	fmt.Fprintln(output, "Server Version:", dockerInfo.ServerVersion)
-	fmt.Fprintln(output, "Storage Driver:", dockerInfo.Driver)
-	if dockerInfo.DriverStatus != nil {
-		for _, pair := range dockerInfo.DriverStatus {
+	if d := r.Docker; d != nil {
+		fmt.Fprintln(output, "Server Version:", d.ServerVersion)
+		fmt.Fprintln(output, "Storage Driver:", d.Driver)
+		for _, pair := range d.DriverStatus {
 			fmt.Fprintf(output, "  %s: %s\n", pair[0], pair[1])
 		}
-	}
-	if dockerInfo.SystemStatus != nil {
-		for _, pair := range dockerInfo.SystemStatus {
+		for _, pair := range d.SystemStatus {
 			fmt.Fprintf(output, " %s: %s\n", pair[0], pair[1])
 		}
-	}
-	fmt.Fprintln(output, "LoggingDriver:", dockerInfo.LoggingDriver)
-	fmt.Fprintln(output, " CgroupDriver:", dockerInfo.CgroupDriver)
-	if len(dockerInfo.Warnings) > 0 {
-		for _, w := range dockerInfo.Warnings {
+		fmt.Fprintln(output, "LoggingDriver:", d.LoggingDriver)
+		fmt.Fprintln(output, " CgroupDriver:", d.CgroupDriver)
+		for _, w := range d.Warnings {
 			fmt.Fprintln(output, w)
 		}
+	} else {
+		fmt.Fprintln(output, "Couldn't connect to Docker:", r.DockerError)
 	}
 
 	printHeader(output, "Docker: Running Containers")
-	c := exec.Command("docker", "ps")
-	if co, err := c.Output(); err == nil {
-		output.Write(co)
+	if r.ContainersError == "" {
+		fmt.Fprint(output, r.Containers)
 	} else {
-		fmt.Fprint(output, "Couldn't list containers: ", err)
+		fmt.Fprint(output, "Couldn't list containers: ", r.ContainersError)
 	}
 
 	printHeader(output, "Latest Claws Logs")
-	if diagnosticsArgs.IncludeLogs {
-		p := "/var/log/claws/claws.log"
-		if cfg != nil {
-			p = path.Join(cfg.System.LogDirectory, "wings.log")
-		}
-		if c, err := exec.Command("tail", "-n", strconv.Itoa(diagnosticsArgs.LogLines), p).Output(); err != nil {
-			fmt.Fprintln(output, "No logs found or an error occurred.")
-		} else {
-			fmt.Fprintf(output, "%s\n", string(c))
-		}
-	} else {
+	if r.LogsRedacted {
 		fmt.Fprintln(output, "Logs redacted.")
+	} else if r.LogsError != "" {
+		fmt.Fprintln(output, r.LogsError)
+	} else {
+		fmt.Fprintf(output, "%s\n", strings.Join(r.Logs, "\n"))
 	}
 
-	fmt.Println("\n---------------  generated report  ---------------")
-	fmt.Println(output.String())
-	fmt.Print("---------------   end of report    ---------------\n\n")
-
-	upload := !diagnosticsArgs.ReviewBeforeUpload
-	if !upload {
-		survey.AskOne(&survey.Confirm{Message: "Upload to " + diagnosticsArgs.HastebinURL + "?", Default: false}, &upload)
-	}
-	if upload {
-		url, err := uploadToHastebin(diagnosticsArgs.HastebinURL, output.String())
-		if err == nil {
-			fmt.Println("Your report is available here: ", url)
-		}
-	}
+	return output.String()
 }
 
 func getDockerInfo() (types.Version, types.Info, error) {
@@ -233,6 +434,57 @@ func uploadToHastebin(hbUrl, content string) (string, error) {
 	return "", errors.New("failed to find key in response")
 }
 
+// Uploads the report to the Panel as a gzip compressed tar archive, along with the complete
+// log file when logs are included in the report.
+func uploadToPanel(report *diagnosticsReport) (*api.DiagnosticsUploadResponse, error) {
+	c, err := config.ReadConfiguration(configPath)
+	if err != nil {
+		return nil, err
+	}
+	config.Set(c)
+
+	var buf bytes.Buffer
+	gw := gzip.NewWriter(&buf)
+	tw := tar.NewWriter(gw)
+
+	add := func(name string, b []byte) error {
+		h := &tar.Header{Name: name, Mode: 0600, Size: int64(len(b)), ModTime: report.GeneratedAt}
+		if err := tw.WriteHeader(h); err != nil {
+			return err
+		}
+		_, err := tw.Write(b)
+		return err
+	}
+
+	j, err := json.MarshalIndent(report, "", "  ")
+	if err != nil {
+		return nil, err
+	}
+	if err := add("report.json", j); err != nil {
+		return nil, err
+	}
+	if err := add("report.txt", []byte(report.String())); err != nil {
+		return nil, err
+	}
+
+	if diagnosticsArgs.IncludeLogs {
+		if b, err := ioutil.ReadFile(path.Join(c.System.LogDirectory, "wings.log")); err == nil {
+			if err := add("logs/wings.log", b); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	if err := tw.Close(); err != nil {
+		return nil, err
+	}
+	if err := gw.Close(); err != nil {
+		return nil, err
+	}
+
+	return api.New().SendDiagnostics(&buf)
+}
+
 func redact(s string) string {
 	if !diagnosticsArgs.IncludeEndpoints {
 		return "{redacted}"
@@ -0,0 +1,81 @@
+package cmd
+
+import (
+	"github.com/spf13/cobra"
+	"github.com/spf13/pflag"
+	"strings"
+)
+
+// The annotation used to assign a flag to a group in the help output.
+const flagGroupAnnotation = "claws_flag_group"
+
+// The usage template for all commands. This is the default cobra template, except that flags
+// are listed in their groups.
+const usageTemplate = `Usage:{{if .Runnable}}
+  {{.UseLine}}{{end}}{{if .HasAvailableSubCommands}}
+  {{.CommandPath}} [command]{{end}}{{if gt (len .Aliases) 0}}
+
+Aliases:
+  {{.NameAndAliases}}{{end}}{{if .HasExample}}
+
+Examples:
+{{.Example}}{{end}}{{if .HasAvailableSubCommands}}
+
+Available Commands:{{range .Commands}}{{if (or .IsAvailableCommand (eq .Name "help"))}}
+  {{rpad .Name .NamePadding }} {{.Short}}{{end}}{{end}}{{end}}{{if .HasAvailableLocalFlags}}
+
+{{groupedFlagUsages .LocalFlags "Flags" | trimTrailingWhitespaces}}{{end}}{{if .HasAvailableInheritedFlags}}
+
+{{groupedFlagUsages .InheritedFlags "Global Flags" | trimTrailingWhitespaces}}{{end}}{{if .HasHelpSubCommands}}
+
+Additional help topics:{{range .Commands}}{{if .IsAdditionalHelpTopicCommand}}
+  {{rpad .CommandPath .CommandPathPadding}} {{.Short}}{{end}}{{end}}{{end}}{{if .HasAvailableSubCommands}}
+
+Use "{{.CommandPath}} [command] --help" for more information about a command.{{end}}
+`
+
+func init() {
+	cobra.AddTemplateFunc("groupedFlagUsages", groupedFlagUsages)
+}
+
+// Assigns the named flags within the flag set to a group in the help output.
+func setFlagGroup(fs *pflag.FlagSet, group string, names ...string) {
+	for _, n := range names {
+		_ = fs.SetAnnotation(n, flagGroupAnnotation, []string{group})
+	}
+}
+
+// Returns the usage for the flags with each group of flags under its own heading. Flags that
+// are not assigned to a group are listed first, under the given title.
+func groupedFlagUsages(fs *pflag.FlagSet, title string) string {
+	order := []string{title}
+	groups := map[string]*pflag.FlagSet{title: pflag.NewFlagSet(title, pflag.ContinueOnError)}
+
+	fs.VisitAll(func(f *pflag.Flag) {
+		if f.Hidden {
+			return
+		}
+
+		name := title
+		if g, ok := f.Annotations[flagGroupAnnotation]; ok && len(g) > 0 {
+			name = g[0] + " " + strings.ToLower(title)
+		}
+
+		if _, ok := groups[name]; !ok {
+			order = append(order, name)
+			groups[name] = pflag.NewFlagSet(name, pflag.ContinueOnError)
+		}
+		groups[name].AddFlag(f)
+	})
+
+	var out []string
+	for _, name := range order {
+		if !groups[name].HasFlags() {
+			continue
+		}
+
+		out = append(out, strings.Title(name)+":\n"+strings.TrimRight(groups[name].FlagUsages(), " \n"))
+	}
+
+	return strings.Join(out, "\n\n")
+}
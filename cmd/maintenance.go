@@ -0,0 +1,92 @@
+package cmd
+
+import (
+	"fmt"
+	"github.com/spf13/cobra"
+	"net/http"
+	"time"
+)
+
+var maintenanceArgs struct {
+	Reason string
+}
+
+var maintenanceCmd = &cobra.Command{
+	Use:   "maintenance",
+	Short: "Manage maintenance mode for this node using the running daemon.",
+	Long: `While a node is in maintenance mode servers cannot be started or transferred to it,
+but running servers can still be stopped and their files accessed. This allows a node
+to be drained before it is taken offline, for example to apply kernel updates.`,
+}
+
+var maintenanceEnableCmd = &cobra.Command{
+	Use:   "enable",
+	Short: "Put this node into maintenance mode.",
+	Args:  cobra.NoArgs,
+	Run: func(cmd *cobra.Command, args []string) {
+		setMaintenance(true)
+	},
+}
+
+var maintenanceDisableCmd = &cobra.Command{
+	Use:   "disable",
+	Short: "Take this node out of maintenance mode.",
+	Args:  cobra.NoArgs,
+	Run: func(cmd *cobra.Command, args []string) {
+		setMaintenance(false)
+	},
+}
+
+var maintenanceStatusCmd = &cobra.Command{
+	Use:   "status",
+	Short: "Show whether or not this node is in maintenance mode.",
+	Args:  cobra.NoArgs,
+	Run: func(cmd *cobra.Command, args []string) {
+		var res maintenanceState
+		if err := newLocalClient().request(http.MethodGet, "/api/system/maintenance", nil, &res); err != nil {
+			exitWithServerError(err)
+		}
+
+		res.print()
+	},
+}
+
+func init() {
+	maintenanceEnableCmd.Flags().StringVar(&maintenanceArgs.Reason, "reason", "", "the reason the node is in maintenance mode")
+
+	maintenanceCmd.AddCommand(maintenanceEnableCmd, maintenanceDisableCmd, maintenanceStatusCmd)
+}
+
+// The maintenance state as returned by the daemon API.
+type maintenanceState struct {
+	Enabled bool       `json:"enabled"`
+	Reason  string     `json:"reason"`
+	Since   *time.Time `json:"since"`
+}
+
+func (m maintenanceState) print() {
+	if !m.Enabled {
+		fmt.Println("This node is not in maintenance mode.")
+		return
+	}
+
+	fmt.Print("This node is in maintenance mode")
+	if m.Since != nil {
+		fmt.Printf(" since %s", m.Since.Local().Format(time.RFC1123))
+	}
+	fmt.Println(".")
+
+	if m.Reason != "" {
+		fmt.Println("Reason:", m.Reason)
+	}
+}
+
+func setMaintenance(enabled bool) {
+	var res maintenanceState
+	body := map[string]interface{}{"enabled": enabled, "reason": maintenanceArgs.Reason}
+	if err := newLocalClient().request(http.MethodPost, "/api/system/maintenance", body, &res); err != nil {
+		exitWithServerError(err)
+	}
+
+	res.print()
+}
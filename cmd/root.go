@@ -1,30 +1,38 @@
 package cmd
 
 import (
+	"context"
 	"crypto/tls"
 	"fmt"
 	"github.com/NYTimes/logrotate"
 	"github.com/apex/log"
 	"github.com/apex/log/handlers/multi"
 	"github.com/avatag-host/claws/loggers/cli"
+	"github.com/avatag-host/claws/loggers/journald"
+	"github.com/avatag-host/claws/loggers/json"
+	"github.com/avatag-host/claws/loggers/syslog"
 	"github.com/docker/docker/client"
 	"github.com/gammazero/workerpool"
 	"github.com/mitchellh/colorstring"
 	"golang.org/x/crypto/acme"
 	"golang.org/x/crypto/acme/autocert"
+	"net"
 	"net/http"
 	"os"
+	"os/signal"
 	"path"
 	"path/filepath"
 	"runtime"
+	"sync"
+	"syscall"
 
 	"github.com/avatag-host/claws/config"
 	"github.com/avatag-host/claws/environment"
+	"github.com/avatag-host/claws/ftp"
 	"github.com/avatag-host/claws/router"
 	"github.com/avatag-host/claws/server"
 	"github.com/avatag-host/claws/system"
 	"github.com/pkg/errors"
-	"github.com/pkg/profile"
 	"github.com/spf13/cobra"
 )
 
@@ -46,7 +54,13 @@ var root = &cobra.Command{
 			os.Exit(1)
 		}
 	},
-	Run: rootCmdRun,
+	Run: func(cmd *cobra.Command, args []string) {
+		if runAsService(func() { rootCmdRun(cmd, args) }) {
+			return
+		}
+
+		rootCmdRun(cmd, args)
+	},
 }
 
 func init() {
@@ -59,12 +73,23 @@ func init() {
 	}
 	root.PersistentFlags().BoolVar(&showVersion, "version", false, "show the version and exit")
 	root.PersistentFlags().BoolVar(&debug, "debug", false, "pass in order to run wings in debug mode")
-	root.PersistentFlags().BoolVar(&shouldRunProfiler, "profile", false, "pass in order to profile wings")
-	root.PersistentFlags().BoolVar(&useAutomaticTls, "auto-tls", false, "pass in order to have wings generate and manage it's own SSL certificates using Let's Encrypt")
+	root.PersistentFlags().BoolVar(&shouldRunProfiler, "profile", false, "enable the profiling endpoints under /api/system/debug")
+	root.PersistentFlags().MarkDeprecated("profile", "enable api.debug_endpoints in the configuration, or at runtime using POST /api/system/debug, instead")
+	root.PersistentFlags().BoolVar(&useAutomaticTls, "auto-tls", false, "pass in order to have wings generate and manage it's own SSL certificates using Let's Encrypt, or the ACME directory set in api.acme")
 	root.PersistentFlags().StringVar(&tlsHostname, "tls-hostname", "", "required with --auto-tls, the FQDN for the generated SSL certificate")
 
+	setFlagGroup(root.PersistentFlags(), "TLS", "auto-tls", "tls-hostname")
+	setFlagGroup(root.PersistentFlags(), "Debugging", "debug", "profile")
+	root.SetUsageTemplate(usageTemplate)
+
 	root.AddCommand(configureCmd)
 	root.AddCommand(diagnosticsCmd)
+	root.AddCommand(configCmd)
+	root.AddCommand(serviceCmd)
+	root.AddCommand(updateCmd)
+	root.AddCommand(completionCmd)
+	root.AddCommand(serverCmd)
+	root.AddCommand(maintenanceCmd)
 }
 
 // Get the configuration path based on the arguments provided.
@@ -85,7 +110,7 @@ func rootCmdRun(*cobra.Command, []string) {
 	}
 
 	if shouldRunProfiler {
-		defer profile.Start().Stop()
+		router.SetDebugEndpointsEnabled(true)
 	}
 
 	// Only attempt configuration file relocation if a custom location has not
@@ -108,12 +133,18 @@ func rootCmdRun(*cobra.Command, []string) {
 		c.Debug = true
 	}
 
-	printLogo()
-	if err := configureLogging(c.System.LogDirectory, c.Debug); err != nil {
+	// The logo would otherwise be mixed in with the JSON log entries written to the console.
+	if c.LogFormat != "json" {
+		printLogo()
+	}
+	if err := configureLogging(c.System.LogDirectory, c.Debug, c.LogFormat, c.System.LogSinks); err != nil {
 		panic(err)
 	}
 
 	log.WithField("path", c.GetPath()).Info("loading configuration from path")
+	for _, e := range c.UnknownKeys() {
+		log.WithField("error", e.Message).Warn("ignoring unknown key in configuration file, run \"claws config validate\" for details")
+	}
 	if c.Debug {
 		log.Debug("running in debug mode")
 		log.Warn("certificate checking is disabled")
@@ -155,14 +186,22 @@ func rootCmdRun(*cobra.Command, []string) {
 		}).Info("configured system user successfully")
 	}
 
+	// Log shipping and the event bridge must be configured before the servers are loaded so
+	// that the listeners for each server are registered.
+	server.ConfigureLogShipping()
+	server.ConfigureEventBridge()
+	server.ConfigureActivity()
+
 	if err := server.LoadDirectory(); err != nil {
 		log.WithField("error", err).Fatal("failed to load server configurations")
 		return
 	}
 
-	if err := environment.ConfigureDocker(&c.Docker); err != nil {
-		log.WithField("error", err).Fatal("failed to configure docker environment")
-		return
+	if c.Environment != config.EnvironmentProcess && c.Environment != config.EnvironmentLxd {
+		if err := environment.ConfigureDocker(&c.Docker); err != nil {
+			log.WithField("error", err).Fatal("failed to configure docker environment")
+			return
+		}
 	}
 
 	if err := c.WriteToDisk(); err != nil {
@@ -179,68 +218,65 @@ func rootCmdRun(*cobra.Command, []string) {
 		log.WithField("error", errors.WithStack(err)).Error("failed to retrieve locally cached server states from disk, assuming all servers in offline state")
 	}
 
-	// Create a new workerpool that limits us to 4 servers being bootstrapped at a time
+	// Create a new workerpool that limits the number of servers being bootstrapped at a time
 	// on Wings. This allows us to ensure the environment exists, write configurations,
 	// and reboot processes without causing a slow-down due to sequential booting.
-	pool := workerpool.New(4)
+	pool := workerpool.New(c.System.BootConcurrency)
+
+	// Servers are restored one priority class at a time, so that servers other servers depend
+	// on, such as proxies and databases, are started first.
+	tracker := server.NewBootTracker(server.GetServers().All())
+	for _, group := range tracker.Groups() {
+		var wg sync.WaitGroup
+		for _, serv := range group {
+			s := serv
+
+			wg.Add(1)
+			pool.Submit(func() {
+				defer wg.Done()
+				defer tracker.Done(s)
+
+				restoreServerState(s, states[s.Id()], tracker)
+			})
+		}
+		wg.Wait()
+	}
 
-	for _, serv := range server.GetServers().All() {
-		s := serv
+	// Wait until all of the servers are ready to go before we fire up the SFTP and HTTP servers.
+	pool.StopWait()
 
-		pool.Submit(func() {
-			s.Log().Info("configuring server environment and restoring to previous state")
+	// Begin recording the resource usage history for all of the servers on the node.
+	go server.TrackResourceHistory()
 
-			var st string
-			if state, exists := states[s.Id()]; exists {
-				st = state
-			}
+	// Restart servers on the schedules defined for them in the Panel.
+	go server.RunScheduledRestarts()
 
-			r, err := s.Environment.IsRunning()
-			// We ignore missing containers because we don't want to actually block booting of wings at this
-			// point. If we didn't do this and you pruned all of the images and then started wings you could
-			// end up waiting a long period of time for all of the images to be re-pulled on Wings boot rather
-			// than when the server itself is started.
-			if err != nil && !client.IsErrNotFound(err) {
-				s.Log().WithField("error", err).Error("error checking server environment status")
-			}
+	// Keep servers in sync with their containers if they are changed outside of Wings.
+	server.StartReconciler()
+
+	// Reload the configuration from the disk whenever a SIGHUP is received, and save the state
+	// that is only written periodically when Wings is asked to stop.
+	go handleReloadSignals()
+	go handleShutdownSignals()
 
-			// Check if the server was previously running. If so, attempt to start the server now so that Wings
-			// can pick up where it left off. If the environment does not exist at all, just create it and then allow
-			// the normal flow to execute.
-			//
-			// This does mean that booting wings after a catastrophic machine crash and wiping out the Docker images
-			// as a result will result in a slow boot.
-			if !r && (st == environment.ProcessRunningState || st == environment.ProcessStartingState) {
-				if err := s.HandlePowerAction(server.PowerActionStart); err != nil {
-					s.Log().WithField("error", errors.WithStack(err)).Warn("failed to return server to running state")
-				}
-			} else if r || (!r && s.IsRunning()) {
-				// If the server is currently running on Docker, mark the process as being in that state.
-				// We never want to stop an instance that is currently running external from Wings since
-				// that is a good way of keeping things running even if Wings gets in a very corrupted state.
-				//
-				// This will also validate that a server process is running if the last tracked state we have
-				// is that it was running, but we see that the container process is not currently running.
-				s.Log().Info("detected server is running, re-attaching to process...")
-
-				s.SetState(environment.ProcessRunningState)
-				if err := s.Environment.Attach(); err != nil {
-					s.Log().WithField("error", errors.WithStack(err)).Warn("failed to attach to running server environment")
-				}
+	// Install new releases automatically when enabled. This checks the configuration on
+	// each run so that it can be enabled without restarting.
+	go runAutomaticUpdates()
 
+	if c.System.Ftp.Enabled {
+		go func() {
+			s, err := ftp.New(c)
+			if err != nil {
+				log.WithField("error", err).Error("failed to configure ftps server")
 				return
 			}
 
-			// Addresses potentially invalid data in the stored file that can cause Wings to lose
-			// track of what the actual server state is.
-			_ = s.SetState(environment.ProcessOfflineState)
-		})
+			if err := s.Run(); err != nil {
+				log.WithField("error", err).Error("ftps server encountered an error while running")
+			}
+		}()
 	}
 
-	// Wait until all of the servers are ready to go before we fire up the SFTP and HTTP servers.
-	pool.StopWait()
-
-
 	// Ensure the archive directory exists.
 	if err := os.MkdirAll(c.System.ArchiveDirectory, 0755); err != nil {
 		log.WithField("error", err).Error("failed to create archive directory")
@@ -259,7 +295,13 @@ func rootCmdRun(*cobra.Command, []string) {
 	}).Info("configuring internal webserver")
 
 	// Configure the router.
-	r := router.Configure()
+	r := router.ExposeResponseWriter(router.Configure())
+
+	// Serve the API on the local socket as well so that the CLI is able to manage servers
+	// on this node.
+	if c.Api.Socket != "" && runtime.GOOS != "windows" {
+		go serveLocalSocket(c.Api.Socket, r)
+	}
 
 	s := &http.Server{
 		Addr:    fmt.Sprintf("%s:%d", c.Api.Host, c.Api.Port),
@@ -299,14 +341,24 @@ func rootCmdRun(*cobra.Command, []string) {
 
 	// Check if the server should run with TLS but using autocert.
 	if useAutomaticTls && len(tlsHostname) > 0 {
+		cache := autocert.DirCache(path.Join(c.System.RootDirectory, "/.tls-cache"))
+
+		client, err := configureAcmeClient(context.Background(), c.Api.Acme, cache)
+		if err != nil {
+			log.WithFields(log.Fields{"directory": c.Api.Acme.DirectoryUrl, "error": err}).Fatal("failed to configure ACME client for auto-tls")
+			os.Exit(1)
+		}
+
 		m := autocert.Manager{
 			Prompt:     autocert.AcceptTOS,
-			Cache:      autocert.DirCache(path.Join(c.System.RootDirectory, "/.tls-cache")),
+			Cache:      cache,
 			HostPolicy: autocert.HostWhitelist(tlsHostname),
+			Client:     client,
+			Email:      c.Api.Acme.Email,
 		}
 
-		log.WithField("hostname", tlsHostname).
-			Info("webserver is now listening with auto-TLS enabled; certificates will be automatically generated by Let's Encrypt")
+		log.WithFields(log.Fields{"hostname": tlsHostname, "directory": client.DirectoryURL}).
+			Info("webserver is now listening with auto-TLS enabled; certificates will be automatically generated using the configured ACME directory")
 
 		// Hook autocert into the main http server.
 		s.TLSConfig.GetCertificate = m.GetCertificate
@@ -331,7 +383,27 @@ func rootCmdRun(*cobra.Command, []string) {
 
 	// Check if main http server should run with TLS.
 	if c.Api.Ssl.Enabled {
-		if err := s.ListenAndServeTLS(c.Api.Ssl.CertificateFile, c.Api.Ssl.KeyFile); err != nil {
+		// Serve the certificate through a reloader so that a renewed certificate is picked up
+		// without restarting and dropping every active websocket connection.
+		cr, err := system.NewCertificateReloader(c.Api.Ssl.CertificateFile, c.Api.Ssl.KeyFile)
+		if err != nil {
+			log.WithFields(log.Fields{"auto_tls": false, "error": err}).Fatal("failed to load TLS certificate for HTTPS server")
+			os.Exit(1)
+		}
+
+		// Serve any additional certificates to clients connecting using their hostnames.
+		sel := system.NewCertificateSelector(cr)
+		for _, sc := range c.Api.Ssl.Certificates {
+			r, err := system.NewCertificateReloader(sc.CertificateFile, sc.KeyFile)
+			if err != nil {
+				log.WithFields(log.Fields{"hostnames": sc.Hostnames, "error": err}).Fatal("failed to load TLS certificate for HTTPS server")
+				os.Exit(1)
+			}
+			sel.Add(sc.Hostnames, r)
+		}
+		s.TLSConfig.GetCertificate = sel.GetCertificate
+
+		if err := s.ListenAndServeTLS("", ""); err != nil {
 			log.WithFields(log.Fields{"auto_tls": false, "error": err}).Fatal("failed to configure HTTPS server")
 			os.Exit(1)
 		}
@@ -346,6 +418,94 @@ func rootCmdRun(*cobra.Command, []string) {
 	}
 }
 
+// Configures the environment for a server when Wings boots and returns it to the state it was
+// in when Wings was last stopped.
+func restoreServerState(s *server.Server, st string, tracker *server.BootTracker) {
+	s.Log().Info("configuring server environment and restoring to previous state")
+
+	r, err := s.Environment.IsRunning()
+	// We ignore missing containers because we don't want to actually block booting of wings at this
+	// point. If we didn't do this and you pruned all of the images and then started wings you could
+	// end up waiting a long period of time for all of the images to be re-pulled on Wings boot rather
+	// than when the server itself is started.
+	if err != nil && !client.IsErrNotFound(err) {
+		s.Log().WithField("error", err).Error("error checking server environment status")
+	}
+
+	// Check if the server was previously running. If so, attempt to start the server now so that Wings
+	// can pick up where it left off. If the environment does not exist at all, just create it and then allow
+	// the normal flow to execute.
+	//
+	// This does mean that booting wings after a catastrophic machine crash and wiping out the Docker images
+	// as a result will result in a slow boot.
+	if !r && (st == environment.ProcessRunningState || st == environment.ProcessStartingState) {
+		s.WaitForBootDependencies(tracker)
+
+		if err := s.HandlePowerAction(server.PowerActionStart); err != nil {
+			s.Log().WithField("error", errors.WithStack(err)).Warn("failed to return server to running state")
+		}
+	} else if r || (!r && s.IsRunning()) {
+		// If the server is currently running on Docker, mark the process as being in that state.
+		// We never want to stop an instance that is currently running external from Wings since
+		// that is a good way of keeping things running even if Wings gets in a very corrupted state.
+		//
+		// This will also validate that a server process is running if the last tracked state we have
+		// is that it was running, but we see that the container process is not currently running.
+		//
+		// Servers with a restart policy may have been brought back up by Docker while Wings was not
+		// running, in which case we attach to them here rather than starting them a second time.
+		s.Log().Info("detected server is running, re-attaching to process...")
+
+		s.SetState(environment.ProcessRunningState)
+		if err := s.Environment.Attach(); err != nil {
+			s.Log().WithField("error", errors.WithStack(err)).Warn("failed to attach to running server environment")
+		}
+
+		// A suspended server may have been paused, in which case the container is still running.
+		s.SyncPausedState()
+
+		return
+	}
+
+	// Processes and LXD containers cannot be re-attached to once Wings restarts, so attaching to
+	// them cleans up anything left running by the previous instance of Wings instead.
+	if t := s.Environment.Type(); t == "process" || t == "lxd" {
+		_ = s.Environment.Attach()
+	}
+
+	// Addresses potentially invalid data in the stored file that can cause Wings to lose
+	// track of what the actual server state is.
+	_ = s.SetState(environment.ProcessOfflineState)
+}
+
+// Serves the API on a unix socket that is only accessible by the user running the daemon.
+func serveLocalSocket(p string, h http.Handler) {
+	if err := os.MkdirAll(filepath.Dir(p), 0755); err != nil {
+		log.WithField("error", err).Error("failed to create directory for local api socket")
+		return
+	}
+
+	// Remove the socket left behind if the daemon did not exit cleanly.
+	_ = os.Remove(p)
+
+	l, err := net.Listen("unix", p)
+	if err != nil {
+		log.WithField("error", err).Error("failed to listen on local api socket")
+		return
+	}
+
+	if err := os.Chmod(p, 0600); err != nil {
+		l.Close()
+		log.WithField("error", err).Error("failed to set permissions on local api socket")
+		return
+	}
+
+	log.WithField("path", p).Info("serving api on local socket")
+	if err := http.Serve(l, router.LocalHandler(h)); err != nil {
+		log.WithField("error", err).Error("local api socket encountered an error while running")
+	}
+}
+
 // Execute calls cobra to handle cli commands
 func Execute() error {
 	return root.Execute()
@@ -353,7 +513,7 @@ func Execute() error {
 
 // Configures the global logger for Zap so that we can call it from any location
 // in the code without having to pass around a logger instance.
-func configureLogging(logDir string, debug bool) error {
+func configureLogging(logDir string, debug bool, format string, sinks config.LogSinkConfiguration) error {
 	if err := os.MkdirAll(path.Join(logDir, "/install"), 0700); err != nil {
 		return errors.WithStack(err)
 	}
@@ -370,12 +530,36 @@ func configureLogging(logDir string, debug bool) error {
 		log.SetLevel(log.InfoLevel)
 	}
 
-	log.SetHandler(multi.New(
-		cli.Default,
-		cli.New(w.File, false),
-	))
+	handlers := []log.Handler{cli.Default, cli.New(w.File, false)}
+	if format == "json" {
+		handlers = []log.Handler{json.Default, json.New(w.File)}
+	}
+
+	// A sink that cannot be connected to should not prevent Wings from booting, so any errors
+	// are logged once the other handlers are configured.
+	var sinkErrors []error
+	if sinks.Syslog.Enabled {
+		if h, err := syslog.New(sinks.Syslog.Network, sinks.Syslog.Address, sinks.Syslog.Tag); err != nil {
+			sinkErrors = append(sinkErrors, errors.Wrap(err, "failed to connect to syslog"))
+		} else {
+			handlers = append(handlers, h)
+		}
+	}
+
+	if sinks.Journald.Enabled {
+		if h, err := journald.New("claws"); err != nil {
+			sinkErrors = append(sinkErrors, errors.Wrap(err, "failed to connect to the systemd journal"))
+		} else {
+			handlers = append(handlers, h)
+		}
+	}
+
+	log.SetHandler(multi.New(handlers...))
 
 	log.WithField("path", p).Info("writing log files to disk")
+	for _, err := range sinkErrors {
+		log.WithField("error", err).Warn("failed to configure additional log output")
+	}
 
 	return nil
 }
@@ -425,3 +609,30 @@ for this issue, it will be closed.[reset]
 `))
 	os.Exit(1)
 }
+
+// Persists any state that is only written to the disk periodically and then exits once the
+// process receives a SIGINT or SIGTERM.
+func handleShutdownSignals() {
+	ch := make(chan os.Signal, 1)
+	signal.Notify(ch, syscall.SIGINT, syscall.SIGTERM)
+
+	sig := <-ch
+	log.WithField("signal", sig.String()).Info("received shutdown signal, saving resource usage history before exiting")
+	server.SaveResourceHistory()
+
+	os.Exit(0)
+}
+
+// Reloads the configuration file each time the process receives a SIGHUP.
+func handleReloadSignals() {
+	ch := make(chan os.Signal, 1)
+	signal.Notify(ch, syscall.SIGHUP)
+
+	for range ch {
+		log.Info("received SIGHUP, reloading configuration and tls certificates from disk")
+		if _, err := server.ReloadConfiguration(); err != nil {
+			log.WithField("error", err).Error("failed to reload configuration")
+		}
+		system.ReloadCertificates()
+	}
+}
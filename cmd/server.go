@@ -0,0 +1,355 @@
+package cmd
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"encoding/json"
+	"fmt"
+	"github.com/avatag-host/claws/config"
+	"github.com/avatag-host/claws/environment"
+	"github.com/docker/go-units"
+	"github.com/spf13/cobra"
+	"io"
+	"net"
+	"net/http"
+	"os"
+	"runtime"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+	"time"
+)
+
+var serverArgs struct {
+	Lines   int
+	Timeout int
+}
+
+var serverCmd = &cobra.Command{
+	Use:   "server",
+	Short: "Manage the servers on this node using the running daemon.",
+	Long: `Manage the servers on this node by talking to the running daemon directly, without
+needing the Panel to be reachable. Servers can be referenced using their full UUID or
+the first characters of it, as shown in the Panel.`,
+}
+
+var serverListCmd = &cobra.Command{
+	Use:   "list",
+	Short: "List the servers on this node.",
+	Args:  cobra.NoArgs,
+	Run: func(cmd *cobra.Command, args []string) {
+		servers, err := newLocalClient().servers()
+		if err != nil {
+			exitWithServerError(err)
+		}
+
+		w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+		fmt.Fprintln(w, "UUID\tSTATE\tMEMORY\tDISK\tSUSPENDED\tPANEL")
+		for _, s := range servers {
+			panel := s.Panel
+			if panel == "" {
+				panel = "-"
+			}
+
+			fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%t\t%s\n", s.Uuid, s.Resources.State, units.BytesSize(float64(s.Resources.Memory)), units.BytesSize(float64(s.Resources.Disk)), s.Suspended, panel)
+		}
+		w.Flush()
+	},
+}
+
+var serverStatusCmd = &cobra.Command{
+	Use:   "status <server>",
+	Short: "Show the state and resource usage of a server.",
+	Args:  cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		c := newLocalClient()
+
+		s, err := c.find(args[0])
+		if err != nil {
+			exitWithServerError(err)
+		}
+
+		w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+		fmt.Fprintf(w, "UUID:\t%s\n", s.Uuid)
+		fmt.Fprintf(w, "State:\t%s\n", s.Resources.State)
+		fmt.Fprintf(w, "Suspended:\t%t\n", s.Suspended)
+		fmt.Fprintf(w, "CPU:\t%.2f%%\n", s.Resources.CpuAbsolute)
+		fmt.Fprintf(w, "Memory:\t%s / %s\n", units.BytesSize(float64(s.Resources.Memory)), units.BytesSize(float64(s.Resources.MemoryLimit)))
+		fmt.Fprintf(w, "Disk:\t%s\n", units.BytesSize(float64(s.Resources.Disk)))
+		fmt.Fprintf(w, "Addresses:\t%s\n", strings.Join(s.Addresses, ", "))
+		w.Flush()
+	},
+}
+
+var serverPowerCmd = &cobra.Command{
+	Use:       "power <server> <start|stop|restart|kill>",
+	Short:     "Send a power action to a server.",
+	Args:      cobra.ExactArgs(2),
+	ValidArgs: []string{"start", "stop", "restart", "kill"},
+	Run: func(cmd *cobra.Command, args []string) {
+		c := newLocalClient()
+
+		s, err := c.find(args[0])
+		if err != nil {
+			exitWithServerError(err)
+		}
+
+		if err := c.request(http.MethodPost, "/api/servers/"+s.Uuid+"/power", map[string]string{"action": args[1]}, nil); err != nil {
+			exitWithServerError(err)
+		}
+
+		fmt.Printf("Sent the %s action to server %s.\n", args[1], s.Uuid)
+	},
+}
+
+var serverExecCmd = &cobra.Command{
+	Use:   "exec <server> -- <command> [args...]",
+	Short: "Run a command inside of a running server and print its output.",
+	Args:  cobra.MinimumNArgs(2),
+	Run: func(cmd *cobra.Command, args []string) {
+		c := newLocalClient()
+
+		s, err := c.find(args[0])
+		if err != nil {
+			exitWithServerError(err)
+		}
+
+		var res environment.ExecResult
+		body := map[string]interface{}{"command": args[1:], "timeout": serverArgs.Timeout}
+		if err := c.request(http.MethodPost, "/api/servers/"+s.Uuid+"/exec", body, &res); err != nil {
+			exitWithServerError(err)
+		}
+
+		fmt.Fprint(os.Stdout, res.Stdout)
+		fmt.Fprint(os.Stderr, res.Stderr)
+		if res.Truncated {
+			fmt.Fprintln(os.Stderr, "(output truncated)")
+		}
+
+		os.Exit(res.ExitCode)
+	},
+}
+
+var serverRepairPermissionsCmd = &cobra.Command{
+	Use:   "repair-permissions <server>",
+	Short: "Fix the owner and permissions of every file for a server.",
+	Long: `Sets the owner of every file for a server to the user that the server runs as, and
+ensures that user can read and write them. This fixes "permission denied" errors after
+files have been created by another user, without restarting the server.`,
+	Args: cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		c := newLocalClient()
+
+		s, err := c.find(args[0])
+		if err != nil {
+			exitWithServerError(err)
+		}
+
+		fmt.Printf("Repairing the permissions for server %s, this could take a while...\n", s.Uuid)
+
+		// Servers with a lot of files can take longer than the usual timeout to repair.
+		c.client.Timeout = 0
+
+		var res struct {
+			Files int64 `json:"files"`
+		}
+		if err := c.request(http.MethodPost, "/api/servers/"+s.Uuid+"/files/repair-permissions?wait=true", nil, &res); err != nil {
+			exitWithServerError(err)
+		}
+
+		fmt.Printf("Repaired the permissions for %d files.\n", res.Files)
+	},
+}
+
+var serverLogsCmd = &cobra.Command{
+	Use:   "logs <server>",
+	Short: "Print the most recent console output of a server.",
+	Args:  cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		c := newLocalClient()
+
+		s, err := c.find(args[0])
+		if err != nil {
+			exitWithServerError(err)
+		}
+
+		var res struct {
+			Data []string `json:"data"`
+		}
+		if err := c.request(http.MethodGet, "/api/servers/"+s.Uuid+"/logs?size="+strconv.Itoa(serverArgs.Lines), nil, &res); err != nil {
+			exitWithServerError(err)
+		}
+
+		for _, line := range res.Data {
+			fmt.Println(line)
+		}
+	},
+}
+
+func init() {
+	serverExecCmd.Flags().IntVar(&serverArgs.Timeout, "timeout", 0, "the number of seconds to wait for the command to finish")
+	serverLogsCmd.Flags().IntVarP(&serverArgs.Lines, "lines", "n", 100, "the number of lines to print, up to 100")
+
+	serverCmd.AddCommand(serverListCmd, serverStatusCmd, serverPowerCmd, serverExecCmd, serverLogsCmd, serverRepairPermissionsCmd)
+}
+
+func exitWithServerError(err error) {
+	fmt.Println(err.Error())
+	os.Exit(1)
+}
+
+// A server as returned by the daemon API.
+type localServer struct {
+	Uuid      string   `json:"uuid"`
+	Panel     string   `json:"panel"`
+	Suspended bool     `json:"suspended"`
+	Addresses []string `json:"addresses"`
+	Resources struct {
+		State       string  `json:"state"`
+		Memory      uint64  `json:"memory_bytes"`
+		MemoryLimit uint64  `json:"memory_limit_bytes"`
+		CpuAbsolute float64 `json:"cpu_absolute"`
+		Disk        int64   `json:"disk_bytes"`
+	} `json:"resources"`
+}
+
+// A client for the API of the daemon running on this node.
+type localClient struct {
+	client *http.Client
+	base   string
+	token  string
+}
+
+// Returns a client for the daemon running on this node. The local socket is used if it is
+// available, otherwise requests are made to the API using the token from the configuration.
+func newLocalClient() *localClient {
+	c, err := config.ReadConfiguration(configPath)
+	if err != nil {
+		exitWithServerError(fmt.Errorf("failed to read the configuration file at %s: %s", configPath, err.Error()))
+	}
+
+	if c.Api.Socket != "" && runtime.GOOS != "windows" {
+		if _, err := os.Stat(c.Api.Socket); err == nil {
+			socket := c.Api.Socket
+
+			return &localClient{
+				client: &http.Client{
+					Timeout: time.Minute * 2,
+					Transport: &http.Transport{
+						DialContext: func(ctx context.Context, _, _ string) (net.Conn, error) {
+							var d net.Dialer
+							return d.DialContext(ctx, "unix", socket)
+						},
+					},
+				},
+				base: "http://claws",
+			}
+		}
+	}
+
+	host := c.Api.Host
+	if ip := net.ParseIP(host); host == "" || (ip != nil && ip.IsUnspecified()) {
+		host = "127.0.0.1"
+	}
+
+	scheme := "http"
+	transport := &http.Transport{}
+	if c.Api.Ssl.Enabled {
+		scheme = "https"
+		// The certificate is issued for the public hostname of the node rather than the
+		// local address being connected to.
+		transport.TLSClientConfig = &tls.Config{InsecureSkipVerify: true}
+	}
+
+	return &localClient{
+		client: &http.Client{Timeout: time.Minute * 2, Transport: transport},
+		base:   fmt.Sprintf("%s://%s", scheme, net.JoinHostPort(host, strconv.Itoa(c.Api.Port))),
+		token:  c.AuthenticationToken,
+	}
+}
+
+// Makes a request to the daemon, decoding the response into out if it is not nil.
+func (c *localClient) request(method string, path string, body interface{}, out interface{}) error {
+	var r io.Reader
+	if body != nil {
+		b, err := json.Marshal(body)
+		if err != nil {
+			return err
+		}
+		r = bytes.NewReader(b)
+	}
+
+	req, err := http.NewRequest(method, c.base+path, r)
+	if err != nil {
+		return err
+	}
+
+	req.Header.Set("Accept", "application/json")
+	req.Header.Set("Content-Type", "application/json")
+	if c.token != "" {
+		req.Header.Set("Authorization", "Bearer "+c.token)
+	}
+
+	res, err := c.client.Do(req)
+	if err != nil {
+		return fmt.Errorf("failed to connect to the daemon, is it running? %s", err.Error())
+	}
+	defer res.Body.Close()
+
+	if res.StatusCode >= 300 {
+		var e struct {
+			Error string `json:"error"`
+		}
+		_ = json.NewDecoder(res.Body).Decode(&e)
+		if e.Error == "" {
+			e.Error = res.Status
+		}
+
+		return fmt.Errorf("the daemon returned an error: %s", e.Error)
+	}
+
+	if out == nil {
+		return nil
+	}
+
+	return json.NewDecoder(res.Body).Decode(out)
+}
+
+// Returns all of the servers on the node.
+func (c *localClient) servers() ([]localServer, error) {
+	var out []localServer
+	if err := c.request(http.MethodGet, "/api/servers?summary=true", nil, &out); err != nil {
+		return nil, err
+	}
+
+	return out, nil
+}
+
+// Returns the server with the given UUID, or the only server whose UUID starts with it.
+func (c *localClient) find(id string) (*localServer, error) {
+	servers, err := c.servers()
+	if err != nil {
+		return nil, err
+	}
+
+	var match *localServer
+	for i, s := range servers {
+		if s.Uuid == id {
+			return &servers[i], nil
+		}
+
+		if strings.HasPrefix(s.Uuid, id) {
+			if match != nil {
+				return nil, fmt.Errorf("more than one server matches \"%s\", use the full UUID instead", id)
+			}
+			match = &servers[i]
+		}
+	}
+
+	if match == nil {
+		return nil, fmt.Errorf("no server matching \"%s\" was found on this node", id)
+	}
+
+	return match, nil
+}
@@ -0,0 +1,67 @@
+package cmd
+
+import (
+	"fmt"
+	"github.com/spf13/cobra"
+	"os"
+	"path/filepath"
+)
+
+// The name of the service that the daemon is installed as.
+const serviceName = "claws"
+
+var serviceCmd = &cobra.Command{
+	Use:   "service",
+	Short: "Manage the system service used to run the daemon.",
+}
+
+var serviceInstallCmd = &cobra.Command{
+	Use:   "install",
+	Short: "Install and enable a system service that runs the daemon on boot.",
+	Run: func(cmd *cobra.Command, args []string) {
+		path, err := filepath.Abs(configPath)
+		if err != nil {
+			exitWithServiceError(err)
+		}
+
+		if err := installService(path); err != nil {
+			exitWithServiceError(err)
+		}
+
+		fmt.Printf("Installed and enabled the %s service using the configuration at %s.\n", serviceName, path)
+	},
+}
+
+var serviceUninstallCmd = &cobra.Command{
+	Use:   "uninstall",
+	Short: "Stop and remove the system service for the daemon.",
+	Run: func(cmd *cobra.Command, args []string) {
+		if err := uninstallService(); err != nil {
+			exitWithServiceError(err)
+		}
+
+		fmt.Printf("Removed the %s service.\n", serviceName)
+	},
+}
+
+var serviceStatusCmd = &cobra.Command{
+	Use:   "status",
+	Short: "Show whether the system service for the daemon is installed and running.",
+	Run: func(cmd *cobra.Command, args []string) {
+		status, err := serviceStatus()
+		if err != nil {
+			exitWithServiceError(err)
+		}
+
+		fmt.Println(status)
+	},
+}
+
+func init() {
+	serviceCmd.AddCommand(serviceInstallCmd, serviceUninstallCmd, serviceStatusCmd)
+}
+
+func exitWithServiceError(err error) {
+	fmt.Println("Failed to manage the service:", err.Error())
+	os.Exit(1)
+}
@@ -0,0 +1,127 @@
+package cmd
+
+import (
+	"fmt"
+	"github.com/avatag-host/claws/config"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+)
+
+const systemdUnitPath = "/etc/systemd/system/" + serviceName + ".service"
+
+// The daemon runs as root so that it is able to manage containers and the ownership of
+// server files. The file limit is raised since every running server holds open log files
+// and websocket connections.
+var systemdUnitTemplate = `[Unit]
+Description=Claws Daemon
+%s
+[Service]
+User=root
+WorkingDirectory=%s
+LimitNOFILE=4096
+PIDFile=/var/run/claws/daemon.pid
+ExecStart=%s --config %s
+Restart=on-failure
+StartLimitInterval=180
+StartLimitBurst=30
+RestartSec=5s
+
+[Install]
+WantedBy=multi-user.target
+`
+
+// Writes a systemd unit for the daemon using the current executable and the given
+// configuration file, and then enables it.
+func installService(configPath string) error {
+	bin, err := os.Executable()
+	if err != nil {
+		return err
+	}
+
+	// Servers using the Docker environment cannot start until Docker is running, so the unit
+	// is tied to the Docker service unless a different environment has been configured.
+	deps := "After=docker.service\nRequires=docker.service\nPartOf=docker.service\n"
+	if c, err := config.ReadConfiguration(configPath); err == nil && c.Environment != config.EnvironmentDocker {
+		deps = "After=network-online.target\nWants=network-online.target\n"
+	}
+
+	unit := fmt.Sprintf(systemdUnitTemplate, deps, filepath.Dir(configPath), bin, configPath)
+	if err := ioutil.WriteFile(systemdUnitPath, []byte(unit), 0644); err != nil {
+		return err
+	}
+
+	if err := systemctl("daemon-reload"); err != nil {
+		return err
+	}
+
+	return systemctl("enable", serviceName)
+}
+
+// Stops and disables the systemd unit for the daemon and removes it.
+func uninstallService() error {
+	if _, err := os.Stat(systemdUnitPath); err != nil {
+		if os.IsNotExist(err) {
+			return fmt.Errorf("the %s service is not installed", serviceName)
+		}
+
+		return err
+	}
+
+	if err := systemctl("disable", "--now", serviceName); err != nil {
+		return err
+	}
+
+	if err := os.Remove(systemdUnitPath); err != nil {
+		return err
+	}
+
+	return systemctl("daemon-reload")
+}
+
+// Returns a description of the state of the systemd unit for the daemon.
+func serviceStatus() (string, error) {
+	if _, err := os.Stat(systemdUnitPath); err != nil {
+		if os.IsNotExist(err) {
+			return fmt.Sprintf("The %s service is not installed.", serviceName), nil
+		}
+
+		return "", err
+	}
+
+	// Both of these commands exit with a non-zero code when the unit is not enabled or
+	// active, so only the output is used.
+	enabled, _ := exec.Command("systemctl", "is-enabled", serviceName).Output()
+	active, _ := exec.Command("systemctl", "is-active", serviceName).Output()
+
+	return fmt.Sprintf(
+		"The %s service is installed at %s (enabled: %s, state: %s).",
+		serviceName, systemdUnitPath, strings.TrimSpace(string(enabled)), strings.TrimSpace(string(active)),
+	), nil
+}
+
+func systemctl(args ...string) error {
+	if out, err := exec.Command("systemctl", args...).CombinedOutput(); err != nil {
+		return fmt.Errorf("systemctl %s: %s: %s", strings.Join(args, " "), err, strings.TrimSpace(string(out)))
+	}
+
+	return nil
+}
+
+// Restarts the systemd unit for the daemon. The restart is queued rather than waited on so
+// that this can be called from within the daemon itself.
+func restartService() error {
+	if _, err := os.Stat(systemdUnitPath); err != nil {
+		return fmt.Errorf("the %s service is not installed", serviceName)
+	}
+
+	return systemctl("restart", "--no-block", serviceName)
+}
+
+// The daemon is never started by the service manager directly on Linux, so there is nothing
+// to do here.
+func runAsService(run func()) bool {
+	return false
+}
@@ -0,0 +1,30 @@
+// +build !linux,!windows
+
+package cmd
+
+import (
+	"github.com/pkg/errors"
+	"runtime"
+)
+
+var errServiceUnsupported = errors.New("services can not be managed on " + runtime.GOOS)
+
+func installService(configPath string) error {
+	return errServiceUnsupported
+}
+
+func uninstallService() error {
+	return errServiceUnsupported
+}
+
+func serviceStatus() (string, error) {
+	return "", errServiceUnsupported
+}
+
+func restartService() error {
+	return errServiceUnsupported
+}
+
+func runAsService(run func()) bool {
+	return false
+}
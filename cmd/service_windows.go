@@ -0,0 +1,176 @@
+package cmd
+
+import (
+	"fmt"
+	"github.com/avatag-host/claws/server"
+	"golang.org/x/sys/windows/svc"
+	"golang.org/x/sys/windows/svc/mgr"
+	"os"
+	"time"
+)
+
+// Registers the daemon as a Windows service that starts on boot and is restarted by the
+// service manager if it exits unexpectedly.
+func installService(configPath string) error {
+	bin, err := os.Executable()
+	if err != nil {
+		return err
+	}
+
+	m, err := mgr.Connect()
+	if err != nil {
+		return err
+	}
+	defer m.Disconnect()
+
+	if s, err := m.OpenService(serviceName); err == nil {
+		s.Close()
+		return fmt.Errorf("the %s service is already installed", serviceName)
+	}
+
+	s, err := m.CreateService(serviceName, bin, mgr.Config{
+		DisplayName: "Claws Daemon",
+		StartType:   mgr.StartAutomatic,
+	}, "--config", configPath)
+	if err != nil {
+		return err
+	}
+	defer s.Close()
+
+	return s.SetRecoveryActions([]mgr.RecoveryAction{
+		{Type: mgr.ServiceRestart, Delay: 5 * time.Second},
+		{Type: mgr.ServiceRestart, Delay: 5 * time.Second},
+		{Type: mgr.ServiceRestart, Delay: 30 * time.Second},
+	}, uint32((24 * time.Hour).Seconds()))
+}
+
+// Stops the Windows service for the daemon, if it is running, and removes it.
+func uninstallService() error {
+	m, err := mgr.Connect()
+	if err != nil {
+		return err
+	}
+	defer m.Disconnect()
+
+	s, err := m.OpenService(serviceName)
+	if err != nil {
+		return fmt.Errorf("the %s service is not installed", serviceName)
+	}
+	defer s.Close()
+
+	if st, err := s.Query(); err == nil && st.State != svc.Stopped {
+		if _, err := s.Control(svc.Stop); err != nil {
+			return err
+		}
+	}
+
+	return s.Delete()
+}
+
+// Returns a description of the state of the Windows service for the daemon.
+func serviceStatus() (string, error) {
+	m, err := mgr.Connect()
+	if err != nil {
+		return "", err
+	}
+	defer m.Disconnect()
+
+	s, err := m.OpenService(serviceName)
+	if err != nil {
+		return fmt.Sprintf("The %s service is not installed.", serviceName), nil
+	}
+	defer s.Close()
+
+	st, err := s.Query()
+	if err != nil {
+		return "", err
+	}
+
+	states := map[svc.State]string{
+		svc.Stopped:         "stopped",
+		svc.StartPending:    "starting",
+		svc.StopPending:     "stopping",
+		svc.Running:         "running",
+		svc.ContinuePending: "resuming",
+		svc.PausePending:    "pausing",
+		svc.Paused:          "paused",
+	}
+
+	return fmt.Sprintf("The %s service is installed (state: %s).", serviceName, states[st.State]), nil
+}
+
+// Windows services are unable to restart themselves, so the service manager is asked to
+// start the service again once it has stopped. When called from within the service the
+// process exits instead, and the recovery actions configured for the service start it again.
+func restartService() error {
+	if interactive, err := svc.IsAnInteractiveSession(); err == nil && !interactive {
+		os.Exit(1)
+	}
+
+	m, err := mgr.Connect()
+	if err != nil {
+		return err
+	}
+	defer m.Disconnect()
+
+	s, err := m.OpenService(serviceName)
+	if err != nil {
+		return fmt.Errorf("the %s service is not installed", serviceName)
+	}
+	defer s.Close()
+
+	if _, err := s.Control(svc.Stop); err != nil {
+		return err
+	}
+
+	for i := 0; i < 30; i++ {
+		if st, err := s.Query(); err == nil && st.State == svc.Stopped {
+			return s.Start()
+		}
+
+		time.Sleep(time.Second)
+	}
+
+	return fmt.Errorf("the %s service did not stop in time", serviceName)
+}
+
+type serviceHandler struct {
+	run func()
+}
+
+// Runs the daemon and reports its state to the service manager until it is asked to stop.
+func (h *serviceHandler) Execute(args []string, r <-chan svc.ChangeRequest, s chan<- svc.Status) (bool, uint32) {
+	s <- svc.Status{State: svc.StartPending}
+	go h.run()
+	s <- svc.Status{State: svc.Running, Accepts: svc.AcceptStop | svc.AcceptShutdown}
+
+	for c := range r {
+		switch c.Cmd {
+		case svc.Interrogate:
+			s <- c.CurrentStatus
+		case svc.Stop, svc.Shutdown:
+			s <- svc.Status{State: svc.StopPending}
+			server.SaveResourceHistory()
+			return false, 0
+		}
+	}
+
+	return false, 0
+}
+
+// Runs the daemon under the Windows service manager if it was started by it, returning
+// true once the service has been stopped. Returns false if the daemon was started from
+// an interactive session.
+func runAsService(run func()) bool {
+	interactive, err := svc.IsAnInteractiveSession()
+	if err != nil || interactive {
+		return false
+	}
+
+	if err := svc.Run(serviceName, &serviceHandler{run: run}); err != nil {
+		fmt.Println("Failed to run as a service:", err.Error())
+		os.Exit(1)
+	}
+
+	return true
+}
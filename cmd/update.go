@@ -0,0 +1,121 @@
+package cmd
+
+import (
+	"fmt"
+	"github.com/apex/log"
+	"github.com/avatag-host/claws/config"
+	"github.com/avatag-host/claws/system"
+	"github.com/spf13/cobra"
+	"os"
+	"time"
+)
+
+var updateArgs struct {
+	Check         bool
+	Force         bool
+	SkipSignature bool
+	NoRestart     bool
+}
+
+var updateCmd = &cobra.Command{
+	Use:   "update",
+	Short: "Update the daemon to the latest release.",
+	Run:   updateCmdRun,
+}
+
+func init() {
+	updateCmd.Flags().BoolVar(&updateArgs.Check, "check", false, "only check if a new release is available")
+	updateCmd.Flags().BoolVar(&updateArgs.Force, "force", false, "reinstall the latest release even if it is the running version")
+	updateCmd.Flags().BoolVar(&updateArgs.SkipSignature, "skip-signature", false, "install the release without verifying the signature of its checksums")
+	updateCmd.Flags().BoolVar(&updateArgs.NoRestart, "no-restart", false, "do not restart the daemon service once the update is installed")
+}
+
+func updateCmdRun(*cobra.Command, []string) {
+	// The configuration is only needed for the update settings, so fall back to the defaults
+	// if it cannot be read.
+	c, err := config.ReadConfiguration(configPath)
+	if err != nil {
+		if c, err = config.NewFromPath(configPath); err != nil {
+			panic(err)
+		}
+	}
+
+	r, err := system.LatestRelease(c.System.Updates.Url)
+	if err != nil {
+		fmt.Println("Failed to check for a new release:", err.Error())
+		os.Exit(1)
+	}
+
+	if !r.IsNewer() && !updateArgs.Force {
+		fmt.Printf("The latest release (%s) is already installed.\n", r.Version())
+		return
+	}
+
+	if updateArgs.Check {
+		fmt.Printf("A new release is available: %s (running %s).\n", r.Version(), system.Version)
+		return
+	}
+
+	fmt.Printf("Installing release %s...\n", r.Version())
+	if err := r.Install(c.System.Updates.PublicKey, updateArgs.SkipSignature); err != nil {
+		fmt.Println("Failed to install the release:", err.Error())
+		os.Exit(1)
+	}
+
+	fmt.Printf("Installed release %s.\n", r.Version())
+
+	if updateArgs.NoRestart {
+		return
+	}
+
+	if err := restartService(); err != nil {
+		fmt.Println("The daemon must be restarted for the update to take effect:", err.Error())
+		return
+	}
+
+	fmt.Println("Restarted the daemon service.")
+}
+
+// Periodically checks for a new release and installs it, restarting the daemon service
+// once it has been installed.
+func runAutomaticUpdates() {
+	for {
+		cfg := config.Get().System.Updates
+		if cfg.Interval <= 0 {
+			cfg.Interval = 24
+		}
+
+		time.Sleep(time.Duration(cfg.Interval) * time.Hour)
+
+		if !config.Get().System.Updates.Enabled {
+			continue
+		}
+
+		l := log.WithField("subsystem", "updater")
+
+		r, err := system.LatestRelease(cfg.Url)
+		if err != nil {
+			l.WithField("error", err).Warn("failed to check for a new release")
+			continue
+		}
+
+		if !r.IsNewer() {
+			continue
+		}
+
+		l = l.WithField("version", r.Version())
+		l.Info("installing new release")
+
+		if err := r.Install(cfg.PublicKey, false); err != nil {
+			l.WithField("error", err).Error("failed to install new release")
+			continue
+		}
+
+		l.Info("installed new release, restarting service")
+		if err := restartService(); err != nil {
+			l.WithField("error", err).Warn("failed to restart service after installing new release, the update will be applied on the next restart")
+		}
+
+		return
+	}
+}
@@ -8,7 +8,6 @@ import (
 	"github.com/pkg/errors"
 	"gopkg.in/yaml.v2"
 	"io/ioutil"
-	"os"
 	"os/exec"
 	"os/user"
 	"strconv"
@@ -26,6 +25,17 @@ type Configuration struct {
 	// The location from which this configuration instance was instantiated.
 	path string
 
+	// The configuration values that were loaded from secret references, which are written
+	// back to the disk in place of the secret values.
+	secrets []secretReference
+
+	// The configuration values that were set using environment variables, which are written
+	// back to the disk using the values from the configuration file instead.
+	overrides []environmentOverride
+
+	// Problems with keys in the configuration file that do not match a known option.
+	unknown []ValidationError
+
 	// Locker specific to writing the configuration to the disk, this happens
 	// in areas that might already be locked so we don't want to crash the process.
 	writeLock sync.Mutex
@@ -34,6 +44,10 @@ type Configuration struct {
 	// if the debug flag is passed through the command line arguments.
 	Debug bool
 
+	// The format used for log output, either "cli" for human readable output or "json" to
+	// write each entry as a single line of JSON that can be ingested by log aggregation tools.
+	LogFormat string `default:"cli" json:"log_format" yaml:"log_format"`
+
 	// A unique identifier for this node in the Panel.
 	Uuid string
 
@@ -49,6 +63,16 @@ type Configuration struct {
 	System SystemConfiguration `json:"system" yaml:"system"`
 	Docker DockerConfiguration `json:"docker" yaml:"docker"`
 
+	// The environment used to run server processes, either "docker", "process" or "lxd". The
+	// process environment runs servers directly on the host and is intended for systems where
+	// Docker is not available, while the lxd environment runs each server inside of an LXD
+	// system container.
+	Environment string `default:"docker" json:"environment" yaml:"environment"`
+
+	Process ProcessConfiguration `json:"process" yaml:"process"`
+
+	Lxd LxdConfiguration `json:"lxd" yaml:"lxd"`
+
 	// The amount of time in seconds that should elapse between disk usage checks
 	// run by the daemon. Setting a higher number can result in better IO performance
 	// at an increased risk of a malicious user creating a process that goes over
@@ -64,6 +88,10 @@ type Configuration struct {
 	PanelLocation string                   `json:"remote" yaml:"remote"`
 	RemoteQuery   RemoteQueryConfiguration `json:"remote_query" yaml:"remote_query"`
 
+	// Additional Panels that are able to create and manage servers on this node. These are
+	// never changed when the primary Panel updates the configuration.
+	Panels []PanelConfiguration `json:"-" yaml:"panels"`
+
 	// AllowedMounts is a list of allowed host-system mount points.
 	// This is required to have the "Server Mounts" feature work properly.
 	AllowedMounts []string `json:"-" yaml:"allowed_mounts"`
@@ -88,10 +116,66 @@ type ApiConfiguration struct {
 		Enabled         bool   `default:"false"`
 		CertificateFile string `json:"cert" yaml:"cert"`
 		KeyFile         string `json:"key" yaml:"key"`
+
+		// Additional certificates that are served to clients connecting using one of their
+		// hostnames, allowing the API and websocket to be reached under multiple domains. The
+		// certificate above is served to clients using any other hostname.
+		Certificates []SslCertificate `json:"certificates" yaml:"certificates"`
 	}
 
+	// The ACME certificate authority used when Wings generates its own certificates.
+	Acme AcmeConfiguration `json:"acme" yaml:"acme"`
+
+	// The location of a unix socket that the API is also served on, allowing the local CLI to
+	// manage servers without a token. The socket is only accessible by the user Wings is
+	// running as. Set this to an empty value to disable the socket.
+	Socket string `default:"/var/run/claws/claws.sock" yaml:"socket"`
+
+	// Determines if the profiling and runtime statistics endpoints under /api/system/debug are
+	// available. These are only accessible using the token for the primary Panel, and can also
+	// be enabled at runtime through the API without changing this value.
+	DebugEndpoints bool `default:"false" json:"debug_endpoints" yaml:"debug_endpoints"`
+
 	// The maximum size for files uploaded through the Panel in bytes.
 	UploadLimit int `default:"100" json:"upload_limit" yaml:"upload_limit"`
+
+	// Configures the temporary banning of IP addresses that repeatedly fail to authenticate
+	// against the API or the FTPS server.
+	Bans BanConfiguration `json:"bans" yaml:"bans"`
+
+	// The IP addresses or CIDR ranges of reverse proxies in front of Wings. The address of the
+	// client is only read from the X-Forwarded-For header for requests made by these proxies,
+	// otherwise the address the request was made from is used.
+	TrustedProxies []string `json:"-" yaml:"trusted_proxies"`
+}
+
+// A certificate and key pair that is served by the API for specific hostnames.
+type SslCertificate struct {
+	// The hostnames the certificate is served for. A hostname may begin with "*." to match
+	// any single subdomain, such as "*.example.com".
+	Hostnames       []string `json:"hostnames" yaml:"hostnames"`
+	CertificateFile string   `json:"cert" yaml:"cert"`
+	KeyFile         string   `json:"key" yaml:"key"`
+}
+
+// Defines the configuration for temporarily banning IP addresses after a number of failed
+// authentication attempts.
+type BanConfiguration struct {
+	// Determines if IP addresses should be banned after failing to authenticate.
+	Enabled bool `default:"true" json:"enabled" yaml:"enabled"`
+
+	// The number of failed authentication attempts allowed from a single IP address within
+	// the window before it is banned.
+	MaxAttempts int `default:"10" json:"max_attempts" yaml:"max_attempts"`
+
+	// The number of seconds that failed authentication attempts are counted for.
+	Window int `default:"300" json:"window" yaml:"window"`
+
+	// The number of seconds that an IP address is banned for.
+	Duration int `default:"900" json:"duration" yaml:"duration"`
+
+	// IP addresses that are never banned, such as the address of the Panel.
+	IgnoredIps []string `json:"ignored_ips" yaml:"ignored_ips"`
 }
 
 // Defines the configuration settings for remote requests from Wings to the Panel.
@@ -136,12 +220,23 @@ func ReadConfiguration(path string) (*Configuration, error) {
 
 	// Replace environment variables within the configuration file with their
 	// values from the host system.
-	b = []byte(os.ExpandEnv(string(b)))
+	b = []byte(expandConfigurationVariables(string(b)))
 
 	if err := yaml.Unmarshal(b, c); err != nil {
 		return nil, err
 	}
 
+	c.unknown = unknownKeys(b)
+
+	// Values set using environment variables take priority over the configuration file.
+	if err := c.applyEnvironmentOverrides(); err != nil {
+		return nil, err
+	}
+
+	if err := c.resolveSecrets(); err != nil {
+		return nil, err
+	}
+
 	return c, nil
 }
 
@@ -160,6 +255,7 @@ func Set(c *Configuration) {
 	if _config == nil || _config.AuthenticationToken != c.AuthenticationToken {
 		_jwtAlgo = jwt.NewHS256([]byte(c.AuthenticationToken))
 	}
+	c.unsafeSetPanelJwtAlgorithms()
 
 	_config = c
 	mu.Unlock()
@@ -296,9 +392,9 @@ func (c *Configuration) WriteToDisk() error {
 		return errors.New("cannot write configuration, no path defined in struct")
 	}
 
-	b, err := yaml.Marshal(&ccopy)
+	b, err := c.marshalWithSecretReferences(&ccopy)
 	if err != nil {
-		return errors.WithStack(err)
+		return err
 	}
 
 	if err := ioutil.WriteFile(c.GetPath(), b, 0644); err != nil {
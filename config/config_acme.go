@@ -0,0 +1,28 @@
+package config
+
+// The directory used for automatic certificates when no other directory is configured.
+const DefaultAcmeDirectory = "https://acme-v02.api.letsencrypt.org/directory"
+
+// Defines the ACME certificate authority used to generate certificates when Wings is started
+// with the --auto-tls flag.
+type AcmeConfiguration struct {
+	// The directory URL of the ACME server, such as the directory for ZeroSSL, Buypass, or an
+	// internal certificate authority.
+	DirectoryUrl string `default:"https://acme-v02.api.letsencrypt.org/directory" json:"directory_url" yaml:"directory_url"`
+
+	// The email address registered with the account, used by the certificate authority to
+	// send expiry notices.
+	Email string `json:"email" yaml:"email"`
+
+	// The External Account Binding credentials issued by the certificate authority, which are
+	// required by some authorities to link the generated account to an existing account.
+	Eab struct {
+		KeyId   string `json:"key_id" yaml:"key_id"`
+		HmacKey string `json:"hmac_key" yaml:"hmac_key"`
+	} `json:"eab" yaml:"eab"`
+}
+
+// Determines if the account should be registered using External Account Binding.
+func (a AcmeConfiguration) UsesExternalAccount() bool {
+	return a.Eab.KeyId != "" && a.Eab.HmacKey != ""
+}
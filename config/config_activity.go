@@ -0,0 +1,14 @@
+package config
+
+// Defines how activity on servers, such as power actions, console commands and changes to
+// files, is reported to the Panel so that it can be shown in the activity log for a server.
+type ActivityConfiguration struct {
+	Enabled bool `default:"false" yaml:"enabled"`
+
+	// The number of seconds between sending batches of activity to the Panel, and the number
+	// of records that are held while waiting to be sent. Records that could not be sent, such
+	// as while the Panel is unreachable, are stored on the disk until they can be. Records are
+	// dropped once this limit is reached.
+	FlushInterval int `default:"10" yaml:"flush_interval"`
+	BufferSize    int `default:"5000" yaml:"buffer_size"`
+}
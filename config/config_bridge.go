@@ -0,0 +1,50 @@
+package config
+
+const (
+	EventBridgeNats  = "nats"
+	EventBridgeRedis = "redis"
+)
+
+// Defines an external message broker that server events are published to, allowing other
+// systems to consume the events for every server without connecting to the websocket for each.
+type EventBridgeConfiguration struct {
+	Enabled bool `default:"false" json:"enabled" yaml:"enabled"`
+
+	// The type of broker to publish events to, either "nats" or "redis".
+	Driver string `default:"nats" json:"driver" yaml:"driver"`
+
+	// The address of the broker, such as "nats.example.com:4222" or "redis.example.com:6379".
+	Address string `json:"address" yaml:"address"`
+
+	// Credentials used to authenticate with the broker. For Redis the username is optional and
+	// only used with Redis 6 ACLs.
+	Username string `json:"username" yaml:"username"`
+	Password string `json:"password" yaml:"password"`
+
+	// Determines if the connection to the broker should use TLS.
+	Tls bool `default:"false" json:"tls" yaml:"tls"`
+
+	// The prefix for the subject or channel that events are published to. Each event is
+	// published to "<prefix>.<node>.<server>.<event>" for NATS, and "<prefix>:<node>:<server>:<event>"
+	// for Redis, with any spaces in the event name replaced by underscores.
+	Prefix string `default:"claws" json:"prefix" yaml:"prefix"`
+
+	// The events that are published, such as "status" or "console output". When empty every
+	// server event is published.
+	Events []string `json:"events" yaml:"events"`
+}
+
+// Determines if the given event should be published to the broker.
+func (b EventBridgeConfiguration) ShouldPublish(event string) bool {
+	if len(b.Events) == 0 {
+		return true
+	}
+
+	for _, e := range b.Events {
+		if e == event {
+			return true
+		}
+	}
+
+	return false
+}
@@ -0,0 +1,19 @@
+package config
+
+// Defines the reports that are written when a server crashes. Each report contains the exit
+// state of the process along with the console output and resource usage leading up to the
+// crash, so that the user can see why their server crashed rather than only that it was
+// restarted.
+type CrashReportConfiguration struct {
+	Enabled bool `default:"true" yaml:"enabled"`
+
+	// The number of lines of console output to include in each report.
+	ConsoleLines int `default:"100" yaml:"console_lines"`
+
+	// The number of reports to keep on the disk for each server. Once this limit is reached the
+	// oldest reports are removed.
+	Retention int `default:"10" yaml:"retention"`
+
+	// If set to true each report is also sent to the Panel when it is written.
+	Upload bool `default:"false" yaml:"upload"`
+}
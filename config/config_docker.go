@@ -5,6 +5,25 @@ import (
 	"encoding/json"
 	"github.com/docker/docker/api/types"
 	"github.com/pkg/errors"
+	"strings"
+)
+
+const (
+	StatsModeDocker = "docker"
+	StatsModeCgroup = "cgroup"
+)
+
+const (
+	PullPolicyAlways       = "always"
+	PullPolicyIfNotPresent = "if-not-present"
+	PullPolicyNever        = "never"
+)
+
+const (
+	ReconcileAttach   = "attach"
+	ReconcileStop     = "stop"
+	ReconcileRecreate = "recreate"
+	ReconcileIgnore   = "ignore"
 )
 
 type dockerNetworkInterfaces struct {
@@ -37,6 +56,102 @@ type DockerNetworkConfiguration struct {
 	IsInternal bool                    `default:"false" yaml:"is_internal"`
 	EnableICC  bool                    `default:"true" yaml:"enable_icc"`
 	Interfaces dockerNetworkInterfaces `yaml:"interfaces"`
+
+	// Allows servers to run using the host network rather than the network above. This bypasses
+	// the port bindings for the server entirely, so a server could listen on any port on the host
+	// and should only be enabled for games that cannot function behind a bridge network.
+	AllowHostNetwork bool `default:"false" json:"allow_host_network" yaml:"allow_host_network"`
+
+	// Determines if IPv6 is enabled on the network created for containers. This is required for
+	// servers to be reachable on IPv6 allocations when using a bridge network.
+	EnableIPv6 bool `default:"true" json:"enable_ipv6" yaml:"enable_ipv6"`
+
+	// Additional user-defined networks that servers are allowed to join alongside the network
+	// above. This allows servers such as a game server and its database to communicate privately.
+	// Networks in this list that do not exist will be created when a server first joins them.
+	AllowedNetworks []string `json:"allowed_networks" yaml:"allowed_networks"`
+}
+
+// Defines the limits for sidecar containers run alongside servers.
+type DockerSidecarConfiguration struct {
+	// The maximum number of sidecars a single server may run. Set to 0 to disable sidecars.
+	Max int `default:"2" json:"max" yaml:"max"`
+
+	// The default memory limit in megabytes and CPU limit as a percentage for each sidecar
+	// when the server does not define one. The memory limit is also the maximum a sidecar
+	// may request.
+	Memory int64 `default:"256" json:"memory" yaml:"memory"`
+	Cpu    int64 `default:"50" json:"cpu" yaml:"cpu"`
+}
+
+// Defines a remote Docker daemon that servers may be assigned to. The server data directories
+// are bind mounted into containers using the same paths as on this machine, so they must be
+// available at those paths on the remote host as well, for example by using shared storage.
+type DockerEndpointConfiguration struct {
+	// The address of the Docker daemon, such as "tcp://10.0.0.2:2376".
+	Host string `json:"host" yaml:"host"`
+
+	// The paths to the TLS certificates used to connect to the daemon. If these are not set the
+	// connection will not use TLS, which should only be done over a trusted private network.
+	TLS struct {
+		CA   string `json:"ca" yaml:"ca"`
+		Cert string `json:"cert" yaml:"cert"`
+		Key  string `json:"key" yaml:"key"`
+	} `json:"tls" yaml:"tls"`
+}
+
+// Defines how Wings responds to server containers being changed outside of Wings, such as by
+// running "docker start" or "docker rm" directly on the node.
+type DockerReconcileConfiguration struct {
+	// Determines if Docker events for server containers are watched. Without this the state
+	// of a server is only corrected the next time a power action is sent to it.
+	Enabled bool `default:"true" json:"enabled" yaml:"enabled"`
+
+	// The action taken when a server container is started outside of Wings. Using "attach"
+	// marks the server as running and attaches to its console, while "stop" kills the container
+	// so that it matches the state in Wings.
+	OnStart string `default:"attach" json:"on_start" yaml:"on_start"`
+
+	// The action taken when the container for a server that is not running is removed outside
+	// of Wings. Using "recreate" creates the container again, while "ignore" leaves it to be
+	// created the next time the server starts.
+	OnRemove string `default:"recreate" json:"on_remove" yaml:"on_remove"`
+}
+
+// Defines the logging driver used for server containers. Only drivers that Docker is able to
+// read logs back from are supported since the daemon relies on them for console output.
+type DockerLogConfiguration struct {
+	// The logging driver to use, one of "json-file", "local" or "journald".
+	Type string `default:"json-file" json:"type" yaml:"type"`
+
+	// The options passed through to the logging driver. If no options are defined when using
+	// the "json-file" or "local" drivers the log is limited to a single 5MB file.
+	Config map[string]string `json:"config" yaml:"config"`
+}
+
+// Defines the security profiles applied to server containers when they are created.
+type DockerSecurityConfiguration struct {
+	// The path to a seccomp profile on the host to apply to all server containers by default. If
+	// this is empty the default profile built into Docker is used.
+	SeccompProfile string `json:"seccomp_profile" yaml:"seccomp_profile"`
+
+	// The name of an AppArmor profile loaded on the host to apply to all server containers by
+	// default. If this is empty the default Docker profile is used.
+	AppArmorProfile string `json:"apparmor_profile" yaml:"apparmor_profile"`
+
+	// The directory containing the seccomp profiles that individual servers may select. A server
+	// requesting the profile "example" will use the file "example.json" in this directory.
+	ProfileDirectory string `default:"/var/lib/panther/profiles" json:"profile_directory" yaml:"profile_directory"`
+
+	// Allows servers to request that their container runs without any seccomp or AppArmor
+	// profile applied by using the "unconfined" profile. This should only be enabled if there
+	// is a game that cannot function otherwise.
+	AllowUnconfined bool `default:"false" json:"allow_unconfined" yaml:"allow_unconfined"`
+
+	// The Linux capabilities that servers are allowed to have added to their containers, such
+	// as "NET_RAW" or "SYS_PTRACE". Any capability requested by a server that is not in this list
+	// will not be added.
+	AllowedCapabilities []string `json:"allowed_capabilities" yaml:"allowed_capabilities"`
 }
 
 // Defines the docker configuration used by the daemon when interacting with
@@ -49,6 +164,16 @@ type DockerConfiguration struct {
 	// Domainname is the Docker domainname for all containers.
 	Domainname string `default:"" json:"domainname" yaml:"domainname"`
 
+	// Determines when images for server containers are pulled before the container is created.
+	// Using "always" pulls the image every time a server starts, "if-not-present" only pulls it
+	// if it does not exist locally, and "never" requires the image to already exist. This can be
+	// overridden on a per-server basis by the Panel.
+	PullPolicy string `default:"always" json:"pull_policy" yaml:"pull_policy"`
+
+	// Additional Docker daemons that servers may be assigned to by the Panel, keyed by name.
+	// Servers that are not assigned to an endpoint use the local Docker daemon.
+	Endpoints map[string]DockerEndpointConfiguration `json:"endpoints" yaml:"endpoints"`
+
 	// Registries .
 	Registries map[string]RegistryConfiguration `json:"registries" yaml:"registries"`
 
@@ -56,12 +181,154 @@ type DockerConfiguration struct {
 	// utilizes host memory for this value, and that we do not keep track of the space used here
 	// so avoid allocating too much to a server.
 	TmpfsSize uint `default:"100" json:"tmpfs_size" yaml:"tmpfs_size"`
+
+	// The maximum combined size in megabytes of the additional tmpfs mounts that a server may
+	// request. Mounts that would push a server over this limit are not created. Set to 0 to
+	// disallow additional tmpfs mounts entirely.
+	TmpfsMaxSize uint `default:"1024" json:"tmpfs_max_size" yaml:"tmpfs_max_size"`
+
+	// The method used to collect resource usage statistics for running containers. Using "docker"
+	// will read them from the Docker stats API, while "cgroup" reads them directly from the cgroup v2
+	// filesystem which is significantly cheaper on nodes running many containers. If the cgroup
+	// filesystem is not available the Docker API will be used instead.
+	StatsMode string `default:"docker" json:"stats_mode" yaml:"stats_mode"`
+
+	// The number of seconds between each resource usage update emitted for a running server. This
+	// can be overridden on a per-server basis by the Panel. Raising this reduces the overhead of
+	// collecting stats on busy nodes, especially when using the "cgroup" stats mode.
+	StatsInterval int `default:"1" json:"stats_interval" yaml:"stats_interval"`
+
+	// The host devices that servers are allowed to have mapped into their containers. Entries
+	// may use glob patterns such as "/dev/dri/*". Any device requested by a server that does not
+	// match an entry in this list will not be mapped.
+	AllowedDevices []string `json:"allowed_devices" yaml:"allowed_devices"`
+
+	// The maximum size in megabytes of /dev/shm that a server may request. Much like tmpfs this
+	// is backed by host memory which is not tracked against the server. Requests larger than this
+	// are reduced to this size.
+	ShmMaxSize uint `default:"1024" json:"shm_max_size" yaml:"shm_max_size"`
+
+	// The lowest OOM score adjustment a server may use. Servers with a lower score are less
+	// likely to be killed when the host runs out of memory, so by default servers are not able
+	// to make themselves less likely to be killed than any other process on the system.
+	MinOomScoreAdj int `default:"0" json:"min_oom_score_adj" yaml:"min_oom_score_adj"`
+
+	// The block devices that the disk throughput limits for a server are applied to, such as
+	// "/dev/sda". This should include the device containing the server data directory. If no
+	// devices are defined the throughput limits for servers have no effect.
+	ThrottleDevices []string `json:"throttle_devices" yaml:"throttle_devices"`
+
+	// The sidecar containers that servers may run alongside their main container.
+	Sidecars DockerSidecarConfiguration `json:"sidecars" yaml:"sidecars"`
+
+	// Labels applied to every server container created by the daemon, allowing external tooling
+	// to discover and classify them. Servers may define their own labels which take priority
+	// over these.
+	Labels map[string]string `json:"labels" yaml:"labels"`
+
+	// Configures how server containers changed outside of Wings are brought back in sync.
+	Reconcile DockerReconcileConfiguration `json:"reconcile" yaml:"reconcile"`
+
+	// The logging driver configuration for server containers.
+	LogConfig DockerLogConfiguration `json:"log_config" yaml:"log_config"`
+
+	// The seccomp and AppArmor profiles applied to server containers.
+	Security DockerSecurityConfiguration `json:"security" yaml:"security"`
+
+	// The resource limits applied to the containers used to run server installation scripts.
+	// These can be overridden on a per-server basis by the Panel.
+	Installer InstallerLimits `default:"{\"memory\":1024,\"cpu\":100,\"pids\":512,\"timeout\":3600}" json:"installer" yaml:"installer"`
+}
+
+// Defines the resource limits for an installation container. A value of zero for any of
+// these fields means there is no limit applied.
+type InstallerLimits struct {
+	// The amount of memory in megabytes the installer container may use.
+	Memory int64 `json:"memory" yaml:"memory"`
+
+	// The percentage of CPU the installer container may use, where 100 is a single thread.
+	Cpu int64 `json:"cpu" yaml:"cpu"`
+
+	// The maximum number of processes that can exist in the installer container.
+	Pids int64 `json:"pids" yaml:"pids"`
+
+	// The number of seconds the installation process may run for before it is aborted
+	// and reported to the Panel as having failed.
+	Timeout int64 `json:"timeout" yaml:"timeout"`
+}
+
+// Merges a set of overrides on top of these limits and returns the result. Override values
+// of zero are ignored and fall back to the existing value, while negative values remove
+// the limit entirely.
+func (l InstallerLimits) Merge(o InstallerLimits) InstallerLimits {
+	merge := func(base int64, override int64) int64 {
+		if override < 0 {
+			return 0
+		} else if override > 0 {
+			return override
+		}
+
+		return base
+	}
+
+	return InstallerLimits{
+		Memory:  merge(l.Memory, o.Memory),
+		Cpu:     merge(l.Cpu, o.Cpu),
+		Pids:    merge(l.Pids, o.Pids),
+		Timeout: merge(l.Timeout, o.Timeout),
+	}
 }
 
 // RegistryConfiguration .
 type RegistryConfiguration struct {
-	Username string `yaml:"username"`
-	Password string `yaml:"password"`
+	Username string `json:"username" yaml:"username"`
+	Password string `json:"password" yaml:"password"`
+}
+
+// Registry credentials provided by the Panel for a single server. These are only used for
+// images from the registry they are defined for, so that they are never sent to any other
+// registry, such as the one hosting the installer or sidecar images.
+type RegistryOverride struct {
+	// The registry the credentials belong to, matched against images in the same way as the
+	// registries defined in the node configuration.
+	Registry string `json:"registry"`
+	Username string `json:"username"`
+	Password string `json:"password"`
+}
+
+// Determines if the image is hosted on the given registry. The registry may also include a
+// path within the registry, such as "ghcr.io/pterodactyl".
+func registryMatches(image string, registry string) bool {
+	registry = strings.TrimSuffix(registry, "/")
+	if registry == "" || !strings.HasPrefix(image, registry) {
+		return false
+	}
+
+	return len(image) == len(registry) || image[len(registry)] == '/' || image[len(registry)] == ':'
+}
+
+// Returns the registry credentials that should be used when pulling the given image. If
+// override credentials are provided for the registry of the image they are always used,
+// otherwise the registry from the configuration with the longest prefix matching the image
+// is used. Returns nil if no credentials should be used.
+func (c DockerConfiguration) RegistryAuthFor(image string, override *RegistryOverride) *RegistryConfiguration {
+	if override != nil && override.Username != "" && registryMatches(image, override.Registry) {
+		return &RegistryConfiguration{Username: override.Username, Password: override.Password}
+	}
+
+	var match string
+	var auth *RegistryConfiguration
+	for registry, rc := range c.Registries {
+		if !registryMatches(image, registry) || len(registry) <= len(match) {
+			continue
+		}
+
+		rc := rc
+		match = registry
+		auth = &rc
+	}
+
+	return auth
 }
 
 // Base64 .
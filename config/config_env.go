@@ -0,0 +1,226 @@
+package config
+
+import (
+	"fmt"
+	"github.com/apex/log"
+	"github.com/pkg/errors"
+	"gopkg.in/yaml.v2"
+	"os"
+	"reflect"
+	"strings"
+)
+
+// The prefix for environment variables that override values in the configuration file.
+const EnvironmentOverridePrefix = "CLAWS_"
+
+// Applies any configuration values set through environment variables. Variables are named
+// using the configuration key in uppercase, with nested keys separated by two underscores.
+// For example CLAWS_API__PORT sets the "port" key within "api", and CLAWS_DOCKER__LABELS__TEAM
+// sets the "team" label.
+//
+// Values are parsed as YAML, so lists and objects can be provided using the YAML flow syntax,
+// such as CLAWS_ALLOWED_ORIGINS="[https://a.example.com, https://b.example.com]".
+//
+// The values from the configuration file that were overridden are remembered so that they are
+// written back to the disk in place of the overridden values, which keeps values such as
+// CLAWS_TOKEN out of the configuration file.
+func (c *Configuration) applyEnvironmentOverrides() error {
+	c.overrides = nil
+
+	for _, e := range os.Environ() {
+		parts := strings.SplitN(e, "=", 2)
+		if len(parts) != 2 || !strings.HasPrefix(parts[0], EnvironmentOverridePrefix) {
+			continue
+		}
+
+		path := strings.Split(strings.ToLower(strings.TrimPrefix(parts[0], EnvironmentOverridePrefix)), "__")
+		original, existed := copyConfigurationValue(reflect.ValueOf(c).Elem(), path)
+
+		if err := setConfigurationKey(reflect.ValueOf(c).Elem(), path, parts[1]); err != nil {
+			if err == errUnknownConfigurationKey {
+				log.WithField("variable", parts[0]).Warn("ignoring environment variable for unknown configuration key")
+				continue
+			}
+
+			return errors.Wrap(err, fmt.Sprintf("config: invalid value for %s", parts[0]))
+		}
+
+		value, _ := copyConfigurationValue(reflect.ValueOf(c).Elem(), path)
+		c.overrides = append(c.overrides, environmentOverride{path: path, original: original, existed: existed, value: value})
+	}
+
+	return nil
+}
+
+// A configuration value that was set using an environment variable, along with the value from
+// the configuration file that it replaced.
+type environmentOverride struct {
+	path     []string
+	original reflect.Value
+	existed  bool
+	value    reflect.Value
+}
+
+// Replaces any values in cp that were set using an environment variable with the values from
+// the configuration file. Values that have since been changed, such as by the Panel updating
+// the configuration, are left as-is.
+func (c *Configuration) restoreOverriddenValues(cp *Configuration) error {
+	// Restore the most recent override first, so that the original file value is what remains
+	// when the same key was overridden more than once.
+	for i := len(c.overrides) - 1; i >= 0; i-- {
+		o := c.overrides[i]
+
+		current, ok := lookupConfigurationValue(reflect.ValueOf(cp).Elem(), o.path)
+		if !ok || !reflect.DeepEqual(current.Interface(), o.value.Interface()) {
+			continue
+		}
+
+		original := o.original
+		if !o.existed {
+			original = reflect.Value{}
+		}
+
+		if err := setConfigurationValue(reflect.ValueOf(cp).Elem(), o.path, original); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// Returns a copy of the value at the given key path within v that does not share any maps or
+// slices with it, and if the key exists.
+func copyConfigurationValue(v reflect.Value, path []string) (reflect.Value, bool) {
+	current, ok := lookupConfigurationValue(v, path)
+	if !ok {
+		return reflect.Value{}, false
+	}
+
+	n := reflect.New(current.Type())
+	if b, err := yaml.Marshal(current.Interface()); err != nil || yaml.Unmarshal(b, n.Interface()) != nil {
+		n.Elem().Set(current)
+	}
+
+	return n.Elem(), true
+}
+
+var errUnknownConfigurationKey = errors.New("config: unknown configuration key")
+
+// Sets the value at the given key path within v, which must be a struct or map. The value is
+// parsed as YAML unless the key is for a string.
+func setConfigurationKey(v reflect.Value, path []string, value string) error {
+	return assignConfigurationKey(v, path, func(v reflect.Value) error {
+		if v.Kind() == reflect.String {
+			v.SetString(value)
+			return nil
+		}
+
+		n := reflect.New(v.Type())
+		if err := yaml.Unmarshal([]byte(value), n.Interface()); err != nil {
+			return err
+		}
+		v.Set(n.Elem())
+
+		return nil
+	})
+}
+
+// Sets the value at the given key path within v to value. If value is not valid and the key
+// is within a map, the key is removed from the map instead.
+func setConfigurationValue(v reflect.Value, path []string, value reflect.Value) error {
+	if !value.IsValid() && len(path) > 0 {
+		parent, ok := lookupConfigurationValue(v, path[:len(path)-1])
+		if ok && parent.Kind() == reflect.Map {
+			if !parent.IsNil() {
+				parent.SetMapIndex(reflect.ValueOf(path[len(path)-1]).Convert(parent.Type().Key()), reflect.Value{})
+			}
+
+			return nil
+		}
+	}
+
+	return assignConfigurationKey(v, path, func(v reflect.Value) error {
+		if !value.IsValid() {
+			v.Set(reflect.Zero(v.Type()))
+		} else {
+			v.Set(value)
+		}
+
+		return nil
+	})
+}
+
+// Finds the value at the given key path within v, creating any pointers and maps along the way,
+// and calls assign with it.
+func assignConfigurationKey(v reflect.Value, path []string, assign func(v reflect.Value) error) error {
+	if v.Kind() == reflect.Ptr {
+		if v.IsNil() {
+			v.Set(reflect.New(v.Type().Elem()))
+		}
+		v = v.Elem()
+	}
+
+	if len(path) == 0 {
+		return assign(v)
+	}
+
+	switch v.Kind() {
+	case reflect.Struct:
+		f, ok := fieldForKey(v, path[0])
+		if !ok {
+			return errUnknownConfigurationKey
+		}
+
+		return assignConfigurationKey(f, path[1:], assign)
+	case reflect.Map:
+		if v.Type().Key().Kind() != reflect.String {
+			return errUnknownConfigurationKey
+		}
+
+		if v.IsNil() {
+			v.Set(reflect.MakeMap(v.Type()))
+		}
+
+		k := reflect.ValueOf(path[0]).Convert(v.Type().Key())
+		e := reflect.New(v.Type().Elem()).Elem()
+		if existing := v.MapIndex(k); existing.IsValid() {
+			e.Set(existing)
+		}
+
+		if err := assignConfigurationKey(e, path[1:], assign); err != nil {
+			return err
+		}
+		v.SetMapIndex(k, e)
+
+		return nil
+	}
+
+	return errUnknownConfigurationKey
+}
+
+// Returns the field of a struct for a configuration key, using the same naming rules as the
+// YAML parser.
+func fieldForKey(v reflect.Value, key string) (reflect.Value, bool) {
+	t := v.Type()
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		if f.PkgPath != "" {
+			continue
+		}
+
+		name := strings.Split(f.Tag.Get("yaml"), ",")[0]
+		if name == "-" {
+			continue
+		}
+
+		if name == "" {
+			name = strings.ToLower(f.Name)
+		}
+
+		if name == key {
+			return v.Field(i), true
+		}
+	}
+
+	return reflect.Value{}, false
+}
@@ -0,0 +1,31 @@
+package config
+
+// Defines the configuration for the FTPS server, which allows server files to be accessed
+// using clients that do not support SFTP. Connections must be upgraded to TLS using explicit
+// FTPS before logging in, plain FTP is never accepted.
+type FtpConfiguration struct {
+	// Determines if the FTPS server should be started.
+	Enabled bool `default:"false" yaml:"enabled"`
+
+	// The address and port that the FTPS server listens on.
+	Address string `default:"0.0.0.0" yaml:"bind_address"`
+	Port    int    `default:"2021" yaml:"bind_port"`
+
+	// The public IP address returned to clients for passive data connections. If this is not
+	// set the address the client connected to is used.
+	PublicAddress string `yaml:"public_address"`
+
+	// The range of ports used for passive data connections. These ports must be reachable by
+	// clients.
+	PassivePortStart int `default:"50000" yaml:"passive_port_start"`
+	PassivePortEnd   int `default:"50100" yaml:"passive_port_end"`
+
+	// The maximum number of control connections that can be open from a single IP address at
+	// once. Set to 0 to allow any number of connections.
+	MaxConnectionsPerIp int `default:"10" yaml:"max_connections_per_ip"`
+
+	// The certificate and key used for TLS connections. If these are not set the certificate
+	// configured for the API is used.
+	CertificateFile string `yaml:"cert"`
+	KeyFile         string `yaml:"key"`
+}
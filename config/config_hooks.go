@@ -0,0 +1,45 @@
+package config
+
+// Defines a command that is run at a point in the lifecycle of a server, allowing the
+// behavior of Wings to be extended without modifying it. The command receives the details
+// of the event as a JSON object on stdin, and in the CLAWS_HOOK_EVENT, CLAWS_NODE_UUID and
+// CLAWS_SERVER_UUID environment variables.
+type HookConfiguration struct {
+	// The lifecycle point the hook runs at, one of "pre-start", "post-stop", "pre-backup" or
+	// "file-uploaded". The "file-uploaded" hook runs for files uploaded over HTTP or FTPS, and
+	// for files written through the API.
+	Event string `json:"event" yaml:"event"`
+
+	// The command to run and the arguments to pass to it. The command is not run in a shell.
+	Command string   `json:"command" yaml:"command"`
+	Args    []string `json:"args" yaml:"args"`
+
+	// The number of seconds the command may run for before it is killed. Defaults to 30.
+	Timeout int `json:"timeout" yaml:"timeout"`
+
+	// The UUIDs of the servers the hook runs for. When empty the hook runs for every server.
+	Servers []string `json:"servers" yaml:"servers"`
+
+	// Determines if the action is aborted when the command fails or exits with a non-zero
+	// status. This only applies to the "pre-" hooks, which run before the action takes place.
+	AbortOnFailure bool `json:"abort_on_failure" yaml:"abort_on_failure"`
+}
+
+// Determines if the hook should run for the given event and server.
+func (h HookConfiguration) Matches(event string, server string) bool {
+	if h.Event != event {
+		return false
+	}
+
+	if len(h.Servers) == 0 {
+		return true
+	}
+
+	for _, s := range h.Servers {
+		if s == server {
+			return true
+		}
+	}
+
+	return false
+}
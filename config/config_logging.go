@@ -0,0 +1,29 @@
+package config
+
+// Defines additional destinations that log entries are sent to, alongside the console and
+// the log file in the log directory.
+type LogSinkConfiguration struct {
+	Syslog   SyslogConfiguration   `yaml:"syslog"`
+	Journald JournaldConfiguration `yaml:"journald"`
+}
+
+// Sends log entries to a syslog daemon. This is not supported on Windows.
+type SyslogConfiguration struct {
+	Enabled bool `default:"false" yaml:"enabled"`
+
+	// The network used to connect to the syslog daemon, either "udp", "tcp" or "unix". When
+	// no network or address is set the local syslog daemon is used.
+	Network string `yaml:"network"`
+
+	// The address of the syslog daemon, such as "logs.example.com:514".
+	Address string `yaml:"address"`
+
+	// The tag attached to each log entry to identify the program that wrote it.
+	Tag string `default:"claws" yaml:"tag"`
+}
+
+// Sends log entries to the systemd journal, with each log field stored as a journal field so
+// that entries can be filtered using journalctl. This is only supported on Linux.
+type JournaldConfiguration struct {
+	Enabled bool `default:"false" yaml:"enabled"`
+}
@@ -0,0 +1,24 @@
+package config
+
+// Defines the configuration used when running servers inside of LXD system containers using
+// the lxd environment.
+type LxdConfiguration struct {
+	// The path to the unix socket for the LXD daemon. Installations of LXD that were not made
+	// using the snap package will generally use /var/lib/lxd/unix.socket instead.
+	Socket string `default:"/var/snap/lxd/common/lxd/unix.socket" json:"socket" yaml:"socket"`
+
+	// The simplestreams image server and image alias used to create the container for each
+	// server. The image is only used when the container is first created, after which the
+	// container is kept between server restarts.
+	ImageServer string `default:"https://images.linuxcontainers.org" json:"image_server" yaml:"image_server"`
+	Image       string `default:"debian/12" json:"image" yaml:"image"`
+
+	// The LXD profile applied to server containers. This profile should provide the network
+	// device for the container.
+	Profile string `default:"default" json:"profile" yaml:"profile"`
+
+	// If set to true the server data directory is mounted into the container with its user
+	// IDs shifted, so that files created by the server are owned by the system user on the
+	// host. This requires a kernel with support for idmapped mounts.
+	ShiftMounts bool `default:"true" json:"shift_mounts" yaml:"shift_mounts"`
+}
@@ -0,0 +1,101 @@
+package config
+
+import (
+	"crypto/subtle"
+	"github.com/gbrlsnchs/jwt/v3"
+)
+
+// Defines an additional Panel that servers on this node can belong to. This allows a single
+// node to be shared between multiple Panels, with each Panel only able to access the servers
+// that it created.
+//
+// The Panel defined by the top level remote and token keys is always used for servers that do
+// not belong to one of these Panels, and is the only Panel able to change the configuration of
+// the node itself.
+type PanelConfiguration struct {
+	// A unique name for the Panel. This is used to track which Panel each server belongs to,
+	// so it should not be changed once servers have been created.
+	Name string `json:"name" yaml:"name"`
+
+	// The location where the Panel is running.
+	PanelLocation string `json:"remote" yaml:"remote"`
+
+	// The token identifier and token that this node uses to authenticate with the Panel, and
+	// that the Panel uses to authenticate with this node.
+	AuthenticationTokenId string `json:"token_id" yaml:"token_id"`
+	AuthenticationToken   string `json:"token" yaml:"token"`
+}
+
+// Returns the primary Panel defined by the top level configuration keys.
+func (c *Configuration) PrimaryPanel() PanelConfiguration {
+	return PanelConfiguration{
+		PanelLocation:         c.PanelLocation,
+		AuthenticationTokenId: c.AuthenticationTokenId,
+		AuthenticationToken:   c.AuthenticationToken,
+	}
+}
+
+// Returns all of the Panels that this node is connected to, starting with the primary Panel.
+func (c *Configuration) AllPanels() []PanelConfiguration {
+	return append([]PanelConfiguration{c.PrimaryPanel()}, c.Panels...)
+}
+
+// Returns the Panel with the given name. An empty name returns the primary Panel.
+func (c *Configuration) GetPanel(name string) (PanelConfiguration, bool) {
+	for _, p := range c.AllPanels() {
+		if p.Name == name {
+			return p, true
+		}
+	}
+
+	return PanelConfiguration{}, false
+}
+
+// Returns the Panel that uses the given authentication token.
+func (c *Configuration) GetPanelForToken(token string) (PanelConfiguration, bool) {
+	for _, p := range c.AllPanels() {
+		if p.AuthenticationToken != "" && subtle.ConstantTimeCompare([]byte(p.AuthenticationToken), []byte(token)) == 1 {
+			return p, true
+		}
+	}
+
+	return PanelConfiguration{}, false
+}
+
+// Determines if the given origin is the location of any of the Panels.
+func (c *Configuration) IsPanelLocation(origin string) bool {
+	for _, p := range c.AllPanels() {
+		if p.PanelLocation != "" && p.PanelLocation == origin {
+			return true
+		}
+	}
+
+	return false
+}
+
+// A JWT algorithm for verifying tokens signed by a Panel.
+type PanelJwtAlgorithm struct {
+	Panel     string
+	Algorithm *jwt.HMACSHA
+}
+
+var _panelJwtAlgos []PanelJwtAlgorithm
+
+// Returns the JWT algorithms for every Panel, starting with the primary Panel.
+func GetPanelJwtAlgorithms() []PanelJwtAlgorithm {
+	mu.RLock()
+	defer mu.RUnlock()
+
+	return _panelJwtAlgos
+}
+
+// Builds the JWT algorithms for the configured Panels. This must be called while holding the
+// configuration lock.
+func (c *Configuration) unsafeSetPanelJwtAlgorithms() {
+	algos := []PanelJwtAlgorithm{{Algorithm: _jwtAlgo}}
+	for _, p := range c.Panels {
+		algos = append(algos, PanelJwtAlgorithm{Panel: p.Name, Algorithm: jwt.NewHS256([]byte(p.AuthenticationToken))})
+	}
+
+	_panelJwtAlgos = algos
+}
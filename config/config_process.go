@@ -0,0 +1,20 @@
+package config
+
+const (
+	EnvironmentDocker  = "docker"
+	EnvironmentProcess = "process"
+	EnvironmentLxd     = "lxd"
+)
+
+// Defines the configuration used when running servers directly on the host using the
+// process environment rather than within Docker containers.
+type ProcessConfiguration struct {
+	// The cgroup v2 directory that a cgroup is created in for each running server in order to
+	// apply CPU and memory limits and collect resource usage. Wings must be able to create
+	// directories here and the cpu and memory controllers must be enabled for it. If the
+	// directory cannot be used servers will run without any resource limits.
+	CgroupRoot string `default:"/sys/fs/cgroup/claws" json:"cgroup_root" yaml:"cgroup_root"`
+
+	// The shell used to run the startup command for servers.
+	Shell string `default:"/bin/sh" json:"shell" yaml:"shell"`
+}
@@ -0,0 +1,29 @@
+package config
+
+const (
+	DiskQuotaXfs   = "xfs"
+	DiskQuotaBtrfs = "btrfs"
+)
+
+// Defines how the disk limits of servers are enforced by the filesystem that the server data
+// directories are stored on. Without this, disk limits are only enforced by Wings checking the
+// size of a server's files every so often, which allows a server to write past its limit
+// between checks.
+type DiskQuotaConfiguration struct {
+	Enabled bool `default:"false" yaml:"enabled"`
+
+	// The type of quota to use, either "xfs" or "btrfs".
+	//
+	// XFS project quotas require the data directory to be on an XFS filesystem mounted with the
+	// "prjquota" option, and work with existing servers.
+	//
+	// Btrfs quota groups require quotas to be enabled on the filesystem using "btrfs quota
+	// enable". Only servers created after this is enabled are given a quota, since the data
+	// directory of each server must be a subvolume.
+	Driver string `default:"xfs" yaml:"driver"`
+
+	// The first XFS project ID allocated to servers, and the number of IDs in the range. This
+	// range must not overlap with any other projects defined on the filesystem.
+	ProjectIdStart int `default:"100000" yaml:"project_id_start"`
+	ProjectIdCount int `default:"100000" yaml:"project_id_count"`
+}
@@ -0,0 +1,218 @@
+package config
+
+import (
+	"github.com/apex/log"
+	"github.com/pkg/errors"
+	"gopkg.in/yaml.v2"
+	"reflect"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// Configuration keys that are only read when Wings boots. Changes to these keys are not
+// applied when the configuration is reloaded, the running values are kept until Wings is
+// restarted.
+var restartOnlyKeys = []string{
+	"log_format",
+	"api.host",
+	"api.port",
+	"api.ssl",
+	"api.acme",
+	"api.socket",
+	"system.root_directory",
+	"system.log_directory",
+	"system.data",
+	"system.archive_directory",
+	"system.backup_directory",
+	"system.snapshot_directory",
+	"system.hibernation_directory",
+	"system.username",
+	"system.timezone",
+	"system.user",
+	"system.user_namespace",
+	"system.per_server_users",
+	"system.boot_concurrency",
+	"system.disk_check_concurrency",
+	"system.disk_quota",
+	"system.enable_log_rotate",
+	"system.log_sinks",
+	"system.log_shipping",
+	"system.activity",
+	"system.event_bridge",
+	"system.ftp",
+	"docker.network",
+	"docker.endpoints",
+	"environment",
+	"process",
+	"lxd",
+}
+
+// The result of reloading the configuration from the disk.
+type ReloadResult struct {
+	// The configuration keys that were changed and are now in effect.
+	Applied []string `json:"applied"`
+
+	// The configuration keys that were changed but will not take effect until Wings is
+	// restarted.
+	RequiresRestart []string `json:"requires_restart"`
+}
+
+var reloadMu sync.Mutex
+
+// Re-reads the configuration file from the disk and applies any changes to the running
+// configuration. Changes to keys that can only be applied when Wings boots are reported in
+// the result but otherwise ignored until the next restart.
+func Reload() (*ReloadResult, error) {
+	reloadMu.Lock()
+	defer reloadMu.Unlock()
+
+	current := Get()
+
+	c, err := ReadConfiguration(current.GetPath())
+	if err != nil {
+		return nil, errors.Wrap(err, "config: failed to read configuration for reload")
+	}
+
+	if _debugViaFlag {
+		c.Debug = true
+	}
+
+	changed, err := changedKeys(current, c)
+	if err != nil {
+		return nil, err
+	}
+
+	res := &ReloadResult{Applied: []string{}, RequiresRestart: []string{}}
+	for _, k := range changed {
+		if isRestartOnlyKey(k) {
+			res.RequiresRestart = append(res.RequiresRestart, k)
+		} else {
+			res.Applied = append(res.Applied, k)
+		}
+	}
+
+	c.preserveRestartOnly(current)
+	Set(c)
+
+	if c.Debug != current.Debug {
+		if c.Debug {
+			log.SetLevel(log.DebugLevel)
+		} else {
+			log.SetLevel(log.InfoLevel)
+		}
+	}
+
+	log.WithField("applied", res.Applied).WithField("requires_restart", res.RequiresRestart).Info("reloaded configuration from disk")
+
+	return res, nil
+}
+
+func isRestartOnlyKey(k string) bool {
+	for _, r := range restartOnlyKeys {
+		if k == r || strings.HasPrefix(k, r+".") {
+			return true
+		}
+	}
+
+	return false
+}
+
+// Copies the values for keys that can only be changed by restarting Wings from the running
+// configuration.
+func (c *Configuration) preserveRestartOnly(old *Configuration) {
+	c.LogFormat = old.LogFormat
+
+	c.Api.Host = old.Api.Host
+	c.Api.Port = old.Api.Port
+	c.Api.Ssl = old.Api.Ssl
+	c.Api.Acme = old.Api.Acme
+	c.Api.Socket = old.Api.Socket
+
+	c.System.RootDirectory = old.System.RootDirectory
+	c.System.LogDirectory = old.System.LogDirectory
+	c.System.Data = old.System.Data
+	c.System.ArchiveDirectory = old.System.ArchiveDirectory
+	c.System.BackupDirectory = old.System.BackupDirectory
+	c.System.SnapshotDirectory = old.System.SnapshotDirectory
+	c.System.HibernationDirectory = old.System.HibernationDirectory
+	c.System.Username = old.System.Username
+	c.System.Timezone = old.System.Timezone
+	c.System.User = old.System.User
+	c.System.UserNamespace = old.System.UserNamespace
+	c.System.PerServerUsers = old.System.PerServerUsers
+	c.System.BootConcurrency = old.System.BootConcurrency
+	c.System.DiskCheckConcurrency = old.System.DiskCheckConcurrency
+	c.System.DiskQuota = old.System.DiskQuota
+	c.System.EnableLogRotate = old.System.EnableLogRotate
+	c.System.LogSinks = old.System.LogSinks
+	c.System.LogShipping = old.System.LogShipping
+	c.System.Activity = old.System.Activity
+	c.System.EventBridge = old.System.EventBridge
+	c.System.Ftp = old.System.Ftp
+
+	c.Docker.Network = old.Docker.Network
+	c.Docker.Endpoints = old.Docker.Endpoints
+
+	c.Environment = old.Environment
+	c.Process = old.Process
+	c.Lxd = old.Lxd
+}
+
+// Returns the configuration keys, up to two levels deep, that have different values between
+// the two configurations.
+func changedKeys(a *Configuration, b *Configuration) ([]string, error) {
+	fa, err := flattenKeys(a)
+	if err != nil {
+		return nil, err
+	}
+
+	fb, err := flattenKeys(b)
+	if err != nil {
+		return nil, err
+	}
+
+	var out []string
+	for k, v := range fb {
+		if !reflect.DeepEqual(fa[k], v) {
+			out = append(out, k)
+		}
+	}
+
+	for k := range fa {
+		if _, ok := fb[k]; !ok {
+			out = append(out, k)
+		}
+	}
+
+	sort.Strings(out)
+
+	return out, nil
+}
+
+func flattenKeys(c *Configuration) (map[string]interface{}, error) {
+	b, err := yaml.Marshal(c)
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+
+	var m yaml.MapSlice
+	if err := yaml.Unmarshal(b, &m); err != nil {
+		return nil, errors.WithStack(err)
+	}
+
+	out := make(map[string]interface{})
+	for _, i := range m {
+		sub, ok := i.Value.(yaml.MapSlice)
+		if !ok {
+			out[i.Key.(string)] = i.Value
+			continue
+		}
+
+		for _, j := range sub {
+			out[i.Key.(string)+"."+j.Key.(string)] = j.Value
+		}
+	}
+
+	return out, nil
+}
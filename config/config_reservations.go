@@ -0,0 +1,17 @@
+package config
+
+// Defines the resources that must remain available on the node for a server to be started.
+// Starting a server while the node is already short on resources can cause the kernel to kill
+// processes for every server on the node, so starts are refused until the resources are
+// available again. Any value set to 0 is not checked.
+type ReservationConfiguration struct {
+	// The minimum amount of memory, in megabytes, that must be available on the node.
+	Memory int64 `default:"0" json:"memory" yaml:"memory"`
+
+	// The minimum amount of disk space, in megabytes, that must be free on the disk that
+	// server data is stored on.
+	Disk int64 `default:"0" json:"disk" yaml:"disk"`
+
+	// The maximum one minute load average of the node.
+	MaxLoad float64 `default:"0" json:"max_load" yaml:"max_load"`
+}
@@ -0,0 +1,411 @@
+package config
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"github.com/buger/jsonparser"
+	"github.com/pkg/errors"
+	"gopkg.in/yaml.v2"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"reflect"
+	"regexp"
+	"strings"
+	"time"
+)
+
+// Matches a configuration value that references a secret stored outside of the configuration
+// file, such as "${file:/etc/claws/token}" or "${vault:secret/data/claws#token}".
+var secretReferenceRegex = regexp.MustCompile(`^\$\{(file|vault|aws):([^}]+)}$`)
+
+// A configuration value that was loaded from a secret reference.
+type secretReference struct {
+	path      []string
+	reference string
+	value     string
+}
+
+// Expands environment variables within the raw configuration file while leaving any secret
+// references in place so that they can be resolved once the file has been parsed.
+func expandConfigurationVariables(s string) string {
+	return os.Expand(s, func(name string) string {
+		if secretReferenceRegex.MatchString("${" + name + "}") {
+			return "${" + name + "}"
+		}
+
+		return os.Getenv(name)
+	})
+}
+
+// Replaces any configuration values that reference a secret with the value of that secret.
+// The following references are supported:
+//
+//  ${file:/path/to/file}             the contents of a file, without a trailing newline
+//  ${vault:secret/data/claws#token}  a key from a secret stored in HashiCorp Vault
+//  ${aws:claws/node#token}           a secret, or a key in a JSON secret, from AWS Secrets Manager
+//
+// The Vault address and token are read from the VAULT_ADDR and VAULT_TOKEN environment variables,
+// and AWS credentials are read from the standard AWS_* environment variables.
+//
+// The references are remembered so that they are written back to the configuration file in
+// place of the secret values.
+func (c *Configuration) resolveSecrets() error {
+	c.secrets = nil
+
+	return c.resolveSecretsIn(reflect.ValueOf(c).Elem(), nil)
+}
+
+func (c *Configuration) resolveSecretsIn(v reflect.Value, path []string) error {
+	switch v.Kind() {
+	case reflect.String:
+		m := secretReferenceRegex.FindStringSubmatch(v.String())
+		if m == nil {
+			return nil
+		}
+
+		value, err := resolveSecret(m[1], m[2])
+		if err != nil {
+			return errors.Wrap(err, fmt.Sprintf("config: failed to resolve secret for %s", strings.Join(path, ".")))
+		}
+
+		c.secrets = append(c.secrets, secretReference{
+			path:      append([]string{}, path...),
+			reference: v.String(),
+			value:     value,
+		})
+		v.SetString(value)
+	case reflect.Ptr:
+		if !v.IsNil() {
+			return c.resolveSecretsIn(v.Elem(), path)
+		}
+	case reflect.Struct:
+		for i := 0; i < v.NumField(); i++ {
+			f := v.Type().Field(i)
+			if f.PkgPath != "" {
+				continue
+			}
+
+			name := strings.Split(f.Tag.Get("yaml"), ",")[0]
+			if name == "-" {
+				continue
+			}
+
+			if name == "" {
+				name = strings.ToLower(f.Name)
+			}
+
+			if err := c.resolveSecretsIn(v.Field(i), append(path, name)); err != nil {
+				return err
+			}
+		}
+	case reflect.Map:
+		if v.Type().Key().Kind() != reflect.String {
+			return nil
+		}
+
+		for _, k := range v.MapKeys() {
+			// Map values are not addressable, so resolve the secrets on a copy of the value
+			// and then store that copy back into the map.
+			e := reflect.New(v.Type().Elem()).Elem()
+			e.Set(v.MapIndex(k))
+
+			if err := c.resolveSecretsIn(e, append(path, k.String())); err != nil {
+				return err
+			}
+
+			v.SetMapIndex(k, e)
+		}
+	case reflect.Slice:
+		for i := 0; i < v.Len(); i++ {
+			if err := c.resolveSecretsIn(v.Index(i), append(path, fmt.Sprint(i))); err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
+
+// Returns the YAML for the configuration with any values that were loaded from a secret replaced
+// with the reference to that secret. Values that have since been changed, such as by the Panel
+// updating the configuration, are written as-is.
+func (c *Configuration) marshalWithSecretReferences(v interface{}) ([]byte, error) {
+	b, err := yaml.Marshal(v)
+	if err != nil || (len(c.secrets) == 0 && len(c.overrides) == 0) {
+		return b, errors.WithStack(err)
+	}
+
+	// Work against a separate copy of the configuration so that maps shared with the running
+	// configuration are not modified.
+	cp := new(Configuration)
+	if err := yaml.Unmarshal(b, cp); err != nil {
+		return nil, errors.WithStack(err)
+	}
+
+	for _, s := range c.secrets {
+		if current, ok := lookupConfigurationKey(reflect.ValueOf(cp).Elem(), s.path); !ok || current != s.value {
+			continue
+		}
+
+		if err := setConfigurationKey(reflect.ValueOf(cp).Elem(), s.path, s.reference); err != nil {
+			return nil, err
+		}
+	}
+
+	if err := c.restoreOverriddenValues(cp); err != nil {
+		return nil, err
+	}
+
+	b, err = yaml.Marshal(cp)
+
+	return b, errors.WithStack(err)
+}
+
+// Returns the string value at the given key path within v.
+func lookupConfigurationKey(v reflect.Value, path []string) (string, bool) {
+	v, ok := lookupConfigurationValue(v, path)
+	if !ok || v.Kind() != reflect.String {
+		return "", false
+	}
+
+	return v.String(), true
+}
+
+// Returns the value at the given key path within v.
+func lookupConfigurationValue(v reflect.Value, path []string) (reflect.Value, bool) {
+	for _, k := range path {
+		if v.Kind() == reflect.Ptr {
+			if v.IsNil() {
+				return reflect.Value{}, false
+			}
+			v = v.Elem()
+		}
+
+		switch v.Kind() {
+		case reflect.Struct:
+			f, ok := fieldForKey(v, k)
+			if !ok {
+				return reflect.Value{}, false
+			}
+			v = f
+		case reflect.Map:
+			if v.Type().Key().Kind() != reflect.String {
+				return reflect.Value{}, false
+			}
+			v = v.MapIndex(reflect.ValueOf(k).Convert(v.Type().Key()))
+			if !v.IsValid() {
+				return reflect.Value{}, false
+			}
+		default:
+			return reflect.Value{}, false
+		}
+	}
+
+	if v.Kind() == reflect.Ptr {
+		if v.IsNil() {
+			return reflect.Value{}, false
+		}
+		v = v.Elem()
+	}
+
+	return v, v.IsValid()
+}
+
+// Returns the value of a secret from the given provider.
+func resolveSecret(provider string, ref string) (string, error) {
+	switch provider {
+	case "file":
+		b, err := ioutil.ReadFile(ref)
+		if err != nil {
+			return "", errors.WithStack(err)
+		}
+
+		return strings.TrimRight(string(b), "\r\n"), nil
+	case "vault":
+		return resolveVaultSecret(ref)
+	case "aws":
+		return resolveAwsSecret(ref)
+	}
+
+	return "", errors.New(fmt.Sprintf("config: unknown secret provider \"%s\"", provider))
+}
+
+var secretsClient = &http.Client{Timeout: time.Second * 15}
+
+// Splits a secret reference into the secret and the key within that secret.
+func splitSecretReference(ref string, key string) (string, string) {
+	if i := strings.LastIndex(ref, "#"); i != -1 {
+		return ref[:i], ref[i+1:]
+	}
+
+	return ref, key
+}
+
+// Reads a key from a secret stored in HashiCorp Vault. Both version 1 and version 2 of the key
+// value secrets engine are supported. If no key is given "value" is used.
+func resolveVaultSecret(ref string) (string, error) {
+	addr := os.Getenv("VAULT_ADDR")
+	if addr == "" {
+		return "", errors.New("config: VAULT_ADDR must be set to load secrets from vault")
+	}
+
+	p, key := splitSecretReference(ref, "value")
+
+	req, err := http.NewRequest(http.MethodGet, strings.TrimRight(addr, "/")+"/v1/"+strings.TrimLeft(p, "/"), nil)
+	if err != nil {
+		return "", errors.WithStack(err)
+	}
+
+	req.Header.Set("X-Vault-Token", os.Getenv("VAULT_TOKEN"))
+	if ns := os.Getenv("VAULT_NAMESPACE"); ns != "" {
+		req.Header.Set("X-Vault-Namespace", ns)
+	}
+
+	b, err := doSecretsRequest(req)
+	if err != nil {
+		return "", err
+	}
+
+	// Version 2 of the secrets engine nests the secret within an additional data key.
+	if v, err := jsonparser.GetString(b, "data", "data", key); err == nil {
+		return v, nil
+	}
+
+	v, err := jsonparser.GetString(b, "data", key)
+	if err != nil {
+		return "", errors.New(fmt.Sprintf("config: vault secret \"%s\" does not contain key \"%s\"", p, key))
+	}
+
+	return v, nil
+}
+
+// Reads a secret from AWS Secrets Manager. If a key is given the secret is parsed as JSON and
+// the value of that key is returned, otherwise the entire secret string is returned.
+func resolveAwsSecret(ref string) (string, error) {
+	id, key := splitSecretReference(ref, "")
+
+	region := os.Getenv("AWS_REGION")
+	if region == "" {
+		region = os.Getenv("AWS_DEFAULT_REGION")
+	}
+
+	// The region can always be determined from an ARN.
+	if parts := strings.Split(id, ":"); len(parts) > 3 && parts[0] == "arn" {
+		region = parts[3]
+	}
+
+	if region == "" {
+		return "", errors.New("config: AWS_REGION must be set to load secrets from aws")
+	}
+
+	body, _ := json.Marshal(map[string]string{"SecretId": id})
+
+	req, err := http.NewRequest(http.MethodPost, fmt.Sprintf("https://secretsmanager.%s.amazonaws.com/", region), strings.NewReader(string(body)))
+	if err != nil {
+		return "", errors.WithStack(err)
+	}
+
+	req.Header.Set("Content-Type", "application/x-amz-json-1.1")
+	req.Header.Set("X-Amz-Target", "secretsmanager.GetSecretValue")
+
+	if err := signAwsRequest(req, body, region, "secretsmanager"); err != nil {
+		return "", err
+	}
+
+	b, err := doSecretsRequest(req)
+	if err != nil {
+		return "", err
+	}
+
+	v, err := jsonparser.GetString(b, "SecretString")
+	if err != nil {
+		return "", errors.New(fmt.Sprintf("config: aws secret \"%s\" does not contain a secret string", id))
+	}
+
+	if key == "" {
+		return v, nil
+	}
+
+	kv, err := jsonparser.GetString([]byte(v), key)
+	if err != nil {
+		return "", errors.New(fmt.Sprintf("config: aws secret \"%s\" does not contain key \"%s\"", id, key))
+	}
+
+	return kv, nil
+}
+
+func doSecretsRequest(req *http.Request) ([]byte, error) {
+	res, err := secretsClient.Do(req)
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+	defer res.Body.Close()
+
+	b, err := ioutil.ReadAll(res.Body)
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+
+	if res.StatusCode < 200 || res.StatusCode >= 300 {
+		return nil, errors.New(fmt.Sprintf("config: secret request to %s failed with status %d", req.URL.Host, res.StatusCode))
+	}
+
+	return b, nil
+}
+
+// Signs a request using AWS Signature Version 4 with the credentials from the environment.
+func signAwsRequest(req *http.Request, body []byte, region string, service string) error {
+	accessKey, secretKey := os.Getenv("AWS_ACCESS_KEY_ID"), os.Getenv("AWS_SECRET_ACCESS_KEY")
+	if accessKey == "" || secretKey == "" {
+		return errors.New("config: AWS_ACCESS_KEY_ID and AWS_SECRET_ACCESS_KEY must be set to load secrets from aws")
+	}
+
+	now := time.Now().UTC()
+	date := now.Format("20060102")
+
+	req.Header.Set("Host", req.URL.Host)
+	req.Header.Set("X-Amz-Date", now.Format("20060102T150405Z"))
+	if token := os.Getenv("AWS_SESSION_TOKEN"); token != "" {
+		req.Header.Set("X-Amz-Security-Token", token)
+	}
+
+	var names []string
+	var canonicalHeaders string
+	for _, h := range []string{"content-type", "host", "x-amz-date", "x-amz-security-token", "x-amz-target"} {
+		if v := req.Header.Get(h); v != "" {
+			names = append(names, h)
+			canonicalHeaders += h + ":" + strings.TrimSpace(v) + "\n"
+		}
+	}
+	signedHeaders := strings.Join(names, ";")
+
+	hash := sha256.Sum256(body)
+	canonical := strings.Join([]string{req.Method, "/", "", canonicalHeaders, signedHeaders, hex.EncodeToString(hash[:])}, "\n")
+
+	scope := strings.Join([]string{date, region, service, "aws4_request"}, "/")
+	chash := sha256.Sum256([]byte(canonical))
+	toSign := strings.Join([]string{"AWS4-HMAC-SHA256", now.Format("20060102T150405Z"), scope, hex.EncodeToString(chash[:])}, "\n")
+
+	key := []byte("AWS4" + secretKey)
+	for _, s := range []string{date, region, service, "aws4_request"} {
+		key = hmacSha256(key, s)
+	}
+
+	req.Header.Set("Authorization", fmt.Sprintf(
+		"AWS4-HMAC-SHA256 Credential=%s/%s, SignedHeaders=%s, Signature=%s",
+		accessKey, scope, signedHeaders, hex.EncodeToString(hmacSha256(key, toSign)),
+	))
+
+	return nil
+}
+
+func hmacSha256(key []byte, data string) []byte {
+	h := hmac.New(sha256.New, key)
+	h.Write([]byte(data))
+
+	return h.Sum(nil)
+}
@@ -0,0 +1,60 @@
+package config
+
+const (
+	LogShippingLoki          = "loki"
+	LogShippingElasticsearch = "elasticsearch"
+)
+
+// Defines how the console output and daemon events for servers are forwarded to an external
+// log store, allowing the logs to be kept for longer than the container log buffer.
+type LogShippingConfiguration struct {
+	Enabled bool `default:"false" json:"enabled" yaml:"enabled"`
+
+	// The type of log store to send logs to, either "loki" or "elasticsearch".
+	Driver string `default:"loki" json:"driver" yaml:"driver"`
+
+	// The base URL of the log store, such as "http://loki.example.com:3100". Logs are sent
+	// to the push API for Loki, and the bulk API for Elasticsearch.
+	Url string `json:"url" yaml:"url"`
+
+	// Credentials used to authenticate with the log store. A token is sent as a bearer token,
+	// otherwise the username and password are used for basic authentication if set.
+	Username string `json:"username" yaml:"username"`
+	Password string `json:"password" yaml:"password"`
+	Token    string `json:"token" yaml:"token"`
+
+	// The Elasticsearch index that logs are written to.
+	Index string `default:"claws-logs" json:"index" yaml:"index"`
+
+	// The UUIDs of the servers to ship logs for. When empty the logs for every server on
+	// the node are shipped.
+	Servers []string `json:"servers" yaml:"servers"`
+
+	// Additional labels attached to every log entry, such as the region of the node.
+	Labels map[string]string `json:"labels" yaml:"labels"`
+
+	// The number of seconds between each batch of logs being sent, and the maximum number of
+	// lines that are held in memory while waiting to be sent. Lines are dropped once this limit
+	// is reached, for example while the log store is unreachable.
+	FlushInterval int `default:"5" json:"flush_interval" yaml:"flush_interval"`
+	BufferSize    int `default:"10000" json:"buffer_size" yaml:"buffer_size"`
+}
+
+// Determines if logs should be shipped for the given server.
+func (l LogShippingConfiguration) ShouldShip(uuid string) bool {
+	if !l.Enabled {
+		return false
+	}
+
+	if len(l.Servers) == 0 {
+		return true
+	}
+
+	for _, s := range l.Servers {
+		if s == uuid {
+			return true
+		}
+	}
+
+	return false
+}
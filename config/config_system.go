@@ -12,6 +12,7 @@ import (
 	"path"
 	"path/filepath"
 	"regexp"
+	"strconv"
 	"time"
 )
 
@@ -32,6 +33,33 @@ type SystemConfiguration struct {
 	// Directory where local backups will be stored on the machine.
 	BackupDirectory string `default:"/var/lib/panther/backups" yaml:"backup_directory"`
 
+	// Directory where local server snapshots will be stored. For snapshots to be instant and
+	// space efficient this should live on the same reflink capable filesystem as the server
+	// data directory.
+	SnapshotDirectory string `default:"/var/lib/panther/snapshots" yaml:"snapshot_directory"`
+
+	// Directory where the compressed files of hibernated servers are stored when they are kept
+	// on this machine, and where they are written to before being uploaded to S3.
+	HibernationDirectory string `default:"/var/lib/panther/hibernation" yaml:"hibernation_directory"`
+
+	// The number of installation logs to keep on the disk for each server. Every installation
+	// attempt writes its own log file, and once this limit is reached the oldest logs are removed.
+	// Set to 0 to keep every log.
+	InstallLogRetention int `default:"10" yaml:"install_log_retention"`
+
+	// The number of one minute samples of resource usage to keep for each server, the default
+	// being 24 hours worth. Set to 0 to disable resource usage history tracking.
+	ResourceHistoryRetention int `default:"1440" yaml:"resource_history_retention"`
+
+	// The number of status, installation, backup and daemon events to keep on the disk for each
+	// server, allowing the Panel to fetch any events it missed while disconnected. Set to 0 to
+	// disable event persistence.
+	EventRetention int `default:"500" yaml:"event_retention"`
+
+	// Configures the reports that are written when a server crashes, which contain the console
+	// output and resource usage leading up to the crash.
+	CrashReports CrashReportConfiguration `yaml:"crash_reports"`
+
 	// The user that should own all of the server files, and be used for containers.
 	Username string `default:"panther" yaml:"username"`
 
@@ -49,17 +77,91 @@ type SystemConfiguration struct {
 		Gid int
 	}
 
+	// Describes how user IDs inside of containers map to user IDs on the host when Docker is
+	// running in rootless mode or with user namespace remapping enabled.
+	UserNamespace UserNamespaceConfiguration `yaml:"user_namespace"`
+
+	// Gives each server its own user and group ID, rather than running every server as the
+	// user above, so that a compromised server is unable to access the files of any other.
+	PerServerUsers PerServerUserConfiguration `yaml:"per_server_users"`
+
 	// The amount of time in seconds that can elapse before a server's disk space calculation is
 	// considered stale and a re-check should occur. DANGER: setting this value too low can seriously
 	// impact system performance and cause massive I/O bottlenecks and high CPU usage for the Wings
 	// process.
 	DiskCheckInterval int64 `default:"150" yaml:"disk_check_interval"`
 
+	// The number of servers that can have their disk space calculated at the same time. The
+	// last calculated disk space for each server is stored on the disk, so that restarting
+	// Wings does not cause every server to be checked at once, but servers whose stored value
+	// is stale are still checked when Wings boots. Lowering this spreads those checks out over
+	// a longer period of time on nodes with slow disks.
+	DiskCheckConcurrency int `default:"2" yaml:"disk_check_concurrency"`
+
+	// Calculates the disk space used by a server using the blocks allocated to each file on
+	// the disk rather than the size of each file, and counts files that are hard linked to one
+	// another only once. This is more accurate for servers with sparse files, such as world
+	// files, or hard linked copies of files, which would otherwise count for far more space
+	// than they actually use.
+	DiskCheckBlockUsage bool `default:"false" yaml:"disk_check_block_usage"`
+
+	// Enforces the disk limits of servers using quotas on the filesystem, so that a server
+	// cannot write more data than it is allowed to at all.
+	DiskQuota DiskQuotaConfiguration `yaml:"disk_quota"`
+
+	// Limits that are applied when extracting archives uploaded to a server, which prevent an
+	// archive that expands to a huge number of files, or a huge amount of data, from filling
+	// the disk of the node.
+	Extraction ExtractionConfiguration `yaml:"extraction"`
+
+	// Limits that are applied when a file is downloaded from a URL directly into a server
+	// directory, rather than being uploaded through the Panel.
+	FilePull FilePullConfiguration `yaml:"file_pull"`
+
+	// The number of servers that will be configured and restored to their previous state at
+	// the same time when Wings boots. Nodes with lots of small servers on fast disks can benefit
+	// from raising this, while HDD backed nodes may want to lower it.
+	BootConcurrency int `default:"4" yaml:"boot_concurrency"`
+
+	// The maximum number of seconds that a server waits for the servers it depends on to be
+	// running before it is started anyway when Wings boots.
+	BootDependencyTimeout int `default:"300" yaml:"boot_dependency_timeout"`
+
+	// The amount of time in seconds that a power action request received through the API will
+	// wait to acquire the power lock for a server before giving up.
+	PowerActionTimeout int `default:"30" yaml:"power_action_timeout"`
+
+	// The multiple of the expected duration of a power action after which it is considered to
+	// be stuck. Stuck actions have the server process killed and are removed from the power
+	// queue so that the server can be used again without restarting Wings. Stop and restart
+	// actions are expected to take up to 10 minutes, and start actions up to 5 minutes. Set
+	// this to 0 to disable the watchdog.
+	PowerWatchdogMultiplier int `default:"2" yaml:"power_watchdog_multiplier"`
+
 	// Determines if Wings should detect a server that stops with a normal exit code of
 	// "0" as being crashed if the process stopped without any Wings interaction. E.g.
 	// the user did not press the stop button, but the process stopped cleanly.
 	DetectCleanExitAsCrash bool `default:"true" yaml:"detect_clean_exit_as_crash"`
 
+	// If set to true, the console output of a server that stops without any Wings interaction
+	// is checked for common causes of Minecraft server crashes, such as the EULA not being
+	// accepted or the port already being in use. A recognized cause is sent as a "crash reason"
+	// event with a hint for the user, and included in the crash report.
+	AnalyzeCrashes bool `default:"false" yaml:"analyze_crashes"`
+
+	// Determines how ANSI escape sequences in console output are handled when the output is
+	// sent over the websocket or returned by the logs endpoint. This should be "keep" to send
+	// them as they are, "strip" to remove them, or "html" to convert the colors and styles to
+	// HTML. Servers can override this in the Panel, and each websocket connection can override
+	// it using the "ansi" query parameter.
+	ConsoleAnsi string `default:"keep" yaml:"console_ansi"`
+
+	// Determines what happens to the process of a server when it is suspended. This should be
+	// "stop" to stop the process, or "pause" to freeze it in place so that the suspension can be
+	// lifted without restarting the server and losing its in-memory state. Environments that
+	// cannot pause a process fall back to stopping it.
+	SuspensionMode string `default:"stop" yaml:"suspension_mode"`
+
 	// If set to true, file permissions for a server will be checked when the process is
 	// booted. This can cause boot delays if the server has a large amount of files. In most
 	// cases disabling this should not have any major impact unless external processes are
@@ -69,6 +171,136 @@ type SystemConfiguration struct {
 	// If set to false Wings will not attempt to write a log rotate configuration to the disk
 	// when it boots and one is not detected.
 	EnableLogRotate bool `default:"true" yaml:"enable_log_rotate"`
+
+	// Additional destinations for the Wings logs, for hosts that collect logs centrally
+	// rather than by reading the log file.
+	LogSinks LogSinkConfiguration `yaml:"log_sinks"`
+
+	// Configures forwarding the console output and events for servers to an external log store.
+	LogShipping LogShippingConfiguration `yaml:"log_shipping"`
+
+	// Configures reporting the activity on servers to the Panel.
+	Activity ActivityConfiguration `yaml:"activity"`
+
+	// Configures publishing server events to an external NATS or Redis broker.
+	EventBridge EventBridgeConfiguration `yaml:"event_bridge"`
+
+	// Commands that are run at points in the lifecycle of servers, such as before a server
+	// starts or after a file is uploaded.
+	//
+	// These are run as the user Wings runs as, so they can only be configured in the config
+	// file, and not through the API.
+	Hooks []HookConfiguration `json:"-" yaml:"hooks"`
+
+	// The resources that must be available on the node for a server to be started.
+	Reservations ReservationConfiguration `yaml:"reservations"`
+
+	// Configures the optional FTPS server for accessing server files.
+	Ftp FtpConfiguration `yaml:"ftp"`
+
+	// Configures checking for and installing new releases of Wings. This controls which
+	// binaries Wings will install and run, so it can only be configured in the config file.
+	Updates UpdateConfiguration `json:"-" yaml:"updates"`
+}
+
+// Defines the user namespace configuration for the Docker daemon.
+type UserNamespaceConfiguration struct {
+	// Set to true when the Docker daemon is running in rootless mode. Containers are run as the
+	// root user within their namespace, which maps to the user running the daemon on the host,
+	// and files are owned by the user Wings is running as rather than the system user.
+	Rootless bool `default:"false" yaml:"rootless"`
+
+	// Set to true when the Docker daemon has "userns-remap" enabled. Files are owned by the
+	// system user offset by the start of the remap range below so that they are accessible
+	// to the remapped user within containers.
+	Remap bool `default:"false" yaml:"remap"`
+
+	// The first host user and group ID of the remap range, as defined for the remap user in
+	// /etc/subuid and /etc/subgid.
+	UidStart int `default:"100000" yaml:"uid_start"`
+	GidStart int `default:"100000" yaml:"gid_start"`
+
+	// The number of IDs in the remap range.
+	Size int `default:"65536" yaml:"size"`
+}
+
+// Defines the limits applied when extracting an archive. A limit of 0 disables that limit.
+type ExtractionConfiguration struct {
+	// The maximum amount of data, in megabytes, that a single archive can expand to. Archives
+	// are also limited to the disk space that the server has remaining.
+	MaxSize int64 `default:"51200" yaml:"max_size"`
+
+	// The maximum number of files that a single archive can contain.
+	MaxFiles int64 `default:"250000" yaml:"max_files"`
+
+	// The maximum number of directories deep that a file in an archive can be.
+	MaxDepth int `default:"64" yaml:"max_depth"`
+}
+
+// Defines the limits applied when pulling a file from a URL into a server directory.
+type FilePullConfiguration struct {
+	// The maximum size, in megabytes, of a file that can be pulled. Files are also limited to the
+	// disk space that the server has remaining. A limit of 0 disables this limit.
+	MaxSize int64 `default:"10240" yaml:"max_size"`
+
+	// The number of files that can be pulled for a single server at the same time.
+	MaxConcurrent int `default:"3" yaml:"max_concurrent"`
+}
+
+// Defines the range of IDs that are allocated to servers when each server has its own user.
+type PerServerUserConfiguration struct {
+	// Determines if each server is given its own user and group ID. The IDs are allocated the
+	// first time a server is loaded and stored in the root directory. Enabling this on a node
+	// with existing servers requires check_permissions_on_boot to be enabled so that the files
+	// for each server are given to its new owner the next time it starts.
+	Enabled bool `default:"false" yaml:"enabled"`
+
+	// The first ID in the range allocated to servers, and the number of IDs in the range. The
+	// same ID is used for both the user and group of a server. This range must not overlap with
+	// any users on the host, and must be within the user namespace remap range if that is used.
+	IdStart int `default:"200000" yaml:"id_start"`
+	IdCount int `default:"100000" yaml:"id_count"`
+}
+
+// Returns the user that server processes should run as inside of their containers.
+func (sc *SystemConfiguration) ContainerUser() string {
+	if sc.UserNamespace.Rootless {
+		return "0:0"
+	}
+
+	return strconv.Itoa(sc.User.Uid)
+}
+
+// Returns the user and group that a server process with its own user should run as inside
+// of its container.
+func (sc *SystemConfiguration) ContainerUserFor(uid int, gid int) string {
+	if sc.UserNamespace.Rootless {
+		return "0:0"
+	}
+
+	return strconv.Itoa(uid) + ":" + strconv.Itoa(gid)
+}
+
+// Returns the user and group ID on the host that should own the files for a server so that
+// they are accessible to the server process running inside of its container.
+func (sc *SystemConfiguration) FileOwner() (int, int) {
+	return sc.FileOwnerFor(sc.User.Uid, sc.User.Gid)
+}
+
+// Returns the user and group ID on the host that should own the files for a server whose
+// process runs as the given user and group inside of its container.
+func (sc *SystemConfiguration) FileOwnerFor(uid int, gid int) (int, int) {
+	ns := sc.UserNamespace
+
+	if ns.Rootless {
+		return os.Getuid(), os.Getgid()
+	}
+
+	if ns.Remap && uid < ns.Size && gid < ns.Size {
+		return ns.UidStart + uid, ns.GidStart + gid
+	}
+
+	return uid, gid
 }
 
 // Ensures that all of the system directories exist on the system. These directories are
@@ -110,6 +342,31 @@ func (sc *SystemConfiguration) ConfigureDirectories() error {
 		return err
 	}
 
+	log.WithField("path", sc.GetEventsPath()).Debug("ensuring event journal directory exists")
+	if err := os.MkdirAll(sc.GetEventsPath(), 0700); err != nil {
+		return err
+	}
+
+	log.WithField("path", sc.GetResourceHistoryPath()).Debug("ensuring resource history directory exists")
+	if err := os.MkdirAll(sc.GetResourceHistoryPath(), 0700); err != nil {
+		return err
+	}
+
+	log.WithField("path", sc.GetCrashReportsPath()).Debug("ensuring crash report directory exists")
+	if err := os.MkdirAll(sc.GetCrashReportsPath(), 0700); err != nil {
+		return err
+	}
+
+	log.WithField("path", sc.SnapshotDirectory).Debug("ensuring snapshot data directory exists")
+	if err := os.MkdirAll(sc.SnapshotDirectory, 0700); err != nil {
+		return err
+	}
+
+	log.WithField("path", sc.HibernationDirectory).Debug("ensuring hibernation data directory exists")
+	if err := os.MkdirAll(sc.HibernationDirectory, 0700); err != nil {
+		return err
+	}
+
 	return nil
 }
 
@@ -173,6 +430,21 @@ func (sc *SystemConfiguration) GetStatesPath() string {
 	return path.Join(sc.RootDirectory, "states.json")
 }
 
+// Returns the directory where resource usage history for servers is stored.
+func (sc *SystemConfiguration) GetResourceHistoryPath() string {
+	return path.Join(sc.RootDirectory, "history")
+}
+
+// Returns the directory where the event journals for servers are stored.
+func (sc *SystemConfiguration) GetEventsPath() string {
+	return path.Join(sc.RootDirectory, "events")
+}
+
+// Returns the directory where the crash reports for servers are stored.
+func (sc *SystemConfiguration) GetCrashReportsPath() string {
+	return path.Join(sc.RootDirectory, "crashes")
+}
+
 // Returns the location of the JSON file that tracks server states.
 func (sc *SystemConfiguration) GetInstallLogPath() string {
 	return path.Join(sc.LogDirectory, "install/")
@@ -0,0 +1,22 @@
+package config
+
+// Defines how Wings checks for and installs new releases of itself.
+type UpdateConfiguration struct {
+	// Determines if Wings should periodically check for a new release and install it
+	// automatically. Updates can always be installed manually using "claws update".
+	Enabled bool `default:"false" yaml:"enabled"`
+
+	// The number of hours between automatic checks for a new release.
+	Interval int `default:"24" yaml:"interval"`
+
+	// The location of the GitHub compatible releases API used to find new releases. This can
+	// be changed to use a mirror that serves the latest release at "<url>/releases/latest".
+	Url string `default:"https://api.github.com/repos/avatag-host/claws" yaml:"url"`
+
+	// The base64 encoded Ed25519 public key used to verify the signature of the checksums
+	// published with each release. The signature covers the version of the release along with
+	// the checksums, so that an older release cannot be served in place of a newer one.
+	// Releases without a valid signature are never installed unless signature verification is
+	// explicitly skipped.
+	PublicKey string `yaml:"public_key"`
+}
@@ -0,0 +1,376 @@
+package config
+
+import (
+	"crypto/tls"
+	"encoding/base64"
+	"fmt"
+	"github.com/google/uuid"
+	"gopkg.in/yaml.v2"
+	"io/ioutil"
+	"net"
+	"net/url"
+	"os"
+	"strings"
+)
+
+// A problem found when validating the configuration.
+type ValidationError struct {
+	// The configuration key that the problem relates to.
+	Key string
+
+	// A description of the problem and how to resolve it.
+	Message string
+}
+
+func (e ValidationError) Error() string {
+	if e.Key == "" {
+		return e.Message
+	}
+
+	return fmt.Sprintf("%s: %s", e.Key, e.Message)
+}
+
+// Returns the problems with any keys in the raw configuration file that do not match a known
+// configuration option. These keys are otherwise silently ignored when the configuration is
+// parsed, leaving the option they were intended for at its default value.
+func unknownKeys(b []byte) []ValidationError {
+	err := yaml.UnmarshalStrict(b, new(Configuration))
+	if err == nil {
+		return nil
+	}
+
+	terr, ok := err.(*yaml.TypeError)
+	if !ok {
+		return []ValidationError{{Message: err.Error()}}
+	}
+
+	var out []ValidationError
+	for _, e := range terr.Errors {
+		// Type mismatches are already reported when the configuration is parsed normally, so
+		// only include the errors for unknown fields here.
+		if strings.Contains(e, "not found in type") || strings.Contains(e, "already set in map") {
+			out = append(out, ValidationError{Message: e})
+		}
+	}
+
+	return out
+}
+
+// Returns the problems with any keys in the configuration file that were ignored because they
+// do not match a known configuration option.
+func (c *Configuration) UnknownKeys() []ValidationError {
+	return c.unknown
+}
+
+// Parses the configuration file at the given path and returns any problems found with it. An
+// error is only returned if the file could not be parsed at all.
+func ValidateFile(path string) (*Configuration, []ValidationError, error) {
+	c, err := ReadConfiguration(path)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return c, append(c.UnknownKeys(), c.Validate()...), nil
+}
+
+// Checks the configuration for values that would prevent Wings from running correctly.
+func (c *Configuration) Validate() []ValidationError {
+	var out []ValidationError
+	add := func(key string, format string, v ...interface{}) {
+		out = append(out, ValidationError{Key: key, Message: fmt.Sprintf(format, v...)})
+	}
+
+	if _, err := uuid.Parse(c.Uuid); err != nil {
+		add("uuid", "must be the UUID of this node in the Panel")
+	}
+
+	if len(c.AuthenticationTokenId) != 16 {
+		add("token_id", "must be the 16 character token identifier provided by the Panel")
+	}
+
+	if len(c.AuthenticationToken) != 64 {
+		add("token", "must be the 64 character token provided by the Panel")
+	}
+
+	if u, err := url.Parse(c.PanelLocation); err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		add("remote", "must be the full URL of the Panel, such as https://panel.example.com")
+	}
+
+	names := make(map[string]bool)
+	for i, p := range c.Panels {
+		key := fmt.Sprintf("panels.%d", i)
+		if p.Name == "" || names[p.Name] {
+			add(key+".name", "must be a unique name for the panel")
+		}
+		names[p.Name] = true
+
+		if u, err := url.Parse(p.PanelLocation); err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			add(key+".remote", "must be the full URL of the Panel, such as https://panel.example.com")
+		}
+
+		if len(p.AuthenticationTokenId) != 16 || len(p.AuthenticationToken) != 64 {
+			add(key+".token", "must be the 16 character token identifier and 64 character token provided by the Panel")
+		} else if p.AuthenticationToken == c.AuthenticationToken {
+			add(key+".token", "must not be the same token used by another panel")
+		}
+	}
+
+	switch c.System.ConsoleAnsi {
+	case "keep", "strip", "html":
+	default:
+		add("system.console_ansi", "must be one of \"keep\", \"strip\" or \"html\"")
+	}
+
+	if c.System.SuspensionMode != "stop" && c.System.SuspensionMode != "pause" {
+		add("system.suspension_mode", "must be either \"stop\" or \"pause\"")
+	}
+
+	if c.LogFormat != "cli" && c.LogFormat != "json" {
+		add("log_format", "must be either \"cli\" or \"json\"")
+	}
+
+	if s := c.System.LogSinks.Syslog; s.Enabled {
+		switch s.Network {
+		case "", "udp", "tcp", "unix":
+		default:
+			add("system.log_sinks.syslog.network", "must be one of \"udp\", \"tcp\" or \"unix\"")
+		}
+
+		if (s.Network == "") != (s.Address == "") {
+			add("system.log_sinks.syslog.address", "a network and address must both be provided, or both left empty to use the local syslog daemon")
+		}
+	}
+
+	if r := c.System.CrashReports; r.Enabled {
+		if r.ConsoleLines < 0 {
+			add("system.crash_reports.console_lines", "must not be negative")
+		}
+
+		if r.Retention < 1 {
+			add("system.crash_reports.retention", "must be at least 1")
+		}
+	}
+
+	if l := c.System.LogShipping; l.Enabled {
+		if l.Driver != LogShippingLoki && l.Driver != LogShippingElasticsearch {
+			add("system.log_shipping.driver", "must be either \"%s\" or \"%s\"", LogShippingLoki, LogShippingElasticsearch)
+		}
+
+		if u, err := url.Parse(l.Url); err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			add("system.log_shipping.url", "must be the full URL of the log store")
+		}
+	}
+
+	if q := c.System.DiskQuota; q.Enabled {
+		if q.Driver != DiskQuotaXfs && q.Driver != DiskQuotaBtrfs {
+			add("system.disk_quota.driver", "must be either \"%s\" or \"%s\"", DiskQuotaXfs, DiskQuotaBtrfs)
+		}
+
+		if q.Driver == DiskQuotaXfs && (q.ProjectIdStart < 1 || q.ProjectIdCount < 1) {
+			add("system.disk_quota.project_id_start", "must be a range of positive project IDs")
+		}
+	}
+
+	if c.System.FilePull.MaxSize < 0 {
+		add("system.file_pull.max_size", "must not be negative")
+	}
+
+	if c.System.FilePull.MaxConcurrent < 1 {
+		add("system.file_pull.max_concurrent", "must be at least 1")
+	}
+
+	if a := c.System.Activity; a.Enabled {
+		if a.FlushInterval < 1 {
+			add("system.activity.flush_interval", "must be at least 1 second")
+		}
+
+		if a.BufferSize < 1 {
+			add("system.activity.buffer_size", "must be at least 1")
+		}
+	}
+
+	if b := c.System.EventBridge; b.Enabled {
+		if b.Driver != EventBridgeNats && b.Driver != EventBridgeRedis {
+			add("system.event_bridge.driver", "must be either \"%s\" or \"%s\"", EventBridgeNats, EventBridgeRedis)
+		}
+
+		if _, _, err := net.SplitHostPort(b.Address); err != nil {
+			add("system.event_bridge.address", "must be the host and port of the broker, such as 127.0.0.1:4222")
+		}
+	}
+
+	for i, h := range c.System.Hooks {
+		key := fmt.Sprintf("system.hooks.%d", i)
+		switch h.Event {
+		case "pre-start", "post-stop", "pre-backup", "file-uploaded":
+		default:
+			add(key+".event", "must be one of \"pre-start\", \"post-stop\", \"pre-backup\" or \"file-uploaded\"")
+		}
+
+		if h.Command == "" {
+			add(key+".command", "a command must be provided")
+		}
+	}
+
+	switch c.Environment {
+	case EnvironmentDocker, EnvironmentProcess, EnvironmentLxd:
+	default:
+		add("environment", "must be one of \"%s\", \"%s\" or \"%s\"", EnvironmentDocker, EnvironmentProcess, EnvironmentLxd)
+	}
+
+	dirs := []struct {
+		key  string
+		path string
+	}{
+		{"system.root_directory", c.System.RootDirectory},
+		{"system.log_directory", c.System.LogDirectory},
+		{"system.data", c.System.Data},
+		{"system.archive_directory", c.System.ArchiveDirectory},
+		{"system.backup_directory", c.System.BackupDirectory},
+		{"system.snapshot_directory", c.System.SnapshotDirectory},
+		{"system.hibernation_directory", c.System.HibernationDirectory},
+	}
+
+	for _, d := range dirs {
+		if err := checkDirectory(d.path); err != nil {
+			add(d.key, "%s", err.Error())
+		}
+	}
+
+	if c.Api.Port <= 0 || c.Api.Port > 65535 {
+		add("api.port", "must be a port between 1 and 65535")
+	}
+
+	if c.Api.Ssl.Enabled {
+		if err := checkCertificate(c.Api.Ssl.CertificateFile, c.Api.Ssl.KeyFile); err != nil {
+			add("api.ssl", "%s", err.Error())
+		}
+
+		for i, sc := range c.Api.Ssl.Certificates {
+			key := fmt.Sprintf("api.ssl.certificates[%d]", i)
+			if len(sc.Hostnames) == 0 {
+				add(key, "at least one hostname must be provided")
+			}
+
+			if err := checkCertificate(sc.CertificateFile, sc.KeyFile); err != nil {
+				add(key, "%s", err.Error())
+			}
+		}
+	}
+
+	if r := c.Docker.Reconcile; r.OnStart != ReconcileAttach && r.OnStart != ReconcileStop {
+		add("docker.reconcile.on_start", "must be one of \"%s\" or \"%s\"", ReconcileAttach, ReconcileStop)
+	}
+
+	if r := c.Docker.Reconcile; r.OnRemove != ReconcileRecreate && r.OnRemove != ReconcileIgnore {
+		add("docker.reconcile.on_remove", "must be one of \"%s\" or \"%s\"", ReconcileRecreate, ReconcileIgnore)
+	}
+
+	if u := c.System.PerServerUsers; u.Enabled {
+		ns := c.System.UserNamespace
+		if u.IdStart <= 0 || u.IdCount <= 0 {
+			add("system.per_server_users", "id_start and id_count must be greater than 0")
+		} else if ns.Rootless {
+			add("system.per_server_users", "cannot be used when docker is running in rootless mode")
+		} else if ns.Remap && u.IdStart+u.IdCount > ns.Size {
+			add("system.per_server_users", "the range of IDs must be within the user namespace remap range of %d IDs", ns.Size)
+		}
+	}
+
+	if c.System.PowerWatchdogMultiplier < 0 {
+		add("system.power_watchdog_multiplier", "cannot be negative, use 0 to disable the watchdog")
+	}
+
+	if r := c.System.Reservations; r.Memory < 0 || r.Disk < 0 || r.MaxLoad < 0 {
+		add("system.reservations", "values cannot be negative, use 0 to disable a reservation")
+	}
+
+	if a := c.Api.Acme; a.DirectoryUrl != "" {
+		if u, err := url.Parse(a.DirectoryUrl); err != nil || u.Scheme != "https" || u.Host == "" {
+			add("api.acme.directory_url", "must be a valid https:// URL")
+		}
+
+		if (a.Eab.KeyId == "") != (a.Eab.HmacKey == "") {
+			add("api.acme.eab", "both key_id and hmac_key must be provided")
+		} else if a.Eab.HmacKey != "" {
+			if _, err := base64.RawURLEncoding.DecodeString(strings.TrimRight(a.Eab.HmacKey, "=")); err != nil {
+				add("api.acme.eab.hmac_key", "must be a base64url encoded key")
+			}
+		}
+	}
+
+	if f := c.System.Ftp; f.Enabled {
+		if f.Port <= 0 || f.Port > 65535 {
+			add("system.ftp.bind_port", "must be a port between 1 and 65535")
+		} else if f.Port == c.Api.Port {
+			add("system.ftp.bind_port", "port %d is already used by the API", f.Port)
+		}
+
+		if f.PassivePortStart <= 0 || f.PassivePortEnd > 65535 || f.PassivePortEnd < f.PassivePortStart {
+			add("system.ftp.passive_port_start", "must be a valid range of ports, with passive_port_end greater than or equal to passive_port_start")
+		} else {
+			for _, p := range []struct {
+				name string
+				port int
+			}{{"the API", c.Api.Port}, {"the FTPS server", f.Port}} {
+				if p.port >= f.PassivePortStart && p.port <= f.PassivePortEnd {
+					add("system.ftp.passive_port_start", "passive port range %d-%d includes port %d used by %s", f.PassivePortStart, f.PassivePortEnd, p.port, p.name)
+				}
+			}
+		}
+
+		cert, key := f.CertificateFile, f.KeyFile
+		if cert == "" || key == "" {
+			cert, key = c.Api.Ssl.CertificateFile, c.Api.Ssl.KeyFile
+		}
+
+		if err := checkCertificate(cert, key); err != nil {
+			add("system.ftp.cert", "%s", err.Error())
+		}
+	}
+
+	return out
+}
+
+// Checks that a directory used by Wings either exists and is writable, or is able to be created.
+func checkDirectory(p string) error {
+	if p == "" {
+		return fmt.Errorf("a directory must be provided")
+	}
+
+	st, err := os.Stat(p)
+	if err != nil {
+		if !os.IsNotExist(err) {
+			return err
+		}
+
+		// Missing directories are created when Wings boots.
+		return nil
+	}
+
+	if !st.IsDir() {
+		return fmt.Errorf("%s exists but is not a directory", p)
+	}
+
+	f, err := ioutil.TempFile(p, ".claws-validate-")
+	if err != nil {
+		return fmt.Errorf("%s is not writable by the current user", p)
+	}
+	f.Close()
+	os.Remove(f.Name())
+
+	return nil
+}
+
+// Checks that a TLS certificate and key exist and are a valid pair.
+func checkCertificate(cert string, key string) error {
+	if cert == "" || key == "" {
+		return fmt.Errorf("a certificate and key file must be provided")
+	}
+
+	if _, err := tls.LoadX509KeyPair(cert, key); err != nil {
+		return fmt.Errorf("failed to load certificate %s and key %s: %s", cert, key, err.Error())
+	}
+
+	return nil
+}
@@ -4,7 +4,10 @@ import (
 	"fmt"
 	"github.com/docker/go-connections/nat"
 	"github.com/avatag-host/claws/config"
+	"net"
+	"sort"
 	"strconv"
+	"strings"
 )
 
 // Defines the allocations available for a given server. When using the Docker environment
@@ -32,6 +35,8 @@ func (a *Allocations) Bindings() nat.PortMap {
 	var out = nat.PortMap{}
 
 	for ip, ports := range a.Mappings {
+		ip = NormalizeIp(ip)
+
 		for _, port := range ports {
 			// Skip over invalid ports.
 			if port < 1 || port > 65535 {
@@ -63,9 +68,17 @@ func (a *Allocations) DockerBindings() nat.PortMap {
 	// Loop over all of the bindings for this container, and convert any that reference 127.0.0.1
 	// to use the pterodactyl0 network interface IP, as that is the true local for what people are
 	// trying to do when creating servers.
+	//
+	// The same is done for the IPv6 loopback address using the IPv6 gateway of the network.
 	for p, binds := range out {
 		for i, alloc := range binds {
-			if alloc.HostIP != "127.0.0.1" {
+			var local string
+			switch alloc.HostIP {
+			case "127.0.0.1":
+				local = iface
+			case "::1":
+				local = config.Get().Docker.Network.Interfaces.V6.Gateway
+			default:
 				continue
 			}
 
@@ -74,7 +87,7 @@ func (a *Allocations) DockerBindings() nat.PortMap {
 				out[p] = append(out[p][:i], out[p][i+1:]...)
 			} else {
 				out[p][i] = nat.PortBinding{
-					HostIP:   iface,
+					HostIP:   local,
 					HostPort: alloc.HostPort,
 				}
 			}
@@ -99,3 +112,43 @@ func (a *Allocations) Exposed() nat.PortSet {
 
 	return out
 }
+
+// Returns all of the addresses assigned to the server in "ip:port" format, with IPv6
+// addresses wrapped in brackets so that they can be used as-is by clients.
+func (a *Allocations) Addresses() []string {
+	var out []string
+
+	for ip, ports := range a.Mappings {
+		for _, port := range ports {
+			if port < 1 || port > 65535 {
+				continue
+			}
+
+			out = append(out, net.JoinHostPort(NormalizeIp(ip), strconv.Itoa(port)))
+		}
+	}
+
+	sort.Strings(out)
+
+	return out
+}
+
+// Returns the address the default allocation can be reached on from the host itself for the
+// given port. If the allocation is bound to all interfaces the loopback address is used.
+func (a *Allocations) LocalAddress(port int) string {
+	ip := NormalizeIp(a.DefaultMapping.Ip)
+	switch ip {
+	case "", "0.0.0.0":
+		ip = "127.0.0.1"
+	case "::":
+		ip = "::1"
+	}
+
+	return net.JoinHostPort(ip, strconv.Itoa(port))
+}
+
+// Normalizes an IP address received from the Panel. IPv6 addresses may be wrapped in
+// brackets which Docker does not accept when binding ports.
+func NormalizeIp(ip string) string {
+	return strings.TrimSuffix(strings.TrimPrefix(ip, "["), "]")
+}
@@ -1,13 +1,29 @@
 package environment
 
 import (
+	"github.com/avatag-host/claws/config"
+	"regexp"
+	"strings"
 	"sync"
+	"time"
 )
 
+var startupVariableRegex = regexp.MustCompile(`{{(\w+)}}`)
+
 type Settings struct {
 	Mounts      []Mount
 	Allocations Allocations
 	Limits      Limits
+	Container   ContainerSettings
+
+	// The number of seconds between resource usage updates for the environment. If this
+	// is zero the node default is used.
+	StatsInterval int
+
+	// The user and group ID that the server process runs as when the server has been given
+	// its own user. If these are zero the system user is used.
+	Uid int
+	Gid int
 }
 
 // Defines the actual configuration struct for the environment with all of the settings
@@ -60,6 +76,14 @@ func (c *Configuration) Allocations() Allocations {
 	return c.settings.Allocations
 }
 
+// Returns the container settings associated with this environment.
+func (c *Configuration) Container() ContainerSettings {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	return c.settings.Container
+}
+
 // Returns all of the mounts associated with this environment.
 func (c *Configuration) Mounts() []Mount {
 	c.mu.RLock()
@@ -68,6 +92,36 @@ func (c *Configuration) Mounts() []Mount {
 	return c.settings.Mounts
 }
 
+// Returns the amount of time between each resource usage update for the environment.
+func (c *Configuration) StatsInterval() time.Duration {
+	c.mu.RLock()
+	i := c.settings.StatsInterval
+	c.mu.RUnlock()
+
+	if i <= 0 {
+		i = config.Get().Docker.StatsInterval
+	}
+
+	if i <= 0 {
+		i = 1
+	}
+
+	return time.Second * time.Duration(i)
+}
+
+// Returns the user and group ID that the server process should run as.
+func (c *Configuration) User() (int, int) {
+	c.mu.RLock()
+	uid, gid := c.settings.Uid, c.settings.Gid
+	c.mu.RUnlock()
+
+	if uid == 0 {
+		return config.Get().System.User.Uid, config.Get().System.User.Gid
+	}
+
+	return uid, gid
+}
+
 // Returns the environment variables associated with this instance.
 func (c *Configuration) EnvironmentVariables() []string {
 	c.mu.RLock()
@@ -75,3 +129,21 @@ func (c *Configuration) EnvironmentVariables() []string {
 
 	return c.environmentVariables
 }
+
+// Returns the startup command for the server with any "{{VARIABLE}}" placeholders replaced
+// using the environment variables for the server, matching the behavior of the entrypoint
+// used by the Docker images. This is used by environments that run the startup command
+// themselves rather than relying on the image to do so.
+func (c *Configuration) StartupCommand() string {
+	vars := make(map[string]string)
+	for _, v := range c.EnvironmentVariables() {
+		parts := strings.SplitN(v, "=", 2)
+		if len(parts) == 2 {
+			vars[parts[0]] = parts[1]
+		}
+	}
+
+	return startupVariableRegex.ReplaceAllStringFunc(vars["STARTUP"], func(m string) string {
+		return vars[m[2:len(m)-2]]
+	})
+}
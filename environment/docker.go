@@ -2,8 +2,11 @@ package environment
 
 import (
 	"context"
+	"fmt"
 	"github.com/apex/log"
+	"github.com/pkg/errors"
 	"strconv"
+	"strings"
 	"sync"
 
 	"github.com/docker/docker/api/types"
@@ -14,6 +17,7 @@ import (
 
 var _cmu sync.Mutex
 var _client *client.Client
+var _clients = make(map[string]*client.Client)
 
 // Return a Docker client to be used throughout the codebase. Once a client has been created it
 // will be returned for all subsequent calls to this function.
@@ -30,14 +34,51 @@ func DockerClient() (*client.Client, error) {
 	return _client, err
 }
 
+// Returns a Docker client for the named endpoint defined in the configuration. If the name
+// is empty the default client returned by DockerClient() is used.
+func DockerClientFor(name string) (*client.Client, error) {
+	if name == "" {
+		return DockerClient()
+	}
+
+	_cmu.Lock()
+	defer _cmu.Unlock()
+
+	if c, ok := _clients[name]; ok {
+		return c, nil
+	}
+
+	ep, ok := config.Get().Docker.Endpoints[name]
+	if !ok {
+		return nil, errors.New(fmt.Sprintf("environment: no docker endpoint named \"%s\" is configured", name))
+	}
+
+	opts := []client.Opt{client.WithHost(ep.Host), client.WithAPIVersionNegotiation()}
+	if ep.TLS.CA != "" || ep.TLS.Cert != "" {
+		opts = append(opts, client.WithTLSClientConfig(ep.TLS.CA, ep.TLS.Cert, ep.TLS.Key))
+	}
+
+	c, err := client.NewClientWithOpts(opts...)
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+	_clients[name] = c
+
+	return c, nil
+}
+
 // Configures the required network for the docker environment.
 func ConfigureDocker(c *config.DockerConfiguration) error {
+	defer configureDockerEndpoints(c)
+
 	// Ensure the required docker network exists on the system.
 	cli, err := DockerClient()
 	if err != nil {
 		return err
 	}
 
+	checkUserNamespace(cli)
+
 	resource, err := cli.NetworkInspect(context.Background(), c.Network.Name, types.NetworkInspectOptions{})
 	if err != nil && client.IsErrNotFound(err) {
 		log.Info("creating missing pterodactyl0 interface, this could take a few seconds...")
@@ -65,21 +106,26 @@ func ConfigureDocker(c *config.DockerConfiguration) error {
 
 // Creates a new network on the machine if one does not exist already.
 func createDockerNetwork(cli *client.Client, c *config.DockerConfiguration) error {
+	ipam := []network.IPAMConfig{
+		{
+			Subnet:  c.Network.Interfaces.V4.Subnet,
+			Gateway: c.Network.Interfaces.V4.Gateway,
+		},
+	}
+
+	if c.Network.EnableIPv6 {
+		ipam = append(ipam, network.IPAMConfig{
+			Subnet:  c.Network.Interfaces.V6.Subnet,
+			Gateway: c.Network.Interfaces.V6.Gateway,
+		})
+	}
+
 	_, err := cli.NetworkCreate(context.Background(), c.Network.Name, types.NetworkCreate{
 		Driver:     c.Network.Driver,
-		EnableIPv6: true,
+		EnableIPv6: c.Network.EnableIPv6,
 		Internal:   c.Network.IsInternal,
 		IPAM: &network.IPAM{
-			Config: []network.IPAMConfig{
-				{
-					Subnet:  c.Network.Interfaces.V4.Subnet,
-					Gateway: c.Network.Interfaces.V4.Gateway,
-				},
-				{
-					Subnet:  c.Network.Interfaces.V6.Subnet,
-					Gateway: c.Network.Interfaces.V6.Gateway,
-				},
-			},
+			Config: ipam,
 		},
 		Options: map[string]string{
 			"encryption": "false",
@@ -114,3 +160,67 @@ func createDockerNetwork(cli *client.Client, c *config.DockerConfiguration) erro
 
 	return nil
 }
+
+// Ensures the required network exists on each of the remote Docker endpoints. A remote
+// endpoint being unavailable should not prevent the daemon from booting, so any failures
+// are only logged.
+func configureDockerEndpoints(c *config.DockerConfiguration) {
+	for name := range c.Endpoints {
+		l := log.WithField("endpoint", name)
+
+		cli, err := DockerClientFor(name)
+		if err != nil {
+			l.WithField("error", err).Error("failed to create client for docker endpoint")
+			continue
+		}
+
+		if _, err := cli.NetworkInspect(context.Background(), c.Network.Name, types.NetworkInspectOptions{}); err == nil {
+			continue
+		} else if !client.IsErrNotFound(err) {
+			l.WithField("error", err).Error("failed to inspect network on docker endpoint")
+			continue
+		}
+
+		// The network configuration is updated based on the network created, which should only
+		// happen for the local daemon, so work with a copy of it here.
+		cc := *c
+		l.Info("creating missing network on docker endpoint")
+		if err := createDockerNetwork(cli, &cc); err != nil {
+			l.WithField("error", err).Error("failed to create network on docker endpoint")
+		}
+	}
+}
+
+// Compares the user namespace configuration against the security options reported by the
+// Docker daemon and warns if they do not match, since file ownership will be wrong for any
+// servers if the daemon is remapping users without Wings being aware of it.
+func checkUserNamespace(cli *client.Client) {
+	info, err := cli.Info(context.Background())
+	if err != nil {
+		log.WithField("error", err).Warn("failed to retrieve docker daemon information")
+		return
+	}
+
+	var rootless, remap bool
+	for _, opt := range info.SecurityOptions {
+		switch {
+		case strings.Contains(opt, "name=rootless"):
+			rootless = true
+		case strings.Contains(opt, "name=userns"):
+			remap = true
+		}
+	}
+
+	ns := config.Get().System.UserNamespace
+	if rootless != ns.Rootless {
+		log.WithField("docker_rootless", rootless).Warn("docker rootless mode does not match the user_namespace.rootless configuration value")
+	}
+
+	if remap != ns.Remap && !rootless {
+		log.WithField("docker_userns_remap", remap).Warn("docker user namespace remapping does not match the user_namespace.remap configuration value")
+	}
+
+	if ns.Remap && (config.Get().System.User.Uid >= ns.Size || config.Get().System.User.Gid >= ns.Size) {
+		log.Warn("system user is outside of the configured user namespace remap range, file ownership will not be translated")
+	}
+}
@@ -8,19 +8,33 @@ import (
 	"fmt"
 	"github.com/apex/log"
 	"github.com/docker/docker/api/types"
+	"github.com/docker/docker/api/types/blkiodev"
 	"github.com/docker/docker/api/types/container"
 	"github.com/docker/docker/api/types/mount"
 	"github.com/docker/docker/client"
 	"github.com/docker/docker/daemon/logger/jsonfilelog"
+	"github.com/docker/go-units"
 	"github.com/pkg/errors"
 	"github.com/avatag-host/claws/config"
 	"github.com/avatag-host/claws/environment"
 	"io"
+	"io/ioutil"
+	"net"
+	"path/filepath"
+	"regexp"
 	"strconv"
 	"strings"
 	"time"
 )
 
+// The capabilities dropped from every server container unless explicitly added back.
+var defaultCapDrop = []string{
+	"setpcap", "mknod", "audit_write", "net_raw", "dac_override",
+	"fowner", "fsetid", "net_bind_service", "sys_chroot", "setfcap",
+}
+
+var securityProfileRegex = regexp.MustCompile(`^[a-zA-Z0-9_-]+$`)
+
 type imagePullStatus struct {
 	Status   string `json:"status"`
 	Progress string `json:"progress"`
@@ -35,6 +49,10 @@ func (e *Environment) Attach() error {
 		return nil
 	}
 
+	if err := e.awaitRestart(); err != nil {
+		return err
+	}
+
 	if err := e.followOutput(); err != nil {
 		return errors.WithStack(err)
 	}
@@ -60,8 +78,18 @@ func (e *Environment) Attach() error {
 		defer cancel()
 		defer e.stream.Close()
 		defer func() {
+			// Stop polling for resources before potentially waiting on the daemon below.
+			cancel()
+
+			// If the Docker daemon was restarted while the container kept running the
+			// environment is attached again, and the server is not marked as offline.
+			if e.recoverFromDaemonRestart() {
+				return
+			}
+
 			e.setState(environment.ProcessOfflineState)
 			e.SetStream(nil)
+			e.stopSidecars()
 		}()
 
 		// Poll resources in a separate thread since this will block the copy call below
@@ -70,6 +98,12 @@ func (e *Environment) Attach() error {
 		// indicates that the container is no longer running.
 		go func(ctx context.Context) {
 			if err := e.pollResources(ctx); err != nil {
+				// Polling stops when the Docker daemon goes away, which is already handled once
+				// the attached stream closes.
+				if !e.daemonAvailable() {
+					return
+				}
+
 				log.WithField("environment_id", e.Id).WithField("error", errors.WithStack(err)).Error("error during environment resource polling")
 			}
 		}(ctx)
@@ -87,7 +121,7 @@ func (e *Environment) Attach() error {
 func (e *Environment) resources() container.Resources {
 	l := e.Configuration.Limits()
 
-	return container.Resources{
+	r := container.Resources{
 		Memory:            l.BoundedMemoryLimit(),
 		MemoryReservation: l.MemoryLimit * 1_000_000,
 		MemorySwap:        l.ConvertedSwap(),
@@ -97,7 +131,26 @@ func (e *Environment) resources() container.Resources {
 		BlkioWeight:       l.IoWeight,
 		OomKillDisable:    &l.OOMDisabled,
 		CpusetCpus:        l.Threads,
+		CpusetMems:        l.CpusetMems,
+	}
+
+	for _, d := range config.Get().Docker.ThrottleDevices {
+		r.BlkioDeviceReadBps = appendThrottleDevice(r.BlkioDeviceReadBps, d, l.IoReadBps)
+		r.BlkioDeviceWriteBps = appendThrottleDevice(r.BlkioDeviceWriteBps, d, l.IoWriteBps)
+		r.BlkioDeviceReadIOps = appendThrottleDevice(r.BlkioDeviceReadIOps, d, l.IoReadIops)
+		r.BlkioDeviceWriteIOps = appendThrottleDevice(r.BlkioDeviceWriteIOps, d, l.IoWriteIops)
+	}
+
+	return r
+}
+
+// Appends a throttle limit for a device to the slice if there is a limit to be applied.
+func appendThrottleDevice(s []*blkiodev.ThrottleDevice, path string, rate uint64) []*blkiodev.ThrottleDevice {
+	if rate == 0 {
+		return s
 	}
+
+	return append(s, &blkiodev.ThrottleDevice{Path: path, Rate: rate})
 }
 
 // Performs an in-place update of the Docker container's resource limits without actually
@@ -134,6 +187,12 @@ func (e *Environment) InSituUpdate() error {
 // Creates a new container for the server using all of the data that is currently
 // available for it. If the container already exists it will be returnee.
 func (e *Environment) Create() error {
+	return e.create(context.Background())
+}
+
+// Creates the container for the server, aborting any image pull once the context is
+// cancelled.
+func (e *Environment) create(ctx context.Context) error {
 	// If the container already exists don't hit the user with an error, just return
 	// the current information about it which is what we would do when creating the
 	// container anyways.
@@ -144,7 +203,7 @@ func (e *Environment) Create() error {
 	}
 
 	// Try to pull the requested image before creating the container.
-	if err := e.ensureImageExists(e.meta.Image); err != nil {
+	if err := e.ensureImageExists(ctx, e.meta.Image); err != nil {
 		return errors.WithStack(err)
 	}
 
@@ -162,7 +221,7 @@ func (e *Environment) Create() error {
 	conf := &container.Config{
 		Hostname:     e.Id,
 		Domainname:   config.Get().Docker.Domainname,
-		User:         strconv.Itoa(config.Get().System.User.Uid),
+		User:         e.containerUser(),
 		AttachStdin:  true,
 		AttachStdout: true,
 		AttachStderr: true,
@@ -171,14 +230,9 @@ func (e *Environment) Create() error {
 		ExposedPorts: a.Exposed(),
 		Image:        e.meta.Image,
 		Env:          e.Configuration.EnvironmentVariables(),
-		Labels: map[string]string{
-			"Service":       "Pterodactyl",
-			"ContainerType": "server_process",
-		},
+		Labels:       e.labels(),
 	}
 
-	tmpfsSize := strconv.Itoa(int(config.Get().Docker.TmpfsSize))
-
 	hostConf := &container.HostConfig{
 		PortBindings: a.DockerBindings(),
 
@@ -186,46 +240,513 @@ func (e *Environment) Create() error {
 		// into the container as a r/w bind.
 		Mounts: e.convertMounts(),
 
-		// Configure the /tmp folder mapping in containers. This is necessary for some
-		// games that need to make use of it for downloads and other installation processes.
-		Tmpfs: map[string]string{
-			"/tmp": "rw,exec,nosuid,size=" + tmpfsSize + "M",
-		},
+		// Configure the /tmp folder mapping in containers, along with any additional tmpfs
+		// mounts requested for the server.
+		Tmpfs: e.tmpfs(),
 
 		// Define resource limits for the container based on the data passed through
 		// from the Panel.
 		Resources: e.resources(),
 
-		DNS: config.Get().Docker.Network.Dns,
-
 		// Configure logging for the container to make it easier on the Daemon to grab
-		// the server output. Ensure that we don't use too much space on the host machine
-		// since we only need it for the last few hundred lines of output and don't care
-		// about anything else in it.
-		LogConfig: container.LogConfig{
-			Type: jsonfilelog.Name,
-			Config: map[string]string{
-				"max-size": "5m",
-				"max-file": "1",
-			},
-		},
-
-		SecurityOpt:    []string{"no-new-privileges"},
+		// the server output.
+		LogConfig: e.logConfig(),
+
 		ReadonlyRootfs: true,
-		CapDrop: []string{
-			"setpcap", "mknod", "audit_write", "net_raw", "dac_override",
-			"fowner", "fsetid", "net_bind_service", "sys_chroot", "setfcap",
-		},
-		NetworkMode: container.NetworkMode(config.Get().Docker.Network.Mode),
+		NetworkMode:    e.networkMode(),
+	}
+
+	// Port bindings have no effect when using the host network, so instead make sure that
+	// nothing else is already using the ports allocated to the server.
+	if hostConf.NetworkMode.IsHost() {
+		if err := e.checkHostPorts(); err != nil {
+			return err
+		}
+
+		hostConf.PortBindings = nil
+	}
+
+	hostConf.Devices = e.devices()
+	hostConf.DNS, hostConf.DNSSearch, hostConf.ExtraHosts = e.dns()
+	hostConf.RestartPolicy = e.restartPolicy()
+	hostConf.ShmSize = e.shmSize()
+	hostConf.OomScoreAdj = e.oomScoreAdj()
+	hostConf.Ulimits = e.ulimits()
+	hostConf.CapAdd, hostConf.CapDrop = e.capabilities()
+
+	securityOpts, err := e.securityOpts()
+	if err != nil {
+		return err
 	}
+	hostConf.SecurityOpt = securityOpts
 
-	if _, err := e.client.ContainerCreate(context.Background(), conf, hostConf, nil, e.Id); err != nil {
+	r, err := e.client.ContainerCreate(context.Background(), conf, hostConf, nil, e.Id)
+	if err != nil {
 		return errors.WithStack(err)
 	}
 
+	if err := e.connectNetworks(r.ID); err != nil {
+		return err
+	}
+
+	return e.createSidecars(ctx)
+}
+
+// Returns the network mode for the container. Servers may only use the host network if it
+// is allowed by the node configuration.
+func (e *Environment) networkMode() container.NetworkMode {
+	if e.Configuration.Container().HostNetwork {
+		if config.Get().Docker.Network.AllowHostNetwork {
+			return container.NetworkMode("host")
+		}
+
+		log.WithField("environment_id", e.Id).Warn("server requested host networking but it is not allowed by the node configuration")
+	}
+
+	return container.NetworkMode(config.Get().Docker.Network.Mode)
+}
+
+// Checks that all of the ports allocated to the server are available on the host. This is
+// used when running on the host network since Docker will not detect port conflicts for us.
+// The ports can only be checked when the container runs on the same machine as Wings, so the
+// check is skipped for remote Docker endpoints.
+func (e *Environment) checkHostPorts() error {
+	log.WithField("environment_id", e.Id).Warn("container is using the host network, port bindings will not be enforced")
+
+	if e.endpoint != "" {
+		log.WithField("environment_id", e.Id).WithField("endpoint", e.endpoint).Debug("skipping host port check for container on remote docker endpoint")
+		return nil
+	}
+
+	for ip, ports := range e.Configuration.Allocations().Mappings {
+		ip = environment.NormalizeIp(ip)
+
+		for _, port := range ports {
+			if port < 1 || port > 65535 {
+				continue
+			}
+
+			addr := net.JoinHostPort(ip, strconv.Itoa(port))
+
+			l, err := net.Listen("tcp", addr)
+			if err != nil {
+				return errors.Wrap(err, fmt.Sprintf("environment/docker: allocation %s is already in use on the host", addr))
+			}
+			l.Close()
+
+			pc, err := net.ListenPacket("udp", addr)
+			if err != nil {
+				return errors.Wrap(err, fmt.Sprintf("environment/docker: allocation %s is already in use on the host", addr))
+			}
+			pc.Close()
+		}
+	}
+
+	return nil
+}
+
+// Connects the container to any additional user-defined networks configured for the server
+// that are allowed by the node. If an allowed network does not exist yet it will be created.
+func (e *Environment) connectNetworks(id string) error {
+	if e.networkMode().IsHost() {
+		return nil
+	}
+
+	for _, n := range e.Configuration.Container().Networks {
+		if n == config.Get().Docker.Network.Name {
+			continue
+		}
+
+		if !environment.IsNetworkAllowed(n) {
+			log.WithField("environment_id", e.Id).WithField("network", n).
+				Warn("skipping network for container, network is not in the node allowlist")
+			continue
+		}
+
+		if _, err := e.client.NetworkInspect(context.Background(), n, types.NetworkInspectOptions{}); err != nil {
+			if !client.IsErrNotFound(err) {
+				return errors.WithStack(err)
+			}
+
+			log.WithField("network", n).Info("creating missing user-defined docker network")
+			_, err := e.client.NetworkCreate(context.Background(), n, types.NetworkCreate{
+				CheckDuplicate: true,
+				Driver:         "bridge",
+				Labels:         map[string]string{"Service": "Pterodactyl"},
+			})
+
+			if err != nil {
+				return errors.Wrap(err, "failed to create user-defined docker network")
+			}
+		}
+
+		if err := e.client.NetworkConnect(context.Background(), n, id, nil); err != nil {
+			return errors.Wrap(err, "failed to connect container to user-defined docker network")
+		}
+	}
+
 	return nil
 }
 
+// Returns the device mappings for the container, skipping any devices that are not allowed
+// by the node configuration.
+func (e *Environment) devices() []container.DeviceMapping {
+	var out []container.DeviceMapping
+
+	for _, d := range e.Configuration.Container().Devices {
+		if !environment.IsDeviceAllowed(d.PathOnHost) {
+			log.WithField("environment_id", e.Id).WithField("device", d.PathOnHost).
+				Warn("skipping device mapping for container, device is not in the node allowlist")
+			continue
+		}
+
+		m := container.DeviceMapping{
+			PathOnHost:        d.PathOnHost,
+			PathInContainer:   d.PathInContainer,
+			CgroupPermissions: d.Permissions,
+		}
+
+		if m.PathInContainer == "" {
+			m.PathInContainer = m.PathOnHost
+		}
+
+		if m.CgroupPermissions == "" {
+			m.CgroupPermissions = "rwm"
+		}
+
+		out = append(out, m)
+	}
+
+	return out
+}
+
+// Returns the DNS servers, search domains and extra hosts entries for the container. Any
+// invalid entries configured for the server are skipped.
+func (e *Environment) dns() ([]string, []string, []string) {
+	cs := e.Configuration.Container()
+
+	var servers []string
+	for _, d := range cs.Dns {
+		if net.ParseIP(d) == nil {
+			log.WithField("environment_id", e.Id).WithField("dns", d).Warn("skipping dns server for container, address is not valid")
+			continue
+		}
+
+		servers = append(servers, d)
+	}
+
+	if len(servers) == 0 {
+		servers = config.Get().Docker.Network.Dns
+	}
+
+	var hosts []string
+	for _, h := range cs.ExtraHosts {
+		if !environment.IsValidExtraHost(h) {
+			log.WithField("environment_id", e.Id).WithField("host", h).Warn("skipping extra host for container, entry is not valid")
+			continue
+		}
+
+		hosts = append(hosts, h)
+	}
+
+	return servers, cs.DnsSearch, hosts
+}
+
+// Returns the labels for the container. Labels defined for the server take priority over those
+// defined for the node, but neither may replace the labels used by the daemon to identify the
+// containers it manages.
+func (e *Environment) labels() map[string]string {
+	out := make(map[string]string)
+	for k, v := range config.Get().Docker.Labels {
+		out[k] = v
+	}
+
+	for k, v := range e.Configuration.Container().Labels {
+		out[k] = v
+	}
+
+	out["Service"] = "Pterodactyl"
+	out["ContainerType"] = "server_process"
+
+	return out
+}
+
+// Returns the user that the server process runs as inside of the container. When servers are
+// given their own user the process runs as that user and group rather than the system user.
+func (e *Environment) containerUser() string {
+	if !config.Get().System.PerServerUsers.Enabled {
+		return config.Get().System.ContainerUser()
+	}
+
+	return config.Get().System.ContainerUserFor(e.Configuration.User())
+}
+
+// Returns the logging configuration for the container. Ensure that we don't use too much space
+// on the host machine by default since we only need the log for the last few hundred lines of
+// output and don't care about anything else in it.
+func (e *Environment) logConfig() container.LogConfig {
+	cfg := config.Get().Docker.LogConfig
+
+	switch cfg.Type {
+	case jsonfilelog.Name, "local", "journald":
+	default:
+		log.WithField("driver", cfg.Type).Warn("unsupported docker log driver configured, using json-file instead")
+
+		cfg.Type = jsonfilelog.Name
+		cfg.Config = nil
+	}
+
+	if len(cfg.Config) == 0 && cfg.Type != "journald" {
+		cfg.Config = map[string]string{
+			"max-size": "5m",
+			"max-file": "1",
+		}
+	}
+
+	return container.LogConfig{Type: cfg.Type, Config: cfg.Config}
+}
+
+// Returns the image pull policy for the environment, preferring the policy configured for the
+// server over the node default.
+func (e *Environment) pullPolicy() string {
+	for _, p := range []string{e.Configuration.Container().PullPolicy, config.Get().Docker.PullPolicy} {
+		switch p {
+		case config.PullPolicyAlways, config.PullPolicyIfNotPresent, config.PullPolicyNever:
+			return p
+		}
+	}
+
+	return config.PullPolicyAlways
+}
+
+// Returns the restart policy for the container as configured for the server. Unknown
+// policies are treated as not having a restart policy at all.
+func (e *Environment) restartPolicy() container.RestartPolicy {
+	cs := e.Configuration.Container()
+
+	switch cs.RestartPolicy {
+	case "on-failure":
+		return container.RestartPolicy{Name: cs.RestartPolicy, MaximumRetryCount: cs.RestartRetries}
+	case "unless-stopped", "always":
+		return container.RestartPolicy{Name: cs.RestartPolicy}
+	}
+
+	return container.RestartPolicy{Name: "no"}
+}
+
+// Removes the restart policy from a container so that Docker does not bring it back up once
+// it has been intentionally stopped. The policy is restored when the container is recreated
+// the next time the server is started.
+func (e *Environment) disableRestartPolicy() {
+	if p := e.restartPolicy(); p.IsNone() {
+		return
+	}
+
+	u := container.UpdateConfig{RestartPolicy: container.RestartPolicy{Name: "no"}}
+	if _, err := e.client.ContainerUpdate(context.Background(), e.Id, u); err != nil && !client.IsErrNotFound(err) {
+		log.WithField("environment_id", e.Id).WithField("error", errors.WithStack(err)).Warn("failed to remove restart policy from container")
+	}
+}
+
+// Waits for Docker to finish restarting the container if it is currently being restarted
+// due to its restart policy. It is not possible to attach to a container in this state.
+func (e *Environment) awaitRestart() error {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*30)
+	defer cancel()
+
+	for {
+		c, err := e.client.ContainerInspect(ctx, e.Id)
+		if err != nil {
+			if client.IsErrNotFound(err) {
+				return nil
+			}
+
+			return errors.WithStack(err)
+		}
+
+		if !c.State.Restarting {
+			return nil
+		}
+
+		select {
+		case <-ctx.Done():
+			return errors.Wrap(ctx.Err(), "environment/docker: timed out waiting for container to restart")
+		case <-time.After(time.Second):
+		}
+	}
+}
+
+// Returns the size of /dev/shm for the container in bytes, capped at the maximum size allowed
+// by the node configuration. Returns zero if the Docker default should be used.
+func (e *Environment) shmSize() int64 {
+	size := e.Configuration.Container().ShmSize
+	if max := config.Get().Docker.ShmMaxSize; size > max {
+		log.WithField("environment_id", e.Id).WithField("shm_size", size).
+			Warn("reducing shm size for container to the node limit")
+		size = max
+	}
+
+	return int64(size) * 1_000_000
+}
+
+// Returns the OOM score adjustment for the container, bounded by the minimum defined in the
+// node configuration and the range accepted by the kernel.
+func (e *Environment) oomScoreAdj() int {
+	adj := e.Configuration.Limits().OomScoreAdj
+	if min := config.Get().Docker.MinOomScoreAdj; adj < min {
+		adj = min
+	}
+
+	if adj < -1000 {
+		return -1000
+	} else if adj > 1000 {
+		return 1000
+	}
+
+	return adj
+}
+
+// Returns the ulimits that should be applied to the container.
+func (e *Environment) ulimits() []*units.Ulimit {
+	var out []*units.Ulimit
+
+	for _, u := range e.Configuration.Container().Ulimits {
+		if !u.Valid() {
+			log.WithField("environment_id", e.Id).WithField("ulimit", u.Name).
+				Warn("skipping ulimit for container, ulimit is not valid")
+			continue
+		}
+
+		out = append(out, &units.Ulimit{Name: u.Name, Soft: u.Soft, Hard: u.Hard})
+	}
+
+	return out
+}
+
+// Returns the capabilities that should be added to and dropped from the container. A number
+// of capabilities are dropped by default, but those requested by the server and allowed by
+// the node configuration are added back.
+func (e *Environment) capabilities() ([]string, []string) {
+	var add []string
+	added := make(map[string]bool)
+	for _, c := range e.Configuration.Container().CapAdd {
+		c = environment.NormalizeCapability(c)
+		if !environment.IsCapabilityAllowed(c) {
+			log.WithField("environment_id", e.Id).WithField("capability", c).
+				Warn("skipping capability for container, capability is not in the node allowlist")
+			continue
+		}
+
+		if !added[c] {
+			added[c] = true
+			add = append(add, c)
+		}
+	}
+
+	var drop []string
+	dropped := make(map[string]bool)
+	for _, c := range append(defaultCapDrop, e.Configuration.Container().CapDrop...) {
+		c = environment.NormalizeCapability(c)
+		if c == "" || added[c] || dropped[c] {
+			continue
+		}
+
+		dropped[c] = true
+		drop = append(drop, c)
+	}
+
+	return add, drop
+}
+
+// Returns the security options for the container, applying the seccomp and AppArmor profiles
+// configured for the server or falling back to those defined for the node.
+func (e *Environment) securityOpts() ([]string, error) {
+	cfg := config.Get().Docker.Security
+	opts := []string{"no-new-privileges"}
+
+	seccomp, apparmor := e.Configuration.Container().SeccompProfile, e.Configuration.Container().AppArmorProfile
+	if (seccomp == "unconfined" || apparmor == "unconfined") && !cfg.AllowUnconfined {
+		return nil, errors.New("environment/docker: unconfined security profiles are not allowed on this node")
+	}
+
+	var p string
+	switch {
+	case seccomp == "unconfined":
+		opts = append(opts, "seccomp=unconfined")
+	case seccomp != "":
+		if !securityProfileRegex.MatchString(seccomp) {
+			return nil, errors.New(fmt.Sprintf("environment/docker: invalid seccomp profile name \"%s\"", seccomp))
+		}
+		p = filepath.Join(cfg.ProfileDirectory, seccomp+".json")
+	default:
+		p = cfg.SeccompProfile
+	}
+
+	// Docker expects the contents of the seccomp profile to be passed through rather than the
+	// path to it, so read the profile from the disk.
+	if p != "" {
+		b, err := ioutil.ReadFile(p)
+		if err != nil {
+			return nil, errors.Wrap(err, "environment/docker: failed to read seccomp profile")
+		}
+
+		opts = append(opts, "seccomp="+string(b))
+	}
+
+	if apparmor == "" {
+		apparmor = cfg.AppArmorProfile
+	}
+
+	if apparmor != "" {
+		opts = append(opts, "apparmor="+apparmor)
+	}
+
+	return opts, nil
+}
+
+// Returns the tmpfs mounts for the container. The /tmp folder is always mounted since some
+// games need to make use of it for downloads and other installation processes. Any additional
+// mounts configured for the server are added so long as their combined size does not exceed
+// the cap defined in the node configuration.
+func (e *Environment) tmpfs() map[string]string {
+	cfg := config.Get().Docker
+	out := map[string]string{
+		"/tmp": "rw,exec,nosuid,size=" + strconv.Itoa(int(cfg.TmpfsSize)) + "M",
+	}
+
+	mounts := make(map[string]bool)
+	for _, m := range e.Configuration.Mounts() {
+		mounts[m.Target] = true
+	}
+
+	var total uint
+	for _, t := range e.Configuration.Container().Tmpfs {
+		l := log.WithField("environment_id", e.Id).WithField("path", t.Path)
+
+		if !filepath.IsAbs(t.Path) || filepath.Clean(t.Path) != t.Path || t.Path == "/" || mounts[t.Path] {
+			l.Warn("skipping tmpfs mount for container, path is not valid")
+			continue
+		}
+
+		size := t.Size
+		if size == 0 {
+			size = cfg.TmpfsSize
+		}
+
+		// A server may resize the default /tmp mount, in which case that size counts towards
+		// the limit in place of the default.
+		if total+size > cfg.TmpfsMaxSize {
+			l.WithField("size", size).Warn("skipping tmpfs mount for container, size exceeds the node limit")
+			continue
+		}
+
+		total += size
+		out[t.Path] = "rw,exec,nosuid,size=" + strconv.Itoa(int(size)) + "M"
+	}
+
+	return out
+}
+
 func (e *Environment) convertMounts() []mount.Mount {
 	var out []mount.Mount
 
@@ -247,6 +768,10 @@ func (e *Environment) Destroy() error {
 	// We set it to stopping than offline to prevent crash detection from being triggered.
 	e.setState(environment.ProcessStoppingState)
 
+	if err := e.removeSidecars(); err != nil {
+		return err
+	}
+
 	err := e.client.ContainerRemove(context.Background(), e.Id, types.ContainerRemoveOptions{
 		RemoveVolumes: true,
 		RemoveLinks:   false,
@@ -266,6 +791,23 @@ func (e *Environment) Destroy() error {
 	return err
 }
 
+// Removes the container for the server and creates it again using the current configuration,
+// such as after the allocations for the server have changed. The server files are stored on
+// the host so they are not affected. This must only be called while the server is stopped.
+func (e *Environment) Recreate() error {
+	if err := e.removeSidecars(); err != nil {
+		return err
+	}
+
+	if err := e.client.ContainerRemove(context.Background(), e.Id, types.ContainerRemoveOptions{RemoveVolumes: true, Force: true}); err != nil {
+		if !client.IsErrNotFound(err) {
+			return errors.Wrap(err, "environment/docker: failed to remove container")
+		}
+	}
+
+	return e.Create()
+}
+
 // Attaches to the log for the container. This avoids us missing crucial output that
 // happens in the split seconds before the code moves from 'Starting' to 'Attaching'
 // on the process.
@@ -349,7 +891,7 @@ func (e *Environment) followOutput() error {
 // need to block all of the servers from booting just because of that. I'd imagine in a lot of
 // cases an outage shouldn't affect users too badly. It'll at least keep existing servers working
 // correctly if anything.
-func (e *Environment) ensureImageExists(image string) error {
+func (e *Environment) ensureImageExists(ctx context.Context, image string) error {
 	e.Events().Publish(environment.DockerImagePullStarted, "")
 	defer e.Events().Publish(environment.DockerImagePullCompleted, "")
 
@@ -358,27 +900,33 @@ func (e *Environment) ensureImageExists(image string) error {
 		return nil
 	}
 
+	policy := e.pullPolicy()
+	if policy != config.PullPolicyAlways {
+		if _, _, err := e.client.ImageInspectWithRaw(context.Background(), image); err == nil {
+			return nil
+		} else if !client.IsErrNotFound(err) {
+			return errors.WithStack(err)
+		}
+
+		if policy == config.PullPolicyNever {
+			return errors.New(fmt.Sprintf("environment/docker: image %s does not exist locally and the pull policy is \"never\"", image))
+		}
+	}
+
 	// Give it up to 15 minutes to pull the image. I think this should cover 99.8% of cases where an
 	// image pull might fail. I can't imagine it will ever take more than 15 minutes to fully pull
 	// an image. Let me know when I am inevitably wrong here...
-	ctx, cancel := context.WithTimeout(context.Background(), time.Minute*15)
+	ctx, cancel := context.WithTimeout(ctx, environment.ImagePullTimeout)
 	defer cancel()
 
-	// Get a registry auth configuration from the config.
-	var registryAuth *config.RegistryConfiguration
-	for registry, c := range config.Get().Docker.Registries {
-		if !strings.HasPrefix(image, registry) {
-			continue
-		}
-
-		log.WithField("registry", registry).Debug("using authentication for registry")
-		registryAuth = &c
-		break
-	}
+	// Get a registry auth configuration from the server settings or node configuration.
+	registryAuth := config.Get().Docker.RegistryAuthFor(image, e.Configuration.Container().RegistryAuth)
 
 	// Get the ImagePullOptions.
 	imagePullOptions := types.ImagePullOptions{All: false}
 	if registryAuth != nil {
+		log.WithField("image", image).Debug("using authentication for registry")
+
 		b64, err := registryAuth.Base64()
 		if err != nil {
 			log.WithError(err).Error("failed to get registry auth credentials")
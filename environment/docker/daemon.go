@@ -0,0 +1,71 @@
+package docker
+
+import (
+	"context"
+	"github.com/apex/log"
+	"github.com/avatag-host/claws/environment"
+	"time"
+)
+
+// The maximum amount of time to wait between each check for the Docker daemon returning.
+const maxDaemonBackoff = time.Second * 30
+
+// Determines if the Docker daemon for the environment is responding.
+func (e *Environment) daemonAvailable() bool {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*5)
+	defer cancel()
+
+	_, err := e.client.Ping(ctx)
+
+	return err == nil
+}
+
+// Blocks until the Docker daemon for the environment is responding again, checking less often
+// the longer it is unavailable.
+func (e *Environment) awaitDaemon() {
+	backoff := time.Second
+	for !e.daemonAvailable() {
+		time.Sleep(backoff)
+		if backoff < maxDaemonBackoff {
+			backoff *= 2
+		}
+	}
+}
+
+// Called when the attached stream for a running container closes. If the stream closed because
+// the Docker daemon was restarted, rather than because the container stopped, this waits for the
+// daemon to return and attaches to the container again so that the server is not marked as
+// offline. Returns true if the environment was attached again.
+func (e *Environment) recoverFromDaemonRestart() bool {
+	// The container was stopped by Wings, or the daemon is still running and so the container
+	// has really stopped.
+	if st := e.State(); st == environment.ProcessOfflineState || st == environment.ProcessStoppingState {
+		return false
+	}
+
+	if e.daemonAvailable() {
+		return false
+	}
+
+	l := log.WithField("environment_id", e.Id)
+	l.Warn("lost connection to docker daemon, waiting for it to become available again")
+
+	e.awaitDaemon()
+
+	// Containers are only still running after the daemon restarts if it has live-restore
+	// enabled, otherwise the container stopped along with the daemon.
+	if running, err := e.IsRunning(); err != nil || !running {
+		l.Info("docker daemon is available again but the server container is no longer running")
+		return false
+	}
+
+	e.SetStream(nil)
+	if err := e.Attach(); err != nil {
+		l.WithField("error", err).Error("failed to attach to server container after docker daemon became available")
+		return false
+	}
+
+	l.Info("attached to server container after docker daemon became available again")
+
+	return true
+}
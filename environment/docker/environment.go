@@ -6,10 +6,14 @@ import (
 	"github.com/docker/docker/client"
 	"github.com/pkg/errors"
 	"github.com/avatag-host/claws/api"
+	"github.com/avatag-host/claws/config"
 	"github.com/avatag-host/claws/environment"
 	"github.com/avatag-host/claws/events"
 	"io"
+	"net"
+	"strconv"
 	"sync"
+	"time"
 )
 
 type Metadata struct {
@@ -34,8 +38,10 @@ type Environment struct {
 
 	meta *Metadata
 
-	// The Docker client being used for this instance.
-	client *client.Client
+	// The Docker client being used for this instance, and the name of the endpoint it is
+	// connected to.
+	client   *client.Client
+	endpoint string
 
 	// Controls the hijacked response stream which exists only when we're attached to
 	// the running container instance.
@@ -55,7 +61,9 @@ type Environment struct {
 // reference the container from here on out. This should be unique per-server (we use the UUID
 // by default). The container does not need to exist at this point.
 func New(id string, m *Metadata, c *environment.Configuration) (*Environment, error) {
-	cli, err := environment.DockerClient()
+	endpoint := c.Container().DockerEndpoint
+
+	cli, err := environment.DockerClientFor(endpoint)
 	if err != nil {
 		return nil, err
 	}
@@ -65,6 +73,7 @@ func New(id string, m *Metadata, c *environment.Configuration) (*Environment, er
 		Configuration: c,
 		meta:          m,
 		client:        cli,
+		endpoint:      endpoint,
 		st:            environment.ProcessOfflineState,
 	}
 
@@ -183,3 +192,78 @@ func (e *Environment) SetImage(i string) {
 	e.meta.Image = i
 	e.mu.Unlock()
 }
+
+// Returns the processes running within the container as reported by Docker.
+func (e *Environment) Processes() (*environment.ProcessList, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*10)
+	defer cancel()
+
+	top, err := e.client.ContainerTop(ctx, e.Id, []string{})
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+
+	return &environment.ProcessList{Titles: top.Titles, Processes: top.Processes}, nil
+}
+
+// Returns the address of the container itself for the given port. Connections to the host
+// ports for the server are accepted by the Docker proxy whether or not anything is listening
+// in the container, so the container must be reached on its own network address instead.
+func (e *Environment) DirectAddress(port int) (string, error) {
+	if e.networkMode().IsHost() {
+		a := e.Configuration.Allocations()
+
+		return a.LocalAddress(port), nil
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*10)
+	defer cancel()
+
+	c, err := e.client.ContainerInspect(ctx, e.Id)
+	if err != nil {
+		return "", errors.WithStack(err)
+	}
+
+	if c.NetworkSettings == nil {
+		return "", errors.New("environment/docker: container has no network settings")
+	}
+
+	ip := c.NetworkSettings.IPAddress
+	if n, ok := c.NetworkSettings.Networks[config.Get().Docker.Network.Name]; ok && n.IPAddress != "" {
+		ip = n.IPAddress
+	}
+
+	if ip == "" {
+		return "", errors.New("environment/docker: container does not have an IP address")
+	}
+
+	return net.JoinHostPort(ip, strconv.Itoa(port)), nil
+}
+
+// Moves the environment to the Docker endpoint currently configured for it if that has changed
+// since the environment was created. Any containers left on the previous endpoint are removed.
+// This must only be called while the environment is offline.
+func (e *Environment) switchEndpoint() error {
+	endpoint := e.Configuration.Container().DockerEndpoint
+	if endpoint == e.endpoint {
+		return nil
+	}
+
+	cli, err := environment.DockerClientFor(endpoint)
+	if err != nil {
+		return err
+	}
+
+	if err := e.removeSidecars(); err != nil {
+		return err
+	}
+
+	if err := e.client.ContainerRemove(context.Background(), e.Id, types.ContainerRemoveOptions{RemoveVolumes: true, Force: true}); err != nil && !client.IsErrNotFound(err) {
+		return errors.Wrap(err, "environment/docker: failed to remove container from previous endpoint")
+	}
+
+	e.client = cli
+	e.endpoint = endpoint
+
+	return nil
+}
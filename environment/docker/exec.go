@@ -0,0 +1,96 @@
+package docker
+
+import (
+	"context"
+	"github.com/docker/docker/api/types"
+	"github.com/docker/docker/pkg/stdcopy"
+	"github.com/pkg/errors"
+	"github.com/apex/log"
+	"github.com/avatag-host/claws/environment"
+	"os"
+	"time"
+)
+
+// Runs a one-off command within the running container using Docker exec. This does not use a
+// TTY and does not interact with the stdin of the server process in any way. If the context
+// is cancelled before the command completes it is killed.
+func (e *Environment) Exec(ctx context.Context, cmd []string, limit int) (*environment.ExecResult, error) {
+	if len(cmd) == 0 {
+		return nil, errors.New("environment/docker: no command provided to exec")
+	}
+
+	exec, err := e.client.ContainerExecCreate(ctx, e.Id, types.ExecConfig{
+		AttachStdout: true,
+		AttachStderr: true,
+		Cmd:          cmd,
+	})
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+
+	resp, err := e.client.ContainerExecAttach(ctx, exec.ID, types.ExecStartCheck{})
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+	defer resp.Close()
+
+	stdout := environment.NewLimitedBuffer(limit)
+	stderr := environment.NewLimitedBuffer(limit)
+
+	done := make(chan error, 1)
+	go func() {
+		_, err := stdcopy.StdCopy(stdout, stderr, resp.Reader)
+		done <- err
+	}()
+
+	select {
+	case <-ctx.Done():
+		e.killExec(exec.ID)
+
+		return nil, errors.WithStack(ctx.Err())
+	case err := <-done:
+		if err != nil {
+			return nil, errors.WithStack(err)
+		}
+	}
+
+	inspect, err := e.client.ContainerExecInspect(ctx, exec.ID)
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+
+	return &environment.ExecResult{
+		ExitCode:  inspect.ExitCode,
+		Stdout:    stdout.String(),
+		Stderr:    stderr.String(),
+		Truncated: stdout.Truncated() || stderr.Truncated(),
+	}, nil
+}
+
+// Kills the process started for an exec that is still running. Docker provides no way to do
+// this through its API, so the process is killed directly using its PID on the host, which is
+// only possible when the container is running on the local Docker daemon.
+func (e *Environment) killExec(id string) {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*10)
+	defer cancel()
+
+	inspect, err := e.client.ContainerExecInspect(ctx, id)
+	if err != nil || !inspect.Running || inspect.Pid <= 0 {
+		return
+	}
+
+	l := log.WithField("environment_id", e.Id).WithField("exec_id", id)
+	if e.endpoint != "" {
+		l.Warn("unable to kill exec process on remote docker endpoint, leaving it to finish on its own")
+		return
+	}
+
+	p, err := os.FindProcess(inspect.Pid)
+	if err == nil {
+		err = p.Kill()
+	}
+
+	if err != nil {
+		l.WithField("error", err).Warn("failed to kill exec process")
+	}
+}
@@ -21,9 +21,18 @@ import (
 // This process will also confirm that the server environment exists and is in a bootable
 // state. This ensures that unexpected container deletion while Wings is running does
 // not result in the server becoming unbootable.
-func (e *Environment) OnBeforeStart() error {
+func (e *Environment) OnBeforeStart(ctx context.Context) error {
+	if err := e.switchEndpoint(); err != nil {
+		return err
+	}
+
 	// Always destroy and re-create the server container to ensure that synced data from
-	// the Panel is usee.
+	// the Panel is usee. Sidecars are removed first since they may depend on the network of
+	// the server container.
+	if err := e.removeSidecars(); err != nil {
+		return errors.Wrap(err, "failed to remove sidecar containers during pre-boot")
+	}
+
 	if err := e.client.ContainerRemove(context.Background(), e.Id, types.ContainerRemoveOptions{RemoveVolumes: true}); err != nil {
 		if !client.IsErrNotFound(err) {
 			return errors.Wrap(err, "failed to remove server docker container during pre-boot")
@@ -37,7 +46,7 @@ func (e *Environment) OnBeforeStart() error {
 	// This won't actually run an installation process however, it is just here to ensure the
 	// environment gets created properly if it is missing and the server is started. We're making
 	// an assumption that all of the files will still exist at this point.
-	if err := e.Create(); err != nil {
+	if err := e.create(ctx); err != nil {
 		return err
 	}
 
@@ -47,7 +56,7 @@ func (e *Environment) OnBeforeStart() error {
 // Starts the server environment and begins piping output to the event listeners for the
 // console. If a container does not exist, or needs to be rebuilt that will happen in the
 // call to OnBeforeStart().
-func (e *Environment) Start() error {
+func (e *Environment) Start(ctx context.Context) error {
 	sawError := false
 	// If sawError is set to true there was an error somewhere in the pipeline that
 	// got passed up, but we also want to ensure we set the server to be offline at
@@ -72,8 +81,10 @@ func (e *Environment) Start() error {
 			return errors.WithStack(err)
 		}
 	} else {
-		// If the server is running update our internal state and continue on with the attach.
-		if c.State.Running {
+		// If the server is running update our internal state and continue on with the attach. This
+		// also covers a container that Docker is restarting due to its restart policy, in which case
+		// the attach will wait for that restart to complete rather than starting it a second time.
+		if c.State.Running || c.State.Restarting {
 			e.setState(environment.ProcessRunningState)
 
 			return e.Attach()
@@ -98,20 +109,22 @@ func (e *Environment) Start() error {
 	// Run the before start function and wait for it to finish. This will validate that the container
 	// exists on the system, and rebuild the container if that is required for server booting to
 	// occur.
-	if err := e.OnBeforeStart(); err != nil {
+	if err := e.OnBeforeStart(ctx); err != nil {
 		return errors.WithStack(err)
 	}
 
-	ctx, cancel := context.WithTimeout(context.Background(), time.Second*10)
+	sctx, cancel := context.WithTimeout(ctx, time.Second*10)
 	defer cancel()
 
-	if err := e.client.ContainerStart(ctx, e.Id, types.ContainerStartOptions{}); err != nil {
+	if err := e.client.ContainerStart(sctx, e.Id, types.ContainerStartOptions{}); err != nil {
 		return errors.WithStack(err)
 	}
 
 	// No errors, good to continue through.
 	sawError = false
 
+	e.startSidecars()
+
 	return e.Attach()
 }
 
@@ -140,6 +153,10 @@ func (e *Environment) Stop() error {
 		e.setState(environment.ProcessStoppingState)
 	}
 
+	// Docker does not know that a process exiting after the stop command was sent is expected,
+	// so make sure it won't try to restart the container once it stops.
+	e.disableRestartPolicy()
+
 	// Only attempt to send the stop command to the instance if we are actually attached to
 	// the instance. If we are not for some reason, just send the container stop event.
 	if e.IsAttached() && s.Type == api.ProcessStopCommand {
@@ -227,6 +244,7 @@ func (e *Environment) Terminate(signal os.Signal) error {
 
 	// We set it to stopping than offline to prevent crash detection from being triggered.
 	e.setState(environment.ProcessStoppingState)
+	e.disableRestartPolicy()
 
 	sig := strings.TrimSuffix(strings.TrimPrefix(signal.String(), "signal "), "ed")
 
@@ -238,3 +256,46 @@ func (e *Environment) Terminate(signal os.Signal) error {
 
 	return nil
 }
+
+// Pauses the server container, freezing all of the processes within it. The container keeps
+// running as far as Docker is concerned, so the state of the environment is not changed.
+func (e *Environment) Pause() error {
+	c, err := e.client.ContainerInspect(context.Background(), e.Id)
+	if err != nil {
+		return errors.WithStack(err)
+	}
+
+	if !c.State.Running {
+		return errors.New("environment/docker: cannot pause a container that is not running")
+	}
+
+	if c.State.Paused {
+		return nil
+	}
+
+	return errors.WithStack(e.client.ContainerPause(context.Background(), e.Id))
+}
+
+// Resumes the processes within a paused server container.
+func (e *Environment) Unpause() error {
+	c, err := e.client.ContainerInspect(context.Background(), e.Id)
+	if err != nil {
+		return errors.WithStack(err)
+	}
+
+	if !c.State.Paused {
+		return nil
+	}
+
+	return errors.WithStack(e.client.ContainerUnpause(context.Background(), e.Id))
+}
+
+// Determines if the server container is currently paused.
+func (e *Environment) IsPaused() (bool, error) {
+	c, err := e.client.ContainerInspect(context.Background(), e.Id)
+	if err != nil {
+		return false, err
+	}
+
+	return c.State.Paused, nil
+}
@@ -0,0 +1,61 @@
+package docker
+
+import (
+	"context"
+	"github.com/avatag-host/claws/environment"
+	"github.com/docker/docker/client"
+	"github.com/pkg/errors"
+)
+
+// Brings the environment in line with a container that was started outside of Wings. If attach
+// is true the environment is marked as running and attached to the container, otherwise the
+// container is killed. Nothing is done if Wings is already tracking the container.
+func (e *Environment) ReconcileStarted(attach bool) error {
+	if e.State() != environment.ProcessOfflineState || e.IsAttached() {
+		return nil
+	}
+
+	if !attach {
+		// Remove the restart policy first so that Docker does not start the container again.
+		e.disableRestartPolicy()
+
+		if err := e.client.ContainerKill(context.Background(), e.Id, "SIGKILL"); err != nil && !client.IsErrNotFound(err) {
+			return errors.Wrap(err, "environment/docker: failed to kill externally started container")
+		}
+
+		return nil
+	}
+
+	e.setState(environment.ProcessRunningState)
+	if err := e.Attach(); err != nil {
+		e.setState(environment.ProcessOfflineState)
+
+		return errors.Wrap(err, "environment/docker: failed to attach to externally started container")
+	}
+
+	return nil
+}
+
+// Marks the environment as offline if the container stopped while Wings was not attached to
+// it. When Wings is attached the state is already updated once the attached stream closes.
+func (e *Environment) ReconcileStopped() {
+	if e.State() == environment.ProcessOfflineState || e.IsAttached() {
+		return
+	}
+
+	e.setState(environment.ProcessOfflineState)
+}
+
+// Creates the container again if it was removed outside of Wings while the server was offline,
+// so that it exists for anything expecting it before the next time the server is started.
+func (e *Environment) ReconcileRemoved() error {
+	if e.State() != environment.ProcessOfflineState {
+		return nil
+	}
+
+	if exists, err := e.Exists(); err != nil || exists {
+		return err
+	}
+
+	return e.Create()
+}
@@ -0,0 +1,188 @@
+package docker
+
+import (
+	"context"
+	"github.com/apex/log"
+	"github.com/docker/docker/api/types"
+	"github.com/docker/docker/api/types/container"
+	"github.com/docker/docker/api/types/filters"
+	"github.com/docker/docker/api/types/mount"
+	"github.com/docker/docker/client"
+	"github.com/pkg/errors"
+	"github.com/avatag-host/claws/config"
+	"github.com/avatag-host/claws/environment"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Returns the name of the container used for a sidecar of this environment. Sidecar names are
+// prefixed so that they can never collide with other containers created for the server, such
+// as the "<uuid>_installer" container used when running the installation script.
+func (e *Environment) sidecarContainerName(name string) string {
+	return e.Id + "_sidecar_" + name
+}
+
+// Returns the sidecars configured for the environment that are valid and within the limits
+// defined in the node configuration.
+func (e *Environment) sidecars() []environment.Sidecar {
+	var out []environment.Sidecar
+
+	for _, s := range e.Configuration.Container().Sidecars {
+		if !s.Valid() {
+			log.WithField("environment_id", e.Id).WithField("sidecar", s.Name).Warn("skipping sidecar for container, definition is not valid")
+			continue
+		}
+
+		if len(out) >= config.Get().Docker.Sidecars.Max {
+			log.WithField("environment_id", e.Id).WithField("sidecar", s.Name).Warn("skipping sidecar for container, node sidecar limit reached")
+			continue
+		}
+
+		out = append(out, s)
+	}
+
+	return out
+}
+
+// Creates the containers for all of the sidecars configured for the environment. This must be
+// called after the server container has been created since sidecars may share its network.
+func (e *Environment) createSidecars(ctx context.Context) error {
+	for _, s := range e.sidecars() {
+		if err := e.createSidecar(ctx, s); err != nil {
+			return errors.WithMessage(err, "failed to create sidecar "+s.Name)
+		}
+	}
+
+	return nil
+}
+
+func (e *Environment) createSidecar(ctx context.Context, s environment.Sidecar) error {
+	if err := e.ensureImageExists(ctx, s.Image); err != nil {
+		return err
+	}
+
+	cfg := config.Get().Docker.Sidecars
+
+	memory := s.MemoryLimit
+	if memory <= 0 || memory > cfg.Memory {
+		memory = cfg.Memory
+	}
+
+	cpu := s.CpuLimit
+	if cpu <= 0 {
+		cpu = cfg.Cpu
+	}
+
+	labels := e.labels()
+	labels["ContainerType"] = "server_sidecar"
+
+	conf := &container.Config{
+		User:   e.containerUser(),
+		Image:  s.Image,
+		Cmd:    s.Command,
+		Env:    s.Environment,
+		Labels: labels,
+	}
+
+	hostConf := &container.HostConfig{
+		Resources: container.Resources{
+			Memory:    memory * 1_000_000,
+			CPUQuota:  cpu * 1000,
+			CPUPeriod: 100_000,
+		},
+		Tmpfs: map[string]string{
+			"/tmp": "rw,exec,nosuid,size=" + strconv.Itoa(int(config.Get().Docker.TmpfsSize)) + "M",
+		},
+		LogConfig:      e.logConfig(),
+		SecurityOpt:    []string{"no-new-privileges"},
+		CapDrop:        defaultCapDrop,
+		ReadonlyRootfs: true,
+		NetworkMode:    container.NetworkMode(config.Get().Docker.Network.Mode),
+	}
+
+	if s.Network == environment.SidecarNetworkShared {
+		hostConf.NetworkMode = container.NetworkMode("container:" + e.Id)
+	} else {
+		hostConf.DNS = config.Get().Docker.Network.Dns
+	}
+
+	if s.MountData {
+		for _, m := range e.Configuration.Mounts() {
+			if m.Default {
+				hostConf.Mounts = append(hostConf.Mounts, mount.Mount{
+					Type:     mount.TypeBind,
+					Source:   m.Source,
+					Target:   m.Target,
+					ReadOnly: true,
+				})
+			}
+		}
+	}
+
+	_, err := e.client.ContainerCreate(context.Background(), conf, hostConf, nil, e.sidecarContainerName(s.Name))
+
+	return errors.WithStack(err)
+}
+
+// Starts all of the sidecar containers for the environment. A sidecar failing to start does
+// not prevent the server itself from running.
+func (e *Environment) startSidecars() {
+	for _, s := range e.sidecars() {
+		if err := e.client.ContainerStart(context.Background(), e.sidecarContainerName(s.Name), types.ContainerStartOptions{}); err != nil {
+			log.WithField("environment_id", e.Id).WithField("sidecar", s.Name).WithField("error", errors.WithStack(err)).Warn("failed to start sidecar container")
+		}
+	}
+}
+
+// Stops all of the sidecar containers for the environment.
+func (e *Environment) stopSidecars() {
+	t := time.Second * 10
+
+	for _, s := range e.sidecars() {
+		if err := e.client.ContainerStop(context.Background(), e.sidecarContainerName(s.Name), &t); err != nil && !client.IsErrNotFound(err) {
+			log.WithField("environment_id", e.Id).WithField("sidecar", s.Name).WithField("error", errors.WithStack(err)).Warn("failed to stop sidecar container")
+		}
+	}
+}
+
+// Removes all of the sidecar containers belonging to the environment. This looks up the
+// containers by name rather than using the current configuration so that sidecars which
+// have since been removed from the server are also cleaned up.
+func (e *Environment) removeSidecars() error {
+	containers, err := e.client.ContainerList(context.Background(), types.ContainerListOptions{
+		All:     true,
+		Filters: filters.NewArgs(filters.Arg("label", "ContainerType=server_sidecar"), filters.Arg("name", e.Id+"_")),
+	})
+	if err != nil {
+		return errors.WithStack(err)
+	}
+
+	for _, c := range containers {
+		// The name filter matches anywhere in the container name, so make sure the container
+		// actually belongs to this environment. Sidecars created before names were prefixed
+		// are matched as well so that they are cleaned up.
+		if !e.ownsSidecar(c.Names) {
+			continue
+		}
+
+		err := e.client.ContainerRemove(context.Background(), c.ID, types.ContainerRemoveOptions{RemoveVolumes: true, Force: true})
+		if err != nil && !client.IsErrNotFound(err) {
+			return errors.WithStack(err)
+		}
+	}
+
+	return nil
+}
+
+// Determines if any of the given container names belong to a sidecar of this environment.
+func (e *Environment) ownsSidecar(names []string) bool {
+	prefix := "/" + e.Id + "_"
+	for _, n := range names {
+		if strings.HasPrefix(n, prefix) {
+			return true
+		}
+	}
+
+	return false
+}
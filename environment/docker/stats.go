@@ -3,13 +3,21 @@ package docker
 import (
 	"context"
 	"encoding/json"
+	"fmt"
 	"github.com/apex/log"
 	"github.com/docker/docker/api/types"
 	"github.com/pkg/errors"
+	"github.com/avatag-host/claws/config"
 	"github.com/avatag-host/claws/environment"
 	"io"
+	"io/ioutil"
 	"math"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
 	"sync/atomic"
+	"time"
 )
 
 // Attach to the instance and then automatically emit an event whenever the resource usage for the
@@ -24,6 +32,15 @@ func (e *Environment) pollResources(ctx context.Context) error {
 		return errors.New("cannot enable resource polling on a stopped server")
 	}
 
+	if config.Get().Docker.StatsMode == config.StatsModeCgroup {
+		err := e.pollCgroupResources(ctx)
+		if err != errCgroupUnavailable {
+			return err
+		}
+
+		l.Debug("cgroup v2 filesystem is not available for container, falling back to docker stats api")
+	}
+
 	stats, err := e.client.ContainerStats(context.Background(), e.Id, true)
 	if err != nil {
 		return errors.WithStack(err)
@@ -32,6 +49,14 @@ func (e *Environment) pollResources(ctx context.Context) error {
 
 	dec := json.NewDecoder(stats.Body)
 
+	// Track the previous block IO operation counts so that we can determine the number of
+	// operations per second between each stats reading.
+	var prevOps *blkioOps
+
+	// Docker streams stats roughly once a second, only emit them to listeners once the
+	// configured interval has passed since the last emitted set.
+	var lastPublish time.Time
+
 	for {
 		select {
 		case <-ctx.Done():
@@ -75,15 +100,36 @@ func (e *Environment) pollResources(ctx context.Context) error {
 				},
 			}
 
-			if b, err := json.Marshal(st); err != nil {
-				l.WithField("error", errors.WithStack(err)).Warn("error while marshaling stats object for environment")
-			} else {
-				e.Events().Publish(environment.ResourceEvent, string(b))
+			bytes, ops := e.blkioUsage(v)
+			st.Io.ReadBytes = bytes.read
+			st.Io.WriteBytes = bytes.write
+			if prevOps != nil && !v.PreRead.IsZero() {
+				if d := v.Read.Sub(v.PreRead).Seconds(); d > 0 {
+					st.Io.ReadIops = perSecond(prevOps.read, ops.read, d)
+					st.Io.WriteIops = perSecond(prevOps.write, ops.write, d)
+				}
 			}
+			prevOps = &ops
+
+			if time.Since(lastPublish) < e.Configuration.StatsInterval() {
+				continue
+			}
+
+			lastPublish = time.Now()
+			e.publishStats(st)
 		}
 	}
 }
 
+// Publishes a set of resource usage stats for the environment to any listeners.
+func (e *Environment) publishStats(st *environment.Stats) {
+	if b, err := json.Marshal(st); err != nil {
+		log.WithField("container_id", e.Id).WithField("error", errors.WithStack(err)).Warn("error while marshaling stats object for environment")
+	} else {
+		e.Events().Publish(environment.ResourceEvent, string(b))
+	}
+}
+
 // The "docker stats" CLI call does not return the same value as the types.MemoryStats.Usage
 // value which can be rather confusing to people trying to compare panel usage to
 // their stats output.
@@ -129,3 +175,116 @@ func calculateDockerAbsoluteCpu(pStats *types.CPUStats, stats *types.CPUStats) f
 
 	return math.Round(percent*1000) / 1000
 }
+
+type blkioOps struct {
+	read  uint64
+	write uint64
+}
+
+// Returns the total bytes and operations read from and written to block devices by the
+// container. Docker reports these values for cgroup v1 hosts, however on cgroup v2 hosts the
+// operation counts are not returned and must be read from the cgroup directly.
+func (e *Environment) blkioUsage(v *types.StatsJSON) (blkioOps, blkioOps) {
+	var bytes, ops blkioOps
+
+	bytes.read, bytes.write = sumBlkioEntries(v.BlkioStats.IoServiceBytesRecursive)
+
+	if len(v.BlkioStats.IoServicedRecursive) > 0 {
+		ops.read, ops.write = sumBlkioEntries(v.BlkioStats.IoServicedRecursive)
+	} else if st, ok := readCgroupV2IoStat(cgroupV2Directory(v.ID)); ok {
+		ops.read, ops.write = st["rios"], st["wios"]
+
+		// Older versions of Docker do not return the byte counts on cgroup v2 either.
+		if len(v.BlkioStats.IoServiceBytesRecursive) == 0 {
+			bytes.read, bytes.write = st["rbytes"], st["wbytes"]
+		}
+	}
+
+	return bytes, ops
+}
+
+// Sums the read and write values for a set of block IO entries. The operation names are
+// capitalized on cgroup v1 and lowercase on cgroup v2.
+func sumBlkioEntries(entries []types.BlkioStatEntry) (read uint64, write uint64) {
+	for _, entry := range entries {
+		switch strings.ToLower(entry.Op) {
+		case "read":
+			read += entry.Value
+		case "write":
+			write += entry.Value
+		}
+	}
+
+	return read, write
+}
+
+// The locations that the cgroup v2 directory for a container can be found at, depending on
+// if Docker is using the systemd or cgroupfs driver.
+var cgroupV2Paths = []string{
+	"/sys/fs/cgroup/system.slice/docker-%s.scope",
+	"/sys/fs/cgroup/docker/%s",
+}
+
+var errCgroupUnavailable = errors.New("environment/docker: cgroup v2 directory for container could not be found")
+
+// Returns the cgroup v2 directory for a container, or an empty string if one could not
+// be found on the system.
+func cgroupV2Directory(id string) string {
+	if id == "" {
+		return ""
+	}
+
+	for _, p := range cgroupV2Paths {
+		d := fmt.Sprintf(p, id)
+		if _, err := os.Stat(filepath.Join(d, "cgroup.controllers")); err == nil {
+			return d
+		}
+	}
+
+	return ""
+}
+
+// Reads the io.stat file from a cgroup v2 directory, summing the values for each device.
+// Returns false if the file could not be read.
+func readCgroupV2IoStat(dir string) (map[string]uint64, bool) {
+	if dir == "" {
+		return nil, false
+	}
+
+	b, err := ioutil.ReadFile(filepath.Join(dir, "io.stat"))
+	if err != nil {
+		return nil, false
+	}
+
+	out := make(map[string]uint64)
+	for _, line := range strings.Split(string(b), "\n") {
+		fields := strings.Fields(line)
+		if len(fields) < 2 {
+			continue
+		}
+
+		// The first field is the major:minor device identifier, everything after that
+		// is a key=value pair.
+		for _, f := range fields[1:] {
+			kv := strings.SplitN(f, "=", 2)
+			if len(kv) != 2 {
+				continue
+			}
+
+			if i, err := strconv.ParseUint(kv[1], 10, 64); err == nil {
+				out[kv[0]] += i
+			}
+		}
+	}
+
+	return out, true
+}
+
+// Returns the rate of change per second between two counter values.
+func perSecond(prev uint64, cur uint64, seconds float64) uint64 {
+	if cur < prev {
+		return 0
+	}
+
+	return uint64(math.Round(float64(cur-prev) / seconds))
+}
@@ -0,0 +1,190 @@
+package docker
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"github.com/pkg/errors"
+	"github.com/avatag-host/claws/environment"
+	"io/ioutil"
+	"math"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Polls the resource usage for the container by reading the values directly out of the cgroup
+// v2 filesystem rather than using the Docker stats API. The Docker API streams a new set of
+// stats for every container each second which becomes very expensive on busy nodes, reading a
+// handful of small files is significantly cheaper.
+//
+// If the cgroup for the container cannot be found errCgroupUnavailable is returned so that
+// the caller can fall back to using the Docker API.
+func (e *Environment) pollCgroupResources(ctx context.Context) error {
+	c, err := e.client.ContainerInspect(ctx, e.Id)
+	if err != nil {
+		return errors.WithStack(err)
+	}
+
+	dir := cgroupV2Directory(c.ID)
+	if dir == "" {
+		return errCgroupUnavailable
+	}
+
+	interval := e.Configuration.StatsInterval()
+	ticker := time.NewTicker(interval)
+	defer func() {
+		ticker.Stop()
+	}()
+
+	var prevCpu uint64
+	var prevOps *blkioOps
+	var prevTime time.Time
+
+	for {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case t := <-ticker.C:
+			if e.State() == environment.ProcessOfflineState {
+				return nil
+			}
+
+			cpu, err := readCgroupKeyedValue(filepath.Join(dir, "cpu.stat"), "usage_usec")
+			if err != nil {
+				// The cgroup is removed as soon as the container stops, so if it no longer
+				// exists just stop polling.
+				if os.IsNotExist(errors.Cause(err)) {
+					return nil
+				}
+
+				return err
+			}
+
+			st := &environment.Stats{}
+			st.Memory, st.MemoryLimit = readCgroupMemory(dir)
+			st.Network.RxBytes, st.Network.TxBytes = readProcessNetwork(c.State.Pid)
+
+			if !prevTime.IsZero() {
+				if d := t.Sub(prevTime).Microseconds(); d > 0 && cpu >= prevCpu {
+					st.CpuAbsolute = math.Round(float64(cpu-prevCpu)/float64(d)*100*1000) / 1000
+				}
+			}
+
+			var ops blkioOps
+			if io, ok := readCgroupV2IoStat(dir); ok {
+				st.Io.ReadBytes, st.Io.WriteBytes = io["rbytes"], io["wbytes"]
+				ops.read, ops.write = io["rios"], io["wios"]
+
+				if prevOps != nil && !prevTime.IsZero() {
+					if d := t.Sub(prevTime).Seconds(); d > 0 {
+						st.Io.ReadIops = perSecond(prevOps.read, ops.read, d)
+						st.Io.WriteIops = perSecond(prevOps.write, ops.write, d)
+					}
+				}
+			}
+
+			prevCpu = cpu
+			prevOps = &ops
+			prevTime = t
+
+			e.publishStats(st)
+
+			// Pick up any changes to the configured interval while the server is running.
+			if i := e.Configuration.StatsInterval(); i != interval {
+				interval = i
+				ticker.Stop()
+				ticker = time.NewTicker(interval)
+			}
+		}
+	}
+}
+
+// Returns the memory usage and limit for a cgroup. The usage excludes inactive file cache
+// in order to match the value reported when using the Docker stats API.
+func readCgroupMemory(dir string) (uint64, uint64) {
+	usage, _ := readCgroupUint(filepath.Join(dir, "memory.current"))
+	if inactive, err := readCgroupKeyedValue(filepath.Join(dir, "memory.stat"), "inactive_file"); err == nil && inactive < usage {
+		usage -= inactive
+	}
+
+	// When there is no memory limit on the cgroup Docker reports the total memory available
+	// on the host, so do the same here.
+	limit, err := readCgroupUint(filepath.Join(dir, "memory.max"))
+	if err != nil {
+		limit, _ = readCgroupKeyedValue("/proc/meminfo", "MemTotal:")
+		limit *= 1024
+	}
+
+	return usage, limit
+}
+
+// Returns the total number of bytes received and transmitted across all of the network
+// interfaces in the network namespace of the given process, excluding the loopback.
+func readProcessNetwork(pid int) (rx uint64, tx uint64) {
+	if pid <= 0 {
+		return 0, 0
+	}
+
+	f, err := os.Open(fmt.Sprintf("/proc/%d/net/dev", pid))
+	if err != nil {
+		return 0, 0
+	}
+	defer f.Close()
+
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		parts := strings.SplitN(scanner.Text(), ":", 2)
+		if len(parts) != 2 || strings.TrimSpace(parts[0]) == "lo" {
+			continue
+		}
+
+		// The first field is the received bytes, and the ninth is the transmitted bytes.
+		fields := strings.Fields(parts[1])
+		if len(fields) < 9 {
+			continue
+		}
+
+		r, _ := strconv.ParseUint(fields[0], 10, 64)
+		t, _ := strconv.ParseUint(fields[8], 10, 64)
+		rx += r
+		tx += t
+	}
+
+	return rx, tx
+}
+
+// Reads a file containing a single unsigned integer value.
+func readCgroupUint(p string) (uint64, error) {
+	b, err := ioutil.ReadFile(p)
+	if err != nil {
+		return 0, errors.WithStack(err)
+	}
+
+	i, err := strconv.ParseUint(strings.TrimSpace(string(b)), 10, 64)
+
+	return i, errors.WithStack(err)
+}
+
+// Reads the value for a given key out of a file containing "key value" pairs on each line.
+func readCgroupKeyedValue(p string, key string) (uint64, error) {
+	f, err := os.Open(p)
+	if err != nil {
+		return 0, errors.WithStack(err)
+	}
+	defer f.Close()
+
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) >= 2 && fields[0] == key {
+			i, err := strconv.ParseUint(fields[1], 10, 64)
+
+			return i, errors.WithStack(err)
+		}
+	}
+
+	return 0, errors.New(fmt.Sprintf("environment/docker: key %s not found in %s", key, p))
+}
@@ -0,0 +1,11 @@
+// +build !linux
+
+package docker
+
+import "context"
+
+// Reading stats from the cgroup filesystem is only supported on Linux, so always fall back
+// to using the Docker API on other systems.
+func (e *Environment) pollCgroupResources(ctx context.Context) error {
+	return errCgroupUnavailable
+}
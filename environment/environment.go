@@ -1,10 +1,17 @@
 package environment
 
 import (
+	"bytes"
+	"context"
 	"github.com/avatag-host/claws/events"
 	"os"
+	"time"
 )
 
+// The maximum amount of time an environment may spend pulling the image it is created from.
+// Starting a server can include this, so anything waiting on a start must allow for it.
+const ImagePullTimeout = time.Minute * 15
+
 const (
 	ConsoleOutputEvent       = "console output"
 	StateChangeEvent         = "state change"
@@ -50,12 +57,14 @@ type ProcessEnvironment interface {
 	InSituUpdate() error
 
 	// Runs before the environment is started. If an error is returned starting will
-	// not occur, otherwise proceeds as normal.
-	OnBeforeStart() error
+	// not occur, otherwise proceeds as normal. Any long running work, such as pulling
+	// an image, is aborted once the context is cancelled.
+	OnBeforeStart(ctx context.Context) error
 
 	// Starts a server instance. If the server instance is not in a state where it
-	// can be started an error should be returned.
-	Start() error
+	// can be started an error should be returned. Starting is aborted once the context
+	// is cancelled.
+	Start(ctx context.Context) error
 
 	// Stops a server instance. If the server is already stopped an error should
 	// not be returned.
@@ -70,6 +79,17 @@ type ProcessEnvironment interface {
 	// is not running no error should be returned.
 	Terminate(signal os.Signal) error
 
+	// Freezes the running server process in place without stopping it, so that it uses no CPU
+	// until it is unpaused. If the environment cannot pause processes an error is returned.
+	Pause() error
+
+	// Resumes a server process that was previously paused. If the process is not paused an
+	// error should not be returned.
+	Unpause() error
+
+	// Determines if the server process is currently paused.
+	IsPaused() (bool, error)
+
 	// Destroys the environment removing any containers that were created (in Docker
 	// environments at least).
 	Destroy() error
@@ -94,4 +114,72 @@ type ProcessEnvironment interface {
 	// Reads the log file for the process from the end backwards until the provided
 	// number of lines is met.
 	Readlog(int) ([]string, error)
+
+	// Runs a one-off command within the running server environment, separate from the
+	// main server process. The command is aborted once the context is cancelled, and at
+	// most limit bytes of output are captured from each of stdout and stderr.
+	Exec(ctx context.Context, cmd []string, limit int) (*ExecResult, error)
+
+	// Returns the processes that are currently running within the server environment.
+	Processes() (*ProcessList, error)
+
+	// Returns the address at which the server can be reached directly on the given port,
+	// bypassing any proxy that forwards connections from the server allocations. Proxies
+	// accept connections before the server is listening, so they cannot be used to tell
+	// if the server is ready.
+	DirectAddress(port int) (string, error)
+}
+
+// The processes running within a server environment. Each process is a row of values that
+// correspond to the column titles.
+type ProcessList struct {
+	Titles    []string   `json:"titles"`
+	Processes [][]string `json:"processes"`
+}
+
+// A writer that stores up to a fixed number of bytes and silently discards anything written
+// beyond that, so that a command producing a huge amount of output cannot exhaust memory.
+type LimitedBuffer struct {
+	buf       bytes.Buffer
+	limit     int
+	truncated bool
+}
+
+// Returns a new buffer that stores up to limit bytes.
+func NewLimitedBuffer(limit int) *LimitedBuffer {
+	return &LimitedBuffer{limit: limit}
+}
+
+func (l *LimitedBuffer) Write(p []byte) (int, error) {
+	n := len(p)
+	if remaining := l.limit - l.buf.Len(); remaining < len(p) {
+		l.truncated = true
+		if remaining <= 0 {
+			return n, nil
+		}
+
+		p = p[:remaining]
+	}
+
+	l.buf.Write(p)
+
+	return n, nil
+}
+
+// Returns the contents of the buffer.
+func (l *LimitedBuffer) String() string {
+	return l.buf.String()
+}
+
+// Determines if any data written to the buffer was discarded.
+func (l *LimitedBuffer) Truncated() bool {
+	return l.truncated
+}
+
+// The result of running a one-off command within a server environment.
+type ExecResult struct {
+	ExitCode  int    `json:"exit_code"`
+	Stdout    string `json:"stdout"`
+	Stderr    string `json:"stderr"`
+	Truncated bool   `json:"truncated"`
 }
@@ -0,0 +1,173 @@
+package lxd
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"github.com/gorilla/websocket"
+	"github.com/pkg/errors"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"time"
+)
+
+// An error returned by the LXD API.
+type ApiError struct {
+	Code    int
+	Message string
+}
+
+func (e *ApiError) Error() string {
+	return fmt.Sprintf("environment/lxd: api error (%d): %s", e.Code, e.Message)
+}
+
+// Determines if the given error is an API error for a resource that does not exist.
+func IsNotFound(err error) bool {
+	if e, ok := errors.Cause(err).(*ApiError); ok {
+		return e.Code == http.StatusNotFound
+	}
+
+	return false
+}
+
+// The response envelope used by every LXD API endpoint.
+type response struct {
+	Type       string          `json:"type"`
+	StatusCode int             `json:"status_code"`
+	ErrorCode  int             `json:"error_code"`
+	Error      string          `json:"error"`
+	Operation  string          `json:"operation"`
+	Metadata   json.RawMessage `json:"metadata"`
+}
+
+// A background operation being performed by LXD.
+type operation struct {
+	Id         string                 `json:"id"`
+	Status     string                 `json:"status"`
+	StatusCode int                    `json:"status_code"`
+	Err        string                 `json:"err"`
+	Metadata   map[string]interface{} `json:"metadata"`
+}
+
+// A minimal client for the LXD REST API that communicates with the daemon over its local
+// unix socket.
+type client struct {
+	socket string
+	http   *http.Client
+}
+
+func newClient(socket string) *client {
+	dial := func(ctx context.Context, _, _ string) (net.Conn, error) {
+		var d net.Dialer
+		return d.DialContext(ctx, "unix", socket)
+	}
+
+	return &client{
+		socket: socket,
+		http:   &http.Client{Transport: &http.Transport{DialContext: dial}},
+	}
+}
+
+// Performs a request against the LXD API. If the request results in a background operation
+// being created that operation is returned, otherwise the response metadata is decoded into
+// v if it is not nil.
+func (c *client) request(ctx context.Context, method string, path string, body interface{}, v interface{}) (*operation, error) {
+	var r io.Reader
+	if body != nil {
+		b, err := json.Marshal(body)
+		if err != nil {
+			return nil, errors.WithStack(err)
+		}
+		r = bytes.NewReader(b)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, method, "http://lxd"+path, r)
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	res, err := c.http.Do(req)
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+	defer res.Body.Close()
+
+	var data response
+	if err := json.NewDecoder(res.Body).Decode(&data); err != nil {
+		return nil, errors.Wrap(err, "environment/lxd: failed to decode api response")
+	}
+
+	if data.Type == "error" {
+		return nil, errors.WithStack(&ApiError{Code: data.ErrorCode, Message: data.Error})
+	}
+
+	if data.Type == "async" {
+		var op operation
+		if err := json.Unmarshal(data.Metadata, &op); err != nil {
+			return nil, errors.WithStack(err)
+		}
+
+		return &op, nil
+	}
+
+	if v != nil && len(data.Metadata) > 0 {
+		if err := json.Unmarshal(data.Metadata, v); err != nil {
+			return nil, errors.WithStack(err)
+		}
+	}
+
+	return nil, nil
+}
+
+// Performs a request and waits for the background operation it creates to complete.
+func (c *client) run(ctx context.Context, method string, path string, body interface{}) (*operation, error) {
+	op, err := c.request(ctx, method, path, body, nil)
+	if err != nil || op == nil {
+		return op, err
+	}
+
+	return c.wait(ctx, op.Id)
+}
+
+// Waits for a background operation to complete, returning an error if it failed.
+func (c *client) wait(ctx context.Context, id string) (*operation, error) {
+	for {
+		var op operation
+		if _, err := c.request(ctx, http.MethodGet, "/1.0/operations/"+id+"/wait?timeout=30", nil, &op); err != nil {
+			return nil, err
+		}
+
+		switch op.Status {
+		case "Success":
+			return &op, nil
+		case "Failure", "Cancelled":
+			return nil, errors.WithStack(&ApiError{Code: op.StatusCode, Message: op.Err})
+		}
+
+		select {
+		case <-ctx.Done():
+			return nil, errors.WithStack(ctx.Err())
+		case <-time.After(time.Millisecond * 100):
+		}
+	}
+}
+
+// Connects to one of the websockets for a background operation using the given secret.
+func (c *client) websocket(ctx context.Context, id string, secret string) (*websocket.Conn, error) {
+	d := websocket.Dialer{
+		NetDialContext: func(ctx context.Context, _, _ string) (net.Conn, error) {
+			var d net.Dialer
+			return d.DialContext(ctx, "unix", c.socket)
+		},
+		HandshakeTimeout: time.Second * 10,
+	}
+
+	u := "ws://lxd/1.0/operations/" + id + "/websocket?secret=" + url.QueryEscape(secret)
+	conn, _, err := d.DialContext(ctx, u, nil)
+
+	return conn, errors.WithStack(err)
+}
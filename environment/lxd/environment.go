@@ -0,0 +1,493 @@
+package lxd
+
+import (
+	"context"
+	"fmt"
+	"github.com/apex/log"
+	"github.com/pkg/errors"
+	"github.com/avatag-host/claws/api"
+	"github.com/avatag-host/claws/config"
+	"github.com/avatag-host/claws/environment"
+	"github.com/avatag-host/claws/events"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// The number of lines of console output kept in memory so that they can be returned by
+// Readlog, since LXD does not keep the output of commands executed in a container.
+const logBufferLines = 500
+
+var ErrNotRunning = errors.New("environment/lxd: server process is not running")
+
+// Replaces the characters in an IP address that are not allowed in LXD device names.
+var deviceNameReplacer = strings.NewReplacer(".", "-", ":", "-")
+
+type Metadata struct {
+	Stop api.ProcessStopConfiguration
+}
+
+// Ensure that the LXD environment is always implementing all of the methods from the base
+// environment interface.
+var _ environment.ProcessEnvironment = (*Environment)(nil)
+
+// An environment that runs each server inside of an LXD system container. The container is
+// created once and kept between restarts of the server, with the server process itself being
+// executed within the container each time the server is started.
+type Environment struct {
+	mu      sync.RWMutex
+	eventMu sync.Mutex
+
+	// The public identifier for this environment, this is the server UUID.
+	Id string
+
+	// The environment configuration.
+	Configuration *environment.Configuration
+
+	meta   *Metadata
+	client *client
+
+	// The session for the running server process and a channel that is closed once it exits.
+	session *execSession
+	done    chan struct{}
+
+	exitCode  uint32
+	oomKilled bool
+
+	// The most recent lines of console output from the process.
+	logs []string
+
+	emitter *events.EventBus
+
+	// Tracks the environment state.
+	st   string
+	stMu sync.RWMutex
+}
+
+// Creates a new LXD environment for a server.
+func New(id string, m *Metadata, c *environment.Configuration) (*Environment, error) {
+	e := &Environment{
+		Id:            id,
+		Configuration: c,
+		meta:          m,
+		client:        newClient(config.Get().Lxd.Socket),
+		st:            environment.ProcessOfflineState,
+	}
+
+	return e, nil
+}
+
+func (e *Environment) Type() string {
+	return "lxd"
+}
+
+func (e *Environment) Config() *environment.Configuration {
+	e.mu.RLock()
+	defer e.mu.RUnlock()
+
+	return e.Configuration
+}
+
+func (e *Environment) Events() *events.EventBus {
+	e.eventMu.Lock()
+	defer e.eventMu.Unlock()
+
+	if e.emitter == nil {
+		e.emitter = events.New()
+	}
+
+	return e.emitter
+}
+
+// Sets the stop configuration for the environment.
+func (e *Environment) SetStopConfiguration(c api.ProcessStopConfiguration) {
+	e.mu.Lock()
+	e.meta.Stop = c
+	e.mu.Unlock()
+}
+
+// Returns the current environment state.
+func (e *Environment) State() string {
+	e.stMu.RLock()
+	defer e.stMu.RUnlock()
+
+	return e.st
+}
+
+// Sets the state of the environment and emits an event for it if it changed.
+func (e *Environment) setState(state string) {
+	e.stMu.Lock()
+	prev := e.st
+	e.st = state
+	e.stMu.Unlock()
+
+	if prev != state {
+		e.Events().Publish(environment.StateChangeEvent, state)
+	}
+}
+
+// Returns the name of the LXD container for the server. Container names must begin with a
+// letter, so the server UUID cannot be used on its own.
+func (e *Environment) name() string {
+	return "claws-" + e.Id
+}
+
+func (e *Environment) path() string {
+	return "/1.0/instances/" + e.name()
+}
+
+// Returns the LXD configuration keys used to apply the resource limits for the server. Keys
+// for limits that are not set are returned with an empty value so that they are unset when
+// updating an existing container.
+func (e *Environment) limits() map[string]string {
+	l := e.Configuration.Limits()
+
+	out := map[string]string{
+		"limits.memory":         "",
+		"limits.memory.swap":    "true",
+		"limits.memory.enforce": "hard",
+		"limits.cpu":            l.Threads,
+		"limits.cpu.allowance":  "",
+	}
+
+	if l.MemoryLimit > 0 {
+		out["limits.memory"] = fmt.Sprintf("%dB", l.BoundedMemoryLimit())
+		if l.Swap == 0 {
+			out["limits.memory.swap"] = "false"
+		}
+	}
+
+	if l.CpuLimit > 0 {
+		out["limits.cpu.allowance"] = fmt.Sprintf("%dms/100ms", l.CpuLimit)
+	}
+
+	return out
+}
+
+// Returns the devices for the container, which are the mounts for the server along with a
+// proxy device for each of the server allocations.
+func (e *Environment) devices() map[string]map[string]string {
+	out := make(map[string]map[string]string)
+
+	for i, m := range e.Configuration.Mounts() {
+		d := map[string]string{
+			"type":   "disk",
+			"source": m.Source,
+			"path":   m.Target,
+		}
+
+		if m.ReadOnly {
+			d["readonly"] = "true"
+		}
+
+		if m.Default && config.Get().Lxd.ShiftMounts {
+			d["shift"] = "true"
+		}
+
+		out["mount"+strconv.Itoa(i)] = d
+	}
+
+	a := e.Configuration.Allocations()
+	for ip, ports := range a.Mappings {
+		ip = environment.NormalizeIp(ip)
+		name := deviceNameReplacer.Replace(ip)
+		if strings.Contains(ip, ":") {
+			ip = "[" + ip + "]"
+		}
+
+		for _, port := range ports {
+			if port < 1 || port > 65535 {
+				continue
+			}
+
+			for _, proto := range []string{"tcp", "udp"} {
+				out[fmt.Sprintf("%s-%s-%d", proto, name, port)] = map[string]string{
+					"type":    "proxy",
+					"listen":  fmt.Sprintf("%s:%s:%d", proto, ip, port),
+					"connect": fmt.Sprintf("%s:127.0.0.1:%d", proto, port),
+				}
+			}
+		}
+	}
+
+	return out
+}
+
+// Determines if the container for the server exists.
+func (e *Environment) Exists() (bool, error) {
+	if _, err := e.client.request(context.Background(), http.MethodGet, e.path(), nil, nil); err != nil {
+		if IsNotFound(err) {
+			return false, nil
+		}
+
+		return false, err
+	}
+
+	return true, nil
+}
+
+// Determines if the server process is running within the container. Processes executed in
+// the container cannot be re-attached to, so this is only true for processes started since
+// Wings last booted.
+func (e *Environment) IsRunning() (bool, error) {
+	e.mu.RLock()
+	defer e.mu.RUnlock()
+
+	return e.session != nil, nil
+}
+
+// Applies the current resource limits to the container. LXD applies these to a running
+// container immediately.
+func (e *Environment) InSituUpdate() error {
+	if ok, err := e.Exists(); err != nil || !ok {
+		return err
+	}
+
+	body := map[string]interface{}{"config": e.limits()}
+	_, err := e.client.run(context.Background(), http.MethodPatch, e.path(), body)
+
+	return err
+}
+
+// Ensures that the container exists with the current configuration for the server, and that
+// it is not running so that it can be started cleanly.
+func (e *Environment) OnBeforeStart(ctx context.Context) error {
+	ok, err := e.Exists()
+	if err != nil {
+		return err
+	}
+
+	if !ok {
+		return e.create(ctx)
+	}
+
+	// Stop any container that was left running, for example if Wings was restarted while the
+	// server was online, before updating its configuration.
+	if err := e.setContainerState("stop", true); err != nil {
+		return err
+	}
+
+	// The devices are replaced entirely rather than patched, otherwise the proxy devices for
+	// allocations that were removed from the server would be left behind.
+	var inst map[string]interface{}
+	if _, err := e.client.request(ctx, http.MethodGet, e.path(), nil, &inst); err != nil {
+		return err
+	}
+
+	c, _ := inst["config"].(map[string]interface{})
+	if c == nil {
+		c = make(map[string]interface{})
+	}
+	for k, v := range e.limits() {
+		c[k] = v
+	}
+
+	inst["config"] = c
+	inst["devices"] = e.devices()
+
+	if _, err := e.client.run(ctx, http.MethodPut, e.path(), inst); err != nil {
+		return errors.Wrap(err, "environment/lxd: failed to update container")
+	}
+
+	return nil
+}
+
+// Creates the container for the server using the configured image.
+func (e *Environment) Create() error {
+	return e.create(context.Background())
+}
+
+// Creates the container for the server, aborting once the context is cancelled.
+func (e *Environment) create(ctx context.Context) error {
+	if ok, err := e.Exists(); err != nil || ok {
+		return err
+	}
+
+	// Servers are started by Wings, so the container should not be started by LXD on boot.
+	c := e.limits()
+	c["boot.autostart"] = "false"
+
+	cfg := config.Get().Lxd
+	body := map[string]interface{}{
+		"name": e.name(),
+		"type": "container",
+		"source": map[string]string{
+			"type":     "image",
+			"alias":    cfg.Image,
+			"server":   cfg.ImageServer,
+			"protocol": "simplestreams",
+		},
+		"profiles": []string{cfg.Profile},
+		"config":   c,
+		"devices":  e.devices(),
+	}
+
+	log.WithField("environment_id", e.Id).WithField("image", cfg.Image).Debug("creating lxd container for server")
+
+	ctx, cancel := context.WithTimeout(ctx, environment.ImagePullTimeout)
+	defer cancel()
+
+	if _, err := e.client.run(ctx, http.MethodPost, "/1.0/instances", body); err != nil {
+		return errors.Wrap(err, "environment/lxd: failed to create container")
+	}
+
+	return nil
+}
+
+// Stops and removes the container for the server.
+func (e *Environment) Destroy() error {
+	e.setState(environment.ProcessStoppingState)
+
+	if err := e.setContainerState("stop", true); err != nil && !IsNotFound(err) {
+		return err
+	}
+
+	if _, err := e.client.run(context.Background(), http.MethodDelete, e.path(), nil); err != nil && !IsNotFound(err) {
+		return err
+	}
+
+	e.setState(environment.ProcessOfflineState)
+
+	return nil
+}
+
+// Returns the exit code of the last process to run, and if it was killed for running out
+// of memory.
+func (e *Environment) ExitState() (uint32, bool, error) {
+	e.mu.RLock()
+	defer e.mu.RUnlock()
+
+	return e.exitCode, e.oomKilled, nil
+}
+
+// Returns up to the last n lines of console output from the server process.
+func (e *Environment) Readlog(n int) ([]string, error) {
+	e.mu.RLock()
+	defer e.mu.RUnlock()
+
+	if n > len(e.logs) {
+		n = len(e.logs)
+	}
+
+	out := make([]string, n)
+	copy(out, e.logs[len(e.logs)-n:])
+
+	return out, nil
+}
+
+// Records a line of console output and emits it to any listeners.
+func (e *Environment) writeLog(line string) {
+	e.mu.Lock()
+	e.logs = append(e.logs, line)
+	if len(e.logs) > logBufferLines {
+		e.logs = e.logs[len(e.logs)-logBufferLines:]
+	}
+	e.mu.Unlock()
+
+	e.Events().Publish(environment.ConsoleOutputEvent, line)
+}
+
+// Returns the processes running inside of the container for the server.
+func (e *Environment) Processes() (*environment.ProcessList, error) {
+	if ok, _ := e.IsRunning(); !ok {
+		return nil, ErrNotRunning
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*10)
+	defer cancel()
+
+	res, err := e.Exec(ctx, []string{"ps", "-eo", "pid=,args="}, 64*1024)
+	if err != nil {
+		return nil, err
+	}
+
+	if res.ExitCode != 0 {
+		return nil, errors.New(fmt.Sprintf("environment/lxd: failed to list processes: %s", strings.TrimSpace(res.Stderr)))
+	}
+
+	out := &environment.ProcessList{Titles: []string{"PID", "CMD"}}
+	for _, line := range strings.Split(res.Stdout, "\n") {
+		fields := strings.SplitN(strings.TrimSpace(line), " ", 2)
+		if len(fields) != 2 {
+			continue
+		}
+
+		out.Processes = append(out.Processes, []string{fields[0], strings.TrimSpace(fields[1])})
+	}
+
+	return out, nil
+}
+
+// Changes the state of the container, such as starting or stopping it. Stopping a container
+// that is already stopped is not treated as an error.
+func (e *Environment) setContainerState(action string, force bool) error {
+	status, err := e.containerStatus()
+	if err != nil {
+		return err
+	}
+
+	if (action == "stop" && status == "Stopped") || (action == "start" && status == "Running") ||
+		(action == "freeze" && status == "Frozen") || (action == "unfreeze" && status != "Frozen") {
+		return nil
+	}
+
+	body := map[string]interface{}{"action": action, "timeout": 30, "force": force}
+	if _, err := e.client.run(context.Background(), http.MethodPut, e.path()+"/state", body); err != nil {
+		return errors.Wrap(err, fmt.Sprintf("environment/lxd: failed to %s container", action))
+	}
+
+	return nil
+}
+
+// Returns the address of the container itself for the given port. The proxy devices for the
+// server allocations accept connections whether or not anything is listening in the container,
+// so the container must be reached on its own network address instead.
+func (e *Environment) DirectAddress(port int) (string, error) {
+	var state instanceState
+	if _, err := e.client.request(context.Background(), http.MethodGet, e.path()+"/state", nil, &state); err != nil {
+		return "", err
+	}
+
+	for name, n := range state.Network {
+		if name == "lo" {
+			continue
+		}
+
+		for _, a := range n.Addresses {
+			if a.Family == "inet" && a.Scope == "global" {
+				return net.JoinHostPort(a.Address, strconv.Itoa(port)), nil
+			}
+		}
+	}
+
+	return "", errors.New("environment/lxd: container does not have an IP address")
+}
+
+// Returns the current status of the container, such as "Running", "Stopped" or "Frozen".
+func (e *Environment) containerStatus() (string, error) {
+	var st struct {
+		Status string `json:"status"`
+	}
+
+	if _, err := e.client.request(context.Background(), http.MethodGet, e.path()+"/state", nil, &st); err != nil {
+		return "", err
+	}
+
+	return st.Status, nil
+}
+
+// Returns the environment variables for the server in the format expected by LXD.
+func (e *Environment) environmentVariables() map[string]string {
+	out := map[string]string{"HOME": "/home/container"}
+	for _, v := range e.Configuration.EnvironmentVariables() {
+		parts := strings.SplitN(v, "=", 2)
+		if len(parts) == 2 {
+			out[parts[0]] = parts[1]
+		}
+	}
+
+	return out
+}
@@ -0,0 +1,176 @@
+package lxd
+
+import (
+	"context"
+	"github.com/gorilla/websocket"
+	"github.com/pkg/errors"
+	"github.com/avatag-host/claws/environment"
+	"io"
+	"net/http"
+	"sync"
+	"syscall"
+)
+
+// A command being executed within a container, along with the websockets used to send input
+// to it and read its output.
+type execSession struct {
+	mu     sync.Mutex
+	id     string
+	client *client
+
+	stdin   *websocket.Conn
+	stdout  *websocket.Conn
+	stderr  *websocket.Conn
+	control *websocket.Conn
+}
+
+// Executes a command within the container, returning once all of the websockets for the
+// command have been connected. The command does not begin executing until that point.
+func (e *Environment) exec(ctx context.Context, cmd []string) (*execSession, error) {
+	uid, gid := e.Configuration.User()
+
+	body := map[string]interface{}{
+		"command":            cmd,
+		"environment":        e.environmentVariables(),
+		"cwd":                "/home/container",
+		"user":               uid,
+		"group":              gid,
+		"interactive":        false,
+		"wait-for-websocket": true,
+	}
+
+	op, err := e.client.request(ctx, http.MethodPost, e.path()+"/exec", body, nil)
+	if err != nil {
+		return nil, errors.Wrap(err, "environment/lxd: failed to execute command in container")
+	}
+
+	if op == nil {
+		return nil, errors.New("environment/lxd: no operation returned when executing command")
+	}
+
+	fds, _ := op.Metadata["fds"].(map[string]interface{})
+
+	s := &execSession{id: op.Id, client: e.client}
+	for fd, conn := range map[string]**websocket.Conn{"0": &s.stdin, "1": &s.stdout, "2": &s.stderr, "control": &s.control} {
+		secret, _ := fds[fd].(string)
+		if secret == "" {
+			s.close()
+			return nil, errors.New("environment/lxd: missing websocket secret for command " + fd)
+		}
+
+		if *conn, err = e.client.websocket(ctx, op.Id, secret); err != nil {
+			s.close()
+			return nil, err
+		}
+	}
+
+	return s, nil
+}
+
+// Writes data to the stdin of the command.
+func (s *execSession) write(p []byte) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return errors.WithStack(s.stdin.WriteMessage(websocket.BinaryMessage, p))
+}
+
+// Sends a signal to the command.
+func (s *execSession) signal(sig int) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	msg := map[string]interface{}{"command": "signal", "signal": sig}
+
+	return errors.WithStack(s.control.WriteJSON(msg))
+}
+
+// Copies the output from one of the output websockets for the command into the writer until
+// the command exits.
+func copyOutput(conn *websocket.Conn, w io.Writer) {
+	for {
+		_, b, err := conn.ReadMessage()
+		if err != nil {
+			return
+		}
+
+		if _, err := w.Write(b); err != nil {
+			return
+		}
+	}
+}
+
+// Waits for the command to exit and returns its exit code.
+func (s *execSession) wait(ctx context.Context) (int, error) {
+	op, err := s.client.wait(ctx, s.id)
+	if err != nil {
+		return 0, err
+	}
+
+	code, _ := op.Metadata["return"].(float64)
+
+	return int(code), nil
+}
+
+func (s *execSession) close() {
+	for _, c := range []*websocket.Conn{s.stdin, s.stdout, s.stderr, s.control} {
+		if c != nil {
+			c.Close()
+		}
+	}
+}
+
+// Runs a one-off command within the container as the system user.
+func (e *Environment) Exec(ctx context.Context, cmd []string, limit int) (*environment.ExecResult, error) {
+	if len(cmd) == 0 {
+		return nil, errors.New("environment/lxd: no command provided to exec")
+	}
+
+	if ok, _ := e.IsRunning(); !ok {
+		return nil, ErrNotRunning
+	}
+
+	s, err := e.exec(ctx, cmd)
+	if err != nil {
+		return nil, err
+	}
+	defer s.close()
+
+	// Close stdin right away so that commands reading from it do not block forever.
+	s.mu.Lock()
+	_ = s.stdin.WriteMessage(websocket.CloseMessage, websocket.FormatCloseMessage(websocket.CloseNormalClosure, ""))
+	s.mu.Unlock()
+
+	stdout := environment.NewLimitedBuffer(limit)
+	stderr := environment.NewLimitedBuffer(limit)
+
+	var wg sync.WaitGroup
+	wg.Add(2)
+	go func() {
+		defer wg.Done()
+		copyOutput(s.stdout, stdout)
+	}()
+	go func() {
+		defer wg.Done()
+		copyOutput(s.stderr, stderr)
+	}()
+
+	code, err := s.wait(ctx)
+	if err != nil {
+		// The command keeps running in the container after we stop waiting on it, so it is
+		// killed if the context was cancelled.
+		if ctx.Err() != nil {
+			_ = s.signal(int(syscall.SIGKILL))
+		}
+
+		return nil, err
+	}
+	wg.Wait()
+
+	return &environment.ExecResult{
+		ExitCode:  code,
+		Stdout:    stdout.String(),
+		Stderr:    stderr.String(),
+		Truncated: stdout.Truncated() || stderr.Truncated(),
+	}, nil
+}
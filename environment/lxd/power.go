@@ -0,0 +1,273 @@
+package lxd
+
+import (
+	"bufio"
+	"context"
+	"github.com/apex/log"
+	"github.com/gorilla/websocket"
+	"github.com/pkg/errors"
+	"github.com/avatag-host/claws/api"
+	"github.com/avatag-host/claws/environment"
+	"io"
+	"io/ioutil"
+	"os"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+)
+
+// Starts the container for the server if it is not already running and then executes the
+// startup command for the server within it.
+func (e *Environment) Start(ctx context.Context) error {
+	if ok, _ := e.IsRunning(); ok {
+		return nil
+	}
+
+	e.setState(environment.ProcessStartingState)
+
+	if err := e.OnBeforeStart(ctx); err != nil {
+		e.setState(environment.ProcessOfflineState)
+		return err
+	}
+
+	if err := e.setContainerState("start", false); err != nil {
+		e.setState(environment.ProcessOfflineState)
+		return err
+	}
+
+	s, err := e.exec(context.Background(), []string{"/bin/sh", "-c", e.Configuration.StartupCommand()})
+	if err != nil {
+		e.setState(environment.ProcessOfflineState)
+		return err
+	}
+
+	done := make(chan struct{})
+
+	e.mu.Lock()
+	e.session = s
+	e.done = done
+	e.exitCode = 0
+	e.oomKilled = false
+	e.logs = nil
+	e.mu.Unlock()
+
+	r, w := io.Pipe()
+
+	var wg sync.WaitGroup
+	wg.Add(2)
+	for _, c := range []*websocket.Conn{s.stdout, s.stderr} {
+		go func(c *websocket.Conn) {
+			defer wg.Done()
+			copyOutput(c, w)
+		}(c)
+	}
+
+	go func() {
+		wg.Wait()
+		w.Close()
+	}()
+
+	go e.readOutput(r)
+	go e.pollResources(done)
+
+	go func() {
+		code, err := s.wait(context.Background())
+		if err != nil {
+			log.WithField("environment_id", e.Id).WithField("error", err).Warn("failed to determine exit code of server process")
+			code = 1
+		}
+		s.close()
+
+		// A process killed by the OOM killer exits with SIGKILL, so only check the OOM counter
+		// for the container when that is the case.
+		oom := code == 128+int(syscall.SIGKILL) && e.oomKillCount() > 0
+
+		// The container only exists to run the server process, so stop it once the process has
+		// exited.
+		if err := e.setContainerState("stop", true); err != nil {
+			log.WithField("environment_id", e.Id).WithField("error", err).Warn("failed to stop container after server process exited")
+		}
+
+		e.mu.Lock()
+		e.session = nil
+		e.exitCode = uint32(code)
+		e.oomKilled = oom
+		e.mu.Unlock()
+
+		close(done)
+		e.setState(environment.ProcessOfflineState)
+	}()
+
+	return nil
+}
+
+// Reads the output of the server process line by line and sends it to the console.
+func (e *Environment) readOutput(r io.Reader) {
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+
+	for scanner.Scan() {
+		e.writeLog(strings.TrimRight(scanner.Text(), "\r"))
+	}
+
+	// Make sure the writer side does not block if we stopped reading early.
+	_, _ = io.Copy(ioutil.Discard, r)
+}
+
+// Stops the server process using the configured stop command, or terminates it if there is
+// no stop command configured.
+func (e *Environment) Stop() error {
+	e.mu.RLock()
+	s := e.meta.Stop
+	e.mu.RUnlock()
+
+	if s.Type == "" || s.Type == api.ProcessStopSignal {
+		if s.Type == "" {
+			log.WithField("environment_id", e.Id).Warn("no stop configuration detected for environment, using termination procedure")
+		}
+
+		return e.Terminate(os.Kill)
+	}
+
+	if ok, _ := e.IsRunning(); !ok {
+		e.setState(environment.ProcessOfflineState)
+		return nil
+	}
+
+	e.setState(environment.ProcessStoppingState)
+
+	return e.SendCommand(s.Value)
+}
+
+// Stops the server process and waits for it to exit. If it does not exit before seconds have
+// passed it is terminated, or an error returned, depending on the value of terminate.
+func (e *Environment) WaitForStop(seconds uint, terminate bool) error {
+	if err := e.Stop(); err != nil {
+		return errors.WithStack(err)
+	}
+
+	e.mu.RLock()
+	done := e.done
+	e.mu.RUnlock()
+
+	if done == nil {
+		return nil
+	}
+
+	select {
+	case <-done:
+		return nil
+	case <-time.After(time.Duration(seconds) * time.Second):
+		if terminate {
+			log.WithField("environment_id", e.Id).Debug("server did not stop in time, executing process termination")
+
+			return e.Terminate(os.Kill)
+		}
+
+		return errors.WithStack(context.DeadlineExceeded)
+	}
+}
+
+// Sends the given signal to the server process. Killing the process stops the container
+// entirely so that any processes it left behind are also killed.
+func (e *Environment) Terminate(signal os.Signal) error {
+	e.mu.RLock()
+	s := e.session
+	e.mu.RUnlock()
+
+	if s == nil {
+		if e.State() != environment.ProcessOfflineState {
+			e.setState(environment.ProcessStoppingState)
+			e.setState(environment.ProcessOfflineState)
+		}
+
+		return nil
+	}
+
+	// We set it to stopping to prevent crash detection from being triggered once the process
+	// exits, at which point the state will be set to offline.
+	e.setState(environment.ProcessStoppingState)
+
+	sig, ok := signal.(syscall.Signal)
+	if signal == os.Kill || !ok {
+		return e.setContainerState("stop", true)
+	}
+
+	return s.signal(int(sig))
+}
+
+// Processes executed within the container are not able to be re-attached to once Wings has
+// been restarted, so there is nothing to attach to unless the process is already running. A
+// container left running by a previous instance of Wings is stopped instead.
+func (e *Environment) Attach() error {
+	if ok, _ := e.IsRunning(); !ok {
+		e.stopOrphanedContainer()
+
+		return ErrNotRunning
+	}
+
+	return nil
+}
+
+// Stops the container if it is running without a server process started by this instance of
+// Wings, since nothing would otherwise be managing the process running inside of it.
+func (e *Environment) stopOrphanedContainer() {
+	status, err := e.containerStatus()
+	if err != nil {
+		if !IsNotFound(err) {
+			log.WithField("environment_id", e.Id).WithField("error", err).Warn("failed to check for orphaned lxd container")
+		}
+
+		return
+	}
+
+	if status == "Stopped" {
+		return
+	}
+
+	log.WithField("environment_id", e.Id).WithField("status", status).Warn("stopping lxd container left running by a previous instance of wings")
+	if err := e.setContainerState("stop", true); err != nil {
+		log.WithField("environment_id", e.Id).WithField("error", err).Warn("failed to stop orphaned lxd container")
+	}
+}
+
+// Sends the provided command to the stdin of the server process.
+func (e *Environment) SendCommand(c string) error {
+	e.mu.RLock()
+	defer e.mu.RUnlock()
+
+	if e.session == nil {
+		return ErrNotRunning
+	}
+
+	if e.meta.Stop.Type == api.ProcessStopCommand && c == e.meta.Stop.Value {
+		e.Events().Publish(environment.StateChangeEvent, environment.ProcessStoppingState)
+	}
+
+	return e.session.write([]byte(c + "\n"))
+}
+
+// Freezes the container, pausing the server process and everything else running within it.
+func (e *Environment) Pause() error {
+	if ok, _ := e.IsRunning(); !ok {
+		return ErrNotRunning
+	}
+
+	return e.setContainerState("freeze", false)
+}
+
+// Resumes the processes within a frozen container.
+func (e *Environment) Unpause() error {
+	return e.setContainerState("unfreeze", false)
+}
+
+// Determines if the container is currently frozen.
+func (e *Environment) IsPaused() (bool, error) {
+	status, err := e.containerStatus()
+	if err != nil {
+		return false, err
+	}
+
+	return status == "Frozen", nil
+}
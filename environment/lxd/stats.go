@@ -0,0 +1,107 @@
+package lxd
+
+import (
+	"context"
+	"encoding/json"
+	"github.com/avatag-host/claws/environment"
+	"math"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// The subset of the LXD instance state used to report the resource usage of the server and
+// to find the addresses of the container.
+type instanceState struct {
+	Cpu struct {
+		Usage uint64 `json:"usage"`
+	} `json:"cpu"`
+	Memory struct {
+		Usage uint64 `json:"usage"`
+	} `json:"memory"`
+	Network map[string]struct {
+		Addresses []struct {
+			Family  string `json:"family"`
+			Address string `json:"address"`
+			Scope   string `json:"scope"`
+		} `json:"addresses"`
+		Counters struct {
+			BytesReceived uint64 `json:"bytes_received"`
+			BytesSent     uint64 `json:"bytes_sent"`
+		} `json:"counters"`
+	} `json:"network"`
+}
+
+// Emits the resource usage of the container until the done channel is closed.
+func (e *Environment) pollResources(done chan struct{}) {
+	ticker := time.NewTicker(e.Configuration.StatsInterval())
+	defer ticker.Stop()
+
+	var prevCpu uint64
+	var prevTime time.Time
+
+	for {
+		select {
+		case <-done:
+			return
+		case t := <-ticker.C:
+			var state instanceState
+			if _, err := e.client.request(context.Background(), http.MethodGet, e.path()+"/state", nil, &state); err != nil {
+				continue
+			}
+
+			st := &environment.Stats{}
+			st.Memory = state.Memory.Usage
+			if l := e.Configuration.Limits(); l.MemoryLimit > 0 {
+				st.MemoryLimit = uint64(l.BoundedMemoryLimit())
+			}
+
+			// The CPU usage reported by LXD is the total number of nanoseconds of CPU time used
+			// by the container.
+			if !prevTime.IsZero() {
+				if d := t.Sub(prevTime).Nanoseconds(); d > 0 && state.Cpu.Usage >= prevCpu {
+					st.CpuAbsolute = math.Round(float64(state.Cpu.Usage-prevCpu)/float64(d)*100*1000) / 1000
+				}
+			}
+
+			prevCpu = state.Cpu.Usage
+			prevTime = t
+
+			for name, n := range state.Network {
+				if name == "lo" {
+					continue
+				}
+
+				st.Network.RxBytes += n.Counters.BytesReceived
+				st.Network.TxBytes += n.Counters.BytesSent
+			}
+
+			if b, err := json.Marshal(st); err == nil {
+				e.Events().Publish(environment.ResourceEvent, string(b))
+			}
+		}
+	}
+}
+
+// Returns the number of times a process in the container has been killed by the OOM killer.
+func (e *Environment) oomKillCount() int {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*5)
+	defer cancel()
+
+	res, err := e.Exec(ctx, []string{"cat", "/sys/fs/cgroup/memory.events"}, 4096)
+	if err != nil || res.ExitCode != 0 {
+		return 0
+	}
+
+	for _, line := range strings.Split(res.Stdout, "\n") {
+		fields := strings.Fields(line)
+		if len(fields) == 2 && fields[0] == "oom_kill" {
+			i, _ := strconv.Atoi(fields[1])
+
+			return i
+		}
+	}
+
+	return 0
+}
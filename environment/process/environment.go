@@ -0,0 +1,268 @@
+package process
+
+import (
+	"context"
+	"fmt"
+	"github.com/pkg/errors"
+	"github.com/avatag-host/claws/api"
+	"github.com/avatag-host/claws/environment"
+	"github.com/avatag-host/claws/events"
+	"io"
+	"os"
+	"os/exec"
+	"strconv"
+	"sync"
+)
+
+// The number of lines of console output kept in memory so that they can be returned by
+// Readlog, since there is no container log to read them back from.
+const logBufferLines = 500
+
+var ErrNotRunning = errors.New("environment/process: server process is not running")
+
+type Metadata struct {
+	Stop api.ProcessStopConfiguration
+}
+
+// Ensure that the process environment is always implementing all of the methods from the
+// base environment interface.
+var _ environment.ProcessEnvironment = (*Environment)(nil)
+
+// An environment that runs the server process directly on the host as the system user rather
+// than within a container. Resource limits are applied using cgroups where they are available.
+type Environment struct {
+	mu      sync.RWMutex
+	eventMu sync.Mutex
+
+	// The public identifier for this environment, this is the server UUID.
+	Id string
+
+	// The environment configuration.
+	Configuration *environment.Configuration
+
+	meta *Metadata
+
+	// The currently running process, its stdin, and a channel that is closed once it exits.
+	cmd   *exec.Cmd
+	stdin io.WriteCloser
+	done  chan struct{}
+
+	exitCode  uint32
+	oomKilled bool
+
+	// Set while the process has been stopped with a signal to pause it.
+	paused bool
+
+	// The most recent lines of console output from the process.
+	logs []string
+
+	emitter *events.EventBus
+
+	// Tracks the environment state.
+	st   string
+	stMu sync.RWMutex
+}
+
+// Creates a new process environment for a server.
+func New(id string, m *Metadata, c *environment.Configuration) (*Environment, error) {
+	e := &Environment{
+		Id:            id,
+		Configuration: c,
+		meta:          m,
+		st:            environment.ProcessOfflineState,
+	}
+
+	return e, nil
+}
+
+func (e *Environment) Type() string {
+	return "process"
+}
+
+func (e *Environment) Config() *environment.Configuration {
+	e.mu.RLock()
+	defer e.mu.RUnlock()
+
+	return e.Configuration
+}
+
+func (e *Environment) Events() *events.EventBus {
+	e.eventMu.Lock()
+	defer e.eventMu.Unlock()
+
+	if e.emitter == nil {
+		e.emitter = events.New()
+	}
+
+	return e.emitter
+}
+
+// Sets the stop configuration for the environment.
+func (e *Environment) SetStopConfiguration(c api.ProcessStopConfiguration) {
+	e.mu.Lock()
+	e.meta.Stop = c
+	e.mu.Unlock()
+}
+
+// Returns the current environment state.
+func (e *Environment) State() string {
+	e.stMu.RLock()
+	defer e.stMu.RUnlock()
+
+	return e.st
+}
+
+// Sets the state of the environment and emits an event for it if it changed.
+func (e *Environment) setState(state string) {
+	e.stMu.Lock()
+	prev := e.st
+	e.st = state
+	e.stMu.Unlock()
+
+	if prev != state {
+		e.Events().Publish(environment.StateChangeEvent, state)
+	}
+}
+
+// Returns the directory the server process runs in, which is the default mount for the
+// server.
+func (e *Environment) workingDirectory() string {
+	for _, m := range e.Configuration.Mounts() {
+		if m.Default {
+			return m.Source
+		}
+	}
+
+	return ""
+}
+
+// There is nothing to create for a process environment, so the environment exists so long
+// as the server data directory does.
+func (e *Environment) Exists() (bool, error) {
+	if _, err := os.Stat(e.workingDirectory()); err != nil {
+		if os.IsNotExist(err) {
+			return false, nil
+		}
+
+		return false, errors.WithStack(err)
+	}
+
+	return true, nil
+}
+
+func (e *Environment) IsRunning() (bool, error) {
+	e.mu.RLock()
+	defer e.mu.RUnlock()
+
+	return e.cmd != nil, nil
+}
+
+// Applies the current resource limits to the running process.
+func (e *Environment) InSituUpdate() error {
+	if ok, _ := e.IsRunning(); !ok {
+		return nil
+	}
+
+	return e.applyLimits()
+}
+
+// Kills any processes left running for the server by a previous instance of Wings before a
+// new process is started for it.
+func (e *Environment) OnBeforeStart(ctx context.Context) error {
+	e.killOrphans()
+
+	if ok, err := e.Exists(); err != nil {
+		return err
+	} else if !ok {
+		return errors.New(fmt.Sprintf("environment/process: server directory %s does not exist", e.workingDirectory()))
+	}
+
+	return nil
+}
+
+// The server directory is created by the server filesystem, so there is nothing else that
+// needs to be created for the process environment.
+func (e *Environment) Create() error {
+	return nil
+}
+
+// Terminates the server process if it is running.
+func (e *Environment) Destroy() error {
+	e.setState(environment.ProcessStoppingState)
+
+	if err := e.Terminate(os.Kill); err != nil {
+		return err
+	}
+
+	e.setState(environment.ProcessOfflineState)
+
+	return nil
+}
+
+// Returns the exit code of the last process to run, and if it was killed for running out
+// of memory.
+func (e *Environment) ExitState() (uint32, bool, error) {
+	e.mu.RLock()
+	defer e.mu.RUnlock()
+
+	return e.exitCode, e.oomKilled, nil
+}
+
+// Returns up to the last n lines of console output from the server process.
+func (e *Environment) Readlog(n int) ([]string, error) {
+	e.mu.RLock()
+	defer e.mu.RUnlock()
+
+	if n > len(e.logs) {
+		n = len(e.logs)
+	}
+
+	out := make([]string, n)
+	copy(out, e.logs[len(e.logs)-n:])
+
+	return out, nil
+}
+
+// Records a line of console output and emits it to any listeners.
+func (e *Environment) writeLog(line string) {
+	e.mu.Lock()
+	e.logs = append(e.logs, line)
+	if len(e.logs) > logBufferLines {
+		e.logs = e.logs[len(e.logs)-logBufferLines:]
+	}
+	e.mu.Unlock()
+
+	e.Events().Publish(environment.ConsoleOutputEvent, line)
+}
+
+// Returns the processes running for the server. If the process is running in a cgroup all
+// of the processes in that cgroup are returned, otherwise only the main process is.
+func (e *Environment) Processes() (*environment.ProcessList, error) {
+	e.mu.RLock()
+	cmd := e.cmd
+	e.mu.RUnlock()
+
+	if cmd == nil {
+		return nil, ErrNotRunning
+	}
+
+	pids := e.cgroupProcesses()
+	if len(pids) == 0 {
+		pids = []int{cmd.Process.Pid}
+	}
+
+	out := &environment.ProcessList{Titles: []string{"PID", "CMD"}}
+	for _, pid := range pids {
+		out.Processes = append(out.Processes, []string{strconv.Itoa(pid), processCommand(pid)})
+	}
+
+	return out, nil
+}
+
+// The server process runs directly on the host, so it is reached on the address of its
+// default allocation.
+func (e *Environment) DirectAddress(port int) (string, error) {
+	a := e.Configuration.Allocations()
+
+	return a.LocalAddress(port), nil
+}
@@ -0,0 +1,360 @@
+package process
+
+import (
+	"bufio"
+	"context"
+	"github.com/apex/log"
+	"github.com/pkg/errors"
+	"github.com/avatag-host/claws/api"
+	"github.com/avatag-host/claws/config"
+	"github.com/avatag-host/claws/environment"
+	"io"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"strings"
+	"time"
+)
+
+// The search path used for server processes when Wings itself has none set.
+const defaultProcessPath = "/usr/local/sbin:/usr/local/bin:/usr/sbin:/usr/bin:/sbin:/bin"
+
+// Returns a command that runs in the server directory as the server user with the server
+// environment variables set.
+func (e *Environment) command(ctx context.Context, name string, args ...string) *exec.Cmd {
+	cmd := exec.CommandContext(ctx, name, args...)
+	cmd.Dir = e.workingDirectory()
+	cmd.Env = e.processEnvironment()
+	cmd.SysProcAttr = sysProcAttr(e.Configuration.User())
+
+	return cmd
+}
+
+// Returns the environment for server processes. This is deliberately not based on the
+// environment of Wings, which can contain the Panel token and credentials for secret stores,
+// so only the search path, home directory and the server variables are passed through.
+func (e *Environment) processEnvironment() []string {
+	path := os.Getenv("PATH")
+	if path == "" {
+		path = defaultProcessPath
+	}
+
+	return append([]string{"PATH=" + path, "HOME=" + e.workingDirectory()}, e.Configuration.EnvironmentVariables()...)
+}
+
+// Starts the server process and begins piping its output to the console.
+func (e *Environment) Start(ctx context.Context) error {
+	if ok, _ := e.IsRunning(); ok {
+		return nil
+	}
+
+	e.setState(environment.ProcessStartingState)
+
+	if err := e.OnBeforeStart(ctx); err != nil {
+		e.setState(environment.ProcessOfflineState)
+		return err
+	}
+
+	shell := config.Get().Process.Shell
+	cmd := e.command(context.Background(), shell, "-c", e.Configuration.StartupCommand())
+
+	stdin, err := cmd.StdinPipe()
+	if err != nil {
+		e.setState(environment.ProcessOfflineState)
+		return errors.WithStack(err)
+	}
+
+	r, w := io.Pipe()
+	cmd.Stdout = w
+	cmd.Stderr = w
+
+	release, err := holdStartup(cmd)
+	if err != nil {
+		e.setState(environment.ProcessOfflineState)
+		return err
+	}
+
+	if err := cmd.Start(); err != nil {
+		release()
+		e.setState(environment.ProcessOfflineState)
+		return errors.WithStack(err)
+	}
+
+	e.recordProcess(cmd.Process.Pid)
+
+	// The shell waits to run the startup command until it has been moved into the cgroup, so
+	// that every process it starts is subject to the limits. If that is not possible the
+	// server is not started at all rather than running without any limits.
+	if err := e.joinCgroup(cmd.Process.Pid); err != nil {
+		_ = cmd.Process.Kill()
+		release()
+		w.Close()
+		_ = cmd.Wait()
+
+		e.removeCgroup()
+		e.forgetProcess()
+		e.setState(environment.ProcessOfflineState)
+
+		return errors.Wrap(err, "environment/process: failed to apply resource limits to server process")
+	}
+	release()
+
+	done := make(chan struct{})
+
+	e.mu.Lock()
+	e.cmd = cmd
+	e.stdin = stdin
+	e.done = done
+	e.exitCode = 0
+	e.oomKilled = false
+	e.logs = nil
+	e.mu.Unlock()
+
+	go e.readOutput(r)
+	go e.pollResources(done)
+
+	go func() {
+		err := cmd.Wait()
+		w.Close()
+
+		var code uint32
+		if err != nil {
+			code = 1
+			if ee, ok := err.(*exec.ExitError); ok && ee.ExitCode() >= 0 {
+				code = uint32(ee.ExitCode())
+			}
+		}
+
+		oom := e.cgroupOomKilled()
+		e.removeCgroup()
+		e.forgetProcess()
+
+		e.mu.Lock()
+		e.cmd = nil
+		e.stdin = nil
+		e.paused = false
+		e.exitCode = code
+		e.oomKilled = oom
+		e.mu.Unlock()
+
+		close(done)
+		e.setState(environment.ProcessOfflineState)
+	}()
+
+	return nil
+}
+
+// Reads the output of the server process line by line and sends it to the console.
+func (e *Environment) readOutput(r io.Reader) {
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+
+	for scanner.Scan() {
+		e.writeLog(strings.TrimRight(scanner.Text(), "\r"))
+	}
+
+	// Make sure the writer side does not block if we stopped reading early.
+	_, _ = io.Copy(ioutil.Discard, r)
+}
+
+// Stops the server process using the configured stop command, or terminates it if there is
+// no stop command configured.
+func (e *Environment) Stop() error {
+	e.mu.RLock()
+	s := e.meta.Stop
+	e.mu.RUnlock()
+
+	if s.Type == "" || s.Type == api.ProcessStopSignal {
+		if s.Type == "" {
+			log.WithField("environment_id", e.Id).Warn("no stop configuration detected for environment, using termination procedure")
+		}
+
+		return e.Terminate(os.Kill)
+	}
+
+	if ok, _ := e.IsRunning(); !ok {
+		e.setState(environment.ProcessOfflineState)
+		return nil
+	}
+
+	e.setState(environment.ProcessStoppingState)
+
+	return e.SendCommand(s.Value)
+}
+
+// Stops the server process and waits for it to exit. If it does not exit before seconds have
+// passed it is terminated, or an error returned, depending on the value of terminate.
+func (e *Environment) WaitForStop(seconds uint, terminate bool) error {
+	if err := e.Stop(); err != nil {
+		return errors.WithStack(err)
+	}
+
+	e.mu.RLock()
+	done := e.done
+	e.mu.RUnlock()
+
+	if done == nil {
+		return nil
+	}
+
+	select {
+	case <-done:
+		return nil
+	case <-time.After(time.Duration(seconds) * time.Second):
+		if terminate {
+			log.WithField("environment_id", e.Id).Debug("server did not stop in time, executing process termination")
+
+			return e.Terminate(os.Kill)
+		}
+
+		return errors.WithStack(context.DeadlineExceeded)
+	}
+}
+
+// Sends the given signal to the server process and all of its children.
+func (e *Environment) Terminate(signal os.Signal) error {
+	e.mu.RLock()
+	cmd := e.cmd
+	e.mu.RUnlock()
+
+	if cmd == nil {
+		if e.State() != environment.ProcessOfflineState {
+			e.setState(environment.ProcessStoppingState)
+			e.setState(environment.ProcessOfflineState)
+		}
+
+		return nil
+	}
+
+	// We set it to stopping to prevent crash detection from being triggered once the process
+	// exits, at which point the state will be set to offline.
+	e.setState(environment.ProcessStoppingState)
+
+	return errors.WithStack(signalProcess(cmd.Process, signal))
+}
+
+// Pauses the server process and all of its children by sending them a stop signal.
+func (e *Environment) Pause() error {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	if e.cmd == nil {
+		return ErrNotRunning
+	}
+
+	if err := pauseProcess(e.cmd.Process, true); err != nil {
+		return err
+	}
+	e.paused = true
+
+	return nil
+}
+
+// Resumes a paused server process and all of its children.
+func (e *Environment) Unpause() error {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	if e.cmd == nil || !e.paused {
+		return nil
+	}
+
+	if err := pauseProcess(e.cmd.Process, false); err != nil {
+		return err
+	}
+	e.paused = false
+
+	return nil
+}
+
+// Determines if the server process is currently paused.
+func (e *Environment) IsPaused() (bool, error) {
+	e.mu.RLock()
+	defer e.mu.RUnlock()
+
+	return e.paused, nil
+}
+
+// The process environment is always attached to the process it is running, and processes
+// are not able to be re-attached to once Wings has been restarted. Any processes left running
+// by a previous instance of Wings are killed instead.
+func (e *Environment) Attach() error {
+	if ok, _ := e.IsRunning(); !ok {
+		e.killOrphans()
+
+		return ErrNotRunning
+	}
+
+	return nil
+}
+
+// Sends the provided command to the stdin of the server process.
+func (e *Environment) SendCommand(c string) error {
+	e.mu.RLock()
+	defer e.mu.RUnlock()
+
+	if e.stdin == nil {
+		return ErrNotRunning
+	}
+
+	if e.meta.Stop.Type == api.ProcessStopCommand && c == e.meta.Stop.Value {
+		e.Events().Publish(environment.StateChangeEvent, environment.ProcessStoppingState)
+	}
+
+	_, err := e.stdin.Write([]byte(c + "\n"))
+
+	return errors.WithStack(err)
+}
+
+// Runs a one-off command in the server directory as the system user. If the context is
+// cancelled before the command completes it is killed, along with anything it started.
+func (e *Environment) Exec(ctx context.Context, cmd []string, limit int) (*environment.ExecResult, error) {
+	if len(cmd) == 0 {
+		return nil, errors.New("environment/process: no command provided to exec")
+	}
+
+	stdout := environment.NewLimitedBuffer(limit)
+	stderr := environment.NewLimitedBuffer(limit)
+
+	c := e.command(context.Background(), cmd[0], cmd[1:]...)
+	c.Stdout = stdout
+	c.Stderr = stderr
+
+	if err := c.Start(); err != nil {
+		return nil, errors.WithStack(err)
+	}
+
+	// The command runs in its own process group, so the whole group is killed rather than only
+	// the command itself.
+	exited := make(chan struct{})
+	go func() {
+		select {
+		case <-ctx.Done():
+			_ = signalProcess(c.Process, os.Kill)
+		case <-exited:
+		}
+	}()
+
+	err := c.Wait()
+	close(exited)
+
+	res := &environment.ExecResult{}
+	if err != nil {
+		if ctx.Err() != nil {
+			return nil, errors.WithStack(ctx.Err())
+		}
+
+		ee, ok := err.(*exec.ExitError)
+		if !ok {
+			return nil, errors.WithStack(err)
+		}
+
+		res.ExitCode = ee.ExitCode()
+	}
+
+	res.Stdout = stdout.String()
+	res.Stderr = stderr.String()
+	res.Truncated = stdout.Truncated() || stderr.Truncated()
+
+	return res, nil
+}
@@ -0,0 +1,308 @@
+package process
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"github.com/apex/log"
+	"github.com/pkg/errors"
+	"github.com/avatag-host/claws/config"
+	"github.com/avatag-host/claws/environment"
+	"io/ioutil"
+	"math"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+)
+
+// Runs the server process in its own process group so that signals can be sent to all of
+// its children, and as the given user if Wings is running as root. The process is killed if
+// Wings exits, since it cannot be attached to again once Wings has been restarted.
+func sysProcAttr(uid int, gid int) *syscall.SysProcAttr {
+	attr := &syscall.SysProcAttr{Setpgid: true, Pdeathsig: syscall.SIGKILL}
+
+	if os.Getuid() == 0 {
+		uid, gid := config.Get().System.FileOwnerFor(uid, gid)
+		attr.Credential = &syscall.Credential{Uid: uint32(uid), Gid: uint32(gid)}
+	}
+
+	return attr
+}
+
+// Sends a signal to the process group of the given process.
+func signalProcess(p *os.Process, signal os.Signal) error {
+	sig, ok := signal.(syscall.Signal)
+	if !ok {
+		return p.Signal(signal)
+	}
+
+	return syscall.Kill(-p.Pid, sig)
+}
+
+// Stops or continues the process group of the given process.
+func pauseProcess(p *os.Process, pause bool) error {
+	sig := syscall.SIGCONT
+	if pause {
+		sig = syscall.SIGSTOP
+	}
+
+	return errors.WithStack(syscall.Kill(-p.Pid, sig))
+}
+
+// Holds the shell running the startup command until the returned function is called, by
+// having it wait for a pipe passed to it to be closed before running the command. This allows
+// the shell to be moved into the cgroup for the environment before it starts any processes,
+// all of which then inherit the cgroup and its limits.
+func holdStartup(cmd *exec.Cmd) (func(), error) {
+	r, w, err := os.Pipe()
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+
+	cmd.ExtraFiles = append(cmd.ExtraFiles, r)
+	fd := 2 + len(cmd.ExtraFiles)
+	cmd.Args[len(cmd.Args)-1] = fmt.Sprintf("read -r _ <&%d; exec %d<&-\n", fd, fd) + cmd.Args[len(cmd.Args)-1]
+
+	return func() {
+		r.Close()
+		w.Close()
+	}, nil
+}
+
+// Returns the file the process group of the running server process is recorded in, so that
+// it can be found again if Wings exits without stopping it.
+func (e *Environment) processFile() string {
+	return filepath.Join(config.Get().System.RootDirectory, "processes", e.Id)
+}
+
+// Records the process group of the server process along with the current boot ID, since the
+// process group cannot be running once the machine has been restarted.
+func (e *Environment) recordProcess(pid int) {
+	err := os.MkdirAll(filepath.Dir(e.processFile()), 0700)
+	if err == nil {
+		err = ioutil.WriteFile(e.processFile(), []byte(fmt.Sprintf("%d %s", pid, bootId())), 0600)
+	}
+
+	if err != nil {
+		log.WithField("environment_id", e.Id).WithField("error", err).Warn("failed to record server process group")
+	}
+}
+
+// Removes the record of the server process once it has exited.
+func (e *Environment) forgetProcess() {
+	if err := os.Remove(e.processFile()); err != nil && !os.IsNotExist(err) {
+		log.WithField("environment_id", e.Id).WithField("error", err).Warn("failed to remove server process group record")
+	}
+}
+
+// Kills any processes left running for the environment by a previous instance of Wings,
+// using both the cgroup for the environment and the recorded process group. Wings cannot
+// attach to these processes again, so they would otherwise keep running unmanaged alongside
+// any process started for the server.
+func (e *Environment) killOrphans() {
+	killed := 0
+	for _, pid := range e.cgroupProcesses() {
+		if syscall.Kill(pid, syscall.SIGKILL) == nil {
+			killed++
+		}
+	}
+
+	if b, err := ioutil.ReadFile(e.processFile()); err == nil {
+		// The process group can only be the one started by Wings if the machine has not been
+		// restarted since, otherwise the ID could belong to an unrelated process.
+		if f := strings.Fields(string(b)); len(f) == 2 && f[1] == bootId() {
+			if pgid, err := strconv.Atoi(f[0]); err == nil && pgid > 1 && syscall.Kill(-pgid, syscall.SIGKILL) == nil {
+				killed++
+			}
+		}
+
+		e.forgetProcess()
+	}
+
+	if killed > 0 {
+		log.WithField("environment_id", e.Id).Warn("killed server processes left running by a previous instance of wings")
+	}
+}
+
+// Returns the ID of the current boot of the machine.
+func bootId() string {
+	b, _ := ioutil.ReadFile("/proc/sys/kernel/random/boot_id")
+
+	return strings.TrimSpace(string(b))
+}
+
+// Returns the cgroup directory for the environment.
+func (e *Environment) cgroupDirectory() string {
+	return filepath.Join(config.Get().Process.CgroupRoot, e.Id)
+}
+
+// Creates the cgroup for the environment, applies the resource limits to it and moves the
+// given process into it.
+func (e *Environment) joinCgroup(pid int) error {
+	if err := os.MkdirAll(e.cgroupDirectory(), 0755); err != nil {
+		return errors.WithStack(err)
+	}
+
+	if err := e.applyLimits(); err != nil {
+		return err
+	}
+
+	return writeCgroupFile(e.cgroupDirectory(), "cgroup.procs", strconv.Itoa(pid))
+}
+
+// Writes the CPU and memory limits for the environment to its cgroup.
+func (e *Environment) applyLimits() error {
+	dir := e.cgroupDirectory()
+	if _, err := os.Stat(dir); err != nil {
+		return errors.WithStack(err)
+	}
+
+	l := e.Configuration.Limits()
+
+	memory, swap := "max", "max"
+	if l.MemoryLimit > 0 {
+		memory = strconv.FormatInt(l.BoundedMemoryLimit(), 10)
+		if l.Swap >= 0 {
+			swap = strconv.FormatInt(l.Swap*1_000_000, 10)
+		}
+	}
+
+	cpu := "max 100000"
+	if l.CpuLimit > 0 {
+		cpu = fmt.Sprintf("%d 100000", l.ConvertedCpuLimit())
+	}
+
+	if err := writeCgroupFile(dir, "memory.max", memory); err != nil {
+		return err
+	}
+
+	// Swap accounting is not always enabled, so don't fail if it cannot be set.
+	_ = writeCgroupFile(dir, "memory.swap.max", swap)
+
+	return writeCgroupFile(dir, "cpu.max", cpu)
+}
+
+// Removes the cgroup for the environment. This only succeeds once every process in it has
+// exited.
+func (e *Environment) removeCgroup() {
+	if err := os.Remove(e.cgroupDirectory()); err != nil && !os.IsNotExist(err) {
+		log.WithField("environment_id", e.Id).WithField("error", err).Debug("failed to remove cgroup for environment")
+	}
+}
+
+// Determines if a process in the cgroup was killed by the OOM killer.
+func (e *Environment) cgroupOomKilled() bool {
+	v, err := readKeyedValue(filepath.Join(e.cgroupDirectory(), "memory.events"), "oom_kill")
+
+	return err == nil && v > 0
+}
+
+// Returns the IDs of all of the processes in the cgroup for the environment.
+func (e *Environment) cgroupProcesses() []int {
+	b, err := ioutil.ReadFile(filepath.Join(e.cgroupDirectory(), "cgroup.procs"))
+	if err != nil {
+		return nil
+	}
+
+	var out []int
+	for _, f := range strings.Fields(string(b)) {
+		if pid, err := strconv.Atoi(f); err == nil {
+			out = append(out, pid)
+		}
+	}
+
+	return out
+}
+
+// Returns the command line for a process.
+func processCommand(pid int) string {
+	b, err := ioutil.ReadFile(fmt.Sprintf("/proc/%d/cmdline", pid))
+	if err != nil {
+		return ""
+	}
+
+	return strings.TrimSpace(strings.ReplaceAll(string(b), "\x00", " "))
+}
+
+// Emits the resource usage of the environment from its cgroup until the done channel is
+// closed.
+func (e *Environment) pollResources(done chan struct{}) {
+	dir := e.cgroupDirectory()
+	ticker := time.NewTicker(e.Configuration.StatsInterval())
+	defer ticker.Stop()
+
+	var prevCpu uint64
+	var prevTime time.Time
+
+	for {
+		select {
+		case <-done:
+			return
+		case t := <-ticker.C:
+			cpu, err := readKeyedValue(filepath.Join(dir, "cpu.stat"), "usage_usec")
+			if err != nil {
+				continue
+			}
+
+			st := &environment.Stats{}
+			st.Memory, _ = readUint(filepath.Join(dir, "memory.current"))
+			if limit, err := readUint(filepath.Join(dir, "memory.max")); err == nil {
+				st.MemoryLimit = limit
+			}
+
+			if !prevTime.IsZero() {
+				if d := t.Sub(prevTime).Microseconds(); d > 0 && cpu >= prevCpu {
+					st.CpuAbsolute = math.Round(float64(cpu-prevCpu)/float64(d)*100*1000) / 1000
+				}
+			}
+
+			prevCpu = cpu
+			prevTime = t
+
+			if b, err := json.Marshal(st); err == nil {
+				e.Events().Publish(environment.ResourceEvent, string(b))
+			}
+		}
+	}
+}
+
+func writeCgroupFile(dir string, name string, value string) error {
+	return errors.WithStack(ioutil.WriteFile(filepath.Join(dir, name), []byte(value), 0644))
+}
+
+// Reads a file containing a single unsigned integer value.
+func readUint(p string) (uint64, error) {
+	b, err := ioutil.ReadFile(p)
+	if err != nil {
+		return 0, errors.WithStack(err)
+	}
+
+	i, err := strconv.ParseUint(strings.TrimSpace(string(b)), 10, 64)
+
+	return i, errors.WithStack(err)
+}
+
+// Reads the value for a given key out of a file containing "key value" pairs on each line.
+func readKeyedValue(p string, key string) (uint64, error) {
+	f, err := os.Open(p)
+	if err != nil {
+		return 0, errors.WithStack(err)
+	}
+	defer f.Close()
+
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) >= 2 && fields[0] == key {
+			i, err := strconv.ParseUint(fields[1], 10, 64)
+
+			return i, errors.WithStack(err)
+		}
+	}
+
+	return 0, errors.New(fmt.Sprintf("environment/process: key %s not found in %s", key, p))
+}
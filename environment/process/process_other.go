@@ -0,0 +1,60 @@
+// +build !linux
+
+package process
+
+import (
+	"errors"
+	"os"
+	"os/exec"
+	"syscall"
+)
+
+var errCgroupUnsupported = errors.New("environment/process: resource limits are only supported on Linux")
+var errPauseUnsupported = errors.New("environment/process: pausing processes is only supported on Linux")
+
+func sysProcAttr(uid int, gid int) *syscall.SysProcAttr {
+	return nil
+}
+
+func signalProcess(p *os.Process, signal os.Signal) error {
+	// Only killing a process is supported on all platforms.
+	return p.Kill()
+}
+
+func pauseProcess(p *os.Process, pause bool) error {
+	return errPauseUnsupported
+}
+
+func holdStartup(cmd *exec.Cmd) (func(), error) {
+	return func() {}, nil
+}
+
+func (e *Environment) recordProcess(pid int) {}
+
+func (e *Environment) forgetProcess() {}
+
+func (e *Environment) killOrphans() {}
+
+func (e *Environment) joinCgroup(pid int) error {
+	return errCgroupUnsupported
+}
+
+func (e *Environment) applyLimits() error {
+	return nil
+}
+
+func (e *Environment) removeCgroup() {}
+
+func (e *Environment) cgroupOomKilled() bool {
+	return false
+}
+
+func (e *Environment) cgroupProcesses() []int {
+	return nil
+}
+
+func processCommand(pid int) string {
+	return ""
+}
+
+func (e *Environment) pollResources(done chan struct{}) {}
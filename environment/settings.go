@@ -3,8 +3,13 @@ package environment
 import (
 	"fmt"
 	"github.com/apex/log"
+	"github.com/avatag-host/claws/config"
 	"math"
+	"net"
+	"path/filepath"
+	"regexp"
 	"strconv"
+	"strings"
 )
 
 type Mount struct {
@@ -27,6 +32,244 @@ type Mount struct {
 	ReadOnly bool `json:"read_only"`
 }
 
+// Defines a device on the host system that should be made available within the server
+// environment, such as a GPU or sound card.
+type DeviceMapping struct {
+	// The path to the device on the host system.
+	PathOnHost string `json:"path_on_host"`
+
+	// The path the device will be available at within the environment. If this is empty
+	// the device will be mapped to the same path it has on the host.
+	PathInContainer string `json:"path_in_container"`
+
+	// The cgroup permissions the environment is given for the device, defaults to "rwm".
+	Permissions string `json:"permissions"`
+}
+
+// Defines an in-memory tmpfs filesystem that should be mounted within the server environment,
+// useful for temporary or cache directories that see a lot of writes.
+type TmpfsMount struct {
+	// The absolute path within the environment to mount the filesystem at.
+	Path string `json:"path"`
+
+	// The size of the filesystem in megabytes. If this is zero the default tmpfs size from
+	// the node configuration is used.
+	Size uint `json:"size"`
+}
+
+// Defines a resource limit applied to the processes within a server environment.
+type Ulimit struct {
+	// The name of the limit, such as "nofile" or "nproc".
+	Name string `json:"name"`
+	Soft int64  `json:"soft"`
+	Hard int64  `json:"hard"`
+}
+
+// The ulimits that a server is able to configure for its environment.
+var configurableUlimits = map[string]bool{
+	"nofile":  true,
+	"nproc":   true,
+	"memlock": true,
+	"core":    true,
+	"stack":   true,
+}
+
+// Determines if a ulimit can be configured for a server environment, and that the soft and
+// hard values for it are sensible.
+func (u Ulimit) Valid() bool {
+	return configurableUlimits[u.Name] && u.Soft >= 0 && u.Hard >= u.Soft
+}
+
+const (
+	// Sidecars sharing the network namespace of the server can reach it over the loopback
+	// interface and expose ports through the server allocations.
+	SidecarNetworkShared = "shared"
+
+	// Sidecars using the default network are isolated from the server network namespace
+	// but are still able to reach it over the container network.
+	SidecarNetworkDefault = "default"
+)
+
+var sidecarNameRegex = regexp.MustCompile(`^[a-z0-9_-]{1,32}$`)
+
+// Defines an auxiliary container that is run alongside a server, such as a proxy or metrics
+// exporter. Sidecars are started after the server and stopped whenever the server stops.
+type Sidecar struct {
+	// A unique name for the sidecar, this is used to name the container.
+	Name string `json:"name"`
+
+	// The image used for the sidecar container.
+	Image string `json:"image"`
+
+	// The command to run, if empty the default command for the image is used.
+	Command []string `json:"command,omitempty"`
+
+	// Environment variables for the sidecar in "KEY=value" format.
+	Environment []string `json:"environment,omitempty"`
+
+	// Determines how the sidecar is networked with the server, either "shared" or "default".
+	Network string `json:"network"`
+
+	// Mounts the server data directory into the sidecar as read-only at /home/container.
+	MountData bool `json:"mount_data"`
+
+	// The amount of memory in megabytes the sidecar may use, and the percentage of CPU it may
+	// use. If these are zero the defaults from the node configuration are used.
+	MemoryLimit int64 `json:"memory_limit"`
+	CpuLimit    int64 `json:"cpu_limit"`
+}
+
+// Determines if the sidecar definition is valid.
+func (s Sidecar) Valid() bool {
+	if !sidecarNameRegex.MatchString(s.Name) || s.Image == "" {
+		return false
+	}
+
+	return s.Network == "" || s.Network == SidecarNetworkShared || s.Network == SidecarNetworkDefault
+}
+
+// Determines if an extra hosts entry is in the valid "host:ip" format.
+func IsValidExtraHost(h string) bool {
+	parts := strings.SplitN(h, ":", 2)
+
+	return len(parts) == 2 && parts[0] != "" && net.ParseIP(parts[1]) != nil
+}
+
+// Determines if a device on the host is allowed to be mapped into a server environment by
+// checking it against the allowlist defined in the node configuration.
+func IsDeviceAllowed(p string) bool {
+	if p == "" || !filepath.IsAbs(p) || filepath.Clean(p) != p {
+		return false
+	}
+
+	for _, pattern := range config.Get().Docker.AllowedDevices {
+		if ok, _ := filepath.Match(pattern, p); ok {
+			return true
+		}
+	}
+
+	return false
+}
+
+// Normalizes the name of a Linux capability into the format used in the node configuration,
+// which is uppercase without the "CAP_" prefix.
+func NormalizeCapability(c string) string {
+	return strings.TrimPrefix(strings.ToUpper(strings.TrimSpace(c)), "CAP_")
+}
+
+// Determines if a capability is allowed to be added to a server environment by checking it
+// against the allowlist defined in the node configuration.
+func IsCapabilityAllowed(c string) bool {
+	c = NormalizeCapability(c)
+	if c == "" || c == "ALL" {
+		return false
+	}
+
+	for _, a := range config.Get().Docker.Security.AllowedCapabilities {
+		if NormalizeCapability(a) == c {
+			return true
+		}
+	}
+
+	return false
+}
+
+// Determines if a server environment is allowed to join the given user-defined network by
+// checking it against the allowlist defined in the node configuration.
+func IsNetworkAllowed(name string) bool {
+	if name == "" {
+		return false
+	}
+
+	for _, n := range config.Get().Docker.Network.AllowedNetworks {
+		if n == name {
+			return true
+		}
+	}
+
+	return false
+}
+
+// Defines settings that control how the container for a server environment is created
+// that are not related to the resource limits of the server.
+type ContainerSettings struct {
+	// Defines the Docker image that will be used for this server
+	Image string `json:"image,omitempty"`
+
+	// Host devices that should be mapped into the environment. Only devices that are allowed
+	// by the node configuration will actually be mapped.
+	Devices []DeviceMapping `json:"devices,omitempty"`
+
+	// Additional user-defined networks the container should be connected to alongside the
+	// default network. Only networks allowed by the node configuration will be joined.
+	Networks []string `json:"networks,omitempty"`
+
+	// Additional tmpfs mounts for the environment. The combined size of these mounts is capped
+	// by the node configuration.
+	Tmpfs []TmpfsMount `json:"tmpfs,omitempty"`
+
+	// The name of the seccomp profile to use for the environment in place of the node default.
+	// This must be the name of a profile in the node's profile directory, or "unconfined".
+	SeccompProfile string `json:"seccomp_profile,omitempty"`
+
+	// The name of the AppArmor profile to use for the environment in place of the node default.
+	AppArmorProfile string `json:"apparmor_profile,omitempty"`
+
+	// Linux capabilities to add to the environment. Only capabilities allowed by the node
+	// configuration will actually be added.
+	CapAdd []string `json:"cap_add,omitempty"`
+
+	// Additional Linux capabilities to drop from the environment.
+	CapDrop []string `json:"cap_drop,omitempty"`
+
+	// The size of /dev/shm for the environment in megabytes. If this is zero the Docker default
+	// is used. This is capped by the node configuration.
+	ShmSize uint `json:"shm_size,omitempty"`
+
+	// Resource limits applied to the processes running in the environment.
+	Ulimits []Ulimit `json:"ulimits,omitempty"`
+
+	// Runs the environment using the host network rather than an isolated network. This is only
+	// applied if the node configuration allows it.
+	HostNetwork bool `json:"host_network,omitempty"`
+
+	// Additional entries to add to the hosts file of the environment, in the "host:ip" format.
+	ExtraHosts []string `json:"extra_hosts,omitempty"`
+
+	// DNS servers and search domains for the environment. If no servers are defined the DNS
+	// servers from the node configuration are used.
+	Dns       []string `json:"dns,omitempty"`
+	DnsSearch []string `json:"dns_search,omitempty"`
+
+	// Auxiliary containers run alongside the server. The number of sidecars is limited by the
+	// node configuration.
+	Sidecars []Sidecar `json:"sidecars,omitempty"`
+
+	// Labels applied to the environment in addition to those defined in the node configuration.
+	Labels map[string]string `json:"labels,omitempty"`
+
+	// The Docker restart policy for the environment, one of "no", "on-failure", "unless-stopped"
+	// or "always". This allows the server to be brought back up by Docker itself if the daemon
+	// is not running. Defaults to "no".
+	RestartPolicy string `json:"restart_policy,omitempty"`
+
+	// The maximum number of times Docker will restart the environment when using the
+	// "on-failure" restart policy. Zero means there is no limit.
+	RestartRetries int `json:"restart_retries,omitempty"`
+
+	// The name of the Docker endpoint from the node configuration that the environment runs on.
+	// If empty the local Docker daemon is used.
+	DockerEndpoint string `json:"docker_endpoint,omitempty"`
+
+	// Determines when the image for the environment is pulled, overriding the node default.
+	// One of "always", "if-not-present" or "never".
+	PullPolicy string `json:"pull_policy,omitempty"`
+
+	// Credentials used when pulling images from a single registry for this server, taking
+	// priority over any registry credentials defined in the node configuration.
+	RegistryAuth *config.RegistryOverride `json:"registry_auth,omitempty"`
+}
+
 // The build settings for a given server that impact docker container creation and
 // resource limits for a server instance.
 type Limits struct {
@@ -41,6 +284,14 @@ type Limits struct {
 	// containers on the system and should be a value between 10 and 1000.
 	IoWeight uint16 `json:"io_weight"`
 
+	// The maximum rate at which the server may read from and write to the disk, in bytes
+	// and operations per second. These limits are applied to each of the throttled devices
+	// defined in the node configuration, a value of zero means there is no limit.
+	IoReadBps   uint64 `json:"io_read_bps"`
+	IoWriteBps  uint64 `json:"io_write_bps"`
+	IoReadIops  uint64 `json:"io_read_iops"`
+	IoWriteIops uint64 `json:"io_write_iops"`
+
 	// The percentage of CPU that this instance is allowed to consume relative to
 	// the host. A value of 200% represents complete utilization of two cores. This
 	// should be a value between 1 and THREAD_COUNT * 100.
@@ -52,7 +303,16 @@ type Limits struct {
 	// Sets which CPU threads can be used by the docker instance.
 	Threads string `json:"threads"`
 
+	// Sets which memory nodes can be used by the docker instance. This is only effective on
+	// NUMA systems, and is normally used alongside Threads to keep a server on a single node.
+	CpusetMems string `json:"cpuset_mems"`
+
 	OOMDisabled bool `json:"oom_disabled"`
+
+	// Adjusts how likely the server process is to be killed by the kernel when the host runs
+	// out of memory, between -1000 and 1000. Negative values are limited by the minimum defined
+	// in the node configuration.
+	OomScoreAdj int `json:"oom_score_adj"`
 }
 
 // Converts the CPU limit for a server build into a number that can be better understood
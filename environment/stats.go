@@ -32,6 +32,15 @@ type Stats struct {
 		RxBytes uint64 `json:"rx_bytes"`
 		TxBytes uint64 `json:"tx_bytes"`
 	} `json:"network"`
+
+	// The total bytes read from and written to block devices by the server process, along
+	// with the current number of read and write operations being performed per second.
+	Io struct {
+		ReadBytes  uint64 `json:"read_bytes"`
+		WriteBytes uint64 `json:"write_bytes"`
+		ReadIops   uint64 `json:"read_iops"`
+		WriteIops  uint64 `json:"write_iops"`
+	} `json:"io"`
 }
 
 // Resets the usages values to zero, used when a server is stopped to ensure we don't hold
@@ -44,4 +53,8 @@ func (s *Stats) Empty() {
 	s.CpuAbsolute = 0
 	s.Network.TxBytes = 0
 	s.Network.RxBytes = 0
+	s.Io.ReadBytes = 0
+	s.Io.WriteBytes = 0
+	s.Io.ReadIops = 0
+	s.Io.WriteIops = 0
 }
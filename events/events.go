@@ -2,6 +2,7 @@ package events
 
 import (
 	"encoding/json"
+	"github.com/apex/log"
 	"github.com/gammazero/workerpool"
 	"github.com/pkg/errors"
 	"strings"
@@ -11,11 +12,18 @@ import (
 type Event struct {
 	Data  string
 	Topic string
+
+	// The sequence number assigned to the event by the journal, or zero if the event was
+	// not recorded.
+	Sequence uint64
 }
 
 type EventBus struct {
 	mu    sync.RWMutex
 	pools map[string]*CallbackPool
+
+	journal       *Journal
+	journalTopics map[string]bool
 }
 
 func New() *EventBus {
@@ -40,6 +48,15 @@ func (e *EventBus) Publish(topic string, data string) {
 		}
 	}
 
+	var seq uint64
+	if j, ok := e.journalFor(t); ok {
+		r, err := j.Append(topic, data)
+		if err != nil {
+			log.WithField("error", err).Warn("failed to write event to journal")
+		}
+		seq = r.Sequence
+	}
+
 	e.mu.RLock()
 	defer e.mu.RUnlock()
 
@@ -49,7 +66,7 @@ func (e *EventBus) Publish(topic string, data string) {
 	if cp, ok := e.pools[t]; ok {
 		for _, callback := range cp.callbacks {
 			c := *callback
-			evt := Event{Data: data, Topic: topic}
+			evt := Event{Data: data, Topic: topic, Sequence: seq}
 			// Using the workerpool with one worker allows us to execute events in a FIFO manner. Running
 			// this using goroutines would cause things such as console output to just output in random order
 			// if more than one event is fired at the same time.
@@ -65,6 +82,38 @@ func (e *EventBus) Publish(topic string, data string) {
 	}
 }
 
+// Records every event published on one of the given topics in the journal, so that they can
+// be replayed later using Journal.Since.
+func (e *EventBus) SetJournal(j *Journal, topics ...string) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	e.journal = j
+	e.journalTopics = make(map[string]bool, len(topics))
+	for _, t := range topics {
+		e.journalTopics[t] = true
+	}
+}
+
+// Returns the journal for the bus, or nil if events are not being recorded.
+func (e *EventBus) Journal() *Journal {
+	e.mu.RLock()
+	defer e.mu.RUnlock()
+
+	return e.journal
+}
+
+func (e *EventBus) journalFor(topic string) (*Journal, bool) {
+	e.mu.RLock()
+	defer e.mu.RUnlock()
+
+	if e.journal == nil || !e.journalTopics[topic] {
+		return nil, false
+	}
+
+	return e.journal, true
+}
+
 // Publishes a JSON message to a given topic.
 func (e *EventBus) PublishJson(topic string, data interface{}) error {
 	b, err := json.Marshal(data)
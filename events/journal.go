@@ -0,0 +1,193 @@
+package events
+
+import (
+	"bufio"
+	"encoding/json"
+	"github.com/pkg/errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+// An event that has been recorded in a journal.
+type Record struct {
+	Sequence  uint64 `json:"sequence"`
+	Topic     string `json:"topic"`
+	Data      string `json:"data"`
+	Timestamp int64  `json:"timestamp"`
+}
+
+// A bounded, persistent log of the events published on a bus. Each event is assigned a
+// sequence number that increases for the lifetime of the journal, allowing a client that
+// was disconnected to request every event that it missed.
+//
+// Records are appended to a file on the disk as they are published, and the file is
+// rewritten with only the retained records once it grows to twice the journal size.
+type Journal struct {
+	mu   sync.Mutex
+	path string
+	size int
+
+	sequence uint64
+	records  []Record
+
+	// The number of records in the file on the disk, including ones no longer retained.
+	written int
+}
+
+// Returns a new journal that retains up to size events at the given path. Any existing events
+// at the path are not loaded until Load is called.
+func NewJournal(path string, size int) *Journal {
+	return &Journal{path: path, size: size}
+}
+
+// Loads the existing events from the disk, if there are any.
+func (j *Journal) Load() error {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+
+	f, err := os.Open(j.path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil
+		}
+
+		return errors.WithStack(err)
+	}
+	defer f.Close()
+
+	scanner := bufio.NewScanner(f)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	for scanner.Scan() {
+		var r Record
+		// A partially written record at the end of the file is skipped rather than preventing
+		// the rest of the journal from loading.
+		if err := json.Unmarshal(scanner.Bytes(), &r); err != nil {
+			continue
+		}
+
+		j.written++
+		j.records = append(j.records, r)
+		if r.Sequence > j.sequence {
+			j.sequence = r.Sequence
+		}
+	}
+
+	if len(j.records) > j.size {
+		j.records = j.records[len(j.records)-j.size:]
+	}
+
+	return errors.WithStack(scanner.Err())
+}
+
+// Records an event in the journal, returning the record with its assigned sequence number.
+func (j *Journal) Append(topic string, data string) (Record, error) {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+
+	j.sequence++
+	r := Record{Sequence: j.sequence, Topic: topic, Data: data, Timestamp: time.Now().Unix()}
+
+	j.records = append(j.records, r)
+	if len(j.records) > j.size {
+		j.records = j.records[len(j.records)-j.size:]
+	}
+
+	if j.written+1 >= j.size*2 {
+		return r, j.rewrite()
+	}
+
+	b, err := json.Marshal(r)
+	if err != nil {
+		return r, errors.WithStack(err)
+	}
+
+	f, err := os.OpenFile(j.path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0600)
+	if err != nil {
+		return r, errors.WithStack(err)
+	}
+	defer f.Close()
+
+	if _, err := f.Write(append(b, '\n')); err != nil {
+		return r, errors.WithStack(err)
+	}
+	j.written++
+
+	return r, nil
+}
+
+// Returns the records after the given sequence number, and the latest sequence number. If
+// events after the sequence number are no longer retained the returned value for complete
+// will be false, indicating that there is a gap between the requested sequence and the
+// first record returned.
+func (j *Journal) Since(sequence uint64) (records []Record, latest uint64, complete bool) {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+
+	complete = true
+	if len(j.records) > 0 && j.records[0].Sequence > sequence+1 {
+		complete = false
+	}
+
+	records = []Record{}
+	for _, r := range j.records {
+		if r.Sequence > sequence {
+			records = append(records, r)
+		}
+	}
+
+	return records, j.sequence, complete
+}
+
+// Removes the journal from the disk.
+func (j *Journal) Remove() error {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+
+	j.records = nil
+	j.written = 0
+	if err := os.Remove(j.path); err != nil && !os.IsNotExist(err) {
+		return errors.WithStack(err)
+	}
+
+	return nil
+}
+
+// Rewrites the file on the disk with only the retained records. This must be called while
+// holding the journal lock.
+func (j *Journal) rewrite() error {
+	tmp, err := ioutil.TempFile(filepath.Dir(j.path), filepath.Base(j.path)+".tmp-")
+	if err != nil {
+		return errors.WithStack(err)
+	}
+	defer os.Remove(tmp.Name())
+
+	w := bufio.NewWriter(tmp)
+	for _, r := range j.records {
+		b, err := json.Marshal(r)
+		if err != nil {
+			tmp.Close()
+			return errors.WithStack(err)
+		}
+
+		w.Write(append(b, '\n'))
+	}
+
+	if err := w.Flush(); err != nil {
+		tmp.Close()
+		return errors.WithStack(err)
+	}
+
+	if err := tmp.Close(); err != nil {
+		return errors.WithStack(err)
+	}
+
+	if err := os.Rename(tmp.Name(), j.path); err != nil {
+		return errors.WithStack(err)
+	}
+	j.written = len(j.records)
+
+	return nil
+}
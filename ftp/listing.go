@@ -0,0 +1,39 @@
+package ftp
+
+import (
+	"fmt"
+	"os"
+	"time"
+)
+
+// The time format used for MDTM replies and the modify fact of MLSD listings.
+const factTimeFormat = "20060102150405"
+
+// Returns a line for a LIST reply in the format used by "ls -l", which is what most clients
+// expect to parse.
+func listLine(info os.FileInfo) string {
+	t := "-"
+	if info.IsDir() {
+		t = "d"
+	} else if info.Mode()&os.ModeSymlink != 0 {
+		t = "l"
+	}
+
+	mod := info.ModTime()
+	ts := mod.Format("Jan _2 15:04")
+	if time.Since(mod) > time.Hour*24*180 {
+		ts = mod.Format("Jan _2  2006")
+	}
+
+	return fmt.Sprintf("%s%s 1 container container %12d %s %s", t, info.Mode().Perm().String()[1:], info.Size(), ts, info.Name())
+}
+
+// Returns the facts about a file for MLSD and MLST replies.
+func factsLine(info os.FileInfo, name string) string {
+	t := "file"
+	if info.IsDir() {
+		t = "dir"
+	}
+
+	return fmt.Sprintf("type=%s;size=%d;modify=%s; %s", t, info.Size(), info.ModTime().UTC().Format(factTimeFormat), name)
+}
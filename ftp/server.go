@@ -0,0 +1,138 @@
+package ftp
+
+import (
+	"crypto/tls"
+	"fmt"
+	"github.com/apex/log"
+	"github.com/pkg/errors"
+	"github.com/avatag-host/claws/config"
+	"github.com/avatag-host/claws/system"
+	"net"
+	"sync"
+)
+
+// An FTPS server that gives users access to the files for servers they have access to using
+// the same credentials as SFTP.
+type Server struct {
+	cfg config.FtpConfiguration
+	tls *tls.Config
+
+	// Tracks the passive ports that are currently in use by a data connection, and the number
+	// of control connections open from each IP address.
+	mu    sync.Mutex
+	ports map[int]bool
+	conns map[string]int
+}
+
+// Creates a new FTPS server using the node configuration.
+func New(c *config.Configuration) (*Server, error) {
+	certFile, keyFile := c.System.Ftp.CertificateFile, c.System.Ftp.KeyFile
+	if certFile == "" || keyFile == "" {
+		certFile, keyFile = c.Api.Ssl.CertificateFile, c.Api.Ssl.KeyFile
+	}
+
+	if certFile == "" || keyFile == "" {
+		return nil, errors.New("ftp: a TLS certificate must be configured to use the FTPS server")
+	}
+
+	cr, err := system.NewCertificateReloader(certFile, keyFile)
+	if err != nil {
+		return nil, errors.Wrap(err, "ftp: failed to load TLS certificate")
+	}
+
+	if c.System.Ftp.PassivePortStart <= 0 || c.System.Ftp.PassivePortEnd < c.System.Ftp.PassivePortStart {
+		return nil, errors.New("ftp: invalid passive port range configured")
+	}
+
+	return &Server{
+		cfg: c.System.Ftp,
+		tls: &tls.Config{
+			GetCertificate: cr.GetCertificate,
+			MinVersion:     tls.VersionTLS12,
+		},
+		ports: make(map[int]bool),
+		conns: make(map[string]int),
+	}, nil
+}
+
+// Starts the FTPS server and begins accepting connections. This blocks until the listener
+// is closed.
+func (s *Server) Run() error {
+	l, err := net.Listen("tcp", fmt.Sprintf("%s:%d", s.cfg.Address, s.cfg.Port))
+	if err != nil {
+		return errors.WithStack(err)
+	}
+
+	log.WithField("listen", l.Addr().String()).Info("ftps server listening for connections")
+
+	for {
+		conn, err := l.Accept()
+		if err != nil {
+			if ne, ok := err.(net.Error); ok && ne.Temporary() {
+				continue
+			}
+
+			return errors.WithStack(err)
+		}
+
+		go newSession(s, conn).serve()
+	}
+}
+
+// Opens a listener for a passive data connection on the first available port in the
+// configured range.
+func (s *Server) listenPassive(host string) (net.Listener, int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for port := s.cfg.PassivePortStart; port <= s.cfg.PassivePortEnd; port++ {
+		if s.ports[port] {
+			continue
+		}
+
+		l, err := net.Listen("tcp", net.JoinHostPort(host, fmt.Sprint(port)))
+		if err != nil {
+			continue
+		}
+
+		s.ports[port] = true
+
+		return l, port, nil
+	}
+
+	return nil, 0, errors.New("ftp: no passive ports are available")
+}
+
+// Releases a passive port once the data connection using it has been closed.
+func (s *Server) releasePassive(port int) {
+	s.mu.Lock()
+	delete(s.ports, port)
+	s.mu.Unlock()
+}
+
+// Tracks a new control connection from the IP address, returning false if the address
+// already has the maximum number of connections open.
+func (s *Server) acquireConnection(ip string) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.cfg.MaxConnectionsPerIp > 0 && s.conns[ip] >= s.cfg.MaxConnectionsPerIp {
+		return false
+	}
+
+	s.conns[ip]++
+
+	return true
+}
+
+// Releases a control connection from the IP address once it has been closed.
+func (s *Server) releaseConnection(ip string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.conns[ip] <= 1 {
+		delete(s.conns, ip)
+	} else {
+		s.conns[ip]--
+	}
+}
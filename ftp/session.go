@@ -0,0 +1,948 @@
+package ftp
+
+import (
+	"bufio"
+	"crypto/tls"
+	"fmt"
+	"github.com/apex/log"
+	"github.com/pkg/errors"
+	"github.com/avatag-host/claws/api"
+	"github.com/avatag-host/claws/router/bans"
+	"github.com/avatag-host/claws/server"
+	"github.com/avatag-host/claws/server/activity"
+	"net"
+	"os"
+	"path"
+	"strings"
+	"time"
+)
+
+const (
+	PermissionFileRead        = "file.read"
+	PermissionFileReadContent = "file.read-content"
+	PermissionFileCreate      = "file.create"
+	PermissionFileUpdate      = "file.update"
+	PermissionFileDelete      = "file.delete"
+)
+
+// Returned when a path provided by the client resolves to somewhere outside of the directory
+// the login is restricted to.
+var errOutsideRoot = errors.New("ftp: path is outside of the restricted directory")
+
+// The amount of time a control connection can be idle before it is closed.
+const idleTimeout = time.Minute * 5
+
+// The amount of time a client has to complete a TLS handshake, on either the control or a
+// data connection.
+const handshakeTimeout = time.Second * 30
+
+// A line read from the control connection.
+type controlLine struct {
+	text string
+	err  error
+}
+
+// A single client connection to the FTPS server.
+type session struct {
+	srv  *Server
+	conn net.Conn
+	r    *bufio.Reader
+	w    *bufio.Writer
+	log  *log.Entry
+
+	// Set once the control connection has been upgraded to TLS, and once the client has
+	// requested that data connections also be protected.
+	secure    bool
+	protected bool
+
+	user        string
+	server      *server.Server
+
+	// The password provided by a user that must also provide a one-time code, which is held
+	// until the code is sent using ACCT.
+	pending string
+
+	permissions []string
+	readOnly    bool
+
+	// The directory within the server data directory that the login is restricted to. All
+	// paths provided by the client are relative to this directory.
+	root string
+
+	// The current working directory, relative to the root of the server data directory.
+	cwd string
+
+	passive     net.Listener
+	passivePort int
+
+	// Receives the next line from the control connection while a read is in progress. Lines
+	// are read in the background so that ABOR can be handled while a transfer is running.
+	line chan controlLine
+
+	renameFrom string
+}
+
+func newSession(srv *Server, conn net.Conn) *session {
+	return &session{
+		srv:  srv,
+		conn: conn,
+		r:    bufio.NewReader(conn),
+		w:    bufio.NewWriter(conn),
+		log:  log.WithField("subsystem", "ftp").WithField("ip", conn.RemoteAddr().String()),
+		cwd:  "/",
+	}
+}
+
+// Handles commands sent by the client until the connection is closed.
+func (s *session) serve() {
+	defer func() {
+		s.closePassive()
+		s.conn.Close()
+	}()
+
+	if s.banned() {
+		s.reply(421, "Too many failed login attempts have been made from this address, try again later.")
+		return
+	}
+
+	if !s.srv.acquireConnection(s.ip()) {
+		s.reply(421, "Too many connections from this address, try again later.")
+		return
+	}
+	defer s.srv.releaseConnection(s.ip())
+
+	s.reply(220, "Claws FTPS server ready, use AUTH TLS to continue.")
+
+	idle := time.NewTimer(idleTimeout)
+	defer idle.Stop()
+
+	for {
+		select {
+		case l := <-s.readLine():
+			s.line = nil
+			if l.err != nil {
+				return
+			}
+
+			if !s.handle(parseCommand(l.text)) {
+				return
+			}
+		case <-idle.C:
+			return
+		}
+
+		if !idle.Stop() {
+			<-idle.C
+		}
+		idle.Reset(idleTimeout)
+	}
+}
+
+// Returns a channel that receives the next line from the control connection, starting a read
+// if one is not already in progress. Only a single line is read at a time so that nothing
+// beyond it is consumed before the command has been handled, such as the TLS handshake that
+// follows AUTH TLS. The channel must be reset to nil once a line is received from it.
+func (s *session) readLine() <-chan controlLine {
+	if s.line == nil {
+		ch := make(chan controlLine, 1)
+		r := s.r
+		go func() {
+			text, err := r.ReadString('\n')
+			ch <- controlLine{text: text, err: err}
+		}()
+
+		s.line = ch
+	}
+
+	return s.line
+}
+
+// Splits a line from the control connection into the command and its argument. Any Telnet
+// interrupt sequence sent by the client ahead of the command, as some do before ABOR, is
+// removed.
+func parseCommand(line string) (string, string) {
+	line = strings.TrimLeft(strings.TrimRight(line, "\r\n"), "\xff\xf4\xf2")
+
+	parts := strings.SplitN(line, " ", 2)
+	if len(parts) == 2 {
+		return strings.ToUpper(parts[0]), parts[1]
+	}
+
+	return strings.ToUpper(parts[0]), ""
+}
+
+// Sends a reply to the client on the control connection.
+func (s *session) reply(code int, msg string) {
+	fmt.Fprintf(s.w, "%d %s\r\n", code, msg)
+	_ = s.w.Flush()
+}
+
+// Sends a multi-line reply to the client on the control connection.
+func (s *session) replyLines(code int, first string, lines []string, last string) {
+	fmt.Fprintf(s.w, "%d-%s\r\n", code, first)
+	for _, l := range lines {
+		fmt.Fprintf(s.w, " %s\r\n", l)
+	}
+	fmt.Fprintf(s.w, "%d %s\r\n", code, last)
+	_ = s.w.Flush()
+}
+
+// Handles a single command from the client, returning false if the connection should be
+// closed.
+func (s *session) handle(cmd string, arg string) bool {
+	switch cmd {
+	case "AUTH":
+		return s.handleAuth(arg)
+	case "PBSZ":
+		if !s.secure {
+			s.reply(503, "PBSZ must be preceded by AUTH TLS.")
+		} else {
+			s.reply(200, "PBSZ=0")
+		}
+	case "PROT":
+		switch {
+		case !s.secure:
+			s.reply(503, "PROT must be preceded by AUTH TLS.")
+		case strings.ToUpper(arg) == "P":
+			s.protected = true
+			s.reply(200, "Protection level set to private.")
+		default:
+			s.reply(536, "Only private data connections are supported.")
+		}
+	case "USER":
+		if !s.secure {
+			s.reply(530, "TLS is required, use AUTH TLS before logging in.")
+			return true
+		}
+		s.user = arg
+		s.server = nil
+		s.pending = ""
+		s.reply(331, "Password required.")
+	case "PASS":
+		s.handleLogin(arg)
+	case "ACCT":
+		s.handleAccount(arg)
+	case "QUIT":
+		s.reply(221, "Goodbye.")
+		return false
+	case "FEAT":
+		s.replyLines(211, "Features:", []string{"AUTH TLS", "PBSZ", "PROT", "EPSV", "PASV", "MLST type*;size*;modify*;", "MLSD", "SIZE", "MDTM", "UTF8"}, "End")
+	case "SYST":
+		s.reply(215, "UNIX Type: L8")
+	case "NOOP":
+		s.reply(200, "OK.")
+	case "OPTS":
+		if strings.ToUpper(arg) == "UTF8 ON" {
+			s.reply(200, "UTF8 enabled.")
+		} else {
+			s.reply(501, "Option not supported.")
+		}
+	default:
+		if s.server == nil {
+			s.reply(530, "Not logged in.")
+			return true
+		}
+
+		if s.server.IsSuspended() {
+			s.reply(421, "This server is suspended.")
+			return false
+		}
+
+		s.handleFileCommand(cmd, arg)
+	}
+
+	return true
+}
+
+// Upgrades the control connection to TLS.
+func (s *session) handleAuth(arg string) bool {
+	if a := strings.ToUpper(arg); a != "TLS" && a != "TLS-C" && a != "SSL" {
+		s.reply(504, "Only AUTH TLS is supported.")
+		return true
+	}
+
+	if s.secure {
+		s.reply(503, "Connection is already secured.")
+		return true
+	}
+
+	s.reply(234, "AUTH TLS successful.")
+
+	conn := tls.Server(s.conn, s.srv.tls)
+	_ = conn.SetDeadline(time.Now().Add(handshakeTimeout))
+	if err := conn.Handshake(); err != nil {
+		s.log.WithField("error", err).Debug("failed to complete tls handshake with client")
+		return false
+	}
+	_ = conn.SetDeadline(time.Time{})
+
+	s.conn = conn
+	s.r = bufio.NewReader(conn)
+	s.w = bufio.NewWriter(conn)
+	s.secure = true
+
+	return true
+}
+
+// Validates the credentials for the user against the Panel. Users that the Panel requires to
+// provide a second factor can either append their one-time code to the end of their password,
+// or send it using ACCT once they have been prompted for it.
+func (s *session) handleLogin(pass string) {
+	if !s.secure || s.user == "" {
+		s.reply(503, "Login with USER first.")
+		return
+	}
+	s.pending = ""
+
+	if s.banned() {
+		s.reply(530, "Too many failed login attempts have been made from this address, try again later.")
+		return
+	}
+
+	resp, panel, err := s.validate(pass, "")
+	if err == api.ErrTwoFactorRequired {
+		if p, code, ok := splitOneTimeCode(pass); ok {
+			resp, panel, err = s.validate(p, code)
+		}
+
+		if err != nil {
+			s.pending = pass
+			s.reply(332, "One-time code required, send it using ACCT.")
+			return
+		}
+	}
+
+	s.login(resp, panel, err)
+}
+
+// Validates the one-time code sent by a user that was prompted for one after sending their
+// password. The user must send their password again if the code is not valid.
+func (s *session) handleAccount(code string) {
+	if !s.secure || s.pending == "" {
+		s.reply(503, "Login with USER and PASS first.")
+		return
+	}
+
+	if s.banned() {
+		s.pending = ""
+		s.reply(530, "Too many failed login attempts have been made from this address, try again later.")
+		return
+	}
+
+	pass := s.pending
+	s.pending = ""
+
+	resp, panel, err := s.validate(pass, strings.TrimSpace(code))
+	s.login(resp, panel, err)
+}
+
+// Returns the IP address the client is connecting from.
+func (s *session) ip() string {
+	ip, _, _ := net.SplitHostPort(s.conn.RemoteAddr().String())
+
+	return ip
+}
+
+// Determines if the client is connecting from an IP address that has been banned after
+// repeatedly failing to authenticate, against either the FTPS server or the API.
+func (s *session) banned() bool {
+	_, ok := bans.Banned(s.ip())
+
+	return ok
+}
+
+// Validates the credentials against the Panel that the server belongs to, which is found
+// using the short server identifier at the end of the username. The Panel is returned along
+// with the response.
+func (s *session) validate(pass string, code string) (*api.SftpAuthResponse, string, error) {
+	ip := s.ip()
+
+	var panel string
+	if i := strings.LastIndex(s.user, "."); i != -1 && i < len(s.user)-1 {
+		if srv := server.GetServers().Find(func(srv *server.Server) bool {
+			return strings.HasPrefix(srv.Id(), s.user[i+1:])
+		}); srv != nil {
+			panel = srv.Panel()
+		}
+	}
+
+	resp, err := api.NewForPanel(panel).ValidateSftpCredentials(api.SftpAuthRequest{User: s.user, Pass: pass, IP: ip, Code: code})
+
+	return resp, panel, err
+}
+
+// Logs the user in using the response from the Panel, or refuses the login if the credentials
+// could not be validated.
+func (s *session) login(resp *api.SftpAuthResponse, panel string, err error) {
+	if err != nil {
+		if err == api.ErrInvalidCredentials {
+			s.log.WithField("username", s.user).Warn("failed to validate user credentials (invalid username or password)")
+			bans.RecordFailure(s.ip())
+		} else if err == api.ErrTwoFactorRequired {
+			s.log.WithField("username", s.user).Warn("failed to validate user credentials (invalid or missing one-time code)")
+			bans.RecordFailure(s.ip())
+		} else {
+			s.log.WithField("username", s.user).WithField("error", err).Error("encountered an error while trying to validate user credentials")
+		}
+
+		// Slow down clients attempting to guess credentials.
+		time.Sleep(time.Second)
+		s.reply(530, "Login incorrect.")
+		return
+	}
+
+	srv := server.GetServers().Find(func(srv *server.Server) bool {
+		return srv.Id() == resp.Server && srv.Panel() == panel
+	})
+
+	if srv == nil {
+		s.reply(530, "Login incorrect.")
+		return
+	}
+
+	root := path.Clean("/" + resp.Root)
+	if st, err := srv.Filesystem().Stat(root); err != nil || !st.Info.IsDir() {
+		s.log.WithField("username", s.user).WithField("root", root).Warn("denying login for user restricted to a directory that does not exist")
+		s.reply(530, "Login incorrect.")
+		return
+	}
+
+	s.server = srv
+	s.permissions = resp.Permissions
+	s.readOnly = resp.ReadOnly
+	s.root = root
+	s.cwd = "/"
+	s.log = s.log.WithField("username", s.user).WithField("server", srv.Id()).WithField("read_only", resp.ReadOnly).WithField("root", root)
+	s.log.Debug("user logged in to ftps server")
+
+	var ip string
+	if addr, ok := s.conn.RemoteAddr().(*net.TCPAddr); ok {
+		ip = addr.IP.String()
+	}
+	srv.RecordActivity(activity.EventSftpLogin, s.user, ip, map[string]interface{}{"protocol": "ftps"})
+
+	s.reply(230, "Login successful.")
+}
+
+// Splits a one-time code appended to the end of a password from the password.
+func splitOneTimeCode(pass string) (string, string, bool) {
+	n := len(pass) - api.OneTimeCodeLength
+	if n <= 0 {
+		return "", "", false
+	}
+
+	for _, c := range pass[n:] {
+		if c < '0' || c > '9' {
+			return "", "", false
+		}
+	}
+
+	return pass[:n], pass[n:], true
+}
+
+// Determines if the user has the given permission for the server. Read-only logins never
+// have any permission that allows files to be modified.
+func (s *session) can(permission string) bool {
+	if s.readOnly && permission != PermissionFileRead && permission != PermissionFileReadContent {
+		return false
+	}
+
+	for _, p := range s.permissions {
+		if p == permission || p == "*" {
+			return true
+		}
+	}
+
+	return false
+}
+
+// Returns the absolute path as seen by the client for a path provided by the client.
+func (s *session) path(p string) string {
+	if p == "" {
+		return s.cwd
+	}
+
+	if !strings.HasPrefix(p, "/") {
+		p = path.Join(s.cwd, p)
+	}
+
+	return path.Clean("/" + p)
+}
+
+// Returns the path relative to the server data directory for a path provided by the client,
+// scoped to the directory the login is restricted to. Cleaning the client path only prevents
+// it from escaping the restricted directory lexically, so the path is also resolved through
+// any symlinks and refused if it ends up outside of the restricted directory.
+func (s *session) resolve(p string) (string, error) {
+	fs := s.server.Filesystem()
+	rel := path.Join(s.root, s.path(p))
+
+	resolved, err := fs.SafePath(rel)
+	if err != nil {
+		return "", err
+	}
+
+	root, err := fs.SafePath(s.root)
+	if err != nil {
+		return "", err
+	}
+
+	if resolved != root && !strings.HasPrefix(resolved, strings.TrimSuffix(root, "/")+"/") {
+		return "", errOutsideRoot
+	}
+
+	return rel, nil
+}
+
+// Opens a listener for a passive data connection, replacing any existing listener.
+func (s *session) openPassive() (int, error) {
+	s.closePassive()
+
+	host, _, _ := net.SplitHostPort(s.conn.LocalAddr().String())
+
+	l, port, err := s.srv.listenPassive(host)
+	if err != nil {
+		return 0, err
+	}
+
+	s.passive = l
+	s.passivePort = port
+
+	return port, nil
+}
+
+func (s *session) closePassive() {
+	if s.passive != nil {
+		s.passive.Close()
+		s.srv.releasePassive(s.passivePort)
+		s.passive = nil
+	}
+}
+
+// Accepts the data connection for a transfer on the passive listener. The connection must
+// come from the same IP address as the control connection.
+func (s *session) acceptData() (net.Conn, error) {
+	if s.passive == nil {
+		return nil, errors.New("ftp: use PASV or EPSV first")
+	}
+	defer s.closePassive()
+
+	if l, ok := s.passive.(*net.TCPListener); ok {
+		_ = l.SetDeadline(time.Now().Add(time.Second * 30))
+	}
+
+	conn, err := s.passive.Accept()
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+
+	want, _, _ := net.SplitHostPort(s.conn.RemoteAddr().String())
+	if got, _, _ := net.SplitHostPort(conn.RemoteAddr().String()); got != want {
+		conn.Close()
+		return nil, errors.New("ftp: data connection was not made from the client address")
+	}
+
+	tc := tls.Server(conn, s.srv.tls)
+	_ = tc.SetDeadline(time.Now().Add(handshakeTimeout))
+	if err := tc.Handshake(); err != nil {
+		conn.Close()
+		return nil, errors.WithStack(err)
+	}
+	_ = tc.SetDeadline(time.Time{})
+
+	return tc, nil
+}
+
+// Opens the data connection for a transfer and runs the given function with it, sending
+// the appropriate replies to the client. The control connection is read while the transfer
+// runs so that the client is able to cancel it using ABOR.
+func (s *session) transfer(fn func(conn net.Conn) error) {
+	if !s.protected {
+		s.reply(534, "Data connections must be protected, use PROT P.")
+		return
+	}
+
+	s.reply(150, "Opening data connection.")
+
+	conn, err := s.acceptData()
+	if err != nil {
+		s.reply(425, "Unable to open data connection.")
+		return
+	}
+
+	done := make(chan error, 1)
+	go func() {
+		done <- fn(conn)
+	}()
+
+	for waiting := true; waiting; {
+		select {
+		case err = <-done:
+			waiting = false
+		case l := <-s.readLine():
+			s.line = nil
+
+			// The control connection was closed, so there is nobody left to send the result
+			// of the transfer to.
+			if l.err != nil {
+				conn.Close()
+				<-done
+				return
+			}
+
+			if cmd, _ := parseCommand(l.text); cmd != "ABOR" {
+				s.reply(503, "A transfer is in progress, use ABOR to cancel it.")
+				continue
+			}
+
+			conn.Close()
+			<-done
+
+			s.reply(426, "Transfer aborted.")
+			s.reply(226, "Abort successful.")
+			return
+		}
+	}
+
+	conn.Close()
+
+	if err != nil {
+		s.log.WithField("error", err).Debug("error while transferring data with client")
+		s.reply(451, "Transfer failed.")
+		return
+	}
+
+	s.reply(226, "Transfer complete.")
+}
+
+// Handles the commands that require the user to be logged in.
+func (s *session) handleFileCommand(cmd string, arg string) {
+	fs := s.server.Filesystem()
+
+	switch cmd {
+	case "PWD", "XPWD":
+		s.reply(257, fmt.Sprintf("\"%s\" is the current directory.", strings.ReplaceAll(s.cwd, "\"", "\"\"")))
+	case "CWD", "XCWD", "CDUP", "XCUP":
+		p := s.path(arg)
+		if cmd == "CDUP" || cmd == "XCUP" {
+			p = path.Dir(s.cwd)
+		}
+
+		r, err := s.resolve(p)
+		if err != nil {
+			s.reply(550, "No such directory.")
+			return
+		}
+
+		if st, err := fs.Stat(r); err != nil || !st.Info.IsDir() {
+			s.reply(550, "No such directory.")
+			return
+		}
+
+		s.cwd = p
+		s.reply(250, "Directory changed.")
+	case "TYPE":
+		s.reply(200, "Type set.")
+	case "MODE":
+		if strings.ToUpper(arg) == "S" {
+			s.reply(200, "Mode set to stream.")
+		} else {
+			s.reply(504, "Only stream mode is supported.")
+		}
+	case "STRU":
+		if strings.ToUpper(arg) == "F" {
+			s.reply(200, "Structure set to file.")
+		} else {
+			s.reply(504, "Only file structure is supported.")
+		}
+	case "PASV":
+		port, err := s.openPassive()
+		if err != nil {
+			s.reply(425, "Unable to open a passive port.")
+			return
+		}
+
+		ip := net.ParseIP(s.srv.cfg.PublicAddress).To4()
+		if ip == nil {
+			host, _, _ := net.SplitHostPort(s.conn.LocalAddr().String())
+			ip = net.ParseIP(host).To4()
+		}
+
+		if ip == nil {
+			s.closePassive()
+			s.reply(425, "PASV is not supported for IPv6 connections, use EPSV.")
+			return
+		}
+
+		s.reply(227, fmt.Sprintf("Entering Passive Mode (%d,%d,%d,%d,%d,%d).", ip[0], ip[1], ip[2], ip[3], port>>8, port&0xff))
+	case "EPSV":
+		if strings.ToUpper(arg) == "ALL" {
+			s.reply(200, "EPSV ALL accepted.")
+			return
+		}
+
+		port, err := s.openPassive()
+		if err != nil {
+			s.reply(425, "Unable to open a passive port.")
+			return
+		}
+
+		s.reply(229, fmt.Sprintf("Entering Extended Passive Mode (|||%d|).", port))
+	case "PORT", "EPRT":
+		s.reply(502, "Active mode is not supported, use passive mode.")
+	case "LIST", "NLST", "MLSD":
+		s.handleList(cmd, arg)
+	case "MLST":
+		if !s.can(PermissionFileRead) {
+			s.reply(550, "Permission denied.")
+			return
+		}
+
+		p, err := s.resolve(arg)
+		if err != nil {
+			s.reply(550, "No such file or directory.")
+			return
+		}
+
+		st, err := fs.Stat(p)
+		if err != nil {
+			s.reply(550, "No such file or directory.")
+			return
+		}
+
+		s.replyLines(250, "Listing "+s.path(arg), []string{factsLine(st.Info, s.path(arg))}, "End")
+	case "SIZE", "MDTM":
+		if !s.can(PermissionFileRead) {
+			s.reply(550, "Permission denied.")
+			return
+		}
+
+		p, err := s.resolve(arg)
+		if err != nil {
+			s.reply(550, "No such file.")
+			return
+		}
+
+		st, err := fs.Stat(p)
+		if err != nil || st.Info.IsDir() {
+			s.reply(550, "No such file.")
+			return
+		}
+
+		if cmd == "SIZE" {
+			s.reply(213, fmt.Sprint(st.Info.Size()))
+		} else {
+			s.reply(213, st.Info.ModTime().UTC().Format(factTimeFormat))
+		}
+	case "REST":
+		// Resuming transfers is not supported, but clients commonly send a zero offset to
+		// check if it is.
+		if arg == "0" {
+			s.reply(350, "Restarting at 0.")
+		} else {
+			s.reply(504, "Resuming transfers is not supported.")
+		}
+	case "RETR":
+		if !s.can(PermissionFileReadContent) {
+			s.reply(550, "Permission denied.")
+			return
+		}
+
+		p, err := s.resolve(arg)
+		if err != nil {
+			s.reply(550, "No such file.")
+			return
+		}
+
+		if st, err := fs.Stat(p); err != nil || st.Info.IsDir() {
+			s.reply(550, "No such file.")
+			return
+		}
+
+		s.transfer(func(conn net.Conn) error {
+			return fs.Readfile(p, conn)
+		})
+	case "STOR":
+		p, err := s.resolve(arg)
+		if err != nil {
+			s.reply(550, "Permission denied.")
+			return
+		}
+
+		permission := PermissionFileCreate
+		if _, err := fs.Stat(p); err == nil {
+			permission = PermissionFileUpdate
+		}
+
+		if !s.can(permission) {
+			s.reply(550, "Permission denied.")
+			return
+		}
+
+		s.transfer(func(conn net.Conn) error {
+			if err := fs.Writefile(p, conn); err != nil {
+				return err
+			}
+
+			if st, err := fs.Stat(p); err == nil {
+				s.server.RunFileUploadedHooks(p, st.Info.Size())
+			}
+
+			return nil
+		})
+	case "DELE", "RMD", "XRMD":
+		if !s.can(PermissionFileDelete) {
+			s.reply(550, "Permission denied.")
+			return
+		}
+
+		p, err := s.resolve(arg)
+		if err != nil || p == s.root {
+			s.reply(550, "Permission denied.")
+			return
+		}
+
+		st, err := fs.Stat(p)
+		if err != nil || st.Info.IsDir() != (cmd != "DELE") {
+			s.reply(550, "No such file or directory.")
+			return
+		}
+
+		if err := fs.Delete(p); err != nil {
+			s.log.WithField("error", err).Warn("failed to delete file for ftps client")
+			s.reply(550, "Unable to delete.")
+			return
+		}
+
+		s.reply(250, "Deleted.")
+	case "MKD", "XMKD":
+		if !s.can(PermissionFileCreate) {
+			s.reply(550, "Permission denied.")
+			return
+		}
+
+		p := s.path(arg)
+		dir, err := s.resolve(path.Dir(p))
+		if err != nil {
+			s.reply(550, "Unable to create directory.")
+			return
+		}
+
+		if err := fs.CreateDirectory(path.Base(p), dir); err != nil {
+			s.reply(550, "Unable to create directory.")
+			return
+		}
+
+		s.reply(257, fmt.Sprintf("\"%s\" created.", strings.ReplaceAll(p, "\"", "\"\"")))
+	case "RNFR":
+		if !s.can(PermissionFileUpdate) {
+			s.reply(550, "Permission denied.")
+			return
+		}
+
+		p, err := s.resolve(arg)
+		if err != nil || p == s.root {
+			s.reply(550, "Permission denied.")
+			return
+		}
+
+		if _, err := fs.Stat(p); err != nil {
+			s.reply(550, "No such file or directory.")
+			return
+		}
+
+		s.renameFrom = p
+		s.reply(350, "Ready for RNTO.")
+	case "RNTO":
+		if s.renameFrom == "" {
+			s.reply(503, "Use RNFR first.")
+			return
+		}
+
+		from := s.renameFrom
+		s.renameFrom = ""
+
+		to, err := s.resolve(arg)
+		if err != nil {
+			s.reply(550, "Unable to rename.")
+			return
+		}
+
+		if err := fs.Rename(from, to); err != nil {
+			if os.IsExist(errors.Cause(err)) {
+				s.reply(553, "A file with that name already exists.")
+			} else {
+				s.reply(550, "Unable to rename.")
+			}
+			return
+		}
+
+		s.reply(250, "Renamed.")
+	case "ABOR":
+		s.closePassive()
+		s.reply(226, "No transfer in progress.")
+	default:
+		s.reply(502, "Command not implemented.")
+	}
+}
+
+// Sends a directory listing over a data connection.
+func (s *session) handleList(cmd string, arg string) {
+	if !s.can(PermissionFileRead) {
+		s.reply(550, "Permission denied.")
+		return
+	}
+
+	// Many clients send flags such as "-la" with the LIST command, which are ignored.
+	if strings.HasPrefix(arg, "-") {
+		parts := strings.SplitN(arg, " ", 2)
+
+		arg = ""
+		if len(parts) == 2 {
+			arg = parts[1]
+		}
+	}
+
+	fs := s.server.Filesystem()
+	p, err := s.resolve(arg)
+	if err != nil {
+		s.reply(550, "No such file or directory.")
+		return
+	}
+
+	st, err := fs.Stat(p)
+	if err != nil {
+		s.reply(550, "No such file or directory.")
+		return
+	}
+
+	infos := []os.FileInfo{st.Info}
+	if st.Info.IsDir() {
+		files, err := fs.ListDirectory(p)
+		if err != nil {
+			s.reply(550, "Unable to list directory.")
+			return
+		}
+
+		infos = infos[:0]
+		for _, f := range files {
+			infos = append(infos, f.Info)
+		}
+	}
+
+	s.transfer(func(conn net.Conn) error {
+		w := bufio.NewWriter(conn)
+		for _, info := range infos {
+			switch cmd {
+			case "NLST":
+				fmt.Fprintf(w, "%s\r\n", info.Name())
+			case "MLSD":
+				fmt.Fprintf(w, "%s\r\n", factsLine(info, info.Name()))
+			default:
+				fmt.Fprintf(w, "%s\r\n", listLine(info))
+			}
+		}
+
+		return errors.WithStack(w.Flush())
+	})
+}
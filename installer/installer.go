@@ -16,8 +16,8 @@ type Installer struct {
 
 // Validates the received data to ensure that all of the required fields
 // have been passed along in the request. This should be manually run before
-// calling Execute().
-func New(data []byte) (*Installer, error) {
+// calling Execute(). The server is created for the Panel with the given name.
+func New(data []byte, panel string) (*Installer, error) {
 	if !govalidator.IsUUIDv4(getString(data, "uuid")) {
 		return nil, NewValidationError("uuid provided was not in a valid format")
 	}
@@ -31,9 +31,15 @@ func New(data []byte) (*Installer, error) {
 			MemoryLimit: getInt(data, "build", "memory"),
 			Swap:        getInt(data, "build", "swap"),
 			IoWeight:    uint16(getInt(data, "build", "io")),
+			IoReadBps:   uint64(getInt(data, "build", "io_read_bps")),
+			IoWriteBps:  uint64(getInt(data, "build", "io_write_bps")),
+			IoReadIops:  uint64(getInt(data, "build", "io_read_iops")),
+			IoWriteIops: uint64(getInt(data, "build", "io_write_iops")),
 			CpuLimit:    getInt(data, "build", "cpu"),
 			DiskSpace:   getInt(data, "build", "disk"),
 			Threads:     getString(data, "build", "threads"),
+			OomScoreAdj: int(getInt(data, "build", "oom_score_adj")),
+			CpusetMems:  getString(data, "build", "cpuset_mems"),
 		},
 		CrashDetectionEnabled: true,
 	}
@@ -63,7 +69,7 @@ func New(data []byte) (*Installer, error) {
 
 	cfg.Container.Image = getString(data, "container", "image")
 
-	c, err := api.New().GetServerConfiguration(cfg.Uuid)
+	c, err := api.NewForPanel(panel).GetServerConfiguration(cfg.Uuid)
 	if err != nil {
 		if !api.IsRequestError(err) {
 			return nil, errors.WithStack(err)
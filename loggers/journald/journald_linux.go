@@ -0,0 +1,99 @@
+package journald
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"github.com/apex/log"
+	"net"
+	"strconv"
+	"strings"
+)
+
+// The socket that the systemd journal accepts entries on using its native protocol.
+const socket = "/run/systemd/journal/socket"
+
+// Priorities used by the journal, matching the syslog severities.
+var priorities = [...]int{
+	log.DebugLevel: 7,
+	log.InfoLevel:  6,
+	log.WarnLevel:  4,
+	log.ErrorLevel: 3,
+	log.FatalLevel: 2,
+}
+
+// A log handler that sends entries directly to the systemd journal. Each log field is stored
+// as its own journal field, so "server" can be filtered on using "journalctl SERVER=<uuid>".
+type Handler struct {
+	conn       *net.UnixConn
+	identifier string
+}
+
+// Connects to the systemd journal, identifying entries with the given name.
+func New(identifier string) (*Handler, error) {
+	conn, err := net.DialUnix("unixgram", nil, &net.UnixAddr{Name: socket, Net: "unixgram"})
+	if err != nil {
+		return nil, err
+	}
+
+	return &Handler{conn: conn, identifier: identifier}, nil
+}
+
+// HandleLog implements log.Handler.
+func (h *Handler) HandleLog(e *log.Entry) error {
+	var b bytes.Buffer
+
+	write(&b, "MESSAGE", e.Message)
+	write(&b, "PRIORITY", strconv.Itoa(priorities[e.Level]))
+	write(&b, "SYSLOG_IDENTIFIER", h.identifier)
+
+	for _, name := range e.Fields.Names() {
+		if name == "source" {
+			continue
+		}
+
+		write(&b, fieldName(name), fmt.Sprintf("%v", e.Fields.Get(name)))
+	}
+
+	_, err := h.conn.Write(b.Bytes())
+
+	return err
+}
+
+// Writes a field in the journal native protocol format. Values containing a newline must be
+// written with their length rather than being terminated by the newline.
+func write(b *bytes.Buffer, name string, value string) {
+	b.WriteString(name)
+	if !strings.Contains(value, "\n") {
+		b.WriteByte('=')
+		b.WriteString(value)
+		b.WriteByte('\n')
+		return
+	}
+
+	b.WriteByte('\n')
+	binary.Write(b, binary.LittleEndian, uint64(len(value)))
+	b.WriteString(value)
+	b.WriteByte('\n')
+}
+
+// Converts a log field name into a valid journal field name, which may only contain upper
+// case letters, numbers and underscores, and must not start with an underscore or number.
+func fieldName(name string) string {
+	n := []byte(strings.ToUpper(name))
+	for i, c := range n {
+		if (c < 'A' || c > 'Z') && (c < '0' || c > '9') {
+			n[i] = '_'
+		}
+	}
+
+	if len(n) == 0 || n[0] == '_' || (n[0] >= '0' && n[0] <= '9') {
+		n = append([]byte("FIELD_"), n...)
+	}
+
+	if len(n) > 64 {
+		n = n[:64]
+	}
+
+	return string(n)
+}
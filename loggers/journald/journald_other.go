@@ -0,0 +1,20 @@
+// +build !linux
+
+package journald
+
+import (
+	"errors"
+	"github.com/apex/log"
+)
+
+type Handler struct{}
+
+// The systemd journal is only available on Linux.
+func New(identifier string) (*Handler, error) {
+	return nil, errors.New("journald: only supported on linux")
+}
+
+// HandleLog implements log.Handler.
+func (h *Handler) HandleLog(e *log.Entry) error {
+	return nil
+}
@@ -0,0 +1,90 @@
+package json
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/apex/log"
+	"github.com/pkg/errors"
+	"io"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+var Default = New(os.Stderr)
+
+var Strings = [...]string{
+	log.DebugLevel: "debug",
+	log.InfoLevel:  "info",
+	log.WarnLevel:  "warn",
+	log.ErrorLevel: "error",
+	log.FatalLevel: "fatal",
+}
+
+// A log handler that writes each entry as a single line of JSON, so that the logs can be
+// ingested directly by log aggregation tools such as Loki or Elasticsearch.
+type Handler struct {
+	mu      sync.Mutex
+	encoder *json.Encoder
+}
+
+func New(w io.Writer) *Handler {
+	return &Handler{encoder: json.NewEncoder(w)}
+}
+
+type tracer interface {
+	StackTrace() errors.StackTrace
+}
+
+// HandleLog implements log.Handler.
+func (h *Handler) HandleLog(e *log.Entry) error {
+	out := make(map[string]interface{}, len(e.Fields)+3)
+	for name, v := range e.Fields {
+		if name == "source" {
+			continue
+		}
+
+		// Errors do not have any exported fields, so they would otherwise be encoded as an
+		// empty object.
+		if err, ok := v.(error); ok {
+			out[name] = err.Error()
+			if t, ok := err.(tracer); ok && name == "error" {
+				out["stacktrace"] = stack(t)
+			}
+			continue
+		}
+
+		// Other values that cannot be encoded are logged using their string representation
+		// rather than dropping the whole entry.
+		if _, err := json.Marshal(v); err != nil {
+			out[name] = fmt.Sprintf("%v", v)
+			continue
+		}
+
+		out[name] = v
+	}
+
+	out["time"] = e.Timestamp.Format(time.RFC3339Nano)
+	out["level"] = Strings[e.Level]
+	out["message"] = e.Message
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	return h.encoder.Encode(out)
+}
+
+func stack(t tracer) []string {
+	st := t.StackTrace()
+	if len(st) > 5 {
+		st = st[:5]
+	}
+
+	out := make([]string, len(st))
+	for i, f := range st {
+		out[i] = strings.Replace(fmt.Sprintf("%+v", f), "\n\t", " ", 1)
+	}
+
+	return out
+}
@@ -0,0 +1,60 @@
+// +build !windows
+
+package syslog
+
+import (
+	"fmt"
+	"github.com/apex/log"
+	"log/syslog"
+	"strings"
+)
+
+// A log handler that sends entries to a local or remote syslog daemon.
+type Handler struct {
+	w *syslog.Writer
+}
+
+// Connects to the syslog daemon at the given address. If the network and address are empty
+// the local syslog daemon is used.
+func New(network string, address string, tag string) (*Handler, error) {
+	w, err := syslog.Dial(network, address, syslog.LOG_DAEMON|syslog.LOG_INFO, tag)
+	if err != nil {
+		return nil, err
+	}
+
+	return &Handler{w: w}, nil
+}
+
+// HandleLog implements log.Handler.
+func (h *Handler) HandleLog(e *log.Entry) error {
+	msg := format(e)
+
+	switch e.Level {
+	case log.DebugLevel:
+		return h.w.Debug(msg)
+	case log.InfoLevel:
+		return h.w.Info(msg)
+	case log.WarnLevel:
+		return h.w.Warning(msg)
+	case log.ErrorLevel:
+		return h.w.Err(msg)
+	default:
+		return h.w.Crit(msg)
+	}
+}
+
+// Formats the entry as the message followed by each of the fields as key=value pairs.
+func format(e *log.Entry) string {
+	var b strings.Builder
+	b.WriteString(e.Message)
+
+	for _, name := range e.Fields.Names() {
+		if name == "source" {
+			continue
+		}
+
+		fmt.Fprintf(&b, " %s=%v", name, e.Fields.Get(name))
+	}
+
+	return b.String()
+}
@@ -0,0 +1,155 @@
+package parser
+
+import (
+	"strings"
+)
+
+var hoconSyntax = lineSyntax{slashComments: true}
+
+// Edits HOCON files in place, such as those used by Sponge and Velocity. Keys are matched using
+// the objects they are nested within, so that a match of "server.port" finds "port" within a
+// "server { ... }" object, or a "server.port" key.
+//
+// Only files that define one key per line are supported, which is how these files are almost
+// always written.
+type hoconFormat struct{}
+
+// Parses a hocon file and updates any matching key/value pairs, adding any keys that do not
+// exist to the object they belong to.
+func (f *ConfigurationFile) parseHoconFile(path string) error {
+	return f.parseLineFile(path, hoconFormat{})
+}
+
+func (hoconFormat) scan(lines []string) lineFile {
+	out := lineFile{sections: []lineSection{{start: -1, end: len(lines) - 1}}}
+
+	// The objects that are currently open, and the section for each. Objects that are not a
+	// value of a key, such as the braces around the root of the file, do not add to the path.
+	type object struct {
+		path    []string
+		section int
+	}
+
+	var stack []object
+	var multiline bool
+	var depth int
+	for i, line := range lines {
+		// Skip over the lines of multi-line strings and arrays, which cannot be replaced.
+		if multiline {
+			if strings.Contains(line, `"""`) {
+				multiline = false
+			}
+			continue
+		}
+
+		if depth > 0 {
+			_, d := hoconSyntax.valueEnd(line, 0)
+			depth += d
+			continue
+		}
+
+		var off int
+		for {
+			off = len(line) - len(strings.TrimLeft(line[off:], " \t,"))
+			if off == len(line) || line[off] != '}' {
+				break
+			}
+
+			if len(stack) > 0 {
+				if s := stack[len(stack)-1].section; s >= 0 {
+					out.sections[s].end = i
+				}
+				stack = stack[:len(stack)-1]
+			}
+			off++
+		}
+
+		t := strings.TrimSpace(line[off:])
+		if t == "" || t[0] == '#' || strings.HasPrefix(t, "//") {
+			continue
+		}
+
+		// The braces around the root of the file are optional.
+		if t[0] == '{' {
+			if len(stack) == 0 && len(out.values) == 0 && len(out.sections) == 1 && !out.sections[0].closing {
+				out.sections[0].start = i
+				out.sections[0].end = -1
+				out.sections[0].closing = true
+				stack = append(stack, object{section: 0})
+			} else {
+				stack = append(stack, object{section: -1})
+			}
+			continue
+		}
+
+		sep := indexUnquoted(line, off, "=:{")
+		if sep == -1 || (sep > 0 && line[sep-1] == '+') {
+			continue
+		}
+
+		key := splitKey(line[off:sep])
+
+		var path []string
+		for _, o := range stack {
+			path = append(path, o.path...)
+		}
+		path = append(path, key...)
+
+		start := sep
+		if line[sep] != '{' {
+			start++
+		}
+		for start < len(line) && (line[start] == ' ' || line[start] == '\t') {
+			start++
+		}
+
+		// Objects that are closed on the same line are left as they are.
+		if start < len(line) && line[start] == '{' {
+			if _, d := hoconSyntax.valueEnd(line, start); d > 0 {
+				out.sections = append(out.sections, lineSection{path: path, start: i, end: -1, closing: true})
+				stack = append(stack, object{path: key, section: len(out.sections) - 1})
+			}
+			continue
+		}
+
+		if strings.HasPrefix(line[start:], `"""`) {
+			if !strings.Contains(line[start+3:], `"""`) {
+				multiline = true
+			}
+			continue
+		}
+
+		end, d := hoconSyntax.valueEnd(line, start)
+		if d > 0 {
+			depth = d
+			continue
+		}
+
+		end = start + len(strings.TrimRight(strings.TrimSuffix(line[start:end], ","), " \t"))
+		if end == start {
+			continue
+		}
+
+		out.values = append(out.values, lineValue{path: path, line: i, start: start, end: end})
+	}
+
+	return out
+}
+
+func (hoconFormat) insert(lines []string, file lineFile, path []string, value string) []string {
+	s := file.section(path)
+	key := joinKey(path[len(s.path):])
+
+	// Keys are added to the end of the object they belong to, or to the end of the file if
+	// the root of the file is not within braces.
+	if s.end >= 0 && s.closing {
+		indent := indentOf(lines[s.end]) + "  "
+		if at := lastContentLine(lines, s.start, s.end-1); at > s.start {
+			indent = indentOf(lines[at])
+		}
+
+		return insertLines(lines, s.end, indent+key+" = "+value)
+	}
+
+	return insertLines(lines, lastContentLine(lines, -1, len(lines)-1)+1, key+" = "+value)
+}
@@ -0,0 +1,98 @@
+package parser
+
+import (
+	. "github.com/franela/goblin"
+	"testing"
+)
+
+func TestHoconFile(t *testing.T) {
+	g := Goblin(t)
+
+	g.Describe("replacing values", func() {
+		runLineFileTests(g, hoconFormat{}, []lineFileTest{
+			{
+				name:     "replaces a key in an object",
+				input:    "server {\n  port = 1\n}\n",
+				replace:  `[{"match": "server.port", "replace_with": 25565}]`,
+				expected: "server {\n  port = 25565\n}\n",
+			},
+			{
+				name:     "replaces a key using a colon separator",
+				input:    "server {\n  port: 1\n}\n",
+				replace:  `[{"match": "server.port", "replace_with": 25565}]`,
+				expected: "server {\n  port: 25565\n}\n",
+			},
+			{
+				name:     "replaces a dotted key",
+				input:    "server.port = 1\n",
+				replace:  `[{"match": "server.port", "replace_with": 25565}]`,
+				expected: "server.port = 25565\n",
+			},
+			{
+				name:     "replaces a key in nested objects and keeps comments",
+				input:    "a {\n  b {\n    c = 1 // note\n  }\n}\n",
+				replace:  `[{"match": "a.b.c", "replace_with": 2}]`,
+				expected: "a {\n  b {\n    c = 2 // note\n  }\n}\n",
+			},
+			{
+				name:     "does not treat comment characters within a string as a comment",
+				input:    "motd = \"a // b # c\" # comment\n",
+				replace:  `[{"match": "motd", "replace_with": "x"}]`,
+				expected: "motd = \"x\" # comment\n",
+			},
+			{
+				name:     "keeps separating commas",
+				input:    "port = 1,\nmotd = \"x\",\n",
+				replace:  `[{"match": "port", "replace_with": 2}]`,
+				expected: "port = 2,\nmotd = \"x\",\n",
+			},
+			{
+				name:     "matches quoted keys",
+				input:    "\"my.key\" = 1\n",
+				replace:  `[{"match": "\"my.key\"", "replace_with": 2}]`,
+				expected: "\"my.key\" = 2\n",
+			},
+			{
+				name:     "matches a wildcard in each object",
+				input:    "a {\n  x = 1\n}\nb {\n  x = 1\n}\n",
+				replace:  `[{"match": "*.x", "replace_with": 2}]`,
+				expected: "a {\n  x = 2\n}\nb {\n  x = 2\n}\n",
+			},
+			{
+				name:     "ignores keys within multi-line strings",
+				input:    "s = \"\"\"\nport = 1\n\"\"\"\nport = 1\n",
+				replace:  `[{"match": "port", "replace_with": 2}]`,
+				expected: "s = \"\"\"\nport = 1\n\"\"\"\nport = 2\n",
+			},
+			{
+				name:     "ignores keys within multi-line arrays",
+				input:    "list = [\n  { port = 5 }\n]\nport = 1\n",
+				replace:  `[{"match": "port", "replace_with": 2}]`,
+				expected: "list = [\n  { port = 5 }\n]\nport = 2\n",
+			},
+		})
+	})
+
+	g.Describe("adding missing keys", func() {
+		runLineFileTests(g, hoconFormat{}, []lineFileTest{
+			{
+				name:     "adds the key to the end of its object",
+				input:    "server {\n  port = 1\n}\n",
+				replace:  `[{"match": "server.ip", "replace_with": "0.0.0.0"}]`,
+				expected: "server {\n  port = 1\n  ip = \"0.0.0.0\"\n}\n",
+			},
+			{
+				name:     "adds the key within braces around the root of the file",
+				input:    "{\n  port = 1\n}\n",
+				replace:  `[{"match": "motd", "replace_with": "x"}]`,
+				expected: "{\n  port = 1\n  motd = \"x\"\n}\n",
+			},
+			{
+				name:     "adds a dotted key for objects that do not exist",
+				input:    "server {\n  port = 1\n}\n",
+				replace:  `[{"match": "other.motd", "replace_with": "x"}]`,
+				expected: "server {\n  port = 1\n}\nother.motd = \"x\"\n",
+			},
+		})
+	})
+}
@@ -0,0 +1,374 @@
+package parser
+
+import (
+	"fmt"
+	"github.com/apex/log"
+	"github.com/pkg/errors"
+	"io/ioutil"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// A configuration format that is edited in place, line by line, rather than being decoded and
+// encoded again. This preserves the comments and layout of the file, which matters for formats
+// such as TOML and HOCON that are usually written by hand.
+type lineFormat interface {
+	// Returns the values and sections found in the file.
+	scan(lines []string) lineFile
+
+	// Returns the lines with the key at the given path added to the file, for keys that do not
+	// already exist.
+	insert(lines []string, file lineFile, path []string, value string) []string
+}
+
+// The values and sections found when scanning a file.
+type lineFile struct {
+	values   []lineValue
+	sections []lineSection
+}
+
+// A value assigned to a key in the file, found at the given offsets of a line. Values that
+// cannot be replaced, such as those spanning multiple lines, have a start offset of -1.
+type lineValue struct {
+	path  []string
+	line  int
+	start int
+	end   int
+}
+
+// A section of the file that contains keys, such as a TOML table or HOCON object. The start
+// is the line that opens the section, or -1 for the root of the file, and the end is the last
+// line of the section. When closing is set the end is the line that closes the section.
+type lineSection struct {
+	path    []string
+	start   int
+	end     int
+	closing bool
+}
+
+// The syntax that is shared by the line based formats.
+type lineSyntax struct {
+	// Determines if strings can be quoted with single quotes.
+	singleQuotes bool
+
+	// Determines if comments can begin with "//" as well as "#".
+	slashComments bool
+}
+
+// Updates the values in a file using the given format, adding any keys that do not exist.
+func (f *ConfigurationFile) parseLineFile(path string, format lineFormat) error {
+	b, err := readFileBytes(path)
+	if err != nil {
+		return err
+	}
+
+	crlf := strings.Contains(string(b), "\r\n")
+	lines := strings.Split(strings.Replace(string(b), "\r\n", "\n", -1), "\n")
+
+	for _, replacement := range f.Replace {
+		value, err := f.LookupConfigurationValue(replacement)
+		if err != nil {
+			return err
+		}
+
+		match := splitKey(replacement.Match)
+		file := format.scan(lines)
+
+		var found bool
+		for _, v := range file.values {
+			if !matchesPath(match, v.path) {
+				continue
+			}
+			found = true
+
+			if v.start < 0 {
+				log.WithFields(log.Fields{"file": f.FileName, "match": replacement.Match}).
+					Debug("cannot replace multi-line string or array configuration value")
+				continue
+			}
+
+			line := lines[v.line]
+			if r, ok := replacement.replacementFor(line[v.start:v.end], value); ok {
+				lines[v.line] = line[:v.start] + r + line[v.end:]
+			}
+		}
+
+		// Keys that do not exist are only added when they are not conditional on an existing
+		// value, and refer to a single key that is not nested within another value.
+		if !found && replacement.IfValue == "" && !strings.Contains(replacement.Match, "*") && !file.nestedInValue(match) {
+			lines = format.insert(lines, file, match, formatLineValue(replacement.getKeyValue([]byte(value))))
+		}
+	}
+
+	sep := "\n"
+	if crlf {
+		sep = "\r\n"
+	}
+
+	return errors.WithStack(ioutil.WriteFile(path, []byte(strings.Join(lines, sep)), 0644))
+}
+
+// Returns the value that should replace the current value in the file, and whether it should
+// be replaced at all. This follows the same rules for if_value as the other formats.
+func (cfr *ConfigurationFileReplacement) replacementFor(raw string, value string) (string, bool) {
+	current, quoted := unquoteValue(raw)
+
+	if strings.HasPrefix(cfr.IfValue, "regex:") {
+		r, err := regexp.Compile(strings.TrimPrefix(cfr.IfValue, "regex:"))
+		if err != nil {
+			log.WithFields(log.Fields{"if_value": strings.TrimPrefix(cfr.IfValue, "regex:"), "error": err}).
+				Warn("configuration if_value using invalid regexp, cannot perform replacement")
+
+			return "", false
+		}
+
+		if !r.MatchString(current) {
+			return "", false
+		}
+
+		v := r.ReplaceAllString(current, value)
+		if quoted {
+			return quoteString(v), true
+		}
+
+		return v, true
+	}
+
+	if cfr.IfValue != "" && cfr.IfValue != current {
+		return "", false
+	}
+
+	return formatLineValue(cfr.getKeyValue([]byte(value))), true
+}
+
+// Determines if the path of a key matches the path being replaced, where a "*" in the match
+// matches any single key.
+func matchesPath(match []string, path []string) bool {
+	if len(match) != len(path) {
+		return false
+	}
+
+	for i, m := range match {
+		if m != "*" && m != path[i] {
+			return false
+		}
+	}
+
+	return true
+}
+
+// Determines if the path of a key is nested within a key that has a value, such as an inline
+// table. Keys cannot be added to these values since that would define the parent key twice.
+func (lf lineFile) nestedInValue(path []string) bool {
+	for _, v := range lf.values {
+		if len(v.path) < len(path) && matchesPath(v.path, path[:len(v.path)]) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// Returns the section with the longest path that the given path of a key begins with, which
+// is usually the root section if there is no other. If no section can contain the key the
+// end of the returned section is -1.
+func (lf lineFile) section(path []string) lineSection {
+	out := lineSection{start: -1, end: -1}
+	for _, s := range lf.sections {
+		if s.end < 0 || len(s.path) >= len(path) || (out.end >= 0 && len(s.path) < len(out.path)) {
+			continue
+		}
+
+		if matchesPath(s.path, path[:len(s.path)]) {
+			out = s
+		}
+	}
+
+	return out
+}
+
+// Returns the offset at which the value beginning at the start offset of the line ends,
+// excluding any trailing comment and whitespace, along with the number of arrays or objects
+// that are left open at the end of the line.
+func (ls lineSyntax) valueEnd(line string, start int) (int, int) {
+	depth := 0
+	end := len(line)
+
+	var quote byte
+loop:
+	for i := start; i < len(line); i++ {
+		c := line[i]
+		if quote != 0 {
+			if c == '\\' && quote == '"' {
+				i++
+			} else if c == quote {
+				quote = 0
+			}
+			continue
+		}
+
+		switch {
+		case c == '"' || (c == '\'' && ls.singleQuotes):
+			quote = c
+		case c == '[' || c == '{':
+			depth++
+		case c == ']' || c == '}':
+			depth--
+		case c == '#' || (ls.slashComments && c == '/' && i+1 < len(line) && line[i+1] == '/'):
+			end = i
+			break loop
+		}
+	}
+
+	return start + len(strings.TrimRight(line[start:end], " \t")), depth
+}
+
+// Returns the offset of the first of the given characters in the line that is not within a
+// quoted string, or -1 if there is not one.
+func indexUnquoted(line string, start int, chars string) int {
+	var quoted bool
+	for i := start; i < len(line); i++ {
+		switch c := line[i]; {
+		case c == '\\' && quoted:
+			i++
+		case c == '"':
+			quoted = !quoted
+		case !quoted && strings.IndexByte(chars, c) != -1:
+			return i
+		}
+	}
+
+	return -1
+}
+
+// Splits a dotted key into its parts, removing the quotes from any quoted parts.
+func splitKey(key string) []string {
+	var out []string
+	for {
+		i := indexUnquoted(key, 0, ".")
+		if i == -1 {
+			break
+		}
+
+		out = append(out, unquoteKey(key[:i]))
+		key = key[i+1:]
+	}
+
+	return append(out, unquoteKey(key))
+}
+
+func unquoteKey(key string) string {
+	k, _ := unquoteValue(strings.TrimSpace(key))
+
+	return k
+}
+
+var bareKeyRegex = regexp.MustCompile(`^[A-Za-z0-9_-]+$`)
+
+// Joins the parts of a key, quoting any parts that cannot be written without quotes.
+func joinKey(path []string) string {
+	out := make([]string, len(path))
+	for i, p := range path {
+		if bareKeyRegex.MatchString(p) {
+			out[i] = p
+		} else {
+			out[i] = quoteString(p)
+		}
+	}
+
+	return strings.Join(out, ".")
+}
+
+// Returns the value without any quotes around it, and whether it was quoted.
+func unquoteValue(v string) (string, bool) {
+	if len(v) < 2 {
+		return v, false
+	}
+
+	switch {
+	case v[0] == '"' && v[len(v)-1] == '"':
+		if s, err := strconv.Unquote(v); err == nil {
+			return s, true
+		}
+
+		return v[1 : len(v)-1], true
+	case v[0] == '\'' && v[len(v)-1] == '\'':
+		return v[1 : len(v)-1], true
+	}
+
+	return v, false
+}
+
+// Returns the string quoted using the escape sequences that are understood by both TOML and
+// HOCON, which are the same as those in JSON.
+func quoteString(s string) string {
+	var b strings.Builder
+	b.WriteByte('"')
+	for _, r := range s {
+		switch r {
+		case '"':
+			b.WriteString(`\"`)
+		case '\\':
+			b.WriteString(`\\`)
+		case '\b':
+			b.WriteString(`\b`)
+		case '\t':
+			b.WriteString(`\t`)
+		case '\n':
+			b.WriteString(`\n`)
+		case '\f':
+			b.WriteString(`\f`)
+		case '\r':
+			b.WriteString(`\r`)
+		default:
+			if r < 0x20 || r == 0x7f {
+				fmt.Fprintf(&b, `\u%04x`, r)
+			} else {
+				b.WriteRune(r)
+			}
+		}
+	}
+	b.WriteByte('"')
+
+	return b.String()
+}
+
+// Returns the value formatted for the file. Booleans and numbers are written as they are, and
+// everything else is written as a quoted string.
+func formatLineValue(v interface{}) string {
+	switch v := v.(type) {
+	case bool:
+		return strconv.FormatBool(v)
+	case int:
+		return strconv.Itoa(v)
+	default:
+		return quoteString(fmt.Sprint(v))
+	}
+}
+
+// Returns the index of the last line in the section that is not blank, or the start of the
+// section if every line is blank.
+func lastContentLine(lines []string, start int, end int) int {
+	for i := end; i > start; i-- {
+		if strings.TrimSpace(lines[i]) != "" {
+			return i
+		}
+	}
+
+	return start
+}
+
+// Returns the whitespace at the start of the line.
+func indentOf(line string) string {
+	return line[:len(line)-len(strings.TrimLeft(line, " \t"))]
+}
+
+// Returns the lines with the given lines inserted before the line at the index.
+func insertLines(lines []string, at int, add ...string) []string {
+	out := make([]string, 0, len(lines)+len(add))
+	out = append(out, lines[:at]...)
+	out = append(out, add...)
+
+	return append(out, lines[at:]...)
+}
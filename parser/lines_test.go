@@ -0,0 +1,107 @@
+package parser
+
+import (
+	"encoding/json"
+	. "github.com/franela/goblin"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// A single rewrite of a file using one of the line based formats.
+type lineFileTest struct {
+	name     string
+	input    string
+	replace  string
+	expected string
+}
+
+// Writes the input to a file, applies the replacements in their JSON form to it using the
+// format and returns the contents of the file afterwards.
+func rewriteLineFile(format lineFormat, input string, replace string) (string, error) {
+	dir, err := ioutil.TempDir("", "parser")
+	if err != nil {
+		return "", err
+	}
+	defer os.RemoveAll(dir)
+
+	p := filepath.Join(dir, "config")
+	if err := ioutil.WriteFile(p, []byte(input), 0644); err != nil {
+		return "", err
+	}
+
+	f := ConfigurationFile{FileName: "config"}
+	if err := json.Unmarshal([]byte(replace), &f.Replace); err != nil {
+		return "", err
+	}
+
+	if err := f.parseLineFile(p, format); err != nil {
+		return "", err
+	}
+
+	b, err := ioutil.ReadFile(p)
+
+	return string(b), err
+}
+
+// Runs each of the tests against the format.
+func runLineFileTests(g *G, format lineFormat, tests []lineFileTest) {
+	for _, t := range tests {
+		t := t
+
+		g.It(t.name, func() {
+			out, err := rewriteLineFile(format, t.input, t.replace)
+			g.Assert(err).IsNil()
+			g.Assert(out).Equal(t.expected)
+		})
+	}
+}
+
+func TestLineFile_Keys(t *testing.T) {
+	g := Goblin(t)
+
+	g.Describe("splitKey", func() {
+		g.It("splits dotted keys", func() {
+			g.Assert(splitKey("server.port")).Equal([]string{"server", "port"})
+		})
+
+		g.It("does not split within quoted parts", func() {
+			g.Assert(splitKey(`server."my.key".value`)).Equal([]string{"server", "my.key", "value"})
+		})
+
+		g.It("trims whitespace around the parts", func() {
+			g.Assert(splitKey(" server . port ")).Equal([]string{"server", "port"})
+		})
+	})
+
+	g.Describe("joinKey", func() {
+		g.It("quotes parts that cannot be written bare", func() {
+			g.Assert(joinKey([]string{"server", "my.key", "with space"})).Equal(`server."my.key"."with space"`)
+		})
+	})
+
+	g.Describe("quoteString", func() {
+		g.It("escapes quotes, backslashes and control characters", func() {
+			g.Assert(quoteString("a \"b\" \\ c\n\t\x01")).Equal(`"a \"b\" \\ c\n\t\u0001"`)
+		})
+	})
+
+	g.Describe("unquoteValue", func() {
+		g.It("removes double and single quotes", func() {
+			v, quoted := unquoteValue(`"a \"b\""`)
+			g.Assert(v).Equal(`a "b"`)
+			g.Assert(quoted).IsTrue()
+
+			v, quoted = unquoteValue(`'C:\path'`)
+			g.Assert(v).Equal(`C:\path`)
+			g.Assert(quoted).IsTrue()
+		})
+
+		g.It("returns values that are not quoted as they are", func() {
+			v, quoted := unquoteValue("25565")
+			g.Assert(v).Equal("25565")
+			g.Assert(quoted).IsFalse()
+		})
+	})
+}
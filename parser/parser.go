@@ -15,6 +15,7 @@ import (
 	"io/ioutil"
 	"os"
 	"path/filepath"
+	"regexp"
 	"strconv"
 	"strings"
 )
@@ -27,6 +28,9 @@ const (
 	Ini        = "ini"
 	Json       = "json"
 	Xml        = "xml"
+	Toml       = "toml"
+	Hocon      = "hocon"
+	Regex      = "regex"
 )
 
 type ConfigurationParser string
@@ -81,6 +85,10 @@ type ConfigurationFileReplacement struct {
 	Match       string       `json:"match"`
 	IfValue     string       `json:"if_value"`
 	ReplaceWith ReplaceValue `json:"replace_with"`
+
+	// Used by the regex parser to apply the expression to the entire file rather than to each
+	// line, allowing a match to span multiple lines.
+	Multiline bool `json:"multiline"`
 }
 
 // Handles unmarshaling the JSON representation into a struct that provides more useful
@@ -101,6 +109,12 @@ func (cfr *ConfigurationFileReplacement) UnmarshalJSON(data []byte) error {
 	}
 	cfr.IfValue = iv
 
+	ml, err := jsonparser.GetBoolean(data, "multiline")
+	if err != nil && err != jsonparser.KeyPathNotFoundError {
+		return err
+	}
+	cfr.Multiline = ml
+
 	rw, dt, _, err := jsonparser.Get(data, "replace_with")
 	if err != nil {
 		if err != jsonparser.KeyPathNotFoundError {
@@ -155,6 +169,15 @@ func (f *ConfigurationFile) Parse(path string, internal bool) error {
 	case Xml:
 		err = f.parseXmlFile(path)
 		break
+	case Toml:
+		err = f.parseTomlFile(path)
+		break
+	case Hocon, "conf":
+		err = f.parseHoconFile(path)
+		break
+	case Regex:
+		err = f.parseRegexFile(path)
+		break
 	}
 
 	if errors.Is(err, os.ErrNotExist) {
@@ -409,6 +432,56 @@ func (f *ConfigurationFile) parseTextFile(path string) error {
 	return nil
 }
 
+// Parses a file using regular expressions, replacing everything that matches the expression
+// in the match field with the replacement value, which can refer to the groups captured by
+// the expression using $1 or ${name}. Unless the replacement is multiline the expression is
+// applied to each line of the file separately, in which case ^ and $ match the start and end
+// of the line.
+func (f *ConfigurationFile) parseRegexFile(path string) error {
+	input, err := readFileBytes(path)
+	if err != nil {
+		return errors.WithStack(err)
+	}
+
+	content := string(input)
+	for _, replace := range f.Replace {
+		pattern := replace.Match
+		if replace.Multiline {
+			pattern = "(?m)" + pattern
+		}
+
+		r, err := regexp.Compile(pattern)
+		if err != nil {
+			log.WithFields(log.Fields{"match": replace.Match, "file": f.FileName, "error": err}).
+				Warn("configuration match using invalid regexp, cannot perform replacement")
+			continue
+		}
+
+		value, err := f.LookupConfigurationValue(replace)
+		if err != nil {
+			return errors.WithStack(err)
+		}
+
+		if replace.Multiline {
+			content = r.ReplaceAllString(content, value)
+			continue
+		}
+
+		lines := strings.Split(content, "\n")
+		for i, line := range lines {
+			l := strings.TrimSuffix(line, "\r")
+			lines[i] = r.ReplaceAllString(l, value) + line[len(l):]
+		}
+		content = strings.Join(lines, "\n")
+	}
+
+	if err := ioutil.WriteFile(path, []byte(content), 0644); err != nil {
+		return errors.WithStack(err)
+	}
+
+	return nil
+}
+
 // Parses a properties file and updates the values within it to match those that
 // are passed. Writes the file once completed.
 func (f *ConfigurationFile) parsePropertiesFile(path string) error {
@@ -0,0 +1,90 @@
+package parser
+
+import (
+	"encoding/json"
+	. "github.com/franela/goblin"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// Writes the input to a file, applies the replacements in their JSON form to it using the
+// regex parser and returns the contents of the file afterwards.
+func rewriteRegexFile(input string, replace string) (string, error) {
+	dir, err := ioutil.TempDir("", "parser")
+	if err != nil {
+		return "", err
+	}
+	defer os.RemoveAll(dir)
+
+	p := filepath.Join(dir, "config")
+	if err := ioutil.WriteFile(p, []byte(input), 0644); err != nil {
+		return "", err
+	}
+
+	f := ConfigurationFile{FileName: "config"}
+	if err := json.Unmarshal([]byte(replace), &f.Replace); err != nil {
+		return "", err
+	}
+
+	if err := f.parseRegexFile(p); err != nil {
+		return "", err
+	}
+
+	b, err := ioutil.ReadFile(p)
+
+	return string(b), err
+}
+
+func TestRegexFile(t *testing.T) {
+	g := Goblin(t)
+
+	g.Describe("parseRegexFile", func() {
+		for _, c := range []struct {
+			name     string
+			input    string
+			replace  string
+			expected string
+		}{
+			{
+				name:     "applies the expression to each line",
+				input:    "port=1\nhost=a\n",
+				replace:  `[{"match": "^port=\\d+$", "replace_with": "port=25565"}]`,
+				expected: "port=25565\nhost=a\n",
+			},
+			{
+				name:     "matches the end of lines with windows line endings",
+				input:    "a=1\r\nb=1\r\n",
+				replace:  `[{"match": "=1$", "replace_with": "=2"}]`,
+				expected: "a=2\r\nb=2\r\n",
+			},
+			{
+				name:     "replaces using named groups",
+				input:    "name: old\n",
+				replace:  `[{"match": "^name: (?P<v>.*)$", "replace_with": "name: new-${v}"}]`,
+				expected: "name: new-old\n",
+			},
+			{
+				name:     "allows multiline matches to span lines",
+				input:    "x {\n  y\n}\n",
+				replace:  `[{"match": "x \\{\\n  y", "replace_with": "z", "multiline": true}]`,
+				expected: "z\n}\n",
+			},
+			{
+				name:     "skips invalid expressions and applies the rest",
+				input:    "a\n",
+				replace:  `[{"match": "(", "replace_with": "b"}, {"match": "a", "replace_with": "c"}]`,
+				expected: "c\n",
+			},
+		} {
+			c := c
+
+			g.It(c.name, func() {
+				out, err := rewriteRegexFile(c.input, c.replace)
+				g.Assert(err).IsNil()
+				g.Assert(out).Equal(c.expected)
+			})
+		}
+	})
+}
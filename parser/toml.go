@@ -0,0 +1,137 @@
+package parser
+
+import (
+	"strconv"
+	"strings"
+)
+
+var tomlSyntax = lineSyntax{singleQuotes: true}
+
+// Edits TOML files in place. Keys are matched using the table they are defined in, so that a
+// match of "server.port" finds "port" in the "[server]" table, or a "server.port" key in the
+// root of the file.
+type tomlFormat struct{}
+
+// Parses a toml file and updates any matching key/value pairs, adding any keys that do not
+// exist to the table they belong to.
+func (f *ConfigurationFile) parseTomlFile(path string) error {
+	return f.parseLineFile(path, tomlFormat{})
+}
+
+func (tomlFormat) scan(lines []string) lineFile {
+	out := lineFile{sections: []lineSection{{start: -1, end: len(lines) - 1}}}
+
+	var table []string
+	var multiline string
+	arrays := make(map[string]int)
+	var depth int
+	for i, line := range lines {
+		// Skip over the lines of multi-line strings and arrays, which cannot be replaced.
+		if multiline != "" {
+			if strings.Contains(line, multiline) {
+				multiline = ""
+			}
+			continue
+		}
+
+		if depth > 0 {
+			_, d := tomlSyntax.valueEnd(line, 0)
+			depth += d
+			continue
+		}
+
+		t := strings.TrimSpace(line)
+		if t == "" || t[0] == '#' {
+			continue
+		}
+
+		// Table headers end the previous section. Each table in an array of tables is given
+		// its index in the array as part of its path, so that "mods.*.name" matches the name
+		// in every "[[mods]]" table.
+		if t[0] == '[' {
+			h := strings.TrimPrefix(t, "[")
+			closing := "]"
+			if strings.HasPrefix(h, "[") {
+				h, closing = h[1:], "]]"
+			}
+
+			if j := strings.Index(h, closing); j != -1 {
+				h = h[:j]
+			}
+
+			out.sections[len(out.sections)-1].end = i - 1
+			table = splitKey(h)
+			if closing == "]]" {
+				k := strings.Join(table, ".")
+				table = append(table, strconv.Itoa(arrays[k]))
+				arrays[k]++
+			}
+			out.sections = append(out.sections, lineSection{path: table, start: i, end: len(lines) - 1})
+			continue
+		}
+
+		eq := indexUnquoted(line, 0, "=")
+		if eq == -1 {
+			continue
+		}
+
+		start := eq + 1
+		for start < len(line) && (line[start] == ' ' || line[start] == '\t') {
+			start++
+		}
+
+		// Values that cannot be replaced are still recorded, so that the key is not added to
+		// the file a second time when it is matched.
+		path := append(append([]string{}, table...), splitKey(line[:eq])...)
+
+		v := line[start:]
+		if strings.HasPrefix(v, `"""`) || strings.HasPrefix(v, "'''") {
+			if !strings.Contains(v[3:], v[:3]) {
+				multiline = v[:3]
+			}
+			out.values = append(out.values, lineValue{path: path, line: i, start: -1, end: -1})
+			continue
+		}
+
+		end, d := tomlSyntax.valueEnd(line, start)
+		if d > 0 {
+			depth = d
+			out.values = append(out.values, lineValue{path: path, line: i, start: -1, end: -1})
+			continue
+		}
+
+		if end == start {
+			continue
+		}
+
+		out.values = append(out.values, lineValue{path: path, line: i, start: start, end: end})
+	}
+
+	return out
+}
+
+func (tomlFormat) insert(lines []string, file lineFile, path []string, value string) []string {
+	s := file.section(path)
+	key := path[len(s.path):]
+
+	// Keys within a table that does not exist yet are added to a new table at the end of the
+	// file, rather than as a dotted key in the root of the file.
+	if len(s.path) == 0 && len(key) > 1 {
+		at := lastContentLine(lines, -1, len(lines)-1) + 1
+		add := []string{"[" + joinKey(key[:len(key)-1]) + "]", joinKey(key[len(key)-1:]) + " = " + value}
+		if at > 0 {
+			add = append([]string{""}, add...)
+		}
+
+		return insertLines(lines, at, add...)
+	}
+
+	at := lastContentLine(lines, s.start, s.end)
+
+	var indent string
+	if at > s.start {
+		indent = indentOf(lines[at])
+	}
+
+	return insertLines(lines, at+1, indent+joinKey(key)+" = "+value)
+}
@@ -0,0 +1,169 @@
+package parser
+
+import (
+	. "github.com/franela/goblin"
+	"testing"
+)
+
+func TestTomlFile(t *testing.T) {
+	g := Goblin(t)
+
+	g.Describe("replacing values", func() {
+		runLineFileTests(g, tomlFormat{}, []lineFileTest{
+			{
+				name:     "replaces a key in a table",
+				input:    "[server]\nport = 1\n",
+				replace:  `[{"match": "server.port", "replace_with": 25565}]`,
+				expected: "[server]\nport = 25565\n",
+			},
+			{
+				name:     "replaces a dotted key in the root of the file",
+				input:    "server.port = 1\n",
+				replace:  `[{"match": "server.port", "replace_with": 25565}]`,
+				expected: "server.port = 25565\n",
+			},
+			{
+				name:     "replaces a key in a nested table",
+				input:    "[a.b]\nc = 1\n",
+				replace:  `[{"match": "a.b.c", "replace_with": 2}]`,
+				expected: "[a.b]\nc = 2\n",
+			},
+			{
+				name:     "matches quoted keys",
+				input:    "\"my.key\" = 1\n",
+				replace:  `[{"match": "\"my.key\"", "replace_with": 2}]`,
+				expected: "\"my.key\" = 2\n",
+			},
+			{
+				name:     "quotes and escapes string values",
+				input:    "motd = 'old'\n",
+				replace:  `[{"match": "motd", "replace_with": "say \"hi\""}]`,
+				expected: "motd = \"say \\\"hi\\\"\"\n",
+			},
+			{
+				name:     "writes booleans without quotes",
+				input:    "enabled = false\n",
+				replace:  `[{"match": "enabled", "replace_with": true}]`,
+				expected: "enabled = true\n",
+			},
+			{
+				name:     "keeps trailing comments",
+				input:    "port = 1 # the port\n",
+				replace:  `[{"match": "port", "replace_with": 2}]`,
+				expected: "port = 2 # the port\n",
+			},
+			{
+				name:     "does not treat a hash within a string as a comment",
+				input:    "motd = \"a # b\" # comment\n",
+				replace:  `[{"match": "motd", "replace_with": "x"}]`,
+				expected: "motd = \"x\" # comment\n",
+			},
+			{
+				name:     "does not match keys within comments",
+				input:    "# port = 1\nport = 1\n",
+				replace:  `[{"match": "port", "replace_with": 2}]`,
+				expected: "# port = 1\nport = 2\n",
+			},
+			{
+				name:     "replaces an inline array as a whole",
+				input:    "list = [1, 2] # comment\n",
+				replace:  `[{"match": "list", "replace_with": "x"}]`,
+				expected: "list = \"x\" # comment\n",
+			},
+			{
+				name:     "matches each table in an array of tables",
+				input:    "[[mods]]\nname = \"a\"\n\n[[mods]]\nname = \"b\"\n",
+				replace:  `[{"match": "mods.*.name", "replace_with": "z"}]`,
+				expected: "[[mods]]\nname = \"z\"\n\n[[mods]]\nname = \"z\"\n",
+			},
+			{
+				name:     "ignores keys within multi-line arrays",
+				input:    "list = [\n  \"port = 5\",\n]\nport = 1\n",
+				replace:  `[{"match": "port", "replace_with": 2}]`,
+				expected: "list = [\n  \"port = 5\",\n]\nport = 2\n",
+			},
+			{
+				name:     "ignores keys within multi-line strings",
+				input:    "text = \"\"\"\nport = 5\n\"\"\"\nport = 1\n",
+				replace:  `[{"match": "port", "replace_with": 2}]`,
+				expected: "text = \"\"\"\nport = 5\n\"\"\"\nport = 2\n",
+			},
+			{
+				name:     "keeps windows line endings",
+				input:    "[server]\r\nport = 1\r\n",
+				replace:  `[{"match": "server.port", "replace_with": 2}]`,
+				expected: "[server]\r\nport = 2\r\n",
+			},
+		})
+	})
+
+	g.Describe("conditional replacements", func() {
+		runLineFileTests(g, tomlFormat{}, []lineFileTest{
+			{
+				name:     "replaces the value when it matches if_value",
+				input:    "mode = \"survival\"\n",
+				replace:  `[{"match": "mode", "if_value": "survival", "replace_with": "creative"}]`,
+				expected: "mode = \"creative\"\n",
+			},
+			{
+				name:     "leaves the value when it does not match if_value",
+				input:    "mode = \"survival\"\n",
+				replace:  `[{"match": "mode", "if_value": "hardcore", "replace_with": "creative"}]`,
+				expected: "mode = \"survival\"\n",
+			},
+			{
+				name:     "replaces using a regex if_value and keeps the quotes",
+				input:    "ip = \"0.0.0.0:25565\"\n",
+				replace:  `[{"match": "ip", "if_value": "regex:^0\\.0\\.0\\.0:(\\d+)$", "replace_with": "10.0.0.1:$1"}]`,
+				expected: "ip = \"10.0.0.1:25565\"\n",
+			},
+		})
+	})
+
+	g.Describe("adding missing keys", func() {
+		runLineFileTests(g, tomlFormat{}, []lineFileTest{
+			{
+				name:     "adds the key to the end of its table",
+				input:    "[server]\nport = 1\n\n[other]\nx = 1\n",
+				replace:  `[{"match": "server.motd", "replace_with": "hi"}]`,
+				expected: "[server]\nport = 1\nmotd = \"hi\"\n\n[other]\nx = 1\n",
+			},
+			{
+				name:     "adds a new table for keys in a table that does not exist",
+				input:    "port = 1\n",
+				replace:  `[{"match": "new.key", "replace_with": "v"}]`,
+				expected: "port = 1\n\n[new]\nkey = \"v\"\n",
+			},
+			{
+				name:     "adds root keys before the first table",
+				input:    "[a]\nx = 1\n",
+				replace:  `[{"match": "b", "replace_with": "v"}]`,
+				expected: "b = \"v\"\n[a]\nx = 1\n",
+			},
+			{
+				name:     "does not add keys that have a multi-line value",
+				input:    "list = [\n  1,\n]\n",
+				replace:  `[{"match": "list", "replace_with": 2}]`,
+				expected: "list = [\n  1,\n]\n",
+			},
+			{
+				name:     "does not add keys within an inline table",
+				input:    "t = { a = 1 }\n",
+				replace:  `[{"match": "t.a", "replace_with": 2}]`,
+				expected: "t = { a = 1 }\n",
+			},
+			{
+				name:     "does not add keys for wildcard matches",
+				input:    "port = 1\n",
+				replace:  `[{"match": "*.name", "replace_with": "x"}]`,
+				expected: "port = 1\n",
+			},
+			{
+				name:     "does not add keys for conditional replacements",
+				input:    "port = 1\n",
+				replace:  `[{"match": "mode", "if_value": "survival", "replace_with": "x"}]`,
+				expected: "port = 1\n",
+			},
+		})
+	})
+}
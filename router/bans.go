@@ -0,0 +1,72 @@
+package router
+
+import (
+	"github.com/avatag-host/claws/config"
+	"github.com/avatag-host/claws/router/bans"
+	"github.com/gin-gonic/gin"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Determines if requests from the IP address are made by a proxy that is trusted to report the
+// address of the client it is forwarding for.
+func isTrustedProxy(ip string) bool {
+	for _, p := range config.Get().Api.TrustedProxies {
+		if strings.Contains(p, "/") {
+			if _, n, err := net.ParseCIDR(p); err == nil && n.Contains(net.ParseIP(ip)) {
+				return true
+			}
+		} else if p == ip {
+			return true
+		}
+	}
+
+	return false
+}
+
+// Returns the IP address of the client making the request. The X-Forwarded-For header is only
+// used when the request was made by a trusted proxy, otherwise a client could pick whichever
+// address it wanted to be banned, or not banned, as. The header is read from the end, skipping
+// the addresses of any trusted proxies.
+func clientIp(c *gin.Context) string {
+	ip, _, err := net.SplitHostPort(strings.TrimSpace(c.Request.RemoteAddr))
+	if err != nil {
+		ip = strings.TrimSpace(c.Request.RemoteAddr)
+	}
+
+	if !isTrustedProxy(ip) {
+		return ip
+	}
+
+	hops := strings.Split(c.GetHeader("X-Forwarded-For"), ",")
+	for i := len(hops) - 1; i >= 0; i-- {
+		h := strings.TrimSpace(hops[i])
+		if net.ParseIP(h) == nil {
+			break
+		}
+
+		ip = h
+		if !isTrustedProxy(h) {
+			break
+		}
+	}
+
+	return ip
+}
+
+// Rejects any requests from IP addresses that are currently banned.
+func BanMiddleware(c *gin.Context) {
+	if exp, ok := bans.Banned(clientIp(c)); ok {
+		c.Header("Retry-After", strconv.Itoa(int(time.Until(exp).Seconds())+1))
+		c.AbortWithStatusJSON(http.StatusTooManyRequests, gin.H{
+			"error": "Too many failed authentication attempts have been made from this address, try again later.",
+		})
+
+		return
+	}
+
+	c.Next()
+}
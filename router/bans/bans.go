@@ -0,0 +1,121 @@
+package bans
+
+import (
+	"github.com/apex/log"
+	"github.com/avatag-host/claws/config"
+	"github.com/patrickmn/go-cache"
+	"sort"
+	"sync"
+	"time"
+)
+
+// Tracks failed authentication attempts for IP addresses and the IP addresses that have
+// been banned as a result of them. The same list is shared by the API and the FTPS server, so
+// that an address banned by one is also banned by the other.
+type banList struct {
+	sync.Mutex
+	attempts *cache.Cache
+	bans     *cache.Cache
+}
+
+// Details about an IP address that is currently banned.
+type Ban struct {
+	Ip        string    `json:"ip"`
+	ExpiresAt time.Time `json:"expires_at"`
+}
+
+var _bans = &banList{
+	attempts: cache.New(time.Minute*5, time.Minute*5),
+	bans:     cache.New(time.Minute*15, time.Minute*5),
+}
+
+// Determines if an IP address should never be banned.
+func isIgnoredIp(ip string) bool {
+	for _, i := range config.Get().Api.Bans.IgnoredIps {
+		if i == ip {
+			return true
+		}
+	}
+
+	return false
+}
+
+// Records a failed authentication attempt for the IP address, banning it if it has failed
+// too many times within the configured window.
+func RecordFailure(ip string) {
+	cfg := config.Get().Api.Bans
+	if !cfg.Enabled || ip == "" || isIgnoredIp(ip) {
+		return
+	}
+
+	b := _bans
+	b.Lock()
+	defer b.Unlock()
+
+	n := 1
+	if v, exp, ok := b.attempts.GetWithExpiration(ip); ok {
+		n = v.(int) + 1
+		// Keep the expiration of the first attempt so that the window is not extended by
+		// every subsequent failure.
+		b.attempts.Set(ip, n, time.Until(exp))
+	} else {
+		b.attempts.Set(ip, n, time.Duration(cfg.Window)*time.Second)
+	}
+
+	if n < cfg.MaxAttempts {
+		return
+	}
+
+	d := time.Duration(cfg.Duration) * time.Second
+	b.attempts.Delete(ip)
+	b.bans.Set(ip, time.Now().Add(d), d)
+
+	log.WithField("ip", ip).WithField("attempts", n).Warn("banning ip address after repeated authentication failures")
+}
+
+// Returns the time the ban for an IP address expires, and if the IP is currently banned.
+func Banned(ip string) (time.Time, bool) {
+	v, ok := _bans.bans.Get(ip)
+	if !ok {
+		return time.Time{}, false
+	}
+
+	return v.(time.Time), true
+}
+
+// Returns all of the IP addresses that are currently banned.
+func All() []Ban {
+	out := make([]Ban, 0)
+	for ip, item := range _bans.bans.Items() {
+		out = append(out, Ban{Ip: ip, ExpiresAt: item.Object.(time.Time)})
+	}
+
+	sort.Slice(out, func(i, j int) bool {
+		return out[i].Ip < out[j].Ip
+	})
+
+	return out
+}
+
+// Removes the ban for an IP address, returning false if it was not banned.
+func Remove(ip string) bool {
+	b := _bans
+	b.Lock()
+	defer b.Unlock()
+
+	_, ok := b.bans.Get(ip)
+	b.bans.Delete(ip)
+	b.attempts.Delete(ip)
+
+	return ok
+}
+
+// Removes all of the current bans.
+func Clear() {
+	b := _bans
+	b.Lock()
+	defer b.Unlock()
+
+	b.bans.Flush()
+	b.attempts.Flush()
+}
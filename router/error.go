@@ -42,12 +42,17 @@ func TrackedServerError(err error, s *server.Server) *RequestError {
 	}
 }
 
-func (e *RequestError) logger() *log.Entry {
+func (e *RequestError) logger(c *gin.Context) *log.Entry {
+	l := log.WithField("error_id", e.Uuid)
 	if e.server != nil {
-		return e.server.Log().WithField("error_id", e.Uuid)
+		l = e.server.Log().WithField("error_id", e.Uuid)
 	}
 
-	return log.WithField("error_id", e.Uuid)
+	if id := c.GetString("request_id"); id != "" {
+		l = l.WithField("request_id", id)
+	}
+
+	return l
 }
 
 // Sets the output message to display to the user in the error.
@@ -63,7 +68,7 @@ func (e *RequestError) AbortWithStatus(status int, c *gin.Context) {
 	// If this error is because the resource does not exist, we likely do not need to log
 	// the error anywhere, just return a 404 and move on with our lives.
 	if os.IsNotExist(e.Err) {
-		e.logger().WithField("error", e.Err).Debug("encountered os.IsNotExist error while handling request")
+		e.logger(c).WithField("error", e.Err).Debug("encountered os.IsNotExist error while handling request")
 
 		c.AbortWithStatusJSON(http.StatusNotFound, gin.H{
 			"error": "The requested resource was not found on the system.",
@@ -73,11 +78,11 @@ func (e *RequestError) AbortWithStatus(status int, c *gin.Context) {
 
 	// Otherwise, log the error to zap, and then report the error back to the user.
 	if status >= 500 {
-		e.logger().WithField("error", e.Err).Error("encountered HTTP/500 error while handling request")
+		e.logger(c).WithField("error", e.Err).Error("encountered HTTP/500 error while handling request")
 
 		c.Error(errors.WithStack(e))
 	} else {
-		e.logger().WithField("error", e.Err).Debug("encountered non-HTTP/500 error while handling request")
+		e.logger(c).WithField("error", e.Err).Debug("encountered non-HTTP/500 error while handling request")
 	}
 
 	msg := "An unexpected error was encountered while processing this request."
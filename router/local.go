@@ -0,0 +1,24 @@
+package router
+
+import (
+	"context"
+	"github.com/gin-gonic/gin"
+	"net/http"
+)
+
+type localRequestKey struct{}
+
+// Wraps the router so that requests made through it are marked as coming from the local
+// socket. This must only be used for listeners that cannot be reached over the network.
+func LocalHandler(h http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		h.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), localRequestKey{}, true)))
+	})
+}
+
+// Determines if the request was made over the local socket.
+func isLocalRequest(c *gin.Context) bool {
+	v, _ := c.Request.Context().Value(localRequestKey{}).(bool)
+
+	return v
+}
@@ -4,26 +4,44 @@ import (
 	"github.com/gin-gonic/gin"
 	"github.com/google/uuid"
 	"github.com/avatag-host/claws/config"
+	"github.com/avatag-host/claws/router/bans"
 	"github.com/avatag-host/claws/server"
 	"net/http"
 	"strings"
 )
 
+// Attaches a unique identifier to each request so that the log entries written while handling
+// it can be correlated. An identifier provided by a proxy in front of Wings is used if present.
+func SetRequestId(c *gin.Context) {
+	id := c.GetHeader("X-Request-Id")
+	if id == "" || len(id) > 64 {
+		id = uuid.Must(uuid.NewRandom()).String()
+	}
+
+	c.Set("request_id", id)
+	c.Header("X-Request-Id", id)
+	c.Next()
+}
+
 // Set the access request control headers on all of the requests.
 func SetAccessControlHeaders(c *gin.Context) {
 	c.Header("Access-Control-Allow-Headers", "Accept, Content-Type, Content-Length, Accept-Encoding, X-CSRF-Token, Authorization")
 
 	o := c.GetHeader("Origin")
-	if o != config.Get().PanelLocation {
-		for _, origin := range config.Get().AllowedOrigins {
-			if origin != "*" && o != origin {
-				continue
-			}
-
-			c.Header("Access-Control-Allow-Origin", origin)
-			c.Next()
-			return
+	if config.Get().IsPanelLocation(o) {
+		c.Header("Access-Control-Allow-Origin", o)
+		c.Next()
+		return
+	}
+
+	for _, origin := range config.Get().AllowedOrigins {
+		if origin != "*" && o != origin {
+			continue
 		}
+
+		c.Header("Access-Control-Allow-Origin", origin)
+		c.Next()
+		return
 	}
 
 	c.Header("Access-Control-Allow-Origin", config.Get().PanelLocation)
@@ -34,6 +52,13 @@ func SetAccessControlHeaders(c *gin.Context) {
 // if it is a server permission, the token has control over that server. If it is a global
 // token, this will ensure that the request is using a properly signed global token.
 func AuthorizationMiddleware(c *gin.Context) {
+	// Requests made over the local socket can only come from the user running Wings, so
+	// they do not need a token and are able to access the servers for every Panel.
+	if isLocalRequest(c) {
+		c.Next()
+		return
+	}
+
 	auth := strings.SplitN(c.GetHeader("Authorization"), " ", 2)
 
 	if len(auth) != 2 || auth[0] != "Bearer" {
@@ -45,20 +70,36 @@ func AuthorizationMiddleware(c *gin.Context) {
 		return
 	}
 
-	// Try to match the request against the global token for the Daemon, regardless
-	// of the permission type. If nothing is matched we will fall through to the Panel
-	// API to try and validate permissions for a server.
-	if auth[1] == config.Get().AuthenticationToken {
+	// Try to match the request against the global token for each Panel, regardless
+	// of the permission type. The Panel is stored on the request so that it can only
+	// access the servers that belong to it.
+	if p, ok := config.Get().GetPanelForToken(auth[1]); ok {
+		c.Set("panel", p.Name)
 		c.Next()
 
 		return
 	}
 
+	bans.RecordFailure(clientIp(c))
+
 	c.AbortWithStatusJSON(http.StatusForbidden, gin.H{
 		"error": "You are not authorized to access this endpoint.",
 	})
 }
 
+// Only allows the request if it was made by the primary Panel. This is used for routes that
+// change the node itself, rather than a server on it.
+func RequirePrimaryPanel(c *gin.Context) {
+	if c.GetString("panel") != "" {
+		c.AbortWithStatusJSON(http.StatusForbidden, gin.H{
+			"error": "You are not authorized to access this endpoint.",
+		})
+		return
+	}
+
+	c.Next()
+}
+
 // Helper function to fetch a server out of the servers collection stored in memory.
 func GetServer(uuid string) *server.Server {
 	return server.GetServers().Find(func(s *server.Server) bool {
@@ -66,11 +107,35 @@ func GetServer(uuid string) *server.Server {
 	})
 }
 
+// Ensures that the files of the requested server are not hibernated, or being hibernated,
+// since they do not exist on the disk. Returns a 409 if they are.
+func ServerNotHibernated(c *gin.Context) {
+	s := GetServer(c.Param("server"))
+	if s.IsHibernated() || s.IsHibernating() {
+		c.AbortWithStatusJSON(http.StatusConflict, gin.H{
+			"error": "The files for this server are hibernated and must be restored first.",
+		})
+		return
+	}
+
+	c.Next()
+}
+
 // Ensure that the requested server exists in this setup. Returns a 404 if we cannot
 // locate it.
 func ServerExists(c *gin.Context) {
 	u, err := uuid.Parse(c.Param("server"))
-	if err != nil || GetServer(u.String()) == nil {
+	if err != nil {
+		c.AbortWithStatusJSON(http.StatusNotFound, gin.H{
+			"error": "The resource you requested does not exist.",
+		})
+		return
+	}
+
+	// Servers belonging to a different Panel than the one making the request are treated
+	// as if they do not exist.
+	s := GetServer(u.String())
+	if p, ok := c.Get("panel"); s == nil || (ok && p != s.Panel()) {
 		c.AbortWithStatusJSON(http.StatusNotFound, gin.H{
 			"error": "The resource you requested does not exist.",
 		})
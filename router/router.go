@@ -10,9 +10,14 @@ func Configure() *gin.Engine {
 	gin.SetMode("release")
 
 	router := gin.New()
+	// The forwarding headers can be set by anyone, so they are only used for the requests made
+	// by the configured trusted proxies.
+	router.ForwardedByClientIP = false
 
 	router.Use(gin.Recovery())
+	router.Use(SetRequestId)
 	router.Use(SetAccessControlHeaders)
+	router.Use(BanMiddleware)
 	// @todo log this into a different file so you can setup IP blocking for abusive requests and such.
 	// This should still dump requests in debug mode since it does help with understanding the request
 	// lifecycle and quickly seeing what was called leading to the logs. However, it isn't feasible to mix
@@ -20,9 +25,10 @@ func Configure() *gin.Engine {
 	// spamfest.
 	router.Use(gin.LoggerWithFormatter(func(params gin.LogFormatterParams) string {
 		log.WithFields(log.Fields{
-			"client_ip": params.ClientIP,
-			"status":    params.StatusCode,
-			"latency":   params.Latency,
+			"client_ip":  params.ClientIP,
+			"request_id": params.Keys["request_id"],
+			"status":     params.StatusCode,
+			"latency":    params.Latency,
 		}).Debugf("%s %s", params.MethodColor()+params.Method+params.ResetColor(), params.Path)
 
 		return ""
@@ -32,6 +38,10 @@ func Configure() *gin.Engine {
 		c.Status(200)
 	})
 
+	// Reports the health of the node for load balancers and monitoring, which do not have
+	// access to the node token.
+	router.GET("/api/health", getHealth)
+
 	// These routes use signed URLs to validate access to the resource being requested.
 	router.GET("/download/backup", getDownloadBackup)
 	router.GET("/download/file", getDownloadFile)
@@ -50,12 +60,30 @@ func Configure() *gin.Engine {
 	// All of the routes beyond this mount will use an authorization middleware
 	// and will not be accessible without the correct Authorization header provided.
 	protected := router.Use(AuthorizationMiddleware)
-	protected.POST("/api/update", postUpdateConfiguration)
+	protected.POST("/api/update", RequirePrimaryPanel, postUpdateConfiguration)
 	protected.GET("/api/system", getSystemInformation)
+	protected.POST("/api/system/reload", RequirePrimaryPanel, postSystemReload)
+	protected.GET("/api/system/bans", RequirePrimaryPanel, getSystemBans)
+	protected.DELETE("/api/system/bans", RequirePrimaryPanel, deleteSystemBans)
+	protected.DELETE("/api/system/bans/:ip", RequirePrimaryPanel, deleteSystemBan)
+	protected.GET("/api/system/debug", RequirePrimaryPanel, getSystemDebug)
+	protected.POST("/api/system/debug", RequirePrimaryPanel, postSystemDebug)
+	protected.GET("/api/system/maintenance", getSystemMaintenance)
+	protected.POST("/api/system/maintenance", RequirePrimaryPanel, postSystemMaintenance)
 	protected.GET("/api/servers", getAllServers)
 	protected.POST("/api/servers", postCreateServer)
 	protected.POST("/api/transfer", postTransfer)
 
+	// Profiling and runtime statistics for diagnosing problems with a running instance, these
+	// are only available once enabled in the configuration or at runtime.
+	debug := router.Group("/api/system/debug")
+	debug.Use(AuthorizationMiddleware, RequirePrimaryPanel, RequireDebugEndpoints)
+	{
+		debug.GET("/runtime", getSystemDebugRuntime)
+		debug.GET("/pprof", getSystemDebugProfiles)
+		debug.GET("/pprof/:profile", getSystemDebugProfile)
+	}
+
 	// These are server specific routes, and require that the request be authorized, and
 	// that the server exist on the Daemon.
 	server := router.Group("/api/servers/:server")
@@ -66,33 +94,72 @@ func Configure() *gin.Engine {
 		server.DELETE("", deleteServer)
 
 		server.GET("/logs", getServerLogs)
+		server.GET("/resources/history", getServerResourceHistory)
+		server.GET("/crashes", getServerCrashReports)
+		server.GET("/crashes/:report", getServerCrashReport)
+		server.GET("/events", getServerEvents)
+		server.GET("/power", getServerPower)
 		server.POST("/power", postServerPower)
 		server.POST("/commands", postServerCommands)
-		server.POST("/install", postServerInstall)
-		server.POST("/reinstall", postServerReinstall)
+		server.GET("/console/recording", getServerConsoleRecording)
+		server.POST("/console/recording", postServerConsoleRecording)
+		server.DELETE("/console/recording", deleteServerConsoleRecording)
+		server.GET("/console/recording/download", getServerConsoleRecordingDownload)
+		server.POST("/exec", postServerExec)
+		server.GET("/processes", getServerProcesses)
+		server.POST("/install", ServerNotHibernated, postServerInstall)
+		server.GET("/install/dry-run", getServerInstallDryRun)
+		server.GET("/install/logs", getServerInstallLogs)
+		server.GET("/install/logs/:log", getServerInstallLog)
+		server.POST("/reinstall", ServerNotHibernated, postServerReinstall)
+		server.POST("/import", ServerNotHibernated, postServerImport)
+		server.GET("/mounts", getServerMounts)
+		server.PUT("/mounts", putServerMounts)
+		server.POST("/mounts/validate", postServerMountsValidate)
+		server.POST("/allocations/sync", postServerSyncAllocations)
+		server.POST("/container/rebuild", postServerRebuildContainer)
 
 		// This archive request causes the archive to start being created
 		// this should only be triggered by the panel.
-		server.POST("/archive", postServerArchive)
+		server.POST("/archive", ServerNotHibernated, postServerArchive)
 
-		files := server.Group("/files")
+		server.GET("/hibernation", getServerHibernation)
+		server.POST("/hibernation", postServerHibernation)
+		server.DELETE("/hibernation", deleteServerHibernation)
+
+		files := server.Group("/files", ServerNotHibernated)
 		{
 			files.GET("/contents", getServerFileContents)
+			files.GET("/preview", getServerFilePreview)
 			files.GET("/list-directory", getServerListDirectory)
 			files.PUT("/rename", putServerRenameFiles)
 			files.POST("/copy", postServerCopyFile)
 			files.POST("/write", postServerWriteFile)
+			files.GET("/text", getServerTextFile)
+			files.POST("/text", postServerTextFile)
 			files.POST("/create-directory", postServerCreateDirectory)
 			files.POST("/delete", postServerDeleteFiles)
 			files.POST("/compress", postServerCompressFiles)
 			files.POST("/decompress", postServerDecompressFiles)
+			files.GET("/pull", getServerFilePulls)
+			files.POST("/pull", postServerPullFile)
+			files.DELETE("/pull/:pull", deleteServerFilePull)
+			files.POST("/repair-permissions", postServerRepairPermissions)
 		}
 
-		backup := server.Group("/backup")
+		backup := server.Group("/backup", ServerNotHibernated)
 		{
 			backup.POST("", postServerBackup)
 			backup.DELETE("/:backup", deleteServerBackup)
 		}
+
+		snapshots := server.Group("/snapshots", ServerNotHibernated)
+		{
+			snapshots.GET("", getServerSnapshots)
+			snapshots.POST("", postServerSnapshot)
+			snapshots.POST("/:snapshot/rollback", postServerSnapshotRollback)
+			snapshots.DELETE("/:snapshot", deleteServerSnapshot)
+		}
 	}
 
 	return router
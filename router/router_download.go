@@ -1,26 +1,25 @@
 package router
 
 import (
-	"bufio"
 	"errors"
 	"github.com/gin-gonic/gin"
 	"github.com/avatag-host/claws/router/tokens"
 	"github.com/avatag-host/claws/server/backup"
 	"net/http"
 	"os"
-	"strconv"
 )
 
 // Handle a download request for a server backup.
 func getDownloadBackup(c *gin.Context) {
 	token := tokens.BackupPayload{}
-	if err := tokens.ParseToken([]byte(c.Query("token")), &token); err != nil {
+	panel, err := tokens.ParseToken([]byte(c.Query("token")), &token)
+	if err != nil {
 		TrackedError(err).AbortWithServerError(c)
 		return
 	}
 
 	s := GetServer(token.ServerUuid)
-	if s == nil || !token.IsUniqueRequest() {
+	if s == nil || s.Panel() != panel || !token.IsUniqueRequest() {
 		c.AbortWithStatusJSON(http.StatusNotFound, gin.H{
 			"error": "The requested resource was not found on this server.",
 		})
@@ -47,23 +46,20 @@ func getDownloadBackup(c *gin.Context) {
 	}
 	defer f.Close()
 
-	c.Header("Content-Length", strconv.Itoa(int(st.Size())))
-	c.Header("Content-Disposition", "attachment; filename="+st.Name())
-	c.Header("Content-Type", "application/octet-stream")
-
-	bufio.NewReader(f).WriteTo(c.Writer)
+	serveAttachment(c, f, st.Name(), st.ModTime())
 }
 
 // Handles downloading a specific file for a server.
 func getDownloadFile(c *gin.Context) {
 	token := tokens.FilePayload{}
-	if err := tokens.ParseToken([]byte(c.Query("token")), &token); err != nil {
+	panel, err := tokens.ParseToken([]byte(c.Query("token")), &token)
+	if err != nil {
 		TrackedError(err).AbortWithServerError(c)
 		return
 	}
 
 	s := GetServer(token.ServerUuid)
-	if s == nil || !token.IsUniqueRequest() {
+	if s == nil || s.Panel() != panel || !token.IsUniqueRequest() {
 		c.AbortWithStatusJSON(http.StatusNotFound, gin.H{
 			"error": "The requested resource was not found on this server.",
 		})
@@ -89,10 +85,7 @@ func getDownloadFile(c *gin.Context) {
 		TrackedServerError(err, s).AbortWithServerError(c)
 		return
 	}
+	defer f.Close()
 
-	c.Header("Content-Length", strconv.Itoa(int(st.Size())))
-	c.Header("Content-Disposition", "attachment; filename="+st.Name())
-	c.Header("Content-Type", "application/octet-stream")
-
-	bufio.NewReader(f).WriteTo(c.Writer)
+	serveAttachment(c, f, st.Name(), st.ModTime())
 }
@@ -6,15 +6,32 @@ import (
 	"github.com/apex/log"
 	"github.com/gin-gonic/gin"
 	"github.com/pkg/errors"
+	"github.com/avatag-host/claws/config"
+	"github.com/avatag-host/claws/environment"
 	"github.com/avatag-host/claws/server"
+	"github.com/avatag-host/claws/server/activity"
+	"github.com/avatag-host/claws/server/ansi"
+	"github.com/avatag-host/claws/server/filesystem"
+	"github.com/avatag-host/claws/server/snapshot"
 	"net/http"
 	"os"
 	"strconv"
+	"time"
 )
 
 type serverProcData struct {
 	server.ResourceUsage
-	Suspended bool `json:"suspended"`
+	Suspended bool     `json:"suspended"`
+	Paused    bool     `json:"paused"`
+	Addresses []string `json:"addresses"`
+}
+
+type serverListItem struct {
+	Uuid      string                `json:"uuid"`
+	Panel     string                `json:"panel"`
+	Suspended bool                  `json:"suspended"`
+	Addresses []string              `json:"addresses"`
+	Resources *server.ResourceUsage `json:"resources"`
 }
 
 // Returns a single server from the collection of servers.
@@ -24,6 +41,103 @@ func getServer(c *gin.Context) {
 	c.JSON(http.StatusOK, serverProcData{
 		ResourceUsage: *s.Proc(),
 		Suspended:     s.IsSuspended(),
+		Paused:        s.IsPaused(),
+		Addresses:     s.Config().Allocations.Addresses(),
+	})
+}
+
+// Returns the resource usage history for a server. The range can be limited by passing
+// "from" and "to" as unix timestamps, otherwise the last 24 hours are returned.
+func getServerResourceHistory(c *gin.Context) {
+	s := GetServer(c.Param("server"))
+
+	to := time.Now()
+	from := to.Add(time.Hour * -24)
+
+	if v := c.Query("from"); v != "" {
+		i, err := strconv.ParseInt(v, 10, 64)
+		if err != nil {
+			c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": "The \"from\" parameter must be a unix timestamp."})
+			return
+		}
+		from = time.Unix(i, 0)
+	}
+
+	if v := c.Query("to"); v != "" {
+		i, err := strconv.ParseInt(v, 10, 64)
+		if err != nil {
+			c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": "The \"to\" parameter must be a unix timestamp."})
+			return
+		}
+		to = time.Unix(i, 0)
+	}
+
+	c.JSON(http.StatusOK, gin.H{"data": s.ResourceHistory().Query(from, to)})
+}
+
+// Returns the crash reports stored for a server, newest first.
+func getServerCrashReports(c *gin.Context) {
+	s := GetServer(c.Param("server"))
+
+	reports, err := s.CrashReports()
+	if err != nil {
+		TrackedServerError(err, s).AbortWithServerError(c)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"data": reports})
+}
+
+// Returns a single crash report for a server.
+func getServerCrashReport(c *gin.Context) {
+	s := GetServer(c.Param("server"))
+
+	r, err := s.CrashReport(c.Param("report"))
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			c.AbortWithStatusJSON(http.StatusNotFound, gin.H{
+				"error": "The requested crash report was not found.",
+			})
+			return
+		}
+
+		TrackedServerError(err, s).AbortWithServerError(c)
+		return
+	}
+
+	c.JSON(http.StatusOK, r)
+}
+
+// Returns the events recorded for a server after the sequence number passed in "since". The
+// response includes the latest sequence number, and whether or not any events between the
+// requested sequence and the first returned event have been discarded.
+func getServerEvents(c *gin.Context) {
+	s := GetServer(c.Param("server"))
+
+	j := s.Events().Journal()
+	if j == nil {
+		c.AbortWithStatusJSON(http.StatusNotFound, gin.H{
+			"error": "Event persistence is not enabled on this instance.",
+		})
+		return
+	}
+
+	var since uint64
+	if v := c.Query("since"); v != "" {
+		i, err := strconv.ParseUint(v, 10, 64)
+		if err != nil {
+			c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": "The \"since\" parameter must be a sequence number."})
+			return
+		}
+		since = i
+	}
+
+	records, latest, complete := j.Since(since)
+
+	c.JSON(http.StatusOK, gin.H{
+		"data":     records,
+		"sequence": latest,
+		"complete": complete,
 	})
 }
 
@@ -38,15 +152,36 @@ func getServerLogs(c *gin.Context) {
 		l = 100
 	}
 
+	mode := c.Query("ansi")
+	if mode == "" {
+		mode = s.ConsoleAnsi()
+	} else if !ansi.IsValidMode(mode) {
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{
+			"error": "The \"ansi\" parameter must be one of \"keep\", \"strip\" or \"html\".",
+		})
+		return
+	}
+
 	out, err := s.ReadLogfile(l)
 	if err != nil {
 		TrackedServerError(err, s).AbortWithServerError(c)
 		return
 	}
 
+	for i, line := range out {
+		out[i] = ansi.Convert(mode, line)
+	}
+
 	c.JSON(http.StatusOK, gin.H{"data": out})
 }
 
+// Returns the current state of the power action queue for a server.
+func getServerPower(c *gin.Context) {
+	s := GetServer(c.Param("server"))
+
+	c.JSON(http.StatusOK, s.PowerQueue().State())
+}
+
 // Handles a request to control the power state of a server. If the action being passed
 // through is invalid a 404 is returned. Otherwise, a HTTP/202 Accepted response is returned
 // and the actual power action is run asynchronously so that we don't have to block the
@@ -86,19 +221,49 @@ func postServerPower(c *gin.Context) {
 		return
 	}
 
+	// A paused server can still be stopped or killed, which resumes the process first.
+	if (data.Action == server.PowerActionStart || data.Action == server.PowerActionRestart) && s.IsPaused() {
+		c.AbortWithStatusJSON(http.StatusConflict, gin.H{
+			"error": "Cannot start or restart a server that is paused while suspended.",
+		})
+		return
+	}
+
+	if (data.Action == server.PowerActionStart || data.Action == server.PowerActionRestart) && server.IsMaintenanceMode() {
+		c.AbortWithStatusJSON(http.StatusServiceUnavailable, gin.H{
+			"error": "Cannot start or restart a server while this node is in maintenance mode.",
+		})
+		return
+	}
+
+	if data.Action == server.PowerActionStart || data.Action == server.PowerActionRestart {
+		if err := s.CheckReservations(); err != nil {
+			c.AbortWithStatusJSON(http.StatusServiceUnavailable, gin.H{
+				"error": "Cannot start or restart this server: " + err.Error() + ".",
+			})
+			return
+		}
+	}
+
 	// Pass the actual heavy processing off to a separate thread to handle so that
 	// we can immediately return a response from the server. Some of these actions
 	// can take quite some time, especially stopping or restarting.
 	go func(s *server.Server) {
-		if err := s.HandlePowerAction(data.Action, 30); err != nil {
+		if err := s.HandlePowerAction(data.Action, config.Get().System.PowerActionTimeout); err != nil {
 			if errors.Is(err, context.DeadlineExceeded) {
 				s.Log().WithField("action", data.Action).
 					Warn("could not acquire a lock while attempting to perform a power action")
+			} else if errors.Is(err, server.ErrPowerActionCancelled) {
+				s.Log().WithField("action", data.Action).
+					Info("power action was cancelled by a higher priority action before it could be executed")
 			} else {
 				s.Log().WithFields(log.Fields{"action": data, "error": err}).
 					Error("encountered error processing a server power action in the background")
 			}
+			return
 		}
+
+		s.RecordActivity(data.Action.ActivityEvent(), "", "", nil)
 	}(s)
 
 	c.Status(http.StatusAccepted)
@@ -118,6 +283,13 @@ func postServerCommands(c *gin.Context) {
 		return
 	}
 
+	if s.IsPaused() {
+		c.AbortWithStatusJSON(http.StatusConflict, gin.H{
+			"error": "Cannot send commands to a server that is paused while suspended.",
+		})
+		return
+	}
+
 	var data struct {
 		Commands []string `json:"commands"`
 	}
@@ -129,12 +301,106 @@ func postServerCommands(c *gin.Context) {
 	for _, command := range data.Commands {
 		if err := s.Environment.SendCommand(command); err != nil {
 			s.Log().WithFields(log.Fields{"command": command, "error": err}).Warn("failed to send command to server instance")
+			continue
 		}
+
+		s.RecordActivity(activity.EventConsoleCommand, "", "", map[string]interface{}{"command": command})
 	}
 
 	c.Status(http.StatusNoContent)
 }
 
+// Returns the processes currently running within the server environment.
+func getServerProcesses(c *gin.Context) {
+	s := GetServer(c.Param("server"))
+
+	if running, err := s.Environment.IsRunning(); err != nil {
+		TrackedServerError(err, s).AbortWithServerError(c)
+		return
+	} else if !running {
+		c.AbortWithStatusJSON(http.StatusBadGateway, gin.H{
+			"error": "Cannot list the processes of a stopped server instance.",
+		})
+		return
+	}
+
+	p, err := s.Environment.Processes()
+	if err != nil {
+		TrackedServerError(err, s).AbortWithServerError(c)
+		return
+	}
+
+	c.JSON(http.StatusOK, p)
+}
+
+const (
+	// The default and maximum number of seconds a command run using exec may take.
+	defaultExecTimeout = 10
+	maxExecTimeout     = 60
+
+	// The maximum number of bytes of output captured from stdout and stderr for a command.
+	maxExecOutput = 64 * 1024
+)
+
+// Runs a one-off command within the server environment and returns the output. This is
+// separate from sending commands to the server console and is intended for automation that
+// needs to inspect the runtime environment.
+func postServerExec(c *gin.Context) {
+	s := GetServer(c.Param("server"))
+
+	var data struct {
+		Command []string `json:"command"`
+		Timeout int      `json:"timeout"`
+	}
+	// BindJSON sends 400 if the request fails, all we need to do is return
+	if err := c.BindJSON(&data); err != nil {
+		return
+	}
+
+	if len(data.Command) == 0 || data.Command[0] == "" {
+		c.AbortWithStatusJSON(http.StatusUnprocessableEntity, gin.H{
+			"error": "A command must be provided.",
+		})
+		return
+	}
+
+	if running, err := s.Environment.IsRunning(); err != nil {
+		TrackedServerError(err, s).AbortWithServerError(c)
+		return
+	} else if !running {
+		c.AbortWithStatusJSON(http.StatusBadGateway, gin.H{
+			"error": "Cannot run commands in a stopped server instance.",
+		})
+		return
+	}
+
+	if data.Timeout <= 0 {
+		data.Timeout = defaultExecTimeout
+	} else if data.Timeout > maxExecTimeout {
+		data.Timeout = maxExecTimeout
+	}
+
+	ctx, cancel := context.WithTimeout(c.Request.Context(), time.Second*time.Duration(data.Timeout))
+	defer cancel()
+
+	s.Log().WithField("command", data.Command).Info("running exec command in server environment")
+
+	res, err := s.Environment.Exec(ctx, data.Command, maxExecOutput)
+	if err != nil {
+		if errors.Is(err, context.DeadlineExceeded) {
+			c.AbortWithStatusJSON(http.StatusGatewayTimeout, gin.H{
+				"error": "The command did not complete before the timeout was reached.",
+			})
+			return
+		}
+
+		TrackedServerError(err, s).AbortWithServerError(c)
+		return
+	}
+
+	c.JSON(http.StatusOK, res)
+}
+
 // Updates information about a server internally.
 func patchServer(c *gin.Context) {
 	s := GetServer(c.Param("server"))
@@ -156,6 +422,13 @@ func patchServer(c *gin.Context) {
 func postServerInstall(c *gin.Context) {
 	s := GetServer(c.Param("server"))
 
+	if !s.Config().SkipEggScripts && !server.SupportsInstallScripts() {
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{
+			"error": "Installation scripts are not supported by the environment used on this node.",
+		})
+		return
+	}
+
 	go func(serv *server.Server) {
 		if err := serv.Install(true); err != nil {
 			serv.Log().WithField("error", err).Error("failed to execute server installation process")
@@ -165,6 +438,20 @@ func postServerInstall(c *gin.Context) {
 	c.Status(http.StatusAccepted)
 }
 
+// Returns the installation script that would be executed for a server with all of the
+// variables substituted, without actually running the installation process.
+func getServerInstallDryRun(c *gin.Context) {
+	s := GetServer(c.Param("server"))
+
+	d, err := s.DryRunInstall()
+	if err != nil {
+		TrackedServerError(err, s).AbortWithServerError(c)
+		return
+	}
+
+	c.JSON(http.StatusOK, d)
+}
+
 // Reinstalls a server.
 func postServerReinstall(c *gin.Context) {
 	s := GetServer(c.Param("server"))
@@ -176,6 +463,13 @@ func postServerReinstall(c *gin.Context) {
 		return
 	}
 
+	if !s.Config().SkipEggScripts && !server.SupportsInstallScripts() {
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{
+			"error": "Installation scripts are not supported by the environment used on this node.",
+		})
+		return
+	}
+
 	go func(s *server.Server) {
 		if err := s.Reinstall(); err != nil {
 			s.Log().WithField("error", err).Error("failed to complete server re-install process")
@@ -185,6 +479,89 @@ func postServerReinstall(c *gin.Context) {
 	c.Status(http.StatusAccepted)
 }
 
+// Replaces the files for a server with the contents of an archive, rather than running the
+// installation script. The import runs in the background and reports its progress over the
+// websocket.
+func postServerImport(c *gin.Context) {
+	s := GetServer(c.Param("server"))
+
+	var src server.ImportSource
+	if err := c.BindJSON(&src); err != nil {
+		return
+	}
+
+	if err := src.Validate(); err != nil {
+		c.AbortWithStatusJSON(http.StatusUnprocessableEntity, gin.H{"error": err.Error()})
+		return
+	}
+
+	if s.IsInstalling() {
+		c.AbortWithStatusJSON(http.StatusConflict, gin.H{
+			"error": "Cannot import server files while the server is being installed.",
+		})
+		return
+	}
+
+	if s.IsHibernated() || s.IsHibernating() {
+		c.AbortWithStatusJSON(http.StatusConflict, gin.H{
+			"error": "Cannot import server files while the server is hibernated.",
+		})
+		return
+	}
+
+	if s.GetState() != environment.ProcessOfflineState {
+		c.AbortWithStatusJSON(http.StatusConflict, gin.H{
+			"error": "Cannot import server files while the server is running.",
+		})
+		return
+	}
+
+	go func(s *server.Server) {
+		if err := s.Import(src); err != nil {
+			s.Log().WithField("error", err).Error("failed to import server files")
+		}
+	}(s)
+
+	c.Status(http.StatusAccepted)
+}
+
+// Returns all of the installation logs stored for a server.
+func getServerInstallLogs(c *gin.Context) {
+	s := GetServer(c.Param("server"))
+
+	logs, err := s.InstallLogs()
+	if err != nil {
+		TrackedServerError(err, s).AbortWithServerError(c)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"data": logs})
+}
+
+// Downloads a specific installation log for a server.
+func getServerInstallLog(c *gin.Context) {
+	s := GetServer(c.Param("server"))
+
+	p, err := s.InstallLogPath(c.Param("log"))
+	if err == nil {
+		_, err = os.Stat(p)
+	}
+
+	if err != nil {
+		if errors.Is(err, server.ErrInvalidInstallLog) || os.IsNotExist(err) {
+			c.AbortWithStatusJSON(http.StatusNotFound, gin.H{
+				"error": "The requested installation log was not found on this server.",
+			})
+			return
+		}
+
+		TrackedServerError(err, s).AbortWithServerError(c)
+		return
+	}
+
+	c.FileAttachment(p, c.Param("log"))
+}
+
 // Deletes a server from the wings daemon and dissociate it's objects.
 func deleteServer(c *gin.Context) {
 	s := GetServer(c.Param("server"))
@@ -208,6 +585,7 @@ func deleteServer(c *gin.Context) {
 	s.Events().Destroy()
 	s.Throttler().StopTimer()
 	s.Websockets().CancelAll()
+	s.CancelFilePulls()
 
 	// Destroy the environment; in Docker this will handle a running container and
 	// forcibly terminate it before removing the container, so we do not need to handle
@@ -222,14 +600,90 @@ func deleteServer(c *gin.Context) {
 	//
 	// In addition, servers with large amounts of files can take some time to finish deleting
 	// so we don't want to block the HTTP call while waiting on this.
-	go func(p string) {
-		if err := os.RemoveAll(p); err != nil {
+	//
+	// The user allocated to the server is only released once its files are gone, so that
+	// another server is never given a user that still owns files on the disk.
+	go func(fs *filesystem.Filesystem, uuid string) {
+		if err := os.RemoveAll(fs.Path()); err != nil {
 			log.WithFields(log.Fields{
-				"path":  p,
+				"path":  fs.Path(),
 				"error": errors.WithStack(err),
 			}).Warn("failed to remove server files during deletion process")
+			return
 		}
-	}(s.Filesystem().Path())
+
+		if err := fs.RemoveChownManifest(); err != nil {
+			log.WithFields(log.Fields{
+				"server": uuid,
+				"error":  err,
+			}).Warn("failed to remove server permissions manifest during deletion process")
+		}
+
+		if err := fs.RemoveQuota(); err != nil {
+			log.WithFields(log.Fields{
+				"server": uuid,
+				"error":  err,
+			}).Warn("failed to remove server disk quota during deletion process")
+		}
+
+		if err := fs.RemoveDiskUsageCache(); err != nil {
+			log.WithFields(log.Fields{
+				"server": uuid,
+				"error":  err,
+			}).Warn("failed to remove stored server disk usage during deletion process")
+		}
+
+		if err := server.RemoveFirstBoot(uuid); err != nil {
+			log.WithFields(log.Fields{
+				"server": uuid,
+				"error":  err,
+			}).Warn("failed to remove server first boot state during deletion process")
+		}
+
+		if err := server.ReleaseServerUser(uuid); err != nil {
+			log.WithFields(log.Fields{
+				"server": uuid,
+				"error":  err,
+			}).Warn("failed to release server user during deletion process")
+		}
+	}(s.Filesystem(), s.Id())
+
+	// Snapshots are tied to the server files on this machine, so once the server is gone
+	// there is no reason to keep them around.
+	go func(uuid string) {
+		if err := snapshot.RemoveAll(uuid); err != nil {
+			log.WithFields(log.Fields{
+				"server": uuid,
+				"error":  errors.WithStack(err),
+			}).Warn("failed to remove server snapshots during deletion process")
+		}
+	}(s.Id())
+
+	if j := s.Events().Journal(); j != nil {
+		if err := j.Remove(); err != nil {
+			s.Log().WithField("error", err).Warn("failed to remove server event journal during deletion process")
+		}
+	}
+
+	if err := s.ResourceHistory().Remove(); err != nil {
+		s.Log().WithField("error", err).Warn("failed to remove server resource history during deletion process")
+	}
+
+	if err := s.RemoveConsoleRecording(); err != nil {
+		s.Log().WithField("error", err).Warn("failed to remove server console recording during deletion process")
+	}
+
+	if err := s.RemoveCrashReports(); err != nil {
+		s.Log().WithField("error", err).Warn("failed to remove server crash reports during deletion process")
+	}
+
+	if err := s.RemoveHibernation(); err != nil {
+		s.Log().WithField("error", err).Warn("failed to remove hibernated server files during deletion process")
+	}
+
+	if err := s.RemoveInstallLogs(); err != nil {
+		s.Log().WithField("error", err).Warn("failed to remove server installation logs during deletion process")
+	}
 
 	var uuid = s.Id()
 	server.GetServers().Remove(func(s2 *server.Server) bool {
@@ -0,0 +1,41 @@
+package router
+
+import (
+	"github.com/avatag-host/claws/server"
+	"github.com/gin-gonic/gin"
+	"github.com/pkg/errors"
+	"net/http"
+)
+
+// Syncs the allocations for a server with the Panel and rebuilds the port bindings for its
+// container if they have changed, so that new allocations are available without the server
+// needing to be reinstalled.
+func postServerSyncAllocations(c *gin.Context) {
+	s := GetServer(c.Param("server"))
+
+	var data struct {
+		Restart bool `json:"restart"`
+	}
+
+	// An empty body is acceptable, in which case a running server is not restarted.
+	if c.Request.ContentLength != 0 {
+		if err := c.BindJSON(&data); err != nil {
+			return
+		}
+	}
+
+	res, err := s.SyncAllocations(data.Restart)
+	if err != nil {
+		if errors.Is(err, server.ErrPowerActionInProgress) {
+			c.AbortWithStatusJSON(http.StatusConflict, gin.H{
+				"error": "Cannot sync allocations while the server is being started, stopped or installed.",
+			})
+			return
+		}
+
+		TrackedServerError(err, s).AbortWithServerError(c)
+		return
+	}
+
+	c.JSON(http.StatusOK, res)
+}
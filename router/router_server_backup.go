@@ -19,6 +19,7 @@ func postServerBackup(c *gin.Context) {
 	if err := c.BindJSON(&data); err != nil {
 		return
 	}
+	data.Panel = s.Panel()
 
 	var adapter backup.BackupInterface
 	var err error
@@ -0,0 +1,36 @@
+package router
+
+import (
+	"github.com/avatag-host/claws/server"
+	"github.com/gin-gonic/gin"
+	"github.com/pkg/errors"
+	"net/http"
+)
+
+// Destroys and recreates the container for a server using its current configuration, without
+// modifying any of the server files. The server must be stopped.
+func postServerRebuildContainer(c *gin.Context) {
+	s := GetServer(c.Param("server"))
+
+	if err := s.RebuildContainer(); err != nil {
+		switch {
+		case errors.Is(err, server.ErrRebuildUnsupported):
+			c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{
+				"error": "Rebuilding the container is only supported for servers using the Docker environment.",
+			})
+		case errors.Is(err, server.ErrIsRunning):
+			c.AbortWithStatusJSON(http.StatusConflict, gin.H{
+				"error": "The server must be stopped before its container can be rebuilt.",
+			})
+		case errors.Is(err, server.ErrPowerActionInProgress):
+			c.AbortWithStatusJSON(http.StatusConflict, gin.H{
+				"error": "Cannot rebuild the container while the server is being started, stopped or installed.",
+			})
+		default:
+			TrackedServerError(err, s).AbortWithServerError(c)
+		}
+		return
+	}
+
+	c.Status(http.StatusNoContent)
+}
@@ -6,8 +6,10 @@ import (
 	"github.com/pkg/errors"
 	"github.com/avatag-host/claws/router/tokens"
 	"github.com/avatag-host/claws/server"
+	"github.com/avatag-host/claws/server/activity"
 	"github.com/avatag-host/claws/server/filesystem"
 	"golang.org/x/sync/errgroup"
+	"io"
 	"mime/multipart"
 	"net/http"
 	"net/url"
@@ -45,12 +47,60 @@ func getServerFileContents(c *gin.Context) {
 		c.Header("Content-Type", "application/octet-stream")
 	}
 
-	if err := s.Filesystem().Readfile(p, c.Writer); err != nil {
+	if err := s.Filesystem().Readfile(p, fileResponseWriter(c)); err != nil {
 		TrackedServerError(err, s).AbortFilesystemError(c)
 		return
 	}
 }
 
+// Returns a preview of an image on the server, scaled down to fit within the size given in the
+// request so that the Panel can show it without downloading the entire file.
+func getServerFilePreview(c *gin.Context) {
+	s := GetServer(c.Param("server"))
+
+	p, err := url.QueryUnescape(c.Query("file"))
+	if err != nil {
+		TrackedServerError(err, s).AbortWithServerError(c)
+		return
+	}
+	p = "/" + strings.TrimLeft(p, "/")
+
+	size, _ := strconv.Atoi(c.Query("size"))
+
+	preview, err := s.Filesystem().Preview(p, size)
+	if err != nil {
+		switch {
+		case errors.Is(err, filesystem.ErrNotImage), errors.Is(err, filesystem.ErrIsDirectory):
+			c.AbortWithStatusJSON(http.StatusUnsupportedMediaType, gin.H{
+				"error":    "The requested file is not an image that can be previewed.",
+				"mimetype": preview.SourceMimetype,
+			})
+		case errors.Is(err, filesystem.ErrImageTooLarge):
+			c.AbortWithStatusJSON(http.StatusRequestEntityTooLarge, gin.H{
+				"error":    "The requested image is too large to be previewed.",
+				"mimetype": preview.SourceMimetype,
+			})
+		case errors.Is(err, filesystem.ErrPreviewBusy):
+			c.Header("Retry-After", "5")
+			c.AbortWithStatusJSON(http.StatusServiceUnavailable, gin.H{
+				"error": "Too many images are being previewed at the moment, try again shortly.",
+			})
+		default:
+			TrackedServerError(err, s).AbortFilesystemError(c)
+		}
+		return
+	}
+
+	s.RecordActivity(activity.EventFileWrite, "", "", map[string]interface{}{"file": p})
+	defer preview.Close()
+
+	c.Header("Content-Type", preview.Mimetype)
+	c.Header("X-Mime-Type", preview.SourceMimetype)
+	c.Header("Cache-Control", "private, max-age=60")
+
+	io.Copy(fileResponseWriter(c), preview)
+}
+
 // Returns the contents of a directory for a server.
 func getServerListDirectory(c *gin.Context) {
 	s := GetServer(c.Param("server"))
@@ -134,6 +184,8 @@ func putServerRenameFiles(c *gin.Context) {
 		return
 	}
 
+	s.RecordActivity(activity.EventFileRename, "", "", map[string]interface{}{"root": data.Root, "files": data.Files})
+
 	c.Status(http.StatusNoContent)
 }
 
@@ -154,6 +206,8 @@ func postServerCopyFile(c *gin.Context) {
 		return
 	}
 
+	s.RecordActivity(activity.EventFileCopy, "", "", map[string]interface{}{"file": data.Location})
+
 	c.Status(http.StatusNoContent)
 }
 
@@ -199,6 +253,8 @@ func postServerDeleteFiles(c *gin.Context) {
 		return
 	}
 
+	s.RecordActivity(activity.EventFileDelete, "", "", map[string]interface{}{"root": data.Root, "files": data.Files})
+
 	c.Status(http.StatusNoContent)
 }
 
@@ -225,6 +281,88 @@ func postServerWriteFile(c *gin.Context) {
 		return
 	}
 
+	s.RecordActivity(activity.EventFileWrite, "", "", map[string]interface{}{"file": f})
+
+	if st, err := s.Filesystem().Stat(f); err == nil {
+		s.RunFileUploadedHooks(f, st.Info.Size())
+	}
+
+	c.Status(http.StatusNoContent)
+}
+
+// Returns the contents of a text file on the server converted to UTF-8, along with the encoding
+// and line endings of the file so that it can be saved back the same way.
+func getServerTextFile(c *gin.Context) {
+	s := GetServer(c.Param("server"))
+
+	p, err := url.QueryUnescape(c.Query("file"))
+	if err != nil {
+		TrackedServerError(err, s).AbortWithServerError(c)
+		return
+	}
+	p = "/" + strings.TrimLeft(p, "/")
+
+	t, err := s.Filesystem().ReadTextFile(p)
+	if err != nil {
+		if errors.Is(err, filesystem.ErrFileTooLarge) || errors.Is(err, filesystem.ErrNotTextFile) || errors.Is(err, filesystem.ErrIsDirectory) {
+			c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{
+				"error": "The requested file cannot be edited as text.",
+			})
+			return
+		}
+
+		TrackedServerError(err, s).AbortFilesystemError(c)
+		return
+	}
+
+	c.JSON(http.StatusOK, t)
+}
+
+// Writes text to a file on the server, converting it to the encoding and line endings given
+// in the request.
+func postServerTextFile(c *gin.Context) {
+	s := GetServer(c.Param("server"))
+
+	p, err := url.QueryUnescape(c.Query("file"))
+	if err != nil {
+		TrackedServerError(err, s).AbortWithServerError(c)
+		return
+	}
+	p = "/" + strings.TrimLeft(p, "/")
+
+	var data filesystem.TextFile
+	if err := c.BindJSON(&data); err != nil {
+		return
+	}
+
+	if err := s.Filesystem().WriteTextFile(p, &data); err != nil {
+		switch {
+		case errors.Is(err, filesystem.ErrUnsupportedEncoding):
+			c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{
+				"error": "The encoding must be one of \"utf-8\", \"utf-16le\", \"utf-16be\" or \"latin-1\".",
+			})
+		case errors.Is(err, filesystem.ErrUnsupportedNewline):
+			c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{
+				"error": "The newline must be either \"lf\" or \"crlf\".",
+			})
+		case errors.Is(err, filesystem.ErrUnencodableText):
+			c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{
+				"error": "The content contains characters that cannot be saved using the requested encoding.",
+			})
+		case errors.Is(err, filesystem.ErrIsDirectory):
+			c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{
+				"error": "Cannot write file, name conflicts with an existing directory by the same name.",
+			})
+		default:
+			TrackedServerError(err, s).AbortFilesystemError(c)
+		}
+		return
+	}
+
+	if st, err := s.Filesystem().Stat(p); err == nil {
+		s.RunFileUploadedHooks(p, st.Info.Size())
+	}
+
 	c.Status(http.StatusNoContent)
 }
 
@@ -253,6 +391,8 @@ func postServerCreateDirectory(c *gin.Context) {
 		return
 	}
 
+	s.RecordActivity(activity.EventFileCreateDirectory, "", "", map[string]interface{}{"name": data.Name, "path": data.Path})
+
 	c.Status(http.StatusNoContent)
 }
 
@@ -288,6 +428,8 @@ func postServerCompressFiles(c *gin.Context) {
 		return
 	}
 
+	s.RecordActivity(activity.EventFileCompress, "", "", map[string]interface{}{"root": data.RootPath, "files": data.Files, "archive": f.Name()})
+
 	c.JSON(http.StatusOK, &filesystem.Stat{
 		Info:     f,
 		Mimetype: "application/tar+gzip",
@@ -330,6 +472,15 @@ func postServerDecompressFiles(c *gin.Context) {
 	}
 
 	if err := s.Filesystem().DecompressFile(data.RootPath, data.File); err != nil {
+		if filesystem.IsExtractionLimitError(err) {
+			s.Log().WithField("error", err).Warn("failed to decompress file due to extraction limits")
+
+			c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{
+				"error": "This archive exceeds the limits for extracting archives on this node.",
+			})
+			return
+		}
+
 		if errors.Is(err, os.ErrNotExist) {
 			c.AbortWithStatusJSON(http.StatusNotFound, gin.H{
 				"error": "The requested archive was not found.",
@@ -353,18 +504,21 @@ func postServerDecompressFiles(c *gin.Context) {
 		return
 	}
 
+	s.RecordActivity(activity.EventFileDecompress, "", "", map[string]interface{}{"root": data.RootPath, "file": data.File})
+
 	c.Status(http.StatusNoContent)
 }
 
 func postServerUploadFiles(c *gin.Context) {
 	token := tokens.UploadPayload{}
-	if err := tokens.ParseToken([]byte(c.Query("token")), &token); err != nil {
+	panel, err := tokens.ParseToken([]byte(c.Query("token")), &token)
+	if err != nil {
 		TrackedError(err).AbortWithServerError(c)
 		return
 	}
 
 	s := GetServer(token.ServerUuid)
-	if s == nil || !token.IsUniqueRequest() {
+	if s == nil || s.Panel() != panel || !token.IsUniqueRequest() {
 		c.AbortWithStatusJSON(http.StatusNotFound, gin.H{
 			"error": "The requested resource was not found on this server.",
 		})
@@ -407,6 +561,13 @@ func postServerUploadFiles(c *gin.Context) {
 			TrackedServerError(err, s).AbortFilesystemError(c)
 			return
 		}
+
+		s.RecordActivity(activity.EventFileUpload, "", clientIp(c), map[string]interface{}{
+			"file": filepath.Join("/", strings.TrimPrefix(p, s.Filesystem().Path())),
+			"size": header.Size,
+		})
+
+		s.RunFileUploadedHooks(filepath.Join("/", strings.TrimPrefix(p, s.Filesystem().Path())), header.Size)
 	}
 }
 
@@ -423,3 +584,103 @@ func handleFileUpload(p string, s *server.Server, header *multipart.FileHeader)
 
 	return nil
 }
+
+// Repairs the owner and permissions of every file for the server. The repair is performed in
+// the background and its progress is sent over the websocket, unless "wait" is set in which
+// case the response is sent once the repair has completed.
+func postServerRepairPermissions(c *gin.Context) {
+	s := GetServer(c.Param("server"))
+
+	if c.Query("wait") != "true" {
+		go func(s *server.Server) {
+			if _, err := s.RepairPermissions(); err != nil && !errors.Is(err, server.ErrPermissionsRepairInProgress) {
+				s.Log().WithField("error", err).Warn("failed to repair server permissions in the background")
+			}
+		}(s)
+
+		c.Status(http.StatusAccepted)
+		return
+	}
+
+	files, err := s.RepairPermissions()
+	if err != nil {
+		if errors.Is(err, server.ErrPermissionsRepairInProgress) {
+			c.AbortWithStatusJSON(http.StatusConflict, gin.H{
+				"error": "The permissions for this server are already being repaired.",
+			})
+			return
+		}
+
+		TrackedServerError(err, s).AbortWithServerError(c)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"files": files})
+}
+
+// Returns the files that are currently being pulled into the server directory.
+func getServerFilePulls(c *gin.Context) {
+	s := GetServer(c.Param("server"))
+
+	c.JSON(http.StatusOK, gin.H{"data": s.FilePulls()})
+}
+
+// Downloads a file from a URL directly into the server directory, so that large files do not
+// need to be uploaded through the Panel. The download runs in the background and its progress
+// is sent over the websocket.
+func postServerPullFile(c *gin.Context) {
+	s := GetServer(c.Param("server"))
+
+	var data server.FilePullRequest
+	if err := c.BindJSON(&data); err != nil {
+		return
+	}
+
+	if err := data.Validate(); err != nil {
+		c.AbortWithStatusJSON(http.StatusUnprocessableEntity, gin.H{"error": err.Error()})
+		return
+	}
+
+	p, err := s.PullFile(data)
+	if err != nil {
+		if errors.Is(err, server.ErrTooManyFilePulls) {
+			c.AbortWithStatusJSON(http.StatusTooManyRequests, gin.H{
+				"error": "The maximum number of files are already being pulled for this server.",
+			})
+			return
+		}
+
+		if errors.Is(err, os.ErrExist) {
+			c.AbortWithStatusJSON(http.StatusConflict, gin.H{
+				"error": "A file with that name already exists.",
+			})
+			return
+		}
+
+		TrackedServerError(err, s).AbortFilesystemError(c)
+		return
+	}
+
+	s.RecordActivity(activity.EventFilePull, "", "", map[string]interface{}{"url": data.Url, "directory": data.Directory})
+
+	c.JSON(http.StatusAccepted, p)
+}
+
+// Cancels a file that is being pulled into the server directory.
+func deleteServerFilePull(c *gin.Context) {
+	s := GetServer(c.Param("server"))
+
+	if err := s.CancelFilePull(c.Param("pull")); err != nil {
+		if errors.Is(err, server.ErrFilePullNotFound) {
+			c.AbortWithStatusJSON(http.StatusNotFound, gin.H{
+				"error": "The requested file pull was not found.",
+			})
+			return
+		}
+
+		TrackedServerError(err, s).AbortWithServerError(c)
+		return
+	}
+
+	c.Status(http.StatusNoContent)
+}
@@ -0,0 +1,92 @@
+package router
+
+import (
+	"github.com/gin-gonic/gin"
+	"github.com/avatag-host/claws/environment"
+	"github.com/avatag-host/claws/server"
+	"github.com/avatag-host/claws/server/backup"
+	"net/http"
+)
+
+// Returns whether the files of a server are hibernated, and where they are stored if so.
+func getServerHibernation(c *gin.Context) {
+	s := GetServer(c.Param("server"))
+
+	c.JSON(http.StatusOK, gin.H{
+		"hibernated":  s.IsHibernated(),
+		"in_progress": s.IsHibernating(),
+		"hibernation": s.Hibernation(),
+	})
+}
+
+// Hibernates the files of a stopped server, compressing them into an archive and removing
+// the server directory. This happens in the background and the Panel is notified once it
+// has completed.
+func postServerHibernation(c *gin.Context) {
+	s := GetServer(c.Param("server"))
+
+	var data struct {
+		Adapter string `json:"adapter"`
+	}
+	// BindJSON sends 400 if the request fails, all we need to do is return
+	if err := c.BindJSON(&data); err != nil {
+		return
+	}
+
+	if data.Adapter != backup.LocalBackupAdapter && data.Adapter != backup.S3BackupAdapter {
+		c.AbortWithStatusJSON(http.StatusUnprocessableEntity, gin.H{
+			"error": "The adapter provided was not valid, should be one of \"" + backup.LocalBackupAdapter + "\" or \"" + backup.S3BackupAdapter + "\".",
+		})
+		return
+	}
+
+	if s.IsHibernated() || s.IsHibernating() {
+		c.AbortWithStatusJSON(http.StatusConflict, gin.H{
+			"error": "The files for this server are already hibernated or being hibernated.",
+		})
+		return
+	}
+
+	if s.GetState() != environment.ProcessOfflineState || s.ExecutingPowerAction() || s.IsInstalling() {
+		c.AbortWithStatusJSON(http.StatusConflict, gin.H{
+			"error": "Cannot hibernate a server while it is running or installing.",
+		})
+		return
+	}
+
+	go func(s *server.Server) {
+		if err := s.Hibernate(data.Adapter); err != nil {
+			s.Log().WithField("error", err).Error("failed to hibernate server files")
+		}
+	}(s)
+
+	c.Status(http.StatusAccepted)
+}
+
+// Restores the files of a hibernated server so that it can be started again. This happens in
+// the background and the Panel is notified once it has completed.
+func deleteServerHibernation(c *gin.Context) {
+	s := GetServer(c.Param("server"))
+
+	if s.IsHibernating() {
+		c.AbortWithStatusJSON(http.StatusConflict, gin.H{
+			"error": "The files for this server are currently being hibernated or restored.",
+		})
+		return
+	}
+
+	if !s.IsHibernated() {
+		c.AbortWithStatusJSON(http.StatusNotFound, gin.H{
+			"error": "The files for this server are not hibernated.",
+		})
+		return
+	}
+
+	go func(s *server.Server) {
+		if err := s.Rehydrate(); err != nil {
+			s.Log().WithField("error", err).Error("failed to restore hibernated server files")
+		}
+	}(s)
+
+	c.Status(http.StatusAccepted)
+}
@@ -0,0 +1,101 @@
+package router
+
+import (
+	"github.com/apex/log"
+	"github.com/avatag-host/claws/config"
+	"github.com/avatag-host/claws/server"
+	"github.com/gin-gonic/gin"
+	"net/http"
+)
+
+// Returns the mounts that are used for a server when it is started, along with the status of
+// each of the custom mounts configured for it.
+func getServerMounts(c *gin.Context) {
+	s := GetServer(c.Param("server"))
+
+	c.JSON(http.StatusOK, gin.H{
+		"mounts":     s.Mounts(),
+		"configured": s.MountStatuses(s.Config().Mounts),
+	})
+}
+
+// Validates a set of custom mounts against the configuration of the node without applying
+// them to the server.
+func postServerMountsValidate(c *gin.Context) {
+	s := GetServer(c.Param("server"))
+
+	var data struct {
+		Mounts []server.Mount `json:"mounts"`
+	}
+
+	if err := c.BindJSON(&data); err != nil {
+		return
+	}
+
+	statuses := s.MountStatuses(data.Mounts)
+
+	c.JSON(http.StatusOK, gin.H{
+		"valid":  allMountsAllowed(statuses),
+		"mounts": statuses,
+	})
+}
+
+// Replaces the custom mounts for a server. The container for the server is recreated with the
+// new mounts the next time it starts, so a running server must be restarted for the changes
+// to apply, which is performed automatically if requested. The mounts are only applied if all
+// of them are allowed.
+func putServerMounts(c *gin.Context) {
+	s := GetServer(c.Param("server"))
+
+	var data struct {
+		Mounts  []server.Mount `json:"mounts"`
+		Restart bool           `json:"restart"`
+	}
+
+	if err := c.BindJSON(&data); err != nil {
+		return
+	}
+
+	statuses := s.MountStatuses(data.Mounts)
+	if !allMountsAllowed(statuses) {
+		c.AbortWithStatusJSON(http.StatusUnprocessableEntity, gin.H{
+			"error":  "One or more of the mounts provided are not allowed on this node.",
+			"mounts": statuses,
+		})
+		return
+	}
+
+	s.Config().SetMounts(data.Mounts)
+	s.SyncWithEnvironment()
+
+	running, err := s.Environment.IsRunning()
+	if err != nil {
+		TrackedServerError(err, s).AbortWithServerError(c)
+		return
+	}
+
+	if running && data.Restart {
+		go func(s *server.Server) {
+			if err := s.HandlePowerAction(server.PowerActionRestart, config.Get().System.PowerActionTimeout); err != nil {
+				s.Log().WithField("error", err).Error("failed to restart server to apply mount changes")
+			}
+		}(s)
+	}
+
+	s.Log().WithFields(log.Fields{"mounts": len(data.Mounts), "restart": running && data.Restart}).Info("updated server mounts")
+
+	c.JSON(http.StatusOK, gin.H{
+		"mounts":           s.Mounts(),
+		"restart_required": running && !data.Restart,
+	})
+}
+
+func allMountsAllowed(statuses []server.MountStatus) bool {
+	for _, m := range statuses {
+		if !m.Allowed {
+			return false
+		}
+	}
+
+	return true
+}
@@ -0,0 +1,87 @@
+package router
+
+import (
+	"github.com/avatag-host/claws/server"
+	"github.com/gin-gonic/gin"
+	"github.com/pkg/errors"
+	"net/http"
+	"os"
+)
+
+// Returns the state of the current or last console recording for a server.
+func getServerConsoleRecording(c *gin.Context) {
+	s := GetServer(c.Param("server"))
+
+	c.JSON(http.StatusOK, gin.H{"data": s.ConsoleRecording()})
+}
+
+// Starts recording the console of a server. If a file is provided the console is recorded to
+// that file in the server directory, otherwise the recording can be downloaded once stopped.
+func postServerConsoleRecording(c *gin.Context) {
+	s := GetServer(c.Param("server"))
+
+	var data struct {
+		File string `json:"file"`
+	}
+	// BindJSON sends 400 if the request fails, all we need to do is return
+	if err := c.BindJSON(&data); err != nil {
+		return
+	}
+
+	r, err := s.StartConsoleRecording(data.File)
+	if err != nil {
+		if errors.Is(err, server.ErrConsoleRecordingInProgress) {
+			c.AbortWithStatusJSON(http.StatusConflict, gin.H{
+				"error": "The console for this server is already being recorded.",
+			})
+			return
+		}
+
+		TrackedServerError(err, s).AbortFilesystemError(c)
+		return
+	}
+
+	c.JSON(http.StatusOK, r)
+}
+
+// Stops recording the console of a server.
+func deleteServerConsoleRecording(c *gin.Context) {
+	s := GetServer(c.Param("server"))
+
+	r, err := s.StopConsoleRecording()
+	if err != nil {
+		if errors.Is(err, server.ErrConsoleRecordingNotInProgress) {
+			c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{
+				"error": "The console for this server is not being recorded.",
+			})
+			return
+		}
+
+		TrackedServerError(err, s).AbortWithServerError(c)
+		return
+	}
+
+	c.JSON(http.StatusOK, r)
+}
+
+// Downloads the last console recording for a server that was not written to the server
+// directory.
+func getServerConsoleRecordingDownload(c *gin.Context) {
+	s := GetServer(c.Param("server"))
+
+	f, r, err := s.OpenConsoleRecording()
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			c.AbortWithStatusJSON(http.StatusNotFound, gin.H{
+				"error": "There is no finished console recording to download for this server.",
+			})
+			return
+		}
+
+		TrackedServerError(err, s).AbortWithServerError(c)
+		return
+	}
+	defer f.Close()
+
+	serveAttachment(c, f, "console-"+r.StartedAt.Format("20060102-150405")+".log", *r.StoppedAt)
+}
@@ -0,0 +1,108 @@
+package router
+
+import (
+	"github.com/gin-gonic/gin"
+	"github.com/pkg/errors"
+	"github.com/avatag-host/claws/server"
+	"github.com/avatag-host/claws/server/snapshot"
+	"net/http"
+	"os"
+)
+
+// Returns all of the snapshots that exist for a server.
+func getServerSnapshots(c *gin.Context) {
+	s := GetServer(c.Param("server"))
+
+	snaps, err := snapshot.List(s.Id())
+	if err != nil {
+		TrackedServerError(err, s).AbortWithServerError(c)
+		return
+	}
+
+	c.JSON(http.StatusOK, snaps)
+}
+
+// Creates a new snapshot of a server's files.
+func postServerSnapshot(c *gin.Context) {
+	s := GetServer(c.Param("server"))
+
+	var data struct {
+		Name string `json:"name"`
+	}
+
+	// An empty body is perfectly acceptable here, the name is purely informational.
+	if c.Request.ContentLength != 0 {
+		if err := c.BindJSON(&data); err != nil {
+			return
+		}
+	}
+
+	snap, err := s.CreateSnapshot(data.Name)
+	if err != nil {
+		TrackedServerError(err, s).AbortWithServerError(c)
+		return
+	}
+
+	c.JSON(http.StatusOK, snap)
+}
+
+// Rolls a server back to a given snapshot. The server must be stopped before this
+// can be performed.
+func postServerSnapshotRollback(c *gin.Context) {
+	s := GetServer(c.Param("server"))
+
+	snap, ok := locateServerSnapshot(c, s)
+	if !ok {
+		return
+	}
+
+	if err := s.RollbackSnapshot(snap); err != nil {
+		if errors.Is(err, server.ErrIsRunning) {
+			c.AbortWithStatusJSON(http.StatusConflict, gin.H{
+				"error": "Cannot roll back a server to a snapshot while it is running.",
+			})
+			return
+		}
+
+		TrackedServerError(err, s).AbortWithServerError(c)
+		return
+	}
+
+	c.JSON(http.StatusOK, snap)
+}
+
+// Deletes a snapshot for a server.
+func deleteServerSnapshot(c *gin.Context) {
+	s := GetServer(c.Param("server"))
+
+	snap, ok := locateServerSnapshot(c, s)
+	if !ok {
+		return
+	}
+
+	if err := snap.Remove(); err != nil {
+		TrackedServerError(err, s).AbortWithServerError(c)
+		return
+	}
+
+	c.Status(http.StatusNoContent)
+}
+
+// Locates the snapshot defined in the request for the server, aborting the request with a
+// 404 error if it cannot be found.
+func locateServerSnapshot(c *gin.Context, s *server.Server) (*snapshot.Snapshot, bool) {
+	snap, err := snapshot.Locate(s.Id(), c.Param("snapshot"))
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) || errors.Is(err, snapshot.ErrInvalidIdentifier) {
+			c.AbortWithStatusJSON(http.StatusNotFound, gin.H{
+				"error": "The requested snapshot was not found on this server.",
+			})
+			return nil, false
+		}
+
+		TrackedServerError(err, s).AbortWithServerError(c)
+		return nil, false
+	}
+
+	return snap, true
+}
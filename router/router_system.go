@@ -2,9 +2,12 @@ package router
 
 import (
 	"bytes"
+	"encoding/json"
 	"github.com/apex/log"
+	"github.com/buger/jsonparser"
 	"github.com/gin-gonic/gin"
 	"github.com/avatag-host/claws/config"
+	"github.com/avatag-host/claws/router/bans"
 	"github.com/avatag-host/claws/installer"
 	"github.com/avatag-host/claws/server"
 	"github.com/avatag-host/claws/system"
@@ -24,10 +27,115 @@ func getSystemInformation(c *gin.Context) {
 	c.JSON(http.StatusOK, i)
 }
 
+// Reloads the configuration file and TLS certificates from the disk, returning the changed
+// keys that were applied and those that require Wings to be restarted.
+func postSystemReload(c *gin.Context) {
+	res, err := server.ReloadConfiguration()
+	if err != nil {
+		TrackedError(err).AbortWithServerError(c)
+		return
+	}
+	system.ReloadCertificates()
+
+	c.JSON(http.StatusOK, res)
+}
+
+// Returns the health of the node, including whether or not it is in maintenance mode. This
+// does not require authentication and so only returns the state of the node itself.
+func getHealth(c *gin.Context) {
+	m := server.Maintenance()
+
+	status := "ok"
+	if m.Enabled {
+		status = "maintenance"
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"status":      status,
+		"maintenance": m.Enabled,
+		"version":     system.Version,
+	})
+}
+
+// Returns the maintenance mode state of the node.
+func getSystemMaintenance(c *gin.Context) {
+	c.JSON(http.StatusOK, server.Maintenance())
+}
+
+// Enables or disables maintenance mode for the node. While enabled servers cannot be started
+// or transferred to the node, but can still be stopped.
+func postSystemMaintenance(c *gin.Context) {
+	var data struct {
+		Enabled bool   `json:"enabled"`
+		Reason  string `json:"reason"`
+	}
+
+	if err := c.BindJSON(&data); err != nil {
+		return
+	}
+
+	m, err := server.SetMaintenance(data.Enabled, data.Reason)
+	if err != nil {
+		TrackedError(err).AbortWithServerError(c)
+		return
+	}
+
+	c.JSON(http.StatusOK, m)
+}
+
+// Returns all of the IP addresses that are currently banned from the API.
+func getSystemBans(c *gin.Context) {
+	c.JSON(http.StatusOK, bans.All())
+}
+
+// Removes all of the current IP address bans.
+func deleteSystemBans(c *gin.Context) {
+	bans.Clear()
+
+	c.Status(http.StatusNoContent)
+}
+
+// Removes the ban for a single IP address.
+func deleteSystemBan(c *gin.Context) {
+	if !bans.Remove(c.Param("ip")) {
+		c.AbortWithStatusJSON(http.StatusNotFound, gin.H{
+			"error": "The requested IP address is not currently banned.",
+		})
+		return
+	}
+
+	c.Status(http.StatusNoContent)
+}
+
 // Returns all of the servers that are registered and configured correctly on
-// this wings instance.
+// this wings instance. Passing "summary=true" returns a summary of each server
+// instead, which is used by the local server commands.
 func getAllServers(c *gin.Context) {
-	c.JSON(http.StatusOK, server.GetServers().All())
+	panel, restricted := c.Get("panel")
+
+	if c.Query("summary") != "true" {
+		c.JSON(http.StatusOK, server.GetServers().Filter(func(s *server.Server) bool {
+			return !restricted || s.Panel() == panel
+		}))
+		return
+	}
+
+	out := []serverListItem{}
+	for _, s := range server.GetServers().All() {
+		if restricted && s.Panel() != panel {
+			continue
+		}
+
+		out = append(out, serverListItem{
+			Uuid:      s.Id(),
+			Panel:     s.Panel(),
+			Suspended: s.IsSuspended(),
+			Addresses: s.Config().Allocations.Addresses(),
+			Resources: s.Proc(),
+		})
+	}
+
+	c.JSON(http.StatusOK, out)
 }
 
 // Creates a new server on the wings daemon and begins the installation process
@@ -36,7 +144,32 @@ func postCreateServer(c *gin.Context) {
 	buf := bytes.Buffer{}
 	buf.ReadFrom(c.Request.Body)
 
-	install, err := installer.New(buf.Bytes())
+	// Another Panel connected to this node could otherwise create a server using the UUID of an
+	// existing server, taking over its files and container.
+	if uuid, _ := jsonparser.GetString(buf.Bytes(), "uuid"); uuid != "" && GetServer(uuid) != nil {
+		c.AbortWithStatusJSON(http.StatusConflict, gin.H{
+			"error": "A server with that UUID already exists on this node.",
+		})
+		return
+	}
+
+	var src *server.ImportSource
+	if b, t, _, err := jsonparser.Get(buf.Bytes(), "import"); err == nil && t != jsonparser.Null {
+		src = &server.ImportSource{}
+		if err := json.Unmarshal(b, src); err != nil {
+			c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{
+				"error": "The import source provided in the request could not be parsed.",
+			})
+			return
+		}
+
+		if err := src.Validate(); err != nil {
+			c.AbortWithStatusJSON(http.StatusUnprocessableEntity, gin.H{"error": err.Error()})
+			return
+		}
+	}
+
+	install, err := installer.New(buf.Bytes(), c.GetString("panel"))
 	if err != nil {
 		if installer.IsValidationError(err) {
 			c.AbortWithStatusJSON(http.StatusUnprocessableEntity, gin.H{
@@ -63,6 +196,15 @@ func postCreateServer(c *gin.Context) {
 			return
 		}
 
+		// Servers being migrated from another host are seeded from an archive of their files
+		// rather than running the installation script.
+		if src != nil {
+			if err := i.Server().Import(*src); err != nil {
+				log.WithFields(log.Fields{"server": i.Uuid(), "error": err}).Error("failed to import files for server")
+			}
+			return
+		}
+
 		if err := i.Server().Install(false); err != nil {
 			log.WithFields(log.Fields{"server": i.Uuid(), "error": err}).Error("failed to run install process for server")
 		}
@@ -0,0 +1,141 @@
+package router
+
+import (
+	"github.com/gin-gonic/gin"
+	"github.com/avatag-host/claws/config"
+	"github.com/avatag-host/claws/system"
+	"net/http"
+	"net/http/pprof"
+	"runtime"
+	rpprof "runtime/pprof"
+	"sync/atomic"
+	"time"
+)
+
+// Set when the debug endpoints have been enabled at runtime, rather than in the configuration.
+var _debugEndpoints int32
+
+var _startedAt = time.Now()
+
+// Enables or disables the debug endpoints without changing the configuration. This does not
+// persist across restarts of Wings.
+func SetDebugEndpointsEnabled(enabled bool) {
+	var v int32
+	if enabled {
+		v = 1
+	}
+
+	atomic.StoreInt32(&_debugEndpoints, v)
+}
+
+func debugEndpointsEnabled() bool {
+	return config.Get().Api.DebugEndpoints || atomic.LoadInt32(&_debugEndpoints) == 1
+}
+
+// Only allows the request if the debug endpoints are enabled, otherwise responds as if the
+// route does not exist.
+func RequireDebugEndpoints(c *gin.Context) {
+	if !debugEndpointsEnabled() {
+		c.AbortWithStatusJSON(http.StatusNotFound, gin.H{
+			"error": "The debug endpoints are not enabled on this instance.",
+		})
+		return
+	}
+
+	c.Next()
+}
+
+// Returns whether or not the debug endpoints are currently enabled.
+func getSystemDebug(c *gin.Context) {
+	c.JSON(http.StatusOK, gin.H{"enabled": debugEndpointsEnabled()})
+}
+
+// Enables or disables the debug endpoints at runtime. Endpoints enabled in the configuration
+// cannot be disabled this way.
+func postSystemDebug(c *gin.Context) {
+	var data struct {
+		Enabled bool `json:"enabled"`
+	}
+
+	if err := c.BindJSON(&data); err != nil {
+		return
+	}
+
+	SetDebugEndpointsEnabled(data.Enabled)
+
+	c.JSON(http.StatusOK, gin.H{"enabled": debugEndpointsEnabled()})
+}
+
+// Returns statistics about the Go runtime, such as the number of running goroutines and the
+// heap usage, for diagnosing leaks on a running instance.
+func getSystemDebugRuntime(c *gin.Context) {
+	var m runtime.MemStats
+	runtime.ReadMemStats(&m)
+
+	var lastGc *time.Time
+	if m.LastGC > 0 {
+		t := time.Unix(0, int64(m.LastGC))
+		lastGc = &t
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"version":    system.Version,
+		"go_version": runtime.Version(),
+		"uptime":     int64(time.Since(_startedAt).Seconds()),
+		"goroutines": runtime.NumGoroutine(),
+		"cpus":       runtime.NumCPU(),
+		"gomaxprocs": runtime.GOMAXPROCS(0),
+		"heap": gin.H{
+			"alloc_bytes":    m.HeapAlloc,
+			"sys_bytes":      m.HeapSys,
+			"idle_bytes":     m.HeapIdle,
+			"inuse_bytes":    m.HeapInuse,
+			"released_bytes": m.HeapReleased,
+			"objects":        m.HeapObjects,
+		},
+		"gc": gin.H{
+			"count":          m.NumGC,
+			"forced_count":   m.NumForcedGC,
+			"pause_total_ns": m.PauseTotalNs,
+			"last_run":       lastGc,
+			"next_bytes":     m.NextGC,
+			"cpu_fraction":   m.GCCPUFraction,
+		},
+		"sys_bytes": m.Sys,
+	})
+}
+
+// Returns the names of the profiles that are available.
+func getSystemDebugProfiles(c *gin.Context) {
+	profiles := []string{"cmdline", "profile", "symbol", "trace"}
+	for _, p := range rpprof.Profiles() {
+		profiles = append(profiles, p.Name())
+	}
+
+	c.JSON(http.StatusOK, gin.H{"profiles": profiles})
+}
+
+// Serves a profile in the format expected by "go tool pprof". This accepts the same query
+// parameters as the standard net/http/pprof handlers, such as "seconds" for CPU profiles and
+// traces, and "debug" to return a human readable profile.
+func getSystemDebugProfile(c *gin.Context) {
+	switch name := c.Param("profile"); name {
+	case "cmdline":
+		pprof.Cmdline(c.Writer, c.Request)
+	case "profile":
+		pprof.Profile(c.Writer, c.Request)
+	case "symbol":
+		pprof.Symbol(c.Writer, c.Request)
+	case "trace":
+		pprof.Trace(c.Writer, c.Request)
+	default:
+		if rpprof.Lookup(name) == nil {
+			c.AbortWithStatusJSON(http.StatusNotFound, gin.H{
+				"error": "The requested profile does not exist.",
+			})
+			return
+		}
+
+		pprof.Handler(name).ServeHTTP(c.Writer, c.Request)
+	}
+}
@@ -1,7 +1,6 @@
 package router
 
 import (
-	"bufio"
 	"bytes"
 	"crypto/sha256"
 	"encoding/hex"
@@ -20,7 +19,6 @@ import (
 	"net/http"
 	"os"
 	"path/filepath"
-	"strconv"
 	"strings"
 )
 
@@ -36,12 +34,13 @@ func getServerArchive(c *gin.Context) {
 	}
 
 	token := tokens.TransferPayload{}
-	if err := tokens.ParseToken([]byte(auth[1]), &token); err != nil {
+	panel, err := tokens.ParseToken([]byte(auth[1]), &token)
+	if err != nil {
 		TrackedError(err).AbortWithServerError(c)
 		return
 	}
 
-	if token.Subject != c.Param("server") {
+	if token.Subject != c.Param("server") || GetServer(c.Param("server")).Panel() != panel {
 		c.AbortWithStatusJSON(http.StatusForbidden, gin.H{
 			"error": "( .. •˘___˘• .. )",
 		})
@@ -83,11 +82,8 @@ func getServerArchive(c *gin.Context) {
 
 	c.Header("X-Checksum", checksum)
 	c.Header("X-Mime-Type", st.Mimetype)
-	c.Header("Content-Length", strconv.Itoa(int(st.Info.Size())))
-	c.Header("Content-Disposition", "attachment; filename="+s.Archiver.Name())
-	c.Header("Content-Type", "application/octet-stream")
 
-	bufio.NewReader(file).WriteTo(c.Writer)
+	serveAttachment(c, file, s.Archiver.Name(), st.Info.ModTime())
 }
 
 func postServerArchive(c *gin.Context) {
@@ -101,7 +97,7 @@ func postServerArchive(c *gin.Context) {
 
 		s.Log().Debug("successfully created server archive, notifying panel")
 
-		r := api.New()
+		r := api.NewForPanel(s.Panel())
 		err := r.SendArchiveStatus(s.Id(), true)
 		if err != nil {
 			if !api.IsRequestError(err) {
@@ -121,9 +117,30 @@ func postServerArchive(c *gin.Context) {
 }
 
 func postTransfer(c *gin.Context) {
+	// Servers can still be archived and transferred away from a node in maintenance mode so
+	// that it can be drained, but they cannot be transferred to it.
+	if server.IsMaintenanceMode() {
+		c.AbortWithStatusJSON(http.StatusServiceUnavailable, gin.H{
+			"error": "Cannot transfer a server to this node while it is in maintenance mode.",
+		})
+		return
+	}
+
 	buf := bytes.Buffer{}
 	buf.ReadFrom(c.Request.Body)
 
+	// The server being transferred belongs to the Panel that requested the transfer.
+	panel := c.GetString("panel")
+
+	// A server that already exists on this node cannot be transferred to it, since the transfer
+	// would replace its files.
+	if id, _ := jsonparser.GetString(buf.Bytes(), "server_id"); GetServer(id) != nil {
+		c.AbortWithStatusJSON(http.StatusConflict, gin.H{
+			"error": "A server with that UUID already exists on this node.",
+		})
+		return
+	}
+
 	go func(data []byte) {
 		serverID, _ := jsonparser.GetString(data, "server_id")
 		url, _ := jsonparser.GetString(data, "url")
@@ -140,7 +157,7 @@ func postTransfer(c *gin.Context) {
 			}
 
 			l.Info("server transfer failed, notifying panel")
-			err := api.New().SendTransferFailure(serverID)
+			err := api.NewForPanel(panel).SendTransferFailure(serverID)
 			if err != nil {
 				if !api.IsRequestError(err) {
 					l.WithField("error", err).Error("failed to notify panel with transfer failure")
@@ -267,7 +284,7 @@ func postTransfer(c *gin.Context) {
 		}
 
 		// Create a new server installer (note this does not execute the install script)
-		i, err := installer.New(serverData)
+		i, err := installer.New(serverData, panel)
 		if err != nil {
 			l.WithField("error", errors.WithStack(err)).Error("failed to validate received server data")
 			return
@@ -296,7 +313,7 @@ func postTransfer(c *gin.Context) {
 		hasError = false
 
 		// Notify the panel that the transfer succeeded.
-		err = api.New().SendTransferSuccess(serverID)
+		err = api.NewForPanel(panel).SendTransferSuccess(serverID)
 		if err != nil {
 			if !api.IsRequestError(err) {
 				l.WithField("error", errors.WithStack(err)).Error("failed to notify panel of transfer success")
@@ -0,0 +1,70 @@
+package router
+
+import (
+	"context"
+	"github.com/gin-gonic/gin"
+	"io"
+	"net/http"
+	"os"
+	"sync"
+	"time"
+)
+
+type responseWriterKey struct{}
+
+// Buffers used to copy file contents to a response when the response cannot read from the file
+// directly, which is the case for HTTP/2 responses.
+var copyBuffers = sync.Pool{
+	New: func() interface{} {
+		b := make([]byte, 32*1024)
+		return &b
+	},
+}
+
+// Wraps the router so that the response writer created by the HTTP server is available to the
+// route handlers. Gin wraps this writer in its own, which hides the ability of the writer to
+// send the contents of a file using sendfile.
+func ExposeResponseWriter(h http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		h.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), responseWriterKey{}, w)))
+	})
+}
+
+// A response writer that sends files to the client using the response writer created by the
+// HTTP server when it is available, allowing the file to be sent without copying it through
+// Wings. Headers and the status code are still written through Gin so that it knows that the
+// response has been written.
+type fileWriter struct {
+	gin.ResponseWriter
+	raw http.ResponseWriter
+}
+
+// Returns the writer that files should be written to for the request.
+func fileResponseWriter(c *gin.Context) *fileWriter {
+	raw, _ := c.Request.Context().Value(responseWriterKey{}).(http.ResponseWriter)
+
+	return &fileWriter{ResponseWriter: c.Writer, raw: raw}
+}
+
+func (w *fileWriter) ReadFrom(r io.Reader) (int64, error) {
+	w.ResponseWriter.WriteHeaderNow()
+
+	if rf, ok := w.raw.(io.ReaderFrom); ok {
+		return rf.ReadFrom(r)
+	}
+
+	buf := copyBuffers.Get().(*[]byte)
+	defer copyBuffers.Put(buf)
+
+	// The writer is wrapped so that io.CopyBuffer does not call back into this function.
+	return io.CopyBuffer(struct{ io.Writer }{w.ResponseWriter}, r, *buf)
+}
+
+// Sends the file to the client as an attachment. Range requests are supported, so that
+// downloads can be resumed.
+func serveAttachment(c *gin.Context, f *os.File, name string, modified time.Time) {
+	c.Header("Content-Disposition", "attachment; filename="+name)
+	c.Header("Content-Type", "application/octet-stream")
+
+	http.ServeContent(fileResponseWriter(c), c.Request, name, modified, f)
+}
@@ -10,18 +10,25 @@ type TokenData interface {
 	GetPayload() *jwt.Payload
 }
 
-// Validates the provided JWT against the known secret for the Daemon and returns the
-// parsed data. This function DOES NOT validate that the token is valid for the connected
-// server, nor does it ensure that the user providing the token is able to actually do things.
+// Validates the provided JWT against the known secret for each Panel and returns the name
+// of the Panel that signed it, after parsing the data. This function DOES NOT validate that
+// the token is valid for the connected server, nor does it ensure that the user providing the
+// token is able to actually do things.
 //
 // This simply returns a parsed token.
-func ParseToken(token []byte, data TokenData) error {
+func ParseToken(token []byte, data TokenData) (string, error) {
 	verifyOptions := jwt.ValidatePayload(
 		data.GetPayload(),
 		jwt.ExpirationTimeValidator(time.Now()),
 	)
 
-	_, err := jwt.Verify(token, config.GetJwtAlgorithm(), &data, verifyOptions)
+	var err error
+	for _, a := range config.GetPanelJwtAlgorithms() {
+		// Keep trying the other Panels only if the token was not signed by this one.
+		if _, err = jwt.Verify(token, a.Algorithm, &data, verifyOptions); err != jwt.ErrHMACVerification {
+			return a.Panel, err
+		}
+	}
 
-	return err
+	return "", err
 }
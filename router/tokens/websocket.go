@@ -14,6 +14,9 @@ type WebsocketPayload struct {
 	UserID      json.Number `json:"user_id"`
 	ServerUUID  string      `json:"server_uuid"`
 	Permissions []string    `json:"permissions"`
+
+	// The name of the Panel that signed the token.
+	Panel string `json:"-"`
 }
 
 // Returns the JWT payload.
@@ -31,6 +34,14 @@ func (p *WebsocketPayload) GetServerUuid() string {
 	return p.ServerUUID
 }
 
+// Returns the name of the Panel that signed the token.
+func (p *WebsocketPayload) GetPanel() string {
+	p.RLock()
+	defer p.RUnlock()
+
+	return p.Panel
+}
+
 // Checks if the given token payload has a permission string.
 func (p *WebsocketPayload) HasPermission(permission string) bool {
 	p.RLock()
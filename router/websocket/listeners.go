@@ -4,6 +4,7 @@ import (
 	"context"
 	"github.com/avatag-host/claws/events"
 	"github.com/avatag-host/claws/server"
+	"github.com/avatag-host/claws/server/ansi"
 	"time"
 )
 
@@ -45,6 +46,13 @@ var e = []string{
 	server.InstallCompletedEvent,
 	server.DaemonMessageEvent,
 	server.BackupCompletedEvent,
+	server.OutOfMemoryEvent,
+	server.CrashReasonEvent,
+	server.ReservationBreachedEvent,
+	server.PowerActionStuckEvent,
+	server.PermissionsRepairEvent,
+	server.ImportEvent,
+	server.FilePullEvent,
 }
 
 // Listens for different events happening on a server and sends them along
@@ -52,7 +60,12 @@ var e = []string{
 func (h *Handler) ListenForServerEvents(ctx context.Context) {
 	h.server.Log().Debug("listening for server events over websocket")
 	callback := func(e events.Event) {
-		if err := h.SendJson(&Message{Event: e.Topic, Args: []string{e.Data}}); err != nil {
+		data := e.Data
+		if e.Topic == server.ConsoleOutputEvent {
+			data = ansi.Convert(h.ansi, data)
+		}
+
+		if err := h.SendJson(&Message{Event: e.Topic, Args: []string{data}, Sequence: e.Sequence}); err != nil {
 			h.server.Log().WithField("error", err).Warn("error while sending server data over websocket")
 		}
 	}
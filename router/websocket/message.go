@@ -7,8 +7,10 @@ const (
 	AuthenticationEvent        = "auth"
 	SetStateEvent              = "set state"
 	SendServerLogsEvent        = "send logs"
+	SendInstallLogsEvent       = "send install logs"
 	SendCommandEvent           = "send command"
 	SendStatsEvent             = "send stats"
+	SendEventsEvent            = "send events"
 	ErrorEvent                 = "daemon error"
 	JwtErrorEvent              = "jwt error"
 )
@@ -20,4 +22,8 @@ type Message struct {
 	// The data to pass along, only used by power/command currently. Other requests
 	// should either omit the field or pass an empty value as it is ignored.
 	Args []string `json:"args,omitempty"`
+
+	// The sequence number of a server event that has been recorded in the event journal. The
+	// events after a given sequence number can be requested using the "send events" event.
+	Sequence uint64 `json:"sequence,omitempty"`
 }
@@ -14,8 +14,12 @@ import (
 	"github.com/avatag-host/claws/environment/docker"
 	"github.com/avatag-host/claws/router/tokens"
 	"github.com/avatag-host/claws/server"
+	"github.com/avatag-host/claws/server/activity"
+	"github.com/avatag-host/claws/server/ansi"
 	"github.com/avatag-host/claws/server/filesystem"
+	"net"
 	"net/http"
+	"strconv"
 	"strings"
 	"sync"
 	"time"
@@ -39,6 +43,10 @@ type Handler struct {
 	jwt        *tokens.WebsocketPayload `json:"-"`
 	server     *server.Server
 	uuid       uuid.UUID
+	ip         string
+
+	// How ANSI escape sequences in the console output are handled for this connection.
+	ansi string
 }
 
 var (
@@ -57,10 +65,11 @@ func IsJwtError(err error) bool {
 // Parses a JWT into a websocket token payload.
 func NewTokenPayload(token []byte) (*tokens.WebsocketPayload, error) {
 	payload := tokens.WebsocketPayload{}
-	err := tokens.ParseToken(token, &payload)
+	panel, err := tokens.ParseToken(token, &payload)
 	if err != nil {
 		return nil, err
 	}
+	payload.Panel = panel
 
 	if !payload.HasPermission(PermissionConnect) {
 		return nil, errors.New("not authorized to connect to this socket")
@@ -76,7 +85,7 @@ func GetHandler(s *server.Server, w http.ResponseWriter, r *http.Request) (*Hand
 		// and not some other location.
 		CheckOrigin: func(r *http.Request) bool {
 			o := r.Header.Get("Origin")
-			if o == config.Get().PanelLocation {
+			if config.Get().IsPanelLocation(o) {
 				return true
 			}
 
@@ -111,9 +120,42 @@ func GetHandler(s *server.Server, w http.ResponseWriter, r *http.Request) (*Hand
 		jwt:        nil,
 		server:     s,
 		uuid:       u,
+		ip:         remoteIp(r),
+		ansi:       connectionAnsi(s, r),
 	}, nil
 }
 
+// Returns the IP address that the websocket connection was made from.
+func remoteIp(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+
+	return host
+}
+
+// Returns how ANSI escape sequences in the console output are handled for the connection, which
+// can be set using the "ansi" query parameter and otherwise uses the setting for the server.
+func connectionAnsi(s *server.Server, r *http.Request) string {
+	if mode := r.URL.Query().Get("ansi"); ansi.IsValidMode(mode) {
+		return mode
+	}
+
+	return s.ConsoleAnsi()
+}
+
+// Records an action performed by the user of the websocket so that it is reported to the
+// Panel.
+func (h *Handler) recordActivity(event string, metadata map[string]interface{}) {
+	var user string
+	if j := h.GetJwt(); j != nil {
+		user = j.UserID.String()
+	}
+
+	h.server.RecordActivity(event, user, h.ip, metadata)
+}
+
 func (h *Handler) Uuid() uuid.UUID {
 	return h.uuid
 }
@@ -192,7 +234,7 @@ func (h *Handler) TokenValid() error {
 		return ErrJwtNoConnectPerm
 	}
 
-	if h.server.Id() != j.GetServerUuid() {
+	if h.server.Id() != j.GetServerUuid() || h.server.Panel() != j.GetPanel() {
 		return ErrJwtUuidMismatch
 	}
 
@@ -205,7 +247,13 @@ func (h *Handler) TokenValid() error {
 func (h *Handler) SendErrorJson(msg Message, err error, shouldLog ...bool) error {
 	j := h.GetJwt()
 	expected := errors.Is(err, server.ErrSuspended) ||
+		errors.Is(err, server.ErrPaused) ||
+		errors.Is(err, server.ErrHibernated) ||
+		errors.Is(err, server.ErrMaintenanceMode) ||
+		server.IsReservationBreachedError(err) ||
 		errors.Is(err, server.ErrIsRunning) ||
+		errors.Is(err, server.ErrPowerActionCancelled) ||
+		errors.Is(err, server.ErrPowerActionStuck) ||
 		errors.Is(err, filesystem.ErrNotEnoughDiskSpace)
 
 	message := "an unexpected error was encountered while handling this request"
@@ -342,6 +390,10 @@ func (h *Handler) HandleInbound(m Message) error {
 			}
 
 			err := h.server.HandlePowerAction(action)
+			if err == nil {
+				h.recordActivity(action.ActivityEvent(), nil)
+			}
+
 			if errors.Is(err, context.DeadlineExceeded) {
 				m, _ := h.GetErrorMessage("another power action is currently being processed for this server, please try again later")
 
@@ -369,10 +421,53 @@ func (h *Handler) HandleInbound(m Message) error {
 			for _, line := range logs {
 				h.SendJson(&Message{
 					Event: server.ConsoleOutputEvent,
+					Args:  []string{ansi.Convert(h.ansi, line)},
+				})
+			}
+
+			return nil
+		}
+	case SendInstallLogsEvent:
+		{
+			if !h.GetJwt().HasPermission(PermissionReceiveInstall) {
+				return nil
+			}
+
+			logs, err := h.server.ReadInstallLog(500)
+			if err != nil {
+				return err
+			}
+
+			for _, line := range logs {
+				h.SendJson(&Message{
+					Event: server.InstallOutputEvent,
 					Args:  []string{line},
 				})
 			}
 
+			return nil
+		}
+	case SendEventsEvent:
+		{
+			j := h.server.Events().Journal()
+			if j == nil {
+				return nil
+			}
+
+			var since uint64
+			if len(m.Args) > 0 {
+				since, _ = strconv.ParseUint(m.Args[0], 10, 64)
+			}
+
+			records, _, _ := j.Since(since)
+			for _, r := range records {
+				h.SendJson(&Message{
+					Event:    r.Topic,
+					Args:     []string{r.Data},
+					Sequence: r.Sequence,
+				})
+			}
+
 			return nil
 		}
 	case SendStatsEvent:
@@ -407,7 +502,20 @@ func (h *Handler) HandleInbound(m Message) error {
 				}
 			}
 
-			return h.server.Environment.SendCommand(strings.Join(m.Args, ""))
+			// Commands would be written to the console of the paused process and only run once
+			// the suspension is lifted, so they are rejected instead.
+			if h.server.IsPaused() {
+				return server.ErrPaused
+			}
+
+			command := strings.Join(m.Args, "")
+			if err := h.server.Environment.SendCommand(command); err != nil {
+				return err
+			}
+
+			h.recordActivity(activity.EventConsoleCommand, map[string]interface{}{"command": command})
+
+			return nil
 		}
 	}
 
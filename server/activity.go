@@ -0,0 +1,52 @@
+package server
+
+import (
+	"github.com/avatag-host/claws/api"
+	"github.com/avatag-host/claws/config"
+	"github.com/avatag-host/claws/server/activity"
+	"time"
+)
+
+var activityReporter *activity.Reporter
+
+// Starts reporting the activity on servers to the Panel, if enabled.
+func ConfigureActivity() {
+	cfg := config.Get().System.Activity
+	if !cfg.Enabled {
+		return
+	}
+
+	activityReporter = activity.New(cfg)
+	go activityReporter.Run()
+}
+
+// Returns the activity event that is recorded when the power action is performed.
+func (pa PowerAction) ActivityEvent() string {
+	switch pa {
+	case PowerActionStart:
+		return activity.EventPowerStart
+	case PowerActionStop:
+		return activity.EventPowerStop
+	case PowerActionRestart:
+		return activity.EventPowerRestart
+	default:
+		return activity.EventPowerKill
+	}
+}
+
+// Records an action performed on the server so that it is reported to the Panel. The user and
+// IP address should be empty when the action was requested by the Panel itself.
+func (s *Server) RecordActivity(event string, user string, ip string, metadata map[string]interface{}) {
+	if activityReporter == nil {
+		return
+	}
+
+	activityReporter.Push(s.Panel(), api.ActivityRecord{
+		Server:    s.Id(),
+		Event:     event,
+		User:      user,
+		Ip:        ip,
+		Metadata:  metadata,
+		Timestamp: time.Now().UTC(),
+	})
+}
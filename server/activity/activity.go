@@ -0,0 +1,174 @@
+package activity
+
+import (
+	"encoding/json"
+	"github.com/apex/log"
+	"github.com/avatag-host/claws/api"
+	"github.com/avatag-host/claws/config"
+	"github.com/pkg/errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+// The events that are reported to the Panel.
+const (
+	EventPowerStart     = "server:power.start"
+	EventPowerStop      = "server:power.stop"
+	EventPowerRestart   = "server:power.restart"
+	EventPowerKill      = "server:power.kill"
+	EventConsoleCommand = "server:console.command"
+	EventSftpLogin      = "server:sftp.login"
+
+	EventFileWrite           = "server:file.write"
+	EventFileUpload          = "server:file.upload"
+	EventFileRename          = "server:file.rename"
+	EventFileCopy            = "server:file.copy"
+	EventFileDelete          = "server:file.delete"
+	EventFileCreateDirectory = "server:file.create-directory"
+	EventFileCompress        = "server:file.compress"
+	EventFileDecompress      = "server:file.decompress"
+	EventFilePull            = "server:file.pull"
+)
+
+// An activity record along with the name of the Panel that it is sent to.
+type entry struct {
+	Panel  string             `json:"panel"`
+	Record api.ActivityRecord `json:"record"`
+}
+
+// Buffers the activity on servers and sends it to the Panel that each server belongs to in
+// batches. Records that cannot be sent are kept, and stored on the disk so that they are not
+// lost if Wings is restarted before the Panel can be reached again.
+type Reporter struct {
+	mu      sync.Mutex
+	cfg     config.ActivityConfiguration
+	path    string
+	pending []entry
+	dropped int
+}
+
+// Returns a new reporter for the given configuration, loading any records that could not be
+// sent before Wings was last stopped.
+func New(cfg config.ActivityConfiguration) *Reporter {
+	r := &Reporter{cfg: cfg, path: filepath.Join(config.Get().System.RootDirectory, "activity.json")}
+
+	if b, err := ioutil.ReadFile(r.path); err == nil {
+		if err := json.Unmarshal(b, &r.pending); err != nil {
+			log.WithField("error", err).Warn("failed to parse unsent server activity from disk")
+		}
+	} else if !os.IsNotExist(err) {
+		log.WithField("error", err).Warn("failed to read unsent server activity from disk")
+	}
+
+	return r
+}
+
+// Adds a record to the buffer to be sent with the next batch. If the buffer is full the record
+// is dropped.
+func (r *Reporter) Push(panel string, rec api.ActivityRecord) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if len(r.pending) >= r.cfg.BufferSize {
+		r.dropped++
+		return
+	}
+
+	r.pending = append(r.pending, entry{Panel: panel, Record: rec})
+}
+
+// Sends the buffered records to the Panel at the configured interval. This function blocks and
+// should be run in its own routine.
+func (r *Reporter) Run() {
+	interval := r.cfg.FlushInterval
+	if interval <= 0 {
+		interval = 10
+	}
+
+	ticker := time.NewTicker(time.Second * time.Duration(interval))
+	defer ticker.Stop()
+
+	for range ticker.C {
+		if err := r.Flush(); err != nil {
+			log.WithField("error", err).Warn("failed to send server activity to the panel, retrying on the next interval")
+		}
+	}
+}
+
+// Sends all of the buffered records to the Panels they belong to. Records for a Panel that could
+// not be sent are kept in the buffer so that they are sent again with the next batch.
+func (r *Reporter) Flush() error {
+	r.mu.Lock()
+	batch := r.pending
+	dropped := r.dropped
+	r.pending = nil
+	r.dropped = 0
+	r.mu.Unlock()
+
+	if dropped > 0 {
+		log.WithField("records", dropped).Warn("dropped server activity because the activity buffer was full")
+	}
+
+	if len(batch) == 0 {
+		return nil
+	}
+
+	panels := make(map[string][]api.ActivityRecord)
+	var order []string
+	for _, e := range batch {
+		if _, ok := panels[e.Panel]; !ok {
+			order = append(order, e.Panel)
+		}
+		panels[e.Panel] = append(panels[e.Panel], e.Record)
+	}
+
+	var failed []entry
+	var err error
+	for _, panel := range order {
+		if serr := api.NewForPanel(panel).SendActivity(panels[panel]); serr != nil {
+			err = serr
+			for _, rec := range panels[panel] {
+				failed = append(failed, entry{Panel: panel, Record: rec})
+			}
+		}
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if len(failed) > 0 {
+		r.pending = append(failed, r.pending...)
+		if over := len(r.pending) - r.cfg.BufferSize; over > 0 {
+			r.pending = r.pending[over:]
+			r.dropped += over
+		}
+	}
+
+	if serr := r.save(); serr != nil {
+		log.WithField("error", serr).Warn("failed to store unsent server activity on disk")
+	}
+
+	return err
+}
+
+// Stores the records that have not been sent on the disk, or removes the stored records if
+// everything has been sent. The caller must hold the lock.
+func (r *Reporter) save() error {
+	if len(r.pending) == 0 {
+		if err := os.Remove(r.path); err != nil && !os.IsNotExist(err) {
+			return errors.WithStack(err)
+		}
+
+		return nil
+	}
+
+	b, err := json.Marshal(r.pending)
+	if err != nil {
+		return errors.WithStack(err)
+	}
+
+	return errors.WithStack(ioutil.WriteFile(r.path, b, 0600))
+}
@@ -0,0 +1,100 @@
+package server
+
+import (
+	"github.com/avatag-host/claws/config"
+	"github.com/avatag-host/claws/environment/docker"
+	"reflect"
+)
+
+// The outcome of syncing the allocations for a server with the Panel.
+type AllocationSync struct {
+	// Set when the allocations for the server were different on the Panel.
+	Changed bool `json:"changed"`
+
+	// Set when the container for the server was recreated with the new port bindings.
+	Recreated bool `json:"recreated"`
+
+	// Set when the server is running and must be restarted for the new allocations to
+	// be bound, because a restart was not requested.
+	RestartRequired bool `json:"restart_required"`
+
+	// Set when the server is being restarted to bind the new allocations.
+	Restarting bool `json:"restarting"`
+}
+
+// Syncs the server with the Panel and applies any changes to its allocations. The port
+// bindings of a container cannot be changed, so when the allocations have changed the
+// container is recreated with the new bindings if the server is stopped, or the server is
+// restarted if it is running and a restart is requested. The server files are not affected.
+func (s *Server) SyncAllocations(restart bool) (*AllocationSync, error) {
+	var out *AllocationSync
+
+	// The power queue is held while the allocations are applied so that the server cannot be
+	// started while its container is being recreated. A restart is queued and runs once the
+	// queue is released.
+	err := s.PowerQueue().Exclusive(func() error {
+		var err error
+		out, err = s.syncAllocations(restart)
+
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return out, nil
+}
+
+func (s *Server) syncAllocations(restart bool) (*AllocationSync, error) {
+	if s.IsInstalling() {
+		return nil, ErrPowerActionInProgress
+	}
+
+	before := s.Config().Allocations
+	if err := s.Sync(); err != nil {
+		return nil, err
+	}
+	s.SyncWithEnvironment()
+
+	out := &AllocationSync{Changed: !reflect.DeepEqual(before, s.Config().Allocations)}
+	if !out.Changed {
+		return out, nil
+	}
+
+	s.Log().Info("allocations for server have changed, applying new port bindings")
+
+	running, err := s.Environment.IsRunning()
+	if err != nil {
+		return nil, err
+	}
+
+	if running {
+		if !restart {
+			out.RestartRequired = true
+			return out, nil
+		}
+
+		out.Restarting = true
+		go func() {
+			if err := s.HandlePowerAction(PowerActionRestart, config.Get().System.PowerActionTimeout); err != nil {
+				s.Log().WithField("error", err).Error("failed to restart server to apply allocation changes")
+			}
+		}()
+
+		return out, nil
+	}
+
+	// Other environments bind the allocations for the server each time it starts.
+	if env, ok := s.Environment.(*docker.Environment); ok {
+		if exists, err := env.Exists(); err != nil {
+			return nil, err
+		} else if exists {
+			if err := env.Recreate(); err != nil {
+				return nil, err
+			}
+			out.Recreated = true
+		}
+	}
+
+	return out, nil
+}
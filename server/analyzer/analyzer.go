@@ -0,0 +1,87 @@
+package analyzer
+
+import (
+	"regexp"
+	"strings"
+)
+
+// The reasons that a crash can be classified as.
+const (
+	ReasonOutOfMemory     = "out_of_memory"
+	ReasonPortInUse       = "port_in_use"
+	ReasonEulaNotAccepted = "eula_not_accepted"
+	ReasonCorruptedChunk  = "corrupted_chunk"
+)
+
+// A known cause of a crash, recognized by any of the patterns matching a line of console output.
+type signature struct {
+	reason   string
+	hint     string
+	patterns []*regexp.Regexp
+}
+
+// The signatures that are checked, in order of priority. When more than one signature matches
+// the output the first one in this list is used, since the later ones are often a side effect
+// of the earlier ones.
+var signatures = []signature{
+	{
+		reason: ReasonEulaNotAccepted,
+		hint:   "The server has not accepted the Minecraft EULA. Set \"eula=true\" in eula.txt and start the server again.",
+		patterns: []*regexp.Regexp{
+			regexp.MustCompile(`(?i)you need to agree to the eula`),
+			regexp.MustCompile(`(?i)failed to load eula\.txt`),
+		},
+	},
+	{
+		reason: ReasonPortInUse,
+		hint:   "The port the server is trying to use is already in use. Make sure no other process is using the port assigned to this server.",
+		patterns: []*regexp.Regexp{
+			regexp.MustCompile(`(?i)failed to bind to port`),
+			regexp.MustCompile(`(?i)java\.net\.BindException`),
+			regexp.MustCompile(`(?i)address already in use`),
+		},
+	},
+	{
+		reason: ReasonOutOfMemory,
+		hint:   "The server ran out of memory. Reduce the memory used by the server, or increase the memory available to it.",
+		patterns: []*regexp.Regexp{
+			regexp.MustCompile(`java\.lang\.OutOfMemoryError`),
+		},
+	},
+	{
+		reason: ReasonCorruptedChunk,
+		hint:   "The server failed to load a chunk of the world, which is usually caused by a corrupted region file. Restore the world from a backup or remove the affected region file.",
+		patterns: []*regexp.Regexp{
+			regexp.MustCompile(`(?i)couldn't load chunk`),
+			regexp.MustCompile(`(?i)failed to read chunk`),
+			regexp.MustCompile(`(?i)exception reading chunk`),
+			regexp.MustCompile(`(?i)chunk file at .+ is in the wrong location`),
+			regexp.MustCompile(`(?i)region file .+ is truncated`),
+		},
+	},
+}
+
+// The classified cause of a crash, along with a hint that can be shown to the user and the line
+// of output that it was recognized from.
+type Reason struct {
+	Reason string `json:"reason"`
+	Hint   string `json:"hint"`
+	Line   string `json:"line"`
+}
+
+// Returns the cause of a crash recognized in the lines of console output, or nil if the output
+// does not match any of the known signatures.
+func Classify(lines []string) *Reason {
+	for _, sig := range signatures {
+		// The last matching line is used since it is the one closest to the crash.
+		for i := len(lines) - 1; i >= 0; i-- {
+			for _, p := range sig.patterns {
+				if p.MatchString(lines[i]) {
+					return &Reason{Reason: sig.reason, Hint: sig.hint, Line: strings.TrimSpace(lines[i])}
+				}
+			}
+		}
+	}
+
+	return nil
+}
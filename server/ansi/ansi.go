@@ -0,0 +1,274 @@
+package ansi
+
+import (
+	"fmt"
+	"html"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// The ways that ANSI escape sequences in console output can be handled.
+const (
+	// The escape sequences are sent as they are, for frontends that render them as a terminal.
+	ModeKeep = "keep"
+
+	// The escape sequences are removed, leaving only the text.
+	ModeStrip = "strip"
+
+	// The colors and styles are converted to HTML, and any other escape sequences are removed.
+	// The text is escaped so that it can be inserted into a page directly.
+	ModeHtml = "html"
+)
+
+var escapeRegex = regexp.MustCompile("[\u001B\u009B][[\\]()#;?]*(?:(?:(?:[a-zA-Z\\d]*(?:;[a-zA-Z\\d]*)*)?\u0007)|(?:(?:\\d{1,4}(?:;\\d{0,4})*)?[\\dA-PRZcf-ntqry=><~]))")
+
+// Matches a select graphic rendition sequence, which sets the colors and style of the text that
+// follows it.
+var sgrRegex = regexp.MustCompile("^(?:\u001B\\[|\u009B)([\\d;]*)m$")
+
+// The colors used for the standard and bright ANSI colors, in the same order as their codes.
+var palette = [16]string{
+	"#000000", "#cd0000", "#00cd00", "#cdcd00", "#0000ee", "#cd00cd", "#00cdcd", "#e5e5e5",
+	"#7f7f7f", "#ff0000", "#00ff00", "#ffff00", "#5c5cff", "#ff00ff", "#00ffff", "#ffffff",
+}
+
+// Determines if the mode is one of the supported ways of handling escape sequences.
+func IsValidMode(mode string) bool {
+	return mode == ModeKeep || mode == ModeStrip || mode == ModeHtml
+}
+
+// Returns the line of output with its escape sequences handled using the mode. Unknown modes
+// keep the line as it is.
+func Convert(mode string, line string) string {
+	switch mode {
+	case ModeStrip:
+		return Strip(line)
+	case ModeHtml:
+		return ToHtml(line)
+	default:
+		return line
+	}
+}
+
+// Returns the line of output with all of its escape sequences removed.
+func Strip(line string) string {
+	return escapeRegex.ReplaceAllString(line, "")
+}
+
+// The text styles that are currently applied while converting a line to HTML.
+type style struct {
+	fg        string
+	bg        string
+	bold      bool
+	dim       bool
+	italic    bool
+	underline bool
+	blink     bool
+	inverse   bool
+	strike    bool
+}
+
+func (s style) css() string {
+	fg, bg := s.fg, s.bg
+	if s.inverse {
+		fg, bg = bg, fg
+		if fg == "" {
+			fg = palette[0]
+		}
+		if bg == "" {
+			bg = palette[7]
+		}
+	}
+
+	var out []string
+	if fg != "" {
+		out = append(out, "color:"+fg)
+	}
+	if bg != "" {
+		out = append(out, "background-color:"+bg)
+	}
+	if s.bold {
+		out = append(out, "font-weight:bold")
+	}
+	if s.dim {
+		out = append(out, "opacity:0.5")
+	}
+	if s.italic {
+		out = append(out, "font-style:italic")
+	}
+
+	var decorations []string
+	if s.underline {
+		decorations = append(decorations, "underline")
+	}
+	if s.strike {
+		decorations = append(decorations, "line-through")
+	}
+	if s.blink {
+		decorations = append(decorations, "blink")
+	}
+	if len(decorations) > 0 {
+		out = append(out, "text-decoration:"+strings.Join(decorations, " "))
+	}
+
+	return strings.Join(out, ";")
+}
+
+// Returns the line of output with its colors and styles converted to HTML spans. Escape
+// sequences other than those that set the style of the text are removed.
+func ToHtml(line string) string {
+	var b strings.Builder
+	var s style
+	var open bool
+
+	last := 0
+	for _, m := range escapeRegex.FindAllStringIndex(line, -1) {
+		b.WriteString(html.EscapeString(line[last:m[0]]))
+		last = m[1]
+
+		// Only the sequences that set the style of the text are converted.
+		sgr := sgrRegex.FindStringSubmatch(line[m[0]:m[1]])
+		if sgr == nil {
+			continue
+		}
+
+		next := s.apply(sgr[1])
+		if next == s {
+			continue
+		}
+		s = next
+
+		if open {
+			b.WriteString("</span>")
+			open = false
+		}
+
+		if css := s.css(); css != "" {
+			b.WriteString(`<span style="` + css + `">`)
+			open = true
+		}
+	}
+	b.WriteString(html.EscapeString(line[last:]))
+
+	if open {
+		b.WriteString("</span>")
+	}
+
+	return b.String()
+}
+
+// Returns the style after applying the parameters of a select graphic rendition sequence.
+func (s style) apply(params string) style {
+	if params == "" {
+		return style{}
+	}
+
+	codes := strings.Split(params, ";")
+	for i := 0; i < len(codes); i++ {
+		c, err := strconv.Atoi(codes[i])
+		if err != nil {
+			continue
+		}
+
+		switch {
+		case c == 0:
+			s = style{}
+		case c == 1:
+			s.bold = true
+		case c == 2:
+			s.dim = true
+		case c == 3:
+			s.italic = true
+		case c == 4:
+			s.underline = true
+		case c == 5 || c == 6:
+			s.blink = true
+		case c == 7:
+			s.inverse = true
+		case c == 9:
+			s.strike = true
+		case c == 22:
+			s.bold, s.dim = false, false
+		case c == 23:
+			s.italic = false
+		case c == 24:
+			s.underline = false
+		case c == 25:
+			s.blink = false
+		case c == 27:
+			s.inverse = false
+		case c == 29:
+			s.strike = false
+		case c >= 30 && c <= 37:
+			s.fg = palette[c-30]
+		case c >= 90 && c <= 97:
+			s.fg = palette[c-90+8]
+		case c == 39:
+			s.fg = ""
+		case c >= 40 && c <= 47:
+			s.bg = palette[c-40]
+		case c >= 100 && c <= 107:
+			s.bg = palette[c-100+8]
+		case c == 49:
+			s.bg = ""
+		case c == 38 || c == 48:
+			color, n := extendedColor(codes[i+1:])
+			i += n
+			if color == "" {
+				continue
+			}
+
+			if c == 38 {
+				s.fg = color
+			} else {
+				s.bg = color
+			}
+		}
+	}
+
+	return s
+}
+
+// Returns the color defined by the parameters following an extended color code, either a
+// 256 color palette index or an RGB value, along with the number of parameters used.
+func extendedColor(params []string) (string, int) {
+	if len(params) == 0 {
+		return "", 0
+	}
+
+	n := make([]int, 0, 4)
+	for _, p := range params {
+		v, err := strconv.Atoi(p)
+		if err != nil || v < 0 || v > 255 {
+			v = 0
+		}
+		n = append(n, v)
+	}
+
+	switch {
+	case n[0] == 5 && len(n) >= 2:
+		return color256(n[1]), 2
+	case n[0] == 2 && len(n) >= 4:
+		return fmt.Sprintf("#%02x%02x%02x", n[1], n[2], n[3]), 4
+	}
+
+	return "", 1
+}
+
+// Returns the color for an index in the 256 color palette.
+func color256(i int) string {
+	switch {
+	case i < 16:
+		return palette[i]
+	case i < 232:
+		i -= 16
+		levels := [6]int{0, 95, 135, 175, 215, 255}
+
+		return fmt.Sprintf("#%02x%02x%02x", levels[i/36], levels[(i/6)%6], levels[i%6])
+	default:
+		v := 8 + (i-232)*10
+
+		return fmt.Sprintf("#%02x%02x%02x", v, v, v)
+	}
+}
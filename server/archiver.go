@@ -52,13 +52,28 @@ func (a *Archiver) Stat() (*filesystem.Stat, error) {
 
 // Archive creates an archive of the server and deletes the previous one.
 func (a *Archiver) Archive() error {
+	files, err := a.files()
+	if err != nil {
+		return err
+	}
+
+	if err := a.DeleteIfExists(); err != nil {
+		return err
+	}
+
+	return archiver.NewTarGz().Archive(files, a.Path())
+}
+
+// Returns the files and directories in the root of the server directory that are included
+// when archiving the server, with any symlinks resolved.
+func (a *Archiver) files() ([]string, error) {
 	path := a.Server.Filesystem().Path()
 
 	// Get the list of root files and directories to archive.
 	var files []string
 	fileInfo, err := ioutil.ReadDir(path)
 	if err != nil {
-		return err
+		return nil, err
 	}
 
 	for _, file := range fileInfo {
@@ -74,18 +89,14 @@ func (a *Archiver) Archive() error {
 			f, err = a.Server.Filesystem().SafePath(filepath.Join(path, file.Name()))
 
 			if err != nil {
-				return err
+				return nil, err
 			}
 		}
 
 		files = append(files, f)
 	}
 
-	if err := a.DeleteIfExists(); err != nil {
-		return err
-	}
-
-	return archiver.NewTarGz().Archive(files, a.Path())
+	return files, nil
 }
 
 // DeleteIfExists deletes the archive if it exists.
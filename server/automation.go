@@ -0,0 +1,180 @@
+package server
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"github.com/apex/log"
+	"github.com/avatag-host/claws/environment"
+	"github.com/avatag-host/claws/events"
+	"github.com/avatag-host/claws/server/automation"
+	"github.com/avatag-host/claws/system"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// The event used to trigger automation rules when a server crashes. This is not published on
+// the event bus, since crashes are otherwise reported through the console output.
+const AutomationCrashEvent = "crash"
+
+// The server events that automation rules can be triggered by.
+var automationEvents = []string{
+	ConsoleOutputEvent,
+	StatusEvent,
+	DaemonMessageEvent,
+	InstallCompletedEvent,
+	BackupCompletedEvent,
+	OutOfMemoryEvent,
+	CrashReasonEvent,
+}
+
+// Webhook URLs are provided by users, so connections to local and private network addresses
+// are refused in the same way as for remote file downloads.
+var automationClient = &http.Client{
+	Timeout: time.Second * 10,
+	Transport: &http.Transport{
+		DialContext: (&net.Dialer{
+			Timeout: 10 * time.Second,
+			Control: checkDownloadAddress,
+		}).DialContext,
+	},
+}
+
+// Returns the automation engine for the rules defined for the server in the Panel. If any of
+// the rules are invalid no rules are used.
+func (s *Server) Automation() *automation.Engine {
+	// The rules are read before acquiring the lock since the configuration lock is held while
+	// the engine is invalidated.
+	rules := s.Config().Automation
+
+	s.automationLock.Lock()
+	defer s.automationLock.Unlock()
+
+	if s.automation == nil {
+		e, err := automation.New(rules)
+		if err != nil {
+			s.Log().WithField("error", err).Warn("failed to load automation rules for server, no rules will be used")
+			e, _ = automation.New(nil)
+		}
+
+		s.automation = e
+	}
+
+	return s.automation
+}
+
+// Discards the automation engine so that it is rebuilt from the current rules the next time
+// an event occurs.
+func (s *Server) invalidateAutomation() {
+	s.automationLock.Lock()
+	s.automation = nil
+	s.automationLock.Unlock()
+}
+
+// Registers the listener that evaluates the automation rules for each server event.
+func (s *Server) startAutomation() {
+	listener := func(e events.Event) {
+		s.runAutomation(strings.SplitN(e.Topic, ":", 2)[0], e.Data)
+	}
+
+	for _, evt := range automationEvents {
+		s.Events().On(evt, &listener)
+	}
+}
+
+// Evaluates the automation rules for the event, performing the actions of any that trigger.
+func (s *Server) runAutomation(event string, data string) {
+	if len(s.Config().Automation) == 0 {
+		return
+	}
+
+	rules := s.Automation().Evaluate(event, data, s.automationVariables)
+	for _, r := range rules {
+		s.Log().WithFields(log.Fields{"rule": r.Name, "event": event}).Debug("automation rule triggered for server")
+
+		go s.performAutomationActions(r, event, data)
+	}
+}
+
+// Returns the values of the variables that automation rule conditions can use.
+func (s *Server) automationVariables() map[string]string {
+	p := s.Proc()
+
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+
+	return map[string]string{
+		"state":        p.State,
+		"crash_count":  strconv.Itoa(s.crasher.RecentCrashes()),
+		"memory_bytes": strconv.FormatUint(p.Memory, 10),
+		"cpu_absolute": strconv.FormatFloat(p.CpuAbsolute, 'f', 3, 64),
+		"disk_bytes":   strconv.FormatInt(p.Disk, 10),
+	}
+}
+
+func (s *Server) performAutomationActions(r automation.Rule, event string, data string) {
+	for _, a := range r.Actions {
+		var err error
+
+		switch a.Type {
+		case automation.ActionCommand:
+			if s.GetState() == environment.ProcessOfflineState || s.IsPaused() {
+				continue
+			}
+			err = s.Environment.SendCommand(a.Value)
+		case automation.ActionPower:
+			action := PowerAction(a.Value)
+			if !action.IsValid() {
+				err = fmt.Errorf("invalid power action \"%s\"", a.Value)
+			} else {
+				err = s.HandlePowerAction(action)
+			}
+		case automation.ActionWebhook:
+			err = s.sendAutomationWebhook(a.Value, r, event, data)
+		}
+
+		if err != nil {
+			s.Log().WithFields(log.Fields{
+				"rule":   r.Name,
+				"action": a.Type,
+				"error":  err,
+			}).Warn("failed to perform automation action for server")
+		}
+	}
+}
+
+// Posts the details of the event that triggered a rule to a webhook.
+func (s *Server) sendAutomationWebhook(url string, r automation.Rule, event string, data string) error {
+	b, err := json.Marshal(map[string]interface{}{
+		"server":    s.Id(),
+		"rule":      r.Name,
+		"event":     event,
+		"data":      data,
+		"timestamp": time.Now().Unix(),
+	})
+	if err != nil {
+		return err
+	}
+
+	req, err := http.NewRequest(http.MethodPost, url, bytes.NewReader(b))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", fmt.Sprintf("Panther Claws/v%s", system.Version))
+
+	res, err := automationClient.Do(req)
+	if err != nil {
+		return err
+	}
+	res.Body.Close()
+
+	if res.StatusCode >= 300 {
+		return fmt.Errorf("webhook returned status %d", res.StatusCode)
+	}
+
+	return nil
+}
@@ -0,0 +1,199 @@
+package automation
+
+import (
+	"fmt"
+	"github.com/pkg/errors"
+	"regexp"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// The types of action that a rule can perform.
+const (
+	ActionCommand = "command"
+	ActionPower   = "power"
+	ActionWebhook = "webhook"
+)
+
+// The default number of seconds between each time a rule is triggered. This prevents a rule
+// from triggering itself in a loop, for example by sending a command that outputs a line that
+// matches the rule.
+const defaultCooldown = 10
+
+// A rule defined for a server in the Panel, which performs actions when a server event occurs
+// that matches all of its conditions.
+type Rule struct {
+	Name string `json:"name"`
+
+	// The server event that triggers the rule, such as "console output", "status" or "crash".
+	Event string `json:"event"`
+
+	// A regular expression that the data for the event must match, such as the line of console
+	// output. This is optional.
+	Match string `json:"match"`
+
+	// Additional conditions that must all be met for the rule to trigger.
+	Conditions []Condition `json:"conditions"`
+
+	// The actions performed, in order, when the rule triggers.
+	Actions []Action `json:"actions"`
+
+	// The minimum number of seconds between each time the rule triggers. Defaults to 10.
+	Cooldown int `json:"cooldown"`
+}
+
+// Compares a variable of the server to a value. The available variables are "data", "state",
+// "crash_count", "memory_bytes", "cpu_absolute" and "disk_bytes".
+type Condition struct {
+	Variable string `json:"variable"`
+
+	// One of "==", "!=", ">", ">=", "<", "<=" or "matches". The numeric operators compare the
+	// values as numbers, and "matches" treats the value as a regular expression.
+	Operator string `json:"operator"`
+	Value    string `json:"value"`
+}
+
+// An action performed when a rule triggers. For commands the value is the command sent to
+// the server, for power actions it is the action to perform, and for webhooks it is the URL
+// that the event is posted to.
+type Action struct {
+	Type  string `json:"type"`
+	Value string `json:"value"`
+}
+
+type compiledRule struct {
+	Rule
+	match      *regexp.Regexp
+	conditions []*regexp.Regexp
+	lastRun    time.Time
+}
+
+// Evaluates the rules for a single server.
+type Engine struct {
+	mu    sync.Mutex
+	rules []*compiledRule
+}
+
+// Returns an engine for the given rules. An error is returned if any of the rules are not
+// valid, in which case none of the rules are used.
+func New(rules []Rule) (*Engine, error) {
+	e := &Engine{}
+	for i, r := range rules {
+		cr := &compiledRule{Rule: r, conditions: make([]*regexp.Regexp, len(r.Conditions))}
+		if r.Event == "" {
+			return nil, errors.New(fmt.Sprintf("automation: rule %d does not have an event", i))
+		}
+
+		if r.Match != "" {
+			re, err := regexp.Compile(r.Match)
+			if err != nil {
+				return nil, errors.Wrap(err, fmt.Sprintf("automation: rule %d has an invalid match expression", i))
+			}
+			cr.match = re
+		}
+
+		for j, c := range r.Conditions {
+			switch c.Operator {
+			case "==", "!=", ">", ">=", "<", "<=":
+			case "matches":
+				re, err := regexp.Compile(c.Value)
+				if err != nil {
+					return nil, errors.Wrap(err, fmt.Sprintf("automation: rule %d has an invalid condition expression", i))
+				}
+				cr.conditions[j] = re
+			default:
+				return nil, errors.New(fmt.Sprintf("automation: rule %d has an unknown condition operator \"%s\"", i, c.Operator))
+			}
+		}
+
+		for _, a := range r.Actions {
+			if a.Type != ActionCommand && a.Type != ActionPower && a.Type != ActionWebhook {
+				return nil, errors.New(fmt.Sprintf("automation: rule %d has an unknown action \"%s\"", i, a.Type))
+			}
+		}
+
+		e.rules = append(e.rules, cr)
+	}
+
+	return e, nil
+}
+
+// Returns the rules that are triggered by the event, marking them as having run. The variables
+// are only requested if a rule for the event matches its data, so that they do not need to be
+// built for every line of console output.
+func (e *Engine) Evaluate(event string, data string, variables func() map[string]string) []Rule {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	var vars map[string]string
+	var out []Rule
+	for _, r := range e.rules {
+		if r.Event != event {
+			continue
+		}
+
+		if r.match != nil && !r.match.MatchString(data) {
+			continue
+		}
+
+		cooldown := r.Cooldown
+		if cooldown <= 0 {
+			cooldown = defaultCooldown
+		}
+
+		if !r.lastRun.IsZero() && time.Since(r.lastRun) < time.Second*time.Duration(cooldown) {
+			continue
+		}
+
+		if vars == nil {
+			vars = variables()
+			vars["data"] = data
+		}
+
+		if !r.matches(vars) {
+			continue
+		}
+
+		r.lastRun = time.Now()
+		out = append(out, r.Rule)
+	}
+
+	return out
+}
+
+func (r *compiledRule) matches(vars map[string]string) bool {
+	for i, c := range r.Conditions {
+		v := vars[c.Variable]
+
+		switch c.Operator {
+		case "==":
+			if v != c.Value {
+				return false
+			}
+		case "!=":
+			if v == c.Value {
+				return false
+			}
+		case "matches":
+			if !r.conditions[i].MatchString(v) {
+				return false
+			}
+		default:
+			a, err1 := strconv.ParseFloat(v, 64)
+			b, err2 := strconv.ParseFloat(c.Value, 64)
+			if err1 != nil || err2 != nil {
+				return false
+			}
+
+			if (c.Operator == ">" && !(a > b)) ||
+				(c.Operator == ">=" && !(a >= b)) ||
+				(c.Operator == "<" && !(a < b)) ||
+				(c.Operator == "<=" && !(a <= b)) {
+				return false
+			}
+		}
+	}
+
+	return true
+}
@@ -6,6 +6,7 @@ import (
 	"github.com/pkg/errors"
 	"github.com/avatag-host/claws/api"
 	"github.com/avatag-host/claws/server/backup"
+	"github.com/avatag-host/claws/server/hooks"
 	"os"
 	"path"
 )
@@ -13,7 +14,7 @@ import (
 // Notifies the panel of a backup's state and returns an error if one is encountered
 // while performing this action.
 func (s *Server) notifyPanelOfBackup(uuid string, ad *backup.ArchiveDetails, successful bool) error {
-	r := api.New()
+	r := s.panelApi()
 	err := r.SendBackupStatus(uuid, ad.ToRequest(successful))
 	if err != nil {
 		if !api.IsRequestError(err) {
@@ -83,7 +84,14 @@ func (s *Server) Backup(b backup.BackupInterface) error {
 		return errors.WithStack(err)
 	}
 
-	ad, err := b.Generate(inc, s.Filesystem().Path())
+	// A pre-backup hook failing is treated the same as the backup itself failing, so that the
+	// Panel is notified that the backup will not complete.
+	var ad *backup.ArchiveDetails
+	err = s.RunHooks(hooks.PreBackup, map[string]interface{}{"backup": b.Identifier()})
+	if err == nil {
+		ad, err = b.Generate(inc, s.Filesystem().Path())
+	}
+
 	if err != nil {
 		if notifyError := s.notifyPanelOfBackup(b.Identifier(), &backup.ArchiveDetails{}, false); notifyError != nil {
 			s.Log().WithFields(log.Fields{
@@ -15,6 +15,15 @@ import (
 	"sync"
 )
 
+// Buffers used to copy files into an archive. Archives are written one file at a time, so the
+// buffer is reused rather than allocated for every file.
+var copyBuffers = sync.Pool{
+	New: func() interface{} {
+		b := make([]byte, 32*1024)
+		return &b
+	},
+}
+
 type Archive struct {
 	sync.Mutex
 
@@ -123,8 +132,10 @@ func (a *Archive) addToArchive(p string, w *tar.Writer) error {
 		return errors.WithStack(err)
 	}
 
-	buf := make([]byte, 4*1024)
-	if _, err := io.CopyBuffer(w, f, buf); err != nil {
+	buf := copyBuffers.Get().(*[]byte)
+	defer copyBuffers.Put(buf)
+
+	if _, err := io.CopyBuffer(w, f, *buf); err != nil {
 		return errors.WithStack(err)
 	}
 
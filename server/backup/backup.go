@@ -42,6 +42,9 @@ type Backup struct {
 	// An array of files to ignore when generating this backup. This should be
 	// compatible with a standard .gitignore structure.
 	IgnoredFiles []string `json:"ignored_files"`
+
+	// The name of the Panel that the server being backed up belongs to.
+	Panel string `json:"-"`
 }
 
 // noinspection GoNameStartsWithPackageName
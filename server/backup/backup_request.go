@@ -9,6 +9,9 @@ type Request struct {
 	Adapter      string   `json:"adapter"`
 	Uuid         string   `json:"uuid"`
 	IgnoredFiles []string `json:"ignored_files"`
+
+	// The name of the Panel that the server being backed up belongs to.
+	Panel string `json:"-"`
 }
 
 // Generates a new local backup struct.
@@ -21,6 +24,7 @@ func (r *Request) NewLocalBackup() (*LocalBackup, error) {
 		Backup{
 			Uuid:         r.Uuid,
 			IgnoredFiles: r.IgnoredFiles,
+			Panel:        r.Panel,
 		},
 	}, nil
 }
@@ -35,6 +39,7 @@ func (r *Request) NewS3Backup() (*S3Backup, error) {
 		Backup: Backup{
 			Uuid:         r.Uuid,
 			IgnoredFiles: r.IgnoredFiles,
+			Panel:        r.Panel,
 		},
 	}, nil
 }
@@ -71,7 +71,7 @@ func (s *S3Backup) generateRemoteRequest(rc io.ReadCloser) error {
 		return err
 	}
 
-	urls, err := api.New().GetBackupRemoteUploadURLs(s.Backup.Uuid, size)
+	urls, err := api.NewForPanel(s.Panel).GetBackupRemoteUploadURLs(s.Backup.Uuid, size)
 	if err != nil {
 		return err
 	}
@@ -81,6 +81,20 @@ func (s *S3Backup) generateRemoteRequest(rc io.ReadCloser) error {
 		"adapter":   "s3",
 	}).Info("attempting to upload backup..")
 
+	if err := UploadParts(rc, size, urls); err != nil {
+		return err
+	}
+
+	log.WithFields(log.Fields{
+		"backup_id": s.Uuid,
+		"adapter":   "s3",
+	}).Info("backup has been successfully uploaded")
+	return nil
+}
+
+// Uploads size bytes from the reader to S3 as a multipart upload using the presigned URLs
+// provided by the Panel. The upload is aborted if any of the parts fail to upload.
+func UploadParts(rc io.Reader, size int64, urls *api.BackupRemoteUploadResponse) error {
 	handlePart := func(part string, size int64) (string, error) {
 		r, err := http.NewRequest(http.MethodPut, part, nil)
 		if err != nil {
@@ -134,8 +148,8 @@ func (s *S3Backup) generateRemoteRequest(rc io.ReadCloser) error {
 			log.WithError(err).Warn("failed to upload part")
 
 			// Send an AbortMultipartUpload request.
-			if err := s.finishUpload(urls.AbortMultipartUpload, nil); err != nil {
-				log.WithError(err).Warn("failed to abort multipart backup upload")
+			if err := finishUpload(urls.AbortMultipartUpload, nil); err != nil {
+				log.WithError(err).Warn("failed to abort multipart upload")
 			}
 
 			return err
@@ -150,19 +164,11 @@ func (s *S3Backup) generateRemoteRequest(rc io.ReadCloser) error {
 	completeUploadBody.WriteString("</CompleteMultipartUpload>")
 
 	// Send a CompleteMultipartUpload request.
-	if err := s.finishUpload(urls.CompleteMultipartUpload, &completeUploadBody); err != nil {
-		return err
-	}
-
-	log.WithFields(log.Fields{
-		"backup_id": s.Uuid,
-		"adapter":   "s3",
-	}).Info("backup has been successfully uploaded")
-	return nil
+	return finishUpload(urls.CompleteMultipartUpload, &completeUploadBody)
 }
 
 // finishUpload sends a requests to the specified url to either complete or abort the upload.
-func (s *S3Backup) finishUpload(url string, body io.Reader) error {
+func finishUpload(url string, body io.Reader) error {
 	r, err := http.NewRequest(http.MethodPost, url, body)
 	if err != nil {
 		return err
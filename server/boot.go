@@ -0,0 +1,250 @@
+package server
+
+import (
+	"github.com/apex/log"
+	"github.com/avatag-host/claws/config"
+	"github.com/avatag-host/claws/environment"
+	"sort"
+	"sync"
+	"time"
+)
+
+// The priority classes that servers are booted in when Wings starts. Every server in a class
+// is restored before any server in the next class.
+const (
+	BootPriorityCritical = "critical"
+	BootPriorityHigh     = "high"
+	BootPriorityNormal   = "normal"
+	BootPriorityLow      = "low"
+)
+
+var bootPriorities = []string{BootPriorityCritical, BootPriorityHigh, BootPriorityNormal, BootPriorityLow}
+
+// Defines how a server is ordered against the other servers on the node when Wings boots.
+type BootConfiguration struct {
+	// The priority class of the server, which defaults to "normal". Servers that others depend
+	// on, such as proxies and databases, should use a higher class.
+	Priority string `json:"priority"`
+
+	// The UUIDs of the servers on this node that must be running before this server is started.
+	// A dependency is booted in the same class as the server, or an earlier one, even if its
+	// own class is lower.
+	DependsOn []string `json:"depends_on"`
+}
+
+// Returns the index of the priority class of the server, where lower values boot first.
+func (s *Server) bootPriority() int {
+	p := s.Config().Boot.Priority
+	for i, v := range bootPriorities {
+		if v == p {
+			return i
+		}
+	}
+
+	// Servers without a valid priority use the "normal" class.
+	return 2
+}
+
+// Returns the servers grouped by the priority class they should be booted in, with the groups
+// in boot order, along with the dependencies of each server. Within a group the servers are
+// ordered so that dependencies come before the servers that depend on them. Dependencies that
+// form a cycle, or refer to servers that are not on this node, are ignored.
+func bootOrder(servers []*Server) ([][]*Server, map[string][]string) {
+	byId := make(map[string]*Server, len(servers))
+	for _, s := range servers {
+		byId[s.Id()] = s
+	}
+
+	deps := make(map[string][]string, len(servers))
+	for _, s := range servers {
+		for _, d := range s.Config().Boot.DependsOn {
+			if _, ok := byId[d]; ok && d != s.Id() {
+				deps[s.Id()] = append(deps[s.Id()], d)
+			}
+		}
+	}
+
+	// Order the servers so that every dependency comes before the servers depending on it,
+	// keeping the servers in priority order where the dependencies allow it.
+	sorted := make([]*Server, len(servers))
+	copy(sorted, servers)
+	sort.SliceStable(sorted, func(i, j int) bool {
+		return sorted[i].bootPriority() < sorted[j].bootPriority()
+	})
+
+	const (
+		unvisited = iota
+		visiting
+		visited
+	)
+
+	state := make(map[string]int, len(servers))
+	order := make([]*Server, 0, len(servers))
+
+	var visit func(s *Server)
+	visit = func(s *Server) {
+		state[s.Id()] = visiting
+
+		var kept []string
+		for _, d := range deps[s.Id()] {
+			if state[d] == visiting {
+				s.Log().WithField("dependency", d).Warn("ignoring server boot dependency that forms a cycle")
+				continue
+			}
+
+			if state[d] == unvisited {
+				visit(byId[d])
+			}
+			kept = append(kept, d)
+		}
+		deps[s.Id()] = kept
+
+		state[s.Id()] = visited
+		order = append(order, s)
+	}
+
+	for _, s := range sorted {
+		if state[s.Id()] == unvisited {
+			visit(s)
+		}
+	}
+
+	// A dependency is moved into the class of the server depending on it when that class boots
+	// earlier. Walking the order backwards visits every server before its dependencies.
+	class := make(map[string]int, len(servers))
+	for _, s := range order {
+		class[s.Id()] = s.bootPriority()
+	}
+
+	for i := len(order) - 1; i >= 0; i-- {
+		id := order[i].Id()
+		for _, d := range deps[id] {
+			if class[id] < class[d] {
+				class[d] = class[id]
+			}
+		}
+	}
+
+	groups := make([][]*Server, len(bootPriorities))
+	for _, s := range order {
+		groups[class[s.Id()]] = append(groups[class[s.Id()]], s)
+	}
+
+	out := make([][]*Server, 0, len(groups))
+	for i, g := range groups {
+		if len(g) == 0 {
+			continue
+		}
+
+		ids := make([]string, len(g))
+		for j, s := range g {
+			ids[j] = s.Id()
+		}
+		log.WithFields(log.Fields{"priority": bootPriorities[i], "servers": ids}).Debug("determined server boot order for priority class")
+
+		out = append(out, g)
+	}
+
+	return out, deps
+}
+
+// Tracks which servers have finished being restored when Wings boots, so that servers can wait
+// for the servers they depend on.
+type BootTracker struct {
+	mu     sync.Mutex
+	groups [][]*Server
+	deps   map[string][]string
+	done   map[string]chan struct{}
+}
+
+// Returns a tracker for restoring the given servers, determining the order that they should be
+// booted in.
+func NewBootTracker(servers []*Server) *BootTracker {
+	bt := &BootTracker{done: make(map[string]chan struct{}, len(servers))}
+	bt.groups, bt.deps = bootOrder(servers)
+	for _, s := range servers {
+		bt.done[s.Id()] = make(chan struct{})
+	}
+
+	return bt
+}
+
+// Returns the servers grouped by priority class, in the order that the groups should be booted.
+// Every server in a group should be restored before the next group is started.
+func (bt *BootTracker) Groups() [][]*Server {
+	return bt.groups
+}
+
+// Marks the server as having been restored to its previous state.
+func (bt *BootTracker) Done(s *Server) {
+	bt.mu.Lock()
+	defer bt.mu.Unlock()
+
+	if ch, ok := bt.done[s.Id()]; ok {
+		close(ch)
+		delete(bt.done, s.Id())
+	}
+}
+
+// Returns a channel that is closed once the server has been restored, or nil if the server is
+// not being restored.
+func (bt *BootTracker) wait(id string) <-chan struct{} {
+	bt.mu.Lock()
+	defer bt.mu.Unlock()
+
+	if ch, ok := bt.done[id]; ok {
+		return ch
+	}
+
+	return nil
+}
+
+// Waits for the servers that this server depends on to be running before it is started when
+// Wings boots. A dependency that is not started, or that fails to start, is not waited on. The
+// server is started anyway once the configured timeout is reached.
+func (s *Server) WaitForBootDependencies(bt *BootTracker) {
+	deps := bt.deps[s.Id()]
+	if len(deps) == 0 {
+		return
+	}
+
+	timeout := time.NewTimer(time.Second * time.Duration(config.Get().System.BootDependencyTimeout))
+	defer timeout.Stop()
+
+	ticker := time.NewTicker(time.Second)
+	defer ticker.Stop()
+
+	for _, id := range deps {
+		d := GetServers().Find(func(s *Server) bool { return s.Id() == id })
+		if d == nil {
+			continue
+		}
+
+		l := s.Log().WithField("dependency", id)
+		l.Debug("waiting for server boot dependency to be running")
+
+		restored := bt.wait(id)
+		for {
+			st := d.GetState()
+			if st == environment.ProcessRunningState {
+				break
+			}
+
+			// Once the dependency has been restored it is either starting or will not be
+			// started at all.
+			if restored == nil && st != environment.ProcessStartingState {
+				l.WithField("state", st).Warn("server boot dependency is not running, starting server anyway")
+				break
+			}
+
+			select {
+			case <-restored:
+				restored = nil
+			case <-ticker.C:
+			case <-timeout.C:
+				l.Warn("timed out waiting for server boot dependency to be running, starting server anyway")
+				return
+			}
+		}
+	}
+}
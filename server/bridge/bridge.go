@@ -0,0 +1,148 @@
+package bridge
+
+import (
+	"bufio"
+	"crypto/tls"
+	"encoding/json"
+	"github.com/apex/log"
+	"github.com/avatag-host/claws/config"
+	"github.com/pkg/errors"
+	"net"
+	"strings"
+	"time"
+)
+
+// The number of events that are held in memory while waiting to be published. Events are
+// dropped once this limit is reached, for example while the broker is unreachable.
+const bufferSize = 1000
+
+// A server event as it is published to the broker.
+type Message struct {
+	Node      string `json:"node"`
+	Server    string `json:"server"`
+	Event     string `json:"event"`
+	Data      string `json:"data"`
+	Sequence  uint64 `json:"sequence,omitempty"`
+	Timestamp int64  `json:"timestamp"`
+}
+
+// A connection to a broker that messages can be published to.
+type publisher interface {
+	Publish(subject string, payload []byte) error
+	Close() error
+}
+
+// Publishes server events to a NATS or Redis broker. Messages are published in the order they
+// are received from a single routine, and the connection is re-established if it is lost.
+type Bridge struct {
+	cfg   config.EventBridgeConfiguration
+	node  string
+	queue chan Message
+}
+
+// Returns a new bridge for the given configuration, publishing events for the node.
+func New(cfg config.EventBridgeConfiguration, node string) *Bridge {
+	return &Bridge{cfg: cfg, node: node, queue: make(chan Message, bufferSize)}
+}
+
+// Queues an event to be published. If the queue is full the event is dropped so that a slow
+// broker never blocks the server the event is for.
+func (b *Bridge) Publish(server string, event string, data string, sequence uint64) {
+	m := Message{
+		Node:      b.node,
+		Server:    server,
+		Event:     event,
+		Data:      data,
+		Sequence:  sequence,
+		Timestamp: time.Now().Unix(),
+	}
+
+	select {
+	case b.queue <- m:
+	default:
+		log.WithField("server", server).Debug("dropping event for broker, the event bridge queue is full")
+	}
+}
+
+// Publishes the queued events to the broker. This function blocks and should be run in its
+// own routine.
+func (b *Bridge) Run() {
+	var p publisher
+	backoff := time.Second
+
+	for m := range b.queue {
+		payload, err := json.Marshal(m)
+		if err != nil {
+			continue
+		}
+
+		for {
+			if p == nil {
+				if p, err = b.connect(); err != nil {
+					log.WithField("error", err).Warn("failed to connect to event bridge broker, retrying")
+					time.Sleep(backoff)
+					if backoff < time.Minute {
+						backoff *= 2
+					}
+					continue
+				}
+				backoff = time.Second
+			}
+
+			if err := p.Publish(b.subject(m), payload); err != nil {
+				log.WithField("error", err).Warn("failed to publish event to event bridge broker, reconnecting")
+				p.Close()
+				p = nil
+				continue
+			}
+
+			break
+		}
+	}
+}
+
+// Returns the subject or channel that the message is published to.
+func (b *Bridge) subject(m Message) string {
+	sep := "."
+	if b.cfg.Driver == config.EventBridgeRedis {
+		sep = ":"
+	}
+
+	// The server event topics may include a specific resource after a colon, such as the
+	// backup UUID for "backup completed:<uuid>".
+	event := strings.NewReplacer(" ", "_", ":", sep).Replace(m.Event)
+
+	return strings.Join([]string{b.cfg.Prefix, m.Node, m.Server, event}, sep)
+}
+
+func (b *Bridge) connect() (publisher, error) {
+	var conn net.Conn
+	var err error
+	d := &net.Dialer{Timeout: time.Second * 10}
+	if b.cfg.Tls {
+		host, _, _ := net.SplitHostPort(b.cfg.Address)
+		conn, err = tls.DialWithDialer(d, "tcp", b.cfg.Address, &tls.Config{ServerName: host})
+	} else {
+		conn, err = d.Dial("tcp", b.cfg.Address)
+	}
+
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+
+	if b.cfg.Driver == config.EventBridgeRedis {
+		return newRedisPublisher(conn, b.cfg.Username, b.cfg.Password)
+	}
+
+	return newNatsPublisher(conn, b.cfg.Username, b.cfg.Password)
+}
+
+// Reads a single CRLF terminated line from the connection.
+func readLine(r *bufio.Reader) (string, error) {
+	line, err := r.ReadString('\n')
+	if err != nil {
+		return "", errors.WithStack(err)
+	}
+
+	return strings.TrimRight(line, "\r\n"), nil
+}
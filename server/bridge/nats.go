@@ -0,0 +1,113 @@
+package bridge
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"github.com/avatag-host/claws/system"
+	"github.com/pkg/errors"
+	"net"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Publishes messages using the NATS client protocol.
+type natsPublisher struct {
+	mu   sync.Mutex
+	conn net.Conn
+	r    *bufio.Reader
+	err  error
+}
+
+func newNatsPublisher(conn net.Conn, username string, password string) (*natsPublisher, error) {
+	p := &natsPublisher{conn: conn, r: bufio.NewReader(conn)}
+
+	// The server sends an INFO line as soon as the connection is opened.
+	conn.SetDeadline(time.Now().Add(time.Second * 10))
+	if line, err := readLine(p.r); err != nil {
+		conn.Close()
+		return nil, err
+	} else if !strings.HasPrefix(line, "INFO") {
+		conn.Close()
+		return nil, errors.New("bridge: unexpected greeting from nats server")
+	}
+
+	opts, _ := json.Marshal(map[string]interface{}{
+		"verbose":  false,
+		"pedantic": false,
+		"name":     "claws",
+		"lang":     "go",
+		"version":  system.Version,
+		"user":     username,
+		"pass":     password,
+	})
+
+	// Send a PING after connecting so that any authentication error is returned before the
+	// PONG, rather than being missed.
+	if _, err := fmt.Fprintf(conn, "CONNECT %s\r\nPING\r\n", opts); err != nil {
+		conn.Close()
+		return nil, errors.WithStack(err)
+	}
+
+	line, err := readLine(p.r)
+	if err != nil {
+		conn.Close()
+		return nil, err
+	}
+
+	if line != "PONG" {
+		conn.Close()
+		return nil, errors.New("bridge: nats server rejected connection: " + line)
+	}
+	conn.SetDeadline(time.Time{})
+
+	go p.read()
+
+	return p, nil
+}
+
+// Reads the messages sent by the server, responding to the PINGs it sends to check that the
+// connection is alive. Any error is returned on the next call to Publish.
+func (p *natsPublisher) read() {
+	for {
+		line, err := readLine(p.r)
+		if err != nil {
+			p.mu.Lock()
+			p.err = err
+			p.mu.Unlock()
+			return
+		}
+
+		switch {
+		case line == "PING":
+			p.mu.Lock()
+			_, err = p.conn.Write([]byte("PONG\r\n"))
+			p.mu.Unlock()
+		case strings.HasPrefix(line, "-ERR"):
+			p.mu.Lock()
+			p.err = errors.New("bridge: nats server returned an error: " + line)
+			p.mu.Unlock()
+		}
+	}
+}
+
+func (p *natsPublisher) Publish(subject string, payload []byte) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if p.err != nil {
+		return p.err
+	}
+
+	p.conn.SetWriteDeadline(time.Now().Add(time.Second * 10))
+	if _, err := fmt.Fprintf(p.conn, "PUB %s %d\r\n%s\r\n", subject, len(payload), payload); err != nil {
+		return errors.WithStack(err)
+	}
+
+	return nil
+}
+
+func (p *natsPublisher) Close() error {
+	return p.conn.Close()
+}
@@ -0,0 +1,71 @@
+package bridge
+
+import (
+	"bufio"
+	"fmt"
+	"github.com/pkg/errors"
+	"net"
+	"strings"
+	"time"
+)
+
+// Publishes messages using the Redis PUBLISH command.
+type redisPublisher struct {
+	conn net.Conn
+	r    *bufio.Reader
+}
+
+func newRedisPublisher(conn net.Conn, username string, password string) (*redisPublisher, error) {
+	p := &redisPublisher{conn: conn, r: bufio.NewReader(conn)}
+
+	if password != "" {
+		args := []string{"AUTH", password}
+		if username != "" {
+			args = []string{"AUTH", username, password}
+		}
+
+		if _, err := p.command(args...); err != nil {
+			conn.Close()
+			return nil, err
+		}
+	}
+
+	return p, nil
+}
+
+// Sends a command to the server and returns the first line of the reply.
+func (p *redisPublisher) command(args ...string) (string, error) {
+	var b strings.Builder
+	fmt.Fprintf(&b, "*%d\r\n", len(args))
+	for _, a := range args {
+		fmt.Fprintf(&b, "$%d\r\n%s\r\n", len(a), a)
+	}
+
+	p.conn.SetDeadline(time.Now().Add(time.Second * 10))
+	defer p.conn.SetDeadline(time.Time{})
+
+	if _, err := p.conn.Write([]byte(b.String())); err != nil {
+		return "", errors.WithStack(err)
+	}
+
+	line, err := readLine(p.r)
+	if err != nil {
+		return "", err
+	}
+
+	if strings.HasPrefix(line, "-") {
+		return "", errors.New("bridge: redis server returned an error: " + line[1:])
+	}
+
+	return line, nil
+}
+
+func (p *redisPublisher) Publish(subject string, payload []byte) error {
+	_, err := p.command("PUBLISH", subject, string(payload))
+
+	return err
+}
+
+func (p *redisPublisher) Close() error {
+	return p.conn.Close()
+}
@@ -1,7 +1,10 @@
 package server
 
 import (
+	"github.com/avatag-host/claws/config"
 	"github.com/avatag-host/claws/environment"
+	"github.com/avatag-host/claws/server/ansi"
+	"github.com/avatag-host/claws/server/automation"
 	"sync"
 )
 
@@ -34,10 +37,29 @@ type Configuration struct {
 	Mounts                []Mount                 `json:"mounts"`
 	Resources             ResourceUsage           `json:"resources"`
 
-	Container struct {
-		// Defines the Docker image that will be used for this server
-		Image string `json:"image,omitempty"`
-	} `json:"container,omitempty"`
+	// The number of seconds between resource usage updates for the server while it is running.
+	// When zero the node default is used.
+	StatsInterval int `json:"stats_interval"`
+
+	// Determines how ANSI escape sequences in the console output of the server are handled,
+	// either "keep", "strip" or "html". When empty the node default is used.
+	ConsoleAnsi string `json:"console_ansi"`
+
+	// Overrides for the resource limits applied to the installation container for this
+	// server. Any value left at zero falls back to the node configuration, while a negative
+	// value removes that limit for the server.
+	Installer config.InstallerLimits `json:"installer"`
+
+	Container environment.ContainerSettings `json:"container,omitempty"`
+
+	// The priority class and dependencies used to order the server when Wings boots.
+	Boot BootConfiguration `json:"boot"`
+
+	// The schedule that the server is restarted on by Wings, if any.
+	ScheduledRestart RestartSchedule `json:"scheduled_restart"`
+
+	// The automation rules defined for the server in the Panel.
+	Automation []automation.Rule `json:"automation"`
 }
 
 func (s *Server) Config() *Configuration {
@@ -55,6 +77,19 @@ func (s *Server) DiskSpace() int64 {
 	return s.cfg.Build.DiskSpace * 1024.0 * 1024.0
 }
 
+// Returns how ANSI escape sequences in the console output of the server are handled, using the
+// node default unless the server overrides it.
+func (s *Server) ConsoleAnsi() string {
+	s.cfg.mu.RLock()
+	defer s.cfg.mu.RUnlock()
+
+	if ansi.IsValidMode(s.cfg.ConsoleAnsi) {
+		return s.cfg.ConsoleAnsi
+	}
+
+	return config.Get().System.ConsoleAnsi
+}
+
 func (s *Server) MemoryLimit() int64 {
 	s.cfg.mu.RLock()
 	defer s.cfg.mu.RUnlock()
@@ -74,3 +109,10 @@ func (c *Configuration) SetSuspended(s bool) {
 	c.Suspended = s
 	c.mu.Unlock()
 }
+
+// Replaces the custom mounts for the server.
+func (c *Configuration) SetMounts(m []Mount) {
+	c.mu.Lock()
+	c.Mounts = m
+	c.mu.Unlock()
+}
@@ -108,6 +108,18 @@ func (ct *ConsoleThrottler) StopTimer() {
 	}
 }
 
+// Replaces the throttle configuration in use, restarting the timers so that changes to the
+// reset and decay intervals take effect.
+func (ct *ConsoleThrottler) SetConfiguration(c config.ConsoleThrottles) {
+	ct.StopTimer()
+
+	ct.mu.Lock()
+	ct.ConsoleThrottles = c
+	ct.mu.Unlock()
+
+	ct.StartTimer()
+}
+
 // Handles output from a server's console. This code ensures that a server is not outputting
 // an excessive amount of data to the console that could indicate a malicious or run-away process
 // and lead to performance issues for other users.
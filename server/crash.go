@@ -5,15 +5,44 @@ import (
 	"github.com/pkg/errors"
 	"github.com/avatag-host/claws/config"
 	"github.com/avatag-host/claws/environment"
+	"github.com/avatag-host/claws/server/analyzer"
+	"strconv"
 	"sync"
 	"time"
 )
 
+// The number of lines of console output that are checked for the cause of a crash.
+const crashAnalysisLines = 200
+
 type CrashHandler struct {
 	mu sync.RWMutex
 
 	// Tracks the time of the last server crash event.
 	lastCrash time.Time
+
+	// The times of the crashes within the last hour.
+	crashes []time.Time
+}
+
+// Records that the server crashed.
+func (cd *CrashHandler) recordCrash() {
+	cd.mu.Lock()
+	cd.crashes = append(cd.crashes, time.Now())
+	cd.mu.Unlock()
+}
+
+// Returns the number of times the server has crashed within the last hour.
+func (cd *CrashHandler) RecentCrashes() int {
+	cd.mu.Lock()
+	defer cd.mu.Unlock()
+
+	i := 0
+	for i < len(cd.crashes) && time.Since(cd.crashes[i]) > time.Hour {
+		i++
+	}
+	cd.crashes = cd.crashes[i:]
+
+	return len(cd.crashes)
 }
 
 // Returns the time of the last crash for this server instance.
@@ -43,15 +72,8 @@ func (cd *CrashHandler) SetLastCrash(t time.Time) {
 // counter for the server will be incremented.
 func (s *Server) handleServerCrash() error {
 	// No point in doing anything here if the server isn't currently offline, there
-	// is no reason to do a crash detection event. If the server crash detection is
-	// disabled we want to skip anything after this as well.
-	if s.GetState() != environment.ProcessOfflineState || !s.Config().CrashDetectionEnabled {
-		if !s.Config().CrashDetectionEnabled {
-			s.Log().Debug("server triggered crash detection but handler is disabled for server process")
-
-			s.PublishConsoleOutputFromDaemon("Server detected as crashed; crash detection is disabled for this instance.")
-		}
-
+	// is no reason to do a crash detection event.
+	if s.GetState() != environment.ProcessOfflineState {
 		return nil
 	}
 
@@ -60,6 +82,27 @@ func (s *Server) handleServerCrash() error {
 		return errors.WithStack(err)
 	}
 
+	// Always report the server running out of memory, even if crash detection is disabled,
+	// otherwise the user has no way of knowing why their server stopped.
+	if oomKilled {
+		s.handleOutOfMemory(exitCode)
+	}
+
+	// The cause is reported regardless of the crash detection settings, since a server that
+	// has not accepted the EULA, for example, exits cleanly.
+	var reason *analyzer.Reason
+	if config.Get().System.AnalyzeCrashes {
+		reason = s.analyzeCrash()
+	}
+
+	if !s.Config().CrashDetectionEnabled {
+		s.Log().Debug("server triggered crash detection but handler is disabled for server process")
+
+		s.PublishConsoleOutputFromDaemon("Server detected as crashed; crash detection is disabled for this instance.")
+
+		return nil
+	}
+
 	// If the system is not configured to detect a clean exit code as a crash, and the
 	// crash is not the result of the program running out of memory, do nothing.
 	if exitCode == 0 && !oomKilled && !config.Get().System.DetectCleanExitAsCrash {
@@ -72,6 +115,17 @@ func (s *Server) handleServerCrash() error {
 	s.PublishConsoleOutputFromDaemon(fmt.Sprintf("Exit code: %d", exitCode))
 	s.PublishConsoleOutputFromDaemon(fmt.Sprintf("Out of memory: %t", oomKilled))
 
+	s.crasher.recordCrash()
+
+	if config.Get().System.CrashReports.Enabled {
+		if r, err := s.writeCrashReport(exitCode, oomKilled, reason); err != nil {
+			s.Log().WithField("error", err).Warn("failed to write crash report for server")
+		} else {
+			s.Log().WithField("report", r.Id).Debug("wrote crash report for server")
+		}
+	}
+	s.runAutomation(AutomationCrashEvent, strconv.Itoa(int(exitCode)))
+
 	c := s.crasher.LastCrashTime()
 	// If the last crash time was within the last 60 seconds we do not want to perform
 	// an automatic reboot of the process. Return an error that can be handled.
@@ -85,3 +139,42 @@ func (s *Server) handleServerCrash() error {
 
 	return s.HandlePowerAction(PowerActionStart)
 }
+
+// Checks the last lines of console output for a known cause of the crash, emitting an event
+// with the cause and a hint for the user if one is recognized.
+func (s *Server) analyzeCrash() *analyzer.Reason {
+	lines, err := s.Environment.Readlog(crashAnalysisLines)
+	if err != nil {
+		s.Log().WithField("error", err).Warn("failed to read console output to analyze server crash")
+		return nil
+	}
+
+	reason := analyzer.Classify(lines)
+	if reason == nil {
+		return nil
+	}
+
+	s.Log().WithField("reason", reason.Reason).Info("recognized cause of server crash in console output")
+
+	_ = s.Events().PublishJson(CrashReasonEvent, reason)
+	s.PublishConsoleOutputFromDaemon("Possible cause: " + reason.Hint)
+
+	return reason
+}
+
+// Emits an event for the server process having been killed for running out of memory, and
+// notifies the Panel so that the user can be told why their server stopped.
+func (s *Server) handleOutOfMemory(exitCode uint32) {
+	limit := s.Config().Build.MemoryLimit
+
+	s.Log().WithField("exit_code", exitCode).WithField("memory_limit", limit).Warn("server process was killed for running out of memory")
+
+	_ = s.Events().PublishJson(OutOfMemoryEvent, map[string]interface{}{
+		"exit_code":    exitCode,
+		"memory_limit": limit,
+	})
+
+	if err := s.panelApi().SendServerOutOfMemory(s.Id(), exitCode, limit); err != nil {
+		s.Log().WithField("error", err).Warn("failed to notify panel of server running out of memory")
+	}
+}
@@ -0,0 +1,187 @@
+package server
+
+import (
+	"encoding/json"
+	"github.com/avatag-host/claws/config"
+	"github.com/avatag-host/claws/environment"
+	"github.com/avatag-host/claws/server/analyzer"
+	"github.com/avatag-host/claws/server/history"
+	"github.com/pkg/errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+)
+
+// The amount of resource usage history leading up to a crash that is included in a report.
+const crashReportHistory = time.Minute * 15
+
+var crashReportIdRegex = regexp.MustCompile(`^[0-9]{14}$`)
+
+// A report written when the server crashes, describing the state of the server leading up to
+// the crash.
+type CrashReport struct {
+	Id        string `json:"id"`
+	ExitCode  uint32 `json:"exit_code"`
+	OomKilled bool   `json:"oom_killed"`
+
+	// The number of times the server has crashed within the last hour, including this crash.
+	RecentCrashes int `json:"recent_crashes"`
+
+	// The cause of the crash recognized in the console output, if crash analysis is enabled.
+	Reason *analyzer.Reason `json:"reason,omitempty"`
+
+	// The last lines of console output from the server process.
+	Console []string `json:"console"`
+
+	// The resource limits of the server at the time of the crash, and the resource usage
+	// recorded in the minutes before it. The usage is only available when resource history is
+	// enabled.
+	Limits    environment.Limits `json:"limits"`
+	Resources []history.Point    `json:"resources"`
+	Disk      int64              `json:"disk_bytes"`
+
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// Returns the directory that the crash reports for the server are stored in.
+func (s *Server) crashReportsPath() string {
+	return filepath.Join(config.Get().System.GetCrashReportsPath(), s.Id())
+}
+
+// Writes a report for a crash of the server process with the given exit state, removing the
+// oldest reports once the configured limit is reached. The report is sent to the Panel as well
+// if uploading reports is enabled.
+func (s *Server) writeCrashReport(exitCode uint32, oomKilled bool, reason *analyzer.Reason) (*CrashReport, error) {
+	cfg := config.Get().System.CrashReports
+
+	now := time.Now().UTC()
+	r := &CrashReport{
+		Id:            now.Format("20060102150405"),
+		ExitCode:      exitCode,
+		OomKilled:     oomKilled,
+		RecentCrashes: s.crasher.RecentCrashes(),
+		Reason:        reason,
+		Console:       []string{},
+		Limits:        s.Config().Build,
+		Resources:     s.ResourceHistory().Query(now.Add(-crashReportHistory), now),
+		Disk:          s.Filesystem().CachedUsage(),
+		CreatedAt:     now,
+	}
+
+	if cfg.ConsoleLines > 0 {
+		if lines, err := s.Environment.Readlog(cfg.ConsoleLines); err != nil {
+			s.Log().WithField("error", err).Warn("failed to read console output for crash report")
+		} else if lines != nil {
+			r.Console = lines
+		}
+	}
+
+	b, err := json.Marshal(r)
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+
+	dir := s.crashReportsPath()
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return nil, errors.WithStack(err)
+	}
+
+	if err := ioutil.WriteFile(filepath.Join(dir, r.Id+".json"), b, 0600); err != nil {
+		return nil, errors.WithStack(err)
+	}
+
+	if ids, err := s.crashReportIds(); err == nil && len(ids) > cfg.Retention {
+		for _, id := range ids[:len(ids)-cfg.Retention] {
+			if err := os.Remove(filepath.Join(dir, id+".json")); err != nil && !os.IsNotExist(err) {
+				s.Log().WithField("error", err).Warn("failed to remove old crash report for server")
+			}
+		}
+	}
+
+	if cfg.Upload {
+		go func(r *CrashReport) {
+			if err := s.panelApi().SendCrashReport(s.Id(), r); err != nil {
+				s.Log().WithField("error", err).Warn("failed to send crash report to panel")
+			}
+		}(r)
+	}
+
+	return r, nil
+}
+
+// Returns the IDs of the crash reports stored for the server, from oldest to newest.
+func (s *Server) crashReportIds() ([]string, error) {
+	files, err := ioutil.ReadDir(s.crashReportsPath())
+	if err != nil {
+		if os.IsNotExist(err) {
+			return []string{}, nil
+		}
+
+		return nil, errors.WithStack(err)
+	}
+
+	ids := make([]string, 0, len(files))
+	for _, f := range files {
+		id := strings.TrimSuffix(f.Name(), ".json")
+		if !f.IsDir() && crashReportIdRegex.MatchString(id) {
+			ids = append(ids, id)
+		}
+	}
+	sort.Strings(ids)
+
+	return ids, nil
+}
+
+// Returns the crash reports stored for the server, from newest to oldest.
+func (s *Server) CrashReports() ([]*CrashReport, error) {
+	ids, err := s.crashReportIds()
+	if err != nil {
+		return nil, err
+	}
+
+	out := make([]*CrashReport, 0, len(ids))
+	for i := len(ids) - 1; i >= 0; i-- {
+		r, err := s.CrashReport(ids[i])
+		if err != nil {
+			// Reports can be removed while they are being listed.
+			if errors.Is(err, os.ErrNotExist) {
+				continue
+			}
+
+			return nil, err
+		}
+
+		out = append(out, r)
+	}
+
+	return out, nil
+}
+
+// Returns a single crash report for the server. An error wrapping os.ErrNotExist is returned if
+// there is no report with the given ID.
+func (s *Server) CrashReport(id string) (*CrashReport, error) {
+	if !crashReportIdRegex.MatchString(id) {
+		return nil, errors.WithStack(os.ErrNotExist)
+	}
+
+	b, err := ioutil.ReadFile(filepath.Join(s.crashReportsPath(), id+".json"))
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+
+	r := &CrashReport{}
+	if err := json.Unmarshal(b, r); err != nil {
+		return nil, errors.WithStack(err)
+	}
+
+	return r, nil
+}
+
+// Removes all of the crash reports stored for the server.
+func (s *Server) RemoveCrashReports() error {
+	return errors.WithStack(os.RemoveAll(s.crashReportsPath()))
+}
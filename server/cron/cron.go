@@ -0,0 +1,177 @@
+package cron
+
+import (
+	"fmt"
+	"github.com/pkg/errors"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// The shorthand expressions that can be used in place of the five fields.
+var macros = map[string]string{
+	"@yearly":   "0 0 1 1 *",
+	"@annually": "0 0 1 1 *",
+	"@monthly":  "0 0 1 * *",
+	"@weekly":   "0 0 * * 0",
+	"@daily":    "0 0 * * *",
+	"@midnight": "0 0 * * *",
+	"@hourly":   "0 * * * *",
+}
+
+// The range of values allowed for each of the fields, in the order they appear in an expression.
+var bounds = [5]struct {
+	name     string
+	min, max int
+}{
+	{"minute", 0, 59},
+	{"hour", 0, 23},
+	{"day of month", 1, 31},
+	{"month", 1, 12},
+	{"day of week", 0, 7},
+}
+
+// The number of minutes searched for the next time a schedule runs before giving up. Four years
+// covers every valid combination of days, including the 29th of February.
+const maxSearchMinutes = 4 * 366 * 24 * 60
+
+// A parsed cron expression in the standard five field format of minute, hour, day of month,
+// month and day of week.
+type Schedule struct {
+	minute, hour, dom, month, dow uint64
+
+	// Set when the day fields are restricted, in which case a day matches if either of them
+	// match, the same as the standard cron behavior.
+	domRestricted, dowRestricted bool
+}
+
+// Parses a cron expression. Each field may be "*", a number, a range such as "1-5", a step such
+// as "*/15" or "0-30/10", or a comma separated list of those. The "@hourly", "@daily",
+// "@weekly", "@monthly" and "@yearly" shorthands are also accepted.
+func Parse(expr string) (*Schedule, error) {
+	expr = strings.TrimSpace(expr)
+	if m, ok := macros[strings.ToLower(expr)]; ok {
+		expr = m
+	}
+
+	fields := strings.Fields(expr)
+	if len(fields) != 5 {
+		return nil, errors.New(fmt.Sprintf("cron: expected 5 fields in expression \"%s\", got %d", expr, len(fields)))
+	}
+
+	var sets [5]uint64
+	for i, f := range fields {
+		set, err := parseField(f, i)
+		if err != nil {
+			return nil, err
+		}
+		sets[i] = set
+	}
+
+	// Sunday can be written as either 0 or 7.
+	if sets[4]&(1<<7) != 0 {
+		sets[4] |= 1
+	}
+
+	return &Schedule{
+		minute:        sets[0],
+		hour:          sets[1],
+		dom:           sets[2],
+		month:         sets[3],
+		dow:           sets[4],
+		domRestricted: fields[2] != "*",
+		dowRestricted: fields[4] != "*",
+	}, nil
+}
+
+// Parses a single field of an expression into a bit set of the values it matches.
+func parseField(f string, i int) (uint64, error) {
+	b := bounds[i]
+
+	var set uint64
+	for _, part := range strings.Split(f, ",") {
+		step := 1
+		if idx := strings.Index(part, "/"); idx >= 0 {
+			n, err := strconv.Atoi(part[idx+1:])
+			if err != nil || n <= 0 {
+				return 0, errors.New(fmt.Sprintf("cron: invalid step \"%s\" in %s field", part[idx+1:], b.name))
+			}
+			step = n
+			part = part[:idx]
+		}
+
+		lo, hi := b.min, b.max
+		if part != "*" {
+			ends := strings.SplitN(part, "-", 2)
+
+			var err error
+			if lo, err = strconv.Atoi(ends[0]); err != nil {
+				return 0, errors.New(fmt.Sprintf("cron: invalid value \"%s\" in %s field", part, b.name))
+			}
+
+			hi = lo
+			if len(ends) == 2 {
+				if hi, err = strconv.Atoi(ends[1]); err != nil {
+					return 0, errors.New(fmt.Sprintf("cron: invalid value \"%s\" in %s field", part, b.name))
+				}
+			} else if step > 1 {
+				// A step after a single value, such as "5/10", runs until the end of the range.
+				hi = b.max
+			}
+		}
+
+		if lo < b.min || hi > b.max || lo > hi {
+			return 0, errors.New(fmt.Sprintf("cron: value \"%s\" is out of range for %s field", part, b.name))
+		}
+
+		for v := lo; v <= hi; v += step {
+			set |= 1 << uint(v)
+		}
+	}
+
+	return set, nil
+}
+
+// Returns the first time after t that the schedule runs, at the start of a minute. The zero
+// time is returned if the schedule never runs, such as for the 30th of February.
+func (s *Schedule) Next(t time.Time) time.Time {
+	t = t.Truncate(time.Minute).Add(time.Minute)
+
+	for i := 0; i < maxSearchMinutes; i++ {
+		if s.month&(1<<uint(t.Month())) == 0 {
+			t = time.Date(t.Year(), t.Month()+1, 1, 0, 0, 0, 0, t.Location())
+			continue
+		}
+
+		if !s.matchesDay(t) {
+			t = time.Date(t.Year(), t.Month(), t.Day()+1, 0, 0, 0, 0, t.Location())
+			continue
+		}
+
+		if s.hour&(1<<uint(t.Hour())) == 0 {
+			t = time.Date(t.Year(), t.Month(), t.Day(), t.Hour()+1, 0, 0, 0, t.Location())
+			continue
+		}
+
+		if s.minute&(1<<uint(t.Minute())) == 0 {
+			t = t.Add(time.Minute)
+			continue
+		}
+
+		return t
+	}
+
+	return time.Time{}
+}
+
+// Determines if the schedule runs on the day of the given time.
+func (s *Schedule) matchesDay(t time.Time) bool {
+	dom := s.dom&(1<<uint(t.Day())) != 0
+	dow := s.dow&(1<<uint(t.Weekday())) != 0
+
+	if s.domRestricted && s.dowRestricted {
+		return dom || dow
+	}
+
+	return dom && dow
+}
@@ -0,0 +1,171 @@
+package server
+
+import (
+	"context"
+	"fmt"
+	"github.com/avatag-host/claws/system"
+	"github.com/pkg/errors"
+	"io"
+	"mime"
+	"net"
+	"net/http"
+	"net/url"
+	"path"
+	"syscall"
+	"time"
+)
+
+// The address ranges that files cannot be downloaded from. The URL is provided by the user,
+// so without this they could read cloud metadata endpoints, or services on the node and its
+// private network, by downloading them into the server directory.
+var blockedDownloadNetworks = func() []*net.IPNet {
+	var out []*net.IPNet
+	for _, cidr := range []string{
+		"0.0.0.0/8",
+		"10.0.0.0/8",
+		"100.64.0.0/10",
+		"127.0.0.0/8",
+		"169.254.0.0/16",
+		"172.16.0.0/12",
+		"192.168.0.0/16",
+		"::/128",
+		"::1/128",
+		"fc00::/7",
+		"fe80::/10",
+	} {
+		_, n, _ := net.ParseCIDR(cidr)
+		out = append(out, n)
+	}
+
+	return out
+}()
+
+var errBlockedDownloadAddress = errors.New("downloading files from local or private network addresses is not allowed")
+
+// Large files can take a long time to download, so only the time spent waiting for the
+// response headers is limited. Connections are checked once the host has been resolved, so
+// that a hostname or redirect pointing to a blocked address is refused as well. Proxies are
+// not used since the check would then apply to the proxy rather than the remote server.
+var downloadClient = &http.Client{
+	Transport: &http.Transport{
+		DialContext: (&net.Dialer{
+			Timeout: 30 * time.Second,
+			Control: checkDownloadAddress,
+		}).DialContext,
+		ResponseHeaderTimeout: time.Minute,
+	},
+}
+
+// Refuses connections to addresses that files cannot be downloaded from.
+func checkDownloadAddress(network string, address string, _ syscall.RawConn) error {
+	host, _, err := net.SplitHostPort(address)
+	if err != nil {
+		return errors.WithStack(err)
+	}
+
+	if isBlockedDownloadIp(net.ParseIP(host)) {
+		return errBlockedDownloadAddress
+	}
+
+	return nil
+}
+
+// Determines if the IP is a loopback, private, link-local or unspecified address.
+func isBlockedDownloadIp(ip net.IP) bool {
+	if ip == nil {
+		return true
+	}
+
+	if ip.IsLoopback() || ip.IsUnspecified() || ip.IsLinkLocalUnicast() || ip.IsLinkLocalMulticast() || ip.IsInterfaceLocalMulticast() {
+		return true
+	}
+
+	// IPv4 addresses mapped into IPv6 are checked as the IPv4 address they represent.
+	if v4 := ip.To4(); v4 != nil {
+		ip = v4
+	}
+
+	for _, n := range blockedDownloadNetworks {
+		if n.Contains(ip) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// Checks that the URL can be used to download a file from, which requires it to use http
+// or https.
+func validateDownloadUrl(u string) error {
+	parsed, err := url.Parse(u)
+	if err != nil || (parsed.Scheme != "http" && parsed.Scheme != "https") || parsed.Host == "" {
+		return errors.New("download URL must be a valid http or https URL")
+	}
+
+	return nil
+}
+
+// Starts downloading the file at the URL, returning the response once the remote server has
+// responded successfully. The caller must close the body of the response.
+func openDownload(ctx context.Context, u string) (*http.Response, error) {
+	req, err := http.NewRequest(http.MethodGet, u, nil)
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+	req = req.WithContext(ctx)
+	req.Header.Set("User-Agent", "claws/"+system.Version)
+
+	res, err := downloadClient.Do(req)
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+
+	if res.StatusCode != http.StatusOK {
+		res.Body.Close()
+
+		return nil, errors.New(fmt.Sprintf("failed to download file: unexpected status code %d", res.StatusCode))
+	}
+
+	return res, nil
+}
+
+// Returns the name of the file being downloaded, using the name suggested by the remote server
+// if there is one, otherwise the last element of the URL after any redirects.
+func downloadName(res *http.Response) string {
+	if _, params, err := mime.ParseMediaType(res.Header.Get("Content-Disposition")); err == nil {
+		if name := path.Base(params["filename"]); params["filename"] != "" && name != "/" && name != "." {
+			return name
+		}
+	}
+
+	if name := path.Base(res.Request.URL.Path); name != "/" && name != "." {
+		return name
+	}
+
+	return ""
+}
+
+// Reports the number of bytes read from the underlying reader, at most once a second since a
+// large file takes a while to download.
+type progressReader struct {
+	r    io.Reader
+	n    int64
+	last time.Time
+	fn   func(int64)
+}
+
+func newProgressReader(r io.Reader, fn func(int64)) *progressReader {
+	return &progressReader{r: r, fn: fn}
+}
+
+func (r *progressReader) Read(p []byte) (int, error) {
+	n, err := r.r.Read(p)
+	r.n += int64(n)
+
+	if time.Since(r.last) >= time.Second {
+		r.last = time.Now()
+		r.fn(r.n)
+	}
+
+	return n, err
+}
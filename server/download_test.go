@@ -0,0 +1,93 @@
+package server
+
+import (
+	"context"
+	. "github.com/franela/goblin"
+	"github.com/pkg/errors"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestDownload_BlockedAddresses(t *testing.T) {
+	g := Goblin(t)
+
+	g.Describe("isBlockedDownloadIp", func() {
+		g.It("blocks loopback, private, link-local and unspecified addresses", func() {
+			for _, ip := range []string{
+				"127.0.0.1",
+				"127.10.0.1",
+				"10.1.2.3",
+				"172.16.0.1",
+				"172.31.255.255",
+				"192.168.1.1",
+				"169.254.169.254",
+				"100.64.0.1",
+				"0.0.0.0",
+				"::",
+				"::1",
+				"fd00::1",
+				"fc00::1",
+				"fe80::1",
+				"::ffff:127.0.0.1",
+				"::ffff:169.254.169.254",
+			} {
+				g.Assert(isBlockedDownloadIp(net.ParseIP(ip))).IsTrue(ip)
+			}
+		})
+
+		g.It("allows public addresses", func() {
+			for _, ip := range []string{"1.1.1.1", "8.8.8.8", "172.32.0.1", "2606:4700:4700::1111"} {
+				g.Assert(isBlockedDownloadIp(net.ParseIP(ip))).IsFalse(ip)
+			}
+		})
+
+		g.It("blocks addresses that cannot be parsed", func() {
+			g.Assert(isBlockedDownloadIp(nil)).IsTrue()
+		})
+	})
+
+	g.Describe("openDownload", func() {
+		g.It("refuses to download from a loopback address", func() {
+			ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				w.Write([]byte("secret"))
+			}))
+			defer ts.Close()
+
+			_, err := openDownload(context.Background(), ts.URL)
+			g.Assert(err == nil).IsFalse()
+			g.Assert(strings.Contains(errors.Cause(err).Error(), errBlockedDownloadAddress.Error())).IsTrue()
+		})
+
+		g.It("refuses a hostname that resolves to a loopback address", func() {
+			ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				w.Write([]byte("secret"))
+			}))
+			defer ts.Close()
+
+			_, err := openDownload(context.Background(), strings.Replace(ts.URL, "127.0.0.1", "localhost", 1))
+			g.Assert(err == nil).IsFalse()
+			g.Assert(strings.Contains(errors.Cause(err).Error(), errBlockedDownloadAddress.Error())).IsTrue()
+		})
+	})
+}
+
+func TestImport_BlockedAddresses(t *testing.T) {
+	g := Goblin(t)
+
+	g.Describe("downloadImport", func() {
+		g.It("refuses to download an archive from a loopback address", func() {
+			ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				w.Write([]byte("secret"))
+			}))
+			defer ts.Close()
+
+			s := &Server{}
+			p, err := s.downloadImport(ts.URL + "/archive.tar.gz")
+			g.Assert(p).Equal("")
+			g.Assert(strings.Contains(errors.Cause(err).Error(), errBlockedDownloadAddress.Error())).IsTrue()
+		})
+	})
+}
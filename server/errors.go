@@ -4,6 +4,23 @@ import "github.com/pkg/errors"
 
 var ErrIsRunning = errors.New("server is running")
 var ErrSuspended = errors.New("server is currently in a suspended state")
+var ErrPaused = errors.New("server is currently paused while it is suspended")
+var ErrMaintenanceMode = errors.New("node is currently in maintenance mode")
+var ErrPowerActionCancelled = errors.New("power action was cancelled by a higher priority action")
+var ErrPowerActionStuck = errors.New("power action stopped responding and was cancelled by the watchdog")
+var ErrNoServerUsersAvailable = errors.New("no user IDs are available to allocate to the server")
+var ErrPowerActionInProgress = errors.New("a power action is currently being performed for the server")
+var ErrRebuildUnsupported = errors.New("environment does not support rebuilding server containers")
+var ErrPermissionsRepairInProgress = errors.New("the permissions for the server are already being repaired")
+var ErrInstallTimeout = errors.New("server installation process exceeded the configured timeout")
+var ErrConsoleRecordingInProgress = errors.New("the console for the server is already being recorded")
+var ErrHibernated = errors.New("server files are hibernated and must be restored first")
+var ErrNotHibernated = errors.New("server files are not hibernated")
+var ErrHibernationInProgress = errors.New("the server files are already being hibernated or restored")
+var ErrConsoleRecordingNotInProgress = errors.New("the console for the server is not being recorded")
+var ErrTooManyFilePulls = errors.New("the maximum number of files are already being pulled for the server")
+var ErrInstallUnsupported = errors.New("installation scripts are not supported by the environment")
+var ErrFilePullNotFound = errors.New("no file is being pulled for the server with that ID")
 
 type crashTooFrequent struct {
 }
@@ -30,3 +47,17 @@ func IsServerDoesNotExistError(err error) bool {
 
 	return ok
 }
+
+type reservationBreached struct {
+	message string
+}
+
+func (e *reservationBreached) Error() string {
+	return e.message
+}
+
+func IsReservationBreachedError(err error) bool {
+	_, ok := errors.Cause(err).(*reservationBreached)
+
+	return ok
+}
@@ -0,0 +1,58 @@
+package server
+
+import (
+	"github.com/avatag-host/claws/config"
+	"github.com/avatag-host/claws/events"
+	"github.com/avatag-host/claws/server/bridge"
+)
+
+var eventBridge *bridge.Bridge
+
+// The events for a server that can be published to the event bridge.
+var bridgeEvents = []string{
+	StatsEvent,
+	StatusEvent,
+	ConsoleOutputEvent,
+	InstallOutputEvent,
+	InstallStartedEvent,
+	InstallCompletedEvent,
+	DaemonMessageEvent,
+	BackupCompletedEvent,
+	OutOfMemoryEvent,
+	CrashReasonEvent,
+	ReservationBreachedEvent,
+	PowerActionStuckEvent,
+	PermissionsRepairEvent,
+	ImportEvent,
+	FilePullEvent,
+}
+
+// Starts publishing server events to the configured broker, if enabled. This must be called
+// before any servers are loaded so that their listeners are registered.
+func ConfigureEventBridge() {
+	cfg := config.Get().System.EventBridge
+	if !cfg.Enabled {
+		return
+	}
+
+	eventBridge = bridge.New(cfg, config.Get().Uuid)
+	go eventBridge.Run()
+}
+
+// Registers the listeners that publish the events for the server to the event bridge.
+func (s *Server) startEventBridge() {
+	if eventBridge == nil {
+		return
+	}
+
+	listener := func(e events.Event) {
+		eventBridge.Publish(s.Id(), e.Topic, e.Data, e.Sequence)
+	}
+
+	cfg := config.Get().System.EventBridge
+	for _, evt := range bridgeEvents {
+		if cfg.ShouldPublish(evt) {
+			s.Events().On(evt, &listener)
+		}
+	}
+}
@@ -1,7 +1,9 @@
 package server
 
 import (
+	"github.com/avatag-host/claws/config"
 	"github.com/avatag-host/claws/events"
+	"path/filepath"
 )
 
 // Defines all of the possible output events for a server.
@@ -15,8 +17,33 @@ const (
 	StatusEvent           = "status"
 	StatsEvent            = "stats"
 	BackupCompletedEvent  = "backup completed"
+	OutOfMemoryEvent      = "out of memory"
+	CrashReasonEvent      = "crash reason"
+
+	ReservationBreachedEvent = "reservation breached"
+	PowerActionStuckEvent    = "power action stuck"
+	PermissionsRepairEvent   = "permissions repair"
+	ImportEvent              = "import"
+	FilePullEvent            = "file pull"
 )
 
+// The events that are recorded in the journal for each server. High volume events such as
+// console output and resource usage are not recorded, since they can be fetched directly.
+var journalEvents = []string{
+	StatusEvent,
+	InstallStartedEvent,
+	InstallCompletedEvent,
+	DaemonMessageEvent,
+	BackupCompletedEvent,
+	OutOfMemoryEvent,
+	CrashReasonEvent,
+	ReservationBreachedEvent,
+	PowerActionStuckEvent,
+	PermissionsRepairEvent,
+	ImportEvent,
+	FilePullEvent,
+}
+
 // Returns the server's emitter instance.
 func (s *Server) Events() *events.EventBus {
 	s.emitterLock.Lock()
@@ -24,6 +51,15 @@ func (s *Server) Events() *events.EventBus {
 
 	if s.emitter == nil {
 		s.emitter = events.New()
+
+		if size := config.Get().System.EventRetention; size > 0 {
+			j := events.NewJournal(filepath.Join(config.Get().System.GetEventsPath(), s.Id()+".jsonl"), size)
+			if err := j.Load(); err != nil {
+				s.Log().WithField("error", err).Warn("failed to load event journal for server")
+			}
+
+			s.emitter.SetJournal(j, journalEvents...)
+		}
 	}
 
 	return s.emitter
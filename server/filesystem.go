@@ -17,8 +17,8 @@ func (s *Server) EnsureDataDirectoryExists() error {
 	} else if err != nil {
 		// Create the server data directory because it does not currently exist
 		// on the system.
-		if err := os.MkdirAll(s.fs.Path(), 0700); err != nil {
-			return errors.WithStack(err)
+		if err := s.fs.CreateRoot(); err != nil {
+			return err
 		}
 
 		if err := s.fs.Chown("/"); err != nil {
@@ -26,5 +26,9 @@ func (s *Server) EnsureDataDirectoryExists() error {
 		}
 	}
 
+	if err := s.fs.ApplyQuota(); err != nil {
+		s.Log().WithField("error", err).Warn("failed to set disk quota for server data directory")
+	}
+
 	return nil
 }
@@ -0,0 +1,212 @@
+package filesystem
+
+import (
+	"encoding/json"
+	"github.com/avatag-host/claws/config"
+	"github.com/karrick/godirwalk"
+	"github.com/pkg/errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"runtime"
+	"sync"
+)
+
+// The number of files that are waiting to be chowned before the walk over the directory
+// blocks until the workers catch up.
+const chownQueueSize = 1024
+
+var errChownStopped = errors.New("chown stopped due to an earlier error")
+
+// The directories found the last time the entire filesystem was chowned, along with their
+// modification time. A directory with the same modification time has not had any entries
+// added, removed or renamed within it, so the files directly inside of it do not need to
+// be chowned again when the owner is also unchanged.
+type chownManifest struct {
+	Uid         int              `json:"uid"`
+	Gid         int              `json:"gid"`
+	Directories map[string]int64 `json:"directories"`
+}
+
+// Returns the path to the manifest for the filesystem, which is kept outside of the server
+// data directory so that it cannot be modified by the server.
+func (fs *Filesystem) chownManifestPath() string {
+	return filepath.Join(config.Get().System.RootDirectory, "permissions", filepath.Base(fs.root)+".json")
+}
+
+// Returns the manifest from the last time the entire filesystem was chowned to the given
+// owner, or nil if there is not one.
+func (fs *Filesystem) readChownManifest(uid int, gid int) *chownManifest {
+	b, err := ioutil.ReadFile(fs.chownManifestPath())
+	if err != nil {
+		return nil
+	}
+
+	m := &chownManifest{}
+	if err := json.Unmarshal(b, m); err != nil || m.Uid != uid || m.Gid != gid {
+		return nil
+	}
+
+	return m
+}
+
+func (fs *Filesystem) writeChownManifest(m *chownManifest) error {
+	p := fs.chownManifestPath()
+	if err := os.MkdirAll(filepath.Dir(p), 0700); err != nil {
+		return errors.WithStack(err)
+	}
+
+	b, err := json.Marshal(m)
+	if err != nil {
+		return errors.WithStack(err)
+	}
+
+	return errors.WithStack(ioutil.WriteFile(p, b, 0600))
+}
+
+// Removes the manifest that is used to skip unchanged directories when chowning the
+// filesystem, causing every file to be chowned the next time. This should be called once
+// the files for a server have been removed.
+func (fs *Filesystem) RemoveChownManifest() error {
+	if err := os.Remove(fs.chownManifestPath()); err != nil && !os.IsNotExist(err) {
+		return errors.WithStack(err)
+	}
+
+	return nil
+}
+
+// Recursively iterates over a file or directory and sets the permissions on all of the
+// underlying files. Files are chowned by a pool of workers while the directory is walked,
+// since a server with a large number of files would otherwise spend minutes doing this on
+// every boot.
+//
+// When the entire filesystem is chowned, directories that have not changed since the last
+// time are skipped using a manifest of their modification times. The directories within
+// them are still walked, since changes deeper in the tree do not change the modification
+// time of their parents.
+func (fs *Filesystem) Chown(path string) error {
+	return fs.chown(nil, path)
+}
+
+// Chowns the file or directory, using the cache to resolve the path if one is provided.
+func (fs *Filesystem) chown(pc *pathCache, path string) error {
+	cleaned, err := fs.cachedSafePath(pc, path)
+	if err != nil {
+		return errors.WithStack(err)
+	}
+
+	if fs.isTest {
+		return nil
+	}
+
+	uid, gid := fs.owner()
+
+	// Start by just chowning the initial path that we received.
+	if err := os.Chown(cleaned, uid, gid); err != nil {
+		return errors.WithStack(err)
+	}
+
+	// If this is not a directory we can now return from the function, there is nothing
+	// left that we need to do.
+	if st, _ := os.Stat(cleaned); !st.IsDir() {
+		return nil
+	}
+
+	var previous, next *chownManifest
+	if root, err := fs.SafePath("/"); err == nil && root == cleaned {
+		previous = fs.readChownManifest(uid, gid)
+		next = &chownManifest{Uid: uid, Gid: gid, Directories: make(map[string]int64)}
+	}
+
+	// The directories that are unchanged since the last walk. This is only accessed by the
+	// walk itself, so it does not need to be guarded.
+	unchanged := make(map[string]bool)
+
+	work := make(chan string, chownQueueSize)
+	stopped := make(chan struct{})
+
+	var once sync.Once
+	var werr error
+	var wg sync.WaitGroup
+	for i := 0; i < runtime.NumCPU()*4; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+
+			for p := range work {
+				// Files can be removed by the server while the walk is running, which is
+				// not a problem.
+				if err := os.Chown(p, uid, gid); err != nil && !os.IsNotExist(err) {
+					once.Do(func() {
+						werr = errors.WithStack(err)
+						close(stopped)
+					})
+				}
+			}
+		}()
+	}
+
+	// If this was a directory, begin walking over its contents recursively and ensure that all
+	// of the subfiles and directories get their permissions updated as well.
+	err = godirwalk.Walk(cleaned, &godirwalk.Options{
+		Unsorted: true,
+		Callback: func(p string, e *godirwalk.Dirent) error {
+			// Do not attempt to chmod a symlink. Go's os.Chown function will affect the symlink
+			// so if it points to a location outside the data directory the user would be able to
+			// (un)intentionally modify that files permissions.
+			if e.IsSymlink() {
+				if e.IsDir() {
+					return godirwalk.SkipThis
+				}
+
+				return nil
+			}
+
+			if e.IsDir() && next != nil {
+				rel, _ := filepath.Rel(cleaned, p)
+
+				// The modification time is recorded before any files within the directory
+				// are chowned, so that anything created while the walk is running is picked
+				// up the next time.
+				if st, err := os.Lstat(p); err == nil {
+					mtime := st.ModTime().UnixNano()
+					next.Directories[rel] = mtime
+
+					if previous != nil && previous.Directories[rel] == mtime {
+						unchanged[p] = true
+					}
+				}
+			}
+
+			if unchanged[p] || unchanged[filepath.Dir(p)] {
+				return nil
+			}
+
+			select {
+			case work <- p:
+				return nil
+			case <-stopped:
+				return errChownStopped
+			}
+		},
+	})
+
+	close(work)
+	wg.Wait()
+
+	if werr != nil {
+		err = werr
+	}
+
+	if next != nil {
+		// If the walk failed the manifest can no longer be trusted, since some of the
+		// directories it contains were not chowned.
+		if err != nil {
+			fs.RemoveChownManifest()
+		} else if err := fs.writeChownManifest(next); err != nil {
+			return err
+		}
+	}
+
+	return errors.WithStack(err)
+}
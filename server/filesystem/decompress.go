@@ -7,6 +7,7 @@ import (
 	"fmt"
 	"github.com/mholt/archiver/v3"
 	"github.com/pkg/errors"
+	"io"
 	"os"
 	"path/filepath"
 	"reflect"
@@ -28,6 +29,17 @@ func (fs *Filesystem) SpaceAvailableForDecompression(dir string, file string) (b
 		return false, err
 	}
 
+	return fs.SpaceAvailableForArchive(source)
+}
+
+// Look through an archive at the given path, which does not need to be within the server data
+// directory, and determine if decompressing it would put the server over its allocated disk
+// space limit.
+func (fs *Filesystem) SpaceAvailableForArchive(source string) (bool, error) {
+	if fs.MaxDisk() <= 0 {
+		return true, nil
+	}
+
 	// Get the cached size in a parallel process so that if it is not cached we are not
 	// waiting an unnecessary amount of time on this call.
 	dirSize, err := fs.DiskUsage(false)
@@ -63,11 +75,41 @@ func (fs *Filesystem) DecompressFile(dir string, file string) error {
 		return errors.WithStack(err)
 	}
 
+	return fs.ExtractArchive(source, dir)
+}
+
+// Writes a file from an archive to the given path, limiting the data written using the limiter.
+// If the file turns out to be larger than the limits allow, the part that was written is
+// removed rather than being left behind.
+func (fs *Filesystem) extractFile(pc *pathCache, limiter *extractionLimiter, p string, r io.Reader) error {
+	err := fs.writefile(pc, p, limiter.reader(r))
+	if err != nil && limiter.err != nil {
+		if derr := fs.Delete(p); derr != nil {
+			fs.error(derr).WithField("file", p).Warn("failed to remove partially extracted file")
+		}
+	}
+
+	return err
+}
+
+// Extracts an archive at the given path, which does not need to be within the server data
+// directory, into a directory of the server. The same checks are performed as when an archive
+// within the server directory is decompressed.
+func (fs *Filesystem) ExtractArchive(source string, dir string) error {
 	// Make sure the file exists basically.
 	if _, err := os.Stat(source); err != nil {
 		return errors.WithStack(err)
 	}
 
+	// Archives usually contain lots of files within the same directories, so resolve each of
+	// them once rather than for every file.
+	pc := newPathCache()
+
+	limiter, err := fs.newExtractionLimiter()
+	if err != nil {
+		return errors.WithStack(err)
+	}
+
 	// Walk over all of the files spinning up an additional go-routine for each file we've encountered
 	// and then extract that file from the archive and write it to the disk. If any part of this process
 	// encounters an error the entire process will be stopped.
@@ -91,14 +133,24 @@ func (fs *Filesystem) DecompressFile(dir string, file string) error {
 			return errors.New(fmt.Sprintf("could not parse underlying data source with type %s", reflect.TypeOf(s).String()))
 		}
 
-		p, err := fs.SafePath(filepath.Join(dir, name))
+		// Check the limits before anything is written, so that an archive which expands to far
+		// more than it should is stopped as early as possible.
+		if err := limiter.add(name, f.Size()); err != nil {
+			return err
+		}
+
+		p, err := fs.cachedSafePath(pc, filepath.Join(dir, name))
 		if err != nil {
 			return errors.Wrap(err, "failed to generate a safe path to server file")
 		}
 
-		return errors.Wrap(fs.Writefile(p, f), "could not extract file from archive")
+		return errors.Wrap(fs.extractFile(pc, limiter, p, f), "could not extract file from archive")
 	})
 	if err != nil {
+		if limiter.err != nil {
+			return errors.WithStack(limiter.err)
+		}
+
 		if strings.HasPrefix(err.Error(), "format ") {
 			return errors.WithStack(ErrUnknownArchiveFormat)
 		}
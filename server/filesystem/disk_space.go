@@ -1,7 +1,11 @@
 package filesystem
 
 import (
+	"encoding/json"
 	"github.com/apex/log"
+	"github.com/avatag-host/claws/config"
+	"github.com/pkg/errors"
+	"io/ioutil"
 	"os"
 	"path/filepath"
 	"sync"
@@ -18,6 +22,38 @@ type usageLookupTime struct {
 	value time.Time
 }
 
+// The last calculated disk space for a filesystem, which is stored on the disk so that it can
+// be used when Wings is restarted rather than checking every server again.
+type diskUsageCache struct {
+	Size      int64     `json:"size"`
+	CheckedAt time.Time `json:"checked_at"`
+}
+
+// Limits the number of filesystems that are having their disk space calculated at once.
+var diskChecks struct {
+	once sync.Once
+	c    chan struct{}
+}
+
+// Blocks until another filesystem can have its disk space calculated, returning a function
+// that must be called once the calculation is complete.
+func acquireDiskCheck() func() {
+	diskChecks.once.Do(func() {
+		n := config.Get().System.DiskCheckConcurrency
+		if n < 1 {
+			n = 1
+		}
+
+		diskChecks.c = make(chan struct{}, n)
+	})
+
+	diskChecks.c <- struct{}{}
+
+	return func() {
+		<-diskChecks.c
+	}
+}
+
 // Update the last time that a disk space lookup was performed.
 func (ult *usageLookupTime) Set(t time.Time) {
 	ult.Lock()
@@ -33,6 +69,63 @@ func (ult *usageLookupTime) Get() time.Time {
 	return ult.value
 }
 
+// Returns the path to the file that the last calculated disk space for the filesystem is
+// stored in.
+func (fs *Filesystem) diskUsageCachePath() string {
+	return filepath.Join(config.Get().System.RootDirectory, "disk", filepath.Base(fs.root)+".json")
+}
+
+// Loads the last calculated disk space for the filesystem from the disk. The value is treated
+// as though it was calculated at the time it was stored, so a new calculation only happens
+// once it becomes stale.
+func (fs *Filesystem) loadDiskUsageCache() {
+	b, err := ioutil.ReadFile(fs.diskUsageCachePath())
+	if err != nil {
+		if !os.IsNotExist(err) {
+			log.WithField("root", fs.root).WithField("error", err).Warn("failed to read stored fs disk usage")
+		}
+		return
+	}
+
+	var c diskUsageCache
+	if err := json.Unmarshal(b, &c); err != nil {
+		log.WithField("root", fs.root).WithField("error", err).Warn("failed to parse stored fs disk usage")
+		return
+	}
+
+	// A time in the future would prevent the disk space from ever being calculated again.
+	if c.CheckedAt.After(time.Now()) {
+		return
+	}
+
+	atomic.StoreInt64(&fs.diskUsed, c.Size)
+	fs.lastLookupTime.Set(c.CheckedAt)
+}
+
+func (fs *Filesystem) writeDiskUsageCache(c diskUsageCache) error {
+	p := fs.diskUsageCachePath()
+	if err := os.MkdirAll(filepath.Dir(p), 0700); err != nil {
+		return errors.WithStack(err)
+	}
+
+	b, err := json.Marshal(c)
+	if err != nil {
+		return errors.WithStack(err)
+	}
+
+	return errors.WithStack(ioutil.WriteFile(p, b, 0600))
+}
+
+// Removes the stored disk space for the filesystem. This should be called once the files for
+// a server have been removed.
+func (fs *Filesystem) RemoveDiskUsageCache() error {
+	if err := os.Remove(fs.diskUsageCachePath()); err != nil && !os.IsNotExist(err) {
+		return errors.WithStack(err)
+	}
+
+	return nil
+}
+
 // Returns the maximum amount of disk space that this Filesystem instance is allowed to use.
 func (fs *Filesystem) MaxDisk() int64 {
 	fs.mu.RLock()
@@ -124,12 +217,21 @@ func (fs *Filesystem) updateCachedDiskUsage() (int64, error) {
 	fs.mu.Lock()
 	defer fs.mu.Unlock()
 
+	if fs.lastLookupTime.Get().After(time.Now().Add(time.Second * fs.diskCheckInterval * -1)) {
+		return atomic.LoadInt64(&fs.diskUsed), nil
+	}
+
 	// Signal that we're currently updating the disk size so that other calls to the disk checking
 	// functions can determine if they should queue up additional calls to this function. Ensure that
 	// we always set this back to "false" when this process is done executing.
 	fs.lookupInProgress.Set(true)
 	defer fs.lookupInProgress.Set(false)
 
+	// Only a limited number of servers are checked at once, since every server having its disk
+	// space checked at the same time, such as when Wings boots, can bring the disk to a halt.
+	release := acquireDiskCheck()
+	defer release()
+
 	// If there is no size its either because there is no data (in which case running this function
 	// will have effectively no impact), or there is nothing in the cache, in which case we need to
 	// grab the size of their data directory. This is a taxing operation, so we want to store it in
@@ -139,10 +241,17 @@ func (fs *Filesystem) updateCachedDiskUsage() (int64, error) {
 	// Always cache the size, even if there is an error. We want to always return that value
 	// so that we don't cause an endless loop of determining the disk size if there is a temporary
 	// error encountered.
-	fs.lastLookupTime.Set(time.Now())
+	now := time.Now()
+	fs.lastLookupTime.Set(now)
 
 	atomic.StoreInt64(&fs.diskUsed, size)
 
+	if err == nil && !fs.isTest {
+		if err := fs.writeDiskUsageCache(diskUsageCache{Size: size, CheckedAt: now}); err != nil {
+			log.WithField("root", fs.root).WithField("error", err).Warn("failed to store fs disk usage on disk")
+		}
+	}
+
 	return size, err
 }
 
@@ -150,13 +259,25 @@ func (fs *Filesystem) updateCachedDiskUsage() (int64, error) {
 // through all of the folders. Returns the size in bytes. This can be a fairly taxing operation
 // on locations with tons of files, so it is recommended that you cache the output.
 func (fs *Filesystem) DirectorySize(dir string) (int64, error) {
+	cleaned, err := fs.SafePath(dir)
+	if err != nil {
+		return 0, err
+	}
+
+	blocks := config.Get().System.DiskCheckBlockUsage
+	links := make(map[fileId]bool)
+
 	var size int64
-	err := filepath.Walk(dir, func(_ string, info os.FileInfo, err error) error {
+	err = filepath.Walk(cleaned, func(_ string, info os.FileInfo, err error) error {
 		if err != nil {
 			return err
 		}
 		if !info.IsDir() {
-			size += info.Size()
+			if blocks {
+				size += diskUsageOf(info, links)
+			} else {
+				size += info.Size()
+			}
 		}
 		return err
 	})
@@ -0,0 +1,36 @@
+// +build !windows
+
+package filesystem
+
+import (
+	"os"
+	"syscall"
+)
+
+// Identifies a file on the system by its device and inode number.
+type fileId struct {
+	dev uint64
+	ino uint64
+}
+
+// Returns the space allocated on the disk for the file. Files with more than one hard link are
+// only counted the first time they are seen, so the links map must be shared between calls
+// for the same directory.
+func diskUsageOf(info os.FileInfo, links map[fileId]bool) int64 {
+	st, ok := info.Sys().(*syscall.Stat_t)
+	if !ok {
+		return info.Size()
+	}
+
+	if uint64(st.Nlink) > 1 {
+		id := fileId{dev: uint64(st.Dev), ino: uint64(st.Ino)}
+		if links[id] {
+			return 0
+		}
+		links[id] = true
+	}
+
+	// The number of blocks is always in 512 byte units, regardless of the block size of the
+	// filesystem.
+	return int64(st.Blocks) * 512
+}
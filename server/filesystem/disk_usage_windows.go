@@ -0,0 +1,13 @@
+package filesystem
+
+import (
+	"os"
+)
+
+type fileId struct{}
+
+// Windows does not expose the allocated size of a file in the same way, so the size of the
+// file is used.
+func diskUsageOf(info os.FileInfo, links map[fileId]bool) int64 {
+	return info.Size()
+}
@@ -1,6 +1,7 @@
 package filesystem
 
 import (
+	"fmt"
 	"github.com/apex/log"
 	"github.com/pkg/errors"
 	"os"
@@ -11,6 +12,36 @@ var ErrIsDirectory = errors.New("filesystem: is a directory")
 var ErrNotEnoughDiskSpace = errors.New("filesystem: not enough disk space")
 var ErrBadPathResolution = errors.New("filesystem: invalid path resolution")
 var ErrUnknownArchiveFormat = errors.New("filesystem: unknown archive format")
+var ErrQuotaUnsupported = errors.New("filesystem: disk quotas are not supported on this system")
+var ErrNoQuotaProjectsAvailable = errors.New("filesystem: no quota project IDs are available")
+var ErrFileTooLarge = errors.New("filesystem: file is too large to be edited")
+var ErrNotTextFile = errors.New("filesystem: file is not a text file")
+var ErrUnsupportedEncoding = errors.New("filesystem: unsupported text encoding")
+var ErrUnsupportedNewline = errors.New("filesystem: unsupported line ending")
+var ErrUnencodableText = errors.New("filesystem: text cannot be represented in the file encoding")
+var ErrNotImage = errors.New("filesystem: file is not a supported image")
+var ErrImageTooLarge = errors.New("filesystem: image is too large to preview")
+var ErrPreviewBusy = errors.New("filesystem: too many images are being previewed")
+
+// Returned when extracting an archive would exceed one of the configured extraction limits.
+type ExtractionLimitError struct {
+	// The limit that was exceeded, either "size", "files" or "depth".
+	Limit string
+
+	// The maximum value allowed for the limit.
+	Max int64
+}
+
+func (e *ExtractionLimitError) Error() string {
+	return fmt.Sprintf("filesystem: archive exceeds the extraction %s limit of %d", e.Limit, e.Max)
+}
+
+// Determines if the error is because an archive exceeded one of the extraction limits.
+func IsExtractionLimitError(err error) bool {
+	var e *ExtractionLimitError
+
+	return errors.As(err, &e)
+}
 
 // Generates an error logger instance with some basic information.
 func (fs *Filesystem) error(err error) *log.Entry {
@@ -0,0 +1,114 @@
+package filesystem
+
+import (
+	"github.com/avatag-host/claws/config"
+	"io"
+	"strings"
+)
+
+// Tracks the files extracted from an archive against the configured extraction limits.
+type extractionLimiter struct {
+	files    int64
+	maxFiles int64
+	maxDepth int
+
+	// The number of bytes that can still be extracted, or -1 if there is no limit. When the
+	// disk space remaining for the server is less than the configured maximum size, running out
+	// is reported as the server not having enough disk space.
+	remaining int64
+	maxSize   int64
+	diskBound bool
+
+	// The limit that was exceeded, which is kept since the archiver does not preserve the
+	// errors returned while walking an archive.
+	err error
+}
+
+// Returns a limiter for extracting an archive into the filesystem. The size of the archive is
+// limited to the smaller of the configured maximum size and the disk space remaining for the
+// server.
+func (fs *Filesystem) newExtractionLimiter() (*extractionLimiter, error) {
+	cfg := config.Get().System.Extraction
+
+	l := &extractionLimiter{maxFiles: cfg.MaxFiles, maxDepth: cfg.MaxDepth, remaining: -1}
+	if cfg.MaxSize > 0 {
+		l.remaining = cfg.MaxSize * 1024 * 1024
+	}
+
+	if fs.MaxDisk() > 0 {
+		used, err := fs.DiskUsage(false)
+		if err != nil {
+			return nil, err
+		}
+
+		if free := fs.MaxDisk() - used; l.remaining < 0 || free < l.remaining {
+			l.remaining, l.diskBound = free, true
+			if l.remaining < 0 {
+				l.remaining = 0
+			}
+		}
+	}
+	l.maxSize = l.remaining
+
+	return l, nil
+}
+
+// Checks that a file with the given name and size can be extracted. The size is the size the
+// archive claims the file to be, which is not trusted, so the data read for the file is also
+// limited by the reader returned from the limiter.
+func (l *extractionLimiter) add(name string, size int64) error {
+	l.files++
+	if l.maxFiles > 0 && l.files > l.maxFiles {
+		return l.fail(&ExtractionLimitError{Limit: "files", Max: l.maxFiles})
+	}
+
+	if l.maxDepth > 0 && len(strings.Split(strings.Trim(name, "/"), "/")) > l.maxDepth {
+		return l.fail(&ExtractionLimitError{Limit: "depth", Max: int64(l.maxDepth)})
+	}
+
+	if l.remaining >= 0 && size > l.remaining {
+		return l.fail(l.sizeError())
+	}
+
+	return nil
+}
+
+func (l *extractionLimiter) fail(err error) error {
+	l.err = err
+
+	return err
+}
+
+func (l *extractionLimiter) sizeError() error {
+	if l.diskBound {
+		return ErrNotEnoughDiskSpace
+	}
+
+	return &ExtractionLimitError{Limit: "size", Max: l.maxSize}
+}
+
+// Returns a reader for the contents of a file that fails once more data has been read from
+// the archive than the limit allows.
+func (l *extractionLimiter) reader(r io.Reader) io.Reader {
+	if l.remaining < 0 {
+		return r
+	}
+
+	return &extractionReader{r: r, l: l}
+}
+
+type extractionReader struct {
+	r io.Reader
+	l *extractionLimiter
+}
+
+func (er *extractionReader) Read(p []byte) (int, error) {
+	n, err := er.r.Read(p)
+
+	er.l.remaining -= int64(n)
+	if er.l.remaining < 0 {
+		return n, er.l.fail(er.l.sizeError())
+	}
+
+	return n, err
+}
@@ -3,7 +3,6 @@ package filesystem
 import (
 	"bufio"
 	"github.com/gabriel-vasile/mimetype"
-	"github.com/karrick/godirwalk"
 	"github.com/pkg/errors"
 	"github.com/avatag-host/claws/config"
 	"github.com/avatag-host/claws/system"
@@ -32,17 +31,53 @@ type Filesystem struct {
 	// The root data directory path for this Filesystem instance.
 	root string
 
+	// The user and group that the server process runs as when the server has its own user,
+	// which is used in place of the system user when setting the owner of files.
+	uid      int
+	gid      int
+	hasOwner bool
+
+	// The disk limit that was last set as the quota for the filesystem, when disk quotas are
+	// enabled.
+	quotaMu      sync.Mutex
+	quotaApplied bool
+	quotaLimit   int64
+
 	isTest bool
 }
 
 // Creates a new Filesystem instance for a given server.
 func New(root string, size int64) *Filesystem {
-	return &Filesystem{
+	fs := &Filesystem{
 		root:              root,
 		diskLimit:         size,
 		diskCheckInterval: time.Duration(config.Get().System.DiskCheckInterval),
 		lastLookupTime:    &usageLookupTime{},
 	}
+
+	fs.loadDiskUsageCache()
+
+	return fs
+}
+
+// Sets the user and group that the server process runs as, so that files are owned by that
+// user rather than the system user.
+func (fs *Filesystem) SetOwner(uid int, gid int) {
+	fs.mu.Lock()
+	fs.uid, fs.gid, fs.hasOwner = uid, gid, true
+	fs.mu.Unlock()
+}
+
+// Returns the user and group ID on the host that should own the files in the filesystem.
+func (fs *Filesystem) owner() (int, int) {
+	fs.mu.RLock()
+	defer fs.mu.RUnlock()
+
+	if fs.hasOwner {
+		return config.Get().System.FileOwnerFor(fs.uid, fs.gid)
+	}
+
+	return config.Get().System.FileOwner()
 }
 
 // Returns the root path for the Filesystem instance.
@@ -50,9 +85,9 @@ func (fs *Filesystem) Path() string {
 	return fs.root
 }
 
-// Reads a file on the system and returns it as a byte representation in a file
-// reader. This is not the most memory efficient usage since it will be reading the
-// entirety of the file into memory.
+// Reads a file on the system and writes it to the writer. If the writer is able to read from
+// the file directly, such as a response that can use sendfile, the file is not copied through
+// memory at all.
 func (fs *Filesystem) Readfile(p string, w io.Writer) error {
 	cleaned, err := fs.SafePath(p)
 	if err != nil {
@@ -71,14 +106,20 @@ func (fs *Filesystem) Readfile(p string, w io.Writer) error {
 	}
 	defer f.Close()
 
-	_, err = bufio.NewReader(f).WriteTo(w)
+	_, err = io.Copy(w, f)
 
 	return err
 }
 
 // Writes a file to the system. If the file does not already exist one will be created.
 func (fs *Filesystem) Writefile(p string, r io.Reader) error {
-	cleaned, err := fs.SafePath(p)
+	return fs.writefile(nil, p, r)
+}
+
+// Writes a file to the system, using the cache to resolve the paths to the file if one is
+// provided.
+func (fs *Filesystem) writefile(pc *pathCache, p string, r io.Reader) error {
+	cleaned, err := fs.cachedSafePath(pc, p)
 	if err != nil {
 		return errors.WithStack(err)
 	}
@@ -95,7 +136,7 @@ func (fs *Filesystem) Writefile(p string, r io.Reader) error {
 			return errors.WithStack(err)
 		}
 
-		if err := fs.Chown(filepath.Dir(cleaned)); err != nil {
+		if err := fs.chown(pc, filepath.Dir(cleaned)); err != nil {
 			return errors.WithStack(err)
 		}
 	} else {
@@ -129,9 +170,13 @@ func (fs *Filesystem) Writefile(p string, r io.Reader) error {
 	// Adjust the disk usage to account for the old size and the new size of the file.
 	fs.addDisk(sz - currentSize)
 
+	if err != nil {
+		return errors.WithStack(err)
+	}
+
 	// Finally, chown the file to ensure the permissions don't end up out-of-whack
 	// if we had just created it.
-	return fs.Chown(cleaned)
+	return fs.chown(pc, cleaned)
 }
 
 // Creates a new directory (name) at a specified path (p) for the server.
@@ -178,55 +223,6 @@ func (fs *Filesystem) Rename(from string, to string) error {
 	return os.Rename(cleanedFrom, cleanedTo)
 }
 
-// Recursively iterates over a file or directory and sets the permissions on all of the
-// underlying files. Iterate over all of the files and directories. If it is a file just
-// go ahead and perform the chown operation. Otherwise dig deeper into the directory until
-// we've run out of directories to dig into.
-func (fs *Filesystem) Chown(path string) error {
-	cleaned, err := fs.SafePath(path)
-	if err != nil {
-		return errors.WithStack(err)
-	}
-
-	if fs.isTest {
-		return nil
-	}
-
-	uid := config.Get().System.User.Uid
-	gid := config.Get().System.User.Gid
-
-	// Start by just chowning the initial path that we received.
-	if err := os.Chown(cleaned, uid, gid); err != nil {
-		return errors.WithStack(err)
-	}
-
-	// If this is not a directory we can now return from the function, there is nothing
-	// left that we need to do.
-	if st, _ := os.Stat(cleaned); !st.IsDir() {
-		return nil
-	}
-
-	// If this was a directory, begin walking over its contents recursively and ensure that all
-	// of the subfiles and directories get their permissions updated as well.
-	return godirwalk.Walk(cleaned, &godirwalk.Options{
-		Unsorted: true,
-		Callback: func(p string, e *godirwalk.Dirent) error {
-			// Do not attempt to chmod a symlink. Go's os.Chown function will affect the symlink
-			// so if it points to a location outside the data directory the user would be able to
-			// (un)intentionally modify that files permissions.
-			if e.IsSymlink() {
-				if e.IsDir() {
-					return godirwalk.SkipThis
-				}
-
-				return nil
-			}
-
-			return os.Chown(p, uid, gid)
-		},
-	})
-}
-
 // Begin looping up to 50 times to try and create a unique copy file name. This will take
 // an input of "file.txt" and generate "file copy.txt". If that name is already taken, it will
 // then try to write "file copy 2.txt" and so on, until reaching 50 loops. At that point we
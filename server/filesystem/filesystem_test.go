@@ -1,6 +1,7 @@
 package filesystem
 
 import (
+	"archive/zip"
 	"bytes"
 	"errors"
 	. "github.com/franela/goblin"
@@ -9,6 +10,7 @@ import (
 	"math/rand"
 	"os"
 	"path/filepath"
+	"strings"
 	"sync/atomic"
 	"testing"
 	"unicode/utf8"
@@ -155,6 +157,268 @@ func TestFilesystem_SafePath(t *testing.T) {
 	})
 }
 
+func TestFilesystem_CachedSafePath(t *testing.T) {
+	g := Goblin(t)
+	fs, rfs := NewFs()
+	prefix := filepath.Join(rfs.root, "/server")
+
+	if err := os.MkdirAll(filepath.Join(rfs.root, "/malicious_dir"), 0777); err != nil {
+		panic(err)
+	}
+
+	g.Describe("cachedSafePath", func() {
+		g.BeforeEach(func() {
+			rfs.reset()
+		})
+
+		g.It("returns the same path as SafePath", func() {
+			err := os.Mkdir(filepath.Join(prefix, "foo"), 0755)
+			g.Assert(err).IsNil()
+
+			pc := newPathCache()
+			for i := 0; i < 2; i++ {
+				p, err := fs.cachedSafePath(pc, "/foo/test.txt")
+				g.Assert(err).IsNil()
+				g.Assert(p).Equal(prefix + "/foo/test.txt")
+			}
+
+			p, err := fs.cachedSafePath(pc, "/bar/baz/test.txt")
+			g.Assert(err).IsNil()
+			g.Assert(p).Equal(prefix + "/bar/baz/test.txt")
+		})
+
+		g.It("works the same as SafePath without a cache", func() {
+			p, err := fs.cachedSafePath(nil, "/foo/../test.txt")
+			g.Assert(err).IsNil()
+			g.Assert(p).Equal(prefix + "/test.txt")
+
+			_, err = fs.cachedSafePath(nil, "../test.txt")
+			g.Assert(errors.Is(err, ErrBadPathResolution)).IsTrue()
+		})
+
+		g.It("blocks access to files outside the root directory", func() {
+			pc := newPathCache()
+
+			for _, p := range []string{"../test.txt", "/../test.txt", "./foo/../../test.txt", "..", "/../malicious_dir/test.txt"} {
+				r, err := fs.cachedSafePath(pc, p)
+				g.Assert(errors.Is(err, ErrBadPathResolution)).IsTrue()
+				g.Assert(r).Equal("")
+			}
+		})
+
+		g.It("blocks a cached directory that is replaced with a symlink outside the root", func() {
+			err := os.Mkdir(filepath.Join(prefix, "foo"), 0755)
+			g.Assert(err).IsNil()
+
+			pc := newPathCache()
+			_, err = fs.cachedSafePath(pc, "/foo/test.txt")
+			g.Assert(err).IsNil()
+
+			err = os.Remove(filepath.Join(prefix, "foo"))
+			g.Assert(err).IsNil()
+			err = os.Symlink(filepath.Join(rfs.root, "/malicious_dir"), filepath.Join(prefix, "foo"))
+			g.Assert(err).IsNil()
+
+			p, err := fs.cachedSafePath(pc, "/foo/test.txt")
+			g.Assert(errors.Is(err, ErrBadPathResolution)).IsTrue()
+			g.Assert(p).Equal("")
+		})
+
+		g.It("blocks a cached directory whose parent is replaced with a symlink outside the root", func() {
+			err := os.MkdirAll(filepath.Join(prefix, "foo/bar"), 0755)
+			g.Assert(err).IsNil()
+			err = os.MkdirAll(filepath.Join(rfs.root, "/malicious_dir/bar"), 0755)
+			g.Assert(err).IsNil()
+
+			pc := newPathCache()
+			_, err = fs.cachedSafePath(pc, "/foo/bar/test.txt")
+			g.Assert(err).IsNil()
+
+			err = os.RemoveAll(filepath.Join(prefix, "foo"))
+			g.Assert(err).IsNil()
+			err = os.Symlink(filepath.Join(rfs.root, "/malicious_dir"), filepath.Join(prefix, "foo"))
+			g.Assert(err).IsNil()
+
+			p, err := fs.cachedSafePath(pc, "/foo/bar/test.txt")
+			g.Assert(errors.Is(err, ErrBadPathResolution)).IsTrue()
+			g.Assert(p).Equal("")
+		})
+
+		g.It("blocks a file that is symlinked outside the root", func() {
+			err := os.Mkdir(filepath.Join(prefix, "foo"), 0755)
+			g.Assert(err).IsNil()
+			err = ioutil.WriteFile(filepath.Join(rfs.root, "/malicious_dir/test.txt"), []byte("external content"), 0644)
+			g.Assert(err).IsNil()
+			err = os.Symlink(filepath.Join(rfs.root, "/malicious_dir/test.txt"), filepath.Join(prefix, "foo/test.txt"))
+			g.Assert(err).IsNil()
+
+			pc := newPathCache()
+			_, err = fs.cachedSafePath(pc, "/foo/other.txt")
+			g.Assert(err).IsNil()
+
+			p, err := fs.cachedSafePath(pc, "/foo/test.txt")
+			g.Assert(errors.Is(err, ErrBadPathResolution)).IsTrue()
+			g.Assert(p).Equal("")
+		})
+
+		g.It("resolves a file that is symlinked within the root", func() {
+			err := rfs.CreateServerFile("target.txt", "content")
+			g.Assert(err).IsNil()
+			err = os.Symlink(filepath.Join(prefix, "target.txt"), filepath.Join(prefix, "link.txt"))
+			g.Assert(err).IsNil()
+
+			p, err := fs.cachedSafePath(newPathCache(), "/link.txt")
+			g.Assert(err).IsNil()
+			g.Assert(p).Equal(prefix + "/target.txt")
+		})
+	})
+}
+
+// Writes a zip archive containing the given files, in order, to the path.
+func writeTestZip(p string, names []string, contents []string) error {
+	f, err := os.Create(p)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	w := zip.NewWriter(f)
+	for i, name := range names {
+		fw, err := w.Create(name)
+		if err != nil {
+			return err
+		}
+
+		if _, err := fw.Write([]byte(contents[i])); err != nil {
+			return err
+		}
+	}
+
+	return w.Close()
+}
+
+func TestFilesystem_ExtractArchive(t *testing.T) {
+	g := Goblin(t)
+	fs, rfs := NewFs()
+	archive := filepath.Join(rfs.root, "archive.zip")
+
+	g.Describe("ExtractArchive", func() {
+		g.It("extracts an archive within the limits", func() {
+			config.Get().System.Extraction = config.ExtractionConfiguration{MaxSize: 1, MaxFiles: 2, MaxDepth: 2}
+
+			err := writeTestZip(archive, []string{"foo.txt", "bar/baz.txt"}, []string{"foo", "baz"})
+			g.Assert(err).IsNil()
+
+			err = fs.ExtractArchive(archive, "/")
+			g.Assert(err).IsNil()
+
+			b, err := ioutil.ReadFile(filepath.Join(rfs.root, "/server/bar/baz.txt"))
+			g.Assert(err).IsNil()
+			g.Assert(string(b)).Equal("baz")
+		})
+
+		g.It("returns an error if the archive has too many files", func() {
+			config.Get().System.Extraction = config.ExtractionConfiguration{MaxFiles: 2}
+
+			err := writeTestZip(archive, []string{"a.txt", "b.txt", "c.txt"}, []string{"a", "b", "c"})
+			g.Assert(err).IsNil()
+
+			err = fs.ExtractArchive(archive, "/")
+			var le *ExtractionLimitError
+			g.Assert(errors.As(err, &le)).IsTrue()
+			g.Assert(le.Limit).Equal("files")
+
+			_, err = rfs.StatServerFile("c.txt")
+			g.Assert(errors.Is(err, os.ErrNotExist)).IsTrue()
+		})
+
+		g.It("returns an error if the archive is nested too deeply", func() {
+			config.Get().System.Extraction = config.ExtractionConfiguration{MaxDepth: 2}
+
+			err := writeTestZip(archive, []string{"a/b.txt", "a/b/c.txt"}, []string{"b", "c"})
+			g.Assert(err).IsNil()
+
+			err = fs.ExtractArchive(archive, "/")
+			var le *ExtractionLimitError
+			g.Assert(errors.As(err, &le)).IsTrue()
+			g.Assert(le.Limit).Equal("depth")
+
+			_, err = rfs.StatServerFile("a/b/c.txt")
+			g.Assert(errors.Is(err, os.ErrNotExist)).IsTrue()
+		})
+
+		g.It("returns an error if the files in the archive are too large", func() {
+			config.Get().System.Extraction = config.ExtractionConfiguration{MaxSize: 1}
+
+			err := writeTestZip(archive, []string{"small.txt", "large.txt"}, []string{"small", strings.Repeat("a", 1024*1024)})
+			g.Assert(err).IsNil()
+
+			err = fs.ExtractArchive(archive, "/")
+			var le *ExtractionLimitError
+			g.Assert(errors.As(err, &le)).IsTrue()
+			g.Assert(le.Limit).Equal("size")
+			g.Assert(le.Max).Equal(int64(1024 * 1024))
+
+			_, err = rfs.StatServerFile("large.txt")
+			g.Assert(errors.Is(err, os.ErrNotExist)).IsTrue()
+		})
+
+		g.AfterEach(func() {
+			config.Get().System.Extraction = config.ExtractionConfiguration{}
+			os.Remove(archive)
+			rfs.reset()
+
+			atomic.StoreInt64(&fs.diskUsed, 0)
+			atomic.StoreInt64(&fs.diskLimit, 0)
+		})
+	})
+
+	g.Describe("extractFile", func() {
+		g.It("writes a file within the limits", func() {
+			l := &extractionLimiter{remaining: 10, maxSize: 10}
+			g.Assert(l.add("test.txt", 5)).IsNil()
+
+			err := fs.extractFile(nil, l, "test.txt", strings.NewReader("hello"))
+			g.Assert(err).IsNil()
+
+			b, err := ioutil.ReadFile(filepath.Join(rfs.root, "/server/test.txt"))
+			g.Assert(err).IsNil()
+			g.Assert(string(b)).Equal("hello")
+		})
+
+		g.It("removes a file that is larger than the size it was declared as", func() {
+			l := &extractionLimiter{remaining: 10, maxSize: 10}
+			g.Assert(l.add("test.txt", 5)).IsNil()
+
+			err := fs.extractFile(nil, l, "test.txt", strings.NewReader(strings.Repeat("a", 100)))
+			var le *ExtractionLimitError
+			g.Assert(errors.As(err, &le)).IsTrue()
+			g.Assert(le.Limit).Equal("size")
+
+			_, err = rfs.StatServerFile("test.txt")
+			g.Assert(errors.Is(err, os.ErrNotExist)).IsTrue()
+			g.Assert(atomic.LoadInt64(&fs.diskUsed)).Equal(int64(0))
+		})
+
+		g.It("reports running out of disk space when the disk is the limit", func() {
+			l := &extractionLimiter{remaining: 10, maxSize: 10, diskBound: true}
+			g.Assert(l.add("test.txt", 5)).IsNil()
+
+			err := fs.extractFile(nil, l, "test.txt", strings.NewReader(strings.Repeat("a", 100)))
+			g.Assert(errors.Is(err, ErrNotEnoughDiskSpace)).IsTrue()
+
+			_, err = rfs.StatServerFile("test.txt")
+			g.Assert(errors.Is(err, os.ErrNotExist)).IsTrue()
+		})
+
+		g.AfterEach(func() {
+			rfs.reset()
+
+			atomic.StoreInt64(&fs.diskUsed, 0)
+		})
+	})
+}
+
 // We test against accessing files outside the root directory in the tests, however it
 // is still possible for someone to mess up and not properly use this safe path call. In
 // order to truly confirm this, we'll try to pass in a symlinked malicious file to all of
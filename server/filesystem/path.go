@@ -73,6 +73,103 @@ func (fs *Filesystem) SafePath(p string) (string, error) {
 	return "", ErrBadPathResolution
 }
 
+// A cache of the directories that have been resolved by SafePath during a single bulk operation,
+// such as extracting an archive, so that the same directories are not resolved again for every
+// file within them. A cache should not be kept once the operation is complete.
+type pathCache struct {
+	mu   sync.RWMutex
+	dirs map[string]cachedDirectory
+}
+
+// A directory that has been resolved and confirmed to be within the data directory, along with
+// the information for the directory when it was resolved.
+type cachedDirectory struct {
+	resolved string
+	info     os.FileInfo
+}
+
+func newPathCache() *pathCache {
+	return &pathCache{dirs: make(map[string]cachedDirectory)}
+}
+
+// Returns the resolved path of the directory if it is in the cache and is still the same
+// directory. A directory, or one of its parents, could have been replaced with a symlink by
+// the server since it was resolved, in which case it is removed from the cache. The symlink
+// can be given the inode of the directory it replaced, so the type is checked as well.
+func (pc *pathCache) get(dir string) (string, bool) {
+	pc.mu.RLock()
+	d, ok := pc.dirs[dir]
+	pc.mu.RUnlock()
+
+	if !ok {
+		return "", false
+	}
+
+	if st, err := os.Lstat(d.resolved); err != nil || !st.IsDir() || !os.SameFile(st, d.info) {
+		pc.mu.Lock()
+		delete(pc.dirs, dir)
+		pc.mu.Unlock()
+
+		return "", false
+	}
+
+	return d.resolved, true
+}
+
+func (pc *pathCache) put(dir string, resolved string, info os.FileInfo) {
+	pc.mu.Lock()
+	pc.dirs[dir] = cachedDirectory{resolved: resolved, info: info}
+	pc.mu.Unlock()
+}
+
+// Works the same as SafePath, but uses the cache to avoid resolving the directory that the
+// path is within if it has already been resolved. If the cache is nil this is the same as
+// calling SafePath.
+func (fs *Filesystem) cachedSafePath(pc *pathCache, p string) (string, error) {
+	if pc == nil {
+		return fs.SafePath(p)
+	}
+
+	r := fs.unsafeFilePath(p)
+	dir := filepath.Dir(r)
+	if r == fs.Path() || !fs.unsafeIsInDataDirectory(dir) {
+		return fs.SafePath(p)
+	}
+
+	resolved, ok := pc.get(dir)
+	if !ok {
+		// Directories that do not exist yet are not cached, and are left to SafePath to work
+		// out.
+		d, err := filepath.EvalSymlinks(dir)
+		if err != nil {
+			return fs.SafePath(p)
+		}
+
+		if !fs.unsafeIsInDataDirectory(d) {
+			return "", ErrBadPathResolution
+		}
+
+		st, err := os.Lstat(d)
+		if err != nil {
+			return fs.SafePath(p)
+		}
+
+		pc.put(dir, d, st)
+		resolved = d
+	}
+
+	target := filepath.Join(resolved, filepath.Base(r))
+
+	// The last part of the path still needs to be checked, since it could be a symlink.
+	if st, err := os.Lstat(target); err != nil && !os.IsNotExist(err) {
+		return "", err
+	} else if err == nil && st.Mode()&os.ModeSymlink != 0 {
+		return fs.SafePath(target)
+	}
+
+	return target, nil
+}
+
 // Generate a path to the file by cleaning it up and appending the root server path to it. This
 // DOES NOT guarantee that the file resolves within the server data directory. You'll want to use
 // the fs.unsafeIsInDataDirectory(p) function to confirm.
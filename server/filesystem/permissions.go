@@ -0,0 +1,68 @@
+package filesystem
+
+import (
+	"github.com/karrick/godirwalk"
+	"github.com/pkg/errors"
+	"os"
+)
+
+// The number of files between each call to the progress function while repairing permissions.
+const permissionsProgressInterval = 1000
+
+// Sets the owner of every file and directory in the filesystem, and ensures that the owner is
+// able to read and write all of them, and list the contents of directories. This fixes the
+// "permission denied" errors caused by installers that create files as another user or with
+// unusual permissions. The progress function, if provided, is called periodically with the
+// number of files processed so far, and the total number of files is returned.
+func (fs *Filesystem) RepairPermissions(progress func(files int64)) (int64, error) {
+	if fs.isTest {
+		return 0, nil
+	}
+
+	uid, gid := fs.owner()
+
+	var files int64
+	err := godirwalk.Walk(fs.Path(), &godirwalk.Options{
+		Unsorted: true,
+		Callback: func(p string, e *godirwalk.Dirent) error {
+			// Symlinks are skipped for the same reason as in Chown, they could point to a
+			// location outside of the data directory.
+			if e.IsSymlink() {
+				if e.IsDir() {
+					return godirwalk.SkipThis
+				}
+
+				return nil
+			}
+
+			st, err := os.Lstat(p)
+			if err != nil {
+				return errors.WithStack(err)
+			}
+
+			if err := os.Chown(p, uid, gid); err != nil {
+				return errors.WithStack(err)
+			}
+
+			mode := st.Mode().Perm() | 0600
+			if st.IsDir() {
+				mode |= 0100
+			}
+
+			if mode != st.Mode().Perm() {
+				if err := os.Chmod(p, mode); err != nil {
+					return errors.WithStack(err)
+				}
+			}
+
+			files++
+			if progress != nil && files%permissionsProgressInterval == 0 {
+				progress(files)
+			}
+
+			return nil
+		},
+	})
+
+	return files, err
+}
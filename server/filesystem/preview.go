@@ -0,0 +1,192 @@
+package filesystem
+
+import (
+	"bytes"
+	"context"
+	"github.com/pkg/errors"
+	"golang.org/x/sync/semaphore"
+	"image"
+	_ "image/gif"
+	"image/jpeg"
+	"image/png"
+	"io"
+	"io/ioutil"
+	"os"
+	"strings"
+	"time"
+)
+
+const (
+	// The default and largest width and height of an image preview.
+	DefaultPreviewSize = 256
+	MaxPreviewSize     = 1024
+
+	// The largest image file that can be previewed, and the largest number of pixels that the
+	// image can have, since the entire image is decoded into memory to scale it.
+	maxPreviewFileSize = 20 * 1024 * 1024
+	maxPreviewPixels   = 25 * 1000 * 1000
+
+	// The number of images that can be scaled at once across all of the servers, and how long
+	// a preview waits for one of them to become available.
+	maxConcurrentPreviews = 4
+	previewWaitTimeout    = time.Second * 10
+)
+
+// Limits the number of images being decoded at once, since each one can use a large amount of
+// memory and CPU time.
+var previewSem = semaphore.NewWeighted(maxConcurrentPreviews)
+
+// An image preview, along with the MIME type of the preview and of the original file.
+type ImagePreview struct {
+	io.ReadCloser
+
+	// The MIME type of the preview, which may differ from that of the file when the image
+	// has been scaled down.
+	Mimetype string
+
+	// The MIME type of the original file.
+	SourceMimetype string
+}
+
+// Returns a preview of an image on the server, scaled down to fit within the given width and
+// height. Images that already fit are returned as they are, otherwise they are scaled and
+// returned as a PNG, or a JPEG if the image is a JPEG. If the file is not a PNG, JPEG or GIF
+// image ErrNotImage is returned, along with the MIME type of the file.
+func (fs *Filesystem) Preview(p string, size int) (*ImagePreview, error) {
+	if size <= 0 {
+		size = DefaultPreviewSize
+	} else if size > MaxPreviewSize {
+		size = MaxPreviewSize
+	}
+
+	st, err := fs.Stat(p)
+	if err != nil {
+		return nil, err
+	}
+
+	preview := &ImagePreview{Mimetype: st.Mimetype, SourceMimetype: st.Mimetype}
+	if st.Info.IsDir() {
+		return preview, ErrIsDirectory
+	}
+
+	switch strings.SplitN(st.Mimetype, ";", 2)[0] {
+	case "image/png", "image/jpeg", "image/gif":
+	default:
+		return preview, ErrNotImage
+	}
+
+	if st.Info.Size() > maxPreviewFileSize {
+		return preview, ErrImageTooLarge
+	}
+
+	cleaned, err := fs.SafePath(p)
+	if err != nil {
+		return nil, err
+	}
+
+	f, err := os.Open(cleaned)
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+
+	// Check the dimensions of the image before decoding it, so that a small file claiming to be
+	// a huge image is not decoded.
+	cfg, format, err := image.DecodeConfig(f)
+	if err != nil {
+		f.Close()
+		return preview, ErrNotImage
+	}
+
+	if cfg.Width*cfg.Height > maxPreviewPixels {
+		f.Close()
+		return preview, ErrImageTooLarge
+	}
+
+	if _, err := f.Seek(0, io.SeekStart); err != nil {
+		f.Close()
+		return nil, errors.WithStack(err)
+	}
+
+	// Animated images are always decoded, so that only the first frame is sent.
+	if cfg.Width <= size && cfg.Height <= size && format != "gif" {
+		preview.ReadCloser = f
+		return preview, nil
+	}
+	defer f.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), previewWaitTimeout)
+	defer cancel()
+
+	if err := previewSem.Acquire(ctx, 1); err != nil {
+		return preview, ErrPreviewBusy
+	}
+	defer previewSem.Release(1)
+
+	img, _, err := image.Decode(f)
+	if err != nil {
+		return preview, ErrNotImage
+	}
+
+	var buf bytes.Buffer
+	scaled := scaleImage(img, size)
+	if format == "jpeg" {
+		preview.Mimetype = "image/jpeg"
+		err = jpeg.Encode(&buf, scaled, &jpeg.Options{Quality: 85})
+	} else {
+		preview.Mimetype = "image/png"
+		err = png.Encode(&buf, scaled)
+	}
+
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+	preview.ReadCloser = ioutil.NopCloser(&buf)
+
+	return preview, nil
+}
+
+// Scales the image down to fit within a square of the given size, keeping its aspect ratio.
+// Each pixel in the scaled image is the average of the pixels it covers in the original.
+func scaleImage(src image.Image, size int) image.Image {
+	b := src.Bounds()
+	w, h := b.Dx(), b.Dy()
+	if w <= size && h <= size {
+		return src
+	}
+
+	dw, dh := size, h*size/w
+	if h > w {
+		dw, dh = w*size/h, size
+	}
+	if dw < 1 {
+		dw = 1
+	}
+	if dh < 1 {
+		dh = 1
+	}
+
+	dst := image.NewRGBA(image.Rect(0, 0, dw, dh))
+	for y := 0; y < dh; y++ {
+		y0, y1 := b.Min.Y+y*h/dh, b.Min.Y+(y+1)*h/dh
+		for x := 0; x < dw; x++ {
+			x0, x1 := b.Min.X+x*w/dw, b.Min.X+(x+1)*w/dw
+
+			var r, g, bl, a, n uint64
+			for sy := y0; sy < y1; sy++ {
+				for sx := x0; sx < x1; sx++ {
+					cr, cg, cb, ca := src.At(sx, sy).RGBA()
+					r, g, bl, a = r+uint64(cr), g+uint64(cg), bl+uint64(cb), a+uint64(ca)
+					n++
+				}
+			}
+
+			i := dst.PixOffset(x, y)
+			dst.Pix[i+0] = uint8(r / n >> 8)
+			dst.Pix[i+1] = uint8(g / n >> 8)
+			dst.Pix[i+2] = uint8(bl / n >> 8)
+			dst.Pix[i+3] = uint8(a / n >> 8)
+		}
+	}
+
+	return dst
+}
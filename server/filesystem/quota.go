@@ -0,0 +1,186 @@
+package filesystem
+
+import (
+	"encoding/json"
+	"github.com/apex/log"
+	"github.com/avatag-host/claws/config"
+	"github.com/pkg/errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sync"
+)
+
+// The XFS project IDs allocated to server data directories, keyed by the name of the data
+// directory, which is the server UUID.
+var quotaProjects struct {
+	sync.Mutex
+	once sync.Once
+	ids  map[string]int
+}
+
+func quotaProjectsPath() string {
+	return filepath.Join(config.Get().System.RootDirectory, "quotas.json")
+}
+
+func loadQuotaProjects() {
+	quotaProjects.ids = make(map[string]int)
+
+	b, err := ioutil.ReadFile(quotaProjectsPath())
+	if err != nil {
+		if !os.IsNotExist(err) {
+			log.WithField("error", err).Warn("failed to read allocated quota projects from disk")
+		}
+		return
+	}
+
+	if err := json.Unmarshal(b, &quotaProjects.ids); err != nil {
+		log.WithField("error", err).Warn("failed to parse allocated quota projects from disk")
+	}
+}
+
+// Writes the allocated project IDs to the disk. The caller must hold the lock.
+func saveQuotaProjects() error {
+	b, err := json.Marshal(quotaProjects.ids)
+	if err != nil {
+		return errors.WithStack(err)
+	}
+
+	return errors.WithStack(ioutil.WriteFile(quotaProjectsPath(), b, 0600))
+}
+
+// Returns the project ID allocated to the filesystem, allocating the lowest unused ID in the
+// configured range if it does not have one yet.
+func (fs *Filesystem) quotaProject() (int, error) {
+	quotaProjects.once.Do(loadQuotaProjects)
+
+	quotaProjects.Lock()
+	defer quotaProjects.Unlock()
+
+	name := filepath.Base(fs.root)
+	if id, ok := quotaProjects.ids[name]; ok {
+		return id, nil
+	}
+
+	used := make(map[int]bool, len(quotaProjects.ids))
+	for _, id := range quotaProjects.ids {
+		used[id] = true
+	}
+
+	cfg := config.Get().System.DiskQuota
+	for id := cfg.ProjectIdStart; id < cfg.ProjectIdStart+cfg.ProjectIdCount; id++ {
+		if used[id] {
+			continue
+		}
+
+		quotaProjects.ids[name] = id
+		if err := saveQuotaProjects(); err != nil {
+			delete(quotaProjects.ids, name)
+			return 0, err
+		}
+
+		return id, nil
+	}
+
+	return 0, ErrNoQuotaProjectsAvailable
+}
+
+func (fs *Filesystem) releaseQuotaProject() error {
+	quotaProjects.once.Do(loadQuotaProjects)
+
+	quotaProjects.Lock()
+	defer quotaProjects.Unlock()
+
+	name := filepath.Base(fs.root)
+	if _, ok := quotaProjects.ids[name]; !ok {
+		return nil
+	}
+
+	delete(quotaProjects.ids, name)
+
+	return saveQuotaProjects()
+}
+
+// Creates the root directory of the filesystem. When btrfs quotas are used the directory is
+// created as a subvolume so that it can be given a quota.
+func (fs *Filesystem) CreateRoot() error {
+	if q := config.Get().System.DiskQuota; q.Enabled && q.Driver == config.DiskQuotaBtrfs {
+		if err := os.MkdirAll(filepath.Dir(fs.root), 0755); err != nil {
+			return errors.WithStack(err)
+		}
+
+		if err := createSubvolume(fs.root); err != nil {
+			return err
+		}
+
+		return errors.WithStack(os.Chmod(fs.root, 0700))
+	}
+
+	return errors.WithStack(os.MkdirAll(fs.root, 0700))
+}
+
+// Sets the quota on the filesystem to the disk limit, so that the server is unable to write
+// more data than it is allowed to. This does nothing unless disk quotas are enabled, or if the
+// quota has already been set to the current limit.
+func (fs *Filesystem) ApplyQuota() error {
+	q := config.Get().System.DiskQuota
+	if !q.Enabled || fs.isTest {
+		return nil
+	}
+
+	limit := fs.MaxDisk()
+
+	fs.quotaMu.Lock()
+	defer fs.quotaMu.Unlock()
+
+	if fs.quotaApplied && fs.quotaLimit == limit {
+		return nil
+	}
+
+	switch q.Driver {
+	case config.DiskQuotaXfs:
+		id, err := fs.quotaProject()
+		if err != nil {
+			return err
+		}
+
+		if err := setXfsQuota(fs.root, id, limit); err != nil {
+			return err
+		}
+	case config.DiskQuotaBtrfs:
+		if err := setBtrfsQuota(fs.root, limit); err != nil {
+			return err
+		}
+	}
+
+	fs.quotaApplied, fs.quotaLimit = true, limit
+
+	return nil
+}
+
+// Removes the quota for the filesystem. This should be called once the files for a server
+// have been removed.
+func (fs *Filesystem) RemoveQuota() error {
+	q := config.Get().System.DiskQuota
+	if !q.Enabled || fs.isTest {
+		return nil
+	}
+
+	switch q.Driver {
+	case config.DiskQuotaXfs:
+		id, err := fs.quotaProject()
+		if err != nil {
+			return err
+		}
+
+		if err := clearXfsQuota(filepath.Dir(fs.root), id); err != nil {
+			return err
+		}
+
+		return fs.releaseQuotaProject()
+	case config.DiskQuotaBtrfs:
+		return clearStaleBtrfsQuotas(filepath.Dir(fs.root))
+	}
+
+	return nil
+}
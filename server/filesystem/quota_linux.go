@@ -0,0 +1,153 @@
+package filesystem
+
+import (
+	"fmt"
+	"github.com/pkg/errors"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"syscall"
+	"unsafe"
+)
+
+// The structure used by the FS_IOC_FSGETXATTR ioctl, which returns the project ID of a file
+// on XFS.
+type fsxattr struct {
+	xflags     uint32
+	extsize    uint32
+	nextents   uint32
+	projid     uint32
+	cowextsize uint32
+	pad        [8]byte
+}
+
+const (
+	fsIocFsgetxattr     = 0x801c581f
+	fsXflagProjinherit  = 0x00000200
+	btrfsSubvolumeInode = 256
+	btrfsSuperMagic     = 0x9123683e
+)
+
+// Runs a quota command, returning the output of the command as the error if it fails.
+func runQuotaCommand(name string, args ...string) error {
+	out, err := exec.Command(name, args...).CombinedOutput()
+	if err != nil {
+		return errors.New(fmt.Sprintf("%s: %s: %s", name, err.Error(), strings.TrimSpace(string(out))))
+	}
+
+	return nil
+}
+
+// Returns the mount point of the filesystem that contains the given path, which is the last
+// directory above the path on the same device.
+func mountPoint(p string) (string, error) {
+	var st syscall.Stat_t
+	if err := syscall.Stat(p, &st); err != nil {
+		return "", errors.WithStack(err)
+	}
+
+	for {
+		parent := filepath.Dir(p)
+		if parent == p {
+			return p, nil
+		}
+
+		var pst syscall.Stat_t
+		if err := syscall.Stat(parent, &pst); err != nil {
+			return "", errors.WithStack(err)
+		}
+
+		if pst.Dev != st.Dev {
+			return p, nil
+		}
+
+		p = parent
+	}
+}
+
+// Returns the XFS project ID of the directory, and whether new files within it inherit it.
+func xfsProject(p string) (uint32, bool, error) {
+	f, err := syscall.Open(p, syscall.O_RDONLY|syscall.O_DIRECTORY, 0)
+	if err != nil {
+		return 0, false, errors.WithStack(err)
+	}
+	defer syscall.Close(f)
+
+	var attr fsxattr
+	if _, _, errno := syscall.Syscall(syscall.SYS_IOCTL, uintptr(f), fsIocFsgetxattr, uintptr(unsafe.Pointer(&attr))); errno != 0 {
+		return 0, false, errors.WithStack(errno)
+	}
+
+	return attr.projid, attr.xflags&fsXflagProjinherit != 0, nil
+}
+
+// Assigns the directory to the project and sets the limit of the project. Assigning the
+// project walks every file in the directory, so it is only done when the directory does not
+// already belong to the project.
+func setXfsQuota(p string, id int, limit int64) error {
+	mnt, err := mountPoint(p)
+	if err != nil {
+		return err
+	}
+
+	current, inherit, err := xfsProject(p)
+	if err != nil {
+		return err
+	}
+
+	if current != uint32(id) || !inherit {
+		if err := runQuotaCommand("xfs_quota", "-x", "-c", fmt.Sprintf("project -s -p %s %d", p, id), mnt); err != nil {
+			return err
+		}
+	}
+
+	// Limits are set in kilobytes, since a plain number is treated as a number of blocks. A
+	// limit of zero removes the limit.
+	return runQuotaCommand("xfs_quota", "-x", "-c", fmt.Sprintf("limit -p bhard=%dk %d", (limit+1023)/1024, id), mnt)
+}
+
+// Removes the limit from the project. The data directory is passed in, since the directory
+// for the server has already been removed.
+func clearXfsQuota(data string, id int) error {
+	mnt, err := mountPoint(data)
+	if err != nil {
+		return err
+	}
+
+	return runQuotaCommand("xfs_quota", "-x", "-c", fmt.Sprintf("limit -p bhard=0 %d", id), mnt)
+}
+
+func createSubvolume(p string) error {
+	return runQuotaCommand("btrfs", "subvolume", "create", p)
+}
+
+// Sets the limit of the quota group of the subvolume. Data directories that were created
+// before btrfs quotas were enabled are not subvolumes, so they cannot be given a quota.
+func setBtrfsQuota(p string, limit int64) error {
+	var fst syscall.Statfs_t
+	if err := syscall.Statfs(p, &fst); err != nil {
+		return errors.WithStack(err)
+	}
+
+	var st syscall.Stat_t
+	if err := syscall.Stat(p, &st); err != nil {
+		return errors.WithStack(err)
+	}
+
+	if uint32(fst.Type) != btrfsSuperMagic || st.Ino != btrfsSubvolumeInode {
+		return errors.Wrap(ErrQuotaUnsupported, "data directory is not a btrfs subvolume")
+	}
+
+	size := "none"
+	if limit > 0 {
+		size = strconv.FormatInt(limit, 10)
+	}
+
+	return runQuotaCommand("btrfs", "qgroup", "limit", size, p)
+}
+
+// Removes the quota groups of subvolumes that have been deleted.
+func clearStaleBtrfsQuotas(data string) error {
+	return runQuotaCommand("btrfs", "qgroup", "clear-stale", data)
+}
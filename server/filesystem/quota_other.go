@@ -0,0 +1,23 @@
+// +build !linux
+
+package filesystem
+
+func setXfsQuota(p string, id int, limit int64) error {
+	return ErrQuotaUnsupported
+}
+
+func clearXfsQuota(data string, id int) error {
+	return ErrQuotaUnsupported
+}
+
+func createSubvolume(p string) error {
+	return ErrQuotaUnsupported
+}
+
+func setBtrfsQuota(p string, limit int64) error {
+	return ErrQuotaUnsupported
+}
+
+func clearStaleBtrfsQuotas(data string) error {
+	return ErrQuotaUnsupported
+}
@@ -0,0 +1,214 @@
+package filesystem
+
+import (
+	"bytes"
+	"encoding/binary"
+	"github.com/pkg/errors"
+	"io/ioutil"
+	"os"
+	"strings"
+	"unicode/utf16"
+	"unicode/utf8"
+)
+
+const (
+	EncodingUtf8    = "utf-8"
+	EncodingUtf16le = "utf-16le"
+	EncodingUtf16be = "utf-16be"
+	EncodingLatin1  = "latin-1"
+
+	NewlineLf   = "lf"
+	NewlineCrlf = "crlf"
+)
+
+// The largest file that can be read as text, since the entire file is loaded into memory to
+// convert it.
+const maxTextFileSize = 10 * 1024 * 1024
+
+var (
+	utf8Bom    = []byte{0xef, 0xbb, 0xbf}
+	utf16leBom = []byte{0xff, 0xfe}
+	utf16beBom = []byte{0xfe, 0xff}
+)
+
+// The contents of a text file converted to UTF-8 with "\n" line endings, along with the
+// encoding and line endings of the file so that it can be written back the same way.
+type TextFile struct {
+	Content  string `json:"content"`
+	Encoding string `json:"encoding"`
+	Newline  string `json:"newline"`
+	Bom      bool   `json:"bom"`
+}
+
+// Reads a file and converts it to UTF-8 text, detecting the encoding and line endings used by
+// the file.
+func (fs *Filesystem) ReadTextFile(p string) (*TextFile, error) {
+	cleaned, err := fs.SafePath(p)
+	if err != nil {
+		return nil, err
+	}
+
+	st, err := os.Stat(cleaned)
+	if err != nil {
+		return nil, err
+	} else if st.IsDir() {
+		return nil, ErrIsDirectory
+	} else if st.Size() > maxTextFileSize {
+		return nil, ErrFileTooLarge
+	}
+
+	b, err := ioutil.ReadFile(cleaned)
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+
+	return decodeText(b)
+}
+
+// Writes the text to a file using the encoding and line endings given, which are usually those
+// returned when the file was read.
+func (fs *Filesystem) WriteTextFile(p string, t *TextFile) error {
+	b, err := encodeText(t)
+	if err != nil {
+		return err
+	}
+
+	return fs.Writefile(p, bytes.NewReader(b))
+}
+
+func decodeText(b []byte) (*TextFile, error) {
+	t := &TextFile{Encoding: EncodingUtf8}
+
+	var s string
+	switch {
+	case bytes.HasPrefix(b, utf8Bom):
+		t.Bom = true
+		b = b[len(utf8Bom):]
+		s = string(b)
+	case bytes.HasPrefix(b, utf16leBom):
+		t.Bom, t.Encoding = true, EncodingUtf16le
+		s = decodeUtf16(b[len(utf16leBom):], binary.LittleEndian)
+	case bytes.HasPrefix(b, utf16beBom):
+		t.Bom, t.Encoding = true, EncodingUtf16be
+		s = decodeUtf16(b[len(utf16beBom):], binary.BigEndian)
+	default:
+		t.Encoding = detectEncoding(b)
+		switch t.Encoding {
+		case EncodingUtf16le:
+			s = decodeUtf16(b, binary.LittleEndian)
+		case EncodingUtf16be:
+			s = decodeUtf16(b, binary.BigEndian)
+		case EncodingLatin1:
+			r := make([]rune, len(b))
+			for i, c := range b {
+				r[i] = rune(c)
+			}
+			s = string(r)
+		default:
+			s = string(b)
+		}
+	}
+
+	// Files containing null characters are almost certainly not text, and would be corrupted
+	// by being written back as text.
+	if strings.ContainsRune(s, 0) {
+		return nil, ErrNotTextFile
+	}
+
+	// The line endings used by most of the file are kept, and lines are returned with "\n"
+	// line endings.
+	t.Newline = NewlineLf
+	if crlf := strings.Count(s, "\r\n"); crlf > 0 && crlf >= strings.Count(s, "\n")-crlf {
+		t.Newline = NewlineCrlf
+	}
+	t.Content = strings.Replace(s, "\r\n", "\n", -1)
+
+	return t, nil
+}
+
+// Returns the encoding of a file without a byte order mark. Text is treated as UTF-16 if most
+// of the high or low bytes are zero, which is the case for files written by Windows that are
+// mostly ASCII. Text that is not valid UTF-8 is otherwise treated as Latin-1.
+func detectEncoding(b []byte) string {
+	if len(b) >= 2 && len(b)%2 == 0 && bytes.IndexByte(b, 0) != -1 {
+		var even, odd int
+		for i := 0; i < len(b); i += 2 {
+			if b[i] == 0 {
+				even++
+			}
+			if b[i+1] == 0 {
+				odd++
+			}
+		}
+
+		if pairs := len(b) / 2; odd > pairs/2 && even <= pairs/8 {
+			return EncodingUtf16le
+		} else if even > pairs/2 && odd <= pairs/8 {
+			return EncodingUtf16be
+		}
+	}
+
+	if utf8.Valid(b) {
+		return EncodingUtf8
+	}
+
+	return EncodingLatin1
+}
+
+func decodeUtf16(b []byte, order binary.ByteOrder) string {
+	u := make([]uint16, len(b)/2)
+	for i := range u {
+		u[i] = order.Uint16(b[i*2:])
+	}
+
+	return string(utf16.Decode(u))
+}
+
+func encodeText(t *TextFile) ([]byte, error) {
+	s := strings.Replace(t.Content, "\r\n", "\n", -1)
+	switch t.Newline {
+	case NewlineCrlf:
+		s = strings.Replace(s, "\n", "\r\n", -1)
+	case NewlineLf, "":
+	default:
+		return nil, ErrUnsupportedNewline
+	}
+
+	var b []byte
+	switch t.Encoding {
+	case EncodingUtf8, "":
+		if t.Bom {
+			b = append(b, utf8Bom...)
+		}
+		b = append(b, s...)
+	case EncodingUtf16le, EncodingUtf16be:
+		var order binary.ByteOrder = binary.LittleEndian
+		bom := utf16leBom
+		if t.Encoding == EncodingUtf16be {
+			order, bom = binary.BigEndian, utf16beBom
+		}
+
+		if t.Bom {
+			b = append(b, bom...)
+		}
+
+		u := utf16.Encode([]rune(s))
+		out := make([]byte, len(u)*2)
+		for i, c := range u {
+			order.PutUint16(out[i*2:], c)
+		}
+		b = append(b, out...)
+	case EncodingLatin1:
+		b = make([]byte, 0, len(s))
+		for _, r := range s {
+			if r > 0xff {
+				return nil, ErrUnencodableText
+			}
+			b = append(b, byte(r))
+		}
+	default:
+		return nil, ErrUnsupportedEncoding
+	}
+
+	return b, nil
+}
@@ -0,0 +1,163 @@
+package server
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/apex/log"
+	"github.com/avatag-host/claws/config"
+	"github.com/avatag-host/claws/environment"
+	"github.com/pkg/errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sync"
+)
+
+// The servers that have been installed but have not yet finished booting for the first time,
+// keyed by the server UUID. Servers that are not in this set have either booted already or
+// were installed before first boot actions were tracked, and never have the actions performed.
+var firstBoot struct {
+	sync.Mutex
+	once    sync.Once
+	pending map[string]bool
+}
+
+// Returns the path to the file that the servers waiting for their first boot are stored in, so
+// that the actions are still performed if Wings is restarted between installing and booting
+// the server.
+func firstBootPath() string {
+	return filepath.Join(config.Get().System.RootDirectory, "first_boot.json")
+}
+
+func loadFirstBoot() {
+	firstBoot.pending = make(map[string]bool)
+
+	b, err := ioutil.ReadFile(firstBootPath())
+	if err != nil {
+		if !os.IsNotExist(err) {
+			log.WithField("error", err).Warn("failed to read servers awaiting first boot from disk")
+		}
+		return
+	}
+
+	if err := json.Unmarshal(b, &firstBoot.pending); err != nil {
+		log.WithField("error", err).Warn("failed to parse servers awaiting first boot from disk")
+	}
+}
+
+// Writes the servers awaiting their first boot to the disk. The caller must hold the lock.
+func saveFirstBoot() error {
+	b, err := json.Marshal(firstBoot.pending)
+	if err != nil {
+		return errors.WithStack(err)
+	}
+
+	if err := ioutil.WriteFile(firstBootPath(), b, 0600); err != nil {
+		return errors.WithStack(err)
+	}
+
+	return nil
+}
+
+// Marks the server as awaiting its first boot, or as having booted, writing the change to the
+// disk if the state changed.
+func setFirstBoot(uuid string, pending bool) error {
+	firstBoot.once.Do(loadFirstBoot)
+
+	firstBoot.Lock()
+	defer firstBoot.Unlock()
+
+	if firstBoot.pending[uuid] == pending {
+		return nil
+	}
+
+	if pending {
+		firstBoot.pending[uuid] = true
+	} else {
+		delete(firstBoot.pending, uuid)
+	}
+
+	return saveFirstBoot()
+}
+
+// Determines if the server has been installed but has not yet finished booting for the first
+// time.
+func (s *Server) IsFirstBoot() bool {
+	firstBoot.once.Do(loadFirstBoot)
+
+	firstBoot.Lock()
+	defer firstBoot.Unlock()
+
+	return firstBoot.pending[s.Id()]
+}
+
+// Marks the server as awaiting its first boot once it has been installed, if the egg defines
+// any first boot actions.
+func (s *Server) awaitFirstBoot() {
+	fb := s.ProcessConfiguration().FirstBoot
+	if len(fb.Files) == 0 && len(fb.Prompts) == 0 {
+		return
+	}
+
+	if err := setFirstBoot(s.Id(), true); err != nil {
+		s.Log().WithField("error", err).Warn("failed to mark server as awaiting first boot")
+	}
+}
+
+// Marks the first boot of the server as completed once the server is running, so that the
+// first boot actions are not performed again.
+func (s *Server) completeFirstBoot() {
+	if !s.IsFirstBoot() {
+		return
+	}
+
+	if err := setFirstBoot(s.Id(), false); err != nil {
+		s.Log().WithField("error", err).Warn("failed to mark first boot of server as completed")
+		return
+	}
+
+	s.Log().Debug("server completed its first boot")
+}
+
+// Writes the files defined for the first boot of the server, replacing any existing content.
+// Unlike the default files these are written even if they already exist, since the server may
+// have created them with different content when it was installed.
+func (s *Server) writeFirstBootFiles() {
+	for _, f := range s.ProcessConfiguration().FirstBoot.Files {
+		l := s.Log().WithField("file", f.Path)
+
+		if err := s.seedFile(f); err != nil {
+			l.WithField("error", err).Warn("failed to write first boot server file")
+			s.PublishConsoleOutputFromDaemon(fmt.Sprintf("Failed to write first boot file %s.", f.Path))
+			continue
+		}
+
+		l.Debug("wrote first boot server file")
+	}
+}
+
+// Answers any of the prompts defined for the first boot of the server that match the line of
+// console output, by sending the answer to the server as a command.
+func (s *Server) answerFirstBootPrompts(line string) {
+	prompts := s.ProcessConfiguration().FirstBoot.Prompts
+	if len(prompts) == 0 || s.GetState() == environment.ProcessOfflineState || !s.IsFirstBoot() {
+		return
+	}
+
+	for _, p := range prompts {
+		if p.Match == nil || !p.Match.Matches(line) {
+			continue
+		}
+
+		s.Log().WithField("match", p.Match.String()).Debug("answering first boot prompt for server")
+
+		if err := s.Environment.SendCommand(p.Answer); err != nil {
+			s.Log().WithField("error", err).Warn("failed to answer first boot prompt for server")
+		}
+	}
+}
+
+// Removes the first boot state for a server once it has been deleted.
+func RemoveFirstBoot(uuid string) error {
+	return setFirstBoot(uuid, false)
+}
@@ -0,0 +1,379 @@
+package server
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"github.com/apex/log"
+	"github.com/avatag-host/claws/api"
+	"github.com/avatag-host/claws/config"
+	"github.com/avatag-host/claws/environment"
+	"github.com/avatag-host/claws/server/backup"
+	"github.com/mholt/archiver/v3"
+	"github.com/pkg/errors"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+// Describes where the compressed files of a hibernated server are stored.
+type Hibernation struct {
+	// Either "wings" if the files are stored on this machine, or "s3" if they were uploaded.
+	Adapter   string    `json:"adapter"`
+	Checksum  string    `json:"checksum"`
+	Size      int64     `json:"size"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// The hibernated servers on this node, keyed by the server UUID.
+var hibernations struct {
+	sync.Mutex
+	once    sync.Once
+	servers map[string]Hibernation
+}
+
+// Returns the path to the file that the hibernated servers are stored in, so that they remain
+// hibernated when Wings is restarted.
+func hibernationsPath() string {
+	return filepath.Join(config.Get().System.RootDirectory, "hibernation.json")
+}
+
+func loadHibernations() {
+	hibernations.servers = make(map[string]Hibernation)
+
+	b, err := ioutil.ReadFile(hibernationsPath())
+	if err != nil {
+		if !os.IsNotExist(err) {
+			log.WithField("error", err).Warn("failed to read hibernated servers from disk")
+		}
+		return
+	}
+
+	if err := json.Unmarshal(b, &hibernations.servers); err != nil {
+		log.WithField("error", err).Warn("failed to parse hibernated servers from disk")
+	}
+}
+
+// Marks the server as hibernated, or as no longer hibernated if h is nil, writing the change to
+// the disk.
+func setHibernation(uuid string, h *Hibernation) error {
+	hibernations.once.Do(loadHibernations)
+
+	hibernations.Lock()
+	defer hibernations.Unlock()
+
+	if h != nil {
+		hibernations.servers[uuid] = *h
+	} else {
+		delete(hibernations.servers, uuid)
+	}
+
+	b, err := json.Marshal(hibernations.servers)
+	if err != nil {
+		return errors.WithStack(err)
+	}
+
+	if err := ioutil.WriteFile(hibernationsPath(), b, 0600); err != nil {
+		return errors.WithStack(err)
+	}
+
+	return nil
+}
+
+// Returns where the files of the server are stored if it is hibernated, or nil if it is not.
+func (s *Server) Hibernation() *Hibernation {
+	hibernations.once.Do(loadHibernations)
+
+	hibernations.Lock()
+	defer hibernations.Unlock()
+
+	if h, ok := hibernations.servers[s.Id()]; ok {
+		return &h
+	}
+
+	return nil
+}
+
+// Determines if the files of the server are hibernated. A hibernated server cannot be started
+// or have its files accessed until it has been restored.
+func (s *Server) IsHibernated() bool {
+	return s.Hibernation() != nil
+}
+
+// Determines if the server files are currently being hibernated or restored.
+func (s *Server) IsHibernating() bool {
+	return s.hibernating.Get()
+}
+
+// Returns the path that the compressed files of the server are stored at while hibernated.
+func (s *Server) hibernationPath() string {
+	return filepath.Join(config.Get().System.HibernationDirectory, s.Id()+".tar.gz")
+}
+
+// Compresses the files of a stopped server into an archive, stored either on this machine or
+// in S3 depending on the adapter, and then deletes the server directory to free up the disk
+// space that it was using. The Panel is notified once the server has been hibernated.
+func (s *Server) Hibernate(adapter string) error {
+	if !s.hibernating.SetIfFalse() {
+		return ErrHibernationInProgress
+	}
+	defer s.hibernating.Set(false)
+
+	if s.IsHibernated() {
+		return ErrHibernated
+	}
+
+	if s.GetState() != environment.ProcessOfflineState || s.ExecutingPowerAction() || s.IsInstalling() {
+		return ErrIsRunning
+	}
+
+	h, err := s.hibernate(adapter)
+	if err != nil {
+		_ = os.Remove(s.hibernationPath())
+
+		s.notifyPanelOfHibernation(api.HibernationRequest{Hibernated: true, Adapter: adapter})
+
+		return err
+	}
+
+	s.notifyPanelOfHibernation(api.HibernationRequest{
+		Hibernated:   true,
+		Successful:   true,
+		Adapter:      h.Adapter,
+		Checksum:     h.Checksum,
+		ChecksumType: "sha256",
+		Size:         h.Size,
+	})
+
+	return nil
+}
+
+func (s *Server) hibernate(adapter string) (*Hibernation, error) {
+	s.Log().WithField("adapter", adapter).Info("hibernating server files")
+
+	files, err := s.Archiver.files()
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+
+	p := s.hibernationPath()
+	if err := os.Remove(p); err != nil && !os.IsNotExist(err) {
+		return nil, errors.WithStack(err)
+	}
+
+	if err := archiver.NewTarGz().Archive(files, p); err != nil {
+		return nil, errors.WithStack(err)
+	}
+
+	checksum, size, err := checksumFile(p)
+	if err != nil {
+		return nil, err
+	}
+
+	h := &Hibernation{Adapter: adapter, Checksum: checksum, Size: size, CreatedAt: time.Now().UTC()}
+
+	if adapter == backup.S3BackupAdapter {
+		if err := s.uploadHibernation(p, size); err != nil {
+			return nil, err
+		}
+
+		if err := os.Remove(p); err != nil {
+			s.Log().WithField("error", err).Warn("failed to remove hibernated server files after uploading them")
+		}
+	}
+
+	// The server is marked as hibernated before its files are removed, so that it cannot be
+	// started with a partially deleted directory if removing them fails.
+	if err := setHibernation(s.Id(), h); err != nil {
+		return nil, err
+	}
+
+	if err := os.RemoveAll(s.Filesystem().Path()); err != nil {
+		s.Log().WithField("error", err).Warn("failed to remove server directory after hibernating files")
+	}
+
+	s.Log().WithField("size", size).Info("server files have been hibernated")
+
+	return h, nil
+}
+
+// Uploads the compressed files of the server to S3 using the presigned URLs from the Panel.
+func (s *Server) uploadHibernation(p string, size int64) error {
+	urls, err := s.panelApi().GetHibernationUploadURLs(s.Id(), size)
+	if err != nil {
+		return err
+	}
+
+	f, err := os.Open(p)
+	if err != nil {
+		return errors.WithStack(err)
+	}
+	defer f.Close()
+
+	return backup.UploadParts(f, size, urls)
+}
+
+// Restores the files of a hibernated server into the server directory, downloading them from
+// S3 first if that is where they were stored. The files are extracted next to the server
+// directory and then moved into place, so a failed restore leaves the server hibernated. The
+// Panel is notified once the server has been restored.
+func (s *Server) Rehydrate() error {
+	if !s.hibernating.SetIfFalse() {
+		return ErrHibernationInProgress
+	}
+	defer s.hibernating.Set(false)
+
+	h := s.Hibernation()
+	if h == nil {
+		return ErrNotHibernated
+	}
+
+	if err := s.rehydrate(h); err != nil {
+		s.notifyPanelOfHibernation(api.HibernationRequest{Adapter: h.Adapter})
+
+		return err
+	}
+
+	s.notifyPanelOfHibernation(api.HibernationRequest{Successful: true, Adapter: h.Adapter})
+
+	return nil
+}
+
+func (s *Server) rehydrate(h *Hibernation) error {
+	s.Log().WithField("adapter", h.Adapter).Info("restoring hibernated server files")
+
+	p := s.hibernationPath()
+	if h.Adapter == backup.S3BackupAdapter {
+		if err := s.downloadHibernation(p); err != nil {
+			return err
+		}
+	}
+
+	if checksum, _, err := checksumFile(p); err != nil {
+		return err
+	} else if checksum != h.Checksum {
+		return errors.New(fmt.Sprintf("checksum of hibernated server files does not match, expected %s got %s", h.Checksum, checksum))
+	}
+
+	target := s.Filesystem().Path()
+	tmp := target + ".rehydrate"
+	if err := os.RemoveAll(tmp); err != nil {
+		return errors.WithStack(err)
+	}
+
+	if err := os.MkdirAll(tmp, 0700); err != nil {
+		return errors.WithStack(err)
+	}
+
+	if err := archiver.NewTarGz().Unarchive(p, tmp); err != nil {
+		os.RemoveAll(tmp)
+
+		return errors.WithStack(err)
+	}
+
+	// Anything left in the server directory was created after the server was hibernated, and
+	// would otherwise prevent the restored files from being moved into place.
+	if err := os.RemoveAll(target); err != nil {
+		os.RemoveAll(tmp)
+
+		return errors.WithStack(err)
+	}
+
+	if err := os.Rename(tmp, target); err != nil {
+		os.RemoveAll(tmp)
+
+		return errors.WithStack(err)
+	}
+
+	if err := s.Filesystem().Chown("/"); err != nil {
+		s.Log().WithField("error", err).Warn("failed to set ownership of restored server files")
+	}
+
+	if err := setHibernation(s.Id(), nil); err != nil {
+		return err
+	}
+
+	if err := os.Remove(p); err != nil && !os.IsNotExist(err) {
+		s.Log().WithField("error", err).Warn("failed to remove hibernated server files after restoring them")
+	}
+
+	// Force a recalculation of the disk usage for the server since all of the files are back.
+	go s.Filesystem().HasSpaceAvailable(false)
+
+	s.Log().Info("hibernated server files have been restored")
+
+	return nil
+}
+
+// Downloads the compressed files of the server from S3 using a presigned URL from the Panel.
+func (s *Server) downloadHibernation(p string) error {
+	url, err := s.panelApi().GetHibernationDownloadURL(s.Id())
+	if err != nil {
+		return err
+	}
+
+	res, err := http.Get(url)
+	if err != nil {
+		return errors.WithStack(err)
+	}
+	defer res.Body.Close()
+
+	if res.StatusCode != http.StatusOK {
+		return errors.New(fmt.Sprintf("failed to download hibernated server files, %d:%s", res.StatusCode, res.Status))
+	}
+
+	f, err := os.OpenFile(p, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0600)
+	if err != nil {
+		return errors.WithStack(err)
+	}
+	defer f.Close()
+
+	if _, err := io.Copy(f, res.Body); err != nil {
+		return errors.WithStack(err)
+	}
+
+	return errors.WithStack(f.Close())
+}
+
+// Removes the compressed files and hibernation state of the server. This should be called
+// when the server is deleted. Files stored in S3 are left for the Panel to remove.
+func (s *Server) RemoveHibernation() error {
+	if err := os.Remove(s.hibernationPath()); err != nil && !os.IsNotExist(err) {
+		return errors.WithStack(err)
+	}
+
+	if !s.IsHibernated() {
+		return nil
+	}
+
+	return setHibernation(s.Id(), nil)
+}
+
+// Notifies the Panel of the result of hibernating or restoring the server.
+func (s *Server) notifyPanelOfHibernation(data api.HibernationRequest) {
+	if err := s.panelApi().SendHibernationStatus(s.Id(), data); err != nil {
+		s.Log().WithField("error", err).Warn("failed to notify panel of server hibernation status")
+	}
+}
+
+// Returns the hex encoded SHA256 checksum and the size of a file.
+func checksumFile(p string) (string, int64, error) {
+	f, err := os.Open(p)
+	if err != nil {
+		return "", 0, errors.WithStack(err)
+	}
+	defer f.Close()
+
+	h := sha256.New()
+	n, err := io.Copy(h, f)
+	if err != nil {
+		return "", 0, errors.WithStack(err)
+	}
+
+	return hex.EncodeToString(h.Sum(nil)), n, nil
+}
@@ -0,0 +1,151 @@
+package history
+
+import (
+	"bytes"
+	"encoding/binary"
+	"github.com/pkg/errors"
+	"io/ioutil"
+	"os"
+	"sync"
+	"time"
+)
+
+// A single sample of resource usage for a server. Each point covers one collection interval
+// (a minute by default), with the CPU usage averaged across the interval and the memory usage
+// being the peak value seen. Every field is fixed size so that the points can be written to
+// the disk in a compact binary format.
+type Point struct {
+	Timestamp   int64   `json:"timestamp"`
+	CpuAbsolute float64 `json:"cpu_absolute"`
+	Memory      uint64  `json:"memory_bytes"`
+	Disk        int64   `json:"disk_bytes"`
+	RxBytes     uint64  `json:"rx_bytes"`
+	TxBytes     uint64  `json:"tx_bytes"`
+}
+
+// A rolling time-series of resource usage for a single server that is persisted to the disk.
+type History struct {
+	mu   sync.Mutex
+	path string
+	size int
+
+	points []Point
+
+	// Values accumulated from the stats received during the current interval, these are
+	// reset every time a new point is recorded.
+	cpuSum   float64
+	cpuCount int
+	memory   uint64
+}
+
+// Returns a new history instance that stores up to size points at the given path. Any
+// existing data at the path is not loaded until Load is called.
+func New(path string, size int) *History {
+	return &History{path: path, size: size}
+}
+
+// Loads the existing history from the disk, if there is any.
+func (h *History) Load() error {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	b, err := ioutil.ReadFile(h.path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil
+		}
+
+		return errors.WithStack(err)
+	}
+
+	points := make([]Point, len(b)/binary.Size(Point{}))
+	if err := binary.Read(bytes.NewReader(b), binary.LittleEndian, &points); err != nil {
+		return errors.Wrap(err, "history: failed to decode resource history file")
+	}
+
+	h.points = points
+	h.trim()
+
+	return nil
+}
+
+// Saves the current history to the disk. The data is written to a temporary file first and
+// then moved into place so that a crash while writing does not corrupt the existing data.
+func (h *History) Save() error {
+	h.mu.Lock()
+	buf := &bytes.Buffer{}
+	err := binary.Write(buf, binary.LittleEndian, h.points)
+	h.mu.Unlock()
+
+	if err != nil {
+		return errors.WithStack(err)
+	}
+
+	if err := ioutil.WriteFile(h.path+".tmp", buf.Bytes(), 0600); err != nil {
+		return errors.WithStack(err)
+	}
+
+	return errors.WithStack(os.Rename(h.path+".tmp", h.path))
+}
+
+// Removes the history file from the disk.
+func (h *History) Remove() error {
+	if err := os.Remove(h.path); err != nil && !os.IsNotExist(err) {
+		return errors.WithStack(err)
+	}
+
+	return nil
+}
+
+// Tracks a set of stats received from the server environment for the current interval.
+func (h *History) Observe(cpu float64, memory uint64) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	h.cpuSum += cpu
+	h.cpuCount++
+	if memory > h.memory {
+		h.memory = memory
+	}
+}
+
+// Records a new point in the history. The CPU and memory values on the point are replaced
+// with the values observed during the interval if any stats were received.
+func (h *History) Record(p Point) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	if h.cpuCount > 0 {
+		p.CpuAbsolute = h.cpuSum / float64(h.cpuCount)
+		p.Memory = h.memory
+	}
+
+	h.cpuSum = 0
+	h.cpuCount = 0
+	h.memory = 0
+
+	h.points = append(h.points, p)
+	h.trim()
+}
+
+// Returns all of the points recorded between the two given times, inclusive.
+func (h *History) Query(from time.Time, to time.Time) []Point {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	out := make([]Point, 0)
+	for _, p := range h.points {
+		if p.Timestamp >= from.Unix() && p.Timestamp <= to.Unix() {
+			out = append(out, p)
+		}
+	}
+
+	return out
+}
+
+// Drops the oldest points until the history is within the configured size.
+func (h *History) trim() {
+	if h.size > 0 && len(h.points) > h.size {
+		h.points = append([]Point(nil), h.points[len(h.points)-h.size:]...)
+	}
+}
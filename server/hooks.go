@@ -0,0 +1,50 @@
+package server
+
+import (
+	"github.com/avatag-host/claws/config"
+	"github.com/avatag-host/claws/server/hooks"
+	"path/filepath"
+	"strings"
+)
+
+// Runs the hooks configured for the event against this server. An error is only returned if
+// a hook configured to abort on failure fails.
+func (s *Server) RunHooks(event string, data map[string]interface{}) error {
+	c := config.Get()
+	if len(c.System.Hooks) == 0 {
+		return nil
+	}
+
+	return hooks.Run(c.System.Hooks, hooks.Context{
+		Event:  event,
+		Node:   c.Uuid,
+		Server: s.Id(),
+		Data:   data,
+	})
+}
+
+// Runs the hooks for a file that was uploaded or written to the server directory in the
+// background, so that the hooks do not delay the response to the client. The path is the path
+// of the file within the server directory.
+func (s *Server) RunFileUploadedHooks(p string, size int64) {
+	if len(config.Get().System.Hooks) == 0 {
+		return
+	}
+
+	go func() {
+		host, err := s.Filesystem().SafePath(p)
+		if err != nil {
+			s.Log().WithField("error", err).Warn("failed to resolve uploaded file for hooks")
+			return
+		}
+
+		err = s.RunHooks(hooks.FileUploaded, map[string]interface{}{
+			"path":      filepath.Join("/", strings.TrimPrefix(host, s.Filesystem().Path())),
+			"host_path": host,
+			"size":      size,
+		})
+		if err != nil {
+			s.Log().WithField("error", err).Warn("failed to run file uploaded hooks")
+		}
+	}()
+}
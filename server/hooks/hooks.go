@@ -0,0 +1,106 @@
+package hooks
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"github.com/apex/log"
+	"github.com/avatag-host/claws/config"
+	"github.com/pkg/errors"
+	"os"
+	"os/exec"
+	"strings"
+	"time"
+)
+
+// The lifecycle points that hooks can be run at.
+const (
+	PreStart     = "pre-start"
+	PostStop     = "post-stop"
+	PreBackup    = "pre-backup"
+	FileUploaded = "file-uploaded"
+)
+
+var Events = []string{PreStart, PostStop, PreBackup, FileUploaded}
+
+// The details of an event passed to a hook on stdin.
+type Context struct {
+	Event     string                 `json:"event"`
+	Node      string                 `json:"node"`
+	Server    string                 `json:"server"`
+	Timestamp int64                  `json:"timestamp"`
+	Data      map[string]interface{} `json:"data,omitempty"`
+}
+
+// Runs each of the configured hooks that match the event, one after another. If a hook that
+// is configured to abort on failure fails, an error is returned and the remaining hooks are
+// not run. Any other failures are only logged.
+func Run(hooks []config.HookConfiguration, c Context) error {
+	if c.Timestamp == 0 {
+		c.Timestamp = time.Now().Unix()
+	}
+
+	for _, h := range hooks {
+		if !h.Matches(c.Event, c.Server) {
+			continue
+		}
+
+		if err := run(h, c); err != nil {
+			if h.AbortOnFailure {
+				return err
+			}
+
+			log.WithFields(log.Fields{
+				"event":   c.Event,
+				"server":  c.Server,
+				"command": h.Command,
+				"error":   err,
+			}).Warn("hook failed to run successfully")
+		}
+	}
+
+	return nil
+}
+
+func run(h config.HookConfiguration, c Context) error {
+	b, err := json.Marshal(c)
+	if err != nil {
+		return errors.WithStack(err)
+	}
+
+	timeout := h.Timeout
+	if timeout <= 0 {
+		timeout = 30
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*time.Duration(timeout))
+	defer cancel()
+
+	var stderr bytes.Buffer
+	cmd := exec.CommandContext(ctx, h.Command, h.Args...)
+	cmd.Stdin = bytes.NewReader(b)
+	cmd.Stderr = &stderr
+	cmd.Env = append(os.Environ(),
+		"CLAWS_HOOK_EVENT="+c.Event,
+		"CLAWS_NODE_UUID="+c.Node,
+		"CLAWS_SERVER_UUID="+c.Server,
+	)
+
+	log.WithFields(log.Fields{"event": c.Event, "server": c.Server, "command": h.Command}).Debug("running hook")
+
+	if err := cmd.Run(); err != nil {
+		if ctx.Err() == context.DeadlineExceeded {
+			return errors.New(fmt.Sprintf("hook %s did not complete within %d seconds", h.Command, timeout))
+		}
+
+		msg := strings.TrimSpace(stderr.String())
+		if msg == "" {
+			msg = err.Error()
+		}
+
+		return errors.New(fmt.Sprintf("hook %s failed: %s", h.Command, msg))
+	}
+
+	return nil
+}
@@ -0,0 +1,303 @@
+package server
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"github.com/avatag-host/claws/config"
+	"github.com/avatag-host/claws/environment"
+	"github.com/avatag-host/claws/server/filesystem"
+	"github.com/mholt/archiver/v3"
+	"github.com/pkg/errors"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// The archive that the files for a server are imported from, which is either downloaded from a
+// URL or has already been uploaded to the server directory.
+type ImportSource struct {
+	// The http or https URL to download the archive from.
+	Url string `json:"url"`
+
+	// The path of an archive within the server directory. The archive is removed once it has
+	// been extracted.
+	File string `json:"file"`
+
+	// The hex encoded SHA256 checksum that the archive must match, if provided.
+	Sha256 string `json:"sha256"`
+}
+
+// Checks that exactly one source for the archive is provided, and that it is usable.
+func (src ImportSource) Validate() error {
+	if (src.Url == "") == (src.File == "") {
+		return errors.New("exactly one of url or file must be provided for an import")
+	}
+
+	if src.Url != "" {
+		if err := validateDownloadUrl(src.Url); err != nil {
+			return err
+		}
+	}
+
+	if src.Sha256 != "" {
+		if b, err := hex.DecodeString(src.Sha256); err != nil || len(b) != sha256.Size {
+			return errors.New("import checksum must be a hex encoded SHA256 checksum")
+		}
+	}
+
+	return nil
+}
+
+// The progress of importing the files for a server, as published with the import event.
+type ImportProgress struct {
+	// One of "started", "downloading", "extracting", "completed" or "failed".
+	Status string `json:"status"`
+
+	// The number of bytes of the archive that have been downloaded, and the total size of the
+	// archive if it is known.
+	Bytes int64 `json:"bytes"`
+	Total int64 `json:"total"`
+
+	Error string `json:"error,omitempty"`
+}
+
+// Seeds the server directory with the files from an archive, rather than running the
+// installation script, which allows servers to be migrated from another host. Existing files
+// with the same name are replaced. The archive is subject to the same limits as any other
+// archive decompressed for the server, including the disk space of the server. The Panel is
+// notified of the result in the same way as an installation.
+func (s *Server) Import(src ImportSource) error {
+	if err := src.Validate(); err != nil {
+		return err
+	}
+
+	if err := s.acquireInstallationLock(); err != nil {
+		return errors.WithStack(err)
+	}
+	defer s.installer.sem.Release(1)
+
+	// The files of a hibernated server are replaced when it is restored, so anything imported
+	// now would be lost. This is checked while holding the installation lock, since a server
+	// cannot start hibernating while it is held.
+	if s.IsHibernated() || s.IsHibernating() {
+		return ErrHibernated
+	}
+
+	if s.GetState() != environment.ProcessOfflineState {
+		return ErrIsRunning
+	}
+
+	s.Events().Publish(InstallStartedEvent, "")
+	s.publishImport(ImportProgress{Status: "started"})
+
+	err := s.importArchive(src)
+	if err != nil {
+		s.Log().WithField("error", err).Error("failed to import server files from archive")
+		s.publishImport(ImportProgress{Status: "failed", Error: err.Error()})
+	} else {
+		s.Log().Info("imported server files from archive")
+		s.publishImport(ImportProgress{Status: "completed"})
+	}
+
+	if serr := s.SyncInstallState(err == nil); serr != nil {
+		s.Log().WithField("error", serr).Warn("failed to notify panel of server install state")
+	}
+
+	if err == nil {
+		s.awaitFirstBoot()
+	}
+
+	s.SetState(environment.ProcessOfflineState)
+	s.Events().Publish(InstallCompletedEvent, "")
+
+	return err
+}
+
+func (s *Server) importArchive(src ImportSource) error {
+	if err := s.EnsureDataDirectoryExists(); err != nil {
+		return err
+	}
+
+	p := ""
+	if src.File != "" {
+		cleaned, err := s.Filesystem().SafePath(src.File)
+		if err != nil {
+			return err
+		}
+		p = cleaned
+	} else {
+		downloaded, err := s.downloadImport(src.Url)
+		if downloaded != "" {
+			defer os.Remove(downloaded)
+		}
+		if err != nil {
+			return err
+		}
+		p = downloaded
+	}
+
+	if st, err := os.Stat(p); err != nil {
+		return errors.WithStack(err)
+	} else if st.IsDir() {
+		return filesystem.ErrIsDirectory
+	}
+
+	if src.Sha256 != "" {
+		if checksum, _, err := checksumFile(p); err != nil {
+			return err
+		} else if !strings.EqualFold(checksum, src.Sha256) {
+			return errors.New(fmt.Sprintf("checksum of import archive does not match, expected %s got %s", src.Sha256, checksum))
+		}
+	}
+
+	s.publishImport(ImportProgress{Status: "extracting"})
+
+	if ok, err := s.Filesystem().SpaceAvailableForArchive(p); err != nil {
+		return err
+	} else if !ok {
+		return filesystem.ErrNotEnoughDiskSpace
+	}
+
+	if err := s.Filesystem().ExtractArchive(p, "/"); err != nil {
+		return err
+	}
+
+	if src.File != "" {
+		if err := os.Remove(p); err != nil && !os.IsNotExist(err) {
+			s.Log().WithField("error", err).Warn("failed to remove import archive after extracting it")
+		}
+	}
+
+	if err := s.Filesystem().Chown("/"); err != nil {
+		s.Log().WithField("error", err).Warn("failed to set ownership of imported server files")
+	}
+
+	// Force a recalculation of the disk usage for the server since the files have changed.
+	go s.Filesystem().HasSpaceAvailable(false)
+
+	return nil
+}
+
+// Downloads the archive to import into the archive directory, returning the path that it was
+// written to. The archive cannot be larger than the maximum size of an extracted archive or the
+// disk space of the server, since it could never be extracted successfully. The path is returned
+// with any error once the file has been created, so that the caller can remove it. Archives are
+// downloaded with the same client as pulled files, which refuses local and private addresses.
+func (s *Server) downloadImport(u string) (string, error) {
+	res, err := openDownload(context.Background(), u)
+	if err != nil {
+		return "", err
+	}
+	defer res.Body.Close()
+
+	var limit int64 = -1
+	if max := config.Get().System.Extraction.MaxSize; max > 0 {
+		limit = max * 1024 * 1024
+	}
+	if d := s.Filesystem().MaxDisk(); d > 0 && (limit < 0 || d < limit) {
+		limit = d
+	}
+
+	if limit >= 0 && res.ContentLength > limit {
+		return "", filesystem.ErrNotEnoughDiskSpace
+	}
+
+	// The format of the archive is determined by the extension of the file, so keep the one
+	// of the downloaded file when it is recognized.
+	ext := ""
+	if name := downloadName(res); name != "" {
+		if _, err := archiver.ByExtension(name); err == nil {
+			ext = importExtension(name)
+		}
+	}
+
+	p := filepath.Join(config.Get().System.ArchiveDirectory, s.Id()+"-import"+ext)
+	f, err := os.OpenFile(p, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0600)
+	if err != nil {
+		return "", errors.WithStack(err)
+	}
+	defer f.Close()
+
+	var r io.Reader = res.Body
+	if limit >= 0 {
+		// Read one byte more than the limit so that an archive exceeding it can be detected
+		// when the server does not report the length of the file upfront.
+		r = io.LimitReader(res.Body, limit+1)
+	}
+
+	n, err := io.Copy(f, newProgressReader(r, func(n int64) {
+		s.publishImport(ImportProgress{Status: "downloading", Bytes: n, Total: res.ContentLength})
+	}))
+	if err != nil {
+		return p, errors.WithStack(err)
+	}
+
+	if limit >= 0 && n > limit {
+		return p, filesystem.ErrNotEnoughDiskSpace
+	}
+
+	if err := f.Close(); err != nil {
+		return p, errors.WithStack(err)
+	}
+
+	s.publishImport(ImportProgress{Status: "downloading", Bytes: n, Total: n})
+
+	if ext != "" {
+		return p, nil
+	}
+
+	return s.detectImportFormat(p)
+}
+
+// Renames a downloaded archive without a recognized extension to use the extension of the
+// format detected from its contents, returning the new path.
+func (s *Server) detectImportFormat(p string) (string, error) {
+	f, err := os.Open(p)
+	if err != nil {
+		return p, errors.WithStack(err)
+	}
+
+	u, err := archiver.ByHeader(f)
+	f.Close()
+	if err != nil {
+		return p, filesystem.ErrUnknownArchiveFormat
+	}
+
+	var ext string
+	switch u.(type) {
+	case *archiver.Zip:
+		ext = ".zip"
+	case *archiver.Tar:
+		ext = ".tar"
+	case *archiver.Rar:
+		ext = ".rar"
+	default:
+		return p, filesystem.ErrUnknownArchiveFormat
+	}
+
+	if err := os.Rename(p, p+ext); err != nil {
+		return p, errors.WithStack(err)
+	}
+
+	return p + ext, nil
+}
+
+// Returns the extension of an archive name recognized by the archiver, including the
+// compression used for tarballs.
+func importExtension(name string) string {
+	name = strings.ToLower(name)
+	for _, ext := range []string{".tar.gz", ".tar.bz2", ".tar.xz", ".tar.lz4", ".tar.sz", ".tar.zst", ".tar.br"} {
+		if strings.HasSuffix(name, ext) {
+			return ext
+		}
+	}
+
+	return filepath.Ext(name)
+}
+
+func (s *Server) publishImport(p ImportProgress) {
+	_ = s.Events().PublishJson(ImportEvent, p)
+}
@@ -18,7 +18,9 @@ import (
 	"io"
 	"os"
 	"path/filepath"
+	"regexp"
 	"strconv"
+	"strings"
 	"time"
 )
 
@@ -36,15 +38,21 @@ func (s *Server) Install(sync bool) error {
 	}
 
 	var err error
-	if !s.Config().SkipEggScripts {
+	if s.Config().SkipEggScripts {
+		s.Log().Info("server configured to skip running installation scripts for this egg, not executing process")
+	} else if !SupportsInstallScripts() {
+		// Installation scripts are always executed inside of a Docker container, so they cannot
+		// be run for servers using the host process or LXD environments. This is reported as a
+		// failed installation rather than pretending the script was run.
+		s.Log().WithField("environment", config.Get().Environment).Warn("installation scripts are not supported by the environment, not executing process")
+		err = ErrInstallUnsupported
+	} else {
 		// Send the start event so the Panel can automatically update. We don't send this unless the process
 		// is actually going to run, otherwise all sorts of weird rapid UI behavior happens since there isn't
 		// an actual install process being executed.
 		s.Events().Publish(InstallStartedEvent, "")
 
 		err = s.internalInstall()
-	} else {
-		s.Log().Info("server configured to skip running installation scripts for this egg, not executing process")
 	}
 
 	s.Log().Debug("notifying panel of server install state")
@@ -61,6 +69,12 @@ func (s *Server) Install(sync bool) error {
 		l.Warn("failed to notify panel of server install state")
 	}
 
+	// The first boot actions are performed again after every successful installation, since
+	// the installation script can replace the files that they write.
+	if err == nil {
+		s.awaitFirstBoot()
+	}
+
 	// Ensure that the server is marked as offline at this point, otherwise you end up
 	// with a blank value which is a bit confusing.
 	s.SetState(environment.ProcessOfflineState)
@@ -72,6 +86,14 @@ func (s *Server) Install(sync bool) error {
 	return err
 }
 
+// Determines if installation scripts can be run for servers using the configured environment.
+// They are always executed inside of a Docker container.
+func SupportsInstallScripts() bool {
+	env := config.Get().Environment
+
+	return env != config.EnvironmentProcess && env != config.EnvironmentLxd
+}
+
 // Reinstalls a server's software by utilizing the install script for the server egg. This
 // does not touch any existing files for the server, other than what the script modifies.
 func (s *Server) Reinstall() error {
@@ -87,7 +109,7 @@ func (s *Server) Reinstall() error {
 
 // Internal installation function used to simplify reporting back to the Panel.
 func (s *Server) internalInstall() error {
-	script, err := api.New().GetInstallationScript(s.Id())
+	script, err := s.panelApi().GetInstallationScript(s.Id())
 	if err != nil {
 		if !api.IsRequestError(err) {
 			return errors.WithStack(err)
@@ -110,26 +132,92 @@ func (s *Server) internalInstall() error {
 	return nil
 }
 
+// Details about an installation process that would be executed for a server, used to
+// debug installation scripts without actually running anything.
+type InstallationDryRun struct {
+	ContainerImage string   `json:"container_image"`
+	Entrypoint     string   `json:"entrypoint"`
+	Script         string   `json:"script"`
+	Environment    []string `json:"environment"`
+
+	// The resource limits that would be applied to the installation container.
+	Limits config.InstallerLimits `json:"limits"`
+}
+
+var installScriptVariableRegex = regexp.MustCompile(`\$\{([A-Za-z_][A-Za-z0-9_]*)\}|\$([A-Za-z_][A-Za-z0-9_]*)`)
+
+// Returns the installation script for the server with all of the known environment variables
+// substituted into it, along with the image and entrypoint that would be used to run it. This
+// does not create any containers or modify any files for the server.
+func (s *Server) DryRunInstall() (*InstallationDryRun, error) {
+	script, err := s.panelApi().GetInstallationScript(s.Id())
+	if err != nil {
+		if !api.IsRequestError(err) {
+			return nil, errors.WithStack(err)
+		}
+
+		return nil, errors.New(err.Error())
+	}
+
+	env := s.GetEnvironmentVariables()
+	vars := make(map[string]string, len(env))
+	for _, v := range env {
+		if parts := strings.SplitN(v, "=", 2); len(parts) == 2 {
+			vars[parts[0]] = parts[1]
+		}
+	}
+
+	// Only replace the variables that we actually know about, anything else is most likely
+	// a variable defined within the script itself and should be left untouched.
+	rendered := installScriptVariableRegex.ReplaceAllStringFunc(script.Script, func(m string) string {
+		match := installScriptVariableRegex.FindStringSubmatch(m)
+
+		name := match[1]
+		if name == "" {
+			name = match[2]
+		}
+
+		if v, ok := vars[name]; ok {
+			return v
+		}
+
+		return m
+	})
+
+	return &InstallationDryRun{
+		ContainerImage: script.ContainerImage,
+		Entrypoint:     script.Entrypoint,
+		Script:         rendered,
+		Environment:    env,
+		Limits:         s.installerLimits(),
+	}, nil
+}
+
 type InstallationProcess struct {
 	Server *Server
 	Script *api.InstallationScript
 
 	client  *client.Client
 	context context.Context
+
+	// The time this installation attempt was started at, used to name the log file
+	// for the attempt.
+	startedAt time.Time
 }
 
 // Generates a new installation process struct that will be used to create containers,
 // and otherwise perform installation commands for a server.
 func NewInstallationProcess(s *Server, script *api.InstallationScript) (*InstallationProcess, error) {
 	proc := &InstallationProcess{
-		Script: script,
-		Server: s,
+		Script:    script,
+		Server:    s,
+		startedAt: time.Now().UTC(),
 	}
 
 	ctx, cancel := context.WithCancel(context.Background())
 	s.installer.cancel = &cancel
 
-	if c, err := environment.DockerClient(); err != nil {
+	if c, err := environment.DockerClientFor(s.Config().Container.DockerEndpoint); err != nil {
 		return nil, errors.WithStack(err)
 	} else {
 		proc.client = c
@@ -223,7 +311,15 @@ func (ip *InstallationProcess) Run() error {
 
 	cid, err := ip.Execute()
 	if err != nil {
-		ip.RemoveContainer()
+		// The output of an installation that timed out is the most useful to look at, so the
+		// log for it is written before the container is removed.
+		if errors.Is(err, ErrInstallTimeout) && cid != "" {
+			if err := ip.AfterExecute(cid); err != nil {
+				ip.Server.Log().WithField("error", err).Warn("failed to write installation log for timed out installation process")
+			}
+		} else {
+			ip.RemoveContainer()
+		}
 
 		return errors.WithStack(err)
 	}
@@ -275,7 +371,17 @@ func (ip *InstallationProcess) writeScriptToDisk() error {
 
 // Pulls the docker image to be used for the installation container.
 func (ip *InstallationProcess) pullInstallationImage() error {
-	r, err := ip.client.ImagePull(ip.context, ip.Script.ContainerImage, types.ImagePullOptions{})
+	opts := types.ImagePullOptions{}
+	if auth := config.Get().Docker.RegistryAuthFor(ip.Script.ContainerImage, ip.Server.Config().Container.RegistryAuth); auth != nil {
+		b64, err := auth.Base64()
+		if err != nil {
+			return errors.WithStack(err)
+		}
+
+		opts.RegistryAuth = b64
+	}
+
+	r, err := ip.client.ImagePull(ip.context, ip.Script.ContainerImage, opts)
 	if err != nil {
 		return errors.WithStack(err)
 	}
@@ -319,9 +425,10 @@ func (ip *InstallationProcess) BeforeExecute() error {
 	return nil
 }
 
-// Returns the log path for the installation process.
+// Returns the log path for this attempt of the installation process. Each attempt is
+// written to its own file so that the output of previous failed attempts is not lost.
 func (ip *InstallationProcess) GetLogPath() string {
-	return filepath.Join(config.Get().System.GetInstallLogPath(), ip.Server.Id()+".log")
+	return filepath.Join(ip.Server.installLogDirectory(), ip.startedAt.Format(installLogTimeFormat)+".log")
 }
 
 // Cleans up after the execution of the installation process. This grabs the logs from the
@@ -341,12 +448,22 @@ func (ip *InstallationProcess) AfterExecute(containerId string) error {
 		return errors.WithStack(err)
 	}
 
+	if err := os.MkdirAll(ip.Server.installLogDirectory(), 0700); err != nil {
+		return errors.WithStack(err)
+	}
+
 	f, err := os.OpenFile(ip.GetLogPath(), os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0600)
 	if err != nil {
 		return errors.WithStack(err)
 	}
 	defer f.Close()
 
+	defer func() {
+		if err := ip.Server.rotateInstallLogs(); err != nil {
+			ip.Server.Log().WithField("error", err).Warn("failed to rotate server installation logs")
+		}
+	}()
+
 	// We write the contents of the container output to a more "permanent" file so that they
 	// can be referenced after this container is deleted. We'll also include the environment
 	// variables passed into the container to make debugging things a little easier.
@@ -434,6 +551,7 @@ func (ip *InstallationProcess) Execute() (string, error) {
 		},
 		Privileged:  true,
 		NetworkMode: container.NetworkMode(config.Get().Docker.Network.Mode),
+		Resources:   ip.resources(),
 	}
 
 	ip.Server.Log().WithField("install_script", ip.tempDir()+"/install.sh").Info("creating install container for server process")
@@ -464,10 +582,27 @@ func (ip *InstallationProcess) Execute() (string, error) {
 		ip.Server.Events().Publish(DaemonMessageEvent, "Installation process completed.")
 	}(r.ID)
 
-	sChan, eChan := ip.client.ContainerWait(ip.context, r.ID, container.WaitConditionNotRunning)
+	// If a timeout is configured for the installer, only wait that long for the container to
+	// finish running. Once that deadline passes the container is forcibly removed by the caller
+	// and the installation is reported as having failed. The ID of the container is returned
+	// along with the timeout error so that the caller can still collect its output.
+	ctx := ip.context
+	if t := ip.Server.installerLimits().Timeout; t > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ip.context, time.Second*time.Duration(t))
+		defer cancel()
+	}
+
+	sChan, eChan := ip.client.ContainerWait(ctx, r.ID, container.WaitConditionNotRunning)
 	select {
 	case err := <-eChan:
 		if err != nil {
+			if errors.Is(ctx.Err(), context.DeadlineExceeded) {
+				ip.Server.Events().Publish(DaemonMessageEvent, "Installation process exceeded the maximum allowed run time and has been aborted.")
+
+				return r.ID, ErrInstallTimeout
+			}
+
 			return "", errors.WithStack(err)
 		}
 	case <-sChan:
@@ -476,6 +611,35 @@ func (ip *InstallationProcess) Execute() (string, error) {
 	return r.ID, nil
 }
 
+// Returns the node installer limits merged with any overrides defined for the server.
+func (s *Server) installerLimits() config.InstallerLimits {
+	return config.Get().Docker.Installer.Merge(s.Config().Installer)
+}
+
+// Converts the installer limits into the resource structure used by Docker when creating
+// the container.
+func (ip *InstallationProcess) resources() container.Resources {
+	l := ip.Server.installerLimits()
+
+	r := container.Resources{}
+	if l.Memory > 0 {
+		r.Memory = l.Memory * 1_000_000
+		r.MemoryReservation = r.Memory
+		r.MemorySwap = r.Memory
+	}
+
+	if l.Cpu > 0 {
+		r.CPUQuota = l.Cpu * 1000
+		r.CPUPeriod = 100_000
+	}
+
+	if l.Pids > 0 {
+		r.PidsLimit = &l.Pids
+	}
+
+	return r
+}
+
 // Streams the output of the installation process to a log file in the server configuration
 // directory, as well as to a websocket listener so that the process can be viewed in
 // the panel by administrators.
@@ -512,7 +676,7 @@ func (ip *InstallationProcess) StreamOutput(id string) error {
 // value of "true" means everything was successful, "false" means something went
 // wrong and the server must be deleted and re-created.
 func (s *Server) SyncInstallState(successful bool) error {
-	err := api.New().SendInstallationStatus(s.Id(), successful)
+	err := s.panelApi().SendInstallationStatus(s.Id(), successful)
 	if err != nil {
 		if !api.IsRequestError(err) {
 			return errors.WithStack(err)
@@ -0,0 +1,147 @@
+package server
+
+import (
+	"bufio"
+	"github.com/pkg/errors"
+	"github.com/avatag-host/claws/config"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"time"
+)
+
+// The format used when naming the log file for an installation attempt. This sorts
+// lexicographically which allows us to avoid parsing every file name when determining
+// which logs are the oldest. The fixed width nanoseconds keep two attempts started within
+// the same second from writing to the same file.
+const installLogTimeFormat = "20060102T150405.000000000Z"
+
+// The format used for the log files written by older versions of Wings, which are still
+// listed alongside the newer logs.
+const legacyInstallLogTimeFormat = "20060102T150405Z"
+
+var installLogNameRegex = regexp.MustCompile(`^\d{8}T\d{6}(\.\d{9})?Z\.log$`)
+
+var ErrInvalidInstallLog = errors.New("server: invalid installation log name provided")
+
+// Details about a single installation attempt log stored on the disk.
+type InstallLog struct {
+	Name      string    `json:"name"`
+	Size      int64     `json:"size"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// Returns the directory where all of the installation logs for this server are stored.
+func (s *Server) installLogDirectory() string {
+	return filepath.Join(config.Get().System.GetInstallLogPath(), s.Id())
+}
+
+// Returns all of the installation logs that exist for the server, ordered from the most
+// recent attempt to the oldest.
+func (s *Server) InstallLogs() ([]InstallLog, error) {
+	out := make([]InstallLog, 0)
+
+	files, err := ioutil.ReadDir(s.installLogDirectory())
+	if err != nil {
+		if os.IsNotExist(err) {
+			return out, nil
+		}
+
+		return nil, errors.WithStack(err)
+	}
+
+	for _, f := range files {
+		if f.IsDir() || !installLogNameRegex.MatchString(f.Name()) {
+			continue
+		}
+
+		l := InstallLog{Name: f.Name(), Size: f.Size(), CreatedAt: f.ModTime()}
+		for _, format := range []string{installLogTimeFormat, legacyInstallLogTimeFormat} {
+			if t, err := time.Parse(format, f.Name()[:len(f.Name())-4]); err == nil {
+				l.CreatedAt = t
+				break
+			}
+		}
+
+		out = append(out, l)
+	}
+
+	sort.SliceStable(out, func(i, j int) bool {
+		return out[i].Name > out[j].Name
+	})
+
+	return out, nil
+}
+
+// Returns the full path to a specific installation log for the server. An error is
+// returned if the name is not a valid log name.
+func (s *Server) InstallLogPath(name string) (string, error) {
+	if !installLogNameRegex.MatchString(name) {
+		return "", ErrInvalidInstallLog
+	}
+
+	return filepath.Join(s.installLogDirectory(), name), nil
+}
+
+// Reads up to the last n lines of the most recent installation log for the server. If the
+// server has never been installed an empty slice is returned.
+func (s *Server) ReadInstallLog(n int) ([]string, error) {
+	logs, err := s.InstallLogs()
+	if err != nil || len(logs) == 0 {
+		return []string{}, err
+	}
+
+	f, err := os.Open(filepath.Join(s.installLogDirectory(), logs[0].Name))
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+	defer f.Close()
+
+	var out []string
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		out = append(out, scanner.Text())
+		if len(out) > n {
+			out = out[1:]
+		}
+	}
+
+	if err := scanner.Err(); err != nil {
+		return nil, errors.WithStack(err)
+	}
+
+	return out, nil
+}
+
+// Removes all of the installation logs for the server.
+func (s *Server) RemoveInstallLogs() error {
+	return errors.WithStack(os.RemoveAll(s.installLogDirectory()))
+}
+
+// Removes the oldest installation logs for the server until only the configured number
+// of logs remain on the disk.
+func (s *Server) rotateInstallLogs() error {
+	keep := config.Get().System.InstallLogRetention
+	if keep <= 0 {
+		return nil
+	}
+
+	logs, err := s.InstallLogs()
+	if err != nil {
+		return err
+	}
+
+	if len(logs) <= keep {
+		return nil
+	}
+
+	for _, l := range logs[keep:] {
+		if err := os.Remove(filepath.Join(s.installLogDirectory(), l.Name)); err != nil && !os.IsNotExist(err) {
+			return errors.WithStack(err)
+		}
+	}
+
+	return nil
+}
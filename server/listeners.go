@@ -8,7 +8,7 @@ import (
 	"github.com/avatag-host/claws/config"
 	"github.com/avatag-host/claws/environment"
 	"github.com/avatag-host/claws/events"
-	"regexp"
+	"github.com/avatag-host/claws/server/ansi"
 	"strconv"
 	"sync"
 )
@@ -101,6 +101,12 @@ func (s *Server) StartEventListeners() {
 		}
 
 		s.SetState(e.Data)
+
+		// If the server is configured to use a readiness check rather than console output to
+		// determine when it has started, begin probing the allocation now.
+		if e.Data == environment.ProcessStartingState {
+			go s.awaitReadiness()
+		}
 	}
 
 	stats := func(e events.Event) {
@@ -115,6 +121,10 @@ func (s *Server) StartEventListeners() {
 		s.resources.Stats = *st
 		s.resources.mu.Unlock()
 
+		if config.Get().System.ResourceHistoryRetention > 0 {
+			s.ResourceHistory().Observe(st.CpuAbsolute, st.Memory)
+		}
+
 		// If there is no disk space available at this point, trigger the server disk limiter logic
 		// which will start to stop the running instance.
 		if !s.Filesystem().HasSpaceAvailable(true) {
@@ -141,9 +151,11 @@ func (s *Server) StartEventListeners() {
 	for _, evt := range dockerEvents {
 		s.Environment.Events().On(evt, &docker)
 	}
-}
 
-var stripAnsiRegex = regexp.MustCompile("[\u001B\u009B][[\\]()#;?]*(?:(?:(?:[a-zA-Z\\d]*(?:;[a-zA-Z\\d]*)*)?\u0007)|(?:(?:\\d{1,4}(?:;\\d{0,4})*)?[\\dA-PRZcf-ntqry=><~]))")
+	s.startLogShipping()
+	s.startEventBridge()
+	s.startAutomation()
+}
 
 // Custom listener for console output events that will check if the given line
 // of output matches one that should mark the server as started or not.
@@ -151,12 +163,13 @@ func (s *Server) onConsoleOutput(data string) {
 	// Get the server's process configuration.
 	processConfiguration := s.ProcessConfiguration()
 
-	// Check if the server is currently starting.
-	if s.GetState() == environment.ProcessStartingState {
+	// Check if the server is currently starting. When a readiness check is configured the
+	// console output is ignored and the allocation probe will mark the server as running.
+	if s.GetState() == environment.ProcessStartingState && !processConfiguration.Startup.Readiness.Enabled() {
 		// Check if we should strip ansi color codes.
 		if processConfiguration.Startup.StripAnsi {
 			// Strip ansi color codes from the data string.
-			data = stripAnsiRegex.ReplaceAllString(data, "")
+			data = ansi.Strip(data)
 		}
 
 		// Iterate over all the done lines.
@@ -178,6 +191,8 @@ func (s *Server) onConsoleOutput(data string) {
 		}
 	}
 
+	s.answerFirstBootPrompts(data)
+
 	// If the command sent to the server is one that should stop the server we will need to
 	// set the server to be in a stopping state, otherwise crash detection will kick in and
 	// cause the server to unexpectedly restart on the user.
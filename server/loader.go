@@ -11,6 +11,8 @@ import (
 	"github.com/avatag-host/claws/config"
 	"github.com/avatag-host/claws/environment"
 	"github.com/avatag-host/claws/environment/docker"
+	"github.com/avatag-host/claws/environment/lxd"
+	"github.com/avatag-host/claws/environment/process"
 	"github.com/avatag-host/claws/server/filesystem"
 	"os"
 	"path/filepath"
@@ -41,6 +43,24 @@ func LoadDirectory() error {
 		return errors.New(err.Error())
 	}
 
+	// Tracks the Panel that each of the server configurations was returned by.
+	panels := make(map[string]string)
+
+	// Servers belonging to additional Panels are loaded as well, however a Panel that cannot be
+	// reached should not prevent the servers for the other Panels from booting.
+	for _, p := range config.Get().Panels {
+		pc, err := api.NewForPanel(p.Name).GetServers()
+		if err != nil {
+			log.WithField("panel", p.Name).WithField("error", err).Error("failed to fetch list of servers from additional panel, skipping...")
+			continue
+		}
+
+		for _, data := range pc {
+			panels[data.Uuid] = p.Name
+		}
+		configs = append(configs, pc...)
+	}
+
 	start := time.Now()
 	log.WithField("total_configs", len(configs)).Info("processing servers returned by the API")
 
@@ -55,6 +75,7 @@ func LoadDirectory() error {
 			// messaging in the output.
 			d := api.ServerConfigurationResponse{
 				Settings: data.Settings,
+				Panel:    panels[data.Uuid],
 			}
 
 			log.WithField("server", data.Uuid).Info("creating new server object from API response")
@@ -98,6 +119,7 @@ func FromConfiguration(data api.ServerConfigurationResponse) (*Server, error) {
 	}
 
 	s.cfg = cfg
+	s.panel = data.Panel
 	if err := s.UpdateDataStructure(data.Settings); err != nil {
 		return nil, err
 	}
@@ -108,28 +130,51 @@ func FromConfiguration(data api.ServerConfigurationResponse) (*Server, error) {
 	s.Archiver = Archiver{Server: s}
 	s.fs = filesystem.New(filepath.Join(config.Get().System.Data, s.Id()), s.DiskSpace())
 
-	// Right now we only support a Docker based environment, so I'm going to hard code
-	// this logic in. When we're ready to support other environment we'll need to make
-	// some modifications here obviously.
+	// Give the server its own user so that its process and files are isolated from those of
+	// the other servers on the node.
+	if config.Get().System.PerServerUsers.Enabled {
+		uid, err := allocateServerUser(s.Id())
+		if err != nil {
+			return nil, err
+		}
+
+		s.uid = uid
+		s.fs.SetOwner(s.User())
+	}
+
+	// Servers run inside of Docker containers unless the node has been configured to use
+	// the host process or LXD environments instead.
 	settings := environment.Settings{
 		Mounts:      s.Mounts(),
 		Allocations: s.cfg.Allocations,
 		Limits:      s.cfg.Build,
+		Container:   s.cfg.Container,
+
+		StatsInterval: s.cfg.StatsInterval,
 	}
+	settings.Uid, settings.Gid = s.User()
 
 	envCfg := environment.NewConfiguration(settings, s.GetEnvironmentVariables())
-	meta := docker.Metadata{
-		Image: s.Config().Container.Image,
+
+	var env environment.ProcessEnvironment
+	var err error
+	switch config.Get().Environment {
+	case config.EnvironmentProcess:
+		env, err = process.New(s.Id(), &process.Metadata{}, envCfg)
+	case config.EnvironmentLxd:
+		env, err = lxd.New(s.Id(), &lxd.Metadata{}, envCfg)
+	default:
+		env, err = docker.New(s.Id(), &docker.Metadata{Image: s.Config().Container.Image}, envCfg)
 	}
 
-	if env, err := docker.New(s.Id(), &meta, envCfg); err != nil {
+	if err != nil {
 		return nil, err
-	} else {
-		s.Environment = env
-		s.StartEventListeners()
-		s.Throttler().StartTimer()
 	}
 
+	s.Environment = env
+	s.StartEventListeners()
+	s.Throttler().StartTimer()
+
 	// Forces the configuration to be synced with the panel.
 	if err := s.SyncWithConfiguration(data); err != nil {
 		return nil, err
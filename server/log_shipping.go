@@ -0,0 +1,56 @@
+package server
+
+import (
+	"github.com/avatag-host/claws/config"
+	"github.com/avatag-host/claws/events"
+	"github.com/avatag-host/claws/server/ansi"
+	"github.com/avatag-host/claws/server/shipping"
+	"time"
+)
+
+var shipper *shipping.Shipper
+
+// Starts shipping the logs for servers to the configured log store, if enabled. This must be
+// called before any servers are loaded so that their listeners are registered.
+func ConfigureLogShipping() {
+	cfg := config.Get().System.LogShipping
+	if !cfg.Enabled {
+		return
+	}
+
+	shipper = shipping.New(cfg, config.Get().Uuid)
+	go shipper.Run()
+}
+
+// Registers the listeners that send the console output and daemon messages for the server to
+// the log shipper, if logs are being shipped for this server.
+func (s *Server) startLogShipping() {
+	if shipper == nil || !config.Get().System.LogShipping.ShouldShip(s.Id()) {
+		return
+	}
+
+	streams := map[string]string{
+		ConsoleOutputEvent: shipping.StreamConsole,
+		DaemonMessageEvent: shipping.StreamDaemon,
+		InstallOutputEvent: shipping.StreamInstall,
+		StatusEvent:        shipping.StreamDaemon,
+	}
+
+	listener := func(e events.Event) {
+		line := e.Data
+		if e.Topic == StatusEvent {
+			line = "server state changed to " + e.Data
+		}
+
+		shipper.Push(shipping.Entry{
+			Time:   time.Now(),
+			Server: s.Id(),
+			Stream: streams[e.Topic],
+			Line:   ansi.Strip(line),
+		})
+	}
+
+	for topic := range streams {
+		s.Events().On(topic, &listener)
+	}
+}
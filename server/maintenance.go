@@ -0,0 +1,110 @@
+package server
+
+import (
+	"encoding/json"
+	"github.com/apex/log"
+	"github.com/avatag-host/claws/config"
+	"github.com/pkg/errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+// The state of maintenance mode for the node. While the node is in maintenance mode servers
+// cannot be started and servers cannot be transferred to the node, but running servers can
+// still be stopped and their files accessed, allowing the node to be drained before it is
+// taken offline.
+type MaintenanceState struct {
+	Enabled bool       `json:"enabled"`
+	Reason  string     `json:"reason,omitempty"`
+	Since   *time.Time `json:"since,omitempty"`
+}
+
+var maintenance struct {
+	sync.RWMutex
+	once  sync.Once
+	state MaintenanceState
+}
+
+// Returns the path to the file that the maintenance state is stored in, so that it persists
+// when the node is rebooted.
+func maintenancePath() string {
+	return filepath.Join(config.Get().System.RootDirectory, ".maintenance")
+}
+
+// Returns the current maintenance state of the node.
+func Maintenance() MaintenanceState {
+	maintenance.once.Do(loadMaintenance)
+
+	maintenance.RLock()
+	defer maintenance.RUnlock()
+
+	return maintenance.state
+}
+
+// Determines if the node is currently in maintenance mode.
+func IsMaintenanceMode() bool {
+	return Maintenance().Enabled
+}
+
+// Enables or disables maintenance mode for the node, storing the state on the disk.
+func SetMaintenance(enabled bool, reason string) (MaintenanceState, error) {
+	maintenance.once.Do(loadMaintenance)
+
+	maintenance.Lock()
+	defer maintenance.Unlock()
+
+	state := MaintenanceState{Enabled: enabled}
+	if enabled {
+		state.Reason = reason
+		if maintenance.state.Enabled {
+			state.Since = maintenance.state.Since
+		} else {
+			t := time.Now().UTC()
+			state.Since = &t
+		}
+
+		b, err := json.Marshal(state)
+		if err != nil {
+			return maintenance.state, errors.WithStack(err)
+		}
+
+		if err := ioutil.WriteFile(maintenancePath(), b, 0600); err != nil {
+			return maintenance.state, errors.WithStack(err)
+		}
+	} else if err := os.Remove(maintenancePath()); err != nil && !os.IsNotExist(err) {
+		return maintenance.state, errors.WithStack(err)
+	}
+
+	maintenance.state = state
+
+	log.WithFields(log.Fields{"enabled": enabled, "reason": reason}).Info("updated node maintenance mode")
+
+	return state, nil
+}
+
+func loadMaintenance() {
+	b, err := ioutil.ReadFile(maintenancePath())
+	if err != nil {
+		if !os.IsNotExist(err) {
+			log.WithField("error", err).Warn("failed to read node maintenance state from disk")
+		}
+		return
+	}
+
+	var state MaintenanceState
+	if err := json.Unmarshal(b, &state); err != nil {
+		log.WithField("error", err).Warn("failed to parse node maintenance state from disk")
+		return
+	}
+
+	maintenance.Lock()
+	maintenance.state = state
+	maintenance.Unlock()
+
+	if state.Enabled {
+		log.WithField("reason", state.Reason).Warn("node is in maintenance mode, servers will not be started")
+	}
+}
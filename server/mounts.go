@@ -4,6 +4,8 @@ import (
 	"github.com/apex/log"
 	"github.com/avatag-host/claws/config"
 	"github.com/avatag-host/claws/environment"
+	"github.com/pkg/errors"
+	"os"
 	"path/filepath"
 	"strings"
 )
@@ -31,41 +33,88 @@ func (s *Server) Mounts() []environment.Mount {
 	return append(m, s.customMounts()...)
 }
 
-// Returns the custom mounts for a given server after verifying that they are within a list of
-// allowed mount points for the node.
-func (s *Server) customMounts() []environment.Mount {
-	var mounts []environment.Mount
+// Describes a custom mount for a server and whether it is allowed by the configuration of the
+// node. Mounts that are not allowed are skipped when the server is started.
+type MountStatus struct {
+	Mount
+	Allowed bool   `json:"allowed"`
+	Error   string `json:"error,omitempty"`
+}
+
+// Checks that a custom mount is allowed by the configuration of the node, returning an error
+// that describes why the mount was denied if it is not.
+func ValidateMount(m Mount) error {
+	source := filepath.Clean(m.Source)
+	target := filepath.Clean(m.Target)
+
+	if !filepath.IsAbs(source) {
+		return errors.New("the source path must be an absolute path")
+	}
+
+	if !filepath.IsAbs(target) {
+		return errors.New("the target path must be an absolute path")
+	}
 
-	// TODO: probably need to handle things trying to mount directories that do not exist.
-	for _, m := range s.Config().Mounts {
-		source := filepath.Clean(m.Source)
-		target := filepath.Clean(m.Target)
-
-		logger := s.Log().WithFields(log.Fields{
-			"source_path": source,
-			"target_path": target,
-			"read_only":   m.ReadOnly,
-		})
-
-		mounted := false
-		for _, allowed := range config.Get().AllowedMounts {
-			if !strings.HasPrefix(source, allowed) {
-				continue
-			}
-
-			mounted = true
-			mounts = append(mounts, environment.Mount{
-				Source:   source,
-				Target:   target,
-				ReadOnly: m.ReadOnly,
-			})
+	if target == "/" || target == "/home/container" || strings.HasPrefix(target, "/home/container/") {
+		return errors.New("the target path cannot be the server data directory or within it")
+	}
 
+	var allowed bool
+	for _, a := range config.Get().AllowedMounts {
+		a = filepath.Clean(a)
+		if source == a || strings.HasPrefix(source, strings.TrimSuffix(a, "/")+"/") {
+			allowed = true
 			break
 		}
+	}
+
+	if !allowed {
+		return errors.New("the source path is not within any of the allowed mount points for this node")
+	}
+
+	if _, err := os.Stat(source); err != nil {
+		if os.IsNotExist(err) {
+			return errors.New("the source path does not exist on this node")
+		}
 
-		if !mounted {
-			logger.Warn("skipping custom server mount, not in list of allowed mount points")
+		return errors.WithStack(err)
+	}
+
+	return nil
+}
+
+// Returns the status of each of the given custom mounts for the server.
+func (s *Server) MountStatuses(mounts []Mount) []MountStatus {
+	out := make([]MountStatus, len(mounts))
+	for i, m := range mounts {
+		out[i] = MountStatus{Mount: Mount{Source: filepath.Clean(m.Source), Target: filepath.Clean(m.Target), ReadOnly: m.ReadOnly}, Allowed: true}
+
+		if err := ValidateMount(m); err != nil {
+			out[i].Allowed = false
+			out[i].Error = err.Error()
+		}
+	}
+
+	return out
+}
+
+// Returns the custom mounts for a given server after verifying that they are allowed by the
+// configuration of the node.
+func (s *Server) customMounts() []environment.Mount {
+	var mounts []environment.Mount
+
+	for _, m := range s.MountStatuses(s.Config().Mounts) {
+		if !m.Allowed {
+			s.Log().WithFields(log.Fields{
+				"source_path": m.Source,
+				"target_path": m.Target,
+				"read_only":   m.ReadOnly,
+				"reason":      m.Error,
+			}).Warn("skipping custom server mount, mount is not allowed")
+			continue
 		}
+
+		mounts = append(mounts, environment.Mount(m.Mount))
 	}
 
 	return mounts
@@ -0,0 +1,57 @@
+package server
+
+import (
+	"time"
+)
+
+// The progress of repairing the permissions for the server files, as published with the
+// permissions repair event.
+type PermissionsRepairProgress struct {
+	// One of "started", "running", "completed" or "failed".
+	Status string `json:"status"`
+
+	// The number of files that have been processed.
+	Files int64 `json:"files"`
+
+	Error string `json:"error,omitempty"`
+}
+
+// Sets the owner and permissions of every file for the server, in the same way as the check
+// performed when the server boots, without requiring the server to be restarted. The progress
+// is published to the server event bus, and the number of files processed is returned.
+func (s *Server) RepairPermissions() (int64, error) {
+	if !s.repairingPermissions.SetIfFalse() {
+		return 0, ErrPermissionsRepairInProgress
+	}
+	defer s.repairingPermissions.Set(false)
+
+	s.Log().Info("repairing permissions for server files")
+	s.publishPermissionsRepair(PermissionsRepairProgress{Status: "started"})
+
+	// Limit the progress events to one a second, since a server can have a lot of files.
+	var last time.Time
+	files, err := s.Filesystem().RepairPermissions(func(files int64) {
+		if time.Since(last) < time.Second {
+			return
+		}
+		last = time.Now()
+
+		s.publishPermissionsRepair(PermissionsRepairProgress{Status: "running", Files: files})
+	})
+
+	if err != nil {
+		s.Log().WithField("error", err).Error("failed to repair permissions for server files")
+		s.publishPermissionsRepair(PermissionsRepairProgress{Status: "failed", Files: files, Error: err.Error()})
+
+		return files, err
+	}
+
+	s.Log().WithField("files", files).Info("repaired permissions for server files")
+	s.publishPermissionsRepair(PermissionsRepairProgress{Status: "completed", Files: files})
+
+	return files, nil
+}
+
+func (s *Server) publishPermissionsRepair(p PermissionsRepairProgress) {
+	_ = s.Events().PublishJson(PermissionsRepairEvent, p)
+}
@@ -6,7 +6,7 @@ import (
 	"github.com/avatag-host/claws/config"
 	"github.com/avatag-host/claws/environment"
 	"github.com/avatag-host/claws/server/filesystem"
-	"golang.org/x/sync/semaphore"
+	"github.com/avatag-host/claws/server/hooks"
 	"os"
 	"time"
 )
@@ -18,8 +18,7 @@ type PowerAction string
 // example, sending two "start" actions back to back will not process the second action until
 // the first action has been completed.
 //
-// This utilizes a workerpool with a limit of one worker so that all of the actions execute
-// in a sync manner.
+// This utilizes a per-server queue so that all of the actions execute in a sync manner.
 const (
 	PowerActionStart     = "start"
 	PowerActionStop      = "stop"
@@ -27,6 +26,15 @@ const (
 	PowerActionTerminate = "kill"
 )
 
+// The number of seconds that a server is given to stop before it is terminated, and the number
+// of seconds a start action is expected to take at most. Starting can include pulling the image
+// for the server, so the start timeout allows for the longest possible pull on top of the time
+// needed to prepare and boot the server.
+const (
+	powerStopTimeout  = 10 * 60
+	powerStartTimeout = int(environment.ImagePullTimeout/time.Second) + 5*60
+)
+
 // Checks if the power action being received is valid.
 func (pa PowerAction) IsValid() bool {
 	return pa == PowerActionStart ||
@@ -41,65 +49,44 @@ func (pa PowerAction) IsStart() bool {
 
 // Check if there is currently a power action being processed for the server.
 func (s *Server) ExecutingPowerAction() bool {
-	if s.powerLock == nil {
-		return false
-	}
-
-	ok := s.powerLock.TryAcquire(1)
-	if ok {
-		s.powerLock.Release(1)
-	}
-
-	// Remember, if we acquired a lock it means nothing was running.
-	return !ok
+	return s.PowerQueue().Busy()
 }
 
 // Helper function that can receive a power action and then process the actions that need
 // to occur for it. This guards against someone calling Start() twice at the same time, or
 // trying to restart while another restart process is currently running.
 //
+// Actions are pushed into the server's power queue and executed one at a time. If the action
+// is not picked up from the queue within the number of seconds provided (or the configured
+// power action timeout if none is provided) it is abandoned and a context deadline error is
+// returned.
+//
 // However, the code design for the daemon does depend on the user correctly calling this
 // function rather than making direct calls to the start/stop/restart functions on the
 // environment struct.
 func (s *Server) HandlePowerAction(action PowerAction, waitSeconds ...int) error {
-	if s.powerLock == nil {
-		s.powerLock = semaphore.NewWeighted(1)
+	wait := config.Get().System.PowerActionTimeout
+	if len(waitSeconds) > 0 && waitSeconds[0] > 0 {
+		wait = waitSeconds[0]
 	}
 
-	// Only attempt to acquire a lock on the process if this is not a termination event. We want to
-	// just allow those events to pass right through for good reason. If a server is currently trying
-	// to process a power action but has gotten stuck you still should be able to pass through the
-	// terminate event. The good news here is that doing that oftentimes will get the stuck process to
-	// move again, and naturally continue through the process.
-	if action != PowerActionTerminate {
-		// Determines if we should wait for the lock or not. If a value greater than 0 is passed
-		// into this function we will wait that long for a lock to be acquired.
-		if len(waitSeconds) > 0 && waitSeconds[0] != 0 {
-			ctx, _ := context.WithTimeout(context.Background(), time.Second*time.Duration(waitSeconds[0]))
-			// Attempt to acquire a lock on the power action lock for up to 30 seconds. If more
-			// time than that passes an error will be propagated back up the chain and this
-			// request will be aborted.
-			if err := s.powerLock.Acquire(ctx, 1); err != nil {
-				return errors.Wrap(err, "could not acquire lock on power state")
-			}
-		} else {
-			// If no wait duration was provided we will attempt to immediately acquire the lock
-			// and bail out with a context deadline error if it is not acquired immediately.
-			if ok := s.powerLock.TryAcquire(1); !ok {
-				return errors.Wrap(context.DeadlineExceeded, "could not acquire lock on power state")
-			}
+	return s.PowerQueue().Push(action, time.Second*time.Duration(wait))
+}
+
+// Executes a power action against the server environment. This should only ever be called
+// by the power queue, which cancels the context if the action becomes stuck.
+func (s *Server) executePowerAction(ctx context.Context, action PowerAction) error {
+	// Starting is not possible while the server is suspended anyways. A paused process cannot
+	// respond to being stopped or killed, so it is resumed first.
+	if s.IsPaused() {
+		if action == PowerActionStart || action == PowerActionRestart {
+			return ErrPaused
 		}
 
-		// Release the lock once the process being requested has finished executing.
-		defer s.powerLock.Release(1)
-	} else {
-		// Still try to acquire the lock if terminating and it is available, just so that other power
-		// actions are blocked until it has completed. However, if it is unavailable we won't stop
-		// the entire process.
-		if ok := s.powerLock.TryAcquire(1); ok {
-			// If we managed to acquire the lock be sure to released it once this process is completed.
-			defer s.powerLock.Release(1)
+		if err := s.Environment.Unpause(); err != nil {
+			return err
 		}
+		s.paused.Set(false)
 	}
 
 	switch action {
@@ -113,13 +100,23 @@ func (s *Server) HandlePowerAction(action PowerAction, waitSeconds ...int) error
 			return err
 		}
 
-		return s.Environment.Start()
+		if err := ctx.Err(); err != nil {
+			return errors.WithStack(err)
+		}
+
+		return s.Environment.Start(ctx)
 	case PowerActionStop:
 		// We're specifically waiting for the process to be stopped here, otherwise the lock is released
 		// too soon, and you can rack up all sorts of issues.
-		return s.Environment.WaitForStop(10*60, true)
+		return s.Environment.WaitForStop(powerStopTimeout, true)
 	case PowerActionRestart:
-		if err := s.Environment.WaitForStop(10*60, true); err != nil {
+		// Check this before stopping the server, otherwise it would be stopped and then not be
+		// able to start again.
+		if IsMaintenanceMode() {
+			return ErrMaintenanceMode
+		}
+
+		if err := s.Environment.WaitForStop(powerStopTimeout, true); err != nil {
 			// Even timeout errors should be bubbled back up the stack. If the process didn't stop
 			// nicely, but the terminate argument was passed then the server is stopped without an
 			// error being returned.
@@ -131,12 +128,20 @@ func (s *Server) HandlePowerAction(action PowerAction, waitSeconds ...int) error
 			return err
 		}
 
+		if err := ctx.Err(); err != nil {
+			return errors.WithStack(err)
+		}
+
 		// Now actually try to start the process by executing the normal pre-boot logic.
 		if err := s.onBeforeStart(); err != nil {
 			return err
 		}
 
-		return s.Environment.Start()
+		if err := ctx.Err(); err != nil {
+			return errors.WithStack(err)
+		}
+
+		return s.Environment.Start(ctx)
 	case PowerActionTerminate:
 		return s.Environment.Terminate(os.Kill)
 	}
@@ -158,6 +163,24 @@ func (s *Server) onBeforeStart() error {
 		return ErrSuspended
 	}
 
+	if IsMaintenanceMode() {
+		return ErrMaintenanceMode
+	}
+
+	if s.IsHibernated() {
+		return ErrHibernated
+	} else if s.IsHibernating() {
+		return ErrHibernationInProgress
+	}
+
+	if err := s.CheckReservations(); err != nil {
+		return err
+	}
+
+	if err := s.RunHooks(hooks.PreStart, nil); err != nil {
+		return errors.Wrap(err, "server start was aborted by a pre-start hook")
+	}
+
 	// Ensure we sync the server information with the environment so that any new environment variables
 	// and process resource limits are correctly applied.
 	s.SyncWithEnvironment()
@@ -173,6 +196,27 @@ func (s *Server) onBeforeStart() error {
 		}
 	}
 
+	// Create any files defined by the egg that are missing, such as default configuration
+	// files, before rendering templates so that the files created can also be templates.
+	if len(s.ProcessConfiguration().Files) > 0 {
+		s.PublishConsoleOutputFromDaemon("Creating missing default server files...")
+		s.SeedFiles()
+	}
+
+	// Write the files for the first boot of the server after the default files, so that they
+	// replace any default content for the same file.
+	if s.IsFirstBoot() && len(s.ProcessConfiguration().FirstBoot.Files) > 0 {
+		s.PublishConsoleOutputFromDaemon("Writing first boot server files...")
+		s.writeFirstBootFiles()
+	}
+
+	// Render any template files shipped by the egg before updating the configuration files, so
+	// that the files they render can also be updated by the configuration file rules.
+	if s.ProcessConfiguration().RenderTemplates {
+		s.PublishConsoleOutputFromDaemon("Rendering server template files...")
+		s.RenderTemplates()
+	}
+
 	// Update the configuration files defined for the server before beginning the boot process.
 	// This process executes a bunch of parallel updates, so we just block until that process
 	// is complete. Any errors as a result of this will just be bubbled out in the logger,
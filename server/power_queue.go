@@ -0,0 +1,346 @@
+package server
+
+import (
+	"context"
+	"github.com/pkg/errors"
+	"sort"
+	"sync"
+	"time"
+)
+
+// Returns the priority of a power action when it is sitting in the queue. Actions with a
+// higher priority are always executed before those with a lower priority, regardless of
+// the order in which they were received.
+func (pa PowerAction) priority() int {
+	switch pa {
+	case PowerActionTerminate:
+		return 3
+	case PowerActionStop:
+		return 2
+	case PowerActionRestart:
+		return 1
+	}
+
+	return 0
+}
+
+type powerQueueEntry struct {
+	action    PowerAction
+	queuedAt  time.Time
+	startedAt time.Time
+	waiters   []chan error
+
+	// Cancels the context the action is being executed with once it is running.
+	cancel context.CancelFunc
+}
+
+// Details about a single entry in the power queue, as exposed to the Panel.
+type PowerQueueItem struct {
+	Action    PowerAction `json:"action"`
+	QueuedAt  time.Time   `json:"queued_at"`
+	StartedAt *time.Time  `json:"started_at,omitempty"`
+	Waiting   int         `json:"waiting"`
+}
+
+// The current state of the power queue for a server.
+type PowerQueueState struct {
+	Running *PowerQueueItem  `json:"running"`
+	Pending []PowerQueueItem `json:"pending"`
+}
+
+// A per-server queue of power actions. Actions are executed one at a time in order of their
+// priority, and identical actions that are already waiting in the queue are merged together
+// so that a user spamming the restart button only ever results in a single pending restart.
+type PowerQueue struct {
+	mu      sync.Mutex
+	running *powerQueueEntry
+	pending []*powerQueueEntry
+	working bool
+
+	// The function called to actually execute a power action once it reaches the front
+	// of the queue. The context is cancelled if the action is released by the watchdog.
+	handler func(context.Context, PowerAction) error
+
+	// Returns the amount of time after which a running action is considered to be stuck, or
+	// zero if it should never be. When an action is stuck the onStuck function is called
+	// before the action is released from the queue.
+	watchdog func(PowerAction) time.Duration
+	onStuck  func(PowerAction, time.Time)
+
+	// Incremented whenever a stuck action is released, so that the routine executing it knows
+	// to stop processing the queue if the action ever returns.
+	generation uint64
+}
+
+// Returns the power queue for the server.
+func (s *Server) PowerQueue() *PowerQueue {
+	s.powerQueueLock.Lock()
+	defer s.powerQueueLock.Unlock()
+
+	if s.powerQueue == nil {
+		s.powerQueue = &PowerQueue{
+			handler:  s.executePowerAction,
+			watchdog: s.powerWatchdogTimeout,
+			onStuck:  s.handleStuckPowerAction,
+		}
+	}
+
+	return s.powerQueue
+}
+
+// Returns true if there is currently an action being executed or waiting to be executed.
+func (q *PowerQueue) Busy() bool {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	return q.working || q.running != nil || len(q.pending) > 0
+}
+
+// Holds the queue while fn is executed, so that any power actions received in the meantime
+// wait until it has finished. This is used for operations that change the environment for the
+// server outside of a power action, such as recreating its container. If an action is already
+// running or waiting in the queue ErrPowerActionInProgress is returned without calling fn.
+func (q *PowerQueue) Exclusive(fn func() error) error {
+	q.mu.Lock()
+	if q.working || q.running != nil || len(q.pending) > 0 {
+		q.mu.Unlock()
+		return ErrPowerActionInProgress
+	}
+	q.working = true
+	q.mu.Unlock()
+
+	defer func() {
+		q.mu.Lock()
+		q.working = false
+		if len(q.pending) > 0 {
+			q.working = true
+			go q.process(q.generation)
+		}
+		q.mu.Unlock()
+	}()
+
+	return fn()
+}
+
+// Returns the current state of the queue.
+func (q *PowerQueue) State() PowerQueueState {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	st := PowerQueueState{Pending: make([]PowerQueueItem, 0, len(q.pending))}
+	if q.running != nil {
+		i := q.running.item()
+		st.Running = &i
+	}
+
+	for _, e := range q.pending {
+		st.Pending = append(st.Pending, e.item())
+	}
+
+	return st
+}
+
+func (e *powerQueueEntry) item() PowerQueueItem {
+	i := PowerQueueItem{Action: e.action, QueuedAt: e.queuedAt, Waiting: len(e.waiters)}
+	if !e.startedAt.IsZero() {
+		t := e.startedAt
+		i.StartedAt = &t
+	}
+
+	return i
+}
+
+// Pushes a power action into the queue and blocks until it has been executed, returning
+// the result of that action. If the action is still waiting in the queue once the timeout
+// is reached it is abandoned and a context deadline error is returned.
+//
+// Termination requests skip the queue entirely; they cancel anything that is pending and
+// are executed immediately, even if another action is currently running. This allows a
+// stuck action to be pushed along by killing the process.
+func (q *PowerQueue) Push(action PowerAction, timeout time.Duration) error {
+	if action == PowerActionTerminate {
+		q.cancelPending()
+
+		return q.handler(context.Background(), action)
+	}
+
+	ch := make(chan error, 1)
+
+	q.mu.Lock()
+	var entry *powerQueueEntry
+	for _, e := range q.pending {
+		if e.action == action {
+			entry = e
+			break
+		}
+	}
+
+	if entry == nil {
+		entry = &powerQueueEntry{action: action, queuedAt: time.Now()}
+		q.pending = append(q.pending, entry)
+
+		sort.SliceStable(q.pending, func(i, j int) bool {
+			return q.pending[i].action.priority() > q.pending[j].action.priority()
+		})
+	}
+	entry.waiters = append(entry.waiters, ch)
+
+	if !q.working {
+		q.working = true
+		go q.process(q.generation)
+	}
+	q.mu.Unlock()
+
+	timer := time.NewTimer(timeout)
+	defer timer.Stop()
+
+	select {
+	case err := <-ch:
+		return err
+	case <-timer.C:
+		if q.abandon(entry, ch) {
+			return errors.Wrap(context.DeadlineExceeded, "could not acquire lock on power state")
+		}
+	}
+
+	// If we get to this point the action was already picked up by the time the timeout was
+	// reached, in which case we just wait for it to finish like normal.
+	return <-ch
+}
+
+// Removes a waiter from a pending entry in the queue, dropping the entry entirely if nothing
+// else is waiting on it. Returns false if the entry is no longer pending.
+func (q *PowerQueue) abandon(entry *powerQueueEntry, ch chan error) bool {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	for i, e := range q.pending {
+		if e != entry {
+			continue
+		}
+
+		for j, w := range e.waiters {
+			if w == ch {
+				e.waiters = append(e.waiters[:j], e.waiters[j+1:]...)
+				break
+			}
+		}
+
+		if len(e.waiters) == 0 {
+			q.pending = append(q.pending[:i], q.pending[i+1:]...)
+		}
+
+		return true
+	}
+
+	return false
+}
+
+// Cancels all of the pending actions in the queue, notifying anything waiting on them.
+func (q *PowerQueue) cancelPending() {
+	q.mu.Lock()
+	pending := q.pending
+	q.pending = nil
+	q.mu.Unlock()
+
+	for _, e := range pending {
+		for _, ch := range e.waiters {
+			ch <- ErrPowerActionCancelled
+		}
+	}
+}
+
+// Works through the queue executing actions one at a time until it is empty. If the running
+// action is released by the watchdog the routine stops, since another will have been started
+// to continue working through the queue.
+func (q *PowerQueue) process(generation uint64) {
+	for {
+		q.mu.Lock()
+		if q.generation != generation {
+			q.mu.Unlock()
+			return
+		}
+
+		if len(q.pending) == 0 {
+			q.running = nil
+			q.working = false
+			q.mu.Unlock()
+			return
+		}
+
+		ctx, cancel := context.WithCancel(context.Background())
+
+		entry := q.pending[0]
+		q.pending = q.pending[1:]
+		entry.startedAt = time.Now()
+		entry.cancel = cancel
+		q.running = entry
+		q.mu.Unlock()
+
+		var timer *time.Timer
+		if q.watchdog != nil {
+			if d := q.watchdog(entry.action); d > 0 {
+				timer = time.AfterFunc(d, func() {
+					q.release(entry)
+				})
+			}
+		}
+
+		err := q.handler(ctx, entry.action)
+		if timer != nil {
+			timer.Stop()
+		}
+		cancel()
+
+		q.mu.Lock()
+		if q.generation != generation {
+			q.mu.Unlock()
+			return
+		}
+		waiters := entry.waiters
+		q.mu.Unlock()
+
+		for _, ch := range waiters {
+			ch <- err
+		}
+	}
+}
+
+// Releases a running action that has been stuck for longer than the watchdog allows, so that
+// the rest of the queue can be processed. The action is aborted by cancelling its context, and
+// anything waiting on it is notified that it was stuck.
+func (q *PowerQueue) release(entry *powerQueueEntry) {
+	q.mu.Lock()
+	if q.running != entry {
+		q.mu.Unlock()
+		return
+	}
+	q.mu.Unlock()
+
+	entry.cancel()
+
+	if q.onStuck != nil {
+		q.onStuck(entry.action, entry.startedAt)
+	}
+
+	q.mu.Lock()
+	// The action may have finished while the stuck handler was running.
+	if q.running != entry {
+		q.mu.Unlock()
+		return
+	}
+
+	q.generation++
+	q.running = nil
+	waiters := entry.waiters
+	if len(q.pending) > 0 {
+		go q.process(q.generation)
+	} else {
+		q.working = false
+	}
+	q.mu.Unlock()
+
+	for _, ch := range waiters {
+		ch <- ErrPowerActionStuck
+	}
+}
@@ -0,0 +1,62 @@
+package server
+
+import (
+	"github.com/apex/log"
+	"github.com/avatag-host/claws/config"
+	"os"
+	"time"
+)
+
+// Returns the amount of time after which a running power action is considered to be stuck, based
+// on the configured multiple of the expected duration of the action.
+func (s *Server) powerWatchdogTimeout(action PowerAction) time.Duration {
+	m := config.Get().System.PowerWatchdogMultiplier
+	if m <= 0 {
+		return 0
+	}
+
+	timeout := powerStartTimeout
+	switch action {
+	case PowerActionStop:
+		timeout = powerStopTimeout
+	case PowerActionRestart:
+		timeout = powerStopTimeout + powerStartTimeout
+	}
+
+	return time.Second * time.Duration(timeout*m)
+}
+
+// Handles a power action that has been running for longer than the watchdog allows. The server
+// process is killed so that whatever the action was waiting on is released, and an event is
+// emitted with the details of the action to help work out why it became stuck.
+func (s *Server) handleStuckPowerAction(action PowerAction, startedAt time.Time) {
+	state := s.GetState()
+	s.Log().WithFields(log.Fields{
+		"action":     action,
+		"started_at": startedAt,
+		"state":      state,
+	}).Error("power action has stopped responding, killing server process and releasing power lock")
+
+	_ = s.Events().PublishJson(PowerActionStuckEvent, map[string]interface{}{
+		"action":     action,
+		"started_at": startedAt,
+		"running":    int(time.Since(startedAt).Seconds()),
+		"state":      state,
+	})
+
+	// Killing the process can itself hang if the environment is wedged, in which case the lock
+	// is released regardless.
+	done := make(chan error, 1)
+	go func() {
+		done <- s.Environment.Terminate(os.Kill)
+	}()
+
+	select {
+	case err := <-done:
+		if err != nil {
+			s.Log().WithField("error", err).Warn("failed to kill server process for stuck power action")
+		}
+	case <-time.After(time.Second * 30):
+		s.Log().Warn("timed out killing server process for stuck power action")
+	}
+}
@@ -0,0 +1,351 @@
+package server
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"github.com/avatag-host/claws/config"
+	"github.com/avatag-host/claws/server/filesystem"
+	"github.com/google/uuid"
+	"github.com/pkg/errors"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Defines a file to download from a URL into the server directory.
+type FilePullRequest struct {
+	// The http or https URL to download the file from.
+	Url string `json:"url"`
+
+	// The directory within the server to write the file to.
+	Directory string `json:"directory"`
+
+	// The name to give the file. If empty the name suggested by the remote server, or the last
+	// element of the URL, is used.
+	Filename string `json:"filename"`
+
+	// The hex encoded SHA256 checksum that the file must match, if provided.
+	Sha256 string `json:"sha256"`
+
+	// Determines if an existing file with the same name is replaced.
+	Overwrite bool `json:"overwrite"`
+}
+
+// Checks that the request can be used to pull a file.
+func (r FilePullRequest) Validate() error {
+	if err := validateDownloadUrl(r.Url); err != nil {
+		return err
+	}
+
+	if r.Filename != "" && (strings.ContainsAny(r.Filename, `/\`) || r.Filename == "." || r.Filename == "..") {
+		return errors.New("file name must not contain a path")
+	}
+
+	if r.Sha256 != "" {
+		if b, err := hex.DecodeString(r.Sha256); err != nil || len(b) != sha256.Size {
+			return errors.New("file checksum must be a hex encoded SHA256 checksum")
+		}
+	}
+
+	return nil
+}
+
+// The progress of a file being pulled into the server directory, as published with the file
+// pull event.
+type FilePull struct {
+	Id  string `json:"id"`
+	Url string `json:"url"`
+
+	// The path of the file within the server directory, which is empty until the name of the
+	// file is known.
+	File string `json:"file"`
+
+	// One of "started", "downloading", "completed", "failed" or "cancelled".
+	Status string `json:"status"`
+
+	// The number of bytes that have been downloaded, and the total size of the file if it is
+	// known.
+	Bytes int64 `json:"bytes"`
+	Total int64 `json:"total"`
+
+	Error     string    `json:"error,omitempty"`
+	StartedAt time.Time `json:"started_at"`
+}
+
+// Tracks the files that are currently being pulled for a server.
+type filePulls struct {
+	mu     sync.Mutex
+	active map[string]*filePull
+}
+
+type filePull struct {
+	status FilePull
+	cancel context.CancelFunc
+}
+
+// Starts downloading a file from a URL into the server directory in the background, returning
+// the initial state of the pull. The progress is published to the server event bus. The file
+// is written under a temporary name and only moved into place once it has been downloaded
+// completely and matches the checksum, if one was provided.
+func (s *Server) PullFile(r FilePullRequest) (*FilePull, error) {
+	if err := r.Validate(); err != nil {
+		return nil, err
+	}
+
+	dir, err := s.Filesystem().SafePath(r.Directory)
+	if err != nil {
+		return nil, err
+	}
+
+	if r.Filename != "" && !r.Overwrite {
+		if _, err := os.Stat(filepath.Join(dir, r.Filename)); err == nil {
+			return nil, errors.WithStack(os.ErrExist)
+		}
+	}
+
+	if !s.Filesystem().HasSpaceAvailable(true) {
+		return nil, filesystem.ErrNotEnoughDiskSpace
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	p := &filePull{
+		status: FilePull{
+			Id:        uuid.Must(uuid.NewRandom()).String(),
+			Url:       r.Url,
+			Status:    "started",
+			StartedAt: time.Now().UTC(),
+		},
+		cancel: cancel,
+	}
+
+	s.pulls.mu.Lock()
+	if len(s.pulls.active) >= config.Get().System.FilePull.MaxConcurrent {
+		s.pulls.mu.Unlock()
+		cancel()
+
+		return nil, ErrTooManyFilePulls
+	}
+
+	if s.pulls.active == nil {
+		s.pulls.active = make(map[string]*filePull)
+	}
+	s.pulls.active[p.status.Id] = p
+	status := p.status
+	s.pulls.mu.Unlock()
+
+	s.Log().WithField("url", r.Url).Info("pulling file into server directory")
+	_ = s.Events().PublishJson(FilePullEvent, status)
+
+	go func() {
+		defer cancel()
+
+		err := s.pullFile(ctx, p, r, dir)
+
+		s.updateFilePull(p, func(f *FilePull) {
+			switch {
+			case err == nil:
+				f.Status = "completed"
+			case ctx.Err() != nil:
+				f.Status = "cancelled"
+			default:
+				f.Status = "failed"
+				f.Error = err.Error()
+			}
+		})
+
+		s.pulls.mu.Lock()
+		delete(s.pulls.active, p.status.Id)
+		s.pulls.mu.Unlock()
+
+		l := s.Log().WithField("url", r.Url)
+		if err != nil {
+			l.WithField("error", err).Warn("failed to pull file into server directory")
+			return
+		}
+
+		l.Info("pulled file into server directory")
+	}()
+
+	return &status, nil
+}
+
+func (s *Server) pullFile(ctx context.Context, p *filePull, r FilePullRequest, dir string) error {
+	res, err := openDownload(ctx, r.Url)
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+
+	name := r.Filename
+	if name == "" {
+		if name = downloadName(res); name == "" {
+			return errors.New("could not determine a name for the pulled file")
+		}
+	}
+
+	root := s.Filesystem().Path()
+	file := filepath.Join("/", strings.TrimPrefix(filepath.Join(dir, name), root))
+	if _, err := s.Filesystem().SafePath(file); err != nil {
+		return err
+	}
+
+	if st, err := s.Filesystem().Stat(file); err == nil {
+		if st.Info.IsDir() {
+			return filesystem.ErrIsDirectory
+		}
+
+		if !r.Overwrite {
+			return errors.WithStack(os.ErrExist)
+		}
+	} else if !os.IsNotExist(errors.Cause(err)) {
+		return err
+	}
+
+	// The file is limited to the smaller of the configured maximum size and the disk space
+	// remaining for the server.
+	var limit int64 = -1
+	var diskBound bool
+	if max := config.Get().System.FilePull.MaxSize; max > 0 {
+		limit = max * 1024 * 1024
+	}
+	if s.Filesystem().MaxDisk() > 0 {
+		used, err := s.Filesystem().DiskUsage(false)
+		if err != nil {
+			return err
+		}
+
+		if free := s.Filesystem().MaxDisk() - used; limit < 0 || free < limit {
+			limit, diskBound = free, true
+			if limit < 0 {
+				limit = 0
+			}
+		}
+	}
+
+	tooLarge := func() error {
+		if diskBound {
+			return filesystem.ErrNotEnoughDiskSpace
+		}
+
+		return errors.New(fmt.Sprintf("file exceeds the maximum size of %dMB", config.Get().System.FilePull.MaxSize))
+	}
+
+	if limit >= 0 && res.ContentLength > limit {
+		return tooLarge()
+	}
+
+	s.updateFilePull(p, func(f *FilePull) {
+		f.File = file
+		f.Status = "downloading"
+		f.Total = res.ContentLength
+	})
+
+	var body io.Reader = res.Body
+	if limit >= 0 {
+		// Read one byte more than the limit so that a file exceeding it can be detected when
+		// the server does not report the length of the file upfront.
+		body = io.LimitReader(res.Body, limit+1)
+	}
+
+	h := sha256.New()
+	pr := newProgressReader(body, func(n int64) {
+		s.updateFilePull(p, func(f *FilePull) {
+			f.Bytes = n
+		})
+	})
+
+	tmp := filepath.Join(filepath.Dir(file), "."+name+".pull-"+p.status.Id[:8])
+	if err := s.Filesystem().Writefile(tmp, io.TeeReader(pr, h)); err != nil {
+		_ = s.Filesystem().Delete(tmp)
+
+		return err
+	}
+
+	if limit >= 0 && pr.n > limit {
+		_ = s.Filesystem().Delete(tmp)
+
+		return tooLarge()
+	}
+
+	if checksum := hex.EncodeToString(h.Sum(nil)); r.Sha256 != "" && !strings.EqualFold(checksum, r.Sha256) {
+		_ = s.Filesystem().Delete(tmp)
+
+		return errors.New(fmt.Sprintf("checksum of pulled file does not match, expected %s got %s", r.Sha256, checksum))
+	}
+
+	s.updateFilePull(p, func(f *FilePull) {
+		f.Bytes = pr.n
+		f.Total = pr.n
+	})
+
+	if r.Overwrite {
+		if err := s.Filesystem().Delete(file); err != nil && !os.IsNotExist(errors.Cause(err)) {
+			_ = s.Filesystem().Delete(tmp)
+
+			return err
+		}
+	}
+
+	if err := s.Filesystem().Rename(tmp, file); err != nil {
+		_ = s.Filesystem().Delete(tmp)
+
+		return errors.WithStack(err)
+	}
+
+	return nil
+}
+
+// Applies a change to the state of a pull and publishes the new state.
+func (s *Server) updateFilePull(p *filePull, fn func(f *FilePull)) {
+	s.pulls.mu.Lock()
+	fn(&p.status)
+	status := p.status
+	s.pulls.mu.Unlock()
+
+	_ = s.Events().PublishJson(FilePullEvent, status)
+}
+
+// Returns the files that are currently being pulled into the server directory.
+func (s *Server) FilePulls() []FilePull {
+	s.pulls.mu.Lock()
+	defer s.pulls.mu.Unlock()
+
+	out := make([]FilePull, 0, len(s.pulls.active))
+	for _, p := range s.pulls.active {
+		out = append(out, p.status)
+	}
+
+	return out
+}
+
+// Cancels a file that is being pulled into the server directory. Anything already downloaded
+// for the file is removed.
+func (s *Server) CancelFilePull(id string) error {
+	s.pulls.mu.Lock()
+	defer s.pulls.mu.Unlock()
+
+	p, ok := s.pulls.active[id]
+	if !ok {
+		return ErrFilePullNotFound
+	}
+
+	p.cancel()
+
+	return nil
+}
+
+// Cancels all of the files being pulled into the server directory. This should be called when
+// the server is deleted.
+func (s *Server) CancelFilePulls() {
+	s.pulls.mu.Lock()
+	defer s.pulls.mu.Unlock()
+
+	for _, p := range s.pulls.active {
+		p.cancel()
+	}
+}
@@ -0,0 +1,113 @@
+package server
+
+import (
+	"fmt"
+	"github.com/apex/log"
+	"github.com/avatag-host/claws/api"
+	"github.com/avatag-host/claws/environment"
+	"net"
+	"time"
+)
+
+// The amount of time to wait between each readiness probe against a server allocation.
+const readinessProbeInterval = time.Second * 2
+
+// Returns the address that should be probed when checking if the server is ready to accept
+// connections. This is the address of the server environment itself rather than the host
+// port for the allocation, since the proxy forwarding that port accepts connections before
+// the server is listening.
+func (s *Server) readinessAddress() (string, error) {
+	return s.Environment.DirectAddress(s.Config().Allocations.DefaultMapping.Port)
+}
+
+// Probes the primary allocation for the server once using the given protocol, returning true
+// if it appears to be accepting connections.
+func probeAllocation(protocol string, address string) bool {
+	c, err := net.DialTimeout(protocol, address, time.Second)
+	if err != nil {
+		return false
+	}
+	defer c.Close()
+
+	if protocol == api.ReadinessCheckTcp {
+		return true
+	}
+
+	// UDP is connectionless, so the only way to know that something is listening on the port
+	// is to send it an empty datagram and receive a response. Receiving nothing at all is not
+	// treated as ready since it is indistinguishable from the datagram being dropped.
+	c.SetDeadline(time.Now().Add(time.Second))
+	if _, err := c.Write([]byte{}); err != nil {
+		return false
+	}
+
+	if _, err := c.Read(make([]byte, 1)); err != nil {
+		return false
+	}
+
+	return true
+}
+
+// Waits for the server's primary allocation to begin accepting connections and then marks
+// the server as running. If the server leaves the starting state while this is running the
+// check is abandoned, and if the configured timeout is reached the failure action is run.
+func (s *Server) awaitReadiness() {
+	cfg := s.ProcessConfiguration().Startup.Readiness
+	if !cfg.Enabled() {
+		return
+	}
+
+	protocol := cfg.Type
+
+	var deadline time.Time
+	if cfg.Timeout > 0 {
+		deadline = time.Now().Add(time.Second * time.Duration(cfg.Timeout))
+	}
+
+	s.Log().WithField("protocol", protocol).Debug("waiting for server allocation to accept connections")
+
+	for {
+		if s.GetState() != environment.ProcessStartingState {
+			return
+		}
+
+		// The address is looked up on every attempt since the environment may not have been
+		// assigned one until shortly after it starts.
+		addr, err := s.readinessAddress()
+		if err != nil {
+			s.Log().WithField("error", err).Debug("failed to determine address for server readiness check")
+		}
+
+		if err == nil && probeAllocation(protocol, addr) {
+			s.Log().WithField("address", addr).Debug("detected server in running state based on allocation readiness check")
+
+			_ = s.SetState(environment.ProcessRunningState)
+			return
+		}
+
+		if !deadline.IsZero() && time.Now().After(deadline) {
+			break
+		}
+
+		time.Sleep(readinessProbeInterval)
+	}
+
+	port := s.Config().Allocations.DefaultMapping.Port
+
+	s.Log().WithFields(log.Fields{"port": port, "action": cfg.FailureAction}).Warn("server did not become ready before the readiness timeout was reached")
+	s.PublishConsoleOutputFromDaemon(fmt.Sprintf("Server did not begin accepting connections on port %d within %d seconds.", port, cfg.Timeout))
+
+	var action PowerAction
+	switch cfg.FailureAction {
+	case api.ReadinessFailureStop:
+		action = PowerActionStop
+	case api.ReadinessFailureTerminate:
+		action = PowerActionTerminate
+	default:
+		return
+	}
+
+	if err := s.HandlePowerAction(action); err != nil {
+		s.Log().WithField("error", err).Error("failed to perform readiness failure action for server")
+	}
+}
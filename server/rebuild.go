@@ -0,0 +1,50 @@
+package server
+
+import (
+	"github.com/avatag-host/claws/environment/docker"
+	"github.com/pkg/errors"
+)
+
+// Destroys the container for the server and creates it again using the current configuration
+// for the server, including its image, mounts and limits. The server files are not affected.
+// This allows a container that has ended up in a broken state to be recovered, and makes any
+// changes to the configuration apply without waiting for the server to be started again.
+func (s *Server) RebuildContainer() error {
+	env, ok := s.Environment.(*docker.Environment)
+	if !ok {
+		return ErrRebuildUnsupported
+	}
+
+	// The container is recreated while holding the power queue, so that it cannot be started
+	// or stopped part way through being rebuilt.
+	return s.PowerQueue().Exclusive(func() error {
+		return s.rebuildContainer(env)
+	})
+}
+
+func (s *Server) rebuildContainer(env *docker.Environment) error {
+	if s.IsInstalling() {
+		return ErrPowerActionInProgress
+	}
+
+	// A container in a broken state may not be able to report whether it is running, in which
+	// case it is rebuilt anyway since that is what this is intended to fix.
+	if running, err := env.IsRunning(); err != nil {
+		s.Log().WithField("error", err).Warn("failed to determine if server is running before rebuilding container")
+	} else if running {
+		return ErrIsRunning
+	}
+
+	s.SyncWithEnvironment()
+
+	s.Log().Info("rebuilding server container")
+	s.PublishConsoleOutputFromDaemon("Rebuilding server container...")
+
+	if err := env.Recreate(); err != nil {
+		return errors.WithMessage(err, "failed to rebuild server container")
+	}
+
+	s.PublishConsoleOutputFromDaemon("Server container rebuilt.")
+
+	return nil
+}
@@ -0,0 +1,132 @@
+package server
+
+import (
+	"context"
+	"github.com/apex/log"
+	"github.com/avatag-host/claws/config"
+	"github.com/avatag-host/claws/environment"
+	"github.com/avatag-host/claws/environment/docker"
+	"github.com/docker/docker/api/types"
+	"github.com/docker/docker/api/types/filters"
+	"time"
+)
+
+// The amount of time to wait after a container is removed before creating it again, giving
+// Wings time to finish whatever it was doing if it removed the container itself.
+const reconcileRemoveDelay = time.Second * 5
+
+// Watches the Docker events for server containers on the local Docker daemon and each of the
+// configured endpoints, bringing servers back in sync when their containers are started, stopped
+// or removed outside of Wings. This does nothing unless servers are using the Docker environment.
+func StartReconciler() {
+	c := config.Get()
+	if c.Environment == config.EnvironmentProcess || c.Environment == config.EnvironmentLxd {
+		return
+	}
+
+	go watchContainerEvents("")
+	for name := range c.Docker.Endpoints {
+		go watchContainerEvents(name)
+	}
+}
+
+// Subscribes to the container events from a Docker endpoint, subscribing again if the
+// connection to the daemon is lost.
+func watchContainerEvents(endpoint string) {
+	l := log.WithField("endpoint", endpoint)
+	backoff := time.Second
+
+	for {
+		cli, err := environment.DockerClientFor(endpoint)
+		if err != nil {
+			l.WithField("error", err).Error("failed to create docker client for reconciler, container events will not be watched")
+			return
+		}
+
+		ctx, cancel := context.WithCancel(context.Background())
+		msgs, errs := cli.Events(ctx, types.EventsOptions{
+			Filters: filters.NewArgs(
+				filters.Arg("type", "container"),
+				filters.Arg("label", "ContainerType=server_process"),
+			),
+		})
+
+		started := time.Now()
+	Loop:
+		for {
+			select {
+			case m := <-msgs:
+				reconcileContainer(endpoint, m.Action, m.Actor.Attributes["name"])
+			case err := <-errs:
+				l.WithField("error", err).Warn("lost connection to docker event stream, reconnecting")
+				break Loop
+			}
+		}
+		cancel()
+
+		// Only back off if the stream is failing repeatedly.
+		if time.Since(started) > time.Minute {
+			backoff = time.Second
+		} else if backoff < time.Minute {
+			backoff *= 2
+		}
+		time.Sleep(backoff)
+	}
+}
+
+// Handles a Docker event for a server container.
+func reconcileContainer(endpoint string, action string, name string) {
+	cfg := config.Get().Docker.Reconcile
+	if !cfg.Enabled || name == "" {
+		return
+	}
+
+	s := GetServers().Find(func(s *Server) bool {
+		return s.Id() == name
+	})
+	if s == nil {
+		return
+	}
+
+	env, ok := s.Environment.(*docker.Environment)
+	if !ok || env.Configuration.Container().DockerEndpoint != endpoint {
+		return
+	}
+
+	// Containers are started, stopped and removed by Wings itself while handling power actions
+	// and installations, none of which should be reconciled.
+	if s.PowerQueue().Busy() || s.IsInstalling() {
+		return
+	}
+
+	switch action {
+	case "start":
+		go func() {
+			attach := cfg.OnStart != config.ReconcileStop
+			s.Log().WithField("attach", attach).Info("server container was started outside of wings, reconciling state")
+
+			if err := env.ReconcileStarted(attach); err != nil {
+				s.Log().WithField("error", err).Error("failed to reconcile externally started server container")
+			}
+		}()
+	case "die":
+		env.ReconcileStopped()
+	case "destroy":
+		if cfg.OnRemove != config.ReconcileRecreate {
+			return
+		}
+
+		go func() {
+			time.Sleep(reconcileRemoveDelay)
+
+			// The server may have been deleted or suspended, or started in the meantime.
+			if GetServers().Find(func(s2 *Server) bool { return s2 == s }) == nil || s.IsSuspended() || s.PowerQueue().Busy() || s.IsInstalling() {
+				return
+			}
+
+			if err := env.ReconcileRemoved(); err != nil {
+				s.Log().WithField("error", err).Error("failed to recreate externally removed server container")
+			}
+		}()
+	}
+}
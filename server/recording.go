@@ -0,0 +1,237 @@
+package server
+
+import (
+	"github.com/avatag-host/claws/config"
+	"github.com/avatag-host/claws/events"
+	"github.com/avatag-host/claws/server/ansi"
+	"github.com/avatag-host/claws/server/filesystem"
+	"github.com/pkg/errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+)
+
+// The maximum size of a console recording, after which the recording is stopped automatically
+// so that a server with a lot of output cannot fill the disk.
+const maxConsoleRecordingSize = 100 * 1024 * 1024
+
+// The state of the current or last console recording for a server.
+type ConsoleRecording struct {
+	// The path of the file within the server directory that the console is recorded to, or
+	// empty if the recording is stored by Wings to be downloaded.
+	File string `json:"file,omitempty"`
+
+	Recording bool       `json:"recording"`
+	Lines     int64      `json:"lines"`
+	Size      int64      `json:"size"`
+	StartedAt time.Time  `json:"started_at"`
+	StoppedAt *time.Time `json:"stopped_at,omitempty"`
+}
+
+// Records the console output of a server to a file, with the time that each line was output.
+type consoleRecorder struct {
+	mu       sync.Mutex
+	f        *os.File
+	listener *func(events.Event)
+	status   *ConsoleRecording
+}
+
+// Returns the path that a recording which is not written to the server directory is stored at.
+func (s *Server) consoleRecordingPath() string {
+	return filepath.Join(config.Get().System.RootDirectory, "recordings", s.Id()+".log")
+}
+
+// Starts recording the console output of the server. If a file is provided the recording is
+// written to that file within the server directory, replacing any existing content, otherwise
+// it is stored by Wings so that it can be downloaded once it is stopped.
+func (s *Server) StartConsoleRecording(file string) (*ConsoleRecording, error) {
+	r := &s.recorder
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if r.f != nil {
+		return nil, ErrConsoleRecordingInProgress
+	}
+
+	p := s.consoleRecordingPath()
+	if file != "" {
+		if !s.Filesystem().HasSpaceAvailable(true) {
+			return nil, filesystem.ErrNotEnoughDiskSpace
+		}
+
+		cleaned, err := s.Filesystem().SafePath(file)
+		if err != nil {
+			return nil, err
+		}
+
+		if st, err := os.Stat(cleaned); err == nil && st.IsDir() {
+			return nil, filesystem.ErrIsDirectory
+		}
+
+		file = filepath.Join("/", strings.TrimPrefix(cleaned, s.Filesystem().Path()))
+		p = cleaned
+	}
+
+	if err := os.MkdirAll(filepath.Dir(p), 0755); err != nil {
+		return nil, errors.WithStack(err)
+	}
+
+	f, err := os.OpenFile(p, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0644)
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+
+	if file != "" {
+		if err := s.Filesystem().Chown(file); err != nil {
+			f.Close()
+			return nil, err
+		}
+	}
+
+	var listener func(events.Event)
+	listener = func(e events.Event) {
+		s.recordConsoleLine(&listener, e.Data)
+	}
+
+	r.f = f
+	r.listener = &listener
+	r.status = &ConsoleRecording{File: file, Recording: true, StartedAt: time.Now().UTC()}
+
+	s.Events().On(ConsoleOutputEvent, r.listener)
+
+	s.Log().WithField("file", file).Info("started recording server console")
+
+	status := *r.status
+
+	return &status, nil
+}
+
+// Writes a line of console output to the recording, stopping the recording if it has reached
+// the maximum size. Lines received by the listener of an earlier recording, which is removed in
+// the background, are ignored.
+func (s *Server) recordConsoleLine(listener *func(events.Event), line string) {
+	r := &s.recorder
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if r.f == nil || r.listener != listener {
+		return
+	}
+
+	n, err := r.f.WriteString("[" + time.Now().UTC().Format(time.RFC3339) + "] " + ansi.Strip(line) + "\n")
+	r.status.Lines++
+	r.status.Size += int64(n)
+
+	if err != nil {
+		s.Log().WithField("error", err).Warn("failed to write to server console recording, stopping recording")
+		_ = s.stopConsoleRecording()
+	} else if r.status.Size >= maxConsoleRecordingSize {
+		s.Log().Warn("server console recording reached the maximum size, stopping recording")
+		_ = s.stopConsoleRecording()
+	}
+}
+
+// Stops recording the console output of the server, returning the final state of the
+// recording.
+func (s *Server) StopConsoleRecording() (*ConsoleRecording, error) {
+	r := &s.recorder
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if r.f == nil {
+		return nil, ErrConsoleRecordingNotInProgress
+	}
+
+	if err := s.stopConsoleRecording(); err != nil {
+		return nil, err
+	}
+
+	status := *r.status
+
+	return &status, nil
+}
+
+// Stops the recording. The caller must hold the lock.
+func (s *Server) stopConsoleRecording() error {
+	r := &s.recorder
+
+	// The listener is removed in the background since this can be called from within the
+	// listener itself, while the event bus is busy calling it.
+	go s.Events().Off(ConsoleOutputEvent, r.listener)
+
+	err := r.f.Close()
+
+	now := time.Now().UTC()
+	r.f = nil
+	r.listener = nil
+	r.status.Recording = false
+	r.status.StoppedAt = &now
+
+	s.Log().WithField("lines", r.status.Lines).Info("stopped recording server console")
+
+	return errors.WithStack(err)
+}
+
+// Returns the state of the current or last console recording for the server, or nil if the
+// console has not been recorded since Wings started.
+func (s *Server) ConsoleRecording() *ConsoleRecording {
+	r := &s.recorder
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if r.status == nil {
+		return nil
+	}
+
+	status := *r.status
+
+	return &status
+}
+
+// Opens the last console recording stored by Wings so that it can be downloaded. An error
+// wrapping os.ErrNotExist is returned if the console is still being recorded, or the last
+// recording was written to the server directory.
+func (s *Server) OpenConsoleRecording() (*os.File, *ConsoleRecording, error) {
+	r := &s.recorder
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if r.status == nil || r.status.Recording || r.status.File != "" {
+		return nil, nil, errors.WithStack(os.ErrNotExist)
+	}
+
+	f, err := os.Open(s.consoleRecordingPath())
+	if err != nil {
+		return nil, nil, errors.WithStack(err)
+	}
+
+	status := *r.status
+
+	return f, &status, nil
+}
+
+// Stops any console recording for the server and removes the recording stored by Wings. This
+// should be called when the server is deleted.
+func (s *Server) RemoveConsoleRecording() error {
+	r := &s.recorder
+
+	r.mu.Lock()
+	if r.f != nil {
+		_ = s.stopConsoleRecording()
+	}
+	r.status = nil
+	r.mu.Unlock()
+
+	if err := os.Remove(s.consoleRecordingPath()); err != nil && !os.IsNotExist(err) {
+		return errors.WithStack(err)
+	}
+
+	return nil
+}
@@ -0,0 +1,21 @@
+package server
+
+import (
+	"github.com/avatag-host/claws/config"
+)
+
+// Reloads the configuration from the disk and applies any changes that affect servers which
+// are already running, such as the console throttle settings.
+func ReloadConfiguration() (*config.ReloadResult, error) {
+	res, err := config.Reload()
+	if err != nil {
+		return nil, err
+	}
+
+	throttles := config.Get().Throttles
+	for _, s := range GetServers().All() {
+		s.Throttler().SetConfiguration(throttles)
+	}
+
+	return res, nil
+}
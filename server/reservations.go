@@ -0,0 +1,52 @@
+package server
+
+import (
+	"fmt"
+	"github.com/avatag-host/claws/config"
+	"github.com/avatag-host/claws/system"
+	"github.com/docker/go-units"
+)
+
+// Checks that the resources reserved in the configuration are available on the node before
+// the server is started. If a reservation is breached an event is emitted for the server and
+// an error describing the breached reservation is returned.
+func (s *Server) CheckReservations() error {
+	r := config.Get().System.Reservations
+	if r.Memory <= 0 && r.Disk <= 0 && r.MaxLoad <= 0 {
+		return nil
+	}
+
+	res, err := system.GetHostResources(config.Get().System.Data)
+	if err != nil {
+		// Never prevent servers from starting because the usage could not be read.
+		s.Log().WithField("error", err).Debug("unable to read host resources, skipping reservation checks")
+		return nil
+	}
+
+	var message string
+	if r.Memory > 0 && res.MemoryAvailable < uint64(r.Memory)*1024*1024 {
+		message = fmt.Sprintf(
+			"node only has %s of memory available, at least %s must remain available to start a server",
+			units.BytesSize(float64(res.MemoryAvailable)), units.BytesSize(float64(r.Memory*1024*1024)),
+		)
+	} else if r.Disk > 0 && res.DiskFree < uint64(r.Disk)*1024*1024 {
+		message = fmt.Sprintf(
+			"node only has %s of disk space free, at least %s must remain free to start a server",
+			units.BytesSize(float64(res.DiskFree)), units.BytesSize(float64(r.Disk*1024*1024)),
+		)
+	} else if r.MaxLoad > 0 && res.Load1 > r.MaxLoad {
+		message = fmt.Sprintf(
+			"node load average is %.2f, servers cannot be started while it is above %.2f",
+			res.Load1, r.MaxLoad,
+		)
+	}
+
+	if message == "" {
+		return nil
+	}
+
+	s.Log().WithField("reason", message).Warn("refusing to start server, node resource reservation breached")
+	s.Events().Publish(ReservationBreachedEvent, message)
+
+	return &reservationBreached{message: message}
+}
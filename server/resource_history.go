@@ -0,0 +1,99 @@
+package server
+
+import (
+	"github.com/avatag-host/claws/config"
+	"github.com/avatag-host/claws/server/history"
+	"path/filepath"
+	"time"
+)
+
+// The number of collection intervals between each write of the resource history to the disk.
+const resourceHistorySaveInterval = 5
+
+// Returns the resource usage history for the server, loading any existing history from the
+// disk the first time it is accessed.
+func (s *Server) ResourceHistory() *history.History {
+	s.historyLock.Lock()
+	defer s.historyLock.Unlock()
+
+	if s.history == nil {
+		p := filepath.Join(config.Get().System.GetResourceHistoryPath(), s.Id()+".bin")
+
+		s.history = history.New(p, config.Get().System.ResourceHistoryRetention)
+		if err := s.history.Load(); err != nil {
+			s.Log().WithField("error", err).Warn("failed to load resource usage history for server")
+		}
+	}
+
+	return s.history
+}
+
+// Records the current resource usage of the server into its history, optionally persisting
+// the history to the disk afterwards.
+func (s *Server) recordResourceHistory(t time.Time, save bool) {
+	p := s.Proc()
+
+	p.mu.RLock()
+	point := history.Point{
+		Timestamp:   t.Unix(),
+		CpuAbsolute: p.CpuAbsolute,
+		Memory:      p.Memory,
+		Disk:        p.Disk,
+		RxBytes:     p.Network.RxBytes,
+		TxBytes:     p.Network.TxBytes,
+	}
+	p.mu.RUnlock()
+
+	h := s.ResourceHistory()
+	h.Record(point)
+
+	if save {
+		if err := h.Save(); err != nil {
+			s.Log().WithField("error", err).Warn("failed to write resource usage history for server to disk")
+		}
+	}
+}
+
+// Writes the resource usage history of every server to the disk. This is called when Wings is
+// shutting down so that the points recorded since the last periodic write are not lost.
+func SaveResourceHistory() {
+	if config.Get().System.ResourceHistoryRetention <= 0 {
+		return
+	}
+
+	for _, s := range GetServers().All() {
+		s.historyLock.Lock()
+		h := s.history
+		s.historyLock.Unlock()
+
+		// Nothing has been recorded for the server since Wings started, so whatever is on the
+		// disk is already up to date.
+		if h == nil {
+			continue
+		}
+
+		if err := h.Save(); err != nil {
+			s.Log().WithField("error", err).Warn("failed to write resource usage history for server to disk")
+		}
+	}
+}
+
+// Records the resource usage of every server on the node once a minute. This function blocks
+// and should be run in its own routine. If resource history is disabled in the configuration
+// this returns immediately.
+func TrackResourceHistory() {
+	if config.Get().System.ResourceHistoryRetention <= 0 {
+		return
+	}
+
+	ticker := time.NewTicker(time.Minute)
+	defer ticker.Stop()
+
+	for i := 1; ; i++ {
+		t := <-ticker.C
+
+		for _, s := range GetServers().All() {
+			s.recordResourceHistory(t, i%resourceHistorySaveInterval == 0)
+		}
+	}
+}
@@ -0,0 +1,142 @@
+package server
+
+import (
+	"github.com/apex/log"
+	"github.com/avatag-host/claws/config"
+	"github.com/avatag-host/claws/environment"
+	"github.com/avatag-host/claws/server/cron"
+	"github.com/pkg/errors"
+	"time"
+)
+
+// Restarts a server on a schedule, which is handled by Wings so that the restarts happen even
+// if the scheduler of the Panel is not running.
+type RestartSchedule struct {
+	// A cron expression in the timezone of the node, such as "0 4 * * *" to restart the server
+	// at 4am every day. Scheduled restarts are disabled when this is empty.
+	Cron string `json:"cron"`
+
+	// Commands sent to the server console before the restart, such as a "say" command letting
+	// players know that the server is about to restart.
+	Warnings []RestartWarning `json:"warnings"`
+}
+
+// A command sent to the server console a number of seconds before a scheduled restart.
+type RestartWarning struct {
+	Before  int    `json:"before"`
+	Command string `json:"command"`
+}
+
+// Tracks the next scheduled restart for a server. This is only accessed by the scheduler loop.
+type restartScheduler struct {
+	cron   string
+	next   time.Time
+	warned map[int]bool
+}
+
+// Runs the scheduled restarts for all of the servers on the node, checking each second if a
+// warning should be sent or a server restarted.
+func RunScheduledRestarts() {
+	ticker := time.NewTicker(time.Second)
+	defer ticker.Stop()
+
+	for t := range ticker.C {
+		loc, err := time.LoadLocation(config.Get().System.Timezone)
+		if err != nil {
+			loc = time.Local
+		}
+
+		for _, s := range GetServers().All() {
+			s.checkScheduledRestart(t.In(loc))
+		}
+	}
+}
+
+// Sends any warnings that are due for the next scheduled restart of the server, and restarts
+// it once the scheduled time is reached. Servers that are not running are not restarted.
+func (s *Server) checkScheduledRestart(now time.Time) {
+	rs := s.Config().ScheduledRestart
+	r := &s.restartScheduler
+
+	if rs.Cron != r.cron {
+		r.cron = rs.Cron
+		r.next = time.Time{}
+
+		if rs.Cron == "" {
+			return
+		}
+
+		sched, err := cron.Parse(rs.Cron)
+		if err != nil {
+			s.Log().WithField("error", err).Warn("invalid cron expression for scheduled server restarts, restarts will not be performed")
+			return
+		}
+
+		s.scheduleNextRestart(sched, now)
+	}
+
+	if r.next.IsZero() {
+		return
+	}
+
+	running := s.GetState() == environment.ProcessRunningState && !s.IsPaused()
+
+	for _, w := range rs.Warnings {
+		if r.warned[w.Before] || now.Before(r.next.Add(-time.Duration(w.Before)*time.Second)) {
+			continue
+		}
+		r.warned[w.Before] = true
+
+		if running && w.Command != "" {
+			if err := s.Environment.SendCommand(w.Command); err != nil {
+				s.Log().WithField("error", err).Warn("failed to send scheduled restart warning to server")
+			}
+		}
+	}
+
+	if now.Before(r.next) {
+		return
+	}
+
+	// The expression was valid when it was first parsed, so there is no need to check the error.
+	sched, _ := cron.Parse(r.cron)
+	s.scheduleNextRestart(sched, now)
+
+	if !running || s.IsSuspended() {
+		return
+	}
+
+	go func(s *Server) {
+		s.Log().Info("restarting server as scheduled")
+		s.PublishConsoleOutputFromDaemon("Restarting server as scheduled...")
+
+		if err := s.HandlePowerAction(PowerActionRestart); err != nil {
+			s.Log().WithField("error", errors.WithStack(err)).Warn("failed to perform scheduled server restart")
+			return
+		}
+
+		s.RecordActivity(PowerAction(PowerActionRestart).ActivityEvent(), "", "", map[string]interface{}{"scheduled": true})
+	}(s)
+}
+
+// Determines the time of the next scheduled restart after now. Warnings that would have been
+// sent before now are skipped, rather than sent late with the wrong amount of time remaining.
+func (s *Server) scheduleNextRestart(sched *cron.Schedule, now time.Time) {
+	r := &s.restartScheduler
+
+	r.next = sched.Next(now)
+	r.warned = make(map[int]bool)
+
+	if r.next.IsZero() {
+		s.Log().WithField("cron", r.cron).Warn("cron expression for scheduled server restarts never matches, restarts will not be performed")
+		return
+	}
+
+	for _, w := range s.Config().ScheduledRestart.Warnings {
+		if !now.Before(r.next.Add(-time.Duration(w.Before) * time.Second)) {
+			r.warned[w.Before] = true
+		}
+	}
+
+	s.Log().WithFields(log.Fields{"cron": r.cron, "next": r.next}).Debug("scheduled next server restart")
+}
@@ -0,0 +1,113 @@
+package server
+
+import (
+	"fmt"
+	"github.com/avatag-host/claws/api"
+	"github.com/avatag-host/claws/system"
+	"github.com/pkg/errors"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"time"
+)
+
+// The largest file that can be downloaded when creating a default file for a server.
+const maxSeedFileSize = 100 * 1024 * 1024
+
+var seedClient = &http.Client{Timeout: time.Minute * 5}
+
+// Creates the default files defined in the process configuration for the server that do not
+// already exist. Files that already exist are never modified, so a user is free to change or
+// replace them once they have been created. Files that cannot be created are logged and
+// skipped, rather than preventing the server from booting.
+func (s *Server) SeedFiles() {
+	for _, f := range s.ProcessConfiguration().Files {
+		l := s.Log().WithField("file", f.Path)
+
+		if _, err := s.Filesystem().Stat(f.Path); err == nil {
+			continue
+		} else if !os.IsNotExist(errors.Cause(err)) {
+			l.WithField("error", err).Warn("failed to check if default server file exists")
+			continue
+		}
+
+		if err := s.seedFile(f); err != nil {
+			l.WithField("error", err).Warn("failed to create default server file")
+			s.PublishConsoleOutputFromDaemon(fmt.Sprintf("Failed to create default file %s.", f.Path))
+			continue
+		}
+
+		l.Debug("created missing default server file")
+	}
+}
+
+// Creates a single default file, either using the content defined for it or by downloading
+// the content from the URL.
+func (s *Server) seedFile(f api.ProcessFileConfiguration) error {
+	r, err := openSeedFile(f)
+	if err != nil {
+		return err
+	}
+	defer r.Close()
+
+	if err := s.Filesystem().Writefile(f.Path, r); err != nil {
+		return err
+	}
+
+	if st, err := s.Filesystem().Stat(f.Path); err == nil && st.Info.Size() > maxSeedFileSize {
+		_ = s.Filesystem().Delete(f.Path)
+
+		return errors.New("default file exceeds the maximum size of 100MB")
+	}
+
+	return nil
+}
+
+// Returns a reader for the content of a default file. When the file is downloaded the reader
+// returns one byte more than the limit, so that a file exceeding it can be detected when the
+// server does not report the length of the file upfront.
+func openSeedFile(f api.ProcessFileConfiguration) (io.ReadCloser, error) {
+	if f.Url == "" {
+		return ioutil.NopCloser(strings.NewReader(f.Content)), nil
+	}
+
+	u, err := url.Parse(f.Url)
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+
+	if u.Scheme != "http" && u.Scheme != "https" {
+		return nil, errors.New("default file URL must use http or https")
+	}
+
+	req, err := http.NewRequest(http.MethodGet, u.String(), nil)
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+	req.Header.Set("User-Agent", "claws/"+system.Version)
+
+	res, err := seedClient.Do(req)
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+
+	if res.StatusCode != http.StatusOK {
+		res.Body.Close()
+
+		return nil, errors.New(fmt.Sprintf("failed to download default file: unexpected status code %d", res.StatusCode))
+	}
+
+	if res.ContentLength > maxSeedFileSize {
+		res.Body.Close()
+
+		return nil, errors.New("default file exceeds the maximum size of 100MB")
+	}
+
+	return struct {
+		io.Reader
+		io.Closer
+	}{io.LimitReader(res.Body, maxSeedFileSize+1), res.Body}, nil
+}
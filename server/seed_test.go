@@ -0,0 +1,81 @@
+package server
+
+import (
+	. "github.com/franela/goblin"
+	"github.com/avatag-host/claws/api"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+)
+
+// Opens the default file and returns its content.
+func readSeedFile(f api.ProcessFileConfiguration) (string, error) {
+	r, err := openSeedFile(f)
+	if err != nil {
+		return "", err
+	}
+	defer r.Close()
+
+	b, err := ioutil.ReadAll(r)
+
+	return string(b), err
+}
+
+func TestSeedFiles(t *testing.T) {
+	g := Goblin(t)
+
+	g.Describe("openSeedFile", func() {
+		var srv *httptest.Server
+
+		g.Before(func() {
+			srv = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				switch r.URL.Path {
+				case "/file":
+					w.Write([]byte("downloaded"))
+				case "/large":
+					w.Header().Set("Content-Length", strconv.Itoa(maxSeedFileSize+1))
+					w.WriteHeader(http.StatusOK)
+				default:
+					w.WriteHeader(http.StatusNotFound)
+				}
+			}))
+		})
+
+		g.After(func() {
+			srv.Close()
+		})
+
+		g.It("returns the content defined for the file", func() {
+			out, err := readSeedFile(api.ProcessFileConfiguration{Path: "a.txt", Content: "hello"})
+			g.Assert(err).IsNil()
+			g.Assert(out).Equal("hello")
+		})
+
+		g.It("prefers downloading the file when a URL is defined", func() {
+			out, err := readSeedFile(api.ProcessFileConfiguration{Path: "a.txt", Content: "hello", Url: srv.URL + "/file"})
+			g.Assert(err).IsNil()
+			g.Assert(out).Equal("downloaded")
+		})
+
+		g.It("rejects URLs that do not use http or https", func() {
+			for _, u := range []string{"file:///etc/passwd", "ftp://example.com/a.txt"} {
+				_, err := openSeedFile(api.ProcessFileConfiguration{Path: "a.txt", Url: u})
+				g.Assert(err == nil).IsFalse()
+			}
+		})
+
+		g.It("returns an error for responses that are not successful", func() {
+			_, err := openSeedFile(api.ProcessFileConfiguration{Path: "a.txt", Url: srv.URL + "/missing"})
+			g.Assert(err == nil).IsFalse()
+			g.Assert(err.Error()).Equal("failed to download default file: unexpected status code 404")
+		})
+
+		g.It("rejects files that report a length over the limit", func() {
+			_, err := openSeedFile(api.ProcessFileConfiguration{Path: "a.txt", Url: srv.URL + "/large"})
+			g.Assert(err == nil).IsFalse()
+			g.Assert(err.Error()).Equal("default file exceeds the maximum size of 100MB")
+		})
+	})
+}
@@ -9,8 +9,13 @@ import (
 	"github.com/avatag-host/claws/config"
 	"github.com/avatag-host/claws/environment"
 	"github.com/avatag-host/claws/environment/docker"
+	"github.com/avatag-host/claws/environment/lxd"
+	"github.com/avatag-host/claws/environment/process"
 	"github.com/avatag-host/claws/events"
+	"github.com/avatag-host/claws/server/automation"
 	"github.com/avatag-host/claws/server/filesystem"
+	"github.com/avatag-host/claws/server/history"
+	"github.com/avatag-host/claws/system"
 	"golang.org/x/sync/semaphore"
 	"strings"
 	"sync"
@@ -21,9 +26,11 @@ type Server struct {
 	// Internal mutex used to block actions that need to occur sequentially, such as
 	// writing the configuration to the disk.
 	sync.RWMutex
-	emitterLock  sync.Mutex
-	powerLock    *semaphore.Weighted
-	throttleLock sync.Mutex
+	emitterLock    sync.Mutex
+	historyLock    sync.Mutex
+	automationLock sync.Mutex
+	powerQueueLock sync.Mutex
+	throttleLock   sync.Mutex
 
 	// Maintains the configuration for the server. This is the data that gets returned by the Panel
 	// such as build settings and container images.
@@ -38,6 +45,19 @@ type Server struct {
 
 	fs *filesystem.Filesystem
 
+	// Set while the permissions for the server files are being repaired.
+	repairingPermissions system.AtomicBool
+
+	// Set while the server files are being hibernated or restored.
+	hibernating system.AtomicBool
+
+	// Set while the server process is paused because the server is suspended.
+	paused system.AtomicBool
+
+	// The user ID allocated to the server when each server is given its own user. This is
+	// zero when servers run as the system user.
+	uid int
+
 	// Events emitted by the server instance.
 	emitter *events.EventBus
 
@@ -52,12 +72,33 @@ type Server struct {
 	// installer process is still running.
 	installer InstallerDetails
 
+	// The rolling resource usage history for the server.
+	history *history.History
+
+	// The engine evaluating the automation rules for the server.
+	automation *automation.Engine
+
+	// The queue of power actions waiting to be executed for the server.
+	powerQueue *PowerQueue
+
 	// The console throttler instance used to control outputs.
 	throttler *ConsoleThrottler
 
+	// Tracks the next scheduled restart of the server.
+	restartScheduler restartScheduler
+
+	// Records the console output of the server to a file when requested.
+	recorder consoleRecorder
+
+	// The files currently being pulled from a URL into the server directory.
+	pulls filePulls
+
 	// Tracks open websocket connections for the server.
 	wsBag       *WebsocketBag
 	wsBagLocker sync.Mutex
+
+	// The name of the Panel that this server belongs to, empty for the primary Panel.
+	panel string
 }
 
 type InstallerDetails struct {
@@ -101,6 +142,17 @@ eloop:
 	return out
 }
 
+// Returns the name of the Panel that this server belongs to. An empty name is returned for
+// servers belonging to the primary Panel.
+func (s *Server) Panel() string {
+	return s.panel
+}
+
+// Returns an API requester for the Panel that this server belongs to.
+func (s *Server) panelApi() *api.Request {
+	return api.NewForPanel(s.panel)
+}
+
 func (s *Server) Log() *log.Entry {
 	return log.WithField("server", s.Id())
 }
@@ -112,7 +164,7 @@ func (s *Server) Log() *log.Entry {
 // This also means mass actions can be performed against servers on the Panel and they
 // will automatically sync with Wings when the server is started.
 func (s *Server) Sync() error {
-	cfg, err := api.New().GetServerConfiguration(s.Id())
+	cfg, err := s.panelApi().GetServerConfiguration(s.Id())
 	if err != nil {
 		if !api.IsRequestError(err) {
 			return errors.WithStack(err)
@@ -148,6 +200,10 @@ func (s *Server) SyncWithConfiguration(cfg api.ServerConfigurationResponse) erro
 		s.Log().Debug("syncing stop configuration with configured docker environment")
 		e.SetImage(s.Config().Container.Image)
 		e.SetStopConfiguration(cfg.ProcessConfiguration.Stop)
+	} else if e, ok := s.Environment.(*process.Environment); ok {
+		e.SetStopConfiguration(cfg.ProcessConfiguration.Stop)
+	} else if e, ok := s.Environment.(*lxd.Environment); ok {
+		e.SetStopConfiguration(cfg.ProcessConfiguration.Stop)
 	}
 
 	return nil
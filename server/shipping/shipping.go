@@ -0,0 +1,241 @@
+package shipping
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"github.com/apex/log"
+	"github.com/avatag-host/claws/config"
+	"github.com/avatag-host/claws/system"
+	"github.com/pkg/errors"
+	"io/ioutil"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// The streams that a log line can belong to.
+const (
+	StreamConsole = "console"
+	StreamDaemon  = "daemon"
+	StreamInstall = "install"
+)
+
+// A single line of output from a server.
+type Entry struct {
+	Time   time.Time
+	Server string
+	Stream string
+	Line   string
+}
+
+// Buffers log lines for servers and sends them to a Loki or Elasticsearch log store in batches.
+type Shipper struct {
+	mu      sync.Mutex
+	cfg     config.LogShippingConfiguration
+	node    string
+	client  *http.Client
+	pending []Entry
+	dropped int
+}
+
+// Returns a new shipper for the given configuration, labelling each line with the node UUID.
+func New(cfg config.LogShippingConfiguration, node string) *Shipper {
+	return &Shipper{
+		cfg:    cfg,
+		node:   node,
+		client: &http.Client{Timeout: time.Second * 30},
+	}
+}
+
+// Adds a line to the buffer to be sent with the next batch. If the buffer is full the line
+// is dropped so that a slow or unreachable log store cannot exhaust the memory of the node.
+func (s *Shipper) Push(e Entry) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if len(s.pending) >= s.cfg.BufferSize {
+		s.dropped++
+		return
+	}
+
+	s.pending = append(s.pending, e)
+}
+
+// Sends the buffered lines to the log store at the configured interval. This function blocks
+// and should be run in its own routine.
+func (s *Shipper) Run() {
+	interval := s.cfg.FlushInterval
+	if interval <= 0 {
+		interval = 5
+	}
+
+	ticker := time.NewTicker(time.Second * time.Duration(interval))
+	defer ticker.Stop()
+
+	for range ticker.C {
+		if err := s.Flush(); err != nil {
+			log.WithField("error", err).Warn("failed to ship server logs, retrying on the next interval")
+		}
+	}
+}
+
+// Sends all of the buffered lines to the log store. If sending fails the lines are kept in the
+// buffer so that they are sent again with the next batch.
+func (s *Shipper) Flush() error {
+	s.mu.Lock()
+	batch := s.pending
+	dropped := s.dropped
+	s.pending = nil
+	s.dropped = 0
+	s.mu.Unlock()
+
+	if dropped > 0 {
+		log.WithField("lines", dropped).Warn("dropped server log lines because the log shipping buffer was full")
+	}
+
+	if len(batch) == 0 {
+		return nil
+	}
+
+	var err error
+	if s.cfg.Driver == config.LogShippingElasticsearch {
+		err = s.sendElasticsearch(batch)
+	} else {
+		err = s.sendLoki(batch)
+	}
+
+	if err != nil {
+		s.mu.Lock()
+		s.pending = append(batch, s.pending...)
+		if over := len(s.pending) - s.cfg.BufferSize; over > 0 {
+			s.pending = s.pending[over:]
+			s.dropped += over
+		}
+		s.mu.Unlock()
+	}
+
+	return err
+}
+
+// Returns the labels that identify a line in the log store.
+func (s *Shipper) labels(e Entry) map[string]string {
+	l := make(map[string]string, len(s.cfg.Labels)+3)
+	for k, v := range s.cfg.Labels {
+		l[k] = v
+	}
+
+	l["node"] = s.node
+	l["server"] = e.Server
+	l["stream"] = e.Stream
+
+	return l
+}
+
+type lokiStream struct {
+	Stream map[string]string `json:"stream"`
+	Values [][2]string       `json:"values"`
+}
+
+// Sends the lines to the Loki push API, grouping them into one stream per server and stream.
+func (s *Shipper) sendLoki(batch []Entry) error {
+	streams := make(map[string]*lokiStream)
+	var order []string
+	for _, e := range batch {
+		key := e.Server + "/" + e.Stream
+		st, ok := streams[key]
+		if !ok {
+			st = &lokiStream{Stream: s.labels(e)}
+			streams[key] = st
+			order = append(order, key)
+		}
+
+		st.Values = append(st.Values, [2]string{strconv.FormatInt(e.Time.UnixNano(), 10), e.Line})
+	}
+
+	body := struct {
+		Streams []*lokiStream `json:"streams"`
+	}{}
+	for _, k := range order {
+		body.Streams = append(body.Streams, streams[k])
+	}
+
+	b, err := json.Marshal(body)
+	if err != nil {
+		return errors.WithStack(err)
+	}
+
+	return s.send("/loki/api/v1/push", "application/json", b)
+}
+
+// Sends the lines to the Elasticsearch bulk API, with one document for each line.
+func (s *Shipper) sendElasticsearch(batch []Entry) error {
+	var buf bytes.Buffer
+	action, err := json.Marshal(map[string]interface{}{"index": map[string]string{"_index": s.cfg.Index}})
+	if err != nil {
+		return errors.WithStack(err)
+	}
+
+	for _, e := range batch {
+		doc := make(map[string]interface{})
+		for k, v := range s.labels(e) {
+			doc[k] = v
+		}
+		doc["@timestamp"] = e.Time.Format(time.RFC3339Nano)
+		doc["message"] = e.Line
+
+		b, err := json.Marshal(doc)
+		if err != nil {
+			return errors.WithStack(err)
+		}
+
+		buf.Write(action)
+		buf.WriteByte('\n')
+		buf.Write(b)
+		buf.WriteByte('\n')
+	}
+
+	return s.send("/_bulk", "application/x-ndjson", buf.Bytes())
+}
+
+func (s *Shipper) send(path string, contentType string, body []byte) error {
+	req, err := http.NewRequest(http.MethodPost, strings.TrimSuffix(s.cfg.Url, "/")+path, bytes.NewReader(body))
+	if err != nil {
+		return errors.WithStack(err)
+	}
+
+	req.Header.Set("Content-Type", contentType)
+	req.Header.Set("User-Agent", fmt.Sprintf("Panther Claws/v%s", system.Version))
+	if s.cfg.Token != "" {
+		req.Header.Set("Authorization", "Bearer "+s.cfg.Token)
+	} else if s.cfg.Username != "" {
+		req.SetBasicAuth(s.cfg.Username, s.cfg.Password)
+	}
+
+	res, err := s.client.Do(req)
+	if err != nil {
+		return errors.WithStack(err)
+	}
+	defer res.Body.Close()
+
+	b, _ := ioutil.ReadAll(res.Body)
+	if res.StatusCode < 200 || res.StatusCode >= 300 {
+		return errors.New(fmt.Sprintf("shipping: log store returned status %d: %s", res.StatusCode, strings.TrimSpace(string(b))))
+	}
+
+	// The bulk API returns a successful response even if some of the documents could not be
+	// indexed, so check the response body for any errors.
+	if s.cfg.Driver == config.LogShippingElasticsearch {
+		var r struct {
+			Errors bool `json:"errors"`
+		}
+		// Retrying the batch would duplicate the lines that were indexed, so these are not retried.
+		if err := json.Unmarshal(b, &r); err == nil && r.Errors {
+			log.Warn("elasticsearch failed to index some of the shipped server log lines")
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,50 @@
+package server
+
+import (
+	"github.com/pkg/errors"
+	"github.com/avatag-host/claws/environment"
+	"github.com/avatag-host/claws/server/snapshot"
+)
+
+// Creates a new point-in-time snapshot of the server's data directory and the container
+// image currently assigned to it.
+func (s *Server) CreateSnapshot(name string) (*snapshot.Snapshot, error) {
+	snap := snapshot.New(s.Id(), name, s.Config().Container.Image)
+
+	if err := snap.Create(s.Filesystem().Path()); err != nil {
+		return nil, errors.WithStack(err)
+	}
+
+	s.Log().WithField("snapshot", snap.Uuid).Info("created new server snapshot")
+
+	return snap, nil
+}
+
+// Rolls the server's data directory back to the state it was in when the given snapshot
+// was created. The server must be offline and cannot be processing a power action while
+// this happens, otherwise files would be swapped out from underneath the running process.
+func (s *Server) RollbackSnapshot(snap *snapshot.Snapshot) error {
+	if s.GetState() != environment.ProcessOfflineState || s.ExecutingPowerAction() {
+		return ErrIsRunning
+	}
+
+	s.Log().WithField("snapshot", snap.Uuid).Info("rolling server files back to snapshot")
+
+	if err := snap.Restore(s.Filesystem().Path()); err != nil {
+		return errors.WithStack(err)
+	}
+
+	if snap.Image != "" && snap.Image != s.Config().Container.Image {
+		s.Log().WithField("snapshot", snap.Uuid).
+			WithField("image", snap.Image).
+			Warn("snapshot was created using a different container image than is currently assigned to the server")
+	}
+
+	s.PublishConsoleOutputFromDaemon("Server files have been rolled back to a previous snapshot.")
+
+	// Force a recalculation of the disk usage for the server since the files have all
+	// been swapped out.
+	go s.Filesystem().HasSpaceAvailable(false)
+
+	return nil
+}
@@ -0,0 +1,212 @@
+package snapshot
+
+import (
+	"encoding/json"
+	"github.com/google/uuid"
+	"github.com/pkg/errors"
+	"github.com/avatag-host/claws/config"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sort"
+	"time"
+)
+
+var ErrInvalidIdentifier = errors.New("snapshot: invalid snapshot identifier provided")
+
+// A snapshot is a point-in-time copy of a server's data directory along with the container
+// image that was assigned to the server at that time. Unlike backups these are never sent
+// anywhere, they live next to the server data on the same disk and are created using
+// reflinks where the underlying filesystem supports them, making them nearly instant and
+// only consuming space for blocks that change after the snapshot is taken.
+type Snapshot struct {
+	Uuid      string    `json:"uuid"`
+	Server    string    `json:"server"`
+	Name      string    `json:"name"`
+	Image     string    `json:"image"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// Returns a new snapshot instance for the given server. This does not actually create
+// anything on the disk until Create is called.
+func New(server string, name string, image string) *Snapshot {
+	return &Snapshot{
+		Uuid:   uuid.Must(uuid.NewRandom()).String(),
+		Server: server,
+		Name:   name,
+		Image:  image,
+	}
+}
+
+// Returns the directory where all of the snapshots for a server are stored.
+func Directory(server string) string {
+	return filepath.Join(config.Get().System.SnapshotDirectory, server)
+}
+
+// Returns all of the snapshots that exist for a given server, ordered from the oldest
+// to the newest.
+func List(server string) ([]*Snapshot, error) {
+	out := make([]*Snapshot, 0)
+
+	files, err := ioutil.ReadDir(Directory(server))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return out, nil
+		}
+
+		return nil, errors.WithStack(err)
+	}
+
+	for _, f := range files {
+		if !f.IsDir() {
+			continue
+		}
+
+		s, err := Locate(server, f.Name())
+		if err != nil {
+			// Don't fail the entire listing because one directory is missing its metadata
+			// file, it was most likely left behind by a snapshot that failed mid-creation.
+			if errors.Is(err, os.ErrNotExist) || errors.Is(err, ErrInvalidIdentifier) {
+				continue
+			}
+
+			return nil, err
+		}
+
+		out = append(out, s)
+	}
+
+	sort.SliceStable(out, func(i, j int) bool {
+		return out[i].CreatedAt.Before(out[j].CreatedAt)
+	})
+
+	return out, nil
+}
+
+// Locates a snapshot for a server on the disk and returns it.
+func Locate(server string, id string) (*Snapshot, error) {
+	if _, err := uuid.Parse(id); err != nil {
+		return nil, ErrInvalidIdentifier
+	}
+
+	s := &Snapshot{Uuid: id, Server: server}
+
+	b, err := ioutil.ReadFile(s.metadataPath())
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+
+	if err := json.Unmarshal(b, s); err != nil {
+		return nil, errors.WithStack(err)
+	}
+
+	return s, nil
+}
+
+// Returns the path to the directory that holds this snapshot.
+func (s *Snapshot) Path() string {
+	return filepath.Join(Directory(s.Server), s.Uuid)
+}
+
+func (s *Snapshot) dataPath() string {
+	return filepath.Join(s.Path(), "data")
+}
+
+func (s *Snapshot) metadataPath() string {
+	return filepath.Join(s.Path(), "snapshot.json")
+}
+
+// Creates the snapshot by cloning the provided source directory into the snapshot
+// location and then writing the metadata file. The metadata file is written last so
+// that a partially copied snapshot is never returned as being valid.
+func (s *Snapshot) Create(source string) error {
+	if err := os.MkdirAll(s.Path(), 0700); err != nil {
+		return errors.WithStack(err)
+	}
+
+	if err := clone(source, s.dataPath()); err != nil {
+		s.Remove()
+
+		return err
+	}
+
+	s.CreatedAt = time.Now().UTC()
+
+	b, err := json.Marshal(s)
+	if err != nil {
+		s.Remove()
+
+		return errors.WithStack(err)
+	}
+
+	if err := ioutil.WriteFile(s.metadataPath(), b, 0600); err != nil {
+		s.Remove()
+
+		return errors.WithStack(err)
+	}
+
+	return nil
+}
+
+// Restores the contents of this snapshot into the target directory. The snapshot is first
+// cloned next to the target and then swapped into place, so if anything fails along the
+// way the existing directory is left untouched.
+func (s *Snapshot) Restore(target string) error {
+	tmp := target + ".rollback"
+	old := target + ".previous"
+
+	// Clean up anything left behind by a previous rollback attempt that did not finish.
+	for _, p := range []string{tmp, old} {
+		if err := os.RemoveAll(p); err != nil {
+			return errors.WithStack(err)
+		}
+	}
+
+	if err := clone(s.dataPath(), tmp); err != nil {
+		os.RemoveAll(tmp)
+
+		return err
+	}
+
+	if err := os.Rename(target, old); err != nil && !os.IsNotExist(err) {
+		os.RemoveAll(tmp)
+
+		return errors.WithStack(err)
+	}
+
+	if err := os.Rename(tmp, target); err != nil {
+		// Try to put the original directory back where it was before returning.
+		os.Rename(old, target)
+
+		return errors.WithStack(err)
+	}
+
+	return errors.WithStack(os.RemoveAll(old))
+}
+
+// Removes a snapshot from the disk.
+func (s *Snapshot) Remove() error {
+	return os.RemoveAll(s.Path())
+}
+
+// Removes all of the snapshots for a given server.
+func RemoveAll(server string) error {
+	return os.RemoveAll(Directory(server))
+}
+
+// Clones a directory into a new location. This will use a reflink copy if supported by the
+// underlying filesystem (btrfs, XFS, etc.) which makes the copy nearly instant and shares all
+// of the unchanged data blocks, falling back to a standard copy otherwise.
+func clone(src string, dst string) error {
+	if err := os.MkdirAll(dst, 0700); err != nil {
+		return errors.WithStack(err)
+	}
+
+	out, err := exec.Command("cp", "-a", "--reflink=auto", src+"/.", dst).CombinedOutput()
+	if err != nil {
+		return errors.Wrapf(err, "snapshot: failed to clone directory: %s", string(out))
+	}
+
+	return nil
+}
@@ -6,6 +6,7 @@ import (
 	"github.com/pkg/errors"
 	"github.com/avatag-host/claws/config"
 	"github.com/avatag-host/claws/environment"
+	"github.com/avatag-host/claws/server/hooks"
 	"io"
 	"io/ioutil"
 	"os"
@@ -96,6 +97,10 @@ func (s *Server) SetState(state string) error {
 		}
 	}()
 
+	if state == environment.ProcessRunningState {
+		go s.completeFirstBoot()
+	}
+
 	// Reset the resource usage to 0 when the process fully stops so that all of the UI
 	// views in the Panel correctly display 0.
 	if state == environment.ProcessOfflineState {
@@ -104,6 +109,17 @@ func (s *Server) SetState(state string) error {
 		s.resources.mu.Unlock()
 
 		s.emitProcUsage()
+
+		// A process that was killed while paused is no longer paused.
+		s.paused.Set(false)
+
+		if prevState != environment.ProcessOfflineState {
+			go func(prevState string) {
+				if err := s.RunHooks(hooks.PostStop, map[string]interface{}{"previous_state": prevState}); err != nil {
+					s.Log().WithField("error", err).Warn("failed to run post stop hooks")
+				}
+			}(prevState)
+		}
 	}
 
 	// If server was in an online state, and is now in an offline state we should handle
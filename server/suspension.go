@@ -0,0 +1,77 @@
+package server
+
+import (
+	"github.com/avatag-host/claws/config"
+	"github.com/avatag-host/claws/environment"
+)
+
+// Determines if the server process is currently paused because the server is suspended.
+// Commands and power actions cannot be sent to a paused server.
+func (s *Server) IsPaused() bool {
+	return s.paused.Get()
+}
+
+// Applies a suspension to the running server process. Depending on the configured suspension
+// mode the process is either paused in place, or gracefully stopped (and terminated if it
+// refuses to stop). If the process cannot be paused it is stopped instead.
+func (s *Server) suspendProcess() {
+	if s.IsPaused() || s.GetState() == environment.ProcessOfflineState {
+		return
+	}
+
+	if config.Get().System.SuspensionMode == "pause" && s.GetState() == environment.ProcessRunningState {
+		s.Log().Info("server suspended with running process state, pausing now")
+
+		err := s.Environment.Pause()
+		if err == nil {
+			s.paused.Set(true)
+			s.PublishConsoleOutputFromDaemon("Server process has been paused.")
+
+			return
+		}
+
+		s.Log().WithField("error", err).Warn("failed to pause server environment after suspension, terminating instead")
+	} else {
+		s.Log().Info("server suspended with running process state, terminating now")
+	}
+
+	go func(s *Server) {
+		if err := s.Environment.WaitForStop(60, true); err != nil {
+			s.Log().WithField("error", err).Warn("failed to terminate server environment after suspension")
+		}
+	}(s)
+}
+
+// Resumes the server process if it was paused by a suspension that has since been lifted.
+func (s *Server) resumeProcess() {
+	if !s.IsPaused() {
+		return
+	}
+
+	s.Log().Info("server unsuspended with paused process, resuming now")
+
+	if err := s.Environment.Unpause(); err != nil {
+		s.Log().WithField("error", err).Error("failed to resume paused server environment")
+		return
+	}
+
+	s.paused.Set(false)
+	s.PublishConsoleOutputFromDaemon("Server process has been resumed.")
+}
+
+// Updates whether the server is paused from the state of its environment. This should be
+// called when Wings boots, since a paused container keeps running while Wings is stopped. A
+// paused server that is no longer suspended is resumed right away.
+func (s *Server) SyncPausedState() {
+	paused, err := s.Environment.IsPaused()
+	if err != nil {
+		s.Log().WithField("error", err).Warn("failed to determine if server environment is paused")
+		return
+	}
+
+	s.paused.Set(paused)
+
+	if paused && !s.IsSuspended() {
+		s.resumeProcess()
+	}
+}
@@ -0,0 +1,139 @@
+package server
+
+import (
+	"bytes"
+	"github.com/karrick/godirwalk"
+	"github.com/pkg/errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// The extension of the template files that are rendered when the server boots.
+const templateExtension = ".tmpl"
+
+// The largest template file that is rendered. Templates are configuration files, so anything
+// larger than this is almost certainly not meant to be a template.
+const maxTemplateSize = 1024 * 1024
+
+// Matches the placeholders within a template file, such as "{{SERVER_PORT}}" or
+// "{{ allocations.default.ip }}".
+var templateVariableRegex = regexp.MustCompile(`{{\s*([\w.]+)\s*}}`)
+
+// Renders every template file in the server directory, writing the result to the same path
+// without the ".tmpl" extension. This allows egg authors to ship entire configuration files
+// rather than defining a replacement for every value within them. Placeholders that do not
+// match a variable are left as they are so that it is obvious there is an issue with them.
+//
+// The variables available to a template are the environment variables for the server, which
+// include the egg variables, along with the allocations for the server:
+//
+//   {{allocations.default.ip}}    the IP address of the default allocation
+//   {{allocations.default.port}}  the port of the default allocation
+//   {{allocations.ports}}         every allocated port, separated by commas
+//   {{allocations.ports.0}}       a single allocated port, in ascending order
+func (s *Server) RenderTemplates() {
+	vars := s.templateVariables()
+	root := s.Filesystem().Path()
+
+	err := godirwalk.Walk(root, &godirwalk.Options{
+		Unsorted: true,
+		Callback: func(p string, e *godirwalk.Dirent) error {
+			if !e.IsRegular() || !strings.HasSuffix(p, templateExtension) {
+				return nil
+			}
+
+			rel, err := filepath.Rel(root, p)
+			if err != nil {
+				return nil
+			}
+
+			if err := s.renderTemplate(rel, vars); err != nil {
+				s.Log().WithField("template", rel).WithField("error", err).Warn("failed to render server template file")
+			}
+
+			return nil
+		},
+	})
+
+	if err != nil && !os.IsNotExist(errors.Cause(err)) {
+		s.Log().WithField("error", err).Error("failed to render server template files")
+	}
+}
+
+// Renders a single template file, which is given relative to the server directory.
+func (s *Server) renderTemplate(p string, vars map[string]string) error {
+	st, err := s.Filesystem().Stat(p)
+	if err != nil {
+		return err
+	}
+
+	if st.Info.Size() > maxTemplateSize {
+		return errors.New("template file exceeds the maximum size of 1MB")
+	}
+
+	cleaned, err := s.Filesystem().SafePath(p)
+	if err != nil {
+		return err
+	}
+
+	b, err := ioutil.ReadFile(cleaned)
+	if err != nil {
+		return errors.WithStack(err)
+	}
+
+	out := replaceTemplateVariables(b, vars)
+
+	return s.Filesystem().Writefile(strings.TrimSuffix(p, templateExtension), bytes.NewReader(out))
+}
+
+// Replaces each of the placeholders within the template contents with the value of the
+// variable it references, leaving any placeholder without a matching variable untouched.
+func replaceTemplateVariables(b []byte, vars map[string]string) []byte {
+	return templateVariableRegex.ReplaceAllFunc(b, func(m []byte) []byte {
+		if v, ok := vars[string(templateVariableRegex.FindSubmatch(m)[1])]; ok {
+			return []byte(v)
+		}
+
+		return m
+	})
+}
+
+// Returns the variables that are available to template files.
+func (s *Server) templateVariables() map[string]string {
+	out := make(map[string]string)
+	for _, v := range s.GetEnvironmentVariables() {
+		if parts := strings.SplitN(v, "=", 2); len(parts) == 2 {
+			out[parts[0]] = parts[1]
+		}
+	}
+
+	a := s.Config().Allocations
+	out["allocations.default.ip"] = a.DefaultMapping.Ip
+	out["allocations.default.port"] = strconv.Itoa(a.DefaultMapping.Port)
+
+	seen := make(map[int]bool)
+	var ports []int
+	for _, p := range a.Mappings {
+		for _, port := range p {
+			if !seen[port] {
+				seen[port] = true
+				ports = append(ports, port)
+			}
+		}
+	}
+	sort.Ints(ports)
+
+	list := make([]string, len(ports))
+	for i, port := range ports {
+		list[i] = strconv.Itoa(port)
+		out["allocations.ports."+strconv.Itoa(i)] = list[i]
+	}
+	out["allocations.ports"] = strings.Join(list, ",")
+
+	return out
+}
@@ -0,0 +1,91 @@
+package server
+
+import (
+	"github.com/avatag-host/claws/config"
+	"github.com/avatag-host/claws/environment"
+	. "github.com/franela/goblin"
+	"testing"
+)
+
+func TestTemplates(t *testing.T) {
+	g := Goblin(t)
+
+	g.Describe("replaceTemplateVariables", func() {
+		vars := map[string]string{
+			"SERVER_PORT":            "25565",
+			"allocations.default.ip": "10.0.0.1",
+			"allocations.ports.1":    "25566",
+		}
+
+		for _, c := range []struct {
+			name     string
+			input    string
+			expected string
+		}{
+			{
+				name:     "replaces placeholders with the variable values",
+				input:    "port={{SERVER_PORT}}\nip={{allocations.default.ip}}\n",
+				expected: "port=25565\nip=10.0.0.1\n",
+			},
+			{
+				name:     "allows whitespace within the braces",
+				input:    "query={{ allocations.ports.1 }}",
+				expected: "query=25566",
+			},
+			{
+				name:     "leaves placeholders without a matching variable untouched",
+				input:    "a={{MISSING}} b={{SERVER_PORT}}",
+				expected: "a={{MISSING}} b=25565",
+			},
+			{
+				name:     "leaves braces that are not placeholders untouched",
+				input:    "{\"key\": {{}}, \"x\": { {SERVER_PORT} }}",
+				expected: "{\"key\": {{}}, \"x\": { {SERVER_PORT} }}",
+			},
+		} {
+			c := c
+
+			g.It(c.name, func() {
+				g.Assert(string(replaceTemplateVariables([]byte(c.input), vars))).Equal(c.expected)
+			})
+		}
+	})
+
+	g.Describe("templateVariables", func() {
+		g.BeforeEach(func() {
+			config.Set(&config.Configuration{
+				AuthenticationToken: "abc",
+				System:              config.SystemConfiguration{Timezone: "UTC"},
+			})
+		})
+
+		g.It("includes the environment variables and allocations for the server", func() {
+			s := &Server{}
+			s.cfg.EnvVars = environment.Variables{"max_players": "20"}
+			s.cfg.Allocations.DefaultMapping.Ip = "10.0.0.1"
+			s.cfg.Allocations.DefaultMapping.Port = 25565
+			s.cfg.Allocations.Mappings = map[string][]int{
+				"10.0.0.1": {25567, 25565},
+				"10.0.0.2": {25565, 25566},
+			}
+
+			vars := s.templateVariables()
+
+			g.Assert(vars["MAX_PLAYERS"]).Equal("20")
+			g.Assert(vars["SERVER_PORT"]).Equal("25565")
+			g.Assert(vars["allocations.default.ip"]).Equal("10.0.0.1")
+			g.Assert(vars["allocations.default.port"]).Equal("25565")
+			g.Assert(vars["allocations.ports"]).Equal("25565,25566,25567")
+			g.Assert(vars["allocations.ports.0"]).Equal("25565")
+			g.Assert(vars["allocations.ports.2"]).Equal("25567")
+		})
+
+		g.It("returns an empty port list when there are no allocations", func() {
+			vars := (&Server{}).templateVariables()
+
+			g.Assert(vars["allocations.ports"]).Equal("")
+			_, ok := vars["allocations.ports.0"]
+			g.Assert(ok).IsFalse()
+		})
+	})
+}
@@ -6,6 +6,7 @@ import (
 	"github.com/imdario/mergo"
 	"github.com/pkg/errors"
 	"github.com/avatag-host/claws/environment"
+	"os"
 )
 
 // Merges data passed through in JSON form into the existing server object.
@@ -55,10 +56,16 @@ func (s *Server) UpdateDataStructure(data []byte) error {
 	// safely assume that we're passing through valid data structures here. I foresee this
 	// backfiring at some point, but until then...
 	//
-	// We'll go ahead and do this with swap as well.
+	// We'll go ahead and do this with swap, the memory nodes and the disk throughput limits as well.
 	c.Build.CpuLimit = src.Build.CpuLimit
 	c.Build.Swap = src.Build.Swap
 	c.Build.DiskSpace = src.Build.DiskSpace
+	c.Build.CpusetMems = src.Build.CpusetMems
+	c.Build.IoReadBps = src.Build.IoReadBps
+	c.Build.IoWriteBps = src.Build.IoWriteBps
+	c.Build.IoReadIops = src.Build.IoReadIops
+	c.Build.IoWriteIops = src.Build.IoWriteIops
+	c.Build.OomScoreAdj = src.Build.OomScoreAdj
 
 	// Mergo can't quite handle this boolean value correctly, so for now we'll just
 	// handle this edge case manually since none of the other data passed through in this
@@ -88,6 +95,141 @@ func (s *Server) UpdateDataStructure(data []byte) error {
 		c.SkipEggScripts = v
 	}
 
+	// Mergo would ignore the host network being disabled again.
+	if v, err := jsonparser.GetBoolean(data, "container", "host_network"); err != nil {
+		if err != jsonparser.KeyPathNotFoundError {
+			return errors.WithStack(err)
+		}
+	} else {
+		c.Container.HostNetwork = v
+	}
+
+	// An empty Docker endpoint moves the server back to the local Docker daemon, which mergo
+	// would ignore.
+	if v, err := jsonparser.GetString(data, "container", "docker_endpoint"); err != nil {
+		if err != jsonparser.KeyPathNotFoundError {
+			return errors.WithStack(err)
+		}
+	} else {
+		c.Container.DockerEndpoint = v
+	}
+
+	// An empty value resets the server to the node default, which mergo would ignore.
+	if v, err := jsonparser.GetString(data, "console_ansi"); err != nil {
+		if err != jsonparser.KeyPathNotFoundError {
+			return errors.WithStack(err)
+		}
+	} else {
+		c.ConsoleAnsi = v
+	}
+
+	// Capabilities are replaced as a whole whenever they are sent, since mergo would ignore an
+	// empty list and the Panel could never remove them.
+	if _, _, _, err := jsonparser.Get(data, "container", "cap_add"); err == nil {
+		c.Container.CapAdd = src.Container.CapAdd
+	}
+
+	if _, _, _, err := jsonparser.Get(data, "container", "cap_drop"); err == nil {
+		c.Container.CapDrop = src.Container.CapDrop
+	}
+
+	// Devices are replaced as a whole so that a device passed through to the server can be
+	// removed again by sending an empty list.
+	if _, _, _, err := jsonparser.Get(data, "container", "devices"); err == nil {
+		c.Container.Devices = src.Container.Devices
+	}
+
+	// Sidecars are replaced as a whole so that they can be removed, including all of them at
+	// once with an empty list.
+	if _, _, _, err := jsonparser.Get(data, "container", "sidecars"); err == nil {
+		c.Container.Sidecars = src.Container.Sidecars
+	}
+
+	// Additional networks are replaced as a whole so that the server can be detached from them.
+	if _, _, _, err := jsonparser.Get(data, "container", "networks"); err == nil {
+		c.Container.Networks = src.Container.Networks
+	}
+
+	// Mergo merges maps key by key, so labels are replaced as a whole to allow them to be removed.
+	if _, _, _, err := jsonparser.Get(data, "container", "labels"); err == nil {
+		c.Container.Labels = src.Container.Labels
+	}
+
+	// Registry credentials are replaced as a whole so that they can be removed by sending null.
+	if _, _, _, err := jsonparser.Get(data, "container", "registry_auth"); err == nil {
+		c.Container.RegistryAuth = src.Container.RegistryAuth
+	}
+
+	// Tmpfs mounts, the shared memory size and ulimits are replaced whenever they are sent so that
+	// they can be removed again, which mergo would ignore.
+	if _, _, _, err := jsonparser.Get(data, "container", "tmpfs"); err == nil {
+		c.Container.Tmpfs = src.Container.Tmpfs
+	}
+
+	if _, _, _, err := jsonparser.Get(data, "container", "shm_size"); err == nil {
+		c.Container.ShmSize = src.Container.ShmSize
+	}
+
+	if _, _, _, err := jsonparser.Get(data, "container", "ulimits"); err == nil {
+		c.Container.Ulimits = src.Container.Ulimits
+	}
+
+	// An empty security profile resets the server to the node default, which mergo would ignore.
+	if v, err := jsonparser.GetString(data, "container", "seccomp_profile"); err != nil {
+		if err != jsonparser.KeyPathNotFoundError {
+			return errors.WithStack(err)
+		}
+	} else {
+		c.Container.SeccompProfile = v
+	}
+
+	if v, err := jsonparser.GetString(data, "container", "apparmor_profile"); err != nil {
+		if err != jsonparser.KeyPathNotFoundError {
+			return errors.WithStack(err)
+		}
+	} else {
+		c.Container.AppArmorProfile = v
+	}
+
+	// The restart policy is reset to the default by sending an empty value, and the number of
+	// retries by sending zero, both of which mergo would ignore.
+	if _, _, _, err := jsonparser.Get(data, "container", "restart_policy"); err == nil {
+		c.Container.RestartPolicy = src.Container.RestartPolicy
+	}
+
+	if _, _, _, err := jsonparser.Get(data, "container", "restart_retries"); err == nil {
+		c.Container.RestartRetries = src.Container.RestartRetries
+	}
+
+	// Hosts entries and DNS settings are replaced as a whole so that entries can be removed.
+	if _, _, _, err := jsonparser.Get(data, "container", "extra_hosts"); err == nil {
+		c.Container.ExtraHosts = src.Container.ExtraHosts
+	}
+
+	if _, _, _, err := jsonparser.Get(data, "container", "dns"); err == nil {
+		c.Container.Dns = src.Container.Dns
+	}
+
+	if _, _, _, err := jsonparser.Get(data, "container", "dns_search"); err == nil {
+		c.Container.DnsSearch = src.Container.DnsSearch
+	}
+
+	// A stats interval of zero resets the server to the node default, which mergo would ignore.
+	if _, _, _, err := jsonparser.Get(data, "stats_interval"); err == nil {
+		c.StatsInterval = src.StatsInterval
+	}
+
+	// An empty pull policy resets the server to the node default, which mergo would ignore.
+	if _, _, _, err := jsonparser.Get(data, "container", "pull_policy"); err == nil {
+		c.Container.PullPolicy = src.Container.PullPolicy
+	}
+
+	// The installer overrides are replaced as a whole so that removing them falls back to the
+	// node configuration, since mergo would ignore any value that was reset to zero.
+	if _, _, _, err := jsonparser.Get(data, "installer"); err == nil {
+		c.Installer = src.Installer
+	}
+
 	// Environment and Mappings should be treated as a full update at all times, never a
 	// true patch, otherwise we can't know what we're passing along.
 	if src.EnvVars != nil && len(src.EnvVars) > 0 {
@@ -102,8 +244,21 @@ func (s *Server) UpdateDataStructure(data []byte) error {
 		c.Mounts = src.Mounts
 	}
 
+	// Automation rules are always replaced as a whole, including when the Panel sends an
+	// empty list to remove all of the rules.
+	if _, _, _, err := jsonparser.Get(data, "automation"); err == nil {
+		c.Automation = src.Automation
+	}
+
+	// The restart schedule is replaced as a whole so that it can be removed by sending an empty
+	// cron expression.
+	if _, _, _, err := jsonparser.Get(data, "scheduled_restart"); err == nil {
+		c.ScheduledRestart = src.ScheduledRestart
+	}
+
 	// Update the configuration once we have a lock on the configuration object.
 	s.cfg = c
+	s.invalidateAutomation()
 
 	return nil
 }
@@ -119,11 +274,26 @@ func (s *Server) SyncWithEnvironment() {
 	s.Log().Debug("syncing server settings with environment")
 
 	// Update the environment settings using the new information from this server.
-	s.Environment.Config().SetSettings(environment.Settings{
+	settings := environment.Settings{
 		Mounts:      s.Mounts(),
 		Allocations: s.Config().Allocations,
 		Limits:      s.Config().Build,
-	})
+		Container:   s.Config().Container,
+
+		StatsInterval: s.Config().StatsInterval,
+	}
+	settings.Uid, settings.Gid = s.User()
+
+	s.Environment.Config().SetSettings(settings)
+
+	// Update the disk limit of the server, which is enforced by the filesystem itself when
+	// disk quotas are enabled.
+	s.fs.SetDiskLimit(s.DiskSpace())
+	if _, err := os.Stat(s.fs.Path()); err == nil {
+		if err := s.fs.ApplyQuota(); err != nil {
+			s.Log().WithField("error", err).Warn("failed to set disk quota for server data directory")
+		}
+	}
 
 	// If build limits are changed, environment variables also change. Plus, any modifications to
 	// the startup command also need to be properly propagated to this environment.
@@ -132,6 +302,8 @@ func (s *Server) SyncWithEnvironment() {
 	s.Environment.Config().SetEnvironmentVariables(s.GetEnvironmentVariables())
 
 	if !s.IsSuspended() {
+		s.resumeProcess()
+
 		// Update the environment in place, allowing memory and CPU usage to be adjusted
 		// on the fly without the user needing to reboot (theoretically).
 		s.Log().Info("performing server limit modification on-the-fly")
@@ -142,15 +314,7 @@ func (s *Server) SyncWithEnvironment() {
 		}
 	} else {
 		// Checks if the server is now in a suspended state. If so and a server process is currently running it
-		// will be gracefully stopped (and terminated if it refuses to stop).
-		if s.GetState() != environment.ProcessOfflineState {
-			s.Log().Info("server suspended with running process state, terminating now")
-
-			go func(s *Server) {
-				if err := s.Environment.WaitForStop(60, true); err != nil {
-					s.Log().WithField("error", err).Warn("failed to terminate server environment after suspension")
-				}
-			}(s)
-		}
+		// will be paused or stopped depending on the configured suspension mode.
+		s.suspendProcess()
 	}
 }
@@ -0,0 +1,120 @@
+package server
+
+import (
+	"encoding/json"
+	"github.com/apex/log"
+	"github.com/avatag-host/claws/config"
+	"github.com/pkg/errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sync"
+)
+
+// The user IDs allocated to servers when each server is given its own user, keyed by the
+// server UUID. The same ID is used for both the user and group of a server.
+var serverUsers struct {
+	sync.Mutex
+	once sync.Once
+	ids  map[string]int
+}
+
+// Returns the path to the file that the allocated user IDs are stored in, so that a server
+// keeps the same user, and therefore continues to own its files, when Wings is restarted.
+func serverUsersPath() string {
+	return filepath.Join(config.Get().System.RootDirectory, "users.json")
+}
+
+func loadServerUsers() {
+	serverUsers.ids = make(map[string]int)
+
+	b, err := ioutil.ReadFile(serverUsersPath())
+	if err != nil {
+		if !os.IsNotExist(err) {
+			log.WithField("error", err).Warn("failed to read allocated server users from disk")
+		}
+		return
+	}
+
+	if err := json.Unmarshal(b, &serverUsers.ids); err != nil {
+		log.WithField("error", err).Warn("failed to parse allocated server users from disk")
+	}
+}
+
+// Writes the allocated user IDs to the disk. The caller must hold the lock.
+func saveServerUsers() error {
+	b, err := json.Marshal(serverUsers.ids)
+	if err != nil {
+		return errors.WithStack(err)
+	}
+
+	if err := ioutil.WriteFile(serverUsersPath(), b, 0600); err != nil {
+		return errors.WithStack(err)
+	}
+
+	return nil
+}
+
+// Returns the user ID allocated to the server, allocating the lowest unused ID in the
+// configured range if the server does not have one yet.
+func allocateServerUser(uuid string) (int, error) {
+	serverUsers.once.Do(loadServerUsers)
+
+	serverUsers.Lock()
+	defer serverUsers.Unlock()
+
+	if id, ok := serverUsers.ids[uuid]; ok {
+		return id, nil
+	}
+
+	used := make(map[int]bool, len(serverUsers.ids))
+	for _, id := range serverUsers.ids {
+		used[id] = true
+	}
+
+	cfg := config.Get().System.PerServerUsers
+	for id := cfg.IdStart; id < cfg.IdStart+cfg.IdCount; id++ {
+		if used[id] {
+			continue
+		}
+
+		serverUsers.ids[uuid] = id
+		if err := saveServerUsers(); err != nil {
+			delete(serverUsers.ids, uuid)
+			return 0, err
+		}
+
+		log.WithFields(log.Fields{"server": uuid, "uid": id}).Debug("allocated user for server")
+
+		return id, nil
+	}
+
+	return 0, ErrNoServerUsersAvailable
+}
+
+// Releases the user ID allocated to a server so that it can be used by another server. This
+// should only be called once the files for the server have been removed.
+func ReleaseServerUser(uuid string) error {
+	serverUsers.once.Do(loadServerUsers)
+
+	serverUsers.Lock()
+	defer serverUsers.Unlock()
+
+	if _, ok := serverUsers.ids[uuid]; !ok {
+		return nil
+	}
+
+	delete(serverUsers.ids, uuid)
+
+	return saveServerUsers()
+}
+
+// Returns the user and group ID that the server process runs as inside of its container, and
+// that owns its files. This is the system user unless each server is given its own user.
+func (s *Server) User() (int, int) {
+	if s.uid == 0 {
+		return config.Get().System.User.Uid, config.Get().System.User.Gid
+	}
+
+	return s.uid, s.uid
+}
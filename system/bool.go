@@ -18,3 +18,9 @@ func (ab *AtomicBool) Set(v bool) {
 func (ab *AtomicBool) Get() bool {
 	return atomic.LoadUint32(&ab.flag) == 1
 }
+
+// Sets the value to true if it is currently false, returning false if the value was already
+// true. This allows the value to be used to ensure only one caller performs an action.
+func (ab *AtomicBool) SetIfFalse() bool {
+	return atomic.CompareAndSwapUint32(&ab.flag, 0, 1)
+}
@@ -0,0 +1,176 @@
+package system
+
+import (
+	"crypto/tls"
+	"github.com/apex/log"
+	"github.com/pkg/errors"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+// The interval at which certificate files are checked for changes.
+const certificateWatchInterval = time.Second * 30
+
+var certificates struct {
+	sync.Mutex
+	reloaders []*CertificateReloader
+}
+
+// Serves a TLS certificate and key pair loaded from the disk, reloading them when the files
+// change so that renewed certificates are used by new connections without restarting Wings
+// and dropping the existing ones.
+type CertificateReloader struct {
+	mu       sync.RWMutex
+	certFile string
+	keyFile  string
+	cert     *tls.Certificate
+	modTime  time.Time
+}
+
+// Loads the certificate and key pair and returns a reloader for them. The reloader begins
+// watching the files for changes, and is reloaded whenever ReloadCertificates is called.
+func NewCertificateReloader(certFile string, keyFile string) (*CertificateReloader, error) {
+	r := &CertificateReloader{certFile: certFile, keyFile: keyFile}
+	if err := r.Reload(); err != nil {
+		return nil, err
+	}
+
+	certificates.Lock()
+	certificates.reloaders = append(certificates.reloaders, r)
+	certificates.Unlock()
+
+	go r.watch()
+
+	return r, nil
+}
+
+// Reloads the certificate and key pair from the disk. If they cannot be loaded the previous
+// certificate continues to be served.
+func (r *CertificateReloader) Reload() error {
+	modTime, err := r.lastModified()
+	if err != nil {
+		return err
+	}
+
+	cert, err := tls.LoadX509KeyPair(r.certFile, r.keyFile)
+	if err != nil {
+		return errors.WithStack(err)
+	}
+
+	r.mu.Lock()
+	r.cert = &cert
+	r.modTime = modTime
+	r.mu.Unlock()
+
+	return nil
+}
+
+// Returns the current certificate. This is intended to be used as the GetCertificate function
+// of a tls.Config.
+func (r *CertificateReloader) GetCertificate(_ *tls.ClientHelloInfo) (*tls.Certificate, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	return r.cert, nil
+}
+
+// Returns the most recent modification time of the certificate and key files.
+func (r *CertificateReloader) lastModified() (time.Time, error) {
+	var t time.Time
+	for _, p := range []string{r.certFile, r.keyFile} {
+		st, err := os.Stat(p)
+		if err != nil {
+			return t, errors.WithStack(err)
+		}
+
+		if st.ModTime().After(t) {
+			t = st.ModTime()
+		}
+	}
+
+	return t, nil
+}
+
+// Periodically checks the certificate files and reloads them when they have been modified,
+// such as after a renewal by certbot.
+func (r *CertificateReloader) watch() {
+	for range time.Tick(certificateWatchInterval) {
+		t, err := r.lastModified()
+		if err != nil {
+			continue
+		}
+
+		r.mu.RLock()
+		changed := !t.Equal(r.modTime)
+		r.mu.RUnlock()
+
+		if !changed {
+			continue
+		}
+
+		l := log.WithField("certificate", r.certFile)
+		if err := r.Reload(); err != nil {
+			l.WithField("error", err).Warn("failed to reload modified tls certificate, continuing to use previous certificate")
+			continue
+		}
+
+		l.Info("reloaded modified tls certificate from disk")
+	}
+}
+
+// Selects the certificate to serve for a connection using the hostname the client requested
+// through SNI, falling back to a default certificate for any other hostname.
+type CertificateSelector struct {
+	fallback *CertificateReloader
+	hosts    map[string]*CertificateReloader
+}
+
+// Returns a selector that serves the given certificate when no other certificate matches.
+func NewCertificateSelector(fallback *CertificateReloader) *CertificateSelector {
+	return &CertificateSelector{fallback: fallback, hosts: make(map[string]*CertificateReloader)}
+}
+
+// Serves the certificate for the given hostnames. A hostname beginning with "*." matches any
+// single subdomain of the rest of the hostname.
+func (s *CertificateSelector) Add(hostnames []string, r *CertificateReloader) {
+	for _, h := range hostnames {
+		s.hosts[strings.ToLower(strings.TrimSuffix(h, "."))] = r
+	}
+}
+
+// Returns the certificate for the hostname requested by the client. This is intended to be
+// used as the GetCertificate function of a tls.Config.
+func (s *CertificateSelector) GetCertificate(hello *tls.ClientHelloInfo) (*tls.Certificate, error) {
+	name := strings.ToLower(strings.TrimSuffix(hello.ServerName, "."))
+	if name != "" {
+		if r, ok := s.hosts[name]; ok {
+			return r.GetCertificate(hello)
+		}
+
+		if i := strings.Index(name, "."); i > 0 {
+			if r, ok := s.hosts["*"+name[i:]]; ok {
+				return r.GetCertificate(hello)
+			}
+		}
+	}
+
+	return s.fallback.GetCertificate(hello)
+}
+
+// Reloads every certificate that is being served from the disk.
+func ReloadCertificates() {
+	certificates.Lock()
+	defer certificates.Unlock()
+
+	for _, r := range certificates.reloaders {
+		l := log.WithField("certificate", r.certFile)
+		if err := r.Reload(); err != nil {
+			l.WithField("error", err).Warn("failed to reload tls certificate, continuing to use previous certificate")
+			continue
+		}
+
+		l.Debug("reloaded tls certificate from disk")
+	}
+}
@@ -0,0 +1,18 @@
+package system
+
+import "github.com/pkg/errors"
+
+// Returned when the resource usage of the host cannot be read on the current platform.
+var ErrResourcesUnavailable = errors.New("system: host resource usage is not available on this platform")
+
+// The current resource usage of the host.
+type HostResources struct {
+	// The amount of memory, in bytes, available for starting new processes without swapping.
+	MemoryAvailable uint64 `json:"memory_available"`
+
+	// The number of bytes free on the disk at the path the resources were read for.
+	DiskFree uint64 `json:"disk_free"`
+
+	// The one minute load average.
+	Load1 float64 `json:"load_1"`
+}
@@ -0,0 +1,55 @@
+package system
+
+import (
+	"bufio"
+	"github.com/pkg/errors"
+	"io/ioutil"
+	"os"
+	"strconv"
+	"strings"
+	"syscall"
+)
+
+// Returns the current resource usage of the host, with the free disk space for the disk that
+// the given path is on.
+func GetHostResources(path string) (*HostResources, error) {
+	r := &HostResources{}
+
+	f, err := os.Open("/proc/meminfo")
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+	defer f.Close()
+
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) >= 2 && fields[0] == "MemAvailable:" {
+			kb, err := strconv.ParseUint(fields[1], 10, 64)
+			if err != nil {
+				return nil, errors.WithStack(err)
+			}
+			r.MemoryAvailable = kb * 1024
+			break
+		}
+	}
+
+	b, err := ioutil.ReadFile("/proc/loadavg")
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+
+	if fields := strings.Fields(string(b)); len(fields) > 0 {
+		if r.Load1, err = strconv.ParseFloat(fields[0], 64); err != nil {
+			return nil, errors.WithStack(err)
+		}
+	}
+
+	var st syscall.Statfs_t
+	if err := syscall.Statfs(path, &st); err != nil {
+		return nil, errors.WithStack(err)
+	}
+	r.DiskFree = uint64(st.Bavail) * uint64(st.Bsize)
+
+	return r, nil
+}
@@ -0,0 +1,8 @@
+// +build !linux
+
+package system
+
+// Returns the current resource usage of the host. This is only supported on Linux.
+func GetHostResources(_ string) (*HostResources, error) {
+	return nil, ErrResourcesUnavailable
+}
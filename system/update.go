@@ -0,0 +1,317 @@
+package system
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/ed25519"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"github.com/pkg/errors"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// The name of the file published with each release that contains the SHA256 checksums of
+// the release binaries, and the detached signature for that file.
+const (
+	ChecksumsFile = "checksums.txt"
+	SignatureFile = "checksums.txt.sig"
+)
+
+var ErrSignatureInvalid = errors.New("system: release checksums signature is not valid")
+var ErrReleaseDowngrade = errors.New("system: release is older than the running version")
+
+// A release of Wings published to the releases API.
+type Release struct {
+	TagName string `json:"tag_name"`
+	Assets  []struct {
+		Name string `json:"name"`
+		Url  string `json:"browser_download_url"`
+	} `json:"assets"`
+}
+
+var updateClient = &http.Client{Timeout: time.Minute * 5}
+
+// Returns the latest release from a GitHub compatible releases API.
+func LatestRelease(url string) (*Release, error) {
+	b, err := download(strings.TrimSuffix(url, "/") + "/releases/latest")
+	if err != nil {
+		return nil, err
+	}
+
+	var r Release
+	if err := json.Unmarshal(b, &r); err != nil {
+		return nil, errors.WithStack(err)
+	}
+
+	return &r, nil
+}
+
+// Returns the version of the release, without any leading "v".
+func (r *Release) Version() string {
+	return strings.TrimPrefix(r.TagName, "v")
+}
+
+// Determines if the release is newer than the running version.
+func (r *Release) IsNewer() bool {
+	return compareVersions(r.Version(), Version) > 0
+}
+
+// Returns the name of the release binary for the running platform.
+func (r *Release) BinaryName() string {
+	name := fmt.Sprintf("claws_%s_%s", runtime.GOOS, runtime.GOARCH)
+	if runtime.GOOS == "windows" {
+		name += ".exe"
+	}
+
+	return name
+}
+
+func (r *Release) asset(name string) (string, error) {
+	for _, a := range r.Assets {
+		if a.Name == name {
+			return a.Url, nil
+		}
+	}
+
+	return "", errors.New(fmt.Sprintf("system: release %s does not include %s", r.TagName, name))
+}
+
+// Downloads the binary for the running platform from the release, verifies it against the
+// published checksums, and replaces the running executable with it. The checksums must be
+// signed by the given Ed25519 public key unless skipSignature is true.
+//
+// Releases older than the running version are never installed, so that a mirror cannot roll a
+// node back to a release with known issues.
+//
+// The executable is replaced by renaming the new binary over it, so a failed update never
+// leaves a partially written binary behind. The running process is not restarted.
+func (r *Release) Install(publicKey string, skipSignature bool) error {
+	if compareVersions(r.Version(), Version) < 0 {
+		return ErrReleaseDowngrade
+	}
+
+	checksums, err := r.checksums(publicKey, skipSignature)
+	if err != nil {
+		return err
+	}
+
+	expected, ok := checksums[r.BinaryName()]
+	if !ok {
+		return errors.New(fmt.Sprintf("system: release %s does not include a checksum for %s", r.TagName, r.BinaryName()))
+	}
+
+	url, err := r.asset(r.BinaryName())
+	if err != nil {
+		return err
+	}
+
+	exe, err := os.Executable()
+	if err != nil {
+		return errors.WithStack(err)
+	}
+
+	if exe, err = filepath.EvalSymlinks(exe); err != nil {
+		return errors.WithStack(err)
+	}
+
+	// The new binary is written next to the existing one so that it is on the same filesystem
+	// and can be renamed over it.
+	tmp, err := ioutil.TempFile(filepath.Dir(exe), "."+filepath.Base(exe)+".update-")
+	if err != nil {
+		return errors.WithStack(err)
+	}
+	defer os.Remove(tmp.Name())
+
+	h := sha256.New()
+	if err := downloadTo(url, io.MultiWriter(tmp, h)); err != nil {
+		tmp.Close()
+		return err
+	}
+
+	if err := tmp.Close(); err != nil {
+		return errors.WithStack(err)
+	}
+
+	if hex.EncodeToString(h.Sum(nil)) != expected {
+		return errors.New(fmt.Sprintf("system: checksum of downloaded %s does not match the release checksums", r.BinaryName()))
+	}
+
+	if err := os.Chmod(tmp.Name(), 0755); err != nil {
+		return errors.WithStack(err)
+	}
+
+	if runtime.GOOS != "windows" {
+		return errors.WithStack(os.Rename(tmp.Name(), exe))
+	}
+
+	// Windows does not allow a running executable to be replaced, but does allow it to be
+	// renamed, so move it out of the way first and put it back if the new binary cannot be
+	// moved into place.
+	old := exe + ".old"
+	_ = os.Remove(old)
+	if err := os.Rename(exe, old); err != nil {
+		return errors.WithStack(err)
+	}
+
+	if err := os.Rename(tmp.Name(), exe); err != nil {
+		if rerr := os.Rename(old, exe); rerr != nil {
+			return errors.Wrap(err, fmt.Sprintf("system: failed to restore previous binary from %s", old))
+		}
+
+		return errors.WithStack(err)
+	}
+
+	return nil
+}
+
+// Downloads the checksums for the release, verifies their signature and returns them
+// keyed by file name.
+func (r *Release) checksums(publicKey string, skipSignature bool) (map[string]string, error) {
+	url, err := r.asset(ChecksumsFile)
+	if err != nil {
+		return nil, err
+	}
+
+	b, err := download(url)
+	if err != nil {
+		return nil, err
+	}
+
+	if !skipSignature {
+		if err := r.verifySignature(b, publicKey); err != nil {
+			return nil, err
+		}
+	}
+
+	out := make(map[string]string)
+	scanner := bufio.NewScanner(bytes.NewReader(b))
+	for scanner.Scan() {
+		// Each line is in the format used by sha256sum, "<checksum>  <file>", where the file
+		// name may be prefixed with an asterisk when generated in binary mode.
+		parts := strings.Fields(scanner.Text())
+		if len(parts) != 2 {
+			continue
+		}
+
+		out[strings.TrimPrefix(parts[1], "*")] = strings.ToLower(parts[0])
+	}
+
+	return out, nil
+}
+
+func (r *Release) verifySignature(checksums []byte, publicKey string) error {
+	if publicKey == "" {
+		return errors.New("system: a public key must be configured to verify release signatures")
+	}
+
+	key, err := base64.StdEncoding.DecodeString(publicKey)
+	if err != nil || len(key) != ed25519.PublicKeySize {
+		return errors.New("system: the configured release public key is not a valid Ed25519 key")
+	}
+
+	url, err := r.asset(SignatureFile)
+	if err != nil {
+		return err
+	}
+
+	sig, err := download(url)
+	if err != nil {
+		return err
+	}
+
+	// Signatures may be published either as raw bytes or base64 encoded.
+	if len(sig) != ed25519.SignatureSize {
+		if sig, err = base64.StdEncoding.DecodeString(strings.TrimSpace(string(sig))); err != nil {
+			return ErrSignatureInvalid
+		}
+	}
+
+	if !ed25519.Verify(ed25519.PublicKey(key), r.signedPayload(checksums), sig) {
+		return ErrSignatureInvalid
+	}
+
+	return nil
+}
+
+// Returns the data that is signed for a release, which is the version of the release on its
+// own line followed by the contents of the checksums file. Including the version prevents the
+// signed checksums of an older release from being served as a newer one.
+func (r *Release) signedPayload(checksums []byte) []byte {
+	return append([]byte("claws "+r.Version()+"\n"), checksums...)
+}
+
+func download(url string) ([]byte, error) {
+	var buf bytes.Buffer
+	if err := downloadTo(url, &buf); err != nil {
+		return nil, err
+	}
+
+	return buf.Bytes(), nil
+}
+
+func downloadTo(url string, w io.Writer) error {
+	req, err := http.NewRequest(http.MethodGet, url, nil)
+	if err != nil {
+		return errors.WithStack(err)
+	}
+	req.Header.Set("User-Agent", fmt.Sprintf("Panther Claws/v%s", Version))
+
+	res, err := updateClient.Do(req)
+	if err != nil {
+		return errors.WithStack(err)
+	}
+	defer res.Body.Close()
+
+	if res.StatusCode != http.StatusOK {
+		return errors.New(fmt.Sprintf("system: request to %s failed with status %d", url, res.StatusCode))
+	}
+
+	_, err = io.Copy(w, res.Body)
+
+	return errors.WithStack(err)
+}
+
+// Compares two dotted version strings, returning a positive number if a is newer than b, a
+// negative number if it is older, and zero if they are the same. Any pre-release suffix is
+// ignored.
+func compareVersions(a string, b string) int {
+	pa, pb := versionParts(a), versionParts(b)
+	for i := 0; i < len(pa) || i < len(pb); i++ {
+		var x, y int
+		if i < len(pa) {
+			x = pa[i]
+		}
+		if i < len(pb) {
+			y = pb[i]
+		}
+
+		if x != y {
+			return x - y
+		}
+	}
+
+	return 0
+}
+
+func versionParts(v string) []int {
+	v = strings.SplitN(strings.SplitN(v, "-", 2)[0], "+", 2)[0]
+
+	var out []int
+	for _, p := range strings.Split(v, ".") {
+		n, _ := strconv.Atoi(p)
+		out = append(out, n)
+	}
+
+	return out
+}